@@ -0,0 +1,114 @@
+package commands
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type adminJob struct {
+	ID        int     `json:"id"`
+	ProjectID int     `json:"project_id"`
+	Project   string  `json:"project,omitempty"`
+	Runner    string  `json:"runner"`
+	Stage     string  `json:"stage"`
+	State     string  `json:"state"`
+	Duration  float64 `json:"duration"`
+}
+
+type adminRunner struct {
+	Name               string `json:"name"`
+	Runner             string `json:"runner"`
+	Builds             int    `json:"builds"`
+	Limit              int    `json:"limit"`
+	Requests           int    `json:"requests"`
+	RequestConcurrency int    `json:"request_concurrency"`
+}
+
+func writeJSON(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(data)
+}
+
+// listJobs lists the running jobs, with the duration in seconds
+func (mr *RunCommand) listJobs() []adminJob {
+	jobs := []adminJob{}
+	for _, build := range mr.buildsHelper.listBuilds() {
+		job := adminJob{
+			ID:        build.ID,
+			ProjectID: build.ProjectID,
+			Runner:    build.Runner.ShortDescription(),
+			Stage:     string(build.CurrentStage),
+			State:     string(build.CurrentState),
+		}
+		if slug, err := build.ProjectSlug(); err == nil {
+			job.Project = strings.TrimPrefix(slug, "/")
+		}
+		if !build.StartedAt.IsZero() {
+			job.Duration = time.Since(build.StartedAt).Seconds()
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs
+}
+
+func (mr *RunCommand) handleJobs(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, mr.listJobs())
+}
+
+// handleJob cancels the job of POST /jobs/<id>/cancel
+func (mr *RunCommand) handleJob(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/jobs/"), "/")
+	if len(parts) != 2 || parts[1] != "cancel" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := strconv.Atoi(parts[0])
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	build := mr.buildsHelper.findBuild(id)
+	if build == nil {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return
+	}
+
+	if !build.Cancel() {
+		http.Error(w, "job already canceled", http.StatusConflict)
+		return
+	}
+
+	build.Log().Warningln("Canceled with the admin socket")
+	writeJSON(w, map[string]string{"status": "canceled"})
+}
+
+// listRunners reports the builds and the requests of the jobs of the
+// runners, with their limits
+func (mr *RunCommand) listRunners() []adminRunner {
+	runners := []adminRunner{}
+	for _, runner := range mr.getConfig().Runners {
+		builds, requests := mr.buildsHelper.runnerUsage(runner)
+		runners = append(runners, adminRunner{
+			Name:               runner.Name,
+			Runner:             runner.ShortDescription(),
+			Builds:             builds,
+			Limit:              runner.Limit,
+			Requests:           requests,
+			RequestConcurrency: runner.GetRequestConcurrency(),
+		})
+	}
+	return runners
+}
+
+func (mr *RunCommand) handleRunners(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, mr.listRunners())
+}
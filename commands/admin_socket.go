@@ -0,0 +1,131 @@
+package commands
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+// adminSocket returns the path of the socket of the local administration of
+// the runner, next to its config file: config.toml has config.sock
+func (c *configOptions) adminSocket() string {
+	return strings.TrimSuffix(c.ConfigFile, filepath.Ext(c.ConfigFile)) + ".sock"
+}
+
+func (mr *RunCommand) isPaused() bool {
+	return atomic.LoadInt32(&mr.paused) != 0
+}
+
+func (mr *RunCommand) setPaused(paused bool) {
+	value := int32(0)
+	if paused {
+		value = 1
+	}
+
+	if atomic.SwapInt32(&mr.paused, value) == value {
+		return
+	}
+
+	if paused {
+		mr.log().Warningln("Paused, no new jobs are requested")
+	} else {
+		mr.log().Println("Resumed, the jobs are requested again")
+	}
+}
+
+func (mr *RunCommand) pollingStatus() string {
+	if mr.isPaused() {
+		return "paused"
+	}
+	return "running"
+}
+
+func (mr *RunCommand) handlePause(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	mr.setPaused(r.URL.Path == "/pause")
+	fmt.Fprintln(w, mr.pollingStatus())
+}
+
+func (mr *RunCommand) handleStatus(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, mr.pollingStatus())
+}
+
+// serveAdminSocket serves the local administration of the runner on the
+// unix socket, only accessible to the user running it
+func (mr *RunCommand) serveAdminSocket() error {
+	socket := mr.adminSocket()
+
+	// remove the socket left by a runner which didn't stop cleanly
+	os.Remove(socket)
+
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return err
+	}
+
+	err = os.Chmod(socket, 0600)
+	if err != nil {
+		listener.Close()
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/pause", mr.handlePause)
+	mux.HandleFunc("/resume", mr.handlePause)
+	mux.HandleFunc("/status", mr.handleStatus)
+	mux.HandleFunc("/jobs", mr.handleJobs)
+	mux.HandleFunc("/jobs/", mr.handleJob)
+	mux.HandleFunc("/runners", mr.handleRunners)
+
+	mr.adminListener = listener
+	go http.Serve(listener, mux)
+
+	return nil
+}
+
+func (mr *RunCommand) closeAdminSocket() {
+	if mr.adminListener != nil {
+		mr.adminListener.Close()
+	}
+}
+
+// requestAdminSocket sends the request to the admin socket of the running
+// runner and returns its response
+func requestAdminSocket(socket, method, path string) (string, error) {
+	client := http.Client{
+		Transport: &http.Transport{
+			Dial: func(network, addr string) (net.Conn, error) {
+				return net.Dial("unix", socket)
+			},
+		},
+	}
+
+	request, err := http.NewRequest(method, "http://gitlab-runner"+path, nil)
+	if err != nil {
+		return "", err
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to the runner at %s, is it running? %v", socket, err)
+	}
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return "", err
+	}
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("request to %s failed: %s", path, response.Status)
+	}
+	return strings.TrimSpace(string(body)), nil
+}
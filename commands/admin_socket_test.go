@@ -0,0 +1,65 @@
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+func TestAdminSocketPath(t *testing.T) {
+	c := configOptions{ConfigFile: "/etc/gitlab-runner/config.toml"}
+	assert.Equal(t, "/etc/gitlab-runner/config.sock", c.adminSocket())
+}
+
+func TestAdminSocketPauseResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "admin-socket")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	runner := &common.RunnerConfig{}
+	mr := &RunCommand{}
+	mr.ConfigFile = filepath.Join(dir, "config.toml")
+	mr.config = &common.Config{Runners: []*common.RunnerConfig{runner}}
+
+	require.NoError(t, mr.serveAdminSocket())
+	defer mr.closeAdminSocket()
+
+	info, err := os.Stat(mr.adminSocket())
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	status, err := requestAdminSocket(mr.adminSocket(), "POST", "/pause")
+	require.NoError(t, err)
+	assert.Equal(t, "paused", status)
+	assert.True(t, mr.isPaused())
+
+	runners := make(chan *common.RunnerConfig, 1)
+	mr.feedRunner(runner, runners)
+	assert.Equal(t, 0, len(runners), "no jobs are requested when paused")
+	assert.EqualError(t, mr.readinessChecks()["polling"], "paused")
+
+	status, err = requestAdminSocket(mr.adminSocket(), "GET", "/status")
+	require.NoError(t, err)
+	assert.Equal(t, "paused", status)
+
+	status, err = requestAdminSocket(mr.adminSocket(), "POST", "/resume")
+	require.NoError(t, err)
+	assert.Equal(t, "running", status)
+
+	mr.feedRunner(runner, runners)
+	assert.Equal(t, 1, len(runners))
+
+	_, err = requestAdminSocket(mr.adminSocket(), "GET", "/pause")
+	assert.EqualError(t, err, "request to /pause failed: 405 Method Not Allowed")
+}
+
+func TestAdminSocketNotRunning(t *testing.T) {
+	_, err := requestAdminSocket("/not/existing/config.sock", "POST", "/pause")
+	assert.Error(t, err)
+}
@@ -1,6 +1,8 @@
 package commands
 
 import (
+	"fmt"
+	"os"
 	"sync"
 
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
@@ -9,6 +11,12 @@ import (
 )
 
 var numBuildsDesc = prometheus.NewDesc("ci_runner_builds", "The current number of running builds.", []string{"state", "stage"}, nil)
+var numRunnerJobsDesc = prometheus.NewDesc("ci_runner_jobs", "The current number of running jobs of each runner.", []string{"runner", "executor"}, nil)
+
+type runnerJobsKey struct {
+	runner   string
+	executor string
+}
 
 type runnerCounter struct {
 	builds   int
@@ -19,6 +27,9 @@ type buildsHelper struct {
 	counters map[string]*runnerCounter
 	builds   []*common.Build
 	lock     sync.Mutex
+	// removed is closed, and replaced, when a build is removed, to wake up
+	// the builds waiting for the project_limit
+	removed chan struct{}
 }
 
 func (b *buildsHelper) getRunnerCounter(runner *common.RunnerConfig) *runnerCounter {
@@ -49,6 +60,55 @@ func (b *buildsHelper) acquireBuild(runner *common.RunnerConfig) bool {
 	return true
 }
 
+// projectLimitReached checks if the project of the build has project_limit
+// builds on the runner
+func (b *buildsHelper) projectLimitReached(build *common.Build) bool {
+	if build.Runner.ProjectLimit <= 0 {
+		return false
+	}
+
+	count := 0
+	for _, otherBuild := range b.builds {
+		if otherBuild.Runner.Token == build.Runner.Token && otherBuild.ProjectID == build.ProjectID {
+			count++
+		}
+	}
+	return count >= build.Runner.ProjectLimit
+}
+
+// addProjectBuild adds the build, once its project has less than
+// project_limit builds on the runner. The project of the job isn't known
+// before it's received, so the job waits in its slot, and the runner keeps
+// requesting the jobs of the other projects. waiting is called once, when
+// the build has to wait.
+func (b *buildsHelper) addProjectBuild(build *common.Build, waiting func(), abort chan os.Signal) error {
+	for {
+		b.lock.Lock()
+		if !b.projectLimitReached(build) {
+			b.addBuildLocked(build)
+			b.lock.Unlock()
+			return nil
+		}
+
+		if b.removed == nil {
+			b.removed = make(chan struct{})
+		}
+		removed := b.removed
+		b.lock.Unlock()
+
+		if waiting != nil {
+			waiting()
+			waiting = nil
+		}
+
+		select {
+		case <-removed:
+		case signal := <-abort:
+			return fmt.Errorf("aborted: %v", signal)
+		}
+	}
+}
+
 func (b *buildsHelper) releaseBuild(runner *common.RunnerConfig) bool {
 	b.lock.Lock()
 	defer b.lock.Unlock()
@@ -91,6 +151,10 @@ func (b *buildsHelper) addBuild(build *common.Build) {
 	b.lock.Lock()
 	defer b.lock.Unlock()
 
+	b.addBuildLocked(build)
+}
+
+func (b *buildsHelper) addBuildLocked(build *common.Build) {
 	runners := make(map[int]bool)
 	projectRunners := make(map[int]bool)
 
@@ -121,7 +185,6 @@ func (b *buildsHelper) addBuild(build *common.Build) {
 	}
 
 	b.builds = append(b.builds, build)
-	return
 }
 
 func (b *buildsHelper) removeBuild(deleteBuild *common.Build) bool {
@@ -131,6 +194,10 @@ func (b *buildsHelper) removeBuild(deleteBuild *common.Build) bool {
 	for idx, build := range b.builds {
 		if build == deleteBuild {
 			b.builds = append(b.builds[0:idx], b.builds[idx+1:]...)
+			if b.removed != nil {
+				close(b.removed)
+				b.removed = nil
+			}
 			return true
 		}
 	}
@@ -144,6 +211,35 @@ func (b *buildsHelper) buildsCount() int {
 	return len(b.builds)
 }
 
+func (b *buildsHelper) listBuilds() []*common.Build {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return append([]*common.Build{}, b.builds...)
+}
+
+func (b *buildsHelper) findBuild(id int) *common.Build {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for _, build := range b.builds {
+		if build.ID == id {
+			return build
+		}
+	}
+	return nil
+}
+
+// runnerUsage returns the number of the builds and of the requests of the
+// jobs of the runner
+func (b *buildsHelper) runnerUsage(runner *common.RunnerConfig) (builds, requests int) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	counter := b.getRunnerCounter(runner)
+	return counter.builds, counter.requests
+}
+
 func (b *buildsHelper) statesAndStages() map[common.BuildRuntimeState]map[common.BuildStage]int {
 	b.lock.Lock()
 	defer b.lock.Unlock()
@@ -161,9 +257,27 @@ func (b *buildsHelper) statesAndStages() map[common.BuildRuntimeState]map[common
 	return data
 }
 
+// runnerJobs returns the number of the running builds of each runner and
+// executor, the executor of the profile selected by the build included
+func (b *buildsHelper) runnerJobs() map[runnerJobsKey]int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	data := make(map[runnerJobsKey]int)
+	for _, build := range b.builds {
+		key := runnerJobsKey{
+			runner:   build.Runner.ShortDescription(),
+			executor: build.Runner.Executor,
+		}
+		data[key]++
+	}
+	return data
+}
+
 // Describe implements prometheus.Collector.
 func (b *buildsHelper) Describe(ch chan<- *prometheus.Desc) {
 	ch <- numBuildsDesc
+	ch <- numRunnerJobsDesc
 }
 
 // Collect implements prometheus.Collector.
@@ -176,4 +290,9 @@ func (b *buildsHelper) Collect(ch chan<- prometheus.Metric) {
 				string(state), string(stage))
 		}
 	}
+
+	for key, count := range b.runnerJobs() {
+		ch <- prometheus.MustNewConstMetric(numRunnerJobsDesc, prometheus.GaugeValue, float64(count),
+			key.runner, key.executor)
+	}
 }
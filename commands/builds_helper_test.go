@@ -1,6 +1,7 @@
 package commands
 
 import (
+	"os"
 	"sync"
 	"testing"
 	"time"
@@ -18,9 +19,10 @@ func TestBuildsHelperCollect(t *testing.T) {
 	b.builds = append(b.builds, &common.Build{
 		CurrentState: common.BuildRunStatePending,
 		CurrentStage: common.BuildStagePrepare,
+		Runner:       &common.RunnerConfig{},
 	})
 	b.Collect(ch)
-	assert.Len(t, ch, 1)
+	assert.Len(t, ch, 2)
 }
 
 func TestBuildsHelperAcquireRequestWithLimit(t *testing.T) {
@@ -202,3 +204,51 @@ func TestBuildHelperCollectWhenRemovingBuild(t *testing.T) {
 	close(finished)
 	wg1.Wait()
 }
+
+func TestBuildsHelperAddProjectBuildWithProjectLimit(t *testing.T) {
+	runner := common.RunnerConfig{
+		ProjectLimit: 1,
+		RunnerCredentials: common.RunnerCredentials{
+			Token: "token",
+		},
+	}
+
+	b := &buildsHelper{}
+	build := &common.Build{Runner: &runner}
+	build.ProjectID = 1
+	require.NoError(t, b.addProjectBuild(build, nil, nil))
+	require.True(t, b.acquireBuild(&runner), "the runner still requests jobs")
+
+	other := &common.Build{Runner: &runner}
+	other.ProjectID = 2
+	require.NoError(t, b.addProjectBuild(other, nil, nil), "the jobs of the other projects aren't blocked")
+
+	waiting := make(chan bool, 1)
+	added := make(chan error, 1)
+	next := &common.Build{Runner: &runner}
+	next.ProjectID = 1
+	go func() {
+		added <- b.addProjectBuild(next, func() { waiting <- true }, nil)
+	}()
+
+	<-waiting
+	assert.Equal(t, 2, b.buildsCount(), "allow only one build of the project")
+
+	b.removeBuild(build)
+	require.NoError(t, <-added)
+	assert.Equal(t, 2, b.buildsCount())
+}
+
+func TestBuildsHelperAddProjectBuildAborted(t *testing.T) {
+	runner := common.RunnerConfig{ProjectLimit: 1}
+
+	b := &buildsHelper{}
+	build := &common.Build{Runner: &runner}
+	require.NoError(t, b.addProjectBuild(build, nil, nil))
+
+	abort := make(chan os.Signal, 1)
+	abort <- os.Interrupt
+	err := b.addProjectBuild(&common.Build{Runner: &runner}, nil, abort)
+	assert.EqualError(t, err, "aborted: interrupt")
+	assert.Equal(t, 1, b.buildsCount())
+}
@@ -68,6 +68,8 @@ type configOptionsWithMetricsServer struct {
 	configOptions
 
 	MetricsServerAddress string `long:"metrics-server" env:"METRICS_SERVER" description:"Metrics server listening address"`
+	HealthServerAddress  string `long:"health-server" env:"HEALTH_SERVER" description:"Health server listening address, serving /healthz and /readyz"`
+	DebugServerAddress   string `long:"debug-server" env:"DEBUG_SERVER" description:"Debug server listening address, serving the profiles and the state of the runner"`
 }
 
 func (c *configOptionsWithMetricsServer) metricsServerAddress() string {
@@ -78,6 +80,32 @@ func (c *configOptionsWithMetricsServer) metricsServerAddress() string {
 	return c.config.MetricsServerAddress
 }
 
+func (c *configOptionsWithMetricsServer) healthServerAddress() string {
+	if c.HealthServerAddress != "" {
+		return c.HealthServerAddress
+	}
+
+	return c.config.HealthServerAddress
+}
+
+func (c *configOptionsWithMetricsServer) debugServerAddress() string {
+	if c.DebugServerAddress != "" {
+		return c.DebugServerAddress
+	}
+
+	return c.config.DebugServerAddress
+}
+
+// spoolDir returns the spool_dir of the config, or the spool directory next
+// to the config file
+func (c *configOptions) spoolDir() string {
+	if c.config.SpoolDir != "" {
+		return c.config.SpoolDir
+	}
+
+	return filepath.Join(filepath.Dir(c.ConfigFile), "spool")
+}
+
 func init() {
 	configFile := os.Getenv("CONFIG_FILE")
 	if configFile == "" {
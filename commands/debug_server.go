@@ -0,0 +1,111 @@
+package commands
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+type debugMemory struct {
+	Alloc        uint64 `json:"alloc"`
+	HeapInuse    uint64 `json:"heap_inuse"`
+	HeapObjects  uint64 `json:"heap_objects"`
+	Sys          uint64 `json:"sys"`
+	NumGC        uint32 `json:"num_gc"`
+	PauseTotalNs uint64 `json:"pause_total_ns"`
+}
+
+type debugState struct {
+	Uptime     float64       `json:"uptime"`
+	Status     string        `json:"status"`
+	Goroutines int           `json:"goroutines"`
+	Workers    int           `json:"workers"`
+	Concurrent int           `json:"concurrent"`
+	Memory     debugMemory   `json:"memory"`
+	Jobs       []adminJob    `json:"jobs"`
+	Runners    []adminRunner `json:"runners"`
+}
+
+// handleDebugState writes a snapshot of the state of the runner: the memory,
+// the goroutines, the running jobs and the requests of the jobs of the
+// runners
+func (mr *RunCommand) handleDebugState(w http.ResponseWriter, r *http.Request) {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+
+	state := debugState{
+		Status:     mr.pollingStatus(),
+		Goroutines: runtime.NumGoroutine(),
+		Workers:    mr.currentWorkers,
+		Concurrent: mr.config.Concurrent,
+		Memory: debugMemory{
+			Alloc:        memStats.Alloc,
+			HeapInuse:    memStats.HeapInuse,
+			HeapObjects:  memStats.HeapObjects,
+			Sys:          memStats.Sys,
+			NumGC:        memStats.NumGC,
+			PauseTotalNs: memStats.PauseTotalNs,
+		},
+		Jobs:    mr.listJobs(),
+		Runners: mr.listRunners(),
+	}
+	if !mr.startedAt.IsZero() {
+		state.Uptime = time.Since(mr.startedAt).Seconds()
+	}
+
+	writeJSON(w, state)
+}
+
+// authorizeDebug requires the debug_server_token of the config as the bearer
+// token of the requests, read on each request to follow the reloads
+func (mr *RunCommand) authorizeDebug(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := mr.config.DebugServerToken
+		given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func (mr *RunCommand) debugHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/debug/state", mr.handleDebugState)
+	return mr.authorizeDebug(mux)
+}
+
+// serveDebug serves the profiles, the goroutine dumps and the state of the
+// runner, to diagnose the runner managers in production. The requests must
+// be authorized with the debug_server_token.
+func (mr *RunCommand) serveDebug() error {
+	if mr.config.DebugServerToken == "" {
+		return errors.New("the debug server requires the debug_server_token")
+	}
+
+	listener, err := net.Listen("tcp", mr.debugServerAddress())
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		log.Fatalln(http.Serve(listener, mr.debugHandler()))
+	}()
+
+	return nil
+}
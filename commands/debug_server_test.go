@@ -0,0 +1,60 @@
+package commands
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+func debugRequest(mr *RunCommand, path, token string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest("GET", path, nil)
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	recorder := httptest.NewRecorder()
+	mr.debugHandler().ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestDebugServerRequiresToken(t *testing.T) {
+	mr := &RunCommand{}
+	mr.config = &common.Config{DebugServerToken: "secret"}
+
+	assert.Equal(t, http.StatusUnauthorized, debugRequest(mr, "/debug/state", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, debugRequest(mr, "/debug/pprof/", "wrong").Code)
+	assert.Equal(t, http.StatusOK, debugRequest(mr, "/debug/pprof/", "secret").Code)
+
+	mr.config = &common.Config{}
+	assert.Equal(t, http.StatusUnauthorized, debugRequest(mr, "/debug/state", "").Code)
+	assert.Error(t, mr.serveDebug())
+}
+
+func TestDebugServerState(t *testing.T) {
+	runner := &common.RunnerConfig{
+		Name:              "runner",
+		RunnerCredentials: common.RunnerCredentials{Token: "a1b2c3d4e5"},
+	}
+	mr := &RunCommand{}
+	mr.config = &common.Config{Concurrent: 2, DebugServerToken: "secret", Runners: []*common.RunnerConfig{runner}}
+	mr.buildsHelper.acquireRequest(runner)
+
+	recorder := debugRequest(mr, "/debug/state", "secret")
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var state debugState
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &state))
+	assert.Equal(t, "running", state.Status)
+	assert.Equal(t, 2, state.Concurrent)
+	assert.True(t, state.Goroutines > 0)
+	assert.True(t, state.Memory.Alloc > 0)
+	assert.Empty(t, state.Jobs)
+	require.Equal(t, 1, len(state.Runners))
+	assert.Equal(t, 1, state.Runners[0].Requests)
+}
@@ -6,26 +6,37 @@ import (
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/codegangsta/cli"
 	"gitlab.com/ayufan/golang-cli-helpers"
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers"
 	"gopkg.in/yaml.v2"
 
 	// Force to load all executors, executes init() on them
+	_ "gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors/custom"
 	_ "gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors/docker"
+	_ "gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors/fargate"
+	_ "gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors/gcpbatch"
+	_ "gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors/lxd"
 	_ "gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors/parallels"
+	_ "gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors/podman"
 	_ "gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors/shell"
 	_ "gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors/ssh"
 	_ "gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors/virtualbox"
+	_ "gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors/wsl"
 )
 
 type ExecCommand struct {
 	common.RunnerSettings
-	Job     string
-	Timeout int `long:"timeout" description:"Job execution timeout (in seconds)"`
+	Job         string
+	Timeout     int    `long:"timeout" description:"Job execution timeout (in seconds)"`
+	Workspace   string `long:"workspace" description:"Directory keeping the cache and the artifacts of the jobs, to share them between the jobs run locally"`
+	EnvFile     string `long:"env-file" description:"File of variables added to the job, a KEY=value on every line"`
+	SecretsFile string `long:"secrets-file" description:"File of secret variables added to the job, like --env-file, masked in the output"`
 }
 
 func (c *ExecCommand) runCommand(name string, arg ...string) (string, error) {
@@ -36,69 +47,86 @@ func (c *ExecCommand) runCommand(name string, arg ...string) (string, error) {
 	return string(result), err
 }
 
-func (c *ExecCommand) getCommands(commands interface{}) (string, error) {
-	if lines, ok := commands.([]interface{}); ok {
-		text := ""
-		for _, line := range lines {
-			if lineText, ok := line.(string); ok {
-				text += lineText + "\n"
-			} else {
-				return "", errors.New("unsupported script")
+func (c *ExecCommand) getCommandLines(commands interface{}) (lines []string, err error) {
+	switch commands := commands.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{commands}, nil
+	case []interface{}:
+		for _, command := range commands {
+			if command == nil {
+				return nil, errors.New("unsupported script")
 			}
+			// the lists of the YAML anchors are nested in the scripts
+			commandLines, err := c.getCommandLines(command)
+			if err != nil {
+				return nil, err
+			}
+			lines = append(lines, commandLines...)
 		}
-		return text + "\n", nil
-	} else if text, ok := commands.(string); ok {
-		return text + "\n", nil
-	} else if commands != nil {
-		return "", errors.New("unsupported script")
+		return lines, nil
+	default:
+		return nil, errors.New("unsupported script")
 	}
-	return "", nil
 }
 
-func (c *ExecCommand) supportedOption(key string, _ interface{}) bool {
-	switch key {
-	case "image", "services", "artifacts", "cache", "after_script":
-		return true
-	default:
-		return false
+func (c *ExecCommand) getCommands(commands interface{}) (string, error) {
+	lines, err := c.getCommandLines(commands)
+	if err != nil || len(lines) == 0 {
+		return "", err
 	}
+	return strings.Join(lines, "\n") + "\n", nil
 }
 
-func (c *ExecCommand) buildCommands(configBeforeScript, jobConfigBeforeScript, jobScript interface{}) (commands string, err error) {
-	// get before_script
-	beforeScript, err := c.getCommands(configBeforeScript)
-	if err != nil {
-		return
+// getKeyword returns the keyword from the first of the configs having it,
+// like the job, the default section and the top level of .gitlab-ci.yml
+func (c *ExecCommand) getKeyword(key string, configs ...common.BuildOptions) interface{} {
+	for _, config := range configs {
+		if value, ok := config[key]; ok {
+			return value
+		}
 	}
+	return nil
+}
 
-	// get job before_script
-	jobBeforeScript, err := c.getCommands(jobConfigBeforeScript)
+func (c *ExecCommand) buildCommands(beforeScript, jobScript interface{}) (commands string, err error) {
+	commands, err = c.getCommands(beforeScript)
 	if err != nil {
 		return
 	}
 
-	if jobBeforeScript == "" {
-		commands += beforeScript
-	} else {
-		commands += jobBeforeScript
+	if jobScript == nil {
+		err = fmt.Errorf("missing 'script' for job")
+		return
 	}
 
-	// get script
 	script, err := c.getCommands(jobScript)
 	if err != nil {
 		return
-	} else if jobScript == nil {
-		err = fmt.Errorf("missing 'script' for job")
-		return
 	}
 	commands += script
 	return
 }
 
+func (c *ExecCommand) getVariableValue(value interface{}) (string, bool) {
+	switch value := value.(type) {
+	case string:
+		return value, true
+	case int, float64, bool:
+		return fmt.Sprint(value), true
+	case map[string]interface{}:
+		// the variables with a description of the pipelines run manually
+		return c.getVariableValue(value["value"])
+	default:
+		return "", false
+	}
+}
+
 func (c *ExecCommand) buildVariables(configVariables interface{}) (buildVariables common.BuildVariables, err error) {
 	if variables, ok := configVariables.(map[string]interface{}); ok {
 		for key, value := range variables {
-			if valueText, ok := value.(string); ok {
+			if valueText, ok := c.getVariableValue(value); ok {
 				buildVariables = append(buildVariables, common.BuildVariable{
 					Key:    key,
 					Value:  valueText,
@@ -129,22 +157,74 @@ func (c *ExecCommand) buildGlobalAndJobVariables(global, job interface{}) (build
 	return
 }
 
-func (c *ExecCommand) buildOptions(config, jobConfig common.BuildOptions) (options common.BuildOptions, err error) {
+// getImageName returns the name of the image given as a string, or as a
+// map with the name and the options the executors don't support
+func (c *ExecCommand) getImageName(kind string, image interface{}) (string, error) {
+	switch image := image.(type) {
+	case string:
+		return image, nil
+	case map[string]interface{}:
+		name, ok := image["name"].(string)
+		if !ok {
+			return "", fmt.Errorf("missing name of %s", kind)
+		}
+		for key := range image {
+			if key != "name" {
+				logrus.Warningln("The", key, "of the", kind, name, "is not supported, ignoring it")
+			}
+		}
+		return name, nil
+	default:
+		return "", fmt.Errorf("unsupported %s", kind)
+	}
+}
+
+func (c *ExecCommand) buildServices(configServices interface{}) (services []interface{}, err error) {
+	list, ok := configServices.([]interface{})
+	if !ok {
+		return nil, errors.New("unsupported services")
+	}
+
+	for _, service := range list {
+		name, err := c.getImageName("service", service)
+		if err != nil {
+			return nil, err
+		}
+		services = append(services, name)
+	}
+	return services, nil
+}
+
+func (c *ExecCommand) buildOptions(configs ...common.BuildOptions) (options common.BuildOptions, err error) {
 	options = make(common.BuildOptions)
 
-	// parse global options
-	for key, value := range config {
-		if c.supportedOption(key, value) {
+	for _, key := range []string{"artifacts", "cache"} {
+		if value := c.getKeyword(key, configs...); value != nil {
 			options[key] = value
 		}
 	}
 
-	// parse job options
-	for key, value := range jobConfig {
-		if c.supportedOption(key, value) {
-			options[key] = value
+	if image := c.getKeyword("image", configs...); image != nil {
+		options["image"], err = c.getImageName("image", image)
+		if err != nil {
+			return
+		}
+	}
+
+	if services := c.getKeyword("services", configs...); services != nil {
+		options["services"], err = c.buildServices(services)
+		if err != nil {
+			return
 		}
 	}
+
+	afterScript, err := c.getCommandLines(c.getKeyword("after_script", configs...))
+	if err != nil {
+		return
+	}
+	if len(afterScript) > 0 {
+		options["after_script"] = afterScript
+	}
 	return
 }
 
@@ -154,11 +234,15 @@ func (c *ExecCommand) parseYaml(job string, build *common.GetBuildResponse) erro
 		return err
 	}
 
+	return c.parseConfig(data, job, build)
+}
+
+func (c *ExecCommand) parseConfig(data []byte, job string, build *common.GetBuildResponse) error {
 	build.Name = job
 
 	// parse gitlab-ci.yml
 	config := make(common.BuildOptions)
-	err = yaml.Unmarshal(data, config)
+	err := yaml.Unmarshal(data, config)
 	if err != nil {
 		return err
 	}
@@ -173,8 +257,16 @@ func (c *ExecCommand) parseYaml(job string, build *common.GetBuildResponse) erro
 	if !ok {
 		return fmt.Errorf("no job named %q", job)
 	}
+	if _, ok := jobConfig["extends"]; ok {
+		logrus.Warningln("The extends keyword is not supported, ignoring it")
+	}
+
+	// the keywords of the job default to the ones of the default section,
+	// and then to the ones at the top level
+	defaultConfig, _ := config.GetSubOptions("default")
+	configs := []common.BuildOptions{jobConfig, defaultConfig, config}
 
-	build.Commands, err = c.buildCommands(config["before_script"], jobConfig["before_script"], jobConfig["script"])
+	build.Commands, err = c.buildCommands(c.getKeyword("before_script", configs...), jobConfig["script"])
 	if err != nil {
 		return err
 	}
@@ -184,19 +276,160 @@ func (c *ExecCommand) parseYaml(job string, build *common.GetBuildResponse) erro
 		return err
 	}
 
-	build.Options, err = c.buildOptions(config, jobConfig)
+	build.Options, err = c.buildOptions(configs...)
 	if err != nil {
 		return err
 	}
 
-	if stage, ok := jobConfig.GetString("stage"); ok {
-		build.Stage = stage
-	} else {
-		build.Stage = "test"
+	build.Stage = c.getStage(jobConfig)
+
+	build.DependsOnBuilds, err = c.buildDependencies(config, jobConfig, build.Stage)
+	if err != nil {
+		return err
 	}
 	return nil
 }
 
+func (c *ExecCommand) getStage(jobConfig common.BuildOptions) string {
+	if stage, ok := jobConfig.GetString("stage"); ok {
+		return stage
+	}
+	return "test"
+}
+
+func (c *ExecCommand) getStages(config common.BuildOptions) (stages []string) {
+	configStages, ok := config["stages"].([]interface{})
+	if !ok {
+		return []string{".pre", "build", "test", "deploy", ".post"}
+	}
+
+	stages = append(stages, ".pre")
+	for _, stage := range configStages {
+		if name, ok := stage.(string); ok {
+			stages = append(stages, name)
+		}
+	}
+	return append(stages, ".post")
+}
+
+// buildDependencies returns the jobs the artifacts of which are given to
+// the job: the ones of its dependencies, or else the ones of the earlier
+// stages, like GitLab does
+func (c *ExecCommand) buildDependencies(config, jobConfig common.BuildOptions, stage string) (dependencies []common.BuildInfo, err error) {
+	if configDependencies, ok := jobConfig["dependencies"]; ok {
+		list, ok := configDependencies.([]interface{})
+		if !ok {
+			return nil, errors.New("unsupported dependencies")
+		}
+		for _, dependency := range list {
+			name, ok := dependency.(string)
+			if !ok {
+				return nil, errors.New("unsupported dependencies")
+			}
+			dependencies = append(dependencies, common.BuildInfo{Name: name})
+		}
+		return dependencies, nil
+	}
+
+	stageIndex := make(map[string]int)
+	for i, name := range c.getStages(config) {
+		stageIndex[name] = i
+	}
+
+	for name := range config {
+		otherJob, ok := config.GetSubOptions(name)
+		if !ok || strings.HasPrefix(name, ".") || otherJob["script"] == nil {
+			continue
+		}
+
+		otherStage := c.getStage(otherJob)
+		if stageIndex[otherStage] < stageIndex[stage] {
+			dependencies = append(dependencies, common.BuildInfo{Name: name, Stage: otherStage})
+		}
+	}
+	return dependencies, nil
+}
+
+// addLocalArtifacts keeps the dependencies the artifacts of which are in
+// the workspace, saved by the jobs run before
+func (c *ExecCommand) addLocalArtifacts(build *common.Build) {
+	cacheDir := filepath.Join(c.CacheDir, build.ProjectUniqueDir(false))
+
+	var dependencies []common.BuildInfo
+	for _, dependency := range build.DependsOnBuilds {
+		file := filepath.FromSlash(common.LocalArtifactsFile(cacheDir, dependency.Name))
+		if _, err := os.Stat(file); err != nil {
+			continue
+		}
+
+		dependency.Artifacts = &common.BuildArtifacts{Filename: filepath.Base(file)}
+		dependencies = append(dependencies, dependency)
+	}
+	build.DependsOnBuilds = dependencies
+}
+
+// readVariablesFile reads the variables of the file, a KEY=value on every
+// line, like the .env files: the empty lines and the comments are skipped,
+// and the values can be quoted
+func (c *ExecCommand) readVariablesFile(file string) (variables common.BuildVariables, err error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		variable, err := common.ParseVariable(strings.TrimPrefix(line, "export "))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", file, i+1, err)
+		}
+
+		variable.Key = strings.TrimSpace(variable.Key)
+		variable.Value = strings.TrimSpace(variable.Value)
+		if len(variable.Value) >= 2 && (variable.Value[0] == '"' || variable.Value[0] == '\'') &&
+			variable.Value[len(variable.Value)-1] == variable.Value[0] {
+			variable.Value = variable.Value[1 : len(variable.Value)-1]
+		}
+		variables = append(variables, variable)
+	}
+	return variables, nil
+}
+
+// addVariablesFiles adds the variables of --env-file and --secrets-file to
+// the job, and returns the secrets to mask in the output
+func (c *ExecCommand) addVariablesFiles(build *common.Build) (secrets []string, err error) {
+	if c.EnvFile != "" {
+		variables, err := c.readVariablesFile(c.EnvFile)
+		if err != nil {
+			return nil, err
+		}
+		for _, variable := range variables {
+			variable.Public = true
+			build.Variables = append(build.Variables, variable)
+		}
+	}
+
+	if c.SecretsFile != "" {
+		variables, err := c.readVariablesFile(c.SecretsFile)
+		if err != nil {
+			return nil, err
+		}
+		for _, variable := range variables {
+			if len(variable.Value) < helpers.MinMaskedLength {
+				logrus.Warningln("The secret", variable.Key, "is shorter than", helpers.MinMaskedLength, "characters and is not masked")
+			}
+			variable.Masked = true
+			build.Variables = append(build.Variables, variable)
+			secrets = append(secrets, variable.Value)
+		}
+	}
+	return secrets, nil
+}
+
 func (c *ExecCommand) createBuild(repoURL string, abortSignal chan os.Signal) (build *common.Build, err error) {
 	// Check if we have uncommitted changes
 	_, err = c.runCommand("git", "diff", "--quiet", "HEAD")
@@ -281,6 +514,17 @@ func (c *ExecCommand) Execute(context *cli.Context) {
 	}
 	c.RunnerSettings.Docker.Volumes = append(c.RunnerSettings.Docker.Volumes, wd+":"+wd+":ro")
 
+	// Keep the cache and the artifacts in the workspace, mounted at the
+	// same path in the containers
+	if c.Workspace != "" {
+		workspace, err := filepath.Abs(c.Workspace)
+		if err != nil {
+			logrus.Fatalln(err)
+		}
+		c.CacheDir = workspace
+		c.RunnerSettings.Docker.Volumes = append(c.RunnerSettings.Docker.Volumes, workspace+":"+workspace)
+	}
+
 	// Create build
 	build, err := c.createBuild(wd, abortSignal)
 	if err != nil {
@@ -292,7 +536,20 @@ func (c *ExecCommand) Execute(context *cli.Context) {
 		logrus.Fatalln(err)
 	}
 
-	err = build.Run(&common.Config{}, &common.Trace{Writer: os.Stdout})
+	if c.Workspace != "" {
+		c.addLocalArtifacts(build)
+	} else {
+		build.DependsOnBuilds = nil
+	}
+
+	secrets, err := c.addVariablesFiles(build)
+	if err != nil {
+		logrus.Fatalln(err)
+	}
+
+	output := helpers.NewMaskWriter(os.Stdout, secrets)
+	err = build.Run(&common.Config{}, &common.Trace{Writer: output})
+	output.Close()
 	if err != nil {
 		logrus.Fatalln(err)
 	}
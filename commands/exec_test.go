@@ -0,0 +1,218 @@
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+const execTestConfig = `
+variables:
+  DATABASE: postgres
+  PORT: 5432
+
+.setup: &setup
+  - bundle install
+  - rake db:create
+
+default:
+  image: ruby:2.7
+  services:
+    - name: postgres:12
+      alias: db
+  before_script:
+    - *setup
+    - echo default
+  after_script:
+    - echo cleanup
+
+before_script:
+  - echo global
+
+rspec:
+  stage: test
+  variables:
+    PORT: 5433
+    VERBOSE:
+      value: "true"
+      description: Verbose output
+  script:
+    - rspec
+
+lint:
+  image:
+    name: golangci/golangci-lint
+    entrypoint: [""]
+  before_script: []
+  script: golangci-lint run
+`
+
+func TestExecParseConfig(t *testing.T) {
+	c := &ExecCommand{}
+	build := &common.GetBuildResponse{}
+
+	err := c.parseConfig([]byte(execTestConfig), "rspec", build)
+	require.NoError(t, err)
+	assert.Equal(t, "rspec", build.Name)
+	assert.Equal(t, "test", build.Stage)
+	assert.Equal(t, "bundle install\nrake db:create\necho default\nrspec\n", build.Commands)
+
+	variables := build.Variables
+	assert.Equal(t, "postgres", variables.Get("DATABASE"))
+	assert.Equal(t, "5433", variables.Get("PORT"))
+	assert.Equal(t, "true", variables.Get("VERBOSE"))
+
+	image, _ := build.Options.GetString("image")
+	assert.Equal(t, "ruby:2.7", image)
+	assert.Equal(t, []interface{}{"postgres:12"}, build.Options["services"])
+	assert.Equal(t, []string{"echo cleanup"}, build.Options["after_script"])
+}
+
+func TestExecParseConfigJobKeywords(t *testing.T) {
+	c := &ExecCommand{}
+	build := &common.GetBuildResponse{}
+
+	err := c.parseConfig([]byte(execTestConfig), "lint", build)
+	require.NoError(t, err)
+	assert.Equal(t, "golangci-lint run\n", build.Commands)
+
+	image, _ := build.Options.GetString("image")
+	assert.Equal(t, "golangci/golangci-lint", image)
+}
+
+func TestExecParseConfigErrors(t *testing.T) {
+	tests := map[string]string{
+		"no job named \"missing\"":         "test:\n  script: make\n",
+		"missing 'script' for job":         "missing:\n  stage: test\n",
+		"unsupported script":               "missing:\n  script:\n    - make: test\n",
+		"invalid value for variable \"A\"": "missing:\n  script: make\n  variables:\n    A: [1]\n",
+		"missing name of service":          "missing:\n  script: make\n  services:\n    - alias: db\n",
+	}
+
+	for expected, config := range tests {
+		c := &ExecCommand{}
+		err := c.parseConfig([]byte(config), "missing", &common.GetBuildResponse{})
+		assert.EqualError(t, err, expected)
+	}
+}
+
+const execTestPipeline = `
+stages: [build, test, deploy]
+
+build:
+  stage: build
+  script: make
+
+docs:
+  stage: build
+  script: make docs
+
+.template:
+  stage: build
+  script: echo template
+
+test:
+  script: make test
+
+deploy:
+  stage: deploy
+  dependencies: [build]
+  script: make deploy
+`
+
+func getDependencyNames(build *common.GetBuildResponse) (names []string) {
+	for _, dependency := range build.DependsOnBuilds {
+		names = append(names, dependency.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestExecDependencies(t *testing.T) {
+	tests := map[string][]string{
+		"build":  nil,
+		"test":   {"build", "docs"},
+		"deploy": {"build"},
+	}
+
+	for job, expected := range tests {
+		c := &ExecCommand{}
+		build := &common.GetBuildResponse{}
+
+		err := c.parseConfig([]byte(execTestPipeline), job, build)
+		require.NoError(t, err)
+		assert.Equal(t, expected, getDependencyNames(build), job)
+	}
+}
+
+func TestExecAddLocalArtifacts(t *testing.T) {
+	workspace, err := ioutil.TempDir("", "exec-workspace")
+	require.NoError(t, err)
+	defer os.RemoveAll(workspace)
+
+	c := &ExecCommand{}
+	c.CacheDir = workspace
+	build := &common.Build{
+		GetBuildResponse: common.GetBuildResponse{
+			ProjectID:       1,
+			DependsOnBuilds: []common.BuildInfo{{Name: "build"}, {Name: "docs"}},
+		},
+		Runner: &common.RunnerConfig{},
+	}
+
+	file := filepath.Join(workspace, "project-1", "artifacts", "build", "artifacts.zip")
+	require.NoError(t, os.MkdirAll(filepath.Dir(file), 0700))
+	require.NoError(t, ioutil.WriteFile(file, []byte("zip"), 0600))
+
+	c.addLocalArtifacts(build)
+	require.Equal(t, 1, len(build.DependsOnBuilds))
+	assert.Equal(t, "build", build.DependsOnBuilds[0].Name)
+	assert.Equal(t, "artifacts.zip", build.DependsOnBuilds[0].Artifacts.Filename)
+}
+
+func writeExecTestFile(t *testing.T, dir, name, content string) string {
+	file := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(file, []byte(content), 0600))
+	return file
+}
+
+func TestExecAddVariablesFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "exec-variables")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	c := &ExecCommand{
+		EnvFile:     writeExecTestFile(t, dir, "env", "# settings\nDATABASE=postgres\n\nexport GREETING=\"hello world\"\n"),
+		SecretsFile: writeExecTestFile(t, dir, "secrets", "TOKEN='token-1234567890'\nPIN=1234\n"),
+	}
+	build := &common.Build{Runner: &common.RunnerConfig{}}
+
+	secrets, err := c.addVariablesFiles(build)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"token-1234567890", "1234"}, secrets)
+	assert.Equal(t, common.BuildVariables{
+		{Key: "DATABASE", Value: "postgres", Public: true},
+		{Key: "GREETING", Value: "hello world", Public: true},
+		{Key: "TOKEN", Value: "token-1234567890", Masked: true},
+		{Key: "PIN", Value: "1234", Masked: true},
+	}, build.Variables)
+}
+
+func TestExecAddVariablesFilesInvalidLine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "exec-variables")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	file := writeExecTestFile(t, dir, "env", "A=1\nINVALID\n")
+	c := &ExecCommand{EnvFile: file}
+
+	_, err = c.addVariablesFiles(&common.Build{Runner: &common.RunnerConfig{}})
+	assert.EqualError(t, err, file+":2: missing =")
+}
@@ -11,11 +11,19 @@ import (
 type healthData struct {
 	failures  int
 	lastCheck time.Time
+	// succeeded is set when one of the requests of the runner succeeded
+	succeeded bool
 }
 
 type healthHelper struct {
 	healthy     map[string]*healthData
 	healthyLock sync.Mutex
+
+	// instances is the health of the GitLab instances, by their URL
+	instances map[string]*healthData
+
+	// configError is the error of the last load of the config
+	configError error
 }
 
 func (mr *healthHelper) getHealth(id string) *healthData {
@@ -59,6 +67,7 @@ func (mr *healthHelper) makeHealthy(id string, healthy bool) {
 	if healthy {
 		health.failures = 0
 		health.lastCheck = time.Now()
+		health.succeeded = true
 	} else {
 		health.failures++
 		if health.failures >= common.HealthyChecks {
@@ -66,3 +75,90 @@ func (mr *healthHelper) makeHealthy(id string, healthy bool) {
 		}
 	}
 }
+
+func (mr *healthHelper) getInstanceHealth(url string) *healthData {
+	if mr.instances == nil {
+		mr.instances = map[string]*healthData{}
+	}
+	health := mr.instances[url]
+	if health == nil {
+		health = &healthData{}
+		mr.instances[url] = health
+	}
+	return health
+}
+
+// isInstanceReachable checks if the GitLab instance answered one of its last
+// HealthyChecks requests. The runners of an unreachable instance are skipped
+// for UnreachableInstanceCheckInterval, then the instance is checked again.
+func (mr *healthHelper) isInstanceReachable(url string) bool {
+	mr.healthyLock.Lock()
+	defer mr.healthyLock.Unlock()
+
+	health := mr.getInstanceHealth(url)
+	if health.failures < common.HealthyChecks {
+		return true
+	}
+
+	return time.Since(health.lastCheck) > common.UnreachableInstanceCheckInterval*time.Second
+}
+
+func (mr *healthHelper) makeInstanceReachable(url string, reachable bool) {
+	mr.healthyLock.Lock()
+	defer mr.healthyLock.Unlock()
+
+	health := mr.getInstanceHealth(url)
+	health.lastCheck = time.Now()
+	if reachable {
+		health.failures = 0
+		return
+	}
+
+	health.failures++
+	if health.failures == common.HealthyChecks {
+		logrus.Errorln("GitLab instance", url, "is not reachable, its runners will be skipped for",
+			common.UnreachableInstanceCheckInterval, "seconds")
+	}
+}
+
+// countHealthy returns the number of the runners which requested jobs
+// successfully, and are not disabled because of the failures of the requests
+func (mr *healthHelper) countHealthy(runners []*common.RunnerConfig) int {
+	mr.healthyLock.Lock()
+	defer mr.healthyLock.Unlock()
+
+	count := 0
+	for _, runner := range runners {
+		health := mr.getHealth(runner.UniqueID())
+		if health.succeeded && health.failures < common.HealthyChecks {
+			count++
+		}
+	}
+	return count
+}
+
+// resetHealth enables the runners again, when the config is reloaded. The
+// runners which requested jobs successfully are still reported as such.
+func (mr *healthHelper) resetHealth() {
+	mr.healthyLock.Lock()
+	defer mr.healthyLock.Unlock()
+
+	for _, health := range mr.healthy {
+		health.failures = 0
+		health.lastCheck = time.Now()
+	}
+}
+
+func (mr *healthHelper) setConfigError(err error) {
+	mr.healthyLock.Lock()
+	defer mr.healthyLock.Unlock()
+
+	mr.configError = err
+}
+
+func (mr *healthHelper) getConfigError() error {
+	mr.healthyLock.Lock()
+	defer mr.healthyLock.Unlock()
+
+	return mr.configError
+}
@@ -0,0 +1,27 @@
+package commands
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+func TestUnreachableInstanceIsSkipped(t *testing.T) {
+	url := "http://gitlab.example.com/"
+	h := &healthHelper{}
+
+	for i := 0; i < common.HealthyChecks; i++ {
+		assert.True(t, h.isInstanceReachable(url))
+		h.makeInstanceReachable(url, false)
+	}
+	assert.False(t, h.isInstanceReachable(url))
+
+	h.instances[url].lastCheck = time.Now().Add(-common.UnreachableInstanceCheckInterval * time.Second * 2)
+	assert.True(t, h.isInstanceReachable(url), "the instance is checked again")
+
+	h.makeInstanceReachable(url, true)
+	assert.True(t, h.isInstanceReachable(url))
+}
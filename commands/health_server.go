@@ -0,0 +1,83 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// readinessChecks returns the checks of the readiness of the runner: the
+// config is loaded, at least one runner requested jobs from GitLab and the
+// jobs are requested
+func (mr *RunCommand) readinessChecks() map[string]error {
+	checks := map[string]error{
+		"config":  mr.getConfigError(),
+		"gitlab":  nil,
+		"polling": nil,
+	}
+
+	config := mr.getConfig()
+	if config == nil || len(config.Runners) == 0 {
+		checks["gitlab"] = errors.New("no runners configured")
+		checks["polling"] = errors.New("no runners configured")
+		return checks
+	}
+
+	if mr.countHealthy(config.Runners) == 0 {
+		checks["gitlab"] = errors.New("no runner requested jobs successfully")
+	}
+	if stopSignal := mr.getStopSignal(); stopSignal != nil {
+		checks["polling"] = fmt.Errorf("stopping on %v signal", stopSignal)
+	} else if mr.isPaused() {
+		checks["polling"] = errors.New("paused")
+	}
+	return checks
+}
+
+func (mr *RunCommand) handleLiveness(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, "ok")
+}
+
+// handleReadiness writes the result of each check, with the 503 status if
+// one of them failed
+func (mr *RunCommand) handleReadiness(w http.ResponseWriter, r *http.Request) {
+	checks := mr.readinessChecks()
+
+	status := http.StatusOK
+	for _, err := range checks {
+		if err != nil {
+			status = http.StatusServiceUnavailable
+		}
+	}
+	w.WriteHeader(status)
+
+	for _, name := range []string{"config", "gitlab", "polling"} {
+		if err := checks[name]; err != nil {
+			fmt.Fprintf(w, "%s: %v\n", name, err)
+		} else {
+			fmt.Fprintf(w, "%s: ok\n", name)
+		}
+	}
+}
+
+// serveHealth serves the /healthz and /readyz endpoints, for the probes of
+// Kubernetes and the load balancers. It doesn't serve the metrics nor the
+// profiling endpoints of the metrics server.
+func (mr *RunCommand) serveHealth() error {
+	listener, err := net.Listen("tcp", mr.healthServerAddress())
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", mr.handleLiveness)
+	mux.HandleFunc("/readyz", mr.handleReadiness)
+	go func() {
+		log.Fatalln(http.Serve(listener, mux))
+	}()
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package commands
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+func readiness(mr *RunCommand) (int, string) {
+	recorder := httptest.NewRecorder()
+	mr.handleReadiness(recorder, httptest.NewRequest("GET", "/readyz", nil))
+	return recorder.Code, recorder.Body.String()
+}
+
+func TestHealthServerReadiness(t *testing.T) {
+	runner := &common.RunnerConfig{
+		RunnerCredentials: common.RunnerCredentials{URL: "https://gitlab.example.com/", Token: "token"},
+	}
+	mr := &RunCommand{}
+	mr.config = &common.Config{Runners: []*common.RunnerConfig{runner}}
+
+	code, body := readiness(mr)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "config: ok\ngitlab: no runner requested jobs successfully\npolling: ok\n", body)
+
+	mr.makeHealthy(runner.UniqueID(), true)
+
+	code, body = readiness(mr)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "config: ok\ngitlab: ok\npolling: ok\n", body)
+
+	for i := 0; i < common.HealthyChecks; i++ {
+		mr.makeHealthy(runner.UniqueID(), false)
+	}
+	mr.setConfigError(errors.New("Near line 3: bad value"))
+
+	code, body = readiness(mr)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "config: Near line 3: bad value\ngitlab: no runner requested jobs successfully\npolling: ok\n", body)
+
+	mr.resetHealth()
+
+	code, body = readiness(mr)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "config: Near line 3: bad value\ngitlab: ok\npolling: ok\n", body)
+
+	mr.setConfigError(nil)
+	mr.setStopSignal(syscall.SIGQUIT)
+
+	code, body = readiness(mr)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "config: ok\ngitlab: ok\npolling: stopping on quit signal\n", body)
+}
+
+func TestHealthServerWithoutRunners(t *testing.T) {
+	mr := &RunCommand{}
+	mr.config = common.NewConfig()
+
+	code, body := readiness(mr)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "config: ok\ngitlab: no runners configured\npolling: no runners configured\n", body)
+
+	recorder := httptest.NewRecorder()
+	mr.handleLiveness(recorder, httptest.NewRequest("GET", "/healthz", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "ok\n", recorder.Body.String())
+}
@@ -1,35 +1,139 @@
 package commands
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
 	log "github.com/Sirupsen/logrus"
 	"github.com/codegangsta/cli"
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/network"
 )
 
 type ListCommand struct {
 	configOptions
+	network common.Network
+	output  io.Writer
+
+	Output string `long:"output" env:"LIST_OUTPUT" description:"Output format: text or json"`
 }
 
-func (c *ListCommand) Execute(context *cli.Context) {
-	err := c.loadConfig()
-	if err != nil {
-		log.Warningln(err)
+// listedRunner is the runner printed with the json output
+type listedRunner struct {
+	Name           string     `json:"name"`
+	URL            string     `json:"url"`
+	Token          string     `json:"token"`
+	Executor       string     `json:"executor"`
+	Features       []string   `json:"features"`
+	Status         string     `json:"status"`
+	ID             int        `json:"id,omitempty"`
+	TokenExpiresAt *time.Time `json:"token_expires_at,omitempty"`
+}
+
+var verifyStatuses = map[common.VerifyState]string{
+	common.VerifySucceeded: "alive",
+	common.VerifyForbidden: "removed",
+	common.VerifyFailed:    "failed",
+}
+
+// verifyRunner sets the status of the runner in GitLab. The runners created
+// in GitLab get their ID and the expiration of their token.
+func (c *ListCommand) verifyRunner(runner *common.RunnerConfig, listed *listedRunner) {
+	if !isAuthenticationToken(runner.Token) {
+		listed.Status = verifyStatuses[c.network.VerifyRunner(runner.RunnerCredentials)]
 		return
 	}
 
+	result, state := c.network.VerifyRunnerToken(runner.RunnerCredentials)
+	listed.Status = verifyStatuses[state]
+	if result != nil {
+		listed.ID = result.ID
+		listed.TokenExpiresAt = result.TokenExpiresAt
+	}
+}
+
+func (c *ListCommand) listRunners() []listedRunner {
+	runners := []listedRunner{}
+	for _, runner := range c.config.Runners {
+		features := common.GetFeatures(*runner)
+		listed := listedRunner{
+			Name:     runner.Name,
+			URL:      runner.URL,
+			Token:    runner.ShortDescription(),
+			Executor: runner.Executor,
+			Features: features.Enabled(),
+		}
+		c.verifyRunner(runner, &listed)
+		runners = append(runners, listed)
+	}
+	return runners
+}
+
+func (c *ListCommand) printJSON(runners []listedRunner) error {
+	data, err := json.MarshalIndent(runners, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(c.output, string(data))
+	return err
+}
+
+func (c *ListCommand) printText(runners []listedRunner) {
 	log.WithFields(log.Fields{
 		"ConfigFile": c.ConfigFile,
 	}).Println("Listing configured runners")
 
-	for _, runner := range c.config.Runners {
-		log.WithFields(log.Fields{
-			"Executor": runner.RunnerSettings.Executor,
+	for i, runner := range c.config.Runners {
+		fields := log.Fields{
+			"Executor": runners[i].Executor,
+			"Features": strings.Join(runners[i].Features, ","),
 			"Token":    runner.RunnerCredentials.Token,
-			"URL":      runner.RunnerCredentials.URL,
-		}).Println(runner.Name)
+			"URL":      runners[i].URL,
+			"Status":   runners[i].Status,
+		}
+		if runners[i].ID != 0 {
+			fields["ID"] = runners[i].ID
+		}
+		if runners[i].TokenExpiresAt != nil {
+			fields["TokenExpiresAt"] = runners[i].TokenExpiresAt
+		}
+		log.WithFields(fields).Println(runners[i].Name)
+	}
+}
+
+func (c *ListCommand) Execute(context *cli.Context) {
+	if c.Output != "" && c.Output != "text" && c.Output != "json" {
+		log.Fatalln("Unknown output format:", c.Output)
+	}
+
+	err := c.loadConfig()
+	if err != nil {
+		log.Warningln(err)
+		return
+	}
+
+	// the logs of the verification are written to stderr, they are not
+	// mixed with the json output
+	runners := c.listRunners()
+	if c.Output != "json" {
+		c.printText(runners)
+		return
+	}
+
+	err = c.printJSON(runners)
+	if err != nil {
+		log.Fatalln(err)
 	}
 }
 
 func init() {
-	common.RegisterCommand2("list", "List all configured runners", &ListCommand{})
+	common.RegisterCommand2("list", "List all configured runners", &ListCommand{
+		network: &network.GitLabClient{},
+		output:  os.Stdout,
+	})
 }
@@ -0,0 +1,63 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+func TestListRunnersJSON(t *testing.T) {
+	alive := &common.RunnerConfig{
+		Name:              "alive",
+		RunnerCredentials: common.RunnerCredentials{URL: "https://gitlab.example.com/", Token: "alive-token"},
+		RunnerSettings:    common.RunnerSettings{Executor: "shell"},
+	}
+	removed := &common.RunnerConfig{
+		Name:              "removed",
+		RunnerCredentials: common.RunnerCredentials{URL: "https://gitlab.example.com/", Token: "removed-token"},
+		RunnerSettings:    common.RunnerSettings{Executor: "docker"},
+	}
+	created := &common.RunnerConfig{
+		Name:              "created",
+		RunnerCredentials: common.RunnerCredentials{URL: "https://gitlab.example.com/", Token: "glrt-created"},
+		RunnerSettings:    common.RunnerSettings{Executor: "docker"},
+	}
+
+	expiresAt := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	network := &common.MockNetwork{}
+	defer network.AssertExpectations(t)
+	network.On("VerifyRunner", alive.RunnerCredentials).Return(common.VerifySucceeded).Once()
+	network.On("VerifyRunner", removed.RunnerCredentials).Return(common.VerifyForbidden).Once()
+	network.On("VerifyRunnerToken", created.RunnerCredentials).Return(&common.VerifyRunnerTokenResponse{ID: 12, TokenExpiresAt: &expiresAt}, common.VerifySucceeded).Once()
+
+	output := &bytes.Buffer{}
+	c := &ListCommand{
+		configOptions: configOptions{config: &common.Config{Runners: []*common.RunnerConfig{alive, removed, created}}},
+		network:       network,
+		output:        output,
+	}
+	require.NoError(t, c.printJSON(c.listRunners()))
+
+	var runners []map[string]interface{}
+	require.NoError(t, json.Unmarshal(output.Bytes(), &runners))
+	require.Equal(t, 3, len(runners))
+
+	assert.Equal(t, "alive", runners[0]["name"])
+	assert.Equal(t, "alive-to", runners[0]["token"], "only the short token is printed")
+	assert.Equal(t, "shell", runners[0]["executor"])
+	assert.Equal(t, "alive", runners[0]["status"])
+	_, hasID := runners[0]["id"]
+	assert.False(t, hasID)
+
+	assert.Equal(t, "removed", runners[1]["status"])
+
+	assert.Equal(t, "alive", runners[2]["status"])
+	assert.Equal(t, float64(12), runners[2]["id"])
+	assert.Equal(t, "2030-01-02T03:04:05Z", runners[2]["token_expires_at"])
+}
@@ -5,10 +5,12 @@ import (
 	"fmt"
 	"net"
 	"net/http"
-	_ "net/http/pprof" // PPROF package adds everything itself inside its init() function
 	"os"
 	"os/signal"
 	"runtime"
+	"runtime/debug"
+	"strconv"
+	"sync"
 	"syscall"
 	"time"
 
@@ -22,8 +24,10 @@ import (
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers"
 	prometheus_helper "gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/prometheus"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/sdnotify"
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/sentry"
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/service"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/tracing"
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/network"
 )
 
@@ -31,6 +35,7 @@ type RunCommand struct {
 	configOptionsWithMetricsServer
 	network common.Network
 	healthHelper
+	pollingHelper
 
 	buildsHelper buildsHelper
 
@@ -58,10 +63,41 @@ type RunCommand struct {
 	// In case this is SIGQUIT it makes to finish all buids
 	stopSignal os.Signal
 
+	// configLock guards the config and the stop signal, when they are
+	// changed while the health server reads them
+	configLock sync.RWMutex
+
 	// runFinished is used to notify that Run() did finish
 	runFinished chan bool
 
 	currentWorkers int
+	startedAt      time.Time
+
+	// paused is set when the jobs are not requested, by the pause command
+	paused int32
+	// adminListener is the listener of the admin socket
+	adminListener net.Listener
+}
+
+func (mr *RunCommand) getConfig() *common.Config {
+	mr.configLock.RLock()
+	defer mr.configLock.RUnlock()
+
+	return mr.config
+}
+
+func (mr *RunCommand) getStopSignal() os.Signal {
+	mr.configLock.RLock()
+	defer mr.configLock.RUnlock()
+
+	return mr.stopSignal
+}
+
+func (mr *RunCommand) setStopSignal(stopSignal os.Signal) {
+	mr.configLock.Lock()
+	defer mr.configLock.Unlock()
+
+	mr.stopSignal = stopSignal
 }
 
 func (mr *RunCommand) log() *log.Entry {
@@ -69,7 +105,8 @@ func (mr *RunCommand) log() *log.Entry {
 }
 
 func (mr *RunCommand) feedRunner(runner *common.RunnerConfig, runners chan *common.RunnerConfig) {
-	if !mr.isHealthy(runner.UniqueID()) {
+	if mr.isPaused() || !mr.isHealthy(runner.UniqueID()) || !mr.isPollDue(runner) ||
+		!mr.isInstanceReachable(runner.URL) || common.IsRateLimited(runner.URL) {
 		return
 	}
 
@@ -79,7 +116,7 @@ func (mr *RunCommand) feedRunner(runner *common.RunnerConfig, runners chan *comm
 func (mr *RunCommand) feedRunners(runners chan *common.RunnerConfig) {
 	for mr.stopSignal == nil {
 		mr.log().Debugln("Feeding runners to channel")
-		config := mr.config
+		config := mr.getConfig()
 
 		// If no runners wait full interval to test again
 		if len(config.Runners) == 0 {
@@ -87,16 +124,52 @@ func (mr *RunCommand) feedRunners(runners chan *common.RunnerConfig) {
 			continue
 		}
 
-		interval := config.GetCheckInterval() / time.Duration(len(config.Runners))
+		schedule := feedSchedule(config.Runners)
+		interval := config.GetCheckInterval() / time.Duration(len(schedule))
 
 		// Feed runner with waiting exact amount of time
-		for _, runner := range config.Runners {
+		for _, runner := range schedule {
 			mr.feedRunner(runner, runners)
 			time.Sleep(interval)
 		}
 	}
 }
 
+// feedSchedule returns the order in which the runners are fed during one
+// check_interval: each runner is fed as many times as its weight, spread
+// over the interval, the runners of higher priority first
+func feedSchedule(runners []*common.RunnerConfig) (schedule []*common.RunnerConfig) {
+	total := 0
+	for _, runner := range runners {
+		total += runner.GetWeight()
+	}
+
+	// smooth weighted round-robin
+	current := make([]int, len(runners))
+	for len(schedule) < total {
+		selected := -1
+		for i, runner := range runners {
+			current[i] += runner.GetWeight()
+			if selected < 0 || current[i] > current[selected] ||
+				current[i] == current[selected] && runner.Priority > runners[selected].Priority {
+				selected = i
+			}
+		}
+		current[selected] -= total
+		schedule = append(schedule, runners[selected])
+	}
+	return
+}
+
+// fairShare returns the number of the builds of each runner when the
+// concurrent builds are shared equally between the runners
+func fairShare(config *common.Config) int {
+	if len(config.Runners) == 0 {
+		return config.Concurrent
+	}
+	return (config.Concurrent + len(config.Runners) - 1) / len(config.Runners)
+}
+
 func (mr *RunCommand) requestJob(runner *common.RunnerConfig) (*common.GetBuildResponse, bool) {
 	if !mr.buildsHelper.acquireRequest(runner) {
 		return nil, false
@@ -105,9 +178,37 @@ func (mr *RunCommand) requestJob(runner *common.RunnerConfig) (*common.GetBuildR
 
 	jobData, healthy := mr.network.GetBuild(*runner)
 	mr.makeHealthy(runner.UniqueID(), healthy)
+	mr.updatePolling(mr.config, runner, jobData != nil)
+	mr.makeInstanceReachable(runner.URL, common.IsInstanceReachable(runner.URL))
 	return jobData, true
 }
 
+// useExecutorProfile switches the build to the executor profile selected by
+// its variables, returning the function releasing the executor of the profile
+func useExecutorProfile(build *common.Build) (release func(), err error) {
+	runner := build.Runner
+	profileRunner, err := runner.GetProfileConfig(append(runner.GetVariables(), build.Variables...))
+	if err != nil || profileRunner == runner {
+		return func() {}, err
+	}
+
+	provider := common.GetExecutor(profileRunner.Executor)
+	if provider == nil {
+		return nil, fmt.Errorf("executor %s of the profile not found", profileRunner.Executor)
+	}
+
+	context, err := provider.Acquire(profileRunner)
+	if err != nil {
+		return nil, err
+	}
+
+	build.Runner = profileRunner
+	build.ExecutorData = context
+	return func() {
+		provider.Release(profileRunner, context)
+	}, nil
+}
+
 func (mr *RunCommand) processRunner(id int, runner *common.RunnerConfig, runners chan *common.RunnerConfig) (err error) {
 	provider := common.GetExecutor(runner.Executor)
 	if provider == nil {
@@ -119,7 +220,12 @@ func (mr *RunCommand) processRunner(id int, runner *common.RunnerConfig, runners
 		log.Warningln("Failed to update executor", runner.Executor, "for", runner.ShortDescription(), err)
 		return
 	}
-	defer provider.Release(runner, context)
+	released := false
+	defer func() {
+		if !released {
+			provider.Release(runner, context)
+		}
+	}()
 
 	// Acquire build slot
 	if !mr.buildsHelper.acquireBuild(runner) {
@@ -130,6 +236,7 @@ func (mr *RunCommand) processRunner(id int, runner *common.RunnerConfig, runners
 	defer mr.buildsHelper.releaseBuild(runner)
 
 	// Receive a new build
+	requestStarted := time.Now()
 	buildData, result := mr.requestJob(runner)
 	if !result {
 		mr.log().WithField("runner", runner.ShortDescription()).
@@ -146,7 +253,22 @@ func (mr *RunCommand) processRunner(id int, runner *common.RunnerConfig, runners
 		Token: buildData.Token,
 	}
 	trace := mr.network.ProcessBuild(*runner, buildCredentials)
-	defer trace.Fail(err)
+	defer func() {
+		trace.Fail(err)
+	}()
+
+	// Trace the job from its request, with the requests of the job to GitLab
+	span := tracing.StartTrace("job", requestStarted)
+	span.SetAttribute("job.id", strconv.Itoa(buildData.ID))
+	span.SetAttribute("project.id", strconv.Itoa(buildData.ProjectID))
+	span.SetAttribute("runner", runner.ShortDescription())
+	span.SetAttribute("executor", runner.Executor)
+	span.StartChildAt("request", requestStarted).End(nil)
+	tracing.RegisterJob(buildData.ID, span)
+	defer func() {
+		tracing.UnregisterJob(buildData.ID)
+		span.End(err)
+	}()
 
 	// Create a new build
 	build := &common.Build{
@@ -154,20 +276,58 @@ func (mr *RunCommand) processRunner(id int, runner *common.RunnerConfig, runners
 		Runner:           runner,
 		ExecutorData:     context,
 		SystemInterrupt:  mr.abortBuilds,
+		Span:             span,
+	}
+
+	// Report the panic of the build with the context of the job and fail
+	// only this job, the runner keeps processing the others
+	defer func() {
+		if r := recover(); r != nil {
+			err = &common.SystemError{Inner: fmt.Errorf("panic: %v", r)}
+			logger := common.NewBuildLogger(trace, build.Log().WithField("stack", string(debug.Stack())))
+			logger.Errorln("Job failed (system failure):", err)
+		}
+	}()
+
+	// Use the executor profile selected by the build
+	releaseProfile, err := useExecutorProfile(build)
+	if err != nil {
+		logger := common.NewBuildLogger(trace, build.Log())
+		logger.Errorln("Job failed (system failure):", err)
+		return
+	}
+	defer releaseProfile()
+
+	// The executor of the profile has its own data, the one of the runner
+	// is released for the other jobs
+	if build.Runner != runner {
+		provider.Release(runner, context)
+		released = true
 	}
 
-	// Add build to list of builds to assign numbers
-	mr.buildsHelper.addBuild(build)
+	// Add build to list of builds to assign numbers, once its project is
+	// below the project_limit of the runner
+	err = mr.buildsHelper.addProjectBuild(build, func() {
+		logger := common.NewBuildLogger(trace, build.Log())
+		logger.Println("Waiting for a job of the project to finish, the project_limit of the runner is reached...")
+	}, mr.abortBuilds)
+	if err != nil {
+		return
+	}
 	defer mr.buildsHelper.removeBuild(build)
 
 	// Process the same runner by different worker again
-	// to speed up taking the builds
-	select {
-	case runners <- runner:
-		mr.log().WithField("runner", runner.ShortDescription()).Debugln("Requeued the runner")
+	// to speed up taking the builds, up to its fair share of the concurrent
+	// builds. Above it, the runner waits for its turn in feedRunners, so a
+	// busy runner doesn't take the workers of the others.
+	if builds, _ := mr.buildsHelper.runnerUsage(runner); builds < fairShare(mr.getConfig()) {
+		select {
+		case runners <- runner:
+			mr.log().WithField("runner", runner.ShortDescription()).Debugln("Requeued the runner")
 
-	default:
-		mr.log().WithField("runner", runner.ShortDescription()).Debugln("Failed to requeue the runner: ")
+		default:
+			mr.log().WithField("runner", runner.ShortDescription()).Debugln("Failed to requeue the runner: ")
+		}
 	}
 
 	// Process a build
@@ -199,18 +359,59 @@ func (mr *RunCommand) startWorkers(startWorker chan int, stopWorker chan bool, r
 	}
 }
 
+// configChanges describes the changes of the reloaded config, which are
+// applied to the next builds, while the running ones keep the old settings
+func configChanges(oldConfig, newConfig *common.Config) (changes []string) {
+	if oldConfig.Concurrent != newConfig.Concurrent {
+		changes = append(changes, fmt.Sprintf("concurrent changed from %d to %d", oldConfig.Concurrent, newConfig.Concurrent))
+	}
+
+	oldRunners := make(map[string]bool)
+	for _, runner := range oldConfig.Runners {
+		oldRunners[runner.UniqueID()] = true
+	}
+	newRunners := make(map[string]bool)
+	for _, runner := range newConfig.Runners {
+		newRunners[runner.UniqueID()] = true
+		if !oldRunners[runner.UniqueID()] {
+			changes = append(changes, "added runner "+runner.ShortDescription())
+		}
+	}
+	for _, runner := range oldConfig.Runners {
+		if !newRunners[runner.UniqueID()] {
+			changes = append(changes, "removed runner "+runner.ShortDescription())
+		}
+	}
+	return
+}
+
 func (mr *RunCommand) loadConfig() error {
+	mr.configLock.Lock()
+	oldConfig := mr.config
 	err := mr.configOptions.loadConfig()
+	// pass user to execute scripts as specific user
+	if err == nil && mr.User != "" {
+		mr.config.User = mr.User
+	}
+	mr.configLock.Unlock()
+
+	mr.setConfigError(err)
 	if err != nil {
 		return err
 	}
 
-	// pass user to execute scripts as specific user
-	if mr.User != "" {
-		mr.config.User = mr.User
+	if oldConfig != nil {
+		for _, change := range configChanges(oldConfig, mr.config) {
+			mr.log().Println("Configuration reloaded:", change)
+		}
+		// the clients are created again with the new certificates
+		mr.network.ResetClients()
 	}
 
-	mr.healthy = nil
+	mr.resetHealth()
+	tracing.Configure(mr.config.Tracing)
+	network.ConfigureTransport(mr.config.HTTPClient)
+	network.ConfigureSpool(mr.spoolDir(), mr.network, mr.config)
 	mr.log().Println("Configuration loaded")
 	mr.log().Debugln(helpers.ToYAML(mr.config))
 
@@ -225,16 +426,27 @@ func (mr *RunCommand) loadConfig() error {
 		mr.sentryLogHook = sentry.LogHook{}
 	}
 
+	for _, runner := range mr.config.Runners {
+		if runner.SentryDSN == "" {
+			continue
+		}
+
+		err := mr.sentryLogHook.AddRunner(runner.ShortDescription(), runner.SentryDSN)
+		if err != nil {
+			mr.log().WithError(err).WithField("runner", runner.ShortDescription()).Errorln("Sentry failure")
+		}
+	}
+
 	return nil
 }
 
 func (mr *RunCommand) checkConfig() (err error) {
-	info, err := os.Stat(mr.ConfigFile)
+	modTime, err := mr.config.GetModTime(mr.ConfigFile)
 	if err != nil {
 		return err
 	}
 
-	if !mr.config.ModTime.Before(info.ModTime()) {
+	if !mr.config.ModTime.Before(modTime) {
 		return nil
 	}
 
@@ -242,7 +454,9 @@ func (mr *RunCommand) checkConfig() (err error) {
 	if err != nil {
 		mr.log().Errorln("Failed to load config", err)
 		// don't reload the same file
-		mr.config.ModTime = info.ModTime()
+		mr.configLock.Lock()
+		mr.config.ModTime = modTime
+		mr.configLock.Unlock()
 		return
 	}
 	return nil
@@ -254,6 +468,7 @@ func (mr *RunCommand) Start(s service.Service) error {
 	mr.reloadSignal = make(chan os.Signal, 1)
 	mr.runFinished = make(chan bool, 1)
 	mr.stopSignals = make(chan os.Signal)
+	mr.startedAt = time.Now()
 	mr.log().Println("Starting multi-runner from", mr.ConfigFile, "...")
 
 	userModeWarning(false)
@@ -321,11 +536,34 @@ func (mr *RunCommand) updateConfig() os.Signal {
 	return nil
 }
 
+// notifyServiceManager sends the state to systemd, when the runner is run
+// with Type=notify
+func (mr *RunCommand) notifyServiceManager(state string) {
+	_, err := sdnotify.Notify(state)
+	if err != nil {
+		mr.log().WithError(err).Warningln("Failed to notify the service manager")
+	}
+}
+
+// notifyStatus sends the status to systemd, with the ping of the watchdog
+// when it's enabled. It's called from the main loop, which is blocked when
+// the runner hangs.
+func (mr *RunCommand) notifyStatus() {
+	state := fmt.Sprintf("STATUS=Running %d jobs", mr.buildsHelper.buildsCount())
+	if mr.isPaused() {
+		state = fmt.Sprintf("STATUS=Paused, running %d jobs", mr.buildsHelper.buildsCount())
+	}
+	if sdnotify.WatchdogInterval() > 0 {
+		state = "WATCHDOG=1\n" + state
+	}
+	mr.notifyServiceManager(state)
+}
+
 func (mr *RunCommand) runWait() {
 	mr.log().Debugln("Waiting for stop signal")
 
 	// Save the stop signal and exit to execute Stop()
-	mr.stopSignal = <-mr.stopSignals
+	mr.setStopSignal(<-mr.stopSignals)
 }
 
 func (mr *RunCommand) serveMetrics() error {
@@ -339,6 +577,9 @@ func (mr *RunCommand) serveMetrics() error {
 	registry := prometheus.NewRegistry()
 	// Metrics about the runner's business logic.
 	registry.MustRegister(&mr.buildsHelper)
+	// Metrics about the durations of the builds and of the requests to GitLab.
+	registry.MustRegister(common.BuildMetrics)
+	registry.MustRegister(network.APIMetrics)
 	// Metrics about catched errors
 	registry.MustRegister(&mr.prometheusLogHook)
 	// Metrics about the program's build version.
@@ -355,9 +596,11 @@ func (mr *RunCommand) serveMetrics() error {
 		}
 	}
 
-	http.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	// the profiles are served only by the authorized debug server
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
 	go func() {
-		log.Fatalln(http.Serve(listener, nil))
+		log.Fatalln(http.Serve(listener, mux))
 	}()
 
 	return nil
@@ -373,6 +616,25 @@ func (mr *RunCommand) Run() {
 		log.Infoln("Metrics server disabled")
 	}
 
+	if mr.healthServerAddress() != "" {
+		if err := mr.serveHealth(); err != nil {
+			log.Fatalln(err)
+		}
+		log.Infoln("Health server listening at", mr.healthServerAddress())
+	}
+
+	if mr.debugServerAddress() != "" {
+		if err := mr.serveDebug(); err != nil {
+			log.Fatalln(err)
+		}
+		log.Infoln("Debug server listening at", mr.debugServerAddress())
+	}
+
+	if err := mr.serveAdminSocket(); err != nil {
+		mr.log().WithError(err).Warningln("The admin socket is disabled, the runner can't be paused")
+	}
+	defer mr.closeAdminSocket()
+
 	runners := make(chan *common.RunnerConfig)
 	go mr.feedRunners(runners)
 
@@ -385,6 +647,8 @@ func (mr *RunCommand) Run() {
 
 	workerIndex := 0
 
+	mr.notifyServiceManager("READY=1")
+
 	for mr.stopSignal == nil {
 		signaled := mr.updateWorkers(&workerIndex, startWorker, stopWorker)
 		if signaled != nil {
@@ -395,6 +659,8 @@ func (mr *RunCommand) Run() {
 		if signaled != nil {
 			break
 		}
+
+		mr.notifyStatus()
 	}
 
 	// Wait for workers to shutdown
@@ -420,15 +686,31 @@ func (mr *RunCommand) abortAllBuilds() {
 	}
 }
 
+// gracefulShutdownTimeout returns the channel of the end of the wait for
+// the builds, or nil when stop_timeout isn't set and the wait is unlimited
+func (mr *RunCommand) gracefulShutdownTimeout() <-chan time.Time {
+	if mr.config == nil || mr.config.StopTimeout <= 0 {
+		return nil
+	}
+	return time.After(time.Duration(mr.config.StopTimeout) * time.Second)
+}
+
 func (mr *RunCommand) handleGracefulShutdown() error {
+	timeout := mr.gracefulShutdownTimeout()
+
 	// We wait till we have a SIGQUIT
 	for mr.stopSignal == syscall.SIGQUIT {
 		mr.log().Warningln("Requested quit, waiting for builds to finish")
 
 		// Wait for other signals to finish builds
 		select {
-		case mr.stopSignal = <-mr.stopSignals:
-		// We received a new signal
+		case stopSignal := <-mr.stopSignals:
+			// We received a new signal
+			mr.setStopSignal(stopSignal)
+
+		case <-timeout:
+			mr.log().Warningln("The builds didn't finish in", mr.config.StopTimeout, "seconds")
+			return errors.New("stop timedout")
 
 		case <-mr.runFinished:
 			// Everything finished we can exit now
@@ -447,8 +729,9 @@ func (mr *RunCommand) handleShutdown() error {
 	// Wait for graceful shutdown or abort after timeout
 	for {
 		select {
-		case mr.stopSignal = <-mr.stopSignals:
-			return fmt.Errorf("forced exit: %v", mr.stopSignal)
+		case stopSignal := <-mr.stopSignals:
+			mr.setStopSignal(stopSignal)
+			return fmt.Errorf("forced exit: %v", stopSignal)
 
 		case <-time.After(common.ShutdownTimeout * time.Second):
 			return errors.New("shutdown timedout")
@@ -461,6 +744,19 @@ func (mr *RunCommand) handleShutdown() error {
 }
 
 func (mr *RunCommand) Stop(s service.Service) (err error) {
+	mr.notifyServiceManager("STOPPING=1")
+	// export the traces of the last jobs
+	defer tracing.Configure(nil)
+	defer network.ConfigureSpool("", nil, nil)
+
+	// The service manager of Windows stops the service, on its stop and on
+	// the shutdown of the system, without a signal: the builds are finished
+	// like on SIGQUIT. An error makes the service exit with a non-zero
+	// code, which triggers its recovery actions.
+	if mr.getStopSignal() == nil && runtime.GOOS == "windows" {
+		mr.setStopSignal(syscall.SIGQUIT)
+	}
+
 	go mr.interruptRun()
 	err = mr.handleGracefulShutdown()
 	if err == nil {
@@ -487,7 +783,10 @@ func (mr *RunCommand) Execute(context *cli.Context) {
 	}
 
 	if mr.Syslog {
-		log.SetFormatter(new(log.TextFormatter))
+		// the entries of the syslog keep the json format when it's set
+		if _, ok := log.StandardLogger().Formatter.(*log.JSONFormatter); !ok {
+			log.SetFormatter(new(log.TextFormatter))
+		}
 		logger, err := service.SystemLogger(nil)
 		if err == nil {
 			log.AddHook(&ServiceLogHook{logger, log.InfoLevel})
@@ -0,0 +1,255 @@
+package commands
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+func newProfileTestBuild(variables ...common.BuildVariable) *common.Build {
+	return &common.Build{
+		GetBuildResponse: common.GetBuildResponse{
+			Variables: variables,
+		},
+		Runner: &common.RunnerConfig{
+			RunnerCredentials: common.RunnerCredentials{Token: "token"},
+			RunnerSettings: common.RunnerSettings{
+				Executor:    "shell",
+				Environment: []string{"KEY=value"},
+			},
+			Profiles: []common.ExecutorProfile{
+				{
+					Name: "profile",
+					RunnerSettings: common.RunnerSettings{
+						Executor: "profile-test",
+					},
+				},
+			},
+		},
+		ExecutorData: "shell data",
+	}
+}
+
+func TestUseExecutorProfile(t *testing.T) {
+	provider := &common.MockExecutorProvider{}
+	provider.On("Acquire", mock.Anything).Return("profile data", nil).Once()
+	provider.On("Release", mock.Anything, "profile data").Return(nil).Once()
+	common.RegisterExecutor("profile-test", provider)
+
+	build := newProfileTestBuild(common.BuildVariable{Key: "EXECUTOR_PROFILE", Value: "profile"})
+	runner := build.Runner
+
+	release, err := useExecutorProfile(build)
+	require.NoError(t, err)
+	assert.Equal(t, "profile-test", build.Runner.Executor)
+	assert.Equal(t, []string{"KEY=value"}, build.Runner.Environment, "it inherits the settings of the runner")
+	assert.Equal(t, "token", build.Runner.Token)
+	assert.Equal(t, "profile data", build.ExecutorData)
+	assert.Equal(t, "shell", runner.Executor, "it doesn't change the runner")
+
+	release()
+	provider.AssertExpectations(t)
+}
+
+func TestUseExecutorProfileNotSelected(t *testing.T) {
+	build := newProfileTestBuild()
+	runner := build.Runner
+
+	release, err := useExecutorProfile(build)
+	require.NoError(t, err)
+	release()
+	assert.Equal(t, runner, build.Runner)
+	assert.Equal(t, "shell data", build.ExecutorData)
+}
+
+func TestUseExecutorProfileUnknown(t *testing.T) {
+	build := newProfileTestBuild(common.BuildVariable{Key: "EXECUTOR_PROFILE", Value: "unknown"})
+
+	_, err := useExecutorProfile(build)
+	assert.EqualError(t, err, `Unknown executor profile "unknown", use one of: profile`)
+}
+
+func TestUseExecutorProfileSelectedByRunner(t *testing.T) {
+	build := newProfileTestBuild()
+	build.Runner.Environment = []string{"EXECUTOR_PROFILE=missing"}
+	build.Runner.Profiles = nil
+
+	_, err := useExecutorProfile(build)
+	assert.EqualError(t, err, `Unknown executor profile "missing", the runner doesn't define any`)
+}
+
+func TestConfigChanges(t *testing.T) {
+	oldConfig := &common.Config{
+		Concurrent: 1,
+		Runners: []*common.RunnerConfig{
+			{RunnerCredentials: common.RunnerCredentials{URL: "https://gitlab.com/", Token: "token-a"}},
+			{RunnerCredentials: common.RunnerCredentials{URL: "https://gitlab.com/", Token: "token-b"}},
+		},
+	}
+	newConfig := &common.Config{
+		Concurrent: 4,
+		Runners: []*common.RunnerConfig{
+			{RunnerCredentials: common.RunnerCredentials{URL: "https://gitlab.com/", Token: "token-b"}},
+			{RunnerCredentials: common.RunnerCredentials{URL: "https://gitlab.com/", Token: "token-c"}},
+		},
+	}
+
+	assert.Equal(t, []string{
+		"concurrent changed from 1 to 4",
+		"added runner token-c",
+		"removed runner token-a",
+	}, configChanges(oldConfig, newConfig))
+	assert.Empty(t, configChanges(newConfig, newConfig))
+}
+
+func TestReloadConfigResetsClients(t *testing.T) {
+	file, err := ioutil.TempFile("", "config.toml")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+	file.WriteString("concurrent = 2\n")
+	file.Close()
+
+	network := &common.MockNetwork{}
+	defer network.AssertExpectations(t)
+
+	mr := &RunCommand{network: network}
+	mr.ConfigFile = file.Name()
+
+	require.NoError(t, mr.loadConfig())
+	assert.Equal(t, 2, mr.config.Concurrent)
+
+	network.On("ResetClients").Return().Once()
+	require.NoError(t, mr.loadConfig())
+}
+
+func TestNotifyStatus(t *testing.T) {
+	dir, err := ioutil.TempDir("", "notify")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	defer os.Setenv("NOTIFY_SOCKET", os.Getenv("NOTIFY_SOCKET"))
+	defer os.Setenv("WATCHDOG_USEC", os.Getenv("WATCHDOG_USEC"))
+	os.Setenv("NOTIFY_SOCKET", socket)
+
+	receive := func() string {
+		buffer := make([]byte, 1024)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := conn.Read(buffer)
+		require.NoError(t, err)
+		return string(buffer[:n])
+	}
+
+	mr := &RunCommand{}
+	mr.buildsHelper.addBuild(newProfileTestBuild())
+
+	os.Setenv("WATCHDOG_USEC", "")
+	mr.notifyStatus()
+	assert.Equal(t, "STATUS=Running 1 jobs", receive())
+
+	os.Setenv("WATCHDOG_USEC", "20000000")
+	mr.setPaused(true)
+	mr.notifyStatus()
+	assert.Equal(t, "WATCHDOG=1\nSTATUS=Paused, running 1 jobs", receive())
+}
+
+func TestGracefulShutdownTimeout(t *testing.T) {
+	mr := &RunCommand{
+		stopSignal:  syscall.SIGQUIT,
+		stopSignals: make(chan os.Signal),
+		runFinished: make(chan bool, 1),
+	}
+	mr.config = &common.Config{StopTimeout: 1}
+
+	err := mr.handleGracefulShutdown()
+	assert.EqualError(t, err, "stop timedout")
+
+	mr.config.StopTimeout = 0
+	mr.runFinished <- true
+	assert.NoError(t, mr.handleGracefulShutdown())
+}
+
+func TestFairShare(t *testing.T) {
+	config := &common.Config{Concurrent: 4}
+	assert.Equal(t, 4, fairShare(config))
+
+	config.Runners = []*common.RunnerConfig{{}, {}}
+	assert.Equal(t, 2, fairShare(config))
+
+	config.Runners = append(config.Runners, &common.RunnerConfig{})
+	assert.Equal(t, 2, fairShare(config))
+}
+
+func TestFeedSchedule(t *testing.T) {
+	gitlab := &common.RunnerConfig{Name: "gitlab", Weight: 3}
+	other := &common.RunnerConfig{Name: "other"}
+	urgent := &common.RunnerConfig{Name: "urgent", Priority: 1}
+
+	names := func(runners []*common.RunnerConfig) (names []string) {
+		for _, runner := range runners {
+			names = append(names, runner.Name)
+		}
+		return
+	}
+
+	schedule := feedSchedule([]*common.RunnerConfig{gitlab, other})
+	assert.Equal(t, "gitlab,gitlab,other,gitlab", strings.Join(names(schedule), ","))
+
+	schedule = feedSchedule([]*common.RunnerConfig{other, urgent})
+	assert.Equal(t, "urgent,other", strings.Join(names(schedule), ","))
+}
+
+type failedTrace struct {
+	bytes.Buffer
+	err error
+}
+
+func (t *failedTrace) Success()                  { t.Fail(nil) }
+func (t *failedTrace) Fail(err error)            { t.err = err }
+func (t *failedTrace) Aborted() chan interface{} { return nil }
+func (t *failedTrace) IsStdout() bool            { return false }
+
+func TestProcessRunnerFailsWithTheUnknownProfile(t *testing.T) {
+	provider := &common.MockExecutorProvider{}
+	provider.On("Acquire", mock.Anything).Return("runner data", nil).Once()
+	provider.On("Release", mock.Anything, "runner data").Return(nil).Once()
+	common.RegisterExecutor("process-test", provider)
+
+	runner := &common.RunnerConfig{
+		RunnerSettings: common.RunnerSettings{Executor: "process-test"},
+	}
+	job := &common.GetBuildResponse{
+		ID:        1,
+		Variables: common.BuildVariables{{Key: "EXECUTOR_PROFILE", Value: "unknown"}},
+	}
+	trace := &failedTrace{}
+
+	network := &common.MockNetwork{}
+	network.On("GetBuild", mock.Anything).Return(job, true).Once()
+	network.On("ProcessBuild", mock.Anything, mock.Anything).Return(trace).Once()
+
+	mr := &RunCommand{network: network}
+	mr.config = &common.Config{Concurrent: 1, Runners: []*common.RunnerConfig{runner}}
+
+	err := mr.processRunner(0, runner, make(chan *common.RunnerConfig))
+	assert.Error(t, err)
+	assert.Equal(t, err, trace.err, "the job fails with the error of the profile")
+	assert.Contains(t, trace.String(), "Unknown executor profile")
+	provider.AssertExpectations(t)
+}
@@ -0,0 +1,37 @@
+package commands
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+type PauseCommand struct {
+	configOptions
+}
+
+func (c *PauseCommand) Execute(context *cli.Context) {
+	status, err := requestAdminSocket(c.adminSocket(), "POST", "/pause")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	log.Println("Runner", status+", the running jobs are not stopped")
+}
+
+type ResumeCommand struct {
+	configOptions
+}
+
+func (c *ResumeCommand) Execute(context *cli.Context) {
+	status, err := requestAdminSocket(c.adminSocket(), "POST", "/resume")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	log.Println("Runner", status)
+}
+
+func init() {
+	common.RegisterCommand2("pause", "stop requesting new jobs, the running jobs continue", &PauseCommand{})
+	common.RegisterCommand2("resume", "request new jobs again after pause", &ResumeCommand{})
+}
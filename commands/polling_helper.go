@@ -0,0 +1,54 @@
+package commands
+
+import (
+	"sync"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+// pollingHelper adapts the interval of the job requests of each runner: it
+// doubles after each request without a job, up to max_check_interval, and
+// is reset when a job is received or when GitLab long polls the requests
+type pollingHelper struct {
+	intervals   map[string]time.Duration
+	nextPolls   map[string]time.Time
+	pollingLock sync.Mutex
+}
+
+func (p *pollingHelper) isPollDue(runner *common.RunnerConfig) bool {
+	p.pollingLock.Lock()
+	defer p.pollingLock.Unlock()
+
+	return !time.Now().Before(p.nextPolls[runner.UniqueID()])
+}
+
+func (p *pollingHelper) updatePolling(config *common.Config, runner *common.RunnerConfig, received bool) {
+	p.pollingLock.Lock()
+	defer p.pollingLock.Unlock()
+
+	if p.intervals == nil {
+		p.intervals = make(map[string]time.Duration)
+		p.nextPolls = make(map[string]time.Time)
+	}
+
+	id := runner.UniqueID()
+	if received || common.IsLongPolling(runner.RunnerCredentials) {
+		delete(p.intervals, id)
+		delete(p.nextPolls, id)
+		return
+	}
+
+	interval := p.intervals[id] * 2
+	if interval < config.GetCheckInterval() {
+		interval = config.GetCheckInterval()
+	}
+	if max := config.GetMaxCheckInterval(); interval > max {
+		interval = max
+	}
+	p.intervals[id] = interval
+
+	// the runners are fed every check_interval, the feeds are skipped for
+	// the rest of the interval
+	p.nextPolls[id] = time.Now().Add(interval - config.GetCheckInterval())
+}
@@ -0,0 +1,52 @@
+package commands
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+func TestPollingBacksOffWhenIdle(t *testing.T) {
+	config := &common.Config{CheckInterval: 1, MaxCheckInterval: 4}
+	runner := &common.RunnerConfig{
+		RunnerCredentials: common.RunnerCredentials{URL: "http://gitlab.example.com/", Token: "polling-token"},
+	}
+
+	p := &pollingHelper{}
+	for _, expected := range []int{1, 2, 4, 4} {
+		p.updatePolling(config, runner, false)
+		assert.Equal(t, time.Duration(expected)*time.Second, p.intervals[runner.UniqueID()])
+	}
+	assert.False(t, p.isPollDue(runner))
+
+	p.updatePolling(config, runner, true)
+	assert.True(t, p.isPollDue(runner), "the runner which received a job is polled right away")
+}
+
+func TestPollingIsFixedByDefault(t *testing.T) {
+	config := &common.Config{CheckInterval: 1}
+	runner := &common.RunnerConfig{
+		RunnerCredentials: common.RunnerCredentials{URL: "http://gitlab.example.com/", Token: "fixed-token"},
+	}
+
+	p := &pollingHelper{}
+	p.updatePolling(config, runner, false)
+	p.updatePolling(config, runner, false)
+	assert.True(t, p.isPollDue(runner))
+}
+
+func TestPollingIsNotBackedOffWhenLongPolling(t *testing.T) {
+	config := &common.Config{CheckInterval: 1, MaxCheckInterval: 4}
+	runner := &common.RunnerConfig{
+		RunnerCredentials: common.RunnerCredentials{URL: "http://gitlab.example.com/", Token: "long-polling-token"},
+	}
+	common.SetLongPolling(runner.RunnerCredentials, true)
+
+	p := &pollingHelper{}
+	p.updatePolling(config, runner, false)
+	p.updatePolling(config, runner, false)
+	assert.True(t, p.isPollDue(runner))
+}
@@ -2,13 +2,16 @@ package commands
 
 import (
 	"bufio"
+	"fmt"
 	"os"
 	"os/signal"
 	"strconv"
 	"strings"
 
+	"github.com/BurntSushi/toml"
 	log "github.com/Sirupsen/logrus"
 	"github.com/codegangsta/cli"
+	"github.com/imdario/mergo"
 
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/ssh"
@@ -20,6 +23,7 @@ type RegisterCommand struct {
 	network    common.Network
 	reader     *bufio.Reader
 	registered bool
+	template   *common.RunnerConfig
 
 	configOptions
 	TagList           string `long:"tag-list" env:"RUNNER_TAG_LIST" description:"Tag list"`
@@ -27,6 +31,8 @@ type RegisterCommand struct {
 	LeaveRunner       bool   `long:"leave-runner" env:"REGISTER_LEAVE_RUNNER" description:"Don't remove runner if registration fails"`
 	RegistrationToken string `short:"r" long:"registration-token" env:"REGISTRATION_TOKEN" description:"Runner's registration token"`
 	RunUntagged       bool   `long:"run-untagged" env:"REGISTER_RUN_UNTAGGED" description:"Register to run untagged builds; defaults to 'true' when 'tag-list' is empty"`
+	TemplateConfig    string `long:"template-config" env:"TEMPLATE_CONFIG_FILE" description:"Config file with a [[runners]] entry, merged into the registered runner"`
+	TokenStore        string `long:"token-store" env:"RUNNER_TOKEN_STORE" description:"Save the runner token in a token store instead of the config file: keyring or kms"`
 
 	common.RunnerConfig
 }
@@ -63,6 +69,9 @@ func (s *RegisterCommand) ask(key, prompt string, allowEmptyOptional ...bool) st
 	allowEmpty := len(allowEmptyOptional) > 0 && allowEmptyOptional[0]
 
 	result := s.context.String(key)
+	if result == "" {
+		result = s.templateValue(key)
+	}
 	result = strings.TrimSpace(result)
 
 	if s.NonInteractive || prompt == "" {
@@ -81,6 +90,76 @@ func (s *RegisterCommand) ask(key, prompt string, allowEmptyOptional ...bool) st
 	return result
 }
 
+// loadTemplate loads the runner of the template config file
+func (s *RegisterCommand) loadTemplate() error {
+	if s.TemplateConfig == "" {
+		return nil
+	}
+
+	config := common.NewConfig()
+	_, err := toml.DecodeFile(s.TemplateConfig, config)
+	if err != nil {
+		return fmt.Errorf("Failed to load the template config %s: %v", s.TemplateConfig, err)
+	}
+	if len(config.Runners) != 1 {
+		return fmt.Errorf("The template config %s must have one [[runners]] entry", s.TemplateConfig)
+	}
+
+	s.template = config.Runners[0]
+	return nil
+}
+
+// templateValue returns the value of the option in the template, used when
+// the option is not given. The passwords are not suggested.
+func (s *RegisterCommand) templateValue(key string) string {
+	template := s.template
+	if template == nil {
+		return ""
+	}
+
+	switch key {
+	case "url":
+		return template.URL
+	case "executor":
+		return template.Executor
+	case "docker-image":
+		if template.Docker != nil {
+			return template.Docker.Image
+		}
+	case "ssh-host", "ssh-port", "ssh-user", "ssh-identity-file":
+		if template.SSH != nil {
+			return map[string]string{
+				"ssh-host":          template.SSH.Host,
+				"ssh-port":          template.SSH.Port,
+				"ssh-user":          template.SSH.User,
+				"ssh-identity-file": template.SSH.IdentityFile,
+			}[key]
+		}
+	case "parallels-base-name":
+		if template.Parallels != nil {
+			return template.Parallels.BaseName
+		}
+	case "virtualbox-base-name":
+		if template.VirtualBox != nil {
+			return template.VirtualBox.BaseName
+		}
+	}
+	return ""
+}
+
+// mergeTemplate sets the settings of the runner, which are not given, to
+// the ones of the template
+func (s *RegisterCommand) mergeTemplate() {
+	if s.template == nil {
+		return
+	}
+
+	err := mergo.Merge(&s.RunnerConfig, *s.template)
+	if err != nil {
+		log.Panicln("Failed to merge the template config:", err)
+	}
+}
+
 func (s *RegisterCommand) askExecutor() {
 	for {
 		names := common.GetExecutors()
@@ -104,6 +183,11 @@ func (s *RegisterCommand) askDocker() {
 		s.Docker = &common.DockerConfig{}
 	}
 	s.Docker.Image = s.ask("docker-image", "Please enter the default Docker image (e.g. ruby:2.1):")
+	for _, volume := range s.Docker.Volumes {
+		if volume == "/cache" {
+			return
+		}
+	}
 	s.Docker.Volumes = append(s.Docker.Volumes, "/cache")
 }
 
@@ -122,7 +206,10 @@ func (s *RegisterCommand) askSSHServer() {
 
 func (s *RegisterCommand) askSSHLogin() {
 	s.SSH.User = s.ask("ssh-user", "Please enter the SSH user (e.g. root):")
-	s.SSH.Password = s.ask("ssh-password", "Please enter the SSH password (e.g. docker.io):", true)
+	// the password of the template is kept, it's not suggested
+	if password := s.ask("ssh-password", "Please enter the SSH password (e.g. docker.io):", true); password != "" {
+		s.SSH.Password = password
+	}
 	s.SSH.IdentityFile = s.ask("ssh-identity-file", "Please enter path to SSH identity file (e.g. /home/user/.ssh/id_rsa):", true)
 }
 
@@ -133,15 +220,22 @@ func (s *RegisterCommand) addRunner(runner *common.RunnerConfig) {
 func (s *RegisterCommand) askRunner() {
 	s.URL = s.ask("url", "Please enter the gitlab-ci coordinator URL (e.g. https://gitlab.com/):")
 
-	if s.Token != "" {
+	if isAuthenticationToken(s.Token) {
+		s.verifyAuthenticationToken()
+	} else if s.Token != "" {
 		log.Infoln("Token specified trying to verify runner...")
 		log.Warningln("If you want to register use the '-r' instead of '-t'.")
-		if !s.network.VerifyRunner(s.RunnerCredentials) {
+		if s.network.VerifyRunner(s.RunnerCredentials) != common.VerifySucceeded {
 			log.Panicln("Failed to verify this runner. Perhaps you are having network problems")
 		}
 	} else {
 		// we store registration token as token, since we pass that to RunnerCredentials
 		s.Token = s.ask("registration-token", "Please enter the gitlab-ci token for this runner:")
+		if isAuthenticationToken(s.Token) {
+			s.verifyAuthenticationToken()
+			return
+		}
+
 		s.Name = s.ask("name", "Please enter the gitlab-ci description for this runner:")
 		s.TagList = s.ask("tag-list", "Please enter the gitlab-ci tags for this runner (comma separated):", true)
 
@@ -162,10 +256,51 @@ func (s *RegisterCommand) askRunner() {
 		}
 
 		s.Token = result.Token
+		s.Tags = splitTagList(s.TagList)
 		s.registered = true
 	}
 }
 
+func splitTagList(tagList string) []string {
+	var tags []string
+	for _, tag := range strings.Split(tagList, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+func isAuthenticationToken(token string) bool {
+	return strings.HasPrefix(token, common.RunnerAuthenticationTokenPrefix)
+}
+
+// verifyAuthenticationToken verifies the authentication token of a runner
+// created in GitLab, which replaces the registration. The description and the
+// tags of the runner are set in GitLab. The runner is not deleted when the
+// registration fails, as it was not created by the command.
+func (s *RegisterCommand) verifyAuthenticationToken() {
+	if s.TagList != "" || s.RunUntagged {
+		log.Warningln("The tags of the runners created in GitLab are set in GitLab, the 'tag-list' and 'run-untagged' options are ignored")
+	}
+
+	result, _ := s.network.VerifyRunnerToken(s.RunnerCredentials)
+	if result == nil {
+		log.Panicln("Failed to verify the runner authentication token. Perhaps you are having network problems")
+	}
+
+	if result.Token != "" {
+		s.Token = result.Token
+	}
+
+	entry := log.WithField("id", result.ID)
+	if result.TokenExpiresAt != nil {
+		entry = entry.WithField("token-expires-at", result.TokenExpiresAt)
+	}
+	entry.Infoln("Runner authentication token verified")
+}
+
 func (s *RegisterCommand) askExecutorOptions() {
 	kubernetes := s.Kubernetes
 	machine := s.Machine
@@ -227,6 +362,10 @@ func (s *RegisterCommand) Execute(context *cli.Context) {
 	if err != nil {
 		log.Panicln(err)
 	}
+	err = s.loadTemplate()
+	if err != nil {
+		log.Panicln(err)
+	}
 	s.askRunner()
 
 	if !s.LeaveRunner {
@@ -257,7 +396,16 @@ func (s *RegisterCommand) Execute(context *cli.Context) {
 	}
 
 	s.askExecutor()
+	s.mergeTemplate()
 	s.askExecutorOptions()
+
+	if s.TokenStore != "" {
+		err = s.config.StoreToken(&s.RunnerConfig, s.TokenStore)
+		if err != nil {
+			log.Panicln(err)
+		}
+	}
+
 	s.addRunner(&s.RunnerConfig)
 	s.saveConfig()
 
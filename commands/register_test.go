@@ -0,0 +1,161 @@
+package commands
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/codegangsta/cli"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/ssh"
+)
+
+func newTemplateRegisterCommand(t *testing.T, template string, flags ...string) (*RegisterCommand, func()) {
+	file, err := ioutil.TempFile("", "template.toml")
+	require.NoError(t, err)
+	file.WriteString(template)
+	file.Close()
+
+	set := flag.NewFlagSet("register", flag.ContinueOnError)
+	for _, name := range []string{"executor", "docker-image", "ssh-user", "ssh-password", "ssh-identity-file"} {
+		set.String(name, "", "")
+	}
+	require.NoError(t, set.Parse(flags))
+
+	s := &RegisterCommand{
+		context:        cli.NewContext(nil, set, nil),
+		NonInteractive: true,
+		TemplateConfig: file.Name(),
+		RunnerConfig: common.RunnerConfig{
+			RunnerSettings: common.RunnerSettings{
+				Docker: &common.DockerConfig{},
+				SSH:    &ssh.Config{},
+			},
+		},
+	}
+	require.NoError(t, s.loadTemplate())
+	return s, func() { os.Remove(file.Name()) }
+}
+
+func TestRegisterTemplateConfig(t *testing.T) {
+	s, cleanup := newTemplateRegisterCommand(t, `
+[[runners]]
+  executor = "docker"
+  environment = ["A=1"]
+  [runners.docker]
+    image = "alpine"
+    privileged = true
+    volumes = ["/cache", "/certs"]
+  [runners.kubernetes]
+    namespace = "ci"
+`, "--docker-image", "ruby:2.1")
+	defer cleanup()
+
+	s.askExecutor()
+	s.mergeTemplate()
+	s.askExecutorOptions()
+
+	assert.Equal(t, "docker", s.Executor)
+	assert.Equal(t, []string{"A=1"}, s.Environment)
+	assert.Equal(t, "ruby:2.1", s.Docker.Image, "the options given take precedence")
+	assert.True(t, s.Docker.Privileged)
+	assert.Equal(t, []string{"/cache", "/certs"}, s.Docker.Volumes)
+	assert.Nil(t, s.Kubernetes, "the sections of the other executors are removed")
+}
+
+func TestRegisterTemplateConfigValues(t *testing.T) {
+	s, cleanup := newTemplateRegisterCommand(t, `
+[[runners]]
+  executor = "docker-ssh"
+  [runners.docker]
+    image = "alpine"
+  [runners.ssh]
+    user = "ci"
+    password = "secret"
+`)
+	defer cleanup()
+
+	s.askExecutor()
+	s.mergeTemplate()
+	s.askExecutorOptions()
+
+	assert.Equal(t, "alpine", s.Docker.Image)
+	assert.Equal(t, "ci", s.SSH.User)
+	assert.Equal(t, "secret", s.SSH.Password)
+	assert.Empty(t, s.templateValue("ssh-password"))
+}
+
+func TestRegisterTemplateConfigInvalid(t *testing.T) {
+	for _, template := range []string{"", "[[runners]]\n[[runners]]\n"} {
+		file, err := ioutil.TempFile("", "template.toml")
+		require.NoError(t, err)
+		defer os.Remove(file.Name())
+		file.WriteString(template)
+		file.Close()
+
+		s := &RegisterCommand{TemplateConfig: file.Name()}
+		assert.EqualError(t, s.loadTemplate(), "The template config "+file.Name()+" must have one [[runners]] entry")
+		assert.Nil(t, s.template)
+	}
+
+	s := &RegisterCommand{TemplateConfig: "/not/existing/template.toml"}
+	assert.Error(t, s.loadTemplate())
+}
+
+func newRegisterCommandWithNetwork(t *testing.T, flags ...string) (*RegisterCommand, *common.MockNetwork) {
+	set := flag.NewFlagSet("register", flag.ContinueOnError)
+	for _, name := range []string{"url", "registration-token", "name", "tag-list", "run-untagged"} {
+		set.String(name, "", "")
+	}
+	require.NoError(t, set.Parse(flags))
+
+	network := &common.MockNetwork{}
+	return &RegisterCommand{
+		context:        cli.NewContext(nil, set, nil),
+		NonInteractive: true,
+		network:        network,
+	}, network
+}
+
+func TestRegisterAuthenticationToken(t *testing.T) {
+	s, network := newRegisterCommandWithNetwork(t, "--url", "https://gitlab.example.com/", "--registration-token", "glrt-token")
+	defer network.AssertExpectations(t)
+
+	credentials := common.RunnerCredentials{URL: "https://gitlab.example.com/", Token: "glrt-token"}
+	network.On("VerifyRunnerToken", credentials).Return(&common.VerifyRunnerTokenResponse{ID: 12, Token: "glrt-token"}, common.VerifySucceeded).Once()
+
+	s.askRunner()
+
+	assert.Equal(t, "glrt-token", s.Token)
+	assert.False(t, s.registered, "the runner created in GitLab is not deleted when the registration fails")
+}
+
+func TestRegisterAuthenticationTokenFailed(t *testing.T) {
+	s, network := newRegisterCommandWithNetwork(t, "--url", "https://gitlab.example.com/")
+	defer network.AssertExpectations(t)
+
+	s.Token = "glrt-token"
+	credentials := common.RunnerCredentials{URL: "https://gitlab.example.com/", Token: "glrt-token"}
+	network.On("VerifyRunnerToken", credentials).Return(nil, common.VerifyForbidden).Once()
+
+	assert.Panics(t, s.askRunner)
+}
+
+func TestRegisterRegistrationToken(t *testing.T) {
+	s, network := newRegisterCommandWithNetwork(t, "--url", "https://gitlab.example.com/", "--registration-token", "registration-token",
+		"--name", "runner", "--tag-list", "docker, linux", "--run-untagged", "false")
+	defer network.AssertExpectations(t)
+
+	credentials := common.RunnerCredentials{URL: "https://gitlab.example.com/", Token: "registration-token"}
+	network.On("RegisterRunner", credentials, "runner", "docker, linux", false).Return(&common.RegisterRunnerResponse{Token: "runner-token"}).Once()
+
+	s.askRunner()
+
+	assert.Equal(t, "runner-token", s.Token)
+	assert.Equal(t, []string{"docker", "linux"}, s.Tags)
+	assert.True(t, s.registered)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"runtime"
+	"strings"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/ayufan/golang-kardianos-service"
@@ -82,7 +83,28 @@ func runServiceInstall(s service.Service, c *cli.Context) error {
 			}
 		}
 	}
-	return service.Control(s, "install")
+	err := service.Control(s, "install")
+	if err != nil {
+		return err
+	}
+
+	err = configureService(c)
+	if err != nil {
+		logrus.Warningln("Failed to configure the service:", err)
+	}
+	return nil
+}
+
+// isServiceAccount checks if the user is an account of Windows without
+// password: the built-in accounts, like NT AUTHORITY\LocalService, the
+// virtual accounts, like NT SERVICE\gitlab-runner, and the group managed
+// service accounts, like DOMAIN\gitlab-runner$
+func isServiceAccount(user string) bool {
+	upper := strings.ToUpper(user)
+	return upper == "LOCALSYSTEM" ||
+		strings.HasPrefix(upper, `NT AUTHORITY\`) ||
+		strings.HasPrefix(upper, `NT SERVICE\`) ||
+		strings.HasSuffix(upper, "$")
 }
 
 func runServiceStatus(displayName string, s service.Service, c *cli.Context) error {
@@ -147,10 +169,15 @@ func createServiceConfig(c *cli.Context) (svcConfig *service.Config) {
 		}
 
 	case "windows":
+		user, password := c.String("user"), c.String("password")
+		if user != "" && password == "" && !isServiceAccount(user) {
+			logrus.Fatalln("Please specify the password of the user, only the service accounts don't have one")
+		}
+
 		svcConfig.Option = service.KeyValue{
-			"Password": c.String("password"),
+			"Password": password,
 		}
-		svcConfig.UserName = c.String("user")
+		svcConfig.UserName = user
 	}
 	return
 }
@@ -207,7 +234,7 @@ func init() {
 		installFlags = append(installFlags, cli.StringFlag{
 			Name:  "password, p",
 			Value: "",
-			Usage: "Specify user password to install service (required)",
+			Usage: "Specify user password to install service (required, unless the user is a service account)",
 		})
 	} else if os.Getuid() == 0 {
 		installFlags = append(installFlags, cli.StringFlag{
@@ -0,0 +1,16 @@
+package commands
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsServiceAccount(t *testing.T) {
+	assert.True(t, isServiceAccount("LocalSystem"))
+	assert.True(t, isServiceAccount(`NT AUTHORITY\LocalService`))
+	assert.True(t, isServiceAccount(`NT Service\gitlab-runner`))
+	assert.True(t, isServiceAccount(`DOMAIN\gitlab-runner$`))
+	assert.False(t, isServiceAccount(`DOMAIN\gitlab-runner`))
+	assert.False(t, isServiceAccount("gitlab-runner"))
+}
@@ -0,0 +1,13 @@
+// +build linux darwin freebsd openbsd
+
+package commands
+
+import (
+	"github.com/codegangsta/cli"
+)
+
+// configureService has nothing to configure, the service managers restart
+// the runner as set in the service files
+func configureService(c *cli.Context) error {
+	return nil
+}
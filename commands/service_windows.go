@@ -0,0 +1,56 @@
+package commands
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/codegangsta/cli"
+)
+
+// serviceRecoveryActions restarts the service after a minute on its first
+// three failures, the count of the failures is reset after a day
+var serviceRecoveryActions = []string{"reset=", "86400", "actions=", "restart/60000/restart/60000/restart/60000"}
+
+func runServiceCommand(name string, args ...string) error {
+	output, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s: %v: %s", name, strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// configureService sets the recovery actions of the service, also used when
+// it stops with a non-zero exit code, and grants to its user the right to
+// modify the working directory and the directory of the config file
+func configureService(c *cli.Context) error {
+	name := c.String("service")
+	err := runServiceCommand("sc.exe", append([]string{"failure", name}, serviceRecoveryActions...)...)
+	if err != nil {
+		return err
+	}
+
+	err = runServiceCommand("sc.exe", "failureflag", name, "1")
+	if err != nil {
+		return err
+	}
+
+	user := c.String("user")
+	if user == "" {
+		return nil
+	}
+
+	dirs := []string{c.String("working-directory")}
+	if configFile := c.String("config"); configFile != "" {
+		dirs = append(dirs, filepath.Dir(configFile))
+	}
+
+	for _, dir := range dirs {
+		err = runServiceCommand("icacls.exe", dir, "/grant", user+":(OI)(CI)M")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
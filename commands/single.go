@@ -20,6 +20,8 @@ type RunSingleCommand struct {
 	lastBuild   time.Time
 	runForever  bool
 	MaxBuilds   int `long:"max-builds" description:"How many builds to process before exiting"`
+	MaxLifetime int `long:"max-lifetime" description:"How long to run in seconds before exiting, the running build is finished first"`
+	startedAt   time.Time
 	finished    bool
 }
 
@@ -114,6 +116,10 @@ func (r *RunSingleCommand) checkFinishedConditions() {
 		log.Println("This runner has not received a job in", r.WaitTimeout, "seconds, so now exiting")
 		r.finished = true
 	}
+	if r.MaxLifetime > 0 && int(time.Since(r.startedAt).Seconds()) >= r.MaxLifetime {
+		log.Println("This runner has reached its lifetime of", r.MaxLifetime, "seconds, so now exiting")
+		r.finished = true
+	}
 	return
 }
 
@@ -142,7 +148,8 @@ func (r *RunSingleCommand) Execute(c *cli.Context) {
 
 	go waitForInterrupts(&r.finished, abortSignal, doneSignal)
 
-	r.lastBuild = time.Now()
+	r.startedAt = time.Now()
+	r.lastBuild = r.startedAt
 
 	for !r.finished {
 		data, err := executorProvider.Acquire(&r.RunnerConfig)
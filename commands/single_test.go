@@ -0,0 +1,30 @@
+package commands
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunSingleMaxBuilds(t *testing.T) {
+	r := &RunSingleCommand{MaxBuilds: 1, lastBuild: time.Now()}
+
+	r.checkFinishedConditions()
+	assert.False(t, r.finished)
+
+	r.postBuild()
+	r.checkFinishedConditions()
+	assert.True(t, r.finished)
+}
+
+func TestRunSingleMaxLifetime(t *testing.T) {
+	r := &RunSingleCommand{runForever: true, MaxLifetime: 60, startedAt: time.Now()}
+
+	r.checkFinishedConditions()
+	assert.False(t, r.finished)
+
+	r.startedAt = time.Now().Add(-time.Minute)
+	r.checkFinishedConditions()
+	assert.True(t, r.finished)
+}
@@ -1,6 +1,9 @@
 package commands
 
 import (
+	"path"
+	"strings"
+
 	"github.com/codegangsta/cli"
 
 	log "github.com/Sirupsen/logrus"
@@ -12,7 +15,83 @@ type UnregisterCommand struct {
 	configOptions
 	common.RunnerCredentials
 	network common.Network
-	Name    string `toml:"name" json:"name" short:"n" long:"name" description:"Name of the runner you wish to unregister"`
+	Name    string `toml:"name" json:"name" short:"n" long:"name" description:"Name of the runner you wish to unregister, a glob pattern with --all-runners"`
+
+	AllRunners bool   `long:"all-runners" description:"Unregister all the runners matching the --url, --executor, --tag and --name filters"`
+	Executor   string `long:"executor" description:"Unregister only the runners of this executor, with --all-runners"`
+	Tag        string `long:"tag" description:"Unregister only the runners registered with this tag, with --all-runners"`
+}
+
+func hasTag(runner *common.RunnerConfig, tag string) bool {
+	for _, runnerTag := range runner.Tags {
+		if runnerTag == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *UnregisterCommand) matchRunner(runner *common.RunnerConfig) bool {
+	if c.URL != "" && strings.TrimRight(runner.URL, "/") != strings.TrimRight(c.URL, "/") {
+		return false
+	}
+	if c.Executor != "" && runner.Executor != c.Executor {
+		return false
+	}
+	if c.Tag != "" && !hasTag(runner, c.Tag) {
+		return false
+	}
+	if c.Name != "" {
+		// the pattern is checked before
+		matched, _ := path.Match(c.Name, runner.Name)
+		return matched
+	}
+	return true
+}
+
+// unregisterAllRunners deletes the runners matching the filters, in GitLab
+// and in the config. The runners which can't be deleted in GitLab are kept.
+func (c *UnregisterCommand) unregisterAllRunners() {
+	_, err := path.Match(c.Name, "")
+	if err != nil {
+		log.Fatalln("Invalid name pattern", c.Name+":", err)
+		return
+	}
+
+	runners := []*common.RunnerConfig{}
+	for _, runner := range c.config.Runners {
+		if !c.matchRunner(runner) {
+			runners = append(runners, runner)
+			continue
+		}
+
+		if !c.network.DeleteRunner(runner.RunnerCredentials) {
+			log.Errorln("Failed to delete runner", runner.Name)
+			runners = append(runners, runner)
+			continue
+		}
+
+		log.Println("Unregistered runner", runner.Name)
+		if file := runner.IncludedFrom(); file != "" {
+			log.Warningln("The runner is defined in", file+", it has to be removed from it")
+		}
+	}
+
+	if len(c.config.Runners) == len(runners) {
+		log.Warningln("No runner was unregistered")
+		return
+	}
+
+	c.config.Runners = runners
+	c.updateConfig()
+}
+
+func (c *UnregisterCommand) updateConfig() {
+	err := c.saveConfig()
+	if err != nil {
+		log.Fatalln("Failed to update", c.ConfigFile, err)
+	}
+	log.Println("Updated", c.ConfigFile)
 }
 
 func (c *UnregisterCommand) Execute(context *cli.Context) {
@@ -24,6 +103,11 @@ func (c *UnregisterCommand) Execute(context *cli.Context) {
 		return
 	}
 
+	if c.AllRunners {
+		c.unregisterAllRunners()
+		return
+	}
+
 	if len(c.Name) > 0 {
 		runnerConfig, err := c.RunnerByName(c.Name)
 		if err != nil {
@@ -40,7 +124,10 @@ func (c *UnregisterCommand) Execute(context *cli.Context) {
 
 	runners := []*common.RunnerConfig{}
 	for _, otherRunner := range c.config.Runners {
-		if otherRunner.RunnerCredentials == c.RunnerCredentials {
+		if otherRunner.URL == c.URL && otherRunner.Token == c.Token {
+			if file := otherRunner.IncludedFrom(); file != "" {
+				log.Warningln("The runner is defined in", file+", it has to be removed from it")
+			}
 			continue
 		}
 		runners = append(runners, otherRunner)
@@ -52,13 +139,7 @@ func (c *UnregisterCommand) Execute(context *cli.Context) {
 	}
 
 	c.config.Runners = runners
-
-	// save config file
-	err = c.saveConfig()
-	if err != nil {
-		log.Fatalln("Failed to update", c.ConfigFile, err)
-	}
-	log.Println("Updated", c.ConfigFile)
+	c.updateConfig()
 }
 
 func init() {
@@ -0,0 +1,119 @@
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+func newUnregisterAllCommand(t *testing.T, network common.Network) (*UnregisterCommand, func()) {
+	dir, err := ioutil.TempDir("", "unregister")
+	require.NoError(t, err)
+
+	runner := func(name, url, executor string) *common.RunnerConfig {
+		return &common.RunnerConfig{
+			Name:              name,
+			RunnerCredentials: common.RunnerCredentials{URL: url, Token: name + "-token"},
+			RunnerSettings:    common.RunnerSettings{Executor: executor},
+		}
+	}
+
+	c := &UnregisterCommand{
+		configOptions: configOptions{
+			ConfigFile: filepath.Join(dir, "config.toml"),
+			config: &common.Config{
+				Runners: []*common.RunnerConfig{
+					runner("autoscale-1", "https://gitlab.example.com/", "docker+machine"),
+					runner("autoscale-2", "https://gitlab.example.com", "docker+machine"),
+					runner("autoscale-3", "https://other.example.com/", "docker+machine"),
+					runner("shell", "https://gitlab.example.com/", "shell"),
+				},
+			},
+		},
+		network:    network,
+		AllRunners: true,
+	}
+	return c, func() { os.RemoveAll(dir) }
+}
+
+func runnerNames(config *common.Config) string {
+	names := []string{}
+	for _, runner := range config.Runners {
+		names = append(names, runner.Name)
+	}
+	return strings.Join(names, " ")
+}
+
+func TestUnregisterAllRunners(t *testing.T) {
+	network := &common.MockNetwork{}
+	defer network.AssertExpectations(t)
+
+	c, cleanup := newUnregisterAllCommand(t, network)
+	defer cleanup()
+
+	c.URL = "https://gitlab.example.com/"
+	c.Executor = "docker+machine"
+	c.Name = "autoscale-*"
+
+	network.On("DeleteRunner", c.config.Runners[0].RunnerCredentials).Return(true).Once()
+	network.On("DeleteRunner", c.config.Runners[1].RunnerCredentials).Return(false).Once()
+
+	c.unregisterAllRunners()
+
+	assert.Equal(t, "autoscale-2 autoscale-3 shell", runnerNames(c.config), "the runner failed to be deleted is kept")
+
+	saved := common.NewConfig()
+	require.NoError(t, saved.LoadConfig(c.ConfigFile))
+	assert.Equal(t, "autoscale-2 autoscale-3 shell", runnerNames(saved))
+}
+
+func TestUnregisterAllRunnersWithoutFilters(t *testing.T) {
+	network := &common.MockNetwork{}
+	defer network.AssertExpectations(t)
+
+	c, cleanup := newUnregisterAllCommand(t, network)
+	defer cleanup()
+
+	for _, runner := range c.config.Runners {
+		network.On("DeleteRunner", runner.RunnerCredentials).Return(true).Once()
+	}
+
+	c.unregisterAllRunners()
+	assert.Empty(t, c.config.Runners)
+}
+
+func TestUnregisterAllRunnersWithTag(t *testing.T) {
+	network := &common.MockNetwork{}
+	defer network.AssertExpectations(t)
+
+	c, cleanup := newUnregisterAllCommand(t, network)
+	defer cleanup()
+
+	c.config.Runners[1].Tags = []string{"docker", "linux"}
+	c.config.Runners[3].Tags = []string{"linux"}
+	c.Tag = "docker"
+
+	network.On("DeleteRunner", c.config.Runners[1].RunnerCredentials).Return(true).Once()
+
+	c.unregisterAllRunners()
+	assert.Equal(t, "autoscale-1 autoscale-3 shell", runnerNames(c.config))
+}
+
+func TestUnregisterAllRunnersNoMatch(t *testing.T) {
+	c, cleanup := newUnregisterAllCommand(t, &common.MockNetwork{})
+	defer cleanup()
+
+	c.Name = "staging-*"
+	c.unregisterAllRunners()
+
+	assert.Equal(t, "autoscale-1 autoscale-2 autoscale-3 shell", runnerNames(c.config))
+	_, err := os.Stat(c.ConfigFile)
+	assert.True(t, os.IsNotExist(err), "the config is not saved")
+}
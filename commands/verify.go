@@ -12,7 +12,17 @@ type VerifyCommand struct {
 	configOptions
 	network common.Network
 
-	DeleteNonExisting bool `long:"delete" description:"Delete no longer existing runners?"`
+	DeleteNonExisting bool `long:"delete" description:"Delete the runners removed from GitLab from the config file"`
+}
+
+// verifyRunner verifies the token of the runner, the runners created in
+// GitLab are verified with the API of their authentication token
+func verifyRunner(network common.Network, runner *common.RunnerConfig) common.VerifyState {
+	if isAuthenticationToken(runner.Token) {
+		_, state := network.VerifyRunnerToken(runner.RunnerCredentials)
+		return state
+	}
+	return network.VerifyRunner(runner.RunnerCredentials)
 }
 
 func (c *VerifyCommand) Execute(context *cli.Context) {
@@ -24,11 +34,18 @@ func (c *VerifyCommand) Execute(context *cli.Context) {
 		return
 	}
 
-	// verify if runner exist
+	// verify if runner exist, the runners which fail to be verified, e.g.
+	// because of network problems, are kept
 	runners := []*common.RunnerConfig{}
 	for _, runner := range c.config.Runners {
-		if c.network.VerifyRunner(runner.RunnerCredentials) {
+		if verifyRunner(c.network, runner) != common.VerifyForbidden {
 			runners = append(runners, runner)
+			continue
+		}
+
+		runner.Log().Warningln("The runner was removed from GitLab")
+		if file := runner.IncludedFrom(); file != "" && c.DeleteNonExisting {
+			log.Warningln("The runner", runner.ShortDescription(), "is defined in", file+", it has to be removed from it")
 		}
 	}
 
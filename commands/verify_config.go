@@ -0,0 +1,435 @@
+package commands
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	log "github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+var (
+	tomlParseError    = regexp.MustCompile(`^Near line (\d+) \(last key parsed '[^']*'\): (.*)$`)
+	tomlMismatchField = regexp.MustCompile(`Type mismatch for '[^']*\.([^'.]+)'`)
+	tomlMismatchType  = regexp.MustCompile(`Expected (\S+) but found '([^']+)'`)
+)
+
+// configProblem is a problem of the config file, at the line when it's known
+type configProblem struct {
+	line    int
+	message string
+}
+
+func (p configProblem) String() string {
+	if p.line == 0 {
+		return p.message
+	}
+	return fmt.Sprintf("line %d: %s", p.line, p.message)
+}
+
+// configKey is a key, or the header of a table, defined by the config file
+type configKey struct {
+	key     string
+	line    int
+	runner  int
+	profile int
+}
+
+// configKeys finds the lines of the keys and of the headers of the tables
+// of the config file, with the indexes of the runners and the profiles they
+// belong to, or -1. The lines of the multi-line arrays and strings are
+// skipped.
+func configKeys(data []byte) (keys []configKey) {
+	table := ""
+	runner, profile := -1, -1
+	multiLineString, arrayDepth := "", 0
+
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+
+		switch {
+		case multiLineString != "":
+			if strings.Contains(line, multiLineString) {
+				multiLineString = ""
+			}
+			continue
+		case arrayDepth > 0:
+			arrayDepth += bracketsDepth(line)
+			continue
+		case line == "" || strings.HasPrefix(line, "#"):
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			arrayTable := strings.HasPrefix(line, "[[")
+			table = joinKey(splitKey(strings.Trim(strings.SplitN(line, "]", 2)[0], "[ ")))
+			if arrayTable && table == "runners" {
+				runner++
+				profile = -1
+			} else if arrayTable && table == "runners.profiles" {
+				profile++
+			} else if !strings.HasPrefix(table, "runners.") {
+				runner, profile = -1, -1
+			} else if !strings.HasPrefix(table, "runners.profiles.") && table != "runners.profiles" {
+				profile = -1
+			}
+			keys = append(keys, configKey{key: table, line: i + 1, runner: runner, profile: profile})
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		key := joinKey(splitKey(parts[0]))
+		if table != "" {
+			key = table + "." + key
+		}
+		keys = append(keys, configKey{key: key, line: i + 1, runner: runner, profile: profile})
+
+		if len(parts) < 2 {
+			continue
+		}
+		value := strings.TrimSpace(parts[1])
+		for _, delimiter := range []string{`"""`, `'''`} {
+			if strings.HasPrefix(value, delimiter) && strings.Count(value, delimiter) == 1 {
+				multiLineString = delimiter
+			}
+		}
+		if multiLineString == "" {
+			arrayDepth = bracketsDepth(value)
+		}
+	}
+	return
+}
+
+// bracketsDepth counts the brackets opened and not closed by the value,
+// outside of the strings and the comments
+func bracketsDepth(value string) (depth int) {
+	quote := rune(0)
+	escaped := false
+	for _, c := range value {
+		switch {
+		case escaped:
+			escaped = false
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				escaped = true
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		}
+	}
+	return
+}
+
+// splitKey splits the dotted key, which parts can be quoted
+func splitKey(key string) (parts []string) {
+	quote := rune(0)
+	part := ""
+	for _, c := range strings.TrimSpace(key) {
+		switch {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+			part += string(c)
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '.':
+			parts = append(parts, strings.TrimSpace(part))
+			part = ""
+		default:
+			part += string(c)
+		}
+	}
+	return append(parts, strings.TrimSpace(part))
+}
+
+func joinKey(parts []string) string {
+	return strings.Join(parts, ".")
+}
+
+// findLine returns the line of the key of the runner or of its profile, or
+// the line of the header of the runner, or of the profile, when the key is
+// not defined
+func findLine(keys []configKey, runner, profile int, key string) (line int) {
+	header := "runners"
+	if profile >= 0 {
+		header = "runners.profiles"
+	}
+
+	for _, k := range keys {
+		if k.runner != runner || k.profile != profile {
+			continue
+		}
+		if k.key == key {
+			return k.line
+		}
+		if k.key == header && line == 0 {
+			line = k.line
+		}
+	}
+	return
+}
+
+// unknownKeys reports the keys unknown to the runner, which are ignored, like
+// the ones with typos
+func unknownKeys(metadata toml.MetaData, keys []configKey) (problems []configProblem) {
+	next := 0
+	var unknown []string
+	for _, key := range metadata.Undecoded() {
+		name := key.String()
+
+		line := 0
+		for i := next; i < len(keys); i++ {
+			if keys[i].key == name {
+				line = keys[i].line
+				next = i + 1
+				break
+			}
+		}
+
+		// the keys of the unknown tables are not reported again
+		reported := false
+		for _, parent := range unknown {
+			if strings.HasPrefix(name, parent+".") {
+				reported = true
+			}
+		}
+		if reported {
+			continue
+		}
+
+		unknown = append(unknown, name)
+		problems = append(problems, configProblem{line: line, message: fmt.Sprintf("unknown key %s", name)})
+	}
+	return
+}
+
+// decodingProblem reports the error of the syntax or of the type of a value,
+// at its line when it can be found
+func decodingProblem(err error, keys []configKey) configProblem {
+	message := err.Error()
+	if matches := tomlParseError.FindStringSubmatch(message); matches != nil {
+		line, _ := strconv.Atoi(matches[1])
+		return configProblem{line: line, message: matches[2]}
+	}
+
+	fields := tomlMismatchField.FindAllStringSubmatch(message, -1)
+	if len(fields) == 0 {
+		return configProblem{message: message}
+	}
+
+	name := fields[len(fields)-1][1]
+	if types := tomlMismatchType.FindStringSubmatch(message); types != nil {
+		message = fmt.Sprintf("invalid value of %s: expected %s but found %s", name, types[1], types[2])
+	}
+
+	// the line is known only when the key is defined once
+	line := 0
+	for _, k := range keys {
+		if k.key == name || strings.HasSuffix(k.key, "."+name) {
+			if line != 0 {
+				return configProblem{message: message}
+			}
+			line = k.line
+		}
+	}
+	return configProblem{line: line, message: message}
+}
+
+// executorSections are the sections of the runners required and used by the
+// executors
+var executorSections = map[string]struct {
+	required []string
+	optional []string
+}{
+	"shell":              {optional: []string{"shell_executor"}},
+	"ssh":                {required: []string{"ssh"}},
+	"docker":             {required: []string{"docker"}},
+	"docker-ssh":         {required: []string{"docker", "ssh"}},
+	"docker+machine":     {required: []string{"docker", "machine"}},
+	"docker-ssh+machine": {required: []string{"docker", "ssh", "machine"}},
+	"podman":             {required: []string{"podman"}},
+	"custom":             {required: []string{"custom"}},
+	"parallels":          {required: []string{"ssh", "parallels"}},
+	"virtualbox":         {required: []string{"ssh", "virtualbox"}},
+	"lxd":                {required: []string{"lxd"}},
+	"fargate":            {required: []string{"fargate"}},
+	"gcp-batch":          {required: []string{"gcp_batch"}},
+	"wsl":                {required: []string{"wsl"}},
+	"kubernetes":         {optional: []string{"kubernetes"}},
+}
+
+// runnerSections returns the executor sections defined for the runner
+func runnerSections(settings *common.RunnerSettings) map[string]bool {
+	return map[string]bool{
+		"shell_executor": settings.ShellExecutor != nil,
+		"ssh":            settings.SSH != nil,
+		"docker":         settings.Docker != nil,
+		"podman":         settings.Podman != nil,
+		"custom":         settings.Custom != nil,
+		"parallels":      settings.Parallels != nil,
+		"virtualbox":     settings.VirtualBox != nil,
+		"lxd":            settings.LXD != nil,
+		"fargate":        settings.Fargate != nil,
+		"gcp_batch":      settings.GCPBatch != nil,
+		"wsl":            settings.WSL != nil,
+		"machine":        settings.Machine != nil,
+		"kubernetes":     settings.Kubernetes != nil,
+	}
+}
+
+// checkExecutor reports the unknown executor, its missing sections and the
+// sections of the other executors, which are ignored
+func checkExecutor(keys []configKey, runner, profile int, settings *common.RunnerSettings, required bool) (problems []configProblem) {
+	prefix := "runners."
+	if profile >= 0 {
+		prefix = "runners.profiles."
+	}
+	report := func(key, format string, args ...interface{}) {
+		problems = append(problems, configProblem{
+			line:    findLine(keys, runner, profile, prefix+key),
+			message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	if settings.Executor == "" {
+		if required {
+			report("executor", "missing executor")
+		}
+		return
+	}
+
+	sections, ok := executorSections[settings.Executor]
+	if !ok {
+		if common.GetExecutor(settings.Executor) == nil {
+			report("executor", "unknown executor %q", settings.Executor)
+		}
+		return
+	}
+
+	defined := runnerSections(settings)
+	used := make(map[string]bool)
+	for _, section := range sections.required {
+		used[section] = true
+		if required && !defined[section] {
+			report("executor", "missing [%s%s] section of the %s executor", prefix, section, settings.Executor)
+		}
+	}
+	for _, section := range sections.optional {
+		used[section] = true
+	}
+
+	for _, section := range sortedKeys(defined) {
+		if defined[section] && !used[section] {
+			report(section, "the [%s%s] section is ignored by the %s executor", prefix, section, settings.Executor)
+		}
+	}
+	return
+}
+
+func sortedKeys(m map[string]bool) (keys []string) {
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return
+}
+
+// exclusiveOptions reports the options set together, of which only the
+// first one is used
+func exclusiveOptions(keys []configKey, runner int, settings *common.RunnerSettings) (problems []configProblem) {
+	report := func(key, used, ignored string) {
+		problems = append(problems, configProblem{
+			line:    findLine(keys, runner, -1, key),
+			message: fmt.Sprintf("%s and %s are mutually exclusive, %s is ignored", used, ignored, ignored),
+		})
+	}
+
+	if k := settings.Kubernetes; k != nil {
+		if k.Host != "" && (k.KubeConfig != "" || k.Context != "") {
+			report("runners.kubernetes.kubeconfig", "host", "kubeconfig")
+		}
+		for _, option := range []struct{ used, ignored, value, legacy string }{
+			{"cpu_limit", "cpus", k.CPULimit, k.CPUs},
+			{"memory_limit", "memory", k.MemoryLimit, k.Memory},
+			{"service_cpu_limit", "service_cpus", k.ServiceCPULimit, k.ServiceCPUs},
+			{"service_memory_limit", "service_memory", k.ServiceMemoryLimit, k.ServiceMemory},
+			{"helper_cpu_limit", "helper_cpus", k.HelperCPULimit, k.HelperCPUs},
+			{"helper_memory_limit", "helper_memory", k.HelperMemoryLimit, k.HelperMemory},
+		} {
+			if option.value != "" && option.legacy != "" {
+				report("runners.kubernetes."+option.ignored, option.used, option.ignored)
+			}
+		}
+		if k.TerminationGracePeriodSeconds != 0 && k.PodTerminationGracePeriod != nil {
+			report("runners.kubernetes.terminationGracePeriodSeconds", "termination_grace_period_seconds", "terminationGracePeriodSeconds")
+		}
+	}
+	return
+}
+
+// checkConfig checks the config file, returning its problems
+func checkConfig(data []byte) (problems []configProblem) {
+	keys := configKeys(data)
+
+	config := common.NewConfig()
+	metadata, err := toml.Decode(string(data), config)
+	if err != nil {
+		return []configProblem{decodingProblem(err, keys)}
+	}
+
+	problems = unknownKeys(metadata, keys)
+
+	for i, runner := range config.Runners {
+		problems = append(problems, checkExecutor(keys, i, -1, &runner.RunnerSettings, true)...)
+		problems = append(problems, exclusiveOptions(keys, i, &runner.RunnerSettings)...)
+
+		for j := range runner.Profiles {
+			problems = append(problems, checkExecutor(keys, i, j, &runner.Profiles[j].RunnerSettings, false)...)
+		}
+	}
+
+	if err := config.Validate(); err != nil {
+		problems = append(problems, configProblem{message: err.Error()})
+	}
+	return
+}
+
+type VerifyConfigCommand struct {
+	configOptions
+}
+
+func (c *VerifyConfigCommand) Execute(context *cli.Context) {
+	data, err := ioutil.ReadFile(c.ConfigFile)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	problems := checkConfig(data)
+	for _, problem := range problems {
+		log.Errorln(c.ConfigFile+":", problem)
+	}
+	if len(problems) > 0 {
+		log.Fatalln("Found", len(problems), "problems in", c.ConfigFile)
+	}
+
+	log.Println(c.ConfigFile, "is valid")
+}
+
+func init() {
+	common.RegisterCommand2("verify-config", "check the config file, reporting the unknown keys, the invalid values and the settings of the executors", &VerifyConfigCommand{})
+}
@@ -0,0 +1,129 @@
+package commands
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func problemsOf(data string) string {
+	var problems []string
+	for _, problem := range checkConfig([]byte(data)) {
+		problems = append(problems, problem.String())
+	}
+	return strings.Join(problems, "\n")
+}
+
+func TestCheckConfigValid(t *testing.T) {
+	assert.Empty(t, problemsOf(`
+concurrent = 4
+
+[[runners]]
+  name = "docker"
+  url = "https://gitlab.com/"
+  token = "token"
+  executor = "docker"
+  environment = [
+    "A=[1]",
+    "B=2",
+  ]
+  [runners.docker]
+    image = "alpine"
+
+[[runners]]
+  name = "shell"
+  executor = "shell"
+  pre_build_script = """
+make deps
+"""
+`))
+}
+
+func TestCheckConfigUnknownKeys(t *testing.T) {
+	assert.Equal(t, strings.Join([]string{
+		"line 2: unknown key concurent",
+		"line 7: unknown key runners.docker.imagee",
+		"line 9: unknown key runners.dockr",
+		"line 15: unknown key runners.docker.imagee",
+	}, "\n"), problemsOf(`
+concurent = 4
+
+[[runners]]
+  executor = "docker"
+  [runners.docker]
+    imagee = "alpine"
+    image = "alpine"
+  [runners.dockr]
+    image = "alpine"
+
+[[runners]]
+  executor = "docker"
+  [runners.docker]
+    imagee = "alpine"
+`))
+}
+
+func TestCheckConfigSyntaxAndTypes(t *testing.T) {
+	assert.Equal(t, strings.Join([]string{"line 3: Expected value but found 'a' instead."}, "\n"), problemsOf(`
+[[runners]]
+  image = alpine
+`))
+
+	assert.Equal(t, strings.Join([]string{"line 4: invalid value of privileged: expected boolean but found string"}, "\n"), problemsOf(`
+[[runners]]
+  [runners.docker]
+    privileged = "yes"
+`))
+}
+
+func TestCheckConfigExecutors(t *testing.T) {
+	assert.Equal(t, strings.Join([]string{
+		"line 2: missing executor",
+		"line 4: unknown executor \"dokcer\"",
+		"line 7: missing [runners.docker] section of the docker executor",
+		"line 10: the [runners.ssh] section is ignored by the shell executor",
+		"line 15: the [runners.profiles.docker] section is ignored by the shell executor",
+	}, "\n"), problemsOf(`
+[[runners]]
+[[runners]]
+  executor = "dokcer"
+
+[[runners]]
+  executor = "docker"
+[[runners]]
+  executor = "shell"
+  [runners.ssh]
+    host = "example.com"
+  [[runners.profiles]]
+    name = "shell"
+    executor = "shell"
+    [runners.profiles.docker]
+      image = "alpine"
+`))
+}
+
+func TestCheckConfigExclusiveOptions(t *testing.T) {
+	assert.Equal(t, strings.Join([]string{
+		"line 7: host and kubeconfig are mutually exclusive, kubeconfig is ignored",
+		"line 9: cpu_limit and cpus are mutually exclusive, cpus is ignored",
+	}, "\n"), problemsOf(`
+[[runners]]
+  executor = "kubernetes"
+  [runners.kubernetes]
+    host = "https://kubernetes.example.com"
+    cpu_limit = "1"
+    kubeconfig = "/etc/kubeconfig"
+    image = "alpine"
+    cpus = "2"
+`))
+}
+
+func TestCheckConfigValidation(t *testing.T) {
+	assert.Equal(t, strings.Join([]string{`Invalid color "red" of the 1a2b3c4d runner, use always or never`}, "\n"), problemsOf(`
+[[runners]]
+  token = "1a2b3c4d"
+  executor = "shell"
+  color = "red"
+`))
+}
@@ -0,0 +1,65 @@
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+func TestVerifyDeleteRemovedRunners(t *testing.T) {
+	dir, err := ioutil.TempDir("", "verify")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	configFile := filepath.Join(dir, "config.toml")
+	err = ioutil.WriteFile(configFile, []byte(`
+[[runners]]
+  name = "alive"
+  url = "https://gitlab.example.com/"
+  token = "alive-token"
+
+[[runners]]
+  name = "removed"
+  url = "https://gitlab.example.com/"
+  token = "removed-token"
+
+[[runners]]
+  name = "unreachable"
+  url = "https://gitlab.example.com/"
+  token = "unreachable-token"
+
+[[runners]]
+  name = "created"
+  url = "https://gitlab.example.com/"
+  token = "glrt-removed"
+`), 0600)
+	require.NoError(t, err)
+
+	credentials := func(token string) common.RunnerCredentials {
+		return common.RunnerCredentials{URL: "https://gitlab.example.com/", Token: token}
+	}
+
+	network := &common.MockNetwork{}
+	defer network.AssertExpectations(t)
+	network.On("VerifyRunner", credentials("alive-token")).Return(common.VerifySucceeded).Once()
+	network.On("VerifyRunner", credentials("removed-token")).Return(common.VerifyForbidden).Once()
+	network.On("VerifyRunner", credentials("unreachable-token")).Return(common.VerifyFailed).Once()
+	network.On("VerifyRunnerToken", credentials("glrt-removed")).Return(nil, common.VerifyForbidden).Once()
+
+	c := &VerifyCommand{
+		configOptions:     configOptions{ConfigFile: configFile},
+		network:           network,
+		DeleteNonExisting: true,
+	}
+	c.Execute(nil)
+
+	saved := common.NewConfig()
+	require.NoError(t, saved.LoadConfig(configFile))
+	assert.Equal(t, "alive unreachable", runnerNames(saved))
+}
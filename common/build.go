@@ -6,12 +6,15 @@ import (
 	"net/url"
 	"os"
 	"path"
+	"runtime/debug"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Sirupsen/logrus"
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/tracing"
 )
 
 type GitStrategy int
@@ -75,6 +78,15 @@ type Build struct {
 
 	CurrentStage BuildStage
 	CurrentState BuildRuntimeState
+
+	// StartedAt is the time the build started to run on the runner
+	StartedAt time.Time `json:"-" yaml:"-"`
+
+	// Span is the trace of the job, nil when it isn't traced
+	Span *tracing.Span `json:"-" yaml:"-"`
+
+	canceled   chan interface{}
+	cancelLock sync.Mutex
 }
 
 func (b *Build) Log() *logrus.Entry {
@@ -130,10 +142,27 @@ func (b *Build) FullProjectDir() string {
 	return helpers.ToSlash(b.BuildDir)
 }
 
+// LocalArtifactsFile returns the path of the artifacts of the job in the
+// cache directory of the project, where the builds run without GitLab, like
+// the ones of exec, keep them for the next jobs
+func LocalArtifactsFile(cacheDir, job string) string {
+	return path.Join(cacheDir, "artifacts", job, "artifacts.zip")
+}
+
+// joinPath joins the paths like path.Join, but keeps the leading slashes of
+// the UNC paths, like //server/share/builds
+func joinPath(root string, elem ...string) string {
+	joined := path.Join(append([]string{root}, elem...)...)
+	if strings.HasPrefix(root, "//") && !strings.HasPrefix(joined, "//") {
+		joined = "/" + joined
+	}
+	return joined
+}
+
 func (b *Build) StartBuild(rootDir, cacheDir string, sharedDir bool) {
 	b.RootDir = rootDir
-	b.BuildDir = path.Join(rootDir, b.ProjectUniqueDir(sharedDir))
-	b.CacheDir = path.Join(cacheDir, b.ProjectUniqueDir(false))
+	b.BuildDir = joinPath(rootDir, b.ProjectUniqueDir(sharedDir))
+	b.CacheDir = joinPath(cacheDir, b.ProjectUniqueDir(false))
 }
 
 func (b *Build) executeStage(buildStage BuildStage, executor Executor, abort chan interface{}) error {
@@ -162,11 +191,21 @@ func (b *Build) executeStage(buildStage BuildStage, executor Executor, abort cha
 	switch buildStage {
 	case BuildStageUserScript, BuildStageAfterScript: // use custom build environment
 		cmd.Predefined = false
-	default: // all other stages use a predefined build environment
-		cmd.Predefined = true
+	default: // all other stages, but the steps, use a predefined build environment
+		cmd.Predefined = b.GetStep(buildStage) == nil
+	}
+
+	if header, ok := collapsedStages[buildStage]; ok {
+		b.startSection(buildStage, header)
+		defer b.endSection(buildStage)
 	}
 
-	return executor.Run(cmd)
+	span := b.Span.StartChild(string(buildStage))
+	started := time.Now()
+	err = executor.Run(cmd)
+	BuildMetrics.observeStage(b, buildStage, time.Since(started), err)
+	span.End(err)
+	return err
 }
 
 func (b *Build) executeUploadArtifacts(state error, executor Executor, abort chan interface{}) (err error) {
@@ -206,8 +245,13 @@ func (b *Build) executeScript(executor Executor, abort chan interface{}) error {
 	}
 
 	if err == nil {
-		// Execute user build script (before_script + script)
-		err = b.executeStage(BuildStageUserScript, executor, abort)
+		if len(b.Steps) > 0 {
+			// Execute the steps of the build
+			err = b.executeSteps(executor, abort)
+		} else {
+			// Execute user build script (before_script + script)
+			err = b.executeStage(BuildStageUserScript, executor, abort)
+		}
 
 		// Execute after script (after_script)
 		timeoutCh := make(chan interface{}, 1)
@@ -251,6 +295,15 @@ func (b *Build) run(executor Executor) (err error) {
 
 	// Run build script
 	go func() {
+		// A panic of the executor fails the job as a system failure, the
+		// other jobs of the runner keep running
+		defer func() {
+			if r := recover(); r != nil {
+				b.Log().WithField("stack", string(debug.Stack())).Errorln("Job panicked:", r)
+				buildFinish <- &SystemError{Inner: fmt.Errorf("panic: %v", r)}
+			}
+		}()
+
 		buildFinish <- b.executeScript(executor, buildAbort)
 	}()
 
@@ -261,6 +314,10 @@ func (b *Build) run(executor Executor) (err error) {
 		err = &BuildError{Inner: errors.New("canceled")}
 		b.CurrentState = BuildRunRuntimeCanceled
 
+	case <-b.getCanceled():
+		err = &BuildError{Inner: errors.New("canceled on the runner")}
+		b.CurrentState = BuildRunRuntimeCanceled
+
 	case <-time.After(time.Duration(buildTimeout) * time.Second):
 		err = &BuildError{Inner: fmt.Errorf("execution took longer than %v seconds", buildTimeout)}
 		b.CurrentState = BuildRunRuntimeTimedout
@@ -320,9 +377,10 @@ func (b *Build) Run(globalConfig *Config, trace BuildTrace) (err error) {
 	logger.Println(fmt.Sprintf("Running with %s\n  on %s (%s)", AppVersion.Line(), b.Runner.Name, b.Runner.ShortDescription()))
 
 	b.CurrentState = BuildRunStatePending
+	b.StartedAt = time.Now()
 
 	defer func() {
-		if _, ok := err.(*BuildError); ok {
+		if err != nil && GetFailureReason(err) == ScriptFailure {
 			logger.SoftErrorln("Job failed:", err)
 			trace.Fail(err)
 		} else if err != nil {
@@ -339,13 +397,25 @@ func (b *Build) Run(globalConfig *Config, trace BuildTrace) (err error) {
 
 	b.Trace = trace
 
+	if b.IsDebugTraceEnabled() {
+		// the traced commands print the values of the variables
+		maskedTrace := newMaskedTrace(trace, b.getSecrets())
+		defer maskedTrace.Close()
+		b.Trace = maskedTrace
+	} else if b.isDebugTraceRequested() {
+		logger.Warningln("CI_DEBUG_TRACE is disabled on this runner")
+	}
+
 	provider := GetExecutor(b.Runner.Executor)
 	if provider == nil {
 		return errors.New("executor not found")
 	}
 
+	prepareSpan := b.Span.StartChild("prepare")
 	executor, err = b.retryCreateExecutor(globalConfig, provider, logger)
+	prepareSpan.End(err)
 	if err == nil {
+		BuildMetrics.observeQueue(b)
 		err = b.run(executor)
 	}
 	if executor != nil {
@@ -354,31 +424,60 @@ func (b *Build) Run(globalConfig *Config, trace BuildTrace) (err error) {
 	return err
 }
 
+func (b *Build) getCanceled() chan interface{} {
+	b.cancelLock.Lock()
+	defer b.cancelLock.Unlock()
+
+	if b.canceled == nil {
+		b.canceled = make(chan interface{})
+	}
+	return b.canceled
+}
+
+// Cancel stops the build on the runner, like when it's canceled in GitLab.
+// It returns false if the build was already canceled.
+func (b *Build) Cancel() bool {
+	canceled := b.getCanceled()
+
+	b.cancelLock.Lock()
+	defer b.cancelLock.Unlock()
+
+	select {
+	case <-canceled:
+		return false
+	default:
+		close(canceled)
+		return true
+	}
+}
+
 func (b *Build) String() string {
 	return helpers.ToYAML(b)
 }
 
 func (b *Build) GetDefaultVariables() BuildVariables {
 	return BuildVariables{
-		{"CI", "true", true, true, false},
-		{"CI_DEBUG_TRACE", "false", true, true, false},
-		{"CI_BUILD_REF", b.Sha, true, true, false},
-		{"CI_BUILD_BEFORE_SHA", b.BeforeSha, true, true, false},
-		{"CI_BUILD_REF_NAME", b.RefName, true, true, false},
-		{"CI_BUILD_ID", strconv.Itoa(b.ID), true, true, false},
-		{"CI_BUILD_REPO", b.RepoURL, true, true, false},
-		{"CI_BUILD_TOKEN", b.Token, true, true, false},
-		{"CI_PROJECT_ID", strconv.Itoa(b.ProjectID), true, true, false},
-		{"CI_PROJECT_DIR", b.FullProjectDir(), true, true, false},
-		{"CI_SERVER", "yes", true, true, false},
-		{"CI_SERVER_NAME", "GitLab CI", true, true, false},
-		{"CI_SERVER_VERSION", "", true, true, false},
-		{"CI_SERVER_REVISION", "", true, true, false},
-		{"GITLAB_CI", "true", true, true, false},
+		{"CI", "true", true, true, false, false},
+		{"CI_DEBUG_TRACE", "false", true, true, false, false},
+		{"CI_BUILD_REF", b.Sha, true, true, false, false},
+		{"CI_BUILD_BEFORE_SHA", b.BeforeSha, true, true, false, false},
+		{"CI_BUILD_REF_NAME", b.RefName, true, true, false, false},
+		{"CI_BUILD_ID", strconv.Itoa(b.ID), true, true, false, false},
+		{"CI_BUILD_REPO", b.RepoURL, true, true, false, false},
+		{"CI_BUILD_TOKEN", b.Token, true, true, false, false},
+		{"CI_PROJECT_ID", strconv.Itoa(b.ProjectID), true, true, false, false},
+		{"CI_PROJECT_DIR", b.FullProjectDir(), true, true, false, false},
+		{"CI_SERVER", "yes", true, true, false, false},
+		{"CI_SERVER_NAME", "GitLab CI", true, true, false, false},
+		{"CI_SERVER_VERSION", "", true, true, false, false},
+		{"CI_SERVER_REVISION", "", true, true, false, false},
+		{"GITLAB_CI", "true", true, true, false, false},
 	}
 }
 
 func (b *Build) GetAllVariables() (variables BuildVariables) {
+	// the proxy variables can be overwritten by the environment of the runner
+	variables = append(variables, b.GetProxyVariables()...)
 	if b.Runner != nil {
 		variables = append(variables, b.Runner.GetVariables()...)
 	}
@@ -407,6 +506,22 @@ func (b *Build) GetRemoteURL() string {
 	return fmt.Sprintf("%sgitlab-ci-token:%s@%s/%s", splits[0], ciJobToken, splits[1], projectPath)
 }
 
+// GetGitReference returns the local repository the clone of the project
+// borrows its objects from: the one of the project in git_references, or
+// git_reference with the variables of the build expanded
+func (b *Build) GetGitReference() string {
+	if slug, err := b.ProjectSlug(); err == nil {
+		if reference := b.Runner.GitReferences[strings.TrimPrefix(slug, "/")]; reference != "" {
+			return reference
+		}
+	}
+
+	if b.Runner.GitReference == "" {
+		return ""
+	}
+	return b.GetAllVariables().ExpandValue(b.Runner.GitReference)
+}
+
 func (b *Build) GetGitDepth() string {
 	return b.GetAllVariables().Get("GIT_DEPTH")
 }
@@ -452,7 +567,7 @@ func (b *Build) GetSubmoduleStrategy() SubmoduleStrategy {
 	}
 }
 
-func (b *Build) IsDebugTraceEnabled() bool {
+func (b *Build) isDebugTraceRequested() bool {
 	trace, err := strconv.ParseBool(b.GetAllVariables().Get("CI_DEBUG_TRACE"))
 	if err != nil {
 		return false
@@ -461,6 +576,25 @@ func (b *Build) IsDebugTraceEnabled() bool {
 	return trace
 }
 
+// IsDebugTraceEnabled checks if the scripts are traced, which is requested by
+// the CI_DEBUG_TRACE variable, unless debug_trace_disabled is set
+func (b *Build) IsDebugTraceEnabled() bool {
+	if b.Runner != nil && b.Runner.DebugTraceDisabled {
+		return false
+	}
+	return b.isDebugTraceRequested()
+}
+
+// getSecrets returns the values masked in the debug traces
+func (b *Build) getSecrets() (secrets []string) {
+	for _, variable := range b.GetAllVariables() {
+		if variable.Masked {
+			secrets = append(secrets, variable.Value)
+		}
+	}
+	return append(secrets, b.Token)
+}
+
 func (b *Build) GetDockerAuthConfig() string {
 	return b.GetAllVariables().Get("DOCKER_AUTH_CONFIG")
 }
@@ -0,0 +1,58 @@
+package common
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type buildMetrics struct {
+	stageDuration *prometheus.HistogramVec
+	queueDuration *prometheus.HistogramVec
+}
+
+// BuildMetrics are the durations of the stages of the builds and of their
+// wait before their scripts start, registered by the metrics server
+var BuildMetrics = &buildMetrics{
+	stageDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "ci_runner_build_stage_duration_seconds",
+		Help:    "The duration of the stages of the builds.",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 14),
+	}, []string{"stage", "executor", "result"}),
+	queueDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "ci_runner_job_queue_duration_seconds",
+		Help:    "The time the jobs waited on the runner, from their receipt to the start of their scripts.",
+		Buckets: prometheus.ExponentialBuckets(0.5, 2, 12),
+	}, []string{"executor"}),
+}
+
+// Describe implements prometheus.Collector.
+func (m *buildMetrics) Describe(ch chan<- *prometheus.Desc) {
+	m.stageDuration.Describe(ch)
+	m.queueDuration.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (m *buildMetrics) Collect(ch chan<- prometheus.Metric) {
+	m.stageDuration.Collect(ch)
+	m.queueDuration.Collect(ch)
+}
+
+// observeStage records the duration of the stage. The stages of the steps,
+// named after the steps of the jobs, are recorded as the step stage.
+func (m *buildMetrics) observeStage(b *Build, stage BuildStage, duration time.Duration, err error) {
+	name := string(stage)
+	if b.GetStep(stage) != nil {
+		name = BuildStageStepPrefix + "*"
+	}
+
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	m.stageDuration.WithLabelValues(name, b.Runner.Executor, result).Observe(duration.Seconds())
+}
+
+func (m *buildMetrics) observeQueue(b *Build) {
+	m.queueDuration.WithLabelValues(b.Runner.Executor).Observe(time.Since(b.StartedAt).Seconds())
+}
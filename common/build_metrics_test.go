@@ -0,0 +1,29 @@
+package common
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildMetricsObserveStage(t *testing.T) {
+	metrics := &buildMetrics{
+		stageDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "stage"}, []string{"stage", "executor", "result"}),
+		queueDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "queue"}, []string{"executor"}),
+	}
+	build := &Build{
+		GetBuildResponse: GetBuildResponse{Steps: []Step{{Name: "test"}}},
+		Runner:           &RunnerConfig{RunnerSettings: RunnerSettings{Executor: "shell"}},
+	}
+
+	metrics.observeStage(build, BuildStagePrepare, time.Second, nil)
+	metrics.observeStage(build, StepStage("test"), time.Second, errors.New("failed"))
+	metrics.observeStage(build, StepStage("test"), time.Second, errors.New("failed"))
+
+	ch := make(chan prometheus.Metric, 10)
+	metrics.Collect(ch)
+	assert.Len(t, ch, 2, "the stages of the steps share the step_* label")
+}
@@ -73,6 +73,18 @@ func convertMapToStringMap(in interface{}) (out interface{}, err error) {
 		return mapString, nil
 	}
 
+	// the maps in the lists, like the services given as maps
+	list, ok := in.([]interface{})
+	if ok {
+		for i, v := range list {
+			list[i], err = convertMapToStringMap(v)
+			if err != nil {
+				return
+			}
+		}
+		return list, nil
+	}
+
 	return in, nil
 }
 
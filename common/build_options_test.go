@@ -111,3 +111,16 @@ func TestBuildOptionsSanitizeWithYamlDecode(t *testing.T) {
 		},
 	}, options)
 }
+
+func TestBuildOptionsSanitizeMapsInLists(t *testing.T) {
+	options := make(BuildOptions)
+
+	require.NoError(t, yaml.Unmarshal([]byte("services:\n- name: postgres\n  alias: db\n- redis\n"), options))
+	require.NoError(t, options.Sanitize())
+	assert.Equal(t, BuildOptions{
+		"services": []interface{}{
+			map[string]interface{}{"name": "postgres", "alias": "db"},
+			"redis",
+		},
+	}, options)
+}
@@ -1,6 +1,7 @@
 package common
 
 import (
+	"bytes"
 	"os"
 	"testing"
 
@@ -419,3 +420,69 @@ func TestGetRemoteURL(t *testing.T) {
 		assert.Equal(t, tc.result, build.GetRemoteURL())
 	}
 }
+
+func TestStartBuildWithUNCPaths(t *testing.T) {
+	build := &Build{
+		GetBuildResponse: GetBuildResponse{RepoURL: "https://gitlab.com/group/project.git"},
+		Runner:           &RunnerConfig{},
+	}
+
+	build.StartBuild("//server/share/builds", "//server/share/cache", false)
+	assert.Equal(t, "//server/share/builds/group/project", build.BuildDir)
+	assert.Equal(t, "//server/share/cache/group/project", build.CacheDir)
+
+	build.StartBuild(`\\server\share\builds`, `\\server\share\cache`, false)
+	assert.Equal(t, `\\server\share\builds/group/project`, build.BuildDir)
+	assert.Equal(t, `\\server\share\cache/group/project`, build.CacheDir)
+}
+
+func TestIsDebugTraceEnabled(t *testing.T) {
+	build := &Build{
+		GetBuildResponse: GetBuildResponse{
+			Variables: BuildVariables{{Key: "CI_DEBUG_TRACE", Value: "true"}},
+		},
+		Runner: &RunnerConfig{},
+	}
+	assert.True(t, build.IsDebugTraceEnabled())
+
+	build.Runner.DebugTraceDisabled = true
+	assert.False(t, build.IsDebugTraceEnabled())
+}
+
+func TestGetSecrets(t *testing.T) {
+	build := &Build{
+		GetBuildResponse: GetBuildResponse{
+			Token: "build-token",
+			Variables: BuildVariables{
+				{Key: "PASSWORD", Value: "secret-password", Masked: true},
+				{Key: "USER", Value: "user"},
+			},
+		},
+		Runner: &RunnerConfig{},
+	}
+	assert.Equal(t, []string{"secret-password", "build-token"}, build.getSecrets())
+}
+
+func TestCollapsedSections(t *testing.T) {
+	e := MockExecutor{}
+	defer e.AssertExpectations(t)
+
+	e.On("Shell").Return(&ShellScriptInfo{Shell: "script-shell"})
+	e.On("Run", mock.Anything).Return(nil).Twice()
+
+	buffer := &bytes.Buffer{}
+	build := &Build{
+		Runner: &RunnerConfig{},
+		Trace:  &Trace{Writer: buffer},
+	}
+
+	err := build.executeStage(BuildStageRestoreCache, &e, nil)
+	assert.NoError(t, err)
+	assert.Regexp(t, "^section_start:[0-9]+:restore_cache\\[collapsed=true\\]\r\033\\[0K.*Restoring the cache.*\n"+
+		"section_end:[0-9]+:restore_cache\r\033\\[0K\n$", buffer.String())
+
+	buffer.Reset()
+	err = build.executeStage(BuildStageUserScript, &e, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, buffer.String())
+}
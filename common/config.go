@@ -10,13 +10,19 @@ import (
 
 	"fmt"
 	"path/filepath"
+	"reflect"
+	"strings"
 
 	"github.com/BurntSushi/toml"
 	log "github.com/Sirupsen/logrus"
+	"github.com/ghodss/yaml"
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/autoscaler"
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/docker"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/patch"
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/ssh"
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/timeperiod"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/tracing"
 )
 
 type DockerPullPolicy string
@@ -64,6 +70,7 @@ type DockerConfig struct {
 	ExtraHosts             []string         `toml:"extra_hosts,omitempty" json:"extra_hosts" long:"extra-hosts" env:"DOCKER_EXTRA_HOSTS" description:"Add a custom host-to-IP mapping"`
 	VolumesFrom            []string         `toml:"volumes_from,omitempty" json:"volumes_from" long:"volumes-from" env:"DOCKER_VOLUMES_FROM" description:"A list of volumes to inherit from another container"`
 	NetworkMode            string           `toml:"network_mode,omitempty" json:"network_mode" long:"network-mode" env:"DOCKER_NETWORK_MODE" description:"Add container to a custom network"`
+	Networks               []string         `toml:"networks,omitempty" json:"networks" long:"networks" env:"DOCKER_NETWORKS" description:"A list of existing networks to which build and service containers are additionally attached"`
 	Links                  []string         `toml:"links,omitempty" json:"links" long:"links" env:"DOCKER_LINKS" description:"Add link to another container"`
 	Services               []string         `toml:"services,omitempty" json:"services" long:"services" env:"DOCKER_SERVICES" description:"Add service that is started with container"`
 	WaitForServicesTimeout int              `toml:"wait_for_services_timeout,omitzero" json:"wait_for_services_timeout" long:"wait-for-services-timeout" env:"DOCKER_WAIT_FOR_SERVICES_TIMEOUT" description:"How long to wait for service startup"`
@@ -85,19 +92,106 @@ type DockerMachine struct {
 	OffPeakIdleCount int      `long:"off-peak-idle-count" env:"MACHINE_OFF_PEAK_IDLE_COUNT" description:"Maximum idle machines when the scheduler is in the OffPeak mode"`
 	OffPeakIdleTime  int      `long:"off-peak-idle-time" env:"MACHINE_OFF_PEAK_IDLE_TIME" description:"Minimum time after machine can be destroyed when the scheduler is in the OffPeak mode"`
 
+	Autoscaler *autoscaler.Config `toml:"autoscaler,omitempty" json:"autoscaler" group:"autoscaler provider" namespace:"autoscaler"`
+
 	offPeakTimePeriods *timeperiod.TimePeriod
 }
 
+type PodmanConfig struct {
+	Host            string           `toml:"host,omitempty" json:"host" long:"host" env:"PODMAN_HOST" description:"URL of the Podman API socket (defaults to the rootless socket of the user running the runner, or /run/podman/podman.sock for root)"`
+	Image           string           `toml:"image" json:"image" long:"image" env:"PODMAN_IMAGE" description:"Image to be used"`
+	HelperImage     string           `toml:"helper_image,omitempty" json:"helper_image" long:"helper-image" env:"PODMAN_HELPER_IMAGE" description:"[ADVANCED] Override the default helper image used to clone repos and upload artifacts"`
+	Privileged      bool             `toml:"privileged,omitzero" json:"privileged" long:"privileged" env:"PODMAN_PRIVILEGED" description:"Give extended privileges to container"`
+	CapAdd          []string         `toml:"cap_add,omitempty" json:"cap_add" long:"cap-add" env:"PODMAN_CAP_ADD" description:"Add Linux capabilities"`
+	CapDrop         []string         `toml:"cap_drop,omitempty" json:"cap_drop" long:"cap-drop" env:"PODMAN_CAP_DROP" description:"Drop Linux capabilities"`
+	DisableCache    bool             `toml:"disable_cache,omitzero" json:"disable_cache" long:"disable-cache" env:"PODMAN_DISABLE_CACHE" description:"Remove the volumes of the job when it finishes"`
+	Volumes         []string         `toml:"volumes,omitempty" json:"volumes" long:"volumes" env:"PODMAN_VOLUMES" description:"Bind mount a volumes"`
+	Services        []string         `toml:"services,omitempty" json:"services" long:"services" env:"PODMAN_SERVICES" description:"Add service that is started in the pod of the job"`
+	AllowedImages   []string         `toml:"allowed_images,omitempty" json:"allowed_images" long:"allowed-images" env:"PODMAN_ALLOWED_IMAGES" description:"Whitelist allowed images"`
+	AllowedServices []string         `toml:"allowed_services,omitempty" json:"allowed_services" long:"allowed-services" env:"PODMAN_ALLOWED_SERVICES" description:"Whitelist allowed services"`
+	PullPolicy      DockerPullPolicy `toml:"pull_policy,omitempty" json:"pull_policy" long:"pull-policy" env:"PODMAN_PULL_POLICY" description:"Image pull policy: never, if-not-present, always"`
+}
+
+type ShellExecutorConfig struct {
+	CleanEnvironment   bool     `toml:"clean_environment,omitzero" json:"clean_environment" long:"clean-environment" env:"SHELL_EXECUTOR_CLEAN_ENVIRONMENT" description:"Start the builds with only the CI variables and the allowed variables of the Runner environment"`
+	AllowedEnvironment []string `toml:"allowed_environment,omitempty" json:"allowed_environment" long:"allowed-environment" env:"SHELL_EXECUTOR_ALLOWED_ENVIRONMENT" description:"Variables of the Runner environment passed to the builds with clean_environment, in addition to the system ones; a name ending with * matches a prefix"`
+}
+
+type CustomConfig struct {
+	PrepareExec        string   `toml:"prepare_exec,omitempty" json:"prepare_exec" long:"prepare-exec" env:"CUSTOM_PREPARE_EXEC" description:"Executable that prepares the environment of the job"`
+	PrepareArgs        []string `toml:"prepare_args,omitempty" json:"prepare_args" long:"prepare-args" description:"Arguments of the prepare executable"`
+	PrepareExecTimeout int      `toml:"prepare_exec_timeout,omitzero" json:"prepare_exec_timeout" long:"prepare-exec-timeout" env:"CUSTOM_PREPARE_EXEC_TIMEOUT" description:"How long, in seconds, the prepare executable can run (default 3600)"`
+	RunExec            string   `toml:"run_exec" json:"run_exec" long:"run-exec" env:"CUSTOM_RUN_EXEC" description:"Executable that runs the scripts of the job in the prepared environment"`
+	RunArgs            []string `toml:"run_args,omitempty" json:"run_args" long:"run-args" description:"Arguments of the run executable, the path of the script and the name of the stage are appended"`
+	Base64Scripts      bool     `toml:"base64_scripts,omitzero" json:"base64_scripts" long:"base64-scripts" env:"CUSTOM_BASE64_SCRIPTS" description:"Write the scripts given to the run executable encoded with base64"`
+	CleanupExec        string   `toml:"cleanup_exec,omitempty" json:"cleanup_exec" long:"cleanup-exec" env:"CUSTOM_CLEANUP_EXEC" description:"Executable that removes the environment of the job"`
+	CleanupArgs        []string `toml:"cleanup_args,omitempty" json:"cleanup_args" long:"cleanup-args" description:"Arguments of the cleanup executable"`
+	CleanupExecTimeout int      `toml:"cleanup_exec_timeout,omitzero" json:"cleanup_exec_timeout" long:"cleanup-exec-timeout" env:"CUSTOM_CLEANUP_EXEC_TIMEOUT" description:"How long, in seconds, the cleanup executable can run (default 3600)"`
+}
+
 type ParallelsConfig struct {
-	BaseName         string `toml:"base_name" json:"base_name" long:"base-name" env:"PARALLELS_BASE_NAME" description:"VM name to be used"`
-	TemplateName     string `toml:"template_name,omitempty" json:"template_name" long:"template-name" env:"PARALLELS_TEMPLATE_NAME" description:"VM template to be created"`
-	DisableSnapshots bool   `toml:"disable_snapshots,omitzero" json:"disable_snapshots" long:"disable-snapshots" env:"PARALLELS_DISABLE_SNAPSHOTS" description:"Disable snapshoting to speedup VM creation"`
+	BaseName            string `toml:"base_name" json:"base_name" long:"base-name" env:"PARALLELS_BASE_NAME" description:"VM name to be used"`
+	TemplateName        string `toml:"template_name,omitempty" json:"template_name" long:"template-name" env:"PARALLELS_TEMPLATE_NAME" description:"VM template to be created"`
+	DisableSnapshots    bool   `toml:"disable_snapshots,omitzero" json:"disable_snapshots" long:"disable-snapshots" env:"PARALLELS_DISABLE_SNAPSHOTS" description:"Disable snapshoting to speedup VM creation"`
+	PoolSize            int    `toml:"pool_size,omitzero" json:"pool_size" long:"pool-size" env:"PARALLELS_POOL_SIZE" description:"Number of VMs kept booted and assigned to the builds, 0 to create the VMs for the builds"`
+	PoolMaxBuilds       int    `toml:"pool_max_builds,omitzero" json:"pool_max_builds" long:"pool-max-builds" env:"PARALLELS_POOL_MAX_BUILDS" description:"Rebuild the VMs of the pool after this number of builds, 0 to only revert them to the snapshot"`
+	PoolTTL             int    `toml:"pool_ttl,omitzero" json:"pool_ttl" long:"pool-ttl" env:"PARALLELS_POOL_TTL" description:"Rebuild the VMs of the pool older than this number of seconds, 0 to keep them"`
+	PoolProvisionScript string `toml:"pool_provision_script,omitempty" json:"pool_provision_script" long:"pool-provision-script" env:"PARALLELS_POOL_PROVISION_SCRIPT" description:"Script run with bash in the VMs of the pool, as root, after they're created or reverted to the snapshot"`
 }
 
 type VirtualBoxConfig struct {
-	BaseName         string `toml:"base_name" json:"base_name" long:"base-name" env:"VIRTUALBOX_BASE_NAME" description:"VM name to be used"`
-	BaseSnapshot     string `toml:"base_snapshot,omitempty" json:"base_snapshot" long:"base-snapshot" env:"VIRTUALBOX_BASE_SNAPSHOT" description:"Name or UUID of a specific VM snapshot to clone"`
-	DisableSnapshots bool   `toml:"disable_snapshots,omitzero" json:"disable_snapshots" long:"disable-snapshots" env:"VIRTUALBOX_DISABLE_SNAPSHOTS" description:"Disable snapshoting to speedup VM creation"`
+	BaseName            string `toml:"base_name" json:"base_name" long:"base-name" env:"VIRTUALBOX_BASE_NAME" description:"VM name to be used"`
+	BaseSnapshot        string `toml:"base_snapshot,omitempty" json:"base_snapshot" long:"base-snapshot" env:"VIRTUALBOX_BASE_SNAPSHOT" description:"Name or UUID of a specific VM snapshot to clone"`
+	DisableSnapshots    bool   `toml:"disable_snapshots,omitzero" json:"disable_snapshots" long:"disable-snapshots" env:"VIRTUALBOX_DISABLE_SNAPSHOTS" description:"Disable snapshoting to speedup VM creation"`
+	PoolSize            int    `toml:"pool_size,omitzero" json:"pool_size" long:"pool-size" env:"VIRTUALBOX_POOL_SIZE" description:"Number of VMs kept booted and assigned to the builds, 0 to create the VMs for the builds"`
+	PoolMaxBuilds       int    `toml:"pool_max_builds,omitzero" json:"pool_max_builds" long:"pool-max-builds" env:"VIRTUALBOX_POOL_MAX_BUILDS" description:"Rebuild the VMs of the pool after this number of builds, 0 to only revert them to the snapshot"`
+	PoolTTL             int    `toml:"pool_ttl,omitzero" json:"pool_ttl" long:"pool-ttl" env:"VIRTUALBOX_POOL_TTL" description:"Rebuild the VMs of the pool older than this number of seconds, 0 to keep them"`
+	PoolProvisionScript string `toml:"pool_provision_script,omitempty" json:"pool_provision_script" long:"pool-provision-script" env:"VIRTUALBOX_POOL_PROVISION_SCRIPT" description:"Script run with bash over SSH in the VMs of the pool, after they're created or reverted to the snapshot"`
+}
+
+type LXDConfig struct {
+	Image        string   `toml:"image" json:"image" long:"image" env:"LXD_IMAGE" description:"Image the containers are launched from, like ubuntu:16.04"`
+	Profiles     []string `toml:"profiles,omitempty" json:"profiles" long:"profiles" env:"LXD_PROFILES" description:"Profiles applied to the containers, in order"`
+	CPULimit     string   `toml:"cpu_limit,omitempty" json:"cpu_limit" long:"cpu-limit" env:"LXD_CPU_LIMIT" description:"Number of CPUs, or a range of them, available to the containers (limits.cpu)"`
+	MemoryLimit  string   `toml:"memory_limit,omitempty" json:"memory_limit" long:"memory-limit" env:"LXD_MEMORY_LIMIT" description:"Memory available to the containers, like 2GB (limits.memory)"`
+	HelperBinary string   `toml:"helper_binary,omitempty" json:"helper_binary" long:"helper-binary" env:"LXD_HELPER_BINARY" description:"[ADVANCED] Path of the gitlab-runner binary pushed to the containers, by default the binary of the running Runner"`
+}
+
+type FargateConfig struct {
+	Region                 string   `toml:"region,omitempty" json:"region" long:"region" env:"FARGATE_REGION" description:"AWS region of the cluster, by default the region of the AWS CLI configuration"`
+	Cluster                string   `toml:"cluster" json:"cluster" long:"cluster" env:"FARGATE_CLUSTER" description:"ECS cluster running the tasks"`
+	TaskDefinition         string   `toml:"task_definition,omitempty" json:"task_definition" long:"task-definition" env:"FARGATE_TASK_DEFINITION" description:"Family, with an optional revision, of the task definition used for the jobs"`
+	TaskDefinitionTemplate string   `toml:"task_definition_template,omitempty" json:"task_definition_template" long:"task-definition-template" env:"FARGATE_TASK_DEFINITION_TEMPLATE" description:"Path of a JSON task definition registered for every job, with the image of the job in its build container, instead of task_definition"`
+	ContainerName          string   `toml:"container_name,omitempty" json:"container_name" long:"container-name" env:"FARGATE_CONTAINER_NAME" description:"Container of the task running the SSH server (default: build)"`
+	PlatformVersion        string   `toml:"platform_version,omitempty" json:"platform_version" long:"platform-version" env:"FARGATE_PLATFORM_VERSION" description:"Fargate platform version of the tasks (default: LATEST)"`
+	Subnets                []string `toml:"subnets" json:"subnets" long:"subnets" env:"FARGATE_SUBNETS" description:"Subnets the tasks are started in"`
+	SecurityGroups         []string `toml:"security_groups,omitempty" json:"security_groups" long:"security-groups" env:"FARGATE_SECURITY_GROUPS" description:"Security groups of the tasks"`
+	AssignPublicIP         bool     `toml:"assign_public_ip,omitzero" json:"assign_public_ip" long:"assign-public-ip" env:"FARGATE_ASSIGN_PUBLIC_IP" description:"Assign a public IP to the tasks, needed to pull images in public subnets"`
+	UseSSM                 bool     `toml:"use_ssm,omitzero" json:"use_ssm" long:"use-ssm" env:"FARGATE_USE_SSM" description:"Connect to the SSH server of the task through an SSM port forwarding session, instead of its private IP"`
+	StartupTimeout         int      `toml:"startup_timeout,omitzero" json:"startup_timeout" long:"startup-timeout" env:"FARGATE_STARTUP_TIMEOUT" description:"How long, in seconds, to wait for the task to run (default: 600)"`
+}
+
+type GCPBatchConfig struct {
+	Project                     string   `toml:"project" json:"project" long:"project" env:"GCP_BATCH_PROJECT" description:"Google Cloud project running the jobs"`
+	Location                    string   `toml:"location" json:"location" long:"location" env:"GCP_BATCH_LOCATION" description:"Region of the Batch jobs, like us-central1"`
+	Bucket                      string   `toml:"bucket" json:"bucket" long:"bucket" env:"GCP_BATCH_BUCKET" description:"Cloud Storage bucket, with an optional path, storing the builds, the cache and the scripts of the jobs"`
+	Image                       string   `toml:"image" json:"image" long:"image" env:"GCP_BATCH_IMAGE" description:"Default image of the builds"`
+	AllowedImages               []string `toml:"allowed_images,omitempty" json:"allowed_images" long:"allowed-images" env:"GCP_BATCH_ALLOWED_IMAGES" description:"Whitelist allowed images"`
+	HelperImage                 string   `toml:"helper_image,omitempty" json:"helper_image" long:"helper-image" env:"GCP_BATCH_HELPER_IMAGE" description:"[ADVANCED] Override the default helper image used to clone repos and upload artifacts"`
+	MachineType                 string   `toml:"machine_type,omitempty" json:"machine_type" long:"machine-type" env:"GCP_BATCH_MACHINE_TYPE" description:"Machine type of the VMs running the jobs, like e2-standard-4"`
+	MachineTypeOverwriteAllowed string   `toml:"machine_type_overwrite_allowed,omitempty" json:"machine_type_overwrite_allowed" long:"machine-type-overwrite-allowed" env:"GCP_BATCH_MACHINE_TYPE_OVERWRITE_ALLOWED" description:"Regex to validate 'GCP_BATCH_MACHINE_TYPE_OVERWRITE' value"`
+	Spot                        bool     `toml:"spot,omitzero" json:"spot" long:"spot" env:"GCP_BATCH_SPOT" description:"Run the jobs on Spot VMs"`
+	ServiceAccount              string   `toml:"service_account,omitempty" json:"service_account" long:"service-account" env:"GCP_BATCH_SERVICE_ACCOUNT" description:"Email of the service account of the VMs running the jobs"`
+	Network                     string   `toml:"network,omitempty" json:"network" long:"network" env:"GCP_BATCH_NETWORK" description:"VPC network of the VMs, like projects/my-project/global/networks/default"`
+	Subnetwork                  string   `toml:"subnetwork,omitempty" json:"subnetwork" long:"subnetwork" env:"GCP_BATCH_SUBNETWORK" description:"Subnetwork of the VMs, like projects/my-project/regions/us-central1/subnetworks/default"`
+	NoExternalIP                bool     `toml:"no_external_ip,omitzero" json:"no_external_ip" long:"no-external-ip" env:"GCP_BATCH_NO_EXTERNAL_IP" description:"Don't assign external IPs to the VMs"`
+}
+
+type WSLConfig struct {
+	Image        string `toml:"image" json:"image" long:"image" env:"WSL_IMAGE" description:"Path of the root filesystem tarball imported as the distribution of every job"`
+	InstallDir   string `toml:"install_dir,omitempty" json:"install_dir" long:"install-dir" env:"WSL_INSTALL_DIR" description:"Directory storing the disks of the distributions (default: the temporary directory)"`
+	User         string `toml:"user,omitempty" json:"user" long:"user" env:"WSL_USER" description:"User running the builds in the distributions (default: root)"`
+	HelperBinary string `toml:"helper_binary,omitempty" json:"helper_binary" long:"helper-binary" env:"WSL_HELPER_BINARY" description:"Windows path of the Linux gitlab-runner binary used in the distributions, by default gitlab-runner must be installed in the image"`
 }
 
 type KubernetesPullPolicy string
@@ -117,46 +211,346 @@ func (p KubernetesPullPolicy) Get() (KubernetesPullPolicy, error) {
 	return "", fmt.Errorf("unsupported kubernetes-pull-policy: %v", p)
 }
 
+type KubernetesExecutionStrategy string
+
+const (
+	ExecutionStrategyAttach KubernetesExecutionStrategy = "attach"
+	ExecutionStrategyExec   KubernetesExecutionStrategy = "exec"
+)
+
+// Get returns one of the predefined values or returns an error if the value can't match the predefined
+func (s KubernetesExecutionStrategy) Get() (KubernetesExecutionStrategy, error) {
+	switch s {
+	case "", ExecutionStrategyAttach:
+		return ExecutionStrategyAttach, nil
+	case ExecutionStrategyExec:
+		return ExecutionStrategyExec, nil
+	}
+	return "", fmt.Errorf("unsupported kubernetes-execution-strategy: %v", s)
+}
+
+type KubernetesDNSPolicy string
+
+const (
+	DNSPolicyNone                    KubernetesDNSPolicy = "none"
+	DNSPolicyDefault                 KubernetesDNSPolicy = "default"
+	DNSPolicyClusterFirst            KubernetesDNSPolicy = "cluster-first"
+	DNSPolicyClusterFirstWithHostNet KubernetesDNSPolicy = "cluster-first-with-host-net"
+)
+
+// Get returns one of the predefined values in kubernetes notation or returns an error if the value can't match the predefined
+func (p KubernetesDNSPolicy) Get() (string, error) {
+	switch p {
+	case "":
+		return "", nil
+	case DNSPolicyNone:
+		return "None", nil
+	case DNSPolicyDefault:
+		return "Default", nil
+	case DNSPolicyClusterFirst:
+		return "ClusterFirst", nil
+	case DNSPolicyClusterFirstWithHostNet:
+		return "ClusterFirstWithHostNet", nil
+	}
+	return "", fmt.Errorf("unsupported kubernetes-dns-policy: %v", p)
+}
+
 type KubernetesConfig struct {
-	Host                          string               `toml:"host" json:"host" long:"host" env:"KUBERNETES_HOST" description:"Optional Kubernetes master host URL (auto-discovery attempted if not specified)"`
-	CertFile                      string               `toml:"cert_file,omitempty" json:"cert_file" long:"cert-file" env:"KUBERNETES_CERT_FILE" description:"Optional Kubernetes master auth certificate"`
-	KeyFile                       string               `toml:"key_file,omitempty" json:"key_file" long:"key-file" env:"KUBERNETES_KEY_FILE" description:"Optional Kubernetes master auth private key"`
-	CAFile                        string               `toml:"ca_file,omitempty" json:"ca_file" long:"ca-file" env:"KUBERNETES_CA_FILE" description:"Optional Kubernetes master auth ca certificate"`
-	Image                         string               `toml:"image" json:"image" long:"image" env:"KUBERNETES_IMAGE" description:"Default docker image to use for builds when none is specified"`
-	Namespace                     string               `toml:"namespace" json:"namespace" long:"namespace" env:"KUBERNETES_NAMESPACE" description:"Namespace to run Kubernetes jobs in"`
-	NamespaceOverwriteAllowed     string               `toml:"namespace_overwrite_allowed" json:"namespace_overwrite_allowed" long:"namespace_overwrite_allowed" env:"KUBERNETES_NAMESPACE_OVERWRITE_ALLOWED" description:"Regex to validate 'KUBERNETES_NAMESPACE_OVERWRITE' value"`
-	Privileged                    bool                 `toml:"privileged,omitzero" json:"privileged" long:"privileged" env:"KUBERNETES_PRIVILEGED" description:"Run all containers with the privileged flag enabled"`
-	CPUs                          string               `toml:"cpus,omitempty" json:"cpus" long:"cpus" env:"KUBERNETES_CPUS" description:"(deprecated) The CPU allocation given to build containers"`
-	Memory                        string               `toml:"memory,omitempty" json:"memory" long:"memory" env:"KUBERNETES_MEMORY" description:"(deprecated) The amount of memory allocated to build containers"`
-	ServiceCPUs                   string               `toml:"service_cpus,omitempty" json:"service_cpus" long:"service-cpus" env:"KUBERNETES_SERVICE_CPUS" description:"(deprecated) The CPU allocation given to build service containers"`
-	ServiceMemory                 string               `toml:"service_memory,omitempty" json:"service_memory" long:"service-memory" env:"KUBERNETES_SERVICE_MEMORY" description:"(deprecated) The amount of memory allocated to build service containers"`
-	HelperCPUs                    string               `toml:"helper_cpus,omitempty" json:"helper_cpus" long:"helper-cpus" env:"KUBERNETES_HELPER_CPUS" description:"(deprecated) The CPU allocation given to build helper containers"`
-	HelperMemory                  string               `toml:"helper_memory,omitempty" json:"helper_memory" long:"helper-memory" env:"KUBERNETES_HELPER_MEMORY" description:"(deprecated) The amount of memory allocated to build helper containers"`
-	CPULimit                      string               `toml:"cpu_limit,omitempty" json:"cpu_limit" long:"cpu-limit" env:"KUBERNETES_CPU_LIMIT" description:"The CPU allocation given to build containers"`
-	MemoryLimit                   string               `toml:"memory_limit,omitempty" json:"memory_limit" long:"memory-limit" env:"KUBERNETES_MEMORY_LIMIT" description:"The amount of memory allocated to build containers"`
-	ServiceCPULimit               string               `toml:"service_cpu_limit,omitempty" json:"service_cpu_limit" long:"service-cpu-limit" env:"KUBERNETES_SERVICE_CPU_LIMIT" description:"The CPU allocation given to build service containers"`
-	ServiceMemoryLimit            string               `toml:"service_memory_limit,omitempty" json:"service_memory_limit" long:"service-memory-limit" env:"KUBERNETES_SERVICE_MEMORY_LIMIT" description:"The amount of memory allocated to build service containers"`
-	HelperCPULimit                string               `toml:"helper_cpu_limit,omitempty" json:"helper_cpu_limit" long:"helper-cpu-limit" env:"KUBERNETES_HELPER_CPU_LIMIT" description:"The CPU allocation given to build helper containers"`
-	HelperMemoryLimit             string               `toml:"helper_memory_limit,omitempty" json:"helper_memory_limit" long:"helper-memory-limit" env:"KUBERNETES_HELPER_MEMORY_LIMIT" description:"The amount of memory allocated to build helper containers"`
-	CPURequest                    string               `toml:"cpu_request,omitempty" json:"cpu_request" long:"cpu-request" env:"KUBERNETES_CPU_REQUEST" description:"The CPU allocation requested for build containers"`
-	MemoryRequest                 string               `toml:"memory_request,omitempty" json:"memory_request" long:"memory-request" env:"KUBERNETES_MEMORY_REQUEST" description:"The amount of memory requested from build containers"`
-	ServiceCPURequest             string               `toml:"service_cpu_request,omitempty" json:"service_cpu_request" long:"service-cpu-request" env:"KUBERNETES_SERVICE_CPU_REQUEST" description:"The CPU allocation requested for build service containers"`
-	ServiceMemoryRequest          string               `toml:"service_memory_request,omitempty" json:"service_memory_request" long:"service-memory-request" env:"KUBERNETES_SERVICE_MEMORY_REQUEST" description:"The amount of memory requested for build service containers"`
-	HelperCPURequest              string               `toml:"helper_cpu_request,omitempty" json:"helper_cpu_request" long:"helper-cpu-request" env:"KUBERNETES_HELPER_CPU_REQUEST" description:"The CPU allocation requested for build helper containers"`
-	HelperMemoryRequest           string               `toml:"helper_memory_request,omitempty" json:"helper_memory_request" long:"helper-memory-request" env:"KUBERNETES_HELPER_MEMORY_REQUEST" description:"The amount of memory requested for build helper containers"`
-	PullPolicy                    KubernetesPullPolicy `toml:"pull_policy,omitempty" json:"pull_policy" long:"pull-policy" env:"KUBERNETES_PULL_POLICY" description:"Policy for if/when to pull a container image (never, if-not-present, always). The cluster default will be used if not set"`
-	NodeSelector                  map[string]string    `toml:"node_selector,omitempty" json:"node_selector" long:"node-selector" description:"A toml table/json object of key=value. Value is expected to be a string. When set this will create pods on k8s nodes that match all the key=value pairs."`
-	ImagePullSecrets              []string             `toml:"image_pull_secrets,omitempty" json:"image_pull_secrets" long:"image-pull-secrets" env:"KUBERNETES_IMAGE_PULL_SECRETS" description:"A list of image pull secrets that are used for pulling docker image"`
-	HelperImage                   string               `toml:"helper_image,omitempty" json:"helper_image" long:"helper-image" env:"KUBERNETES_HELPER_IMAGE" description:"[ADVANCED] Override the default helper image used to clone repos and upload artifacts"`
-	TerminationGracePeriodSeconds int64                `toml:"terminationGracePeriodSeconds,omitzero" json:"terminationGracePeriodSeconds" long:"terminationGracePeriodSeconds" env:"KUBERNETES_TERMINATIONGRACEPERIODSECONDS" description:"Duration after the processes running in the pod are sent a termination signal and the time when the processes are forcibly halted with a kill signal."`
-	PollInterval                  int                  `toml:"poll_interval,omitzero" json:"poll_interval" long:"poll-interval" env:"KUBERNETES_POLL_INTERVAL" description:"How frequently, in seconds, the runner will poll the Kubernetes pod it has just created to check its status"`
-	PollTimeout                   int                  `toml:"poll_timeout,omitzero" json:"poll_timeout" long:"poll-timeout" env:"KUBERNETES_POLL_TIMEOUT" description:"The total amount of time, in seconds, that needs to pass before the runner will timeout attempting to connect to the pod it has just created (useful for queueing more builds that the cluster can handle at a time)"`
+	Host                            string                      `toml:"host" json:"host" long:"host" env:"KUBERNETES_HOST" description:"Optional Kubernetes master host URL (auto-discovery attempted if not specified)"`
+	CertFile                        string                      `toml:"cert_file,omitempty" json:"cert_file" long:"cert-file" env:"KUBERNETES_CERT_FILE" description:"Optional Kubernetes master auth certificate"`
+	KeyFile                         string                      `toml:"key_file,omitempty" json:"key_file" long:"key-file" env:"KUBERNETES_KEY_FILE" description:"Optional Kubernetes master auth private key"`
+	CAFile                          string                      `toml:"ca_file,omitempty" json:"ca_file" long:"ca-file" env:"KUBERNETES_CA_FILE" description:"Optional Kubernetes master auth ca certificate"`
+	BearerToken                     string                      `toml:"bearer_token,omitempty" json:"bearer_token" long:"bearer-token" env:"KUBERNETES_BEARER_TOKEN" description:"Optional Kubernetes service account token used to authenticate with the API"`
+	KubeConfig                      string                      `toml:"kubeconfig,omitempty" json:"kubeconfig" long:"kubeconfig" env:"KUBERNETES_KUBECONFIG" description:"Optional path to the kubeconfig file used to connect to the cluster, when host is not set"`
+	Context                         string                      `toml:"context,omitempty" json:"context" long:"context" env:"KUBERNETES_CONTEXT" description:"Optional name of the kubeconfig context used to connect to the cluster (the current context is used when empty)"`
+	ExecCredential                  *KubernetesExecCredential   `toml:"exec_credential,omitempty" json:"exec_credential"`
+	Image                           string                      `toml:"image" json:"image" long:"image" env:"KUBERNETES_IMAGE" description:"Default docker image to use for builds when none is specified"`
+	Namespace                       string                      `toml:"namespace" json:"namespace" long:"namespace" env:"KUBERNETES_NAMESPACE" description:"Namespace to run Kubernetes jobs in"`
+	NamespaceOverwriteAllowed       string                      `toml:"namespace_overwrite_allowed" json:"namespace_overwrite_allowed" long:"namespace_overwrite_allowed" env:"KUBERNETES_NAMESPACE_OVERWRITE_ALLOWED" description:"Regex to validate 'KUBERNETES_NAMESPACE_OVERWRITE' value"`
+	NamespacePerJob                 bool                        `toml:"namespace_per_job,omitzero" json:"namespace_per_job" long:"namespace-per-job" env:"KUBERNETES_NAMESPACE_PER_JOB" description:"Create a dedicated namespace, prefixed with the configured namespace, for every job and remove it when the job finishes"`
+	NamespaceResourceQuota          string                      `toml:"namespace_resource_quota,omitempty" json:"namespace_resource_quota" long:"namespace-resource-quota" env:"KUBERNETES_NAMESPACE_RESOURCE_QUOTA" description:"Path to the manifest of a ResourceQuota created in the namespace of every job, when namespace_per_job is enabled"`
+	NamespaceNetworkPolicy          string                      `toml:"namespace_network_policy,omitempty" json:"namespace_network_policy" long:"namespace-network-policy" env:"KUBERNETES_NAMESPACE_NETWORK_POLICY" description:"Path to the manifest of a NetworkPolicy created in the namespace of every job, when namespace_per_job is enabled"`
+	ServiceAccount                  string                      `toml:"service_account,omitempty" json:"service_account" long:"service-account" env:"KUBERNETES_SERVICE_ACCOUNT" description:"Executor pods will use this Service Account to talk to kubernetes API"`
+	ServiceAccountMapping           []KubernetesServiceAccount  `toml:"service_account_mapping,omitempty" json:"service_account_mapping"`
+	ServiceAccountOverwriteAllowed  string                      `toml:"service_account_overwrite_allowed,omitempty" json:"service_account_overwrite_allowed" long:"service-account-overwrite-allowed" env:"KUBERNETES_SERVICE_ACCOUNT_OVERWRITE_ALLOWED" description:"Regex to validate 'KUBERNETES_SERVICE_ACCOUNT_OVERWRITE' value"`
+	Privileged                      bool                        `toml:"privileged,omitzero" json:"privileged" long:"privileged" env:"KUBERNETES_PRIVILEGED" description:"Run all containers with the privileged flag enabled"`
+	CPUs                            string                      `toml:"cpus,omitempty" json:"cpus" long:"cpus" env:"KUBERNETES_CPUS" description:"(deprecated) The CPU allocation given to build containers"`
+	Memory                          string                      `toml:"memory,omitempty" json:"memory" long:"memory" env:"KUBERNETES_MEMORY" description:"(deprecated) The amount of memory allocated to build containers"`
+	ServiceCPUs                     string                      `toml:"service_cpus,omitempty" json:"service_cpus" long:"service-cpus" env:"KUBERNETES_SERVICE_CPUS" description:"(deprecated) The CPU allocation given to build service containers"`
+	ServiceMemory                   string                      `toml:"service_memory,omitempty" json:"service_memory" long:"service-memory" env:"KUBERNETES_SERVICE_MEMORY" description:"(deprecated) The amount of memory allocated to build service containers"`
+	HelperCPUs                      string                      `toml:"helper_cpus,omitempty" json:"helper_cpus" long:"helper-cpus" env:"KUBERNETES_HELPER_CPUS" description:"(deprecated) The CPU allocation given to build helper containers"`
+	HelperMemory                    string                      `toml:"helper_memory,omitempty" json:"helper_memory" long:"helper-memory" env:"KUBERNETES_HELPER_MEMORY" description:"(deprecated) The amount of memory allocated to build helper containers"`
+	CPULimit                        string                      `toml:"cpu_limit,omitempty" json:"cpu_limit" long:"cpu-limit" env:"KUBERNETES_CPU_LIMIT" description:"The CPU allocation given to build containers"`
+	MemoryLimit                     string                      `toml:"memory_limit,omitempty" json:"memory_limit" long:"memory-limit" env:"KUBERNETES_MEMORY_LIMIT" description:"The amount of memory allocated to build containers"`
+	ServiceCPULimit                 string                      `toml:"service_cpu_limit,omitempty" json:"service_cpu_limit" long:"service-cpu-limit" env:"KUBERNETES_SERVICE_CPU_LIMIT" description:"The CPU allocation given to build service containers"`
+	ServiceMemoryLimit              string                      `toml:"service_memory_limit,omitempty" json:"service_memory_limit" long:"service-memory-limit" env:"KUBERNETES_SERVICE_MEMORY_LIMIT" description:"The amount of memory allocated to build service containers"`
+	HelperCPULimit                  string                      `toml:"helper_cpu_limit,omitempty" json:"helper_cpu_limit" long:"helper-cpu-limit" env:"KUBERNETES_HELPER_CPU_LIMIT" description:"The CPU allocation given to build helper containers"`
+	HelperMemoryLimit               string                      `toml:"helper_memory_limit,omitempty" json:"helper_memory_limit" long:"helper-memory-limit" env:"KUBERNETES_HELPER_MEMORY_LIMIT" description:"The amount of memory allocated to build helper containers"`
+	CPURequest                      string                      `toml:"cpu_request,omitempty" json:"cpu_request" long:"cpu-request" env:"KUBERNETES_CPU_REQUEST" description:"The CPU allocation requested for build containers"`
+	MemoryRequest                   string                      `toml:"memory_request,omitempty" json:"memory_request" long:"memory-request" env:"KUBERNETES_MEMORY_REQUEST" description:"The amount of memory requested from build containers"`
+	ServiceCPURequest               string                      `toml:"service_cpu_request,omitempty" json:"service_cpu_request" long:"service-cpu-request" env:"KUBERNETES_SERVICE_CPU_REQUEST" description:"The CPU allocation requested for build service containers"`
+	ServiceMemoryRequest            string                      `toml:"service_memory_request,omitempty" json:"service_memory_request" long:"service-memory-request" env:"KUBERNETES_SERVICE_MEMORY_REQUEST" description:"The amount of memory requested for build service containers"`
+	HelperCPURequest                string                      `toml:"helper_cpu_request,omitempty" json:"helper_cpu_request" long:"helper-cpu-request" env:"KUBERNETES_HELPER_CPU_REQUEST" description:"The CPU allocation requested for build helper containers"`
+	HelperMemoryRequest             string                      `toml:"helper_memory_request,omitempty" json:"helper_memory_request" long:"helper-memory-request" env:"KUBERNETES_HELPER_MEMORY_REQUEST" description:"The amount of memory requested for build helper containers"`
+	PullPolicy                      KubernetesPullPolicy        `toml:"pull_policy,omitempty" json:"pull_policy" long:"pull-policy" env:"KUBERNETES_PULL_POLICY" description:"Policy for if/when to pull a container image (never, if-not-present, always). The cluster default will be used if not set"`
+	ExecutionStrategy               KubernetesExecutionStrategy `toml:"execution_strategy,omitempty" json:"execution_strategy" long:"execution-strategy" env:"KUBERNETES_EXECUTION_STRATEGY" description:"How scripts are run in the build pod: attach (feed scripts to the shell of the container) or exec (start a new process for every script). Defaults to attach"`
+	NodeSelector                    map[string]string           `toml:"node_selector,omitempty" json:"node_selector" long:"node-selector" description:"A toml table/json object of key=value. Value is expected to be a string. When set this will create pods on k8s nodes that match all the key=value pairs."`
+	NodeSelectorOverwriteAllowed    string                      `toml:"node_selector_overwrite_allowed,omitempty" json:"node_selector_overwrite_allowed" long:"node-selector-overwrite-allowed" env:"KUBERNETES_NODE_SELECTOR_OVERWRITE_ALLOWED" description:"Regex to validate 'KUBERNETES_NODE_SELECTOR_*' values"`
+	NodeTolerations                 map[string]string           `toml:"node_tolerations,omitempty" json:"node_tolerations" long:"node-tolerations" description:"A toml table/json object of key=value:effect. Value is expected to be a taint effect. When set pods will tolerate the given taints"`
+	NodeTolerationsOverwriteAllowed string                      `toml:"node_tolerations_overwrite_allowed,omitempty" json:"node_tolerations_overwrite_allowed" long:"node-tolerations-overwrite-allowed" env:"KUBERNETES_NODE_TOLERATIONS_OVERWRITE_ALLOWED" description:"Regex to validate 'KUBERNETES_NODE_TOLERATIONS_*' values"`
+	Affinity                        *KubernetesAffinity         `toml:"affinity,omitempty" json:"affinity"`
+	TopologySpreadConstraints       []KubernetesTopologySpread  `toml:"topology_spread_constraints,omitempty" json:"topology_spread_constraints"`
+	PriorityClassName               string                      `toml:"priority_class_name,omitempty" json:"priority_class_name" long:"priority-class-name" env:"KUBERNETES_PRIORITY_CLASS_NAME" description:"Name of the PriorityClass of build pods"`
+	RuntimeClassName                string                      `toml:"runtime_class_name,omitempty" json:"runtime_class_name" long:"runtime-class-name" env:"KUBERNETES_RUNTIME_CLASS_NAME" description:"Name of the RuntimeClass of build pods, to run them with a sandboxed container runtime, like gVisor or Kata Containers"`
+	DNSPolicy                       KubernetesDNSPolicy         `toml:"dns_policy,omitempty" json:"dns_policy" long:"dns-policy" env:"KUBERNETES_DNS_POLICY" description:"How the DNS of build pods is configured (none, default, cluster-first, cluster-first-with-host-net). The cluster default will be used if not set"`
+	DNSConfig                       *KubernetesDNSConfig        `toml:"dns_config,omitempty" json:"dns_config"`
+	RunAsJob                        bool                        `toml:"run_as_job,omitzero" json:"run_as_job" long:"run-as-job" env:"KUBERNETES_RUN_AS_JOB" description:"Create a Job object running the build pod, instead of a bare pod"`
+	JobTTLSecondsAfterFinished      int                         `toml:"job_ttl_seconds_after_finished,omitzero" json:"job_ttl_seconds_after_finished" long:"job-ttl-seconds-after-finished" env:"KUBERNETES_JOB_TTL_SECONDS_AFTER_FINISHED" description:"How long, in seconds, a finished Job is kept before the cluster removes it, when run_as_job is enabled. When 0, the TTL is not set"`
+	PodSpec                         []KubernetesPodSpec         `toml:"pod_spec,omitempty" json:"pod_spec"`
+	Volumes                         KubernetesVolumes           `toml:"volumes,omitempty" json:"volumes"`
+	BuildsDirVolume                 *KubernetesBuildsDirVolume  `toml:"builds_dir_volume,omitempty" json:"builds_dir_volume"`
+	InitContainers                  []KubernetesInitContainer   `toml:"init_containers,omitempty" json:"init_containers"`
+	ServiceProbes                   []KubernetesServiceProbe    `toml:"service_probes,omitempty" json:"service_probes"`
+	WaitForServicesTimeout          int                         `toml:"wait_for_services_timeout,omitzero" json:"wait_for_services_timeout" long:"wait-for-services-timeout" env:"KUBERNETES_WAIT_FOR_SERVICES_TIMEOUT" description:"How long, in seconds, to wait for service containers to become ready. Use -1 to disable waiting"`
+	ImagePullSecrets                []string                    `toml:"image_pull_secrets,omitempty" json:"image_pull_secrets" long:"image-pull-secrets" env:"KUBERNETES_IMAGE_PULL_SECRETS" description:"A list of image pull secrets that are used for pulling docker image"`
+	HelperImage                     string                      `toml:"helper_image,omitempty" json:"helper_image" long:"helper-image" env:"KUBERNETES_HELPER_IMAGE" description:"[ADVANCED] Override the default helper image used to clone repos and upload artifacts"`
+	HelperImages                    map[string]string           `toml:"helper_images,omitempty" json:"helper_images" long:"helper-images" description:"[ADVANCED] A toml table/json object of architecture=image. Overrides the helper image used on nodes of the given architecture"`
+	HelperSecurityContext           *KubernetesSecurityContext  `toml:"helper_security_context,omitempty" json:"helper_security_context"`
+	TerminationGracePeriodSeconds   int64                       `toml:"terminationGracePeriodSeconds,omitzero" json:"terminationGracePeriodSeconds" long:"terminationGracePeriodSeconds" env:"KUBERNETES_TERMINATIONGRACEPERIODSECONDS" description:"(deprecated) Duration after the processes running in the pod are sent a termination signal and the time when the processes are forcibly halted with a kill signal."`
+	PodTerminationGracePeriod       *int64                      `toml:"termination_grace_period_seconds,omitempty" json:"termination_grace_period_seconds" long:"termination-grace-period-seconds" env:"KUBERNETES_TERMINATION_GRACE_PERIOD_SECONDS" description:"Duration, in seconds, after the processes running in the pod are sent a termination signal and the time when the processes are forcibly halted with a kill signal. Gives pre_stop hooks time to finish"`
+	BuildLifecycle                  *KubernetesLifecycle        `toml:"build_lifecycle,omitempty" json:"build_lifecycle"`
+	ServiceLifecycles               []KubernetesLifecycle       `toml:"service_lifecycles,omitempty" json:"service_lifecycles"`
+	PollInterval                    int                         `toml:"poll_interval,omitzero" json:"poll_interval" long:"poll-interval" env:"KUBERNETES_POLL_INTERVAL" description:"How frequently, in seconds, the runner will poll the Kubernetes pod it has just created to check its status"`
+	PollTimeout                     int                         `toml:"poll_timeout,omitzero" json:"poll_timeout" long:"poll-timeout" env:"KUBERNETES_POLL_TIMEOUT" description:"The total amount of time, in seconds, that needs to pass before the runner will timeout attempting to connect to the pod it has just created (useful for queueing more builds that the cluster can handle at a time)"`
+	SchedulingTimeout               int                         `toml:"scheduling_timeout,omitzero" json:"scheduling_timeout" long:"scheduling-timeout" env:"KUBERNETES_SCHEDULING_TIMEOUT" description:"The amount of time, in seconds, the build pod can wait to be assigned to a node before the job fails. When 0, only poll_timeout applies"`
+	DisruptionRetries               int                         `toml:"disruption_retries,omitzero" json:"disruption_retries" long:"disruption-retries" env:"KUBERNETES_DISRUPTION_RETRIES" description:"How many times the job is started again on a new pod when the build pod is preempted, evicted or its node shuts down"`
+	CleanupInterval                 int                         `toml:"cleanup_interval,omitzero" json:"cleanup_interval" long:"cleanup-interval" env:"KUBERNETES_CLEANUP_INTERVAL" description:"How frequently, in seconds, the runner will look for orphaned pods, secrets and config maps left behind by jobs. When 0, the cleanup is disabled"`
+	CleanupGracePeriod              int                         `toml:"cleanup_grace_period,omitzero" json:"cleanup_grace_period" long:"cleanup-grace-period" env:"KUBERNETES_CLEANUP_GRACE_PERIOD" description:"The minimal age, in seconds, of objects not used by any job of this runner before they are removed by the cleanup"`
+	ManagerID                       string                      `toml:"manager_id,omitempty" json:"manager_id" long:"manager-id" env:"KUBERNETES_MANAGER_ID" description:"The ID of the runner process set in the labels of its objects, which must not change when it's restarted. By default the short runner token"`
+}
+
+type KubernetesVolumeMount struct {
+	Name      string `toml:"name" json:"name"`
+	MountPath string `toml:"mount_path" json:"mount_path"`
+	SubPath   string `toml:"sub_path,omitempty" json:"sub_path"`
+	ReadOnly  bool   `toml:"read_only,omitzero" json:"read_only"`
+}
+
+type KubernetesVolumes struct {
+	HostPaths  []KubernetesHostPath  `toml:"host_path,omitempty" json:"host_path" description:"The host paths which will be mounted"`
+	PVCs       []KubernetesPVC       `toml:"pvc,omitempty" json:"pvc" description:"The persistent volume claims that will be mounted"`
+	ConfigMaps []KubernetesConfigMap `toml:"config_map,omitempty" json:"config_map" description:"The config maps which will be mounted as volumes"`
+	Secrets    []KubernetesSecret    `toml:"secret,omitempty" json:"secret" description:"The secret maps which will be mounted"`
+	EmptyDirs  []KubernetesEmptyDir  `toml:"empty_dir,omitempty" json:"empty_dir" description:"The empty directories which will be mounted"`
+	CSIs       []KubernetesCSI       `toml:"csi,omitempty" json:"csi" description:"The CSI volumes which will be mounted"`
+}
+
+type KubernetesExecCredential struct {
+	Command string            `toml:"command" json:"command" description:"The command printing the ExecCredential object with credentials of the cluster"`
+	Args    []string          `toml:"args,omitempty" json:"args" description:"Arguments of the command"`
+	Env     map[string]string `toml:"env,omitempty" json:"env" description:"Additional environment variables of the command"`
+}
+
+type KubernetesServiceAccount struct {
+	Project        string `toml:"project" json:"project" description:"The path of the project, may contain * wildcards; group/** matches all projects of the group and its subgroups"`
+	ServiceAccount string `toml:"service_account" json:"service_account" description:"The service account used by build pods of matching projects"`
+}
+
+type KubernetesBuildsDirVolume struct {
+	StorageClass string `toml:"storage_class,omitempty" json:"storage_class" description:"The storage class of the volume claim, the default storage class is used when empty"`
+	Size         string `toml:"size" json:"size" description:"The requested size of the volume"`
+	AccessMode   string `toml:"access_mode,omitempty" json:"access_mode" description:"The access mode of the volume claim (defaults to ReadWriteOnce)"`
+}
+
+type KubernetesHostPath struct {
+	Name      string `toml:"name" json:"name" description:"The name of the volume"`
+	MountPath string `toml:"mount_path" json:"mount_path" description:"Path where volume should be mounted inside of container"`
+	SubPath   string `toml:"sub_path,omitempty" json:"sub_path" description:"The sub-path of the volume to mount (defaults to volume root)"`
+	ReadOnly  bool   `toml:"read_only,omitzero" json:"read_only" description:"If this volume should be mounted read only"`
+	HostPath  string `toml:"host_path,omitempty" json:"host_path" description:"Path from the host that should be mounted as a volume (defaults to mount_path)"`
+}
+
+type KubernetesPVC struct {
+	Name      string `toml:"name" json:"name" description:"The name of the persistent volume claim"`
+	MountPath string `toml:"mount_path" json:"mount_path" description:"Path where volume should be mounted inside of container"`
+	SubPath   string `toml:"sub_path,omitempty" json:"sub_path" description:"The sub-path of the volume to mount (defaults to volume root)"`
+	ReadOnly  bool   `toml:"read_only,omitzero" json:"read_only" description:"If this volume should be mounted read only"`
+}
+
+type KubernetesConfigMap struct {
+	Name      string            `toml:"name" json:"name" description:"The name of the config map"`
+	MountPath string            `toml:"mount_path" json:"mount_path" description:"Path where volume should be mounted inside of container"`
+	SubPath   string            `toml:"sub_path,omitempty" json:"sub_path" description:"The sub-path of the volume to mount (defaults to volume root)"`
+	ReadOnly  bool              `toml:"read_only,omitzero" json:"read_only" description:"If this volume should be mounted read only"`
+	Items     map[string]string `toml:"items,omitempty" json:"items" description:"Key-to-path mapping for keys from the config map that should be used"`
+}
+
+type KubernetesSecret struct {
+	Name      string            `toml:"name" json:"name" description:"The name of the secret"`
+	MountPath string            `toml:"mount_path" json:"mount_path" description:"Path where volume should be mounted inside of container"`
+	SubPath   string            `toml:"sub_path,omitempty" json:"sub_path" description:"The sub-path of the volume to mount (defaults to volume root)"`
+	ReadOnly  bool              `toml:"read_only,omitzero" json:"read_only" description:"If this volume should be mounted read only"`
+	Items     map[string]string `toml:"items,omitempty" json:"items" description:"Key-to-path mapping for keys from the secret that should be used"`
+}
+
+type KubernetesEmptyDir struct {
+	Name      string `toml:"name" json:"name" description:"The name of the volume"`
+	MountPath string `toml:"mount_path" json:"mount_path" description:"Path where volume should be mounted inside of container"`
+	SubPath   string `toml:"sub_path,omitempty" json:"sub_path" description:"The sub-path of the volume to mount (defaults to volume root)"`
+	Medium    string `toml:"medium,omitempty" json:"medium" description:"Set to 'Memory' to have a tmpfs"`
+	SizeLimit string `toml:"size_limit,omitempty" json:"size_limit" description:"Total amount of local storage required for the volume"`
+}
+
+type KubernetesCSI struct {
+	Name             string            `toml:"name" json:"name" description:"The name of the volume"`
+	MountPath        string            `toml:"mount_path" json:"mount_path" description:"Path where volume should be mounted inside of container"`
+	SubPath          string            `toml:"sub_path,omitempty" json:"sub_path" description:"The sub-path of the volume to mount (defaults to volume root)"`
+	ReadOnly         bool              `toml:"read_only,omitzero" json:"read_only" description:"If this volume should be mounted read only"`
+	Driver           string            `toml:"driver" json:"driver" description:"A string value that specifies the name of the volume driver to use"`
+	FSType           string            `toml:"fs_type,omitempty" json:"fs_type" description:"Filesystem type to mount"`
+	VolumeAttributes map[string]string `toml:"volume_attributes,omitempty" json:"volume_attributes" description:"Key-value pair mapping for attributes of the CSI volume"`
+}
+
+type KubernetesSecurityContext struct {
+	Privileged             *bool    `toml:"privileged,omitempty" json:"privileged"`
+	RunAsUser              *int64   `toml:"run_as_user,omitempty" json:"run_as_user"`
+	RunAsNonRoot           *bool    `toml:"run_as_non_root,omitempty" json:"run_as_non_root"`
+	ReadOnlyRootFilesystem *bool    `toml:"read_only_root_filesystem,omitempty" json:"read_only_root_filesystem"`
+	CapAdd                 []string `toml:"cap_add,omitempty" json:"cap_add"`
+	CapDrop                []string `toml:"cap_drop,omitempty" json:"cap_drop"`
+}
+
+type KubernetesDNSConfig struct {
+	Nameservers []string                    `toml:"nameservers,omitempty" json:"nameservers" description:"A list of IP addresses of DNS servers used by the pod"`
+	Searches    []string                    `toml:"searches,omitempty" json:"searches" description:"A list of DNS search domains used for host-name lookup"`
+	Options     []KubernetesDNSConfigOption `toml:"options,omitempty" json:"options" description:"A list of resolver options"`
+}
+
+type KubernetesDNSConfigOption struct {
+	Name  string  `toml:"name" json:"name"`
+	Value *string `toml:"value,omitempty" json:"value"`
+}
+
+type KubernetesInitContainer struct {
+	Name         string                  `toml:"name" json:"name"`
+	Image        string                  `toml:"image" json:"image"`
+	Command      []string                `toml:"command,omitempty" json:"command"`
+	Args         []string                `toml:"args,omitempty" json:"args"`
+	VolumeMounts []KubernetesVolumeMount `toml:"volume_mounts,omitempty" json:"volume_mounts"`
+}
+
+type KubernetesServiceProbe struct {
+	Service             string   `toml:"service" json:"service"`
+	Port                int      `toml:"port,omitzero" json:"port"`
+	HTTPPath            string   `toml:"http_path,omitempty" json:"http_path"`
+	Command             []string `toml:"command,omitempty" json:"command"`
+	InitialDelaySeconds int32    `toml:"initial_delay_seconds,omitzero" json:"initial_delay_seconds"`
+	PeriodSeconds       int32    `toml:"period_seconds,omitzero" json:"period_seconds"`
+	TimeoutSeconds      int32    `toml:"timeout_seconds,omitzero" json:"timeout_seconds"`
+	FailureThreshold    int32    `toml:"failure_threshold,omitzero" json:"failure_threshold"`
+}
+
+type KubernetesLifecycle struct {
+	Service   string   `toml:"service,omitempty" json:"service" description:"The image name of the service, only used in service_lifecycles"`
+	PostStart []string `toml:"post_start,omitempty" json:"post_start" description:"The command executed in the container right after it's started"`
+	PreStop   []string `toml:"pre_stop,omitempty" json:"pre_stop" description:"The command executed in the container before it's stopped"`
+}
+
+type KubernetesPodSpec struct {
+	Name      string     `toml:"name" json:"name"`
+	PatchPath string     `toml:"patch_path,omitempty" json:"patch_path"`
+	Patch     string     `toml:"patch,omitempty" json:"patch"`
+	PatchType patch.Type `toml:"patch_type,omitempty" json:"patch_type"`
+}
+
+// PodSpecPatch returns the patch in JSON format, read from the file when
+// patch_path is set. The patch can be written in JSON or YAML.
+func (s *KubernetesPodSpec) PodSpecPatch() ([]byte, error) {
+	data := []byte(s.Patch)
+	if s.PatchPath != "" {
+		if s.Patch != "" {
+			return nil, fmt.Errorf("pod_spec %q: patch and patch_path can't be used together", s.Name)
+		}
+
+		var err error
+		if data, err = ioutil.ReadFile(s.PatchPath); err != nil {
+			return nil, fmt.Errorf("pod_spec %q: %v", s.Name, err)
+		}
+	}
+
+	data, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("pod_spec %q: %v", s.Name, err)
+	}
+	return data, nil
+}
+
+type KubernetesAffinity struct {
+	NodeAffinity    *KubernetesNodeAffinity `toml:"node_affinity,omitempty" json:"node_affinity"`
+	PodAffinity     *KubernetesPodAffinity  `toml:"pod_affinity,omitempty" json:"pod_affinity"`
+	PodAntiAffinity *KubernetesPodAffinity  `toml:"pod_anti_affinity,omitempty" json:"pod_anti_affinity"`
+}
+
+type KubernetesNodeAffinity struct {
+	RequiredDuringSchedulingIgnoredDuringExecution  []KubernetesNodeSelectorTerm        `toml:"required_during_scheduling_ignored_during_execution,omitempty" json:"required_during_scheduling_ignored_during_execution"`
+	PreferredDuringSchedulingIgnoredDuringExecution []KubernetesPreferredSchedulingTerm `toml:"preferred_during_scheduling_ignored_during_execution,omitempty" json:"preferred_during_scheduling_ignored_during_execution"`
+}
+
+type KubernetesNodeSelectorTerm struct {
+	MatchExpressions []KubernetesNodeSelectorRequirement `toml:"match_expressions,omitempty" json:"match_expressions"`
+}
+
+type KubernetesNodeSelectorRequirement struct {
+	Key      string   `toml:"key" json:"key"`
+	Operator string   `toml:"operator" json:"operator"`
+	Values   []string `toml:"values,omitempty" json:"values"`
+}
+
+type KubernetesPreferredSchedulingTerm struct {
+	Weight     int32                      `toml:"weight" json:"weight"`
+	Preference KubernetesNodeSelectorTerm `toml:"preference" json:"preference"`
+}
+
+type KubernetesPodAffinity struct {
+	RequiredDuringSchedulingIgnoredDuringExecution  []KubernetesPodAffinityTerm         `toml:"required_during_scheduling_ignored_during_execution,omitempty" json:"required_during_scheduling_ignored_during_execution"`
+	PreferredDuringSchedulingIgnoredDuringExecution []KubernetesWeightedPodAffinityTerm `toml:"preferred_during_scheduling_ignored_during_execution,omitempty" json:"preferred_during_scheduling_ignored_during_execution"`
+}
+
+type KubernetesPodAffinityTerm struct {
+	MatchLabels map[string]string `toml:"match_labels,omitempty" json:"match_labels"`
+	Namespaces  []string          `toml:"namespaces,omitempty" json:"namespaces"`
+	TopologyKey string            `toml:"topology_key" json:"topology_key"`
+}
+
+type KubernetesTopologySpread struct {
+	MaxSkew           int32             `toml:"max_skew" json:"max_skew"`
+	TopologyKey       string            `toml:"topology_key" json:"topology_key"`
+	WhenUnsatisfiable string            `toml:"when_unsatisfiable,omitempty" json:"when_unsatisfiable"`
+	MatchLabels       map[string]string `toml:"match_labels,omitempty" json:"match_labels"`
+}
+
+type KubernetesWeightedPodAffinityTerm struct {
+	Weight          int                       `toml:"weight" json:"weight"`
+	PodAffinityTerm KubernetesPodAffinityTerm `toml:"pod_affinity_term" json:"pod_affinity_term"`
 }
 
 type RunnerCredentials struct {
 	URL       string `toml:"url" json:"url" short:"u" long:"url" env:"CI_SERVER_URL" required:"true" description:"Runner URL"`
 	Token     string `toml:"token" json:"token" short:"t" long:"token" env:"CI_SERVER_TOKEN" required:"true" description:"Runner token"`
 	TLSCAFile string `toml:"tls-ca-file,omitempty" json:"tls-ca-file" long:"tls-ca-file" env:"CI_SERVER_TLS_CA_FILE" description:"File containing the certificates to verify the peer when using HTTPS"`
+	// The client certificate of the requests to GitLab, for the servers
+	// requiring the TLS client authentication
+	TLSCertFile string `toml:"tls-cert-file,omitempty" json:"tls-cert-file" long:"tls-cert-file" env:"CI_SERVER_TLS_CERT_FILE" description:"File containing the certificate to authenticate with the peer when using HTTPS"`
+	TLSKeyFile  string `toml:"tls-key-file,omitempty" json:"tls-key-file" long:"tls-key-file" env:"CI_SERVER_TLS_KEY_FILE" description:"File containing the private key to authenticate with the peer when using HTTPS"`
+
+	// The proxies of the requests of the runner to GitLab, passed to the
+	// builds and the services with the http_proxy, https_proxy and no_proxy
+	// variables
+	HTTPProxy  string `toml:"http_proxy,omitempty" json:"http_proxy" long:"http-proxy" env:"RUNNER_HTTP_PROXY" description:"Proxy of the HTTP requests of the runner and of its jobs"`
+	HTTPSProxy string `toml:"https_proxy,omitempty" json:"https_proxy" long:"https-proxy" env:"RUNNER_HTTPS_PROXY" description:"Proxy of the HTTPS requests of the runner and of its jobs"`
+	NoProxy    string `toml:"no_proxy,omitempty" json:"no_proxy" long:"no-proxy" env:"RUNNER_NO_PROXY" description:"Comma-separated hosts and domains requested without the proxies"`
+
+	tokenReference string
 }
 
 type CacheConfig struct {
@@ -182,49 +576,162 @@ type RunnerSettings struct {
 	PreBuildScript  string   `toml:"pre_build_script,omitempty" json:"pre_build_script" long:"pre-build-script" env:"RUNNER_PRE_BUILD_SCRIPT" description:"Runner-specific command script executed after code is pulled, just before build executes"`
 	PostBuildScript string   `toml:"post_build_script,omitempty" json:"post_build_script" long:"post-build-script" env:"RUNNER_POST_BUILD_SCRIPT" description:"Runner-specific command script executed after code is pulled and just after build executes"`
 
-	Shell string `toml:"shell,omitempty" json:"shell" long:"shell" env:"RUNNER_SHELL" description:"Select bash, cmd or powershell"`
-
-	SSH        *ssh.Config       `toml:"ssh,omitempty" json:"ssh" group:"ssh executor" namespace:"ssh"`
-	Docker     *DockerConfig     `toml:"docker,omitempty" json:"docker" group:"docker executor" namespace:"docker"`
-	Parallels  *ParallelsConfig  `toml:"parallels,omitempty" json:"parallels" group:"parallels executor" namespace:"parallels"`
-	VirtualBox *VirtualBoxConfig `toml:"virtualbox,omitempty" json:"virtualbox" group:"virtualbox executor" namespace:"virtualbox"`
-	Cache      *CacheConfig      `toml:"cache,omitempty" json:"cache" group:"cache configuration" namespace:"cache"`
-	Machine    *DockerMachine    `toml:"machine,omitempty" json:"machine" group:"docker machine provider" namespace:"machine"`
-	Kubernetes *KubernetesConfig `toml:"kubernetes,omitempty" json:"kubernetes" group:"kubernetes executor" namespace:"kubernetes"`
+	Shell         string `toml:"shell,omitempty" json:"shell" long:"shell" env:"RUNNER_SHELL" description:"Select bash, sh, zsh, cmd, powershell or pwsh"`
+	CommandPrefix string `toml:"command_prefix,omitempty" json:"command_prefix" long:"command-prefix" env:"RUNNER_COMMAND_PREFIX" description:"Prefix of the commands run by the build scripts, like nice -n10"`
+	Color         string `toml:"color,omitempty" json:"color" long:"color" env:"RUNNER_COLOR" description:"Set to always to force the colors of the build output, or to never to disable them"`
+	// LoginShell overwrites whether the executor runs bash and zsh as login
+	// shells, which read /etc/profile and ~/.bash_profile
+	LoginShell *bool `toml:"login_shell,omitempty" json:"login_shell"`
+	// DebugTraceDisabled ignores the CI_DEBUG_TRACE variable of the jobs, so
+	// the scripts are never traced
+	DebugTraceDisabled bool `toml:"debug_trace_disabled,omitzero" json:"debug_trace_disabled" long:"debug-trace-disabled" env:"RUNNER_DEBUG_TRACE_DISABLED" description:"Ignore the CI_DEBUG_TRACE variable of the jobs"`
+	// WorkingDirectories are the directories, relative to the project
+	// directory, the stages like build_script run in
+	WorkingDirectories map[string]string `toml:"working_directories,omitempty" json:"working_directories"`
+	// GitReference is the local repository, like a mirror of the projects,
+	// the clones borrow their objects from with git clone --reference
+	GitReference string `toml:"git_reference,omitempty" json:"git_reference" long:"git-reference" env:"RUNNER_GIT_REFERENCE" description:"Local repository the clones borrow their objects from, like a mirror of the projects"`
+	// GitReferences are the reference repositories of the projects, by their
+	// path like group/project, used instead of GitReference
+	GitReferences map[string]string `toml:"git_references,omitempty" json:"git_references"`
+
+	ShellExecutor *ShellExecutorConfig `toml:"shell_executor,omitempty" json:"shell_executor" group:"shell executor" namespace:"shell_executor"`
+	SSH           *ssh.Config          `toml:"ssh,omitempty" json:"ssh" group:"ssh executor" namespace:"ssh"`
+	Docker        *DockerConfig        `toml:"docker,omitempty" json:"docker" group:"docker executor" namespace:"docker"`
+	Podman        *PodmanConfig        `toml:"podman,omitempty" json:"podman" group:"podman executor" namespace:"podman"`
+	Custom        *CustomConfig        `toml:"custom,omitempty" json:"custom" group:"custom executor" namespace:"custom"`
+	Parallels     *ParallelsConfig     `toml:"parallels,omitempty" json:"parallels" group:"parallels executor" namespace:"parallels"`
+	VirtualBox    *VirtualBoxConfig    `toml:"virtualbox,omitempty" json:"virtualbox" group:"virtualbox executor" namespace:"virtualbox"`
+	LXD           *LXDConfig           `toml:"lxd,omitempty" json:"lxd" group:"lxd executor" namespace:"lxd"`
+	Fargate       *FargateConfig       `toml:"fargate,omitempty" json:"fargate" group:"fargate executor" namespace:"fargate"`
+	GCPBatch      *GCPBatchConfig      `toml:"gcp_batch,omitempty" json:"gcp_batch" group:"gcp batch executor" namespace:"gcp_batch"`
+	WSL           *WSLConfig           `toml:"wsl,omitempty" json:"wsl" group:"wsl executor" namespace:"wsl"`
+	Cache         *CacheConfig         `toml:"cache,omitempty" json:"cache" group:"cache configuration" namespace:"cache"`
+	Machine       *DockerMachine       `toml:"machine,omitempty" json:"machine" group:"docker machine provider" namespace:"machine"`
+	Kubernetes    *KubernetesConfig    `toml:"kubernetes,omitempty" json:"kubernetes" group:"kubernetes executor" namespace:"kubernetes"`
 }
 
 type RunnerConfig struct {
 	Name               string `toml:"name" json:"name" short:"name" long:"description" env:"RUNNER_NAME" description:"Runner name"`
 	Limit              int    `toml:"limit,omitzero" json:"limit" long:"limit" env:"RUNNER_LIMIT" description:"Maximum number of builds processed by this runner"`
+	ProjectLimit       int    `toml:"project_limit,omitzero" json:"project_limit" long:"project-limit" env:"RUNNER_PROJECT_LIMIT" description:"Maximum number of builds of one project processed by this runner"`
+	Weight             int    `toml:"weight,omitzero" json:"weight" long:"weight" env:"RUNNER_WEIGHT" description:"Share of the job requests of this runner, relative to the weights of the other runners"`
+	Priority           int    `toml:"priority,omitzero" json:"priority" long:"priority" env:"RUNNER_PRIORITY" description:"The runners of higher priority are requested first for jobs"`
+	SentryDSN          string `toml:"sentry_dsn,omitempty" json:"sentry_dsn" long:"sentry-dsn" env:"RUNNER_SENTRY_DSN" description:"Report the errors of this runner and of its jobs to this Sentry DSN, instead of the global one"`
 	OutputLimit        int    `toml:"output_limit,omitzero" long:"output-limit" env:"RUNNER_OUTPUT_LIMIT" description:"Maximum build trace size in kilobytes"`
 	RequestConcurrency int    `toml:"request_concurrency,omitzero" long:"request-concurrency" env:"RUNNER_REQUEST_CONCURRENCY" description:"Maximum concurrency for job requests"`
 
+	// The tags the runner was registered with, saved by register to filter
+	// the runners to unregister; the tags of the runner are set in GitLab
+	Tags []string `toml:"tags,omitempty" json:"tags"`
+
 	RunnerCredentials
 	RunnerSettings
+
+	Profiles []ExecutorProfile `toml:"profiles,omitempty" json:"profiles"`
+
+	includedFrom string
+}
+
+// ExecutorProfile is an alternative executor of the runner, selected by the
+// builds with the EXECUTOR_PROFILE variable. The settings left empty are
+// taken from the runner.
+type ExecutorProfile struct {
+	Name string `toml:"name" json:"name"`
+
+	RunnerSettings
+}
+
+// HTTPClientConfig is the transport of the requests to GitLab, shared by the
+// requests of all the jobs to the same GitLab
+type HTTPClientConfig struct {
+	MaxIdleConns        int  `toml:"max_idle_conns,omitzero" json:"max_idle_conns" description:"Maximum number of the idle connections to GitLab, 100 by default"`
+	MaxIdleConnsPerHost int  `toml:"max_idle_conns_per_host,omitzero" json:"max_idle_conns_per_host" description:"Maximum number of the idle connections to each GitLab host, 10 by default"`
+	IdleConnTimeout     int  `toml:"idle_conn_timeout,omitzero" json:"idle_conn_timeout" description:"Timeout in seconds of the idle connections, 90 by default"`
+	DialTimeout         int  `toml:"dial_timeout,omitzero" json:"dial_timeout" description:"Timeout in seconds of the connection to GitLab, 30 by default"`
+	TLSHandshakeTimeout int  `toml:"tls_handshake_timeout,omitzero" json:"tls_handshake_timeout" description:"Timeout in seconds of the TLS handshake, 10 by default"`
+	EnableHTTP2         bool `toml:"enable_http2,omitzero" json:"enable_http2" description:"Use HTTP/2 with the GitLab servers supporting it"`
 }
 
 type Config struct {
-	MetricsServerAddress string          `toml:"metrics_server,omitempty" json:"metrics_server"`
-	Concurrent           int             `toml:"concurrent" json:"concurrent"`
-	CheckInterval        int             `toml:"check_interval" json:"check_interval" description:"Define active checking interval of jobs"`
-	User                 string          `toml:"user,omitempty" json:"user"`
-	Runners              []*RunnerConfig `toml:"runners" json:"runners"`
-	SentryDSN            *string         `toml:"sentry_dsn"`
-	ModTime              time.Time       `toml:"-"`
-	Loaded               bool            `toml:"-"`
+	MetricsServerAddress string            `toml:"metrics_server,omitempty" json:"metrics_server"`
+	HealthServerAddress  string            `toml:"health_server,omitempty" json:"health_server"`
+	DebugServerAddress   string            `toml:"debug_server,omitempty" json:"debug_server"`
+	DebugServerToken     string            `toml:"debug_server_token,omitempty" json:"debug_server_token"`
+	Concurrent           int               `toml:"concurrent" json:"concurrent"`
+	CheckInterval        int               `toml:"check_interval" json:"check_interval" description:"Define active checking interval of jobs"`
+	MaxCheckInterval     int               `toml:"max_check_interval,omitzero" json:"max_check_interval" description:"Define the longest checking interval of jobs of the idle runners"`
+	User                 string            `toml:"user,omitempty" json:"user"`
+	Runners              []*RunnerConfig   `toml:"runners" json:"runners"`
+	SentryDSN            *string           `toml:"sentry_dsn"`
+	TokenKMSCommand      string            `toml:"token_kms_command,omitempty" json:"token_kms_command"`
+	IncludeDir           string            `toml:"include_dir,omitempty" json:"include_dir"`
+	StopTimeout          int               `toml:"stop_timeout,omitempty" json:"stop_timeout" description:"Limit in seconds the wait for the jobs on the graceful shutdown"`
+	Tracing              *tracing.Config   `toml:"tracing,omitempty" json:"tracing"`
+	HTTPClient           *HTTPClientConfig `toml:"http_client,omitempty" json:"http_client"`
+	SpoolDir             string            `toml:"spool_dir,omitempty" json:"spool_dir" description:"Directory of the results of the jobs kept while GitLab is unreachable"`
+	ModTime              time.Time         `toml:"-"`
+	Loaded               bool              `toml:"-"`
 }
 
-func (c *KubernetesConfig) GetHelperImage() string {
+// GetHelperImage returns the helper image used on nodes of the given
+// architecture, as reported by the kubernetes.io/arch label of the node
+func (c *KubernetesConfig) GetHelperImage(arch string) string {
+	if image := c.HelperImages[arch]; len(image) > 0 {
+		return image
+	}
+
 	if len(c.HelperImage) > 0 {
 		return c.HelperImage
 	}
 
+	return getDefaultHelperImage(arch)
+}
+
+// GetHelperImage returns the helper image used on hosts of the given
+// architecture
+func (c *PodmanConfig) GetHelperImage(arch string) string {
+	if len(c.HelperImage) > 0 {
+		return c.HelperImage
+	}
+
+	return getDefaultHelperImage(arch)
+}
+
+// GetHelperImage returns the helper image of the Batch jobs
+func (c *GCPBatchConfig) GetHelperImage() string {
+	if len(c.HelperImage) > 0 {
+		return c.HelperImage
+	}
+
+	return getDefaultHelperImage("amd64")
+}
+
+// getDefaultHelperImage returns the helper image of this version of the
+// runner for the given architecture
+func getDefaultHelperImage(arch string) string {
 	rev := REVISION
 	if rev == "HEAD" {
 		rev = "latest"
 	}
 
-	return fmt.Sprintf("%s:x86_64-%s", defaultHelperImage, rev)
+	switch arch {
+	case "", "amd64":
+		arch = "x86_64"
+	case "arm64":
+		arch = "arm"
+	}
+
+	return fmt.Sprintf("%s:%s-%s", defaultHelperImage, arch, rev)
+}
+
+// GetTerminationGracePeriod returns the termination grace period of the
+// build pod, as set by the new or the deprecated setting
+func (c *KubernetesConfig) GetTerminationGracePeriod() *int64 {
+	if c.PodTerminationGracePeriod != nil {
+		return c.PodTerminationGracePeriod
+	}
+	return &c.TerminationGracePeriodSeconds
 }
 
 func (c *KubernetesConfig) GetPollAttempts() int {
@@ -295,6 +802,13 @@ func (c *RunnerConfig) String() string {
 	return fmt.Sprintf("%v url=%v token=%v executor=%v", c.Name, c.URL, c.Token, c.Executor)
 }
 
+func (c *RunnerConfig) GetWeight() int {
+	if c.Weight <= 0 {
+		return 1
+	}
+	return c.Weight
+}
+
 func (c *RunnerConfig) GetRequestConcurrency() int {
 	if c.RequestConcurrency <= 0 {
 		return 1
@@ -302,8 +816,37 @@ func (c *RunnerConfig) GetRequestConcurrency() int {
 	return c.RequestConcurrency
 }
 
+// colorVariables returns the variables the common tools use to force or to
+// disable the colors of their output, when they don't write to a terminal
+func colorVariables(color string) BuildVariables {
+	switch color {
+	case ColorAlways:
+		return BuildVariables{
+			{Key: "FORCE_COLOR", Value: "1", Internal: true},
+			{Key: "CLICOLOR_FORCE", Value: "1", Internal: true},
+			{Key: "CLICOLOR", Value: "1", Internal: true},
+			{Key: "TERM", Value: "xterm-256color", Internal: true},
+		}
+	case ColorNever:
+		return BuildVariables{
+			{Key: "NO_COLOR", Value: "1", Internal: true},
+			{Key: "CLICOLOR", Value: "0", Internal: true},
+			{Key: "TERM", Value: "dumb", Internal: true},
+		}
+	}
+	return nil
+}
+
+func (c *RunnerConfig) validateColor() error {
+	switch c.Color {
+	case "", ColorAlways, ColorNever:
+		return nil
+	}
+	return fmt.Errorf("Invalid color %q of the %s runner, use %s or %s", c.Color, c.ShortDescription(), ColorAlways, ColorNever)
+}
+
 func (c *RunnerConfig) GetVariables() BuildVariables {
-	var variables BuildVariables
+	variables := colorVariables(c.Color)
 
 	for _, environment := range c.Environment {
 		if variable, err := ParseVariable(environment); err == nil {
@@ -315,6 +858,63 @@ func (c *RunnerConfig) GetVariables() BuildVariables {
 	return variables
 }
 
+// mergeRunnerSettings returns the settings, with the empty ones taken from
+// the defaults
+func mergeRunnerSettings(settings, defaults RunnerSettings) RunnerSettings {
+	merged := reflect.ValueOf(&settings).Elem()
+	defaultValues := reflect.ValueOf(defaults)
+
+	for i := 0; i < merged.NumField(); i++ {
+		field := merged.Field(i)
+		if reflect.DeepEqual(field.Interface(), reflect.Zero(field.Type()).Interface()) {
+			field.Set(defaultValues.Field(i))
+		}
+	}
+	return settings
+}
+
+// GetProfileConfig returns the config of the runner with the settings of the
+// executor profile selected by the EXECUTOR_PROFILE variable, or the config
+// itself when no profile is selected
+func (c *RunnerConfig) GetProfileConfig(variables BuildVariables) (*RunnerConfig, error) {
+	name := variables.Get(ExecutorProfileVariable)
+	if name == "" {
+		return c, nil
+	}
+
+	names := make([]string, 0, len(c.Profiles))
+	for _, profile := range c.Profiles {
+		if profile.Name != name {
+			names = append(names, profile.Name)
+			continue
+		}
+
+		config := *c
+		config.RunnerSettings = mergeRunnerSettings(profile.RunnerSettings, c.RunnerSettings)
+		config.Profiles = nil
+		return &config, nil
+	}
+
+	if len(names) == 0 {
+		return nil, fmt.Errorf("Unknown executor profile %q, the runner doesn't define any", name)
+	}
+	return nil, fmt.Errorf("Unknown executor profile %q, use one of: %s", name, strings.Join(names, ", "))
+}
+
+func (c *RunnerConfig) validateProfiles() error {
+	names := make(map[string]bool)
+	for _, profile := range c.Profiles {
+		if profile.Name == "" {
+			return fmt.Errorf("runner %s: missing name of executor profile", c.ShortDescription())
+		}
+		if names[profile.Name] {
+			return fmt.Errorf("runner %s: duplicate executor profile %q", c.ShortDescription(), profile.Name)
+		}
+		names[profile.Name] = true
+	}
+	return nil
+}
+
 func NewConfig() *Config {
 	return &Config{
 		Concurrent: 1,
@@ -330,7 +930,7 @@ func (c *Config) StatConfig(configFile string) error {
 }
 
 func (c *Config) LoadConfig(configFile string) error {
-	info, err := os.Stat(configFile)
+	_, err := os.Stat(configFile)
 
 	// permission denied is soft error
 	if os.IsNotExist(err) {
@@ -343,19 +943,63 @@ func (c *Config) LoadConfig(configFile string) error {
 		return err
 	}
 
+	err = c.loadIncludedFiles(configFile)
+	if err != nil {
+		return err
+	}
+
+	modTime, err := c.GetModTime(configFile)
+	if err != nil {
+		return err
+	}
+
+	err = c.Validate()
+	if err != nil {
+		return err
+	}
+
+	err = c.loadTokens()
+	if err != nil {
+		return err
+	}
+
+	c.ModTime = modTime
+	c.Loaded = true
+	return nil
+}
+
+// Validate checks the settings of the runners, which can't be checked by
+// decoding the file, and compiles the off peak periods
+func (c *Config) Validate() error {
 	for _, runner := range c.Runners {
-		if runner.Machine == nil {
-			continue
+		err := runner.validateProfiles()
+		if err != nil {
+			return err
 		}
 
-		err := runner.Machine.CompileOffPeakPeriods()
+		err = runner.validateColor()
 		if err != nil {
 			return err
 		}
-	}
 
-	c.ModTime = info.ModTime()
-	c.Loaded = true
+		if runner.Machine != nil {
+			err = runner.Machine.CompileOffPeakPeriods()
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, profile := range runner.Profiles {
+			if profile.Machine == nil {
+				continue
+			}
+
+			err = profile.Machine.CompileOffPeakPeriods()
+			if err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
@@ -363,7 +1007,12 @@ func (c *Config) SaveConfig(configFile string) error {
 	var newConfig bytes.Buffer
 	newBuffer := bufio.NewWriter(&newConfig)
 
-	if err := toml.NewEncoder(newBuffer).Encode(c); err != nil {
+	err := c.withoutIncludedRunners(func() error {
+		return c.withTokenReferences(func() error {
+			return toml.NewEncoder(newBuffer).Encode(c)
+		})
+	})
+	if err != nil {
 		log.Fatalf("Error encoding TOML: %s", err)
 		return err
 	}
@@ -390,3 +1039,52 @@ func (c *Config) GetCheckInterval() time.Duration {
 	}
 	return CheckInterval
 }
+
+// GetMaxCheckInterval returns the longest interval of the job requests of an
+// idle runner, which is check_interval when the polling isn't adaptive
+func (c *Config) GetMaxCheckInterval() time.Duration {
+	max := time.Duration(c.MaxCheckInterval) * time.Second
+	if max < c.GetCheckInterval() {
+		return c.GetCheckInterval()
+	}
+	return max
+}
+
+func (c *HTTPClientConfig) GetMaxIdleConns() int {
+	if c == nil || c.MaxIdleConns <= 0 {
+		return DefaultMaxIdleConns
+	}
+	return c.MaxIdleConns
+}
+
+func (c *HTTPClientConfig) GetMaxIdleConnsPerHost() int {
+	if c == nil || c.MaxIdleConnsPerHost <= 0 {
+		return DefaultMaxIdleConnsPerHost
+	}
+	return c.MaxIdleConnsPerHost
+}
+
+func (c *HTTPClientConfig) GetIdleConnTimeout() time.Duration {
+	if c == nil || c.IdleConnTimeout <= 0 {
+		return DefaultIdleConnTimeout * time.Second
+	}
+	return time.Duration(c.IdleConnTimeout) * time.Second
+}
+
+func (c *HTTPClientConfig) GetDialTimeout() time.Duration {
+	if c == nil || c.DialTimeout <= 0 {
+		return DefaultDialTimeout * time.Second
+	}
+	return time.Duration(c.DialTimeout) * time.Second
+}
+
+func (c *HTTPClientConfig) GetTLSHandshakeTimeout() time.Duration {
+	if c == nil || c.TLSHandshakeTimeout <= 0 {
+		return DefaultTLSHandshakeTimeout * time.Second
+	}
+	return time.Duration(c.TLSHandshakeTimeout) * time.Second
+}
+
+func (c *HTTPClientConfig) IsHTTP2Enabled() bool {
+	return c != nil && c.EnableHTTP2
+}
@@ -0,0 +1,111 @@
+package common
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// GetIncludedFiles returns the files of the include_dir, in the order their
+// runners are added to the config. The include_dir is relative to the
+// directory of the config file.
+func (c *Config) GetIncludedFiles(configFile string) ([]string, error) {
+	if c.IncludeDir == "" {
+		return nil, nil
+	}
+
+	return filepath.Glob(filepath.Join(c.getIncludeDir(configFile), "*.toml"))
+}
+
+func (c *Config) getIncludeDir(configFile string) string {
+	if filepath.IsAbs(c.IncludeDir) {
+		return c.IncludeDir
+	}
+	return filepath.Join(filepath.Dir(configFile), c.IncludeDir)
+}
+
+// loadIncludedFiles adds the runners of the files of the include_dir after
+// the runners of the config file. The included files can have only runners.
+func (c *Config) loadIncludedFiles(configFile string) error {
+	files, err := c.GetIncludedFiles(configFile)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		included := struct {
+			Runners []*RunnerConfig `toml:"runners"`
+		}{}
+
+		metadata, err := toml.DecodeFile(file, &included)
+		if err != nil {
+			return fmt.Errorf("Failed to load the included config %s: %v", file, err)
+		}
+		if undecoded := metadata.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("Failed to load the included config %s: only [[runners]] can be set, found %s", file, undecoded[0])
+		}
+
+		for _, runner := range included.Runners {
+			runner.includedFrom = file
+			c.Runners = append(c.Runners, runner)
+		}
+	}
+	return nil
+}
+
+// GetModTime returns the latest modification time of the config file, of
+// the include_dir, changed when files are added or removed, and of the
+// included files
+func (c *Config) GetModTime(configFile string) (time.Time, error) {
+	files := []string{configFile}
+	if c.IncludeDir != "" {
+		files = append(files, c.getIncludeDir(configFile))
+	}
+
+	included, err := c.GetIncludedFiles(configFile)
+	if err != nil {
+		return time.Time{}, err
+	}
+	files = append(files, included...)
+
+	var modTime time.Time
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if os.IsNotExist(err) && file != configFile {
+			continue
+		} else if err != nil {
+			return time.Time{}, err
+		}
+
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+	return modTime, nil
+}
+
+// IncludedFrom returns the included file the runner is defined in, or an
+// empty string if it's defined in the config file
+func (c *RunnerConfig) IncludedFrom() string {
+	return c.includedFrom
+}
+
+// withoutIncludedRunners calls f with only the runners of the config file,
+// so the runners of the included files are not saved to the config file
+func (c *Config) withoutIncludedRunners(f func() error) error {
+	runners := c.Runners
+	defer func() {
+		c.Runners = runners
+	}()
+
+	c.Runners = nil
+	for _, runner := range runners {
+		if runner.includedFrom == "" {
+			c.Runners = append(c.Runners, runner)
+		}
+	}
+	return f()
+}
@@ -0,0 +1,110 @@
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfigFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "config")
+	require.NoError(t, err)
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+	}
+	return dir
+}
+
+func TestConfigIncludeDir(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"config.toml": `
+concurrent = 2
+include_dir = "conf.d"
+
+[[runners]]
+  name = "main"
+  executor = "shell"
+`,
+		"conf.d/20-docker.toml": `
+[[runners]]
+  name = "docker"
+  executor = "docker"
+  [runners.docker]
+    image = "alpine"
+`,
+		"conf.d/10-ssh.toml": `
+[[runners]]
+  name = "ssh-1"
+  executor = "ssh"
+
+[[runners]]
+  name = "ssh-2"
+  executor = "ssh"
+`,
+		"conf.d/README": "not included",
+	})
+	defer os.RemoveAll(dir)
+
+	configFile := filepath.Join(dir, "config.toml")
+	config := NewConfig()
+	require.NoError(t, config.LoadConfig(configFile))
+
+	names := []string{}
+	for _, runner := range config.Runners {
+		names = append(names, runner.Name+":"+filepath.Base(runner.IncludedFrom()))
+	}
+	assert.Equal(t, "main:. ssh-1:10-ssh.toml ssh-2:10-ssh.toml docker:20-docker.toml", strings.Join(names, " "))
+	assert.Equal(t, "alpine", config.Runners[3].Docker.Image)
+
+	config.Runners = append(config.Runners, &RunnerConfig{Name: "registered"})
+	require.NoError(t, config.SaveConfig(configFile))
+	assert.Len(t, config.Runners, 5)
+
+	data, err := ioutil.ReadFile(configFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `name = "main"`)
+	assert.Contains(t, string(data), `name = "registered"`)
+	assert.NotContains(t, string(data), `name = "ssh-1"`)
+	assert.NotContains(t, string(data), `name = "docker"`)
+}
+
+func TestConfigIncludeDirModTime(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"config.toml":        `include_dir = "conf.d"`,
+		"conf.d/runner.toml": "",
+	})
+	defer os.RemoveAll(dir)
+
+	configFile := filepath.Join(dir, "config.toml")
+	config := NewConfig()
+	require.NoError(t, config.LoadConfig(configFile))
+
+	future := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "conf.d/runner.toml"), future, future))
+
+	modTime, err := config.GetModTime(configFile)
+	require.NoError(t, err)
+	assert.True(t, config.ModTime.Before(modTime))
+	assert.Equal(t, future.Unix(), modTime.Unix())
+}
+
+func TestConfigIncludeDirErrors(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"config.toml":        `include_dir = "conf.d"`,
+		"conf.d/runner.toml": "concurrent = 10\n",
+	})
+	defer os.RemoveAll(dir)
+
+	err := NewConfig().LoadConfig(filepath.Join(dir, "config.toml"))
+	assert.EqualError(t, err, "Failed to load the included config "+filepath.Join(dir, "conf.d/runner.toml")+
+		": only [[runners]] can be set, found concurrent")
+}
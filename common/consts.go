@@ -11,15 +11,37 @@ const UpdateRetryInterval = 3 * time.Second
 const ReloadConfigInterval = 3
 const HealthyChecks = 3
 const HealthCheckInterval = 3600
+const UnreachableInstanceCheckInterval = 60
+const DefaultRetryAfter = 5 * time.Second
+const MaxRetryAfter = 60 * time.Second
+const RateLimitRetries = 3
 const DefaultWaitForServicesTimeout = 30
 const ShutdownTimeout = 30
 const DefaultOutputLimit = 4096 // 4MB in kilobytes
 const ForceTraceSentInterval = 30 * time.Second
+const TracePatchLimit = 256 * 1024
+const KeepaliveInterval = 60 * time.Second
+const OrphanedJobTimeout = 60 * time.Minute
+const FinalUpdateRetries = 5
+const SpoolCheckInterval = 5 * time.Second
+const SpoolRetryInterval = 10 * time.Second
+const MaxSpoolRetryInterval = 10 * time.Minute
+const SpoolExpiry = 24 * time.Hour
 const PreparationRetries = 3
 const DefaultGetSourcesAttempts = 1
 const DefaultArtifactDownloadAttempts = 1
 const DefaultRestoreCacheAttempts = 1
 const KubernetesPollInterval = 3
 const KubernetesPollTimeout = 180
+const ExecutorProfileVariable = "EXECUTOR_PROFILE"
+const ShellOptionsVariable = "CI_SHELL_OPTIONS"
+const ErrorActionPreferenceVariable = "CI_ERROR_ACTION_PREFERENCE"
+const ColorAlways = "always"
+const ColorNever = "never"
+const DefaultMaxIdleConns = 100
+const DefaultMaxIdleConnsPerHost = 10
+const DefaultIdleConnTimeout = 90
+const DefaultDialTimeout = 30
+const DefaultTLSHandshakeTimeout = 10
 
 var PreparationRetryInterval = 3 * time.Second
@@ -26,6 +26,9 @@ type ExecutorProvider interface {
 	Acquire(config *RunnerConfig) (ExecutorData, error)
 	Release(config *RunnerConfig, data ExecutorData) error
 	GetFeatures(features *FeaturesInfo)
+	// GetDefaultShell returns the shell of the executor, used when the
+	// runner doesn't configure one
+	GetDefaultShell() string
 }
 
 type BuildError struct {
@@ -40,6 +43,40 @@ func (b *BuildError) Error() string {
 	return b.Inner.Error()
 }
 
+// JobFailureReason is the reason of the failure of the job
+type JobFailureReason string
+
+const (
+	// ScriptFailure is the failure of the script of the job
+	ScriptFailure JobFailureReason = "script_failure"
+	// RunnerSystemFailure is the failure of the runner or of the
+	// infrastructure running the job, which may succeed when retried
+	RunnerSystemFailure JobFailureReason = "runner_system_failure"
+)
+
+// SystemError is returned by the executors when the job was stopped by the
+// infrastructure running it, like an evicted pod, and not by its script
+type SystemError struct {
+	Inner error
+}
+
+func (e *SystemError) Error() string {
+	if e.Inner == nil {
+		return "system failure"
+	}
+
+	return e.Inner.Error()
+}
+
+// GetFailureReason returns the reason of the failure of the job, only the
+// BuildErrors are failures of its script
+func GetFailureReason(err error) JobFailureReason {
+	if _, ok := err.(*BuildError); ok {
+		return ScriptFailure
+	}
+	return RunnerSystemFailure
+}
+
 var executors map[string]ExecutorProvider
 
 func RegisterExecutor(executor string, provider ExecutorProvider) {
@@ -82,6 +119,26 @@ func GetExecutorProviders() (providers []ExecutorProvider) {
 	return
 }
 
+// GetFeatures returns the features of the executor of the runner and of
+// its shell, which defaults to the shell of the executor
+func GetFeatures(config RunnerConfig) (features FeaturesInfo) {
+	provider := GetExecutor(config.Executor)
+	if provider == nil {
+		return
+	}
+	provider.GetFeatures(&features)
+
+	shellName := config.Shell
+	if shellName == "" {
+		shellName = provider.GetDefaultShell()
+	}
+
+	if shell := GetShell(shellName); shell != nil {
+		shell.GetFeatures(&features)
+	}
+	return
+}
+
 func NewExecutor(executor string) Executor {
 	provider := GetExecutor(executor)
 	if provider != nil {
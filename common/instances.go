@@ -0,0 +1,31 @@
+package common
+
+import (
+	"sync"
+)
+
+var unreachableInstancesLock sync.RWMutex
+var unreachableInstances = make(map[string]bool)
+
+// SetInstanceReachable stores if the GitLab instance answered the last
+// request of the jobs, a failed connection or a server error makes it
+// unreachable
+func SetInstanceReachable(url string, reachable bool) {
+	unreachableInstancesLock.Lock()
+	defer unreachableInstancesLock.Unlock()
+
+	if reachable {
+		delete(unreachableInstances, url)
+	} else {
+		unreachableInstances[url] = true
+	}
+}
+
+// IsInstanceReachable returns if the GitLab instance answered the last
+// request of the jobs
+func IsInstanceReachable(url string) bool {
+	unreachableInstancesLock.RLock()
+	defer unreachableInstancesLock.RUnlock()
+
+	return !unreachableInstances[url]
+}
@@ -0,0 +1,26 @@
+package common
+
+import (
+	"sync"
+)
+
+var longPollingLock sync.RWMutex
+var longPollingByRunner = make(map[string]bool)
+
+// SetLongPolling stores if GitLab holds the job requests of the runner until
+// a job is available or the polling timeout passes, as reported by GitLab
+// when the runner asks for a build
+func SetLongPolling(runner RunnerCredentials, enabled bool) {
+	longPollingLock.Lock()
+	defer longPollingLock.Unlock()
+
+	longPollingByRunner[runner.UniqueID()] = enabled
+}
+
+// IsLongPolling returns if the job requests of the runner are long polling
+func IsLongPolling(runner RunnerCredentials) bool {
+	longPollingLock.RLock()
+	defer longPollingLock.RUnlock()
+
+	return longPollingByRunner[runner.UniqueID()]
+}
@@ -38,3 +38,10 @@ func (m *MockExecutorProvider) Release(config *RunnerConfig, data ExecutorData)
 func (m *MockExecutorProvider) GetFeatures(features *FeaturesInfo) {
 	m.Called(features)
 }
+func (m *MockExecutorProvider) GetDefaultShell() string {
+	ret := m.Called()
+
+	r0 := ret.Get(0).(string)
+
+	return r0
+}
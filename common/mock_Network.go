@@ -36,13 +36,24 @@ func (m *MockNetwork) DeleteRunner(config RunnerCredentials) bool {
 
 	return r0
 }
-func (m *MockNetwork) VerifyRunner(config RunnerCredentials) bool {
+func (m *MockNetwork) VerifyRunner(config RunnerCredentials) VerifyState {
 	ret := m.Called(config)
 
-	r0 := ret.Get(0).(bool)
+	r0 := ret.Get(0).(VerifyState)
 
 	return r0
 }
+func (m *MockNetwork) VerifyRunnerToken(config RunnerCredentials) (*VerifyRunnerTokenResponse, VerifyState) {
+	ret := m.Called(config)
+
+	var r0 *VerifyRunnerTokenResponse
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*VerifyRunnerTokenResponse)
+	}
+	r1 := ret.Get(1).(VerifyState)
+
+	return r0, r1
+}
 func (m *MockNetwork) UpdateBuild(config RunnerConfig, id int, state BuildState, trace *string) UpdateState {
 	ret := m.Called(config, id, state, trace)
 
@@ -85,3 +96,6 @@ func (m *MockNetwork) ProcessBuild(config RunnerConfig, buildCredentials *BuildC
 
 	return r0
 }
+func (m *MockNetwork) ResetClients() {
+	m.Called()
+}
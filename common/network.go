@@ -2,6 +2,7 @@ package common
 
 import (
 	"io"
+	"time"
 
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/url"
 )
@@ -9,6 +10,7 @@ import (
 type UpdateState int
 type UploadState int
 type DownloadState int
+type VerifyState int
 type BuildState string
 
 const (
@@ -40,12 +42,45 @@ const (
 	DownloadNotFound
 )
 
+const (
+	VerifySucceeded VerifyState = iota
+	// VerifyForbidden is returned when the token is rejected by GitLab,
+	// e.g. when the runner was removed
+	VerifyForbidden
+	VerifyFailed
+)
+
 type FeaturesInfo struct {
 	Variables bool `json:"variables"`
 	Image     bool `json:"image"`
 	Services  bool `json:"services"`
-	Artifacts bool `json:"features"`
+	Artifacts bool `json:"artifacts"`
 	Cache     bool `json:"cache"`
+	// Steps is set when the shell runs the steps sent by GitLab, instead
+	// of the commands of the build
+	Steps bool `json:"steps"`
+}
+
+// Enabled returns the names of the enabled features, as sent to GitLab
+func (f *FeaturesInfo) Enabled() (names []string) {
+	features := []struct {
+		name    string
+		enabled bool
+	}{
+		{"variables", f.Variables},
+		{"image", f.Image},
+		{"services", f.Services},
+		{"artifacts", f.Artifacts},
+		{"cache", f.Cache},
+		{"steps", f.Steps},
+	}
+
+	for _, feature := range features {
+		if feature.enabled {
+			names = append(names, feature.name)
+		}
+	}
+	return
 }
 
 type VersionInfo struct {
@@ -97,6 +132,7 @@ type GetBuildResponse struct {
 	Stage           string         `json:"stage"`
 	Tag             bool           `json:"tag"`
 	DependsOnBuilds []BuildInfo    `json:"depends_on_builds"`
+	Steps           []Step         `json:"steps,omitempty"`
 	TLSCAChain      string         `json:"-"`
 
 	Credentials []BuildResponseCredentials `json:"credentials,omitempty"`
@@ -133,6 +169,16 @@ type VerifyRunnerRequest struct {
 	Token string `json:"token,omitempty"`
 }
 
+// RunnerAuthenticationTokenPrefix is the prefix of the authentication tokens
+// of the runners created in GitLab, used instead of the registration tokens
+const RunnerAuthenticationTokenPrefix = "glrt-"
+
+type VerifyRunnerTokenResponse struct {
+	ID             int        `json:"id"`
+	Token          string     `json:"token,omitempty"`
+	TokenExpiresAt *time.Time `json:"token_expires_at,omitempty"`
+}
+
 type UpdateBuildRequest struct {
 	Info  VersionInfo `json:"info,omitempty"`
 	Token string      `json:"token,omitempty"`
@@ -141,10 +187,12 @@ type UpdateBuildRequest struct {
 }
 
 type BuildCredentials struct {
-	ID        int    `long:"id" env:"CI_BUILD_ID" description:"The build ID to upload artifacts for"`
-	Token     string `long:"token" env:"CI_BUILD_TOKEN" required:"true" description:"Build token"`
-	URL       string `long:"url" env:"CI_SERVER_URL" required:"true" description:"GitLab CI URL"`
-	TLSCAFile string `long:"tls-ca-file" env:"CI_SERVER_TLS_CA_FILE" description:"File containing the certificates to verify the peer when using HTTPS"`
+	ID          int    `long:"id" env:"CI_BUILD_ID" description:"The build ID to upload artifacts for"`
+	Token       string `long:"token" env:"CI_BUILD_TOKEN" required:"true" description:"Build token"`
+	URL         string `long:"url" env:"CI_SERVER_URL" required:"true" description:"GitLab CI URL"`
+	TLSCAFile   string `long:"tls-ca-file" env:"CI_SERVER_TLS_CA_FILE" description:"File containing the certificates to verify the peer when using HTTPS"`
+	TLSCertFile string `long:"tls-cert-file" env:"CI_SERVER_TLS_CERT_FILE" description:"File containing the certificate to authenticate with the peer when using HTTPS"`
+	TLSKeyFile  string `long:"tls-key-file" env:"CI_SERVER_TLS_KEY_FILE" description:"File containing the private key to authenticate with the peer when using HTTPS"`
 }
 
 type BuildTrace interface {
@@ -167,11 +215,13 @@ type Network interface {
 	GetBuild(config RunnerConfig) (*GetBuildResponse, bool)
 	RegisterRunner(config RunnerCredentials, description, tags string, runUntagged bool) *RegisterRunnerResponse
 	DeleteRunner(config RunnerCredentials) bool
-	VerifyRunner(config RunnerCredentials) bool
+	VerifyRunner(config RunnerCredentials) VerifyState
+	VerifyRunnerToken(config RunnerCredentials) (*VerifyRunnerTokenResponse, VerifyState)
 	UpdateBuild(config RunnerConfig, id int, state BuildState, trace *string) UpdateState
 	PatchTrace(config RunnerConfig, buildCredentials *BuildCredentials, tracePart BuildTracePatch) UpdateState
 	DownloadArtifacts(config BuildCredentials, artifactsFile string) DownloadState
 	UploadRawArtifacts(config BuildCredentials, reader io.Reader, baseName string, expireIn string) UploadState
 	UploadArtifacts(config BuildCredentials, artifactsFile string) UploadState
 	ProcessBuild(config RunnerConfig, buildCredentials *BuildCredentials) BuildTrace
+	ResetClients()
 }
@@ -0,0 +1,137 @@
+package common
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+// GetServiceAliases returns the host names of the service, which are the
+// name of its image without the tag, with `/` replaced by `__` or `-`
+func GetServiceAliases(image string) []string {
+	name := image
+	if i := strings.Index(name, "@"); i >= 0 {
+		name = name[:i]
+	}
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name = name[:i]
+	}
+
+	aliases := []string{strings.Replace(name, "/", "__", -1)}
+	if alternativeName := strings.Replace(name, "/", "-", -1); alternativeName != aliases[0] {
+		aliases = append(aliases, alternativeName)
+	}
+	return aliases
+}
+
+func (c *RunnerCredentials) HasProxy() bool {
+	return c.HTTPProxy != "" || c.HTTPSProxy != ""
+}
+
+func splitNoProxy(noProxy string) (hosts []string) {
+	for _, host := range strings.Split(noProxy, ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	return
+}
+
+func isNoProxy(noProxy []string, host string) bool {
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+
+	for _, entry := range noProxy {
+		entry = strings.TrimPrefix(entry, ".")
+		if entry == "*" || host == entry || strings.HasSuffix(host, "."+entry) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetProxy returns the proxy of the requests of the scheme to the host, or
+// an empty string when the host is in no_proxy
+func (c *RunnerCredentials) GetProxy(scheme, host string) string {
+	if isNoProxy(splitNoProxy(c.NoProxy), host) {
+		return ""
+	}
+
+	if scheme == "https" && c.HTTPSProxy != "" {
+		return c.HTTPSProxy
+	}
+	return c.HTTPProxy
+}
+
+func (b *Build) getServices() (services []string) {
+	if b.Runner.Docker != nil {
+		services = append(services, b.Runner.Docker.Services...)
+	}
+	if b.Runner.Podman != nil {
+		services = append(services, b.Runner.Podman.Services...)
+	}
+
+	var buildServices []string
+	if b.Options.Decode(&buildServices, "services") == nil {
+		services = append(services, buildServices...)
+	}
+	return
+}
+
+// urlHostname returns the host of the URL without the port and the brackets
+// of the IPv6 addresses
+func urlHostname(u *url.URL) string {
+	if host, _, err := net.SplitHostPort(u.Host); err == nil {
+		return host
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(u.Host, "["), "]")
+}
+
+// getNoProxy returns the no_proxy of the runner, with the local host, the
+// GitLab host and the aliases of the services of the build, which are
+// requested directly
+func (b *Build) getNoProxy() string {
+	noProxy := splitNoProxy(b.Runner.NoProxy)
+	noProxy = append(noProxy, "localhost", "127.0.0.1")
+
+	if serverURL, err := url.Parse(b.Runner.URL); err == nil && serverURL.Host != "" {
+		noProxy = append(noProxy, urlHostname(serverURL))
+	}
+	for _, service := range b.getServices() {
+		noProxy = append(noProxy, GetServiceAliases(service)...)
+	}
+
+	var hosts []string
+	seen := make(map[string]bool)
+	for _, host := range noProxy {
+		if !seen[host] {
+			seen[host] = true
+			hosts = append(hosts, host)
+		}
+	}
+	return strings.Join(hosts, ",")
+}
+
+// GetProxyVariables returns the proxy variables of the runner, in lower and
+// upper case as the tools read either
+func (b *Build) GetProxyVariables() (variables BuildVariables) {
+	if b.Runner == nil || !b.Runner.HasProxy() {
+		return
+	}
+
+	values := map[string]string{
+		"http_proxy":  b.Runner.HTTPProxy,
+		"https_proxy": b.Runner.HTTPSProxy,
+		"no_proxy":    b.getNoProxy(),
+	}
+	for _, key := range []string{"http_proxy", "https_proxy", "no_proxy"} {
+		if values[key] == "" {
+			continue
+		}
+		variables = append(variables,
+			BuildVariable{Key: key, Value: values[key], Internal: true},
+			BuildVariable{Key: strings.ToUpper(key), Value: values[key], Internal: true})
+	}
+	return
+}
@@ -0,0 +1,79 @@
+package common
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetServiceAliases(t *testing.T) {
+	tests := map[string][]string{
+		"mysql":                          {"mysql"},
+		"mysql:5.7":                      {"mysql"},
+		"tutum/wordpress:latest":         {"tutum__wordpress", "tutum-wordpress"},
+		"registry.example.com:5000/pg":   {"registry.example.com:5000__pg", "registry.example.com:5000-pg"},
+		"postgres@sha256:0123456789abcd": {"postgres"},
+	}
+
+	for image, expected := range tests {
+		assert.Equal(t, expected, GetServiceAliases(image), image)
+	}
+}
+
+func TestGetProxy(t *testing.T) {
+	credentials := RunnerCredentials{
+		HTTPProxy:  "http://proxy.example.com:3128",
+		HTTPSProxy: "http://secure-proxy.example.com:3128",
+		NoProxy:    "internal.example.com, .corp",
+	}
+
+	assert.Equal(t, "http://proxy.example.com:3128", credentials.GetProxy("http", "gitlab.example.com"))
+	assert.Equal(t, "http://secure-proxy.example.com:3128", credentials.GetProxy("https", "gitlab.example.com:443"))
+	assert.Empty(t, credentials.GetProxy("https", "internal.example.com:443"))
+	assert.Empty(t, credentials.GetProxy("https", "gitlab.internal.example.com"))
+	assert.Empty(t, credentials.GetProxy("http", "gitlab.corp"))
+
+	credentials.HTTPSProxy = ""
+	assert.Equal(t, "http://proxy.example.com:3128", credentials.GetProxy("https", "gitlab.example.com"))
+}
+
+func TestURLHostname(t *testing.T) {
+	for host, expected := range map[string]string{
+		"gitlab.example.com":      "gitlab.example.com",
+		"gitlab.example.com:8080": "gitlab.example.com",
+		"[::1]":                   "::1",
+		"[::1]:8080":              "::1",
+	} {
+		assert.Equal(t, expected, urlHostname(&url.URL{Host: host}), host)
+	}
+}
+
+func TestGetProxyVariables(t *testing.T) {
+	build := &Build{
+		Runner: &RunnerConfig{
+			RunnerCredentials: RunnerCredentials{
+				URL:       "https://gitlab.example.com/",
+				HTTPProxy: "http://proxy.example.com:3128",
+				NoProxy:   "internal.example.com",
+			},
+			RunnerSettings: RunnerSettings{
+				Docker:      &DockerConfig{Services: []string{"mysql:5.7"}},
+				Environment: []string{"NO_PROXY=overwritten"},
+			},
+		},
+	}
+	build.Options = BuildOptions{"services": []interface{}{"tutum/wordpress:latest"}}
+
+	variables := build.GetProxyVariables()
+	assert.Equal(t, "http://proxy.example.com:3128", variables.Get("http_proxy"))
+	assert.Equal(t, "http://proxy.example.com:3128", variables.Get("HTTP_PROXY"))
+	assert.Empty(t, variables.Get("https_proxy"))
+	assert.Equal(t, "internal.example.com,localhost,127.0.0.1,gitlab.example.com,mysql,tutum__wordpress,tutum-wordpress",
+		variables.Get("no_proxy"))
+
+	assert.Equal(t, "overwritten", build.GetAllVariables().Get("NO_PROXY"))
+
+	build.Runner.HTTPProxy = ""
+	assert.Empty(t, build.GetProxyVariables())
+}
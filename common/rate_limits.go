@@ -0,0 +1,34 @@
+package common
+
+import (
+	"sync"
+	"time"
+)
+
+var rateLimitsLock sync.RWMutex
+var rateLimits = make(map[string]time.Time)
+
+// SetRateLimited pauses the requests to the GitLab instance until the time,
+// after it answered 429 Too Many Requests
+func SetRateLimited(url string, until time.Time) {
+	rateLimitsLock.Lock()
+	defer rateLimitsLock.Unlock()
+
+	if until.After(rateLimits[url]) {
+		rateLimits[url] = until
+	}
+}
+
+// RateLimitedUntil returns the time until which the requests to the GitLab
+// instance are paused, it's in the past when they aren't
+func RateLimitedUntil(url string) time.Time {
+	rateLimitsLock.RLock()
+	defer rateLimitsLock.RUnlock()
+
+	return rateLimits[url]
+}
+
+// IsRateLimited returns if the requests to the GitLab instance are paused
+func IsRateLimited(url string) bool {
+	return time.Now().Before(RateLimitedUntil(url))
+}
@@ -0,0 +1,20 @@
+package common
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimited(t *testing.T) {
+	url := "https://rate-limited.example.com/"
+	assert.False(t, IsRateLimited(url))
+
+	SetRateLimited(url, time.Now().Add(time.Minute))
+	assert.True(t, IsRateLimited(url))
+
+	// an earlier limit doesn't shorten the pause
+	SetRateLimited(url, time.Now())
+	assert.True(t, IsRateLimited(url))
+}
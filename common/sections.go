@@ -0,0 +1,32 @@
+package common
+
+import (
+	"fmt"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers"
+)
+
+// collapsedStages are the headers of the stages run by the runner for the
+// user, like the ones fetching the sources or handling the cache. Their
+// output is collapsed in the trace, so it doesn't bury the output of the
+// scripts of the user.
+var collapsedStages = map[BuildStage]string{
+	BuildStagePrepare:           "Preparing the build environment",
+	BuildStageGetSources:        "Getting the sources",
+	BuildStageDownloadArtifacts: "Downloading the artifacts",
+	BuildStageRestoreCache:      "Restoring the cache",
+	BuildStageArchiveCache:      "Saving the cache",
+	BuildStageUploadArtifacts:   "Uploading the artifacts",
+}
+
+// startSection writes the marker of the start of the collapsed section,
+// hidden by the erase line sequence, followed by its header
+func (b *Build) startSection(name BuildStage, header string) {
+	fmt.Fprintf(b.Trace, "section_start:%d:%s[collapsed=true]\r%s%s%s%s\n",
+		time.Now().Unix(), name, helpers.ANSI_CLEAR, helpers.ANSI_BOLD_CYAN, header, helpers.ANSI_RESET)
+}
+
+func (b *Build) endSection(name BuildStage) {
+	fmt.Fprintf(b.Trace, "section_end:%d:%s\r%s\n", time.Now().Unix(), name, helpers.ANSI_CLEAR)
+}
@@ -43,6 +43,11 @@ type ShellScriptInfo struct {
 	PreCloneScript  string
 	PreBuildScript  string
 	PostBuildScript string
+
+	// MaskedVariablesInEnvironment is set by the executors passing the
+	// environment of the shell configuration to the shell, so the masked
+	// variables are given there instead of being exported by the scripts
+	MaskedVariablesInEnvironment bool
 }
 
 type Shell interface {
@@ -0,0 +1,72 @@
+package common
+
+import (
+	"fmt"
+	"time"
+)
+
+// BuildStageStepPrefix prefixes the stages running the steps of the build
+const BuildStageStepPrefix = "step_"
+
+// Step is a step of the build, sent by GitLab instead of the commands. Every
+// step is run as its own stage, with its own variables.
+type Step struct {
+	Name             string         `json:"name"`
+	Script           []string       `json:"script"`
+	Variables        BuildVariables `json:"variables"`
+	WorkingDirectory string         `json:"working_directory"`
+}
+
+// StepStage returns the stage running the step
+func StepStage(name string) BuildStage {
+	return BuildStage(BuildStageStepPrefix + name)
+}
+
+// GetStep returns the step run by the stage, or nil when it's not the stage
+// of a step
+func (b *Build) GetStep(stage BuildStage) *Step {
+	for i := range b.Steps {
+		if StepStage(b.Steps[i].Name) == stage {
+			return &b.Steps[i]
+		}
+	}
+	return nil
+}
+
+func (b *Build) validateSteps() error {
+	names := make(map[string]bool)
+	for i, step := range b.Steps {
+		if step.Name == "" {
+			return fmt.Errorf("Missing name of step %d", i+1)
+		}
+		if names[step.Name] {
+			return fmt.Errorf("Duplicate step %q", step.Name)
+		}
+		names[step.Name] = true
+	}
+	return nil
+}
+
+// executeSteps runs the steps in order, until one of them fails
+func (b *Build) executeSteps(executor Executor, abort chan interface{}) error {
+	err := b.validateSteps()
+	if err != nil {
+		return &BuildError{Inner: err}
+	}
+
+	logger := NewBuildLogger(b.Trace, b.Log())
+	for _, step := range b.Steps {
+		logger.Println("Running step", step.Name+"...")
+
+		started := time.Now()
+		err = b.executeStage(StepStage(step.Name), executor, abort)
+		duration := fmt.Sprintf("%.1fs", time.Since(started).Seconds())
+
+		if err != nil {
+			logger.SoftErrorln("Step", step.Name, "failed after", duration+":", err)
+			return err
+		}
+		logger.Infoln("Step", step.Name, "succeeded in", duration)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package common
+
+import (
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newStepsBuild(steps ...Step) *Build {
+	return &Build{
+		GetBuildResponse: GetBuildResponse{Steps: steps},
+		Runner:           &RunnerConfig{},
+		Trace:            &Trace{Writer: ioutil.Discard},
+	}
+}
+
+func TestGetStep(t *testing.T) {
+	build := newStepsBuild(Step{Name: "build"}, Step{Name: "test"})
+
+	step := build.GetStep(StepStage("test"))
+	if assert.NotNil(t, step) {
+		assert.Equal(t, "test", step.Name)
+	}
+	assert.Nil(t, build.GetStep(BuildStageUserScript))
+	assert.Nil(t, build.GetStep(StepStage("deploy")))
+}
+
+func TestExecuteStepsInvalidSteps(t *testing.T) {
+	build := newStepsBuild(Step{Name: "build"}, Step{Name: "build"})
+	err := build.executeSteps(&MockExecutor{}, nil)
+	assert.EqualError(t, err, `Duplicate step "build"`)
+
+	build = newStepsBuild(Step{Name: "build"}, Step{})
+	err = build.executeSteps(&MockExecutor{}, nil)
+	assert.EqualError(t, err, "Missing name of step 2")
+}
+
+func TestExecuteStepsStopsOnFailure(t *testing.T) {
+	abort := make(chan interface{})
+
+	e := MockExecutor{}
+	defer e.AssertExpectations(t)
+
+	e.On("Shell").Return(&ShellScriptInfo{Shell: "script-shell"})
+	cmd := ExecutorCommand{Script: "script", Abort: abort, Predefined: false}
+	e.On("Run", cmd).Return(nil).Once()
+	e.On("Run", cmd).Return(errors.New("step fail")).Once()
+
+	build := newStepsBuild(Step{Name: "build"}, Step{Name: "test"}, Step{Name: "deploy"})
+	err := build.executeSteps(&e, abort)
+	assert.EqualError(t, err, "step fail")
+	assert.Equal(t, StepStage("test"), build.CurrentStage)
+}
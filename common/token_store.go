@@ -0,0 +1,125 @@
+package common
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// TokenStore keeps the tokens of the runners outside of the config file,
+// e.g. in the keyring of the system. The config file has the reference to
+// the token, prefixed with the name of the store: <store>:<reference>.
+type TokenStore interface {
+	// Load returns the token of the reference
+	Load(config *Config, reference string) (string, error)
+	// Store saves the token and returns its reference
+	Store(config *Config, token string) (string, error)
+}
+
+var tokenStores map[string]TokenStore
+
+func RegisterTokenStore(name string, store TokenStore) {
+	log.Debugln("Registering", name, "token store...")
+
+	if tokenStores == nil {
+		tokenStores = make(map[string]TokenStore)
+	}
+	if tokenStores[name] != nil {
+		panic("Token store already exist: " + name)
+	}
+	tokenStores[name] = store
+}
+
+func GetTokenStore(name string) TokenStore {
+	if tokenStores == nil {
+		return nil
+	}
+
+	return tokenStores[name]
+}
+
+func GetTokenStores() []string {
+	names := []string{}
+	for name := range tokenStores {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// loadToken replaces the reference to the token with the token. The tokens
+// without the prefix of a registered store are kept as they are.
+func (c *RunnerCredentials) loadToken(config *Config) error {
+	parts := strings.SplitN(c.Token, ":", 2)
+	if len(parts) != 2 {
+		return nil
+	}
+
+	store := GetTokenStore(parts[0])
+	if store == nil {
+		return nil
+	}
+
+	token, err := store.Load(config, parts[1])
+	if err != nil {
+		return fmt.Errorf("Failed to load the token %s from the %s token store: %v", parts[1], parts[0], err)
+	}
+
+	c.tokenReference = c.Token
+	c.Token = token
+	return nil
+}
+
+// TokenReference returns the reference saved in the config file instead of
+// the token, or an empty string if the token is saved in the config file
+func (c *RunnerCredentials) TokenReference() string {
+	return c.tokenReference
+}
+
+// StoreToken saves the token of the runner in the token store, the config
+// file gets its reference when it's saved
+func (c *Config) StoreToken(runner *RunnerConfig, name string) error {
+	store := GetTokenStore(name)
+	if store == nil {
+		return fmt.Errorf("Unknown token store: %s, supported: %s", name, strings.Join(GetTokenStores(), ", "))
+	}
+
+	reference, err := store.Store(c, runner.Token)
+	if err != nil {
+		return fmt.Errorf("Failed to save the token in the %s token store: %v", name, err)
+	}
+
+	runner.tokenReference = name + ":" + reference
+	return nil
+}
+
+func (c *Config) loadTokens() error {
+	for _, runner := range c.Runners {
+		err := runner.loadToken(c)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// withTokenReferences calls f with the references to the tokens in place of
+// the tokens, so they are not written to the config file
+func (c *Config) withTokenReferences(f func() error) error {
+	tokens := make([]string, len(c.Runners))
+	for i, runner := range c.Runners {
+		tokens[i] = runner.Token
+		if runner.tokenReference != "" {
+			runner.Token = runner.tokenReference
+		}
+	}
+
+	defer func() {
+		for i, runner := range c.Runners {
+			runner.Token = tokens[i]
+		}
+	}()
+	return f()
+}
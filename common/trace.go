@@ -3,6 +3,8 @@ package common
 import (
 	"io"
 	"os"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers"
 )
 
 type Trace struct {
@@ -30,3 +32,21 @@ func (s *Trace) Aborted() chan interface{} {
 func (s *Trace) IsStdout() bool {
 	return true
 }
+
+// maskedTrace replaces the secrets with [MASKED] in the output of the build,
+// Close writes the rest of the output
+type maskedTrace struct {
+	BuildTrace
+	*helpers.MaskWriter
+}
+
+func newMaskedTrace(trace BuildTrace, secrets []string) *maskedTrace {
+	return &maskedTrace{
+		BuildTrace: trace,
+		MaskWriter: helpers.NewMaskWriter(trace, secrets),
+	}
+}
+
+func (t *maskedTrace) Write(p []byte) (int, error) {
+	return t.MaskWriter.Write(p)
+}
@@ -0,0 +1,21 @@
+package common
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaskedTrace(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	trace := newMaskedTrace(&Trace{Writer: buffer}, []string{"super-secret"})
+
+	trace.Write([]byte("+ curl -H super-"))
+	trace.Write([]byte("secret https://example.com\n+ echo super-sec"))
+	assert.Equal(t, "+ curl -H [MASKED] https://example.com\n", buffer.String())
+
+	trace.Close()
+	assert.Equal(t, "+ curl -H [MASKED] https://example.com\n+ echo super-sec", buffer.String())
+	assert.True(t, trace.IsStdout())
+}
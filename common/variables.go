@@ -13,6 +13,7 @@ type BuildVariable struct {
 	Public   bool   `json:"public"`
 	Internal bool   `json:"-"`
 	File     bool   `json:"file"`
+	Masked   bool   `json:"masked"`
 }
 
 type BuildVariables []BuildVariable
@@ -30,6 +31,29 @@ func (b BuildVariables) PublicOrInternal() (variables BuildVariables) {
 	return variables
 }
 
+// WithoutFiles returns the variables, but the file ones. Their values are
+// written to files by the scripts, which set the variables to the paths of
+// the files, so they're left out of the environment of the containers.
+func (b BuildVariables) WithoutFiles() (variables BuildVariables) {
+	for _, variable := range b {
+		if !variable.File {
+			variables = append(variables, variable)
+		}
+	}
+	return variables
+}
+
+// Masked returns the masked variables. The executors which support it pass
+// them in the environment of the shell, so the scripts never print them.
+func (b BuildVariables) Masked() (variables BuildVariables) {
+	for _, variable := range b {
+		if variable.Masked {
+			variables = append(variables, variable)
+		}
+	}
+	return variables
+}
+
 func (b BuildVariables) StringList() (variables []string) {
 	for _, variable := range b {
 		variables = append(variables, variable.String())
@@ -52,13 +76,80 @@ func (b BuildVariables) Get(key string) string {
 	return ""
 }
 
+// variablesExpander resolves the references to the variables in the values,
+// recursively. A variable referencing itself, like PATH=/opt/bin:$PATH, gets
+// the previous value of the variable, and the references closing a cycle
+// are left unexpanded. $$ is expanded to $ once, in any value.
+type variablesExpander struct {
+	variables BuildVariables
+	values    map[int]string
+	resolving map[int]bool
+}
+
+func newVariablesExpander(variables BuildVariables) *variablesExpander {
+	return &variablesExpander{
+		variables: variables,
+		values:    make(map[int]string),
+		resolving: make(map[int]bool),
+	}
+}
+
+// lookup returns the index of the variable the key references in the value
+// of the variable at the index, or -1 when it's not defined
+func (e *variablesExpander) lookup(key string, from int) int {
+	end := len(e.variables)
+	if from >= 0 && e.variables[from].Key == key {
+		end = from
+	}
+	for i := end - 1; i >= 0; i-- {
+		if e.variables[i].Key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func (e *variablesExpander) expand(value string, from int) string {
+	return os.Expand(value, func(key string) string {
+		switch key {
+		case "$":
+			return key
+		case "*", "#", "@", "!", "?", "0", "1", "2", "3", "4", "5", "6", "7", "8", "9":
+			return ""
+		}
+
+		i := e.lookup(key, from)
+		if i < 0 {
+			return ""
+		}
+		return e.resolve(i)
+	})
+}
+
+func (e *variablesExpander) resolve(i int) string {
+	if value, ok := e.values[i]; ok {
+		return value
+	}
+	if e.resolving[i] {
+		return "$" + e.variables[i].Key
+	}
+
+	e.resolving[i] = true
+	value := e.expand(e.variables[i].Value, i)
+	delete(e.resolving, i)
+
+	e.values[i] = value
+	return value
+}
+
 func (b BuildVariables) ExpandValue(value string) string {
-	return os.Expand(value, b.Get)
+	return newVariablesExpander(b).expand(value, -1)
 }
 
 func (b BuildVariables) Expand() (variables BuildVariables) {
-	for _, variable := range b {
-		variable.Value = b.ExpandValue(variable.Value)
+	expander := newVariablesExpander(b)
+	for i, variable := range b {
+		variable.Value = expander.resolve(i)
 		variables = append(variables, variable)
 	}
 	return variables
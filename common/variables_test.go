@@ -21,14 +21,14 @@ func TestVariablesJSON(t *testing.T) {
 }
 
 func TestVariableString(t *testing.T) {
-	v := BuildVariable{"key", "value", false, false, false}
+	v := BuildVariable{"key", "value", false, false, false, false}
 	assert.Equal(t, "key=value", v.String())
 }
 
 func TestPublicAndInternalVariables(t *testing.T) {
-	v1 := BuildVariable{"key", "value", false, false, false}
-	v2 := BuildVariable{"public", "value", true, false, false}
-	v3 := BuildVariable{"private", "value", false, true, false}
+	v1 := BuildVariable{"key", "value", false, false, false, false}
+	v2 := BuildVariable{"public", "value", true, false, false, false}
+	v3 := BuildVariable{"private", "value", false, true, false, false}
 	all := BuildVariables{v1, v2, v3}
 	public := all.PublicOrInternal()
 	assert.NotContains(t, public, v1)
@@ -36,15 +36,26 @@ func TestPublicAndInternalVariables(t *testing.T) {
 	assert.Contains(t, public, v3)
 }
 
+func TestVariablesWithoutFiles(t *testing.T) {
+	all := BuildVariables{
+		{Key: "KUBECONFIG", Value: "apiVersion: v1", File: true},
+		{Key: "KUBE_NAMESPACE", Value: "production"},
+	}
+
+	variables := all.WithoutFiles()
+	assert.Len(t, variables, 1)
+	assert.Equal(t, "KUBE_NAMESPACE", variables[0].Key)
+}
+
 func TestListVariables(t *testing.T) {
-	v := BuildVariables{{"key", "value", false, false, false}}
+	v := BuildVariables{{"key", "value", false, false, false, false}}
 	assert.Equal(t, []string{"key=value"}, v.StringList())
 }
 
 func TestGetVariable(t *testing.T) {
-	v1 := BuildVariable{"key", "key_value", false, false, false}
-	v2 := BuildVariable{"public", "public_value", true, false, false}
-	v3 := BuildVariable{"private", "private_value", false, false, false}
+	v1 := BuildVariable{"key", "key_value", false, false, false, false}
+	v2 := BuildVariable{"public", "public_value", true, false, false, false}
+	v3 := BuildVariable{"private", "private_value", false, false, false, false}
 	all := BuildVariables{v1, v2, v3}
 
 	assert.Equal(t, "public_value", all.Get("public"))
@@ -54,7 +65,7 @@ func TestGetVariable(t *testing.T) {
 func TestParseVariable(t *testing.T) {
 	v, err := ParseVariable("key=value=value2")
 	assert.NoError(t, err)
-	assert.Equal(t, BuildVariable{"key", "value=value2", false, false, false}, v)
+	assert.Equal(t, BuildVariable{"key", "value=value2", false, false, false, false}, v)
 }
 
 func TestInvalidParseVariable(t *testing.T) {
@@ -64,26 +75,55 @@ func TestInvalidParseVariable(t *testing.T) {
 
 func TestVariablesExpansion(t *testing.T) {
 	all := BuildVariables{
-		{"key", "value_of_$public", false, false, false},
-		{"public", "some_value", true, false, false},
-		{"private", "value_of_${public}", false, false, false},
-		{"public", "value_of_$undefined", true, false, false},
+		{"key", "value_of_$public", false, false, false, false},
+		{"public", "some_value", true, false, false, false},
+		{"private", "value_of_${public}", false, false, false, false},
+		{"public", "value_of_$undefined", true, false, false, false},
 	}
 
 	expanded := all.Expand()
 	assert.Len(t, expanded, 4)
-	assert.Equal(t, expanded.Get("key"), "value_of_value_of_$undefined")
+	assert.Equal(t, expanded.Get("key"), "value_of_value_of_")
 	assert.Equal(t, expanded.Get("public"), "value_of_")
-	assert.Equal(t, expanded.Get("private"), "value_of_value_of_$undefined")
-	assert.Equal(t, expanded.ExpandValue("${public} ${private}"), "value_of_ value_of_value_of_$undefined")
+	assert.Equal(t, expanded.Get("private"), "value_of_value_of_")
+	assert.Equal(t, expanded.ExpandValue("${public} ${private}"), "value_of_ value_of_value_of_")
+}
+
+func TestVariablesNestedExpansion(t *testing.T) {
+	all := BuildVariables{
+		{Key: "IMAGE", Value: "$REGISTRY/$NAME:$TAG"},
+		{Key: "REGISTRY", Value: "registry.$DOMAIN"},
+		{Key: "DOMAIN", Value: "example.com"},
+		{Key: "NAME", Value: "app"},
+		{Key: "TAG", Value: "v1"},
+		{Key: "TAG", Value: "$TAG-$$HOME"},
+	}
+
+	expanded := all.Expand()
+	assert.Equal(t, "registry.example.com/app:v1-$HOME", expanded.Get("IMAGE"))
+	assert.Equal(t, "v1-$HOME", expanded.Get("TAG"))
+	assert.Equal(t, "registry.example.com/app:v1-$HOME", all.ExpandValue("$IMAGE"))
+	assert.Equal(t, "$HOME", all.ExpandValue("$$HOME"))
+}
+
+func TestVariablesCycleExpansion(t *testing.T) {
+	all := BuildVariables{
+		{Key: "A", Value: "a-$B"},
+		{Key: "B", Value: "b-$A"},
+		{Key: "PATH", Value: "/opt/bin:$PATH"},
+	}
+
+	expanded := all.Expand()
+	assert.Equal(t, "a-b-$A", expanded.Get("A"))
+	assert.Equal(t, "/opt/bin:", expanded.Get("PATH"))
 }
 
 func TestSpecialVariablesExpansion(t *testing.T) {
 	all := BuildVariables{
-		{"key", "$$", false, false, false},
-		{"key2", "$/dsa", true, false, false},
-		{"key3", "aa$@bb", false, false, false},
-		{"key4", "aa${@}bb", false, false, false},
+		{"key", "$$", false, false, false, false},
+		{"key2", "$/dsa", true, false, false, false},
+		{"key3", "aa$@bb", false, false, false, false},
+		{"key4", "aa${@}bb", false, false, false, false},
 	}
 
 	expanded := all.Expand()
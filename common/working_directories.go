@@ -0,0 +1,51 @@
+package common
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// GetWorkingDirectory returns the directory the stage runs in, relative to
+// the project directory, e.g. a subdirectory of a monorepo. It's set by the
+// working_directory of the step, by the working_directories option of the
+// job or by the working_directories of the runner, in this order. It returns
+// an empty string for the stages running in the project directory.
+func (b *Build) GetWorkingDirectory(stage BuildStage) (string, error) {
+	var directory string
+	if step := b.GetStep(stage); step != nil && step.WorkingDirectory != "" {
+		directory = step.WorkingDirectory
+	} else if directories, err := b.getJobWorkingDirectories(); err != nil {
+		return "", err
+	} else if dir, ok := directories[string(stage)]; ok {
+		directory = dir
+	} else if b.Runner != nil {
+		directory = b.Runner.WorkingDirectories[string(stage)]
+	}
+
+	directory = b.GetAllVariables().ExpandValue(directory)
+	if directory == "" {
+		return "", nil
+	}
+
+	directory = path.Clean(strings.Replace(directory, "\\", "/", -1))
+	if path.IsAbs(directory) || strings.Contains(directory, ":") ||
+		directory == ".." || strings.HasPrefix(directory, "../") {
+		return "", fmt.Errorf("Working directory of %s must be inside the project directory: %s", stage, directory)
+	}
+	if directory == "." {
+		return "", nil
+	}
+	return directory, nil
+}
+
+func (b *Build) getJobWorkingDirectories() (map[string]string, error) {
+	options := struct {
+		WorkingDirectories map[string]string `json:"working_directories"`
+	}{}
+	err := b.Options.Decode(&options)
+	if err != nil {
+		return nil, err
+	}
+	return options.WorkingDirectories, nil
+}
@@ -0,0 +1,49 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetWorkingDirectory(t *testing.T) {
+	build := &Build{
+		GetBuildResponse: GetBuildResponse{
+			Options: BuildOptions{"working_directories": map[string]interface{}{
+				"build_script": "services/$SERVICE/",
+				"after_script": ".",
+			}},
+			Variables: BuildVariables{{Key: "SERVICE", Value: "api"}},
+			Steps:     []Step{{Name: "lint", WorkingDirectory: `web\app`}},
+		},
+		Runner: &RunnerConfig{RunnerSettings: RunnerSettings{
+			WorkingDirectories: map[string]string{"after_script": "tools", "step_test": "tests"},
+		}},
+	}
+
+	tests := map[BuildStage]string{
+		BuildStageUserScript:   "services/api",
+		BuildStageAfterScript:  "",
+		StepStage("lint"):      "web/app",
+		StepStage("test"):      "tests",
+		BuildStageArchiveCache: "",
+	}
+
+	for stage, expected := range tests {
+		dir, err := build.GetWorkingDirectory(stage)
+		assert.NoError(t, err, string(stage))
+		assert.Equal(t, expected, dir, string(stage))
+	}
+}
+
+func TestGetWorkingDirectoryOutsideOfProject(t *testing.T) {
+	for _, dir := range []string{"..", "../other", "a/../../other", "/builds", `C:\builds`} {
+		build := &Build{
+			GetBuildResponse: GetBuildResponse{Steps: []Step{{Name: "lint", WorkingDirectory: dir}}},
+			Runner:           &RunnerConfig{},
+		}
+
+		_, err := build.GetWorkingDirectory(StepStage("lint"))
+		assert.Error(t, err, dir)
+	}
+}
@@ -0,0 +1,250 @@
+package custom
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers"
+)
+
+const (
+	// buildFailureExitCode is the exit code of the executables reporting
+	// a failure of the job, like a failed script
+	buildFailureExitCode = 1
+	// systemFailureExitCode is the exit code of the executables reporting
+	// a failure of the environment, like a missing VM
+	systemFailureExitCode = 2
+
+	defaultExecTimeout = 3600
+
+	// customEnvPrefix is prepended to the names of the variables of the job,
+	// so they don't change the behaviour of the executables
+	customEnvPrefix = "CUSTOM_ENV_"
+)
+
+type executor struct {
+	executors.AbstractExecutor
+	options     customOptions
+	tempDir     string
+	contextFile string
+}
+
+func getExecTimeout(timeout int) time.Duration {
+	if timeout <= 0 {
+		timeout = defaultExecTimeout
+	}
+	return time.Duration(timeout) * time.Second
+}
+
+// getEnv returns the environment of the executables: the variables of the
+// job with the CUSTOM_ENV_ prefix, the names of the masked ones, which the
+// scripts don't export, the path of the job context and the exit codes
+// reporting failures
+func (s *executor) getEnv() []string {
+	env := os.Environ()
+	var masked []string
+	for _, variable := range s.Build.GetAllVariables() {
+		env = append(env, customEnvPrefix+variable.Key+"="+variable.Value)
+		if variable.Masked {
+			masked = append(masked, variable.Key)
+		}
+	}
+
+	return append(env,
+		"MASKED_VARIABLES="+strings.Join(masked, " "),
+		"JOB_CONTEXT="+s.contextFile,
+		fmt.Sprintf("BUILD_FAILURE_EXIT_CODE=%d", buildFailureExitCode),
+		fmt.Sprintf("SYSTEM_FAILURE_EXIT_CODE=%d", systemFailureExitCode),
+	)
+}
+
+// runExec runs the executable and maps its exit code to a build or
+// a system failure. When timeout is 0, the executable can run until it's
+// aborted.
+func (s *executor) runExec(name string, c *exec.Cmd, output io.Writer, timeout time.Duration, abort chan interface{}) error {
+	helpers.SetProcessGroup(c)
+	defer helpers.KillProcessGroup(c)
+
+	c.Env = s.getEnv()
+	c.Stdout = output
+	c.Stderr = output
+
+	if err := c.Start(); err != nil {
+		return fmt.Errorf("failed to start %s: %v", name, err)
+	}
+
+	waitCh := make(chan error, 1)
+	go func() {
+		waitCh <- c.Wait()
+	}()
+
+	var timeoutCh <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutCh = timer.C
+	}
+
+	var err error
+	select {
+	case err = <-waitCh:
+	case <-timeoutCh:
+		helpers.KillProcessGroup(c)
+		<-waitCh
+		return fmt.Errorf("%s timed out after %v", name, timeout)
+	case <-abort:
+		helpers.KillProcessGroup(c)
+		<-waitCh
+		return errors.New("Aborted")
+	}
+
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok {
+		return err
+	}
+
+	exitCode := -1
+	if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+		exitCode = status.ExitStatus()
+	}
+	switch exitCode {
+	case buildFailureExitCode:
+		return &common.BuildError{Inner: fmt.Errorf("exit code %d", exitCode)}
+	case systemFailureExitCode:
+		return fmt.Errorf("%s reported a system failure", name)
+	default:
+		return fmt.Errorf("%s failed with unknown exit code %d", name, exitCode)
+	}
+}
+
+func (s *executor) Prepare(globalConfig *common.Config, config *common.RunnerConfig, build *common.Build) error {
+	if config.Custom == nil {
+		return errors.New("Missing custom configuration")
+	}
+	if config.Custom.RunExec == "" {
+		return errors.New("Missing run_exec of the custom executor")
+	}
+
+	err := s.AbstractExecutor.Prepare(globalConfig, config, build)
+	if err != nil {
+		return err
+	}
+
+	if err = build.Options.Decode(&s.options); err != nil {
+		return err
+	}
+
+	s.tempDir, err = ioutil.TempDir("", "custom-executor")
+	if err != nil {
+		return err
+	}
+
+	s.contextFile, err = writeJobContext(s.tempDir, newJobContext(build, s.options))
+	if err != nil {
+		return err
+	}
+
+	s.Println("Using Custom executor...")
+
+	if s.Config.Custom.PrepareExec == "" {
+		return nil
+	}
+
+	c := exec.Command(s.Config.Custom.PrepareExec, s.Config.Custom.PrepareArgs...)
+	timeout := getExecTimeout(s.Config.Custom.PrepareExecTimeout)
+	return s.runExec("prepare_exec", c, s.BuildTrace, timeout, build.Trace.Aborted())
+}
+
+func (s *executor) Run(cmd common.ExecutorCommand) error {
+	stage := "build"
+	if cmd.Predefined {
+		stage = "predefined"
+	}
+
+	scriptFile := filepath.Join(s.tempDir, "script."+s.BuildShell.Extension)
+	if s.BuildShell.Extension == "" {
+		scriptFile = filepath.Join(s.tempDir, "script")
+	}
+	script := []byte(cmd.Script)
+	if s.Config.Custom.Base64Scripts {
+		script = helpers.ToBase64Lines(script)
+	}
+
+	err := ioutil.WriteFile(scriptFile, script, 0700)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(scriptFile)
+
+	args := append(append([]string{}, s.Config.Custom.RunArgs...), scriptFile, stage)
+	c := exec.Command(s.Config.Custom.RunExec, args...)
+
+	// the job timeout applies to the scripts
+	return s.runExec("run_exec", c, s.BuildTrace, 0, cmd.Abort)
+}
+
+func (s *executor) Cleanup() {
+	if s.Config.Custom != nil && s.Config.Custom.CleanupExec != "" && s.tempDir != "" {
+		output := new(bytes.Buffer)
+		c := exec.Command(s.Config.Custom.CleanupExec, s.Config.Custom.CleanupArgs...)
+		timeout := getExecTimeout(s.Config.Custom.CleanupExecTimeout)
+
+		err := s.runExec("cleanup_exec", c, output, timeout, nil)
+		if err != nil {
+			s.Warningln("Cleanup failed:", err, strings.TrimSpace(output.String()))
+		}
+	}
+
+	if s.tempDir != "" {
+		os.RemoveAll(s.tempDir)
+	}
+
+	s.AbstractExecutor.Cleanup()
+}
+
+func init() {
+	options := executors.ExecutorOptions{
+		DefaultBuildsDir: "/builds",
+		DefaultCacheDir:  "/cache",
+		SharedBuildsDir:  false,
+		Shell: common.ShellScriptInfo{
+			Shell:                        "bash",
+			Type:                         common.NormalShell,
+			RunnerCommand:                "gitlab-runner",
+			MaskedVariablesInEnvironment: true,
+		},
+		ShowHostname:     false,
+		SupportedOptions: []string{"image", "services"},
+	}
+
+	creator := func() common.Executor {
+		return &executor{
+			AbstractExecutor: executors.AbstractExecutor{
+				ExecutorOptions: options,
+			},
+		}
+	}
+
+	featuresUpdater := func(features *common.FeaturesInfo) {
+		features.Variables = true
+		features.Image = true
+		features.Services = true
+	}
+
+	common.RegisterExecutor("custom", executors.DefaultExecutorProvider{
+		Creator:         creator,
+		FeaturesUpdater: featuresUpdater,
+		DefaultShell:    options.Shell.Shell,
+	})
+}
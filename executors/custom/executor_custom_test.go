@@ -0,0 +1,190 @@
+package custom
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors"
+)
+
+func newTestExecutor(t *testing.T) (*executor, func()) {
+	runner := &common.RunnerConfig{
+		RunnerCredentials: common.RunnerCredentials{Token: "abcdef1234567890"},
+		RunnerSettings: common.RunnerSettings{
+			Custom: &common.CustomConfig{RunExec: "/bin/true"},
+		},
+	}
+	build := &common.Build{
+		GetBuildResponse: common.GetBuildResponse{
+			ID:        10,
+			ProjectID: 20,
+			Name:      "test",
+			Stage:     "build",
+			RepoURL:   "https://gitlab.example.com/group/project.git",
+			Variables: common.BuildVariables{
+				{Key: "SECRET", Value: "value"},
+				{Key: "TOKEN", Value: "masked", Masked: true},
+			},
+		},
+		Runner: runner,
+	}
+	build.StartBuild("/builds", "/cache", false)
+
+	tempDir, err := ioutil.TempDir("", "custom-executor-test")
+	require.NoError(t, err)
+
+	e := &executor{
+		AbstractExecutor: executors.AbstractExecutor{
+			Config: *runner,
+			Build:  build,
+		},
+		tempDir:     tempDir,
+		contextFile: filepath.Join(tempDir, "job_context.json"),
+	}
+	return e, func() {
+		os.RemoveAll(tempDir)
+	}
+}
+
+func writeTestScript(t *testing.T, dir, script string) string {
+	file := filepath.Join(dir, "exec.sh")
+	err := ioutil.WriteFile(file, []byte("#!/bin/sh\n"+script+"\n"), 0700)
+	require.NoError(t, err)
+	return file
+}
+
+func TestGetExecTimeout(t *testing.T) {
+	assert.Equal(t, time.Hour, getExecTimeout(0))
+	assert.Equal(t, 30*time.Second, getExecTimeout(30))
+}
+
+func TestGetEnv(t *testing.T) {
+	e, done := newTestExecutor(t)
+	defer done()
+
+	env := e.getEnv()
+	assert.Contains(t, env, "CUSTOM_ENV_SECRET=value")
+	assert.Contains(t, env, "CUSTOM_ENV_TOKEN=masked")
+	assert.Contains(t, env, "MASKED_VARIABLES=TOKEN")
+	assert.Contains(t, env, "CUSTOM_ENV_CI_BUILD_ID=10")
+	assert.Contains(t, env, "JOB_CONTEXT="+e.contextFile)
+	assert.Contains(t, env, "BUILD_FAILURE_EXIT_CODE=1")
+	assert.Contains(t, env, "SYSTEM_FAILURE_EXIT_CODE=2")
+	assert.NotContains(t, env, "SECRET=value")
+}
+
+func TestRunExec(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Shell scripts are not supported on Windows")
+	}
+
+	tests := []struct {
+		script       string
+		output       string
+		buildFailure bool
+		err          string
+	}{
+		{script: `echo "context: $JOB_CONTEXT"`, output: "context: "},
+		{script: "exit $BUILD_FAILURE_EXIT_CODE", buildFailure: true, err: "exit code 1"},
+		{script: "exit $SYSTEM_FAILURE_EXIT_CODE", err: "run_exec reported a system failure"},
+		{script: "exit 3", err: "run_exec failed with unknown exit code 3"},
+		{script: "sleep 10", err: "run_exec timed out after 100ms"},
+	}
+
+	for _, test := range tests {
+		e, done := newTestExecutor(t)
+		file := writeTestScript(t, e.tempDir, test.script)
+
+		output := new(bytes.Buffer)
+		err := e.runExec("run_exec", exec.Command(file), output, 100*time.Millisecond, nil)
+		done()
+
+		if test.err == "" {
+			assert.NoError(t, err, test.script)
+			assert.Contains(t, output.String(), test.output+e.contextFile, test.script)
+			continue
+		}
+
+		require.Error(t, err, test.script)
+		assert.Equal(t, test.err, err.Error(), test.script)
+		_, isBuildError := err.(*common.BuildError)
+		assert.Equal(t, test.buildFailure, isBuildError, test.script)
+	}
+}
+
+func TestRunExecAbort(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Shell scripts are not supported on Windows")
+	}
+
+	e, done := newTestExecutor(t)
+	defer done()
+	file := writeTestScript(t, e.tempDir, "sleep 10")
+
+	abort := make(chan interface{})
+	close(abort)
+
+	err := e.runExec("run_exec", exec.Command(file), ioutil.Discard, 0, abort)
+	assert.EqualError(t, err, "Aborted")
+}
+
+func TestRunBase64Scripts(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Shell scripts are not supported on Windows")
+	}
+
+	e, done := newTestExecutor(t)
+	defer done()
+
+	output := new(bytes.Buffer)
+	e.BuildTrace = &common.Trace{Writer: output}
+	e.BuildShell = &common.ShellConfiguration{Extension: "sh"}
+	e.Config.Custom.RunExec = writeTestScript(t, e.tempDir, `base64 -d < "$1"`)
+	e.Config.Custom.Base64Scripts = true
+
+	script := "echo `date`\r\necho héllo\n"
+	err := e.Run(common.ExecutorCommand{Script: script})
+	assert.NoError(t, err)
+	assert.Equal(t, script, output.String())
+}
+
+func TestWriteJobContext(t *testing.T) {
+	e, done := newTestExecutor(t)
+	defer done()
+
+	context := newJobContext(e.Build, customOptions{Image: "ruby:$CI_BUILD_ID", Services: []string{"mysql"}})
+	file, err := writeJobContext(e.tempDir, context)
+	require.NoError(t, err)
+	assert.Equal(t, e.contextFile, file)
+
+	info, err := os.Stat(file)
+	require.NoError(t, err)
+	if runtime.GOOS != "windows" {
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+
+	data, err := ioutil.ReadFile(file)
+	require.NoError(t, err)
+
+	var written jobContext
+	require.NoError(t, json.Unmarshal(data, &written))
+	assert.Equal(t, 1, written.Version)
+	assert.Equal(t, jobInfo{ID: 10, Name: "test", Stage: "build"}, written.Job)
+	assert.Equal(t, projectInfo{ID: 20, Dir: "/builds/group/project"}, written.Project)
+	assert.Equal(t, "/builds", written.BuildsDir)
+	assert.Equal(t, "/cache/group/project", written.CacheDir)
+	assert.Equal(t, "ruby:10", written.Image)
+	assert.Equal(t, []string{"mysql"}, written.Services)
+	assert.Contains(t, written.Variables, common.BuildVariable{Key: "SECRET", Value: "value"})
+}
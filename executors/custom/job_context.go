@@ -0,0 +1,94 @@
+package custom
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+// jobContextVersion is increased on incompatible changes of the job context
+const jobContextVersion = 1
+
+// jobContext describes the job to the executables of the custom executor.
+// It's written as JSON to the file given in the JOB_CONTEXT variable.
+type jobContext struct {
+	Version   int                   `json:"version"`
+	Job       jobInfo               `json:"job"`
+	Project   projectInfo           `json:"project"`
+	Runner    runnerInfo            `json:"runner"`
+	BuildsDir string                `json:"builds_dir"`
+	CacheDir  string                `json:"cache_dir"`
+	Image     string                `json:"image,omitempty"`
+	Services  []string              `json:"services,omitempty"`
+	Variables common.BuildVariables `json:"variables"`
+}
+
+type jobInfo struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Stage string `json:"stage"`
+	Ref   string `json:"ref"`
+	Sha   string `json:"sha"`
+	Tag   bool   `json:"tag"`
+}
+
+type projectInfo struct {
+	ID  int    `json:"id"`
+	Dir string `json:"dir"`
+}
+
+type runnerInfo struct {
+	ID          string `json:"id"`
+	Description string `json:"description"`
+}
+
+type customOptions struct {
+	Image    string   `json:"image"`
+	Services []string `json:"services"`
+}
+
+func newJobContext(build *common.Build, options customOptions) *jobContext {
+	return &jobContext{
+		Version: jobContextVersion,
+		Job: jobInfo{
+			ID:    build.ID,
+			Name:  build.Name,
+			Stage: build.Stage,
+			Ref:   build.RefName,
+			Sha:   build.Sha,
+			Tag:   build.Tag,
+		},
+		Project: projectInfo{
+			ID:  build.ProjectID,
+			Dir: build.FullProjectDir(),
+		},
+		Runner: runnerInfo{
+			ID:          build.Runner.ShortDescription(),
+			Description: build.Runner.Name,
+		},
+		BuildsDir: build.RootDir,
+		CacheDir:  build.CacheDir,
+		Image:     build.GetAllVariables().ExpandValue(options.Image),
+		Services:  options.Services,
+		Variables: build.GetAllVariables(),
+	}
+}
+
+// writeJobContext writes the job context to a file readable only by the
+// user of the runner, as it contains the secret variables of the job
+func writeJobContext(dir string, context *jobContext) (string, error) {
+	data, err := json.MarshalIndent(context, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	file := filepath.Join(dir, "job_context.json")
+	if err = ioutil.WriteFile(file, data, 0600); err != nil {
+		os.Remove(file)
+		return "", err
+	}
+	return file, nil
+}
@@ -1,10 +1,13 @@
 package executors
 
-import "gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+import (
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
 
 type DefaultExecutorProvider struct {
 	Creator         func() common.Executor
 	FeaturesUpdater func(features *common.FeaturesInfo)
+	DefaultShell    string
 }
 
 func (e DefaultExecutorProvider) CanCreate() bool {
@@ -31,3 +34,7 @@ func (e DefaultExecutorProvider) GetFeatures(features *common.FeaturesInfo) {
 		e.FeaturesUpdater(features)
 	}
 }
+
+func (e DefaultExecutorProvider) GetDefaultShell() string {
+	return e.DefaultShell
+}
@@ -0,0 +1,27 @@
+package executors
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+func TestDefaultExecutorProviderFeatures(t *testing.T) {
+	provider := DefaultExecutorProvider{
+		Creator: func() common.Executor {
+			t.Fatal("the executor is created to get the features")
+			return nil
+		},
+		FeaturesUpdater: func(features *common.FeaturesInfo) {
+			features.Variables = true
+		},
+		DefaultShell: "bash",
+	}
+
+	var features common.FeaturesInfo
+	provider.GetFeatures(&features)
+	assert.True(t, features.Variables)
+	assert.Equal(t, "bash", provider.GetDefaultShell())
+}
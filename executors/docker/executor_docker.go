@@ -41,10 +41,11 @@ type executor struct {
 	volumesFrom []string
 	devices     []docker.Device
 	links       []string
+	dindAlias   string
 }
 
 func (s *executor) getServiceVariables() []string {
-	return s.Build.GetAllVariables().PublicOrInternal().StringList()
+	return s.Build.GetAllVariables().PublicOrInternal().WithoutFiles().StringList()
 }
 
 func (s *executor) getUserAuthConfiguration(indexName string) *docker.AuthConfiguration {
@@ -526,6 +527,11 @@ func (s *executor) createService(service, version, image string) (*docker.Contai
 
 	containerName := s.Build.ProjectUniqueName() + "-" + strings.Replace(service, "/", "__", -1)
 
+	env := s.getServiceVariables()
+	if s.isDindService(image) {
+		env = append(env, s.getDindServiceVariables()...)
+	}
+
 	// this will fail potentially some builds if there's name collision
 	s.removeContainer(containerName)
 
@@ -534,7 +540,7 @@ func (s *executor) createService(service, version, image string) (*docker.Contai
 		Config: &docker.Config{
 			Image:  serviceImage.ID,
 			Labels: s.getLabels("service", "service="+service, "service.version="+version),
-			Env:    s.getServiceVariables(),
+			Env:    env,
 		},
 		HostConfig: &docker.HostConfig{
 			RestartPolicy: docker.NeverRestart(),
@@ -554,6 +560,12 @@ func (s *executor) createService(service, version, image string) (*docker.Contai
 		return nil, err
 	}
 
+	err = s.connectNetworks(container)
+	if err != nil {
+		s.failures = append(s.failures, container)
+		return nil, err
+	}
+
 	s.Debugln("Starting service container", container.ID, "...")
 	err = s.client.StartContainer(container.ID, nil)
 	if err != nil {
@@ -656,6 +668,11 @@ func (s *executor) createServices() (err error) {
 
 	s.waitForServices()
 
+	err = s.waitForDindService()
+	if err != nil {
+		return
+	}
+
 	s.links = s.buildServiceLinks(linksMap)
 	return
 }
@@ -674,6 +691,9 @@ func (s *executor) createContainer(containerType, imageName string, cmd []string
 
 	containerName := s.Build.ProjectUniqueName() + "-" + containerType
 
+	env := append(s.Build.GetAllVariables().WithoutFiles().StringList(), s.BuildShell.Environment...)
+	env = append(env, s.getDindBuildVariables()...)
+
 	options := docker.CreateContainerOptions{
 		Name: containerName,
 		Config: &docker.Config{
@@ -687,7 +707,7 @@ func (s *executor) createContainer(containerType, imageName string, cmd []string
 			AttachStderr: true,
 			OpenStdin:    true,
 			StdinOnce:    true,
-			Env:          append(s.Build.GetAllVariables().StringList(), s.BuildShell.Environment...),
+			Env:          env,
 		},
 		HostConfig: &docker.HostConfig{
 			CPUSetCPUs:    s.Config.Docker.CPUSetCPUs,
@@ -724,9 +744,27 @@ func (s *executor) createContainer(containerType, imageName string, cmd []string
 	}
 
 	s.builds = append(s.builds, container)
+
+	err = s.connectNetworks(container)
+	if err != nil {
+		return nil, err
+	}
 	return
 }
 
+func (s *executor) connectNetworks(container *docker.Container) error {
+	for _, network := range s.Config.Docker.Networks {
+		s.Debugln("Connecting container", container.ID, "to network", network, "...")
+		err := s.client.ConnectNetwork(network, docker.NetworkConnectionOptions{
+			Container: container.ID,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to connect container to network %q: %s", network, err)
+		}
+	}
+	return nil
+}
+
 func (s *executor) killContainer(container *docker.Container, waitCh chan error) (err error) {
 	for {
 		s.disconnectNetwork(container.ID)
@@ -954,6 +992,12 @@ func (s *executor) createDependencies() (err error) {
 		return err
 	}
 
+	s.Debugln("Creating Docker-in-Docker volume...")
+	err = s.createDindVolume()
+	if err != nil {
+		return err
+	}
+
 	s.Debugln("Creating services...")
 	err = s.createServices()
 	if err != nil {
@@ -71,9 +71,10 @@ func init() {
 		DefaultCacheDir:  "/cache",
 		SharedBuildsDir:  false,
 		Shell: common.ShellScriptInfo{
-			Shell:         "bash",
-			Type:          common.NormalShell,
-			RunnerCommand: "/usr/bin/gitlab-runner-helper",
+			Shell:                        "bash",
+			Type:                         common.NormalShell,
+			RunnerCommand:                "/usr/bin/gitlab-runner-helper",
+			MaskedVariablesInEnvironment: true,
 		},
 		ShowHostname:     true,
 		SupportedOptions: []string{"image", "services"},
@@ -98,5 +99,6 @@ func init() {
 	common.RegisterExecutor("docker", executors.DefaultExecutorProvider{
 		Creator:         creator,
 		FeaturesUpdater: featuresUpdater,
+		DefaultShell:    options.Shell.Shell,
 	})
 }
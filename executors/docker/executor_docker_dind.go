@@ -0,0 +1,191 @@
+package docker
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+const defaultDindCertsDir = "/certs"
+const dindTLSPort = 2376
+const dindPort = 2375
+
+// isDindService checks if service description points to the Docker-in-Docker
+// image, eg. docker:dind, docker:17.06-dind or registry.local/docker:dind
+func (s *executor) isDindService(description string) bool {
+	service, version, _, _ := s.splitServiceAndVersion(description)
+	if !strings.Contains(version, "dind") {
+		return false
+	}
+
+	return service == "docker" || strings.HasSuffix(service, "/docker")
+}
+
+// isDindTLSEnabled follows the rules of the docker:dind image: TLS is used
+// unless user explicitly sets DOCKER_TLS_CERTDIR to an empty value
+func (s *executor) isDindTLSEnabled() bool {
+	for _, variable := range s.Build.GetAllVariables() {
+		if variable.Key == "DOCKER_TLS_CERTDIR" {
+			return variable.Value != ""
+		}
+	}
+	return true
+}
+
+// getDindCertsDir returns the directory of the certificates of docker:dind,
+// DOCKER_TLS_CERTDIR of the job or /certs. The volume is mounted there in the
+// service and in the build container, so the paths of both match.
+func (s *executor) getDindCertsDir() string {
+	certsDir := s.Build.GetAllVariables().Get("DOCKER_TLS_CERTDIR")
+	if certsDir == "" {
+		return defaultDindCertsDir
+	}
+	return path.Clean(certsDir)
+}
+
+func (s *executor) isVariableDefined(key string) bool {
+	for _, variable := range s.Build.GetAllVariables() {
+		if variable.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *executor) getDindServiceAlias() string {
+	serviceNames, err := s.getServiceNames()
+	if err != nil {
+		return ""
+	}
+
+	for _, serviceName := range serviceNames {
+		if !s.isDindService(serviceName) {
+			continue
+		}
+
+		_, _, _, linkNames := s.splitServiceAndVersion(serviceName)
+		if len(linkNames) > 0 {
+			return linkNames[len(linkNames)-1]
+		}
+	}
+	return ""
+}
+
+// getDindServiceVariables returns variables passed to the docker:dind service,
+// DOCKER_TLS_CERTDIR is always set, as the variables of the job which are not
+// public aren't passed to the services
+func (s *executor) getDindServiceVariables() []string {
+	if !s.isDindTLSEnabled() {
+		return nil
+	}
+
+	return []string{"DOCKER_TLS_CERTDIR=" + s.getDindCertsDir()}
+}
+
+// getDindBuildVariables returns variables that connect the docker client in
+// the build container with the docker:dind service. Variables that were
+// defined by user are not overwritten.
+func (s *executor) getDindBuildVariables() (variables []string) {
+	if s.dindAlias == "" || s.isVariableDefined("DOCKER_HOST") {
+		return
+	}
+
+	if !s.isDindTLSEnabled() {
+		return []string{fmt.Sprintf("DOCKER_HOST=tcp://%s:%d", s.dindAlias, dindPort)}
+	}
+
+	variables = append(variables, fmt.Sprintf("DOCKER_HOST=tcp://%s:%d", s.dindAlias, dindTLSPort))
+	variables = append(variables, "DOCKER_TLS_VERIFY=1")
+	if !s.isVariableDefined("DOCKER_TLS_CERTDIR") {
+		variables = append(variables, "DOCKER_TLS_CERTDIR="+s.getDindCertsDir())
+	}
+	if !s.isVariableDefined("DOCKER_CERT_PATH") {
+		variables = append(variables, "DOCKER_CERT_PATH="+path.Join(s.getDindCertsDir(), "client"))
+	}
+	return
+}
+
+// createDindVolume creates the temporary volume where docker:dind stores
+// generated TLS certificates, shared with the build container
+func (s *executor) createDindVolume() error {
+	s.dindAlias = s.getDindServiceAlias()
+	if s.dindAlias == "" || !s.isDindTLSEnabled() {
+		return nil
+	}
+
+	s.Debugln("Creating Docker-in-Docker certificates volume...")
+	container, err := s.createCacheVolume("", s.getDindCertsDir())
+	if container != nil {
+		s.caches = append(s.caches, container)
+		s.volumesFrom = append(s.volumesFrom, container.ID)
+	}
+	return err
+}
+
+// waitForDindService waits until docker:dind generates the client
+// certificates, which happens just before the daemon starts listening
+func (s *executor) waitForDindService() error {
+	if s.dindAlias == "" || !s.isDindTLSEnabled() {
+		return nil
+	}
+
+	timeout := s.Config.Docker.WaitForServicesTimeout
+	if timeout == 0 {
+		timeout = common.DefaultWaitForServicesTimeout
+	}
+	if timeout < 0 {
+		return nil
+	}
+
+	waitImage, err := s.getPrebuiltImage()
+	if err != nil {
+		return err
+	}
+
+	s.Println("Waiting for Docker-in-Docker service to be ready...")
+	certFile := path.Join(s.getDindCertsDir(), "client", "cert.pem")
+	waitContainerOpts := docker.CreateContainerOptions{
+		Name: s.Build.ProjectUniqueName() + "-wait-for-dind",
+		Config: &docker.Config{
+			Cmd:    []string{"sh", "-c", fmt.Sprintf("until [ -e %s ]; do sleep 1; done", certFile)},
+			Image:  waitImage.ID,
+			Labels: s.getLabels("wait", "wait=dind"),
+		},
+		HostConfig: &docker.HostConfig{
+			RestartPolicy: docker.NeverRestart(),
+			VolumesFrom:   s.volumesFrom,
+			LogConfig: docker.LogConfig{
+				Type: "json-file",
+			},
+		},
+	}
+
+	s.removeContainer(waitContainerOpts.Name)
+	waitContainer, err := s.client.CreateContainer(waitContainerOpts)
+	if err != nil {
+		return err
+	}
+	defer s.removeContainer(waitContainer.ID)
+
+	err = s.client.StartContainer(waitContainer.ID, nil)
+	if err != nil {
+		return err
+	}
+
+	waitResult := make(chan error, 1)
+	go func() {
+		waitResult <- s.waitForContainer(waitContainer.ID)
+	}()
+
+	select {
+	case err = <-waitResult:
+		return err
+	case <-time.After(time.Duration(timeout) * time.Second):
+		s.Warningln("Docker-in-Docker service didn't generate certificates in", timeout, "seconds")
+		return nil
+	}
+}
@@ -69,6 +69,7 @@ func (s *sshExecutor) Run(cmd common.ExecutorCommand) error {
 		Command:     s.BuildShell.GetCommandWithArguments(),
 		Stdin:       cmd.Script,
 		Abort:       cmd.Abort,
+		ScriptFile:  ssh.ScriptFile(s.Build.ID),
 	})
 	if _, ok := err.(*ssh.ExitError); ok {
 		err = &common.BuildError{Inner: err}
@@ -86,9 +87,10 @@ func init() {
 		DefaultBuildsDir: "builds",
 		SharedBuildsDir:  false,
 		Shell: common.ShellScriptInfo{
-			Shell:         "bash",
-			Type:          common.LoginShell,
-			RunnerCommand: "gitlab-runner",
+			Shell:                        "bash",
+			Type:                         common.LoginShell,
+			RunnerCommand:                "gitlab-runner",
+			MaskedVariablesInEnvironment: true,
 		},
 		ShowHostname:     true,
 		SupportedOptions: []string{"image", "services"},
@@ -113,5 +115,6 @@ func init() {
 	common.RegisterExecutor("docker-ssh", executors.DefaultExecutorProvider{
 		Creator:         creator,
 		FeaturesUpdater: featuresUpdater,
+		DefaultShell:    options.Shell.Shell,
 	})
 }
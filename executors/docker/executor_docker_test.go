@@ -177,6 +177,84 @@ func TestServiceFromNamedImage(t *testing.T) {
 	}
 }
 
+func TestIsDindService(t *testing.T) {
+	e := executor{}
+
+	assert.True(t, e.isDindService("docker:dind"))
+	assert.True(t, e.isDindService("docker:17.06-dind"))
+	assert.True(t, e.isDindService("registry.local:5000/docker:dind"))
+	assert.False(t, e.isDindService("docker:latest"))
+	assert.False(t, e.isDindService("mysql:dind"))
+}
+
+func getDindTestExecutor(variables ...common.BuildVariable) executor {
+	e := executor{
+		dindAlias: "docker",
+	}
+	e.Build = &common.Build{
+		Runner: &common.RunnerConfig{},
+	}
+	e.Build.Variables = variables
+	return e
+}
+
+func TestDindBuildVariables(t *testing.T) {
+	e := getDindTestExecutor()
+	assert.Equal(t, []string{
+		"DOCKER_HOST=tcp://docker:2376",
+		"DOCKER_TLS_VERIFY=1",
+		"DOCKER_TLS_CERTDIR=/certs",
+		"DOCKER_CERT_PATH=/certs/client",
+	}, e.getDindBuildVariables())
+	assert.Equal(t, []string{"DOCKER_TLS_CERTDIR=/certs"}, e.getDindServiceVariables())
+}
+
+func TestDindBuildVariablesWithUserDefinedCertsDir(t *testing.T) {
+	e := getDindTestExecutor(common.BuildVariable{Key: "DOCKER_TLS_CERTDIR", Value: "/docker-certs/"})
+	assert.Equal(t, []string{
+		"DOCKER_HOST=tcp://docker:2376",
+		"DOCKER_TLS_VERIFY=1",
+		"DOCKER_CERT_PATH=/docker-certs/client",
+	}, e.getDindBuildVariables())
+	assert.Equal(t, []string{"DOCKER_TLS_CERTDIR=/docker-certs"}, e.getDindServiceVariables())
+}
+
+func TestDindBuildVariablesWithTLSDisabled(t *testing.T) {
+	e := getDindTestExecutor(common.BuildVariable{Key: "DOCKER_TLS_CERTDIR", Value: ""})
+	assert.Equal(t, []string{"DOCKER_HOST=tcp://docker:2375"}, e.getDindBuildVariables())
+	assert.Empty(t, e.getDindServiceVariables())
+}
+
+func TestDindBuildVariablesWithUserDefinedHost(t *testing.T) {
+	e := getDindTestExecutor(common.BuildVariable{Key: "DOCKER_HOST", Value: "tcp://other:2375"})
+	assert.Empty(t, e.getDindBuildVariables())
+}
+
+func TestDindBuildVariablesWithoutDindService(t *testing.T) {
+	e := getDindTestExecutor()
+	e.dindAlias = ""
+	assert.Empty(t, e.getDindBuildVariables())
+}
+
+func TestConnectNetworks(t *testing.T) {
+	var c docker_helpers.MockClient
+	defer c.AssertExpectations(t)
+
+	e := executor{client: &c}
+	e.Config.Docker = &common.DockerConfig{
+		Networks: []string{"databases", "monitoring"},
+	}
+
+	container := &docker.Container{ID: "container-id"}
+	c.On("ConnectNetwork", "databases", docker.NetworkConnectionOptions{Container: "container-id"}).
+		Return(nil).Once()
+	c.On("ConnectNetwork", "monitoring", docker.NetworkConnectionOptions{Container: "container-id"}).
+		Return(errors.New("no such network")).Once()
+
+	err := e.connectNetworks(container)
+	assert.EqualError(t, err, `failed to connect container to network "monitoring": no such network`)
+}
+
 func TestDockerForNamedImage(t *testing.T) {
 	var c docker_helpers.MockClient
 	defer c.AssertExpectations(t)
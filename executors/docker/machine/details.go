@@ -8,6 +8,7 @@ import (
 	"github.com/Sirupsen/logrus"
 
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/docker"
 )
 
 type machineDetails struct {
@@ -19,6 +20,9 @@ type machineDetails struct {
 	Reason     string
 	RetryCount int
 	LastSeen   time.Time
+
+	// machine manages the machine, when it's not the docker-machine
+	machine docker_helpers.Machine
 }
 
 func (m *machineDetails) isUsed() bool {
@@ -10,6 +10,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/autoscaler"
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/docker"
 )
 
@@ -28,11 +29,31 @@ type machineProvider struct {
 	statistics  machineProviderStatistics
 	// provider stores a real executor that is used to start run the builds
 	provider common.ExecutorProvider
+	// newAutoscaler creates the machines of the autoscaler providers, which
+	// replace the docker-machine
+	newAutoscaler func(config *autoscaler.Config) docker_helpers.Machine
 
 	machinesDataDesc       *prometheus.Desc
 	providerStatisticsDesc *prometheus.Desc
 }
 
+// machineFor returns the docker-machine, or the autoscaler provider when
+// it's configured
+func (m *machineProvider) machineFor(config *common.RunnerConfig) docker_helpers.Machine {
+	if config.Machine != nil && config.Machine.Autoscaler != nil {
+		return m.newAutoscaler(config.Machine.Autoscaler)
+	}
+	return m.machine
+}
+
+// machineOf returns what manages the machine
+func (m *machineProvider) machineOf(details *machineDetails) docker_helpers.Machine {
+	if details.machine != nil {
+		return details.machine
+	}
+	return m.machine
+}
+
 func (m *machineProvider) machineDetails(name string, acquire bool) *machineDetails {
 	m.lock.Lock()
 	defer m.lock.Unlock()
@@ -67,18 +88,19 @@ func (m *machineProvider) create(config *common.RunnerConfig, state machineState
 	details.UsedCount = 0
 	details.RetryCount = 0
 	details.LastSeen = time.Now()
+	details.machine = m.machineFor(config)
 	errCh = make(chan error, 1)
 
 	// Create machine asynchronously
 	go func() {
 		started := time.Now()
-		err := m.machine.Create(config.Machine.MachineDriver, details.Name, config.Machine.MachineOptions...)
+		err := details.machine.Create(config.Machine.MachineDriver, details.Name, config.Machine.MachineOptions...)
 		for i := 0; i < 3 && err != nil; i++ {
 			details.RetryCount++
 			logrus.WithField("name", details.Name).WithError(err).
 				Warningln("Machine creation failed, trying to provision")
 			time.Sleep(provisionRetryInterval)
-			err = m.machine.Provision(details.Name)
+			err = details.machine.Provision(details.Name)
 		}
 
 		if err != nil {
@@ -112,7 +134,7 @@ func (m *machineProvider) findFreeMachine(machines ...string) (details *machineD
 		}
 
 		// Check if node is running
-		canConnect := m.machine.CanConnect(name)
+		canConnect := m.machineOf(details).CanConnect(name)
 		if !canConnect {
 			m.remove(name, "machine is unavailable")
 			continue
@@ -151,7 +173,7 @@ func (m *machineProvider) retryUseMachine(config *common.RunnerConfig) (details
 
 func (m *machineProvider) finalizeRemoval(details *machineDetails) {
 	for {
-		if !m.machine.Exist(details.Name) {
+		if !m.machineOf(details).Exist(details.Name) {
 			logrus.WithField("name", details.Name).
 				WithField("created", time.Since(details.Created)).
 				WithField("used", time.Since(details.Used)).
@@ -160,7 +182,7 @@ func (m *machineProvider) finalizeRemoval(details *machineDetails) {
 			break
 		}
 
-		err := m.machine.Remove(details.Name)
+		err := m.machineOf(details).Remove(details.Name)
 		if err == nil {
 			break
 		}
@@ -274,12 +296,16 @@ func (m *machineProvider) createMachines(config *common.RunnerConfig, data *mach
 }
 
 func (m *machineProvider) loadMachines(config *common.RunnerConfig) (machines []string, err error) {
-	machines, err = m.machine.List()
+	machine := m.machineFor(config)
+	machines, err = machine.List()
 	if err != nil {
 		return nil, err
 	}
 
 	machines = filterMachineList(machines, machineFilter(config))
+	for _, name := range machines {
+		m.machineDetails(name, false).machine = machine
+	}
 	return
 }
 
@@ -289,6 +315,13 @@ func (m *machineProvider) Acquire(config *common.RunnerConfig) (data common.Exec
 		return
 	}
 
+	if config.Machine.Autoscaler != nil {
+		_, err = autoscaler.NewProvider(config.Machine.Autoscaler)
+		if err != nil {
+			return
+		}
+	}
+
 	// Lock updating machines, because two Acquires can be run at the same time
 	m.acquireLock.Lock()
 	defer m.acquireLock.Unlock()
@@ -329,7 +362,7 @@ func (m *machineProvider) Acquire(config *common.RunnerConfig) (data common.Exec
 func (m *machineProvider) Use(config *common.RunnerConfig, data common.ExecutorData) (newConfig common.RunnerConfig, newData common.ExecutorData, err error) {
 	// Find a new machine
 	details, _ := data.(*machineDetails)
-	if details == nil || !details.canBeUsed() || !m.machine.CanConnect(details.Name) {
+	if details == nil || !details.canBeUsed() || !m.machineOf(details).CanConnect(details.Name) {
 		details, err = m.retryUseMachine(config)
 		if err != nil {
 			return
@@ -340,7 +373,7 @@ func (m *machineProvider) Use(config *common.RunnerConfig, data common.ExecutorD
 	}
 
 	// Get machine credentials
-	dc, err := m.machine.Credentials(details.Name)
+	dc, err := m.machineOf(details).Credentials(details.Name)
 	if err != nil {
 		if newData != nil {
 			m.Release(config, newData)
@@ -395,6 +428,10 @@ func (m *machineProvider) GetFeatures(features *common.FeaturesInfo) {
 	m.provider.GetFeatures(features)
 }
 
+func (m *machineProvider) GetDefaultShell() string {
+	return m.provider.GetDefaultShell()
+}
+
 func (m *machineProvider) Create() common.Executor {
 	return &machineExecutor{
 		provider: m,
@@ -412,5 +449,7 @@ func newMachineProvider(name, executor string) *machineProvider {
 		details:  make(machinesDetails),
 		machine:  docker_helpers.NewMachineCommand(),
 		provider: provider,
+
+		newAutoscaler: autoscaler.NewMachine,
 	}
 }
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/autoscaler"
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/docker"
 	"strings"
 	"testing"
@@ -549,3 +550,54 @@ func TestMachineCreationIfFailedToConnect(t *testing.T) {
 	assert.Error(t, err, "it create a new machine")
 	assert.Nil(t, nd)
 }
+
+func TestMachineAutoscaler(t *testing.T) {
+	p, dockerMachine := testMachineProvider("runner--autoscaled-machine1")
+	autoscaled := &testMachine{
+		Created: make(chan bool, 10),
+		Removed: make(chan bool, 10),
+	}
+	p.newAutoscaler = func(config *autoscaler.Config) docker_helpers.Machine {
+		return autoscaled
+	}
+
+	config := &common.RunnerConfig{
+		RunnerSettings: common.RunnerSettings{
+			Machine: &common.DockerMachine{
+				MachineName: "autoscaled-%s",
+				IdleCount:   1,
+				IdleTime:    5,
+				Autoscaler:  &autoscaler.Config{Provider: "aws-ec2"},
+			},
+		},
+	}
+
+	_, err := p.Acquire(config)
+	assert.Error(t, err, "the machines are being created")
+	<-autoscaled.Created
+	assert.Equal(t, 1, len(autoscaled.machines))
+	assert.Equal(t, 1, len(dockerMachine.machines), "doesn't use docker-machine")
+
+	details := p.details[autoscaled.machines[0]]
+	assert.Equal(t, autoscaled, details.machine)
+
+	p.remove(details.Name, "test")
+	<-autoscaled.Removed
+	assert.Equal(t, 0, len(autoscaled.machines))
+}
+
+func TestMachineAutoscalerUnknownProvider(t *testing.T) {
+	p, _ := testMachineProvider()
+
+	config := &common.RunnerConfig{
+		RunnerSettings: common.RunnerSettings{
+			Machine: &common.DockerMachine{
+				MachineName: "autoscaled-%s",
+				Autoscaler:  &autoscaler.Config{Provider: "unknown"},
+			},
+		},
+	}
+
+	_, err := p.Acquire(config)
+	assert.Error(t, err)
+}
@@ -44,6 +44,13 @@ func (e *AbstractExecutor) updateShell() error {
 	if e.Config.Shell != "" {
 		script.Shell = e.Config.Shell
 	}
+	if e.Config.LoginShell != nil {
+		if *e.Config.LoginShell {
+			script.Type = common.LoginShell
+		} else {
+			script.Type = common.NormalShell
+		}
+	}
 	return nil
 }
 
@@ -58,6 +65,12 @@ func (e *AbstractExecutor) generateShellConfiguration() error {
 	}
 	e.BuildShell = shellConfiguration
 	e.Debugln("Shell configuration:", shellConfiguration)
+
+	// added after printing the configuration, to keep them out of the log
+	if info.MaskedVariablesInEnvironment {
+		masked := e.Build.GetAllVariables().Masked().StringList()
+		shellConfiguration.Environment = append(shellConfiguration.Environment, masked...)
+	}
 	return nil
 }
 
@@ -0,0 +1,77 @@
+package executors
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+func TestUpdateShellLoginShell(t *testing.T) {
+	enabled, disabled := true, false
+
+	tests := []struct {
+		executorType common.ShellType
+		loginShell   *bool
+		expectedType common.ShellType
+	}{
+		{common.LoginShell, nil, common.LoginShell},
+		{common.NormalShell, nil, common.NormalShell},
+		{common.NormalShell, &enabled, common.LoginShell},
+		{common.LoginShell, &disabled, common.NormalShell},
+	}
+
+	for _, test := range tests {
+		e := AbstractExecutor{
+			ExecutorOptions: ExecutorOptions{
+				Shell: common.ShellScriptInfo{Shell: "bash", Type: test.executorType},
+			},
+			Config: common.RunnerConfig{
+				RunnerSettings: common.RunnerSettings{LoginShell: test.loginShell},
+			},
+		}
+
+		err := e.updateShell()
+		assert.NoError(t, err)
+		assert.Equal(t, test.expectedType, e.Shell().Type)
+	}
+}
+
+func TestGenerateShellConfigurationMaskedVariables(t *testing.T) {
+	shell := &common.MockShell{}
+	shell.On("GetName").Return("masked-variables-shell")
+	shell.On("GetConfiguration", mock.Anything).Return(&common.ShellConfiguration{Command: "sh"}, nil)
+	common.RegisterShell(shell)
+
+	build := &common.Build{
+		GetBuildResponse: common.GetBuildResponse{
+			Variables: common.BuildVariables{
+				{Key: "PUBLIC", Value: "value", Public: true},
+				{Key: "TOKEN", Value: "secret", Masked: true},
+			},
+		},
+		Runner: &common.RunnerConfig{},
+	}
+
+	for _, inEnvironment := range []bool{false, true} {
+		e := AbstractExecutor{
+			ExecutorOptions: ExecutorOptions{
+				Shell: common.ShellScriptInfo{
+					Shell:                        "masked-variables-shell",
+					MaskedVariablesInEnvironment: inEnvironment,
+				},
+			},
+			Build: build,
+		}
+
+		err := e.generateShellConfiguration()
+		assert.NoError(t, err)
+		if inEnvironment {
+			assert.Equal(t, []string{"TOKEN=secret"}, e.BuildShell.Environment)
+		} else {
+			assert.Empty(t, e.BuildShell.Environment)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package fargate
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers"
+)
+
+// awsCLI runs the AWS CLI. It's a variable, so tests can replace it.
+var awsCLI = func(args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	logrus.Debugf("Executing aws: %#v", args)
+	cmd := exec.Command("aws", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+
+	if _, ok := err.(*exec.ExitError); ok {
+		err = fmt.Errorf("aws error: %s", strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.Bytes(), err
+}
+
+type keyValuePair struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type containerOverride struct {
+	Name        string         `json:"name"`
+	Environment []keyValuePair `json:"environment,omitempty"`
+}
+
+type taskOverride struct {
+	ContainerOverrides []containerOverride `json:"containerOverrides"`
+}
+
+type awsVpcConfiguration struct {
+	Subnets        []string `json:"subnets"`
+	SecurityGroups []string `json:"securityGroups,omitempty"`
+	AssignPublicIP string   `json:"assignPublicIp"`
+}
+
+type networkConfiguration struct {
+	AwsVpcConfiguration awsVpcConfiguration `json:"awsvpcConfiguration"`
+}
+
+type taskContainer struct {
+	Name       string `json:"name"`
+	RuntimeID  string `json:"runtimeId"`
+	LastStatus string `json:"lastStatus"`
+}
+
+type attachmentDetail struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type taskAttachment struct {
+	Type    string             `json:"type"`
+	Details []attachmentDetail `json:"details"`
+}
+
+type task struct {
+	TaskArn       string           `json:"taskArn"`
+	LastStatus    string           `json:"lastStatus"`
+	StoppedReason string           `json:"stoppedReason"`
+	Containers    []taskContainer  `json:"containers"`
+	Attachments   []taskAttachment `json:"attachments"`
+}
+
+type taskFailure struct {
+	Arn    string `json:"arn"`
+	Reason string `json:"reason"`
+}
+
+type tasksOutput struct {
+	Tasks    []task        `json:"tasks"`
+	Failures []taskFailure `json:"failures"`
+}
+
+// taskID returns the ID of the task, the last part of its ARN
+func (t *task) taskID() string {
+	return t.TaskArn[strings.LastIndex(t.TaskArn, "/")+1:]
+}
+
+func (t *task) privateIPv4Address() string {
+	for _, attachment := range t.Attachments {
+		if attachment.Type != "ElasticNetworkInterface" {
+			continue
+		}
+		for _, detail := range attachment.Details {
+			if detail.Name == "privateIPv4Address" {
+				return detail.Value
+			}
+		}
+	}
+	return ""
+}
+
+func (t *task) container(name string) *taskContainer {
+	for i := range t.Containers {
+		if t.Containers[i].Name == name {
+			return &t.Containers[i]
+		}
+	}
+	return nil
+}
+
+type taskDefinitionOutput struct {
+	TaskDefinition struct {
+		TaskDefinitionArn string `json:"taskDefinitionArn"`
+	} `json:"taskDefinition"`
+}
+
+type ecsClient struct {
+	region  string
+	cluster string
+}
+
+func (c *ecsClient) aws(args ...string) ([]byte, error) {
+	args = append(args, "--output", "json")
+	if c.region != "" {
+		args = append(args, "--region", c.region)
+	}
+	return awsCLI(args...)
+}
+
+func (c *ecsClient) run(args ...string) ([]byte, error) {
+	return c.aws(append(args, "--cluster", c.cluster)...)
+}
+
+func (c *ecsClient) runTasksCommand(args ...string) (*task, error) {
+	output, err := c.run(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var result tasksOutput
+	err = json.Unmarshal(output, &result)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Failures) > 0 {
+		return nil, fmt.Errorf("%s: %s", result.Failures[0].Arn, result.Failures[0].Reason)
+	}
+	if len(result.Tasks) == 0 {
+		return nil, errors.New("no task returned")
+	}
+	return &result.Tasks[0], nil
+}
+
+type runTaskOptions struct {
+	TaskDefinition  string
+	PlatformVersion string
+	Network         networkConfiguration
+	Overrides       taskOverride
+	StartedBy       string
+	EnableExecute   bool
+}
+
+func (c *ecsClient) RunTask(options runTaskOptions) (*task, error) {
+	network, err := json.Marshal(options.Network)
+	if err != nil {
+		return nil, err
+	}
+	overrides, err := json.Marshal(options.Overrides)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{"ecs", "run-task",
+		"--launch-type", "FARGATE",
+		"--count", "1",
+		"--task-definition", options.TaskDefinition,
+		"--network-configuration", string(network),
+		"--overrides", string(overrides),
+		"--started-by", options.StartedBy,
+	}
+	if options.PlatformVersion != "" {
+		args = append(args, "--platform-version", options.PlatformVersion)
+	}
+	if options.EnableExecute {
+		args = append(args, "--enable-execute-command")
+	}
+	return c.runTasksCommand(args...)
+}
+
+// RegisterTaskDefinition registers the task definition, in the JSON input of
+// register-task-definition, and returns the ARN of its new revision
+func (c *ecsClient) RegisterTaskDefinition(definition []byte) (string, error) {
+	output, err := c.aws("ecs", "register-task-definition", "--cli-input-json", string(definition))
+	if err != nil {
+		return "", err
+	}
+
+	var result taskDefinitionOutput
+	err = json.Unmarshal(output, &result)
+	if err != nil {
+		return "", err
+	}
+	if result.TaskDefinition.TaskDefinitionArn == "" {
+		return "", errors.New("no task definition returned")
+	}
+	return result.TaskDefinition.TaskDefinitionArn, nil
+}
+
+func (c *ecsClient) DeregisterTaskDefinition(taskDefinitionArn string) error {
+	_, err := c.aws("ecs", "deregister-task-definition", "--task-definition", taskDefinitionArn)
+	return err
+}
+
+func (c *ecsClient) DescribeTask(taskArn string) (*task, error) {
+	return c.runTasksCommand("ecs", "describe-tasks", "--tasks", taskArn)
+}
+
+func (c *ecsClient) StopTask(taskArn string, reason string) error {
+	_, err := c.run("ecs", "stop-task", "--task", taskArn, "--reason", reason)
+	return err
+}
+
+// startPortForwarding starts an SSM session forwarding the local port to the
+// port of the container. The session runs until the command is killed.
+func (c *ecsClient) startPortForwarding(t *task, container *taskContainer, port string, localPort string) (*exec.Cmd, error) {
+	// the target needs the name of the cluster, not its ARN
+	cluster := c.cluster[strings.LastIndex(c.cluster, "/")+1:]
+	target := fmt.Sprintf("ecs:%s_%s_%s", cluster, t.taskID(), container.RuntimeID)
+	parameters := fmt.Sprintf(`{"portNumber":["%s"],"localPortNumber":["%s"]}`, port, localPort)
+
+	args := []string{"ssm", "start-session",
+		"--target", target,
+		"--document-name", "AWS-StartPortForwardingSession",
+		"--parameters", parameters,
+	}
+	if c.region != "" {
+		args = append(args, "--region", c.region)
+	}
+
+	logrus.Debugf("Executing aws: %#v", args)
+	cmd := exec.Command("aws", args...)
+	helpers.SetProcessGroup(cmd)
+	return cmd, cmd.Start()
+}
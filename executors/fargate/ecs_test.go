@@ -0,0 +1,133 @@
+package fargate
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const runningTask = `{
+  "tasks": [{
+    "taskArn": "arn:aws:ecs:us-east-1:123456789012:task/ci/0123456789abcdef",
+    "lastStatus": "RUNNING",
+    "containers": [{"name": "build", "runtimeId": "0123456789abcdef-1234", "lastStatus": "RUNNING"}],
+    "attachments": [{
+      "type": "ElasticNetworkInterface",
+      "details": [
+        {"name": "subnetId", "value": "subnet-1234"},
+        {"name": "privateIPv4Address", "value": "10.0.1.15"}
+      ]
+    }]
+  }],
+  "failures": []
+}`
+
+func mockAWSCLI(output string, err error) (*[]string, func()) {
+	var calledArgs []string
+	oldAWSCLI := awsCLI
+	awsCLI = func(args ...string) ([]byte, error) {
+		calledArgs = args
+		return []byte(output), err
+	}
+	return &calledArgs, func() {
+		awsCLI = oldAWSCLI
+	}
+}
+
+func TestRunTask(t *testing.T) {
+	args, done := mockAWSCLI(runningTask, nil)
+	defer done()
+
+	c := &ecsClient{region: "us-east-1", cluster: "ci"}
+	task, err := c.RunTask(runTaskOptions{
+		TaskDefinition: "ci-build:3",
+		Network: networkConfiguration{
+			AwsVpcConfiguration: awsVpcConfiguration{
+				Subnets:        []string{"subnet-1234"},
+				AssignPublicIP: "DISABLED",
+			},
+		},
+		Overrides: taskOverride{
+			ContainerOverrides: []containerOverride{{Name: "build"}},
+		},
+		StartedBy:     "runner-abcdef12",
+		EnableExecute: true,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"ecs", "run-task",
+		"--launch-type", "FARGATE",
+		"--count", "1",
+		"--task-definition", "ci-build:3",
+		"--network-configuration", `{"awsvpcConfiguration":{"subnets":["subnet-1234"],"assignPublicIp":"DISABLED"}}`,
+		"--overrides", `{"containerOverrides":[{"name":"build"}]}`,
+		"--started-by", "runner-abcdef12",
+		"--enable-execute-command",
+		"--cluster", "ci", "--output", "json", "--region", "us-east-1",
+	}, *args)
+
+	assert.Equal(t, "0123456789abcdef", task.taskID())
+	assert.Equal(t, "10.0.1.15", task.privateIPv4Address())
+	require.NotNil(t, task.container("build"))
+	assert.Equal(t, "0123456789abcdef-1234", task.container("build").RuntimeID)
+	assert.Nil(t, task.container("sidecar"))
+}
+
+func TestRegisterTaskDefinition(t *testing.T) {
+	args, done := mockAWSCLI(`{"taskDefinition": {"taskDefinitionArn": "arn:aws:ecs:us-east-1:123456789012:task-definition/ci-build:4"}}`, nil)
+	defer done()
+
+	c := &ecsClient{region: "us-east-1", cluster: "ci"}
+	arn, err := c.RegisterTaskDefinition([]byte(`{"family":"ci-build"}`))
+	require.NoError(t, err)
+	assert.Equal(t, "arn:aws:ecs:us-east-1:123456789012:task-definition/ci-build:4", arn)
+	assert.Equal(t, []string{
+		"ecs", "register-task-definition",
+		"--cli-input-json", `{"family":"ci-build"}`,
+		"--output", "json", "--region", "us-east-1",
+	}, *args)
+
+	err = c.DeregisterTaskDefinition(arn)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"ecs", "deregister-task-definition",
+		"--task-definition", "arn:aws:ecs:us-east-1:123456789012:task-definition/ci-build:4",
+		"--output", "json", "--region", "us-east-1",
+	}, *args)
+}
+
+func TestRunTaskFailure(t *testing.T) {
+	_, done := mockAWSCLI(`{"tasks": [], "failures": [{"arn": "arn:aws:ecs:us-east-1:123456789012:cluster/ci", "reason": "MISSING"}]}`, nil)
+	defer done()
+
+	c := &ecsClient{cluster: "ci"}
+	_, err := c.RunTask(runTaskOptions{TaskDefinition: "ci-build"})
+	assert.EqualError(t, err, "arn:aws:ecs:us-east-1:123456789012:cluster/ci: MISSING")
+}
+
+func TestDescribeTaskError(t *testing.T) {
+	_, done := mockAWSCLI("", errors.New("aws error: Unable to locate credentials"))
+	defer done()
+
+	c := &ecsClient{cluster: "ci"}
+	_, err := c.DescribeTask("arn:aws:ecs:us-east-1:123456789012:task/ci/0123456789abcdef")
+	assert.EqualError(t, err, "aws error: Unable to locate credentials")
+}
+
+func TestStopTask(t *testing.T) {
+	args, done := mockAWSCLI("{}", nil)
+	defer done()
+
+	c := &ecsClient{cluster: "ci"}
+	err := c.StopTask("arn:aws:ecs:us-east-1:123456789012:task/ci/0123456789abcdef", "Job finished")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"ecs", "stop-task",
+		"--task", "arn:aws:ecs:us-east-1:123456789012:task/ci/0123456789abcdef",
+		"--reason", "Job finished",
+		"--cluster", "ci", "--output", "json",
+	}, *args)
+}
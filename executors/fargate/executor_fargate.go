@@ -0,0 +1,373 @@
+package fargate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os/exec"
+	"strings"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/ssh"
+)
+
+const (
+	defaultContainerName  = "build"
+	defaultStartupTimeout = 600
+
+	// sshPublicKeyVariable is set in the container to the public key of the
+	// identity file, for images authorizing it on start
+	sshPublicKeyVariable = "SSH_PUBLIC_KEY"
+)
+
+var taskPollInterval = 5 * time.Second
+
+type fargateOptions struct {
+	Image string `json:"image"`
+}
+
+type executor struct {
+	executors.AbstractExecutor
+	options        fargateOptions
+	client         *ecsClient
+	taskDefinition string
+	registered     bool
+	task           *task
+	tunnel         *exec.Cmd
+	sshCommand     ssh.Client
+}
+
+func (s *executor) containerName() string {
+	if s.Config.Fargate.ContainerName != "" {
+		return s.Config.Fargate.ContainerName
+	}
+	return defaultContainerName
+}
+
+func (s *executor) sshPort() string {
+	if s.Config.SSH.Port != "" {
+		return s.Config.SSH.Port
+	}
+	return "22"
+}
+
+func (s *executor) getRunTaskOptions() (runTaskOptions, error) {
+	config := s.Config.Fargate
+
+	assignPublicIP := "DISABLED"
+	if config.AssignPublicIP {
+		assignPublicIP = "ENABLED"
+	}
+
+	override := containerOverride{Name: s.containerName()}
+	if s.Config.SSH.IdentityFile != "" {
+		publicKey, err := ioutil.ReadFile(s.Config.SSH.IdentityFile + ".pub")
+		if err != nil {
+			return runTaskOptions{}, fmt.Errorf("failed to read the public key of the identity file: %v", err)
+		}
+		override.Environment = append(override.Environment, keyValuePair{
+			Name:  sshPublicKeyVariable,
+			Value: strings.TrimSpace(string(publicKey)),
+		})
+	}
+
+	return runTaskOptions{
+		TaskDefinition:  s.taskDefinition,
+		PlatformVersion: config.PlatformVersion,
+		Network: networkConfiguration{
+			AwsVpcConfiguration: awsVpcConfiguration{
+				Subnets:        config.Subnets,
+				SecurityGroups: config.SecurityGroups,
+				AssignPublicIP: assignPublicIP,
+			},
+		},
+		Overrides: taskOverride{
+			ContainerOverrides: []containerOverride{override},
+		},
+		StartedBy:     "runner-" + s.Build.Runner.ShortDescription(),
+		EnableExecute: config.UseSSM,
+	}, nil
+}
+
+// renderTaskDefinition sets the image of the container in the task
+// definition template, keeping the image of the template when it's empty
+func renderTaskDefinition(template []byte, containerName string, image string) ([]byte, error) {
+	var definition map[string]interface{}
+	err := json.Unmarshal(template, &definition)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the task definition template: %v", err)
+	}
+
+	containers, _ := definition["containerDefinitions"].([]interface{})
+	for _, c := range containers {
+		container, ok := c.(map[string]interface{})
+		if !ok || container["name"] != containerName {
+			continue
+		}
+		if image != "" {
+			container["image"] = image
+		}
+		return json.Marshal(definition)
+	}
+	return nil, fmt.Errorf("task definition template has no %s container", containerName)
+}
+
+// registerTaskDefinition registers the task definition of the job from the
+// template; the revision is deregistered in Cleanup
+func (s *executor) registerTaskDefinition() error {
+	template, err := ioutil.ReadFile(s.Config.Fargate.TaskDefinitionTemplate)
+	if err != nil {
+		return fmt.Errorf("failed to read the task definition template: %v", err)
+	}
+
+	image := ""
+	if s.options.Image != "" {
+		image = s.Build.GetAllVariables().ExpandValue(s.options.Image)
+	}
+
+	definition, err := renderTaskDefinition(template, s.containerName(), image)
+	if err != nil {
+		return err
+	}
+
+	s.Println("Registering task definition from", s.Config.Fargate.TaskDefinitionTemplate, "...")
+	s.taskDefinition, err = s.client.RegisterTaskDefinition(definition)
+	if err != nil {
+		return err
+	}
+	s.registered = true
+	return nil
+}
+
+func (s *executor) waitForTask() (*task, error) {
+	timeout := s.Config.Fargate.StartupTimeout
+	if timeout <= 0 {
+		timeout = defaultStartupTimeout
+	}
+
+	deadline := time.Now().Add(time.Duration(timeout) * time.Second)
+	for {
+		t, err := s.client.DescribeTask(s.task.TaskArn)
+		if err != nil {
+			return nil, err
+		}
+
+		switch t.LastStatus {
+		case "RUNNING":
+			return t, nil
+		case "DEACTIVATING", "STOPPING", "DEPROVISIONING", "STOPPED":
+			return nil, fmt.Errorf("task %s stopped: %s", t.taskID(), t.StoppedReason)
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("task %s didn't start in %d seconds, its status is %s", t.taskID(), timeout, t.LastStatus)
+		}
+		time.Sleep(taskPollInterval)
+	}
+}
+
+func allocateLocalPort() (string, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	defer ln.Close()
+
+	_, port, err := net.SplitHostPort(ln.Addr().String())
+	return port, err
+}
+
+// getSSHAddress returns the address of the SSH server of the task, starting
+// an SSM port forwarding session when configured
+func (s *executor) getSSHAddress(t *task) (host string, port string, err error) {
+	if !s.Config.Fargate.UseSSM {
+		host = t.privateIPv4Address()
+		if host == "" {
+			return "", "", fmt.Errorf("task %s has no private IP address", t.taskID())
+		}
+		return host, s.sshPort(), nil
+	}
+
+	container := t.container(s.containerName())
+	if container == nil {
+		return "", "", fmt.Errorf("task %s has no %s container", t.taskID(), s.containerName())
+	}
+
+	port, err = allocateLocalPort()
+	if err != nil {
+		return "", "", err
+	}
+
+	s.Debugln("Starting SSM port forwarding session on port", port, "...")
+	s.tunnel, err = s.client.startPortForwarding(t, container, s.sshPort(), port)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to start SSM session: %v", err)
+	}
+	return "127.0.0.1", port, nil
+}
+
+func (s *executor) Prepare(globalConfig *common.Config, config *common.RunnerConfig, build *common.Build) error {
+	err := s.AbstractExecutor.Prepare(globalConfig, config, build)
+	if err != nil {
+		return err
+	}
+
+	if s.BuildShell.PassFile {
+		return errors.New("Fargate doesn't support shells that require script file")
+	}
+
+	if s.Config.SSH == nil {
+		return errors.New("Missing SSH config")
+	}
+
+	if s.Config.Fargate == nil {
+		return errors.New("Missing Fargate configuration")
+	}
+
+	if s.Config.Fargate.Cluster == "" {
+		return errors.New("Missing Cluster setting from Fargate configuration")
+	}
+
+	if (s.Config.Fargate.TaskDefinition == "") == (s.Config.Fargate.TaskDefinitionTemplate == "") {
+		return errors.New("Fargate configuration needs either TaskDefinition or TaskDefinitionTemplate setting")
+	}
+
+	if len(s.Config.Fargate.Subnets) == 0 {
+		return errors.New("Missing Subnets setting from Fargate configuration")
+	}
+
+	err = build.Options.Decode(&s.options)
+	if err != nil {
+		return err
+	}
+
+	s.client = &ecsClient{
+		region:  s.Config.Fargate.Region,
+		cluster: s.Config.Fargate.Cluster,
+	}
+
+	if s.Config.Fargate.TaskDefinitionTemplate != "" {
+		err = s.registerTaskDefinition()
+		if err != nil {
+			return err
+		}
+	} else {
+		if s.options.Image != "" {
+			s.Warningln("The image of the job is ignored without TaskDefinitionTemplate setting")
+		}
+		s.taskDefinition = s.Config.Fargate.TaskDefinition
+	}
+
+	options, err := s.getRunTaskOptions()
+	if err != nil {
+		return err
+	}
+
+	s.Println("Using Fargate executor with task definition", s.taskDefinition, "...")
+	s.task, err = s.client.RunTask(options)
+	if err != nil {
+		return err
+	}
+
+	s.Println("Waiting for task", s.task.taskID(), "to run...")
+	t, err := s.waitForTask()
+	if err != nil {
+		return err
+	}
+
+	host, port, err := s.getSSHAddress(t)
+	if err != nil {
+		return err
+	}
+
+	s.Println("Starting SSH command...")
+	s.sshCommand = ssh.Client{
+		Config:         *s.Config.SSH,
+		Stdout:         s.BuildTrace,
+		Stderr:         s.BuildTrace,
+		ConnectRetries: 30,
+	}
+	s.sshCommand.Host = host
+	s.sshCommand.Port = port
+
+	s.Debugln("Connecting to SSH server...")
+	return s.sshCommand.Connect()
+}
+
+func (s *executor) Run(cmd common.ExecutorCommand) error {
+	err := s.sshCommand.Run(ssh.Command{
+		Environment: s.BuildShell.Environment,
+		Command:     s.BuildShell.GetCommandWithArguments(),
+		Stdin:       cmd.Script,
+		Abort:       cmd.Abort,
+		ScriptFile:  ssh.ScriptFile(s.Build.ID),
+	})
+	if _, ok := err.(*ssh.ExitError); ok {
+		err = &common.BuildError{Inner: err}
+	}
+	return err
+}
+
+func (s *executor) Cleanup() {
+	s.sshCommand.Cleanup()
+
+	if s.tunnel != nil {
+		helpers.KillProcessGroup(s.tunnel)
+		s.tunnel.Wait()
+	}
+
+	if s.task != nil {
+		err := s.client.StopTask(s.task.TaskArn, "Job finished")
+		if err != nil {
+			s.Warningln("Failed to stop task", s.task.taskID()+":", err)
+		}
+	}
+
+	if s.registered {
+		err := s.client.DeregisterTaskDefinition(s.taskDefinition)
+		if err != nil {
+			s.Warningln("Failed to deregister task definition", s.taskDefinition+":", err)
+		}
+	}
+
+	s.AbstractExecutor.Cleanup()
+}
+
+func init() {
+	options := executors.ExecutorOptions{
+		DefaultBuildsDir: "/builds",
+		DefaultCacheDir:  "/cache",
+		SharedBuildsDir:  false,
+		Shell: common.ShellScriptInfo{
+			Shell:                        "bash",
+			Type:                         common.LoginShell,
+			RunnerCommand:                "gitlab-runner",
+			MaskedVariablesInEnvironment: true,
+		},
+		ShowHostname: false,
+	}
+
+	creator := func() common.Executor {
+		return &executor{
+			AbstractExecutor: executors.AbstractExecutor{
+				ExecutorOptions: options,
+			},
+		}
+	}
+
+	featuresUpdater := func(features *common.FeaturesInfo) {
+		features.Variables = true
+		features.Image = true
+	}
+
+	common.RegisterExecutor("fargate", executors.DefaultExecutorProvider{
+		Creator:         creator,
+		FeaturesUpdater: featuresUpdater,
+		DefaultShell:    options.Shell.Shell,
+	})
+}
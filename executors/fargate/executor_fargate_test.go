@@ -0,0 +1,156 @@
+package fargate
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/ssh"
+)
+
+func newTestExecutor(config *common.FargateConfig, sshConfig *ssh.Config) *executor {
+	runner := &common.RunnerConfig{
+		RunnerCredentials: common.RunnerCredentials{Token: "abcdef1234567890"},
+		RunnerSettings: common.RunnerSettings{
+			Fargate: config,
+			SSH:     sshConfig,
+		},
+	}
+	build := &common.Build{
+		GetBuildResponse: common.GetBuildResponse{ID: 10, ProjectID: 20},
+		Runner:           runner,
+	}
+
+	return &executor{
+		AbstractExecutor: executors.AbstractExecutor{
+			Config: *runner,
+			Build:  build,
+		},
+		client:         &ecsClient{cluster: config.Cluster},
+		taskDefinition: config.TaskDefinition,
+		task:           &task{TaskArn: "arn:aws:ecs:us-east-1:123456789012:task/ci/0123456789abcdef"},
+	}
+}
+
+func TestFargateExecutorRegistered(t *testing.T) {
+	executors := common.GetExecutors()
+	assert.Contains(t, executors, "fargate")
+}
+
+func TestGetRunTaskOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fargate-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	identityFile := filepath.Join(dir, "id_rsa")
+	err = ioutil.WriteFile(identityFile+".pub", []byte("ssh-rsa AAAAB3Nza runner\n"), 0600)
+	require.NoError(t, err)
+
+	e := newTestExecutor(&common.FargateConfig{
+		Cluster:        "ci",
+		TaskDefinition: "ci-build:3",
+		ContainerName:  "ci-coordinator",
+		Subnets:        []string{"subnet-1234"},
+		SecurityGroups: []string{"sg-1234"},
+		AssignPublicIP: true,
+		UseSSM:         true,
+	}, &ssh.Config{IdentityFile: identityFile})
+
+	options, err := e.getRunTaskOptions()
+	require.NoError(t, err)
+	assert.Equal(t, runTaskOptions{
+		TaskDefinition: "ci-build:3",
+		Network: networkConfiguration{
+			AwsVpcConfiguration: awsVpcConfiguration{
+				Subnets:        []string{"subnet-1234"},
+				SecurityGroups: []string{"sg-1234"},
+				AssignPublicIP: "ENABLED",
+			},
+		},
+		Overrides: taskOverride{
+			ContainerOverrides: []containerOverride{{
+				Name:        "ci-coordinator",
+				Environment: []keyValuePair{{Name: "SSH_PUBLIC_KEY", Value: "ssh-rsa AAAAB3Nza runner"}},
+			}},
+		},
+		StartedBy:     "runner-abcdef12",
+		EnableExecute: true,
+	}, options)
+}
+
+func TestGetRunTaskOptionsMissingPublicKey(t *testing.T) {
+	e := newTestExecutor(&common.FargateConfig{Cluster: "ci"}, &ssh.Config{IdentityFile: "/nonexistent/id_rsa"})
+	_, err := e.getRunTaskOptions()
+	assert.Error(t, err)
+}
+
+func TestRenderTaskDefinition(t *testing.T) {
+	template := []byte(`{
+  "family": "ci-build",
+  "containerDefinitions": [
+    {"name": "sidecar", "image": "redis:latest"},
+    {"name": "build", "image": "ci-build:latest"}
+  ]
+}`)
+
+	definition, err := renderTaskDefinition(template, "build", "ruby:2.4")
+	require.NoError(t, err)
+	assert.Equal(t, `{"containerDefinitions":[{"image":"redis:latest","name":"sidecar"},{"image":"ruby:2.4","name":"build"}],"family":"ci-build"}`, string(definition))
+
+	definition, err = renderTaskDefinition(template, "build", "")
+	require.NoError(t, err)
+	assert.Equal(t, `{"containerDefinitions":[{"image":"redis:latest","name":"sidecar"},{"image":"ci-build:latest","name":"build"}],"family":"ci-build"}`, string(definition))
+
+	_, err = renderTaskDefinition(template, "ci-coordinator", "ruby:2.4")
+	assert.Error(t, err)
+
+	_, err = renderTaskDefinition([]byte("{"), "build", "ruby:2.4")
+	assert.Error(t, err)
+}
+
+func TestWaitForTask(t *testing.T) {
+	oldPollInterval := taskPollInterval
+	taskPollInterval = time.Millisecond
+	defer func() {
+		taskPollInterval = oldPollInterval
+	}()
+
+	_, done := mockAWSCLI(runningTask, nil)
+	e := newTestExecutor(&common.FargateConfig{Cluster: "ci"}, &ssh.Config{})
+	task, err := e.waitForTask()
+	done()
+	require.NoError(t, err)
+	assert.Equal(t, "RUNNING", task.LastStatus)
+
+	_, done = mockAWSCLI(`{"tasks": [{"taskArn": "arn:aws:ecs:us-east-1:123456789012:task/ci/0123456789abcdef", "lastStatus": "STOPPED", "stoppedReason": "CannotPullContainerError"}]}`, nil)
+	_, err = e.waitForTask()
+	done()
+	assert.EqualError(t, err, "task 0123456789abcdef stopped: CannotPullContainerError")
+}
+
+func TestGetSSHAddress(t *testing.T) {
+	e := newTestExecutor(&common.FargateConfig{Cluster: "ci"}, &ssh.Config{Port: "2222"})
+	task := &task{
+		TaskArn: "arn:aws:ecs:us-east-1:123456789012:task/ci/0123456789abcdef",
+		Attachments: []taskAttachment{{
+			Type:    "ElasticNetworkInterface",
+			Details: []attachmentDetail{{Name: "privateIPv4Address", Value: "10.0.1.15"}},
+		}},
+	}
+
+	host, port, err := e.getSSHAddress(task)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.15", host)
+	assert.Equal(t, "2222", port)
+
+	task.Attachments = nil
+	_, _, err = e.getSSHAddress(task)
+	assert.EqualError(t, err, "task 0123456789abcdef has no private IP address")
+}
@@ -0,0 +1,424 @@
+package gcpbatch
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors"
+)
+
+// mountPath is where the bucket is mounted on the VMs and in the containers
+const mountPath = "/mnt/disks/ci"
+
+var (
+	jobPollInterval = 10 * time.Second
+	logPollInterval = 2 * time.Second
+	// logFlushTimeout limits the wait for the last lines of a job, which
+	// Cloud Logging makes available with a delay
+	logFlushTimeout = time.Minute
+
+	invalidNameChars = regexp.MustCompile("[^a-z0-9-]+")
+)
+
+type batchOptions struct {
+	Image string `json:"image"`
+}
+
+type executor struct {
+	executors.AbstractExecutor
+	client      *batchClient
+	options     batchOptions
+	image       string
+	machineType string
+	stage       int
+	jobs        []string
+	// secrets are the versions of the secrets holding the masked variables
+	secrets     map[string]string
+	secretNames []string
+}
+
+func (s *executor) bucketPath() string {
+	return strings.Trim(strings.TrimPrefix(s.Config.GCPBatch.Bucket, "gs://"), "/")
+}
+
+// jobPrefix returns the prefix of the names of the Batch jobs of the build,
+// which must contain only lowercase letters, numbers and hyphens
+func (s *executor) jobPrefix() string {
+	prefix := fmt.Sprintf("runner-%s-job-%d", s.Build.Runner.ShortDescription(), s.Build.ID)
+	return invalidNameChars.ReplaceAllString(strings.ToLower(prefix), "-")
+}
+
+func (s *executor) scriptsPath() string {
+	return "scripts/" + s.jobPrefix()
+}
+
+// overwriteMachineType checks for variable in order to overwrite the configured
+// machine type, as long as it complies to validation regular-expression, when
+// expression is empty the overwrite is disabled.
+func (s *executor) overwriteMachineType() error {
+	s.machineType = s.Config.GCPBatch.MachineType
+	if s.Config.GCPBatch.MachineTypeOverwriteAllowed == "" {
+		return nil
+	}
+
+	machineType := s.Build.Variables.Expand().Get("GCP_BATCH_MACHINE_TYPE_OVERWRITE")
+	if machineType == "" {
+		return nil
+	}
+
+	r, err := regexp.Compile(s.Config.GCPBatch.MachineTypeOverwriteAllowed)
+	if err != nil {
+		return err
+	}
+
+	if !r.MatchString(machineType) {
+		return fmt.Errorf("GCP_BATCH_MACHINE_TYPE_OVERWRITE='%s' does not match 'machine_type_overwrite_allowed': '%s'",
+			machineType, s.Config.GCPBatch.MachineTypeOverwriteAllowed)
+	}
+
+	s.Println("Overwriting configured machine type, from", s.machineType, "to", machineType)
+	s.machineType = machineType
+	return nil
+}
+
+// endMarker is printed by the job after its script, so the executor knows
+// when Cloud Logging has all the lines of the job
+func endMarker(name string) string {
+	return "gitlab-runner-end-of-" + name
+}
+
+func (s *executor) newJobSpec(name, image string, command []string, script string) *jobSpec {
+	config := s.Config.GCPBatch
+
+	// run the command with the script as its standard input
+	shellScript := `"$@" < ` + script + `; status=$?; echo ` + endMarker(name) + `; exit $status`
+	commands := append([]string{"-c", shellScript, "sh"}, command...)
+
+	var env *environment
+	if len(s.secrets) > 0 {
+		env = &environment{SecretVariables: s.secrets}
+	}
+
+	spec := &jobSpec{
+		TaskGroups: []taskGroup{{
+			TaskSpec: taskSpec{
+				Runnables: []runnable{{
+					Container: containerRunnable{
+						ImageURI:   image,
+						Entrypoint: "sh",
+						Commands:   commands,
+						Volumes:    []string{mountPath + ":" + mountPath},
+					},
+					Environment: env,
+				}},
+				Volumes: []volume{{
+					GCS:       gcsVolume{RemotePath: s.bucketPath()},
+					MountPath: mountPath,
+				}},
+			},
+			TaskCount: 1,
+		}},
+		AllocationPolicy: allocationPolicy{
+			Instances: []instancePolicyOrTemplate{{
+				Policy: instancePolicy{MachineType: s.machineType},
+			}},
+		},
+		Labels: map[string]string{
+			"gitlab-runner": invalidNameChars.ReplaceAllString(strings.ToLower(s.Build.Runner.ShortDescription()), "-"),
+			"gitlab-job-id": strconv.Itoa(s.Build.ID),
+		},
+		LogsPolicy: logsPolicy{Destination: "CLOUD_LOGGING"},
+	}
+
+	if config.Spot {
+		spec.AllocationPolicy.Instances[0].Policy.ProvisioningModel = "SPOT"
+	}
+	if config.ServiceAccount != "" {
+		spec.AllocationPolicy.ServiceAccount = &serviceAccount{Email: config.ServiceAccount}
+	}
+	if config.Network != "" || config.Subnetwork != "" || config.NoExternalIP {
+		spec.AllocationPolicy.Network = &networkPolicy{
+			NetworkInterfaces: []networkInterface{{
+				Network:      config.Network,
+				Subnetwork:   config.Subnetwork,
+				NoExternalIP: config.NoExternalIP,
+			}},
+		}
+	}
+	return spec
+}
+
+func (s *executor) Prepare(globalConfig *common.Config, config *common.RunnerConfig, build *common.Build) error {
+	if config.GCPBatch == nil {
+		return errors.New("Missing GCP Batch configuration")
+	}
+
+	if config.GCPBatch.Project == "" || config.GCPBatch.Location == "" || config.GCPBatch.Bucket == "" {
+		return errors.New("Missing Project, Location or Bucket setting from GCP Batch configuration")
+	}
+
+	err := s.AbstractExecutor.Prepare(globalConfig, config, build)
+	if err != nil {
+		return err
+	}
+
+	if s.BuildShell.PassFile {
+		return errors.New("GCP Batch doesn't support shells that require script file")
+	}
+
+	err = build.Options.Decode(&s.options)
+	if err != nil {
+		return err
+	}
+
+	s.image = s.Config.GCPBatch.Image
+	if s.options.Image != "" {
+		s.image = s.Build.GetAllVariables().ExpandValue(s.options.Image)
+		err = s.verifyAllowedImage(s.image)
+		if err != nil {
+			return err
+		}
+	}
+	if s.image == "" {
+		return errors.New("No image specified and no default set in config")
+	}
+
+	err = s.overwriteMachineType()
+	if err != nil {
+		return err
+	}
+
+	s.client = &batchClient{
+		project:  s.Config.GCPBatch.Project,
+		location: s.Config.GCPBatch.Location,
+	}
+
+	err = s.createSecrets()
+	if err != nil {
+		return err
+	}
+
+	s.Println("Using Google Cloud Batch executor with image", s.image, "...")
+	return nil
+}
+
+// createSecrets stores the masked variables in Secret Manager, so they are
+// given to the jobs in their environment instead of in the scripts
+func (s *executor) createSecrets() error {
+	for _, variable := range s.Build.GetAllVariables().Masked() {
+		name := fmt.Sprintf("%s-%d", s.jobPrefix(), len(s.secretNames))
+		version, err := s.client.CreateSecret(name, variable.Value)
+		if err != nil {
+			return err
+		}
+		s.secretNames = append(s.secretNames, name)
+
+		if s.secrets == nil {
+			s.secrets = make(map[string]string)
+		}
+		s.secrets[variable.Key] = version
+	}
+	return nil
+}
+
+// verifyAllowedImage checks the image of the build against allowed_images,
+// the images are allowed when it's empty
+func (s *executor) verifyAllowedImage(image string) error {
+	allowedImages := s.Config.GCPBatch.AllowedImages
+	if len(allowedImages) == 0 || image == s.Config.GCPBatch.Image {
+		return nil
+	}
+
+	for _, allowedImage := range allowedImages {
+		if ok, _ := filepath.Match(allowedImage, image); ok {
+			return nil
+		}
+	}
+
+	s.Println()
+	s.Errorln("The", image, "is not present on list of allowed images")
+	for _, allowedImage := range allowedImages {
+		s.Println("-", allowedImage)
+	}
+	s.Println()
+	return errors.New("invalid image")
+}
+
+// jobLogs copies the output of a job to the trace of the build, while the
+// job runs
+type jobLogs struct {
+	marker  string
+	written int
+	ended   bool
+}
+
+// writeLogs writes the lines of the job not written yet, and reports if the
+// job printed its end marker
+func (s *executor) writeLogs(j *job, logs *jobLogs) bool {
+	if j.UID == "" || logs.ended {
+		return logs.ended
+	}
+
+	lines, err := s.client.ReadLogs(j.UID)
+	if err != nil {
+		s.Warningln("Failed to read the logs of the job:", err)
+		return false
+	}
+
+	for ; logs.written < len(lines); logs.written++ {
+		line := strings.TrimSuffix(lines[logs.written], "\n")
+		if line == logs.marker {
+			logs.ended = true
+			break
+		}
+		fmt.Fprintln(s.BuildTrace, line)
+	}
+	return logs.ended
+}
+
+// flushLogs writes the last lines of the job, until its end marker
+func (s *executor) flushLogs(j *job, logs *jobLogs) {
+	timeout := time.After(logFlushTimeout)
+	for !s.writeLogs(j, logs) {
+		select {
+		case <-timeout:
+			s.Warningln("The end of the logs of the job is missing")
+			return
+		case <-time.After(logPollInterval):
+		}
+	}
+}
+
+func (s *executor) waitForJob(name string, logs *jobLogs, abort chan interface{}) (*job, error) {
+	for {
+		j, err := s.client.DescribeJob(name)
+		if err != nil {
+			return nil, err
+		}
+
+		switch j.Status.State {
+		case "SUCCEEDED", "FAILED":
+			return j, nil
+		}
+
+		s.writeLogs(j, logs)
+
+		select {
+		case <-abort:
+			s.client.DeleteJob(name)
+			return nil, errors.New("Aborted")
+		case <-time.After(jobPollInterval):
+		}
+	}
+}
+
+func (s *executor) Run(cmd common.ExecutorCommand) error {
+	image, command := s.image, s.BuildShell.DockerCommand
+	if cmd.Predefined {
+		image, command = s.Config.GCPBatch.GetHelperImage(), []string{"gitlab-runner-build"}
+	}
+
+	s.stage++
+	name := fmt.Sprintf("%s-%d", s.jobPrefix(), s.stage)
+	script := fmt.Sprintf("%s/%d.sh", s.scriptsPath(), s.stage)
+
+	scriptURL := "gs://" + s.bucketPath() + "/" + script
+	s.Debugln("Uploading script", script, "...")
+	err := s.client.UploadFile(scriptURL, cmd.Script)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err := s.client.RemoveFile(scriptURL)
+		s.Debugln("Removed script", script, "with", err)
+	}()
+
+	s.Debugln("Submitting job", name, "with image", image, "...")
+	_, err = s.client.SubmitJob(name, s.newJobSpec(name, image, command, mountPath+"/"+script))
+	if err != nil {
+		return err
+	}
+	s.jobs = append(s.jobs, name)
+
+	logs := &jobLogs{marker: endMarker(name)}
+	j, err := s.waitForJob(name, logs, cmd.Abort)
+	if err != nil {
+		return err
+	}
+
+	exitCode := j.exitCode()
+	if j.Status.State == "SUCCEEDED" || exitCode >= 0 {
+		// the script ran, so it printed the end marker
+		s.flushLogs(j, logs)
+	}
+
+	if j.Status.State == "SUCCEEDED" {
+		return nil
+	}
+	if exitCode > 0 {
+		return &common.BuildError{Inner: fmt.Errorf("exit code %d", exitCode)}
+	}
+	return fmt.Errorf("job %s failed: %s", name, j.failureReason())
+}
+
+func (s *executor) Cleanup() {
+	if s.client != nil {
+		for _, name := range s.jobs {
+			err := s.client.DeleteJob(name)
+			s.Debugln("Deleted job", name, "with", err)
+		}
+
+		if s.stage > 0 {
+			err := s.client.RemoveFiles("gs://" + s.bucketPath() + "/" + s.scriptsPath())
+			s.Debugln("Removed scripts with", err)
+		}
+
+		for _, name := range s.secretNames {
+			err := s.client.DeleteSecret(name)
+			s.Debugln("Deleted secret", name, "with", err)
+		}
+	}
+
+	s.AbstractExecutor.Cleanup()
+}
+
+func init() {
+	options := executors.ExecutorOptions{
+		DefaultBuildsDir: mountPath + "/builds",
+		DefaultCacheDir:  mountPath + "/cache",
+		SharedBuildsDir:  true,
+		Shell: common.ShellScriptInfo{
+			Shell:                        "bash",
+			Type:                         common.NormalShell,
+			RunnerCommand:                "/usr/bin/gitlab-runner-helper",
+			MaskedVariablesInEnvironment: true,
+		},
+		ShowHostname:     false,
+		SupportedOptions: []string{"image"},
+	}
+
+	creator := func() common.Executor {
+		return &executor{
+			AbstractExecutor: executors.AbstractExecutor{
+				ExecutorOptions: options,
+			},
+		}
+	}
+
+	featuresUpdater := func(features *common.FeaturesInfo) {
+		features.Variables = true
+		features.Image = true
+	}
+
+	common.RegisterExecutor("gcp-batch", executors.DefaultExecutorProvider{
+		Creator:         creator,
+		FeaturesUpdater: featuresUpdater,
+		DefaultShell:    options.Shell.Shell,
+	})
+}
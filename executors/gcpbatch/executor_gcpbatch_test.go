@@ -0,0 +1,179 @@
+package gcpbatch
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors"
+)
+
+func newTestExecutor(config *common.GCPBatchConfig, variables common.BuildVariables) *executor {
+	runner := &common.RunnerConfig{
+		RunnerCredentials: common.RunnerCredentials{Token: "ABCdef_1234567890"},
+		RunnerSettings:    common.RunnerSettings{GCPBatch: config},
+	}
+	build := &common.Build{
+		GetBuildResponse: common.GetBuildResponse{ID: 10, ProjectID: 20, Variables: variables},
+		Runner:           runner,
+	}
+
+	return &executor{
+		AbstractExecutor: executors.AbstractExecutor{
+			Config: *runner,
+			Build:  build,
+		},
+	}
+}
+
+func TestGCPBatchExecutorRegistered(t *testing.T) {
+	executors := common.GetExecutors()
+	assert.Contains(t, executors, "gcp-batch")
+}
+
+func TestJobPrefix(t *testing.T) {
+	e := newTestExecutor(&common.GCPBatchConfig{Bucket: "gs://ci-bucket/runner/"}, nil)
+	assert.Equal(t, "runner-abcdef-1-job-10", e.jobPrefix())
+	assert.Equal(t, "ci-bucket/runner", e.bucketPath())
+}
+
+func TestOverwriteMachineType(t *testing.T) {
+	tests := []struct {
+		allowed     string
+		overwrite   string
+		machineType string
+		err         bool
+	}{
+		{allowed: "", overwrite: "n2-standard-8", machineType: "e2-standard-4"},
+		{allowed: "^e2-", overwrite: "", machineType: "e2-standard-4"},
+		{allowed: "^e2-", overwrite: "e2-standard-8", machineType: "e2-standard-8"},
+		{allowed: "^e2-", overwrite: "n2-standard-8", err: true},
+	}
+
+	for _, test := range tests {
+		var variables common.BuildVariables
+		if test.overwrite != "" {
+			variables = append(variables, common.BuildVariable{Key: "GCP_BATCH_MACHINE_TYPE_OVERWRITE", Value: test.overwrite})
+		}
+		e := newTestExecutor(&common.GCPBatchConfig{
+			MachineType:                 "e2-standard-4",
+			MachineTypeOverwriteAllowed: test.allowed,
+		}, variables)
+
+		err := e.overwriteMachineType()
+		if test.err {
+			assert.Error(t, err, test.overwrite)
+			continue
+		}
+		assert.NoError(t, err, test.overwrite)
+		assert.Equal(t, test.machineType, e.machineType, test.overwrite)
+	}
+}
+
+func TestNewJobSpec(t *testing.T) {
+	e := newTestExecutor(&common.GCPBatchConfig{
+		Bucket:         "ci-bucket",
+		Spot:           true,
+		ServiceAccount: "ci@ci-project.iam.gserviceaccount.com",
+		NoExternalIP:   true,
+	}, nil)
+	e.machineType = "e2-standard-4"
+
+	spec := e.newJobSpec("runner-1", "ruby:2.1", []string{"gitlab-runner-build"}, "/mnt/disks/ci/scripts/1.sh")
+
+	require.Equal(t, 1, len(spec.TaskGroups))
+	assert.Equal(t, containerRunnable{
+		ImageURI:   "ruby:2.1",
+		Entrypoint: "sh",
+		Commands: []string{
+			"-c", `"$@" < /mnt/disks/ci/scripts/1.sh; status=$?; echo gitlab-runner-end-of-runner-1; exit $status`,
+			"sh", "gitlab-runner-build",
+		},
+		Volumes: []string{"/mnt/disks/ci:/mnt/disks/ci"},
+	}, spec.TaskGroups[0].TaskSpec.Runnables[0].Container)
+	assert.Equal(t, []volume{{GCS: gcsVolume{RemotePath: "ci-bucket"}, MountPath: "/mnt/disks/ci"}}, spec.TaskGroups[0].TaskSpec.Volumes)
+	assert.Equal(t, []instancePolicyOrTemplate{{
+		Policy: instancePolicy{MachineType: "e2-standard-4", ProvisioningModel: "SPOT"},
+	}}, spec.AllocationPolicy.Instances)
+	assert.Equal(t, &serviceAccount{Email: "ci@ci-project.iam.gserviceaccount.com"}, spec.AllocationPolicy.ServiceAccount)
+	require.NotNil(t, spec.AllocationPolicy.Network)
+	assert.True(t, spec.AllocationPolicy.Network.NetworkInterfaces[0].NoExternalIP)
+	assert.Equal(t, "10", spec.Labels["gitlab-job-id"])
+	assert.Equal(t, "CLOUD_LOGGING", spec.LogsPolicy.Destination)
+}
+
+func TestCreateSecrets(t *testing.T) {
+	calls, done := mockGcloudCLI("", nil)
+	defer done()
+
+	e := newTestExecutor(&common.GCPBatchConfig{Bucket: "ci-bucket"}, common.BuildVariables{
+		{Key: "PUBLIC", Value: "value", Public: true},
+		{Key: "TOKEN", Value: "secret", Masked: true},
+	})
+	e.client = &batchClient{project: "ci-project", location: "us-central1"}
+
+	require.NoError(t, e.createSecrets())
+	require.Equal(t, 1, len(*calls))
+	assert.Equal(t, []string{
+		"secrets", "create", "runner-abcdef-1-job-10-0", "--data-file", "-", "--replication-policy", "automatic",
+		"--project", "ci-project", "--format", "json",
+	}, (*calls)[0].args)
+	assert.Equal(t, "secret", (*calls)[0].stdin)
+
+	spec := e.newJobSpec("runner-1", "ruby:2.1", []string{"gitlab-runner-build"}, "/mnt/disks/ci/scripts/1.sh")
+	assert.Equal(t, &environment{SecretVariables: map[string]string{
+		"TOKEN": "projects/ci-project/secrets/runner-abcdef-1-job-10-0/versions/1",
+	}}, spec.TaskGroups[0].TaskSpec.Runnables[0].Environment)
+
+	e.Cleanup()
+	assert.Equal(t, []string{"secrets", "delete", "runner-abcdef-1-job-10-0", "--quiet", "--project", "ci-project", "--format", "json"}, (*calls)[len(*calls)-1].args)
+}
+
+func TestWriteLogs(t *testing.T) {
+	calls, done := mockGcloudCLI(`[{"textPayload": "Cloning repository..."}]`, nil)
+	defer done()
+
+	var trace bytes.Buffer
+	e := newTestExecutor(&common.GCPBatchConfig{Bucket: "ci-bucket"}, nil)
+	e.client = &batchClient{project: "ci-project", location: "us-central1"}
+	e.BuildTrace = &common.Trace{Writer: &trace}
+	e.BuildLogger = common.NewBuildLogger(e.BuildTrace, logrus.WithFields(logrus.Fields{}))
+
+	j := &job{UID: "runner-1-0123"}
+	logs := &jobLogs{marker: endMarker("runner-1")}
+	assert.False(t, e.writeLogs(j, logs))
+	assert.Equal(t, "Cloning repository...\n", trace.String())
+
+	done()
+	calls, done = mockGcloudCLI(`[
+		{"textPayload": "Cloning repository..."},
+		{"textPayload": "Job succeeded"},
+		{"textPayload": "gitlab-runner-end-of-runner-1"}
+	]`, nil)
+	e.flushLogs(j, logs)
+	assert.Equal(t, "Cloning repository...\nJob succeeded\n", trace.String(), "the lines are written once, without the marker")
+	assert.Equal(t, 1, len(*calls))
+	assert.True(t, e.writeLogs(j, logs))
+	assert.Equal(t, 1, len(*calls), "the logs aren't read after the marker")
+}
+
+func TestVerifyAllowedImage(t *testing.T) {
+	e := newTestExecutor(&common.GCPBatchConfig{
+		Image:         "ruby:2.1",
+		AllowedImages: []string{"ruby:*", "registry.example.com/*"},
+	}, nil)
+	e.BuildTrace = &common.Trace{Writer: &bytes.Buffer{}}
+	e.BuildLogger = common.NewBuildLogger(e.BuildTrace, logrus.WithFields(logrus.Fields{}))
+
+	assert.NoError(t, e.verifyAllowedImage("ruby:2.3"))
+	assert.NoError(t, e.verifyAllowedImage("registry.example.com/ci"))
+	assert.Error(t, e.verifyAllowedImage("alpine"))
+
+	e.Config.GCPBatch.AllowedImages = nil
+	assert.NoError(t, e.verifyAllowedImage("alpine"))
+}
@@ -0,0 +1,261 @@
+package gcpbatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// gcloudCLI runs the Google Cloud CLI. It's a variable, so tests can replace it.
+var gcloudCLI = func(stdin io.Reader, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	logrus.Debugf("Executing gcloud: %#v", args)
+	cmd := exec.Command("gcloud", args...)
+	cmd.Stdin = stdin
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+
+	if _, ok := err.(*exec.ExitError); ok {
+		err = fmt.Errorf("gcloud error: %s", strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.Bytes(), err
+}
+
+type gcsVolume struct {
+	RemotePath string `json:"remotePath"`
+}
+
+type volume struct {
+	GCS       gcsVolume `json:"gcs"`
+	MountPath string    `json:"mountPath"`
+}
+
+type containerRunnable struct {
+	ImageURI   string   `json:"imageUri"`
+	Entrypoint string   `json:"entrypoint"`
+	Commands   []string `json:"commands"`
+	Volumes    []string `json:"volumes"`
+}
+
+// environment holds the variables of the runnable. The secret ones are the
+// Secret Manager versions holding their values.
+type environment struct {
+	SecretVariables map[string]string `json:"secretVariables,omitempty"`
+}
+
+type runnable struct {
+	Container   containerRunnable `json:"container"`
+	Environment *environment      `json:"environment,omitempty"`
+}
+
+type taskSpec struct {
+	Runnables      []runnable `json:"runnables"`
+	Volumes        []volume   `json:"volumes"`
+	MaxRetryCount  int        `json:"maxRetryCount"`
+	MaxRunDuration string     `json:"maxRunDuration,omitempty"`
+}
+
+type taskGroup struct {
+	TaskSpec  taskSpec `json:"taskSpec"`
+	TaskCount int      `json:"taskCount"`
+}
+
+type instancePolicy struct {
+	MachineType       string `json:"machineType,omitempty"`
+	ProvisioningModel string `json:"provisioningModel,omitempty"`
+}
+
+type instancePolicyOrTemplate struct {
+	Policy instancePolicy `json:"policy"`
+}
+
+type serviceAccount struct {
+	Email string `json:"email"`
+}
+
+type networkInterface struct {
+	Network      string `json:"network,omitempty"`
+	Subnetwork   string `json:"subnetwork,omitempty"`
+	NoExternalIP bool   `json:"noExternalIpAddress,omitempty"`
+}
+
+type networkPolicy struct {
+	NetworkInterfaces []networkInterface `json:"networkInterfaces"`
+}
+
+type allocationPolicy struct {
+	Instances      []instancePolicyOrTemplate `json:"instances"`
+	ServiceAccount *serviceAccount            `json:"serviceAccount,omitempty"`
+	Network        *networkPolicy             `json:"network,omitempty"`
+}
+
+type logsPolicy struct {
+	Destination string `json:"destination"`
+}
+
+type jobSpec struct {
+	TaskGroups       []taskGroup       `json:"taskGroups"`
+	AllocationPolicy allocationPolicy  `json:"allocationPolicy"`
+	Labels           map[string]string `json:"labels,omitempty"`
+	LogsPolicy       logsPolicy        `json:"logsPolicy"`
+}
+
+type statusEvent struct {
+	Description string `json:"description"`
+	TaskState   string `json:"taskState"`
+}
+
+type jobStatus struct {
+	State        string        `json:"state"`
+	StatusEvents []statusEvent `json:"statusEvents"`
+}
+
+type job struct {
+	Name   string    `json:"name"`
+	UID    string    `json:"uid"`
+	Status jobStatus `json:"status"`
+}
+
+type logEntry struct {
+	TextPayload string `json:"textPayload"`
+}
+
+var exitCodeRegexp = regexp.MustCompile(`exit code (\d+)`)
+
+// exitCode returns the exit code of the failed task of the job, as reported
+// by its status events, or -1 when the task didn't run
+func (j *job) exitCode() int {
+	for i := len(j.Status.StatusEvents) - 1; i >= 0; i-- {
+		match := exitCodeRegexp.FindStringSubmatch(j.Status.StatusEvents[i].Description)
+		if match == nil {
+			continue
+		}
+		if code, err := strconv.Atoi(match[1]); err == nil {
+			return code
+		}
+	}
+	return -1
+}
+
+func (j *job) failureReason() string {
+	if len(j.Status.StatusEvents) == 0 {
+		return j.Status.State
+	}
+	return j.Status.StatusEvents[len(j.Status.StatusEvents)-1].Description
+}
+
+type batchClient struct {
+	project  string
+	location string
+}
+
+func (c *batchClient) run(stdin io.Reader, args ...string) ([]byte, error) {
+	args = append(args, "--project", c.project, "--format", "json")
+	return gcloudCLI(stdin, args...)
+}
+
+func (c *batchClient) SubmitJob(name string, spec *jobSpec) (*job, error) {
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := ioutil.TempFile("", "batch-job")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(file.Name())
+
+	_, err = file.Write(data)
+	file.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := c.run(nil, "batch", "jobs", "submit", name, "--location", c.location, "--config", file.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	var result job
+	err = json.Unmarshal(output, &result)
+	return &result, err
+}
+
+func (c *batchClient) DescribeJob(name string) (*job, error) {
+	output, err := c.run(nil, "batch", "jobs", "describe", name, "--location", c.location)
+	if err != nil {
+		return nil, err
+	}
+
+	var result job
+	err = json.Unmarshal(output, &result)
+	return &result, err
+}
+
+func (c *batchClient) DeleteJob(name string) error {
+	_, err := c.run(nil, "batch", "jobs", "delete", name, "--location", c.location, "--quiet")
+	return err
+}
+
+// ReadLogs returns the output of the tasks of the job, sent to Cloud Logging
+func (c *batchClient) ReadLogs(jobUID string) ([]string, error) {
+	filter := fmt.Sprintf(`logName="projects/%s/logs/batch_task_logs" AND labels.job_uid="%s"`, c.project, jobUID)
+	output, err := c.run(nil, "logging", "read", filter, "--order", "asc")
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []logEntry
+	err = json.Unmarshal(output, &entries)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		lines = append(lines, entry.TextPayload)
+	}
+	return lines, nil
+}
+
+// CreateSecret stores the value in Secret Manager, read from the standard
+// input, and returns the name of its version
+func (c *batchClient) CreateSecret(name string, value string) (string, error) {
+	_, err := c.run(strings.NewReader(value), "secrets", "create", name, "--data-file", "-", "--replication-policy", "automatic")
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("projects/%s/secrets/%s/versions/1", c.project, name), nil
+}
+
+func (c *batchClient) DeleteSecret(name string) error {
+	_, err := c.run(nil, "secrets", "delete", name, "--quiet")
+	return err
+}
+
+func (c *batchClient) UploadFile(url string, content string) error {
+	_, err := c.run(strings.NewReader(content), "storage", "cp", "-", url)
+	return err
+}
+
+func (c *batchClient) RemoveFile(url string) error {
+	_, err := c.run(nil, "storage", "rm", url)
+	return err
+}
+
+func (c *batchClient) RemoveFiles(url string) error {
+	_, err := c.run(nil, "storage", "rm", "--recursive", url)
+	return err
+}
@@ -0,0 +1,92 @@
+package gcpbatch
+
+import (
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type gcloudCall struct {
+	args  []string
+	stdin string
+}
+
+func mockGcloudCLI(output string, err error) (*[]gcloudCall, func()) {
+	var calls []gcloudCall
+	oldGcloudCLI := gcloudCLI
+	gcloudCLI = func(stdin io.Reader, args ...string) ([]byte, error) {
+		call := gcloudCall{args: args}
+		if stdin != nil {
+			data, _ := ioutil.ReadAll(stdin)
+			call.stdin = string(data)
+		}
+		calls = append(calls, call)
+		return []byte(output), err
+	}
+	return &calls, func() {
+		gcloudCLI = oldGcloudCLI
+	}
+}
+
+func TestJobExitCode(t *testing.T) {
+	j := &job{Status: jobStatus{
+		State: "FAILED",
+		StatusEvents: []statusEvent{
+			{Description: "Job state is set from QUEUED to SCHEDULED for job projects/123/locations/us-central1/jobs/runner-1."},
+			{Description: "Task state is updated from RUNNING to FAILED on zones/us-central1-a/instances/5678 with exit code 2.", TaskState: "FAILED"},
+			{Description: "Job state is set from RUNNING to FAILED for job projects/123/locations/us-central1/jobs/runner-1."},
+		},
+	}}
+	assert.Equal(t, 2, j.exitCode())
+	assert.Equal(t, "Job state is set from RUNNING to FAILED for job projects/123/locations/us-central1/jobs/runner-1.", j.failureReason())
+
+	j = &job{Status: jobStatus{State: "FAILED"}}
+	assert.Equal(t, -1, j.exitCode())
+	assert.Equal(t, "FAILED", j.failureReason())
+}
+
+func TestReadLogs(t *testing.T) {
+	calls, done := mockGcloudCLI(`[{"textPayload": "Cloning repository..."}, {"textPayload": "Job succeeded"}]`, nil)
+	defer done()
+
+	c := &batchClient{project: "ci-project", location: "us-central1"}
+	lines, err := c.ReadLogs("runner-1-0123")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Cloning repository...", "Job succeeded"}, lines)
+
+	require.Equal(t, 1, len(*calls))
+	assert.Equal(t, []string{
+		"logging", "read",
+		`logName="projects/ci-project/logs/batch_task_logs" AND labels.job_uid="runner-1-0123"`,
+		"--order", "asc",
+		"--project", "ci-project", "--format", "json",
+	}, (*calls)[0].args)
+}
+
+func TestUploadFile(t *testing.T) {
+	calls, done := mockGcloudCLI("", nil)
+	defer done()
+
+	c := &batchClient{project: "ci-project", location: "us-central1"}
+	err := c.UploadFile("gs://ci-bucket/scripts/1.sh", "echo hello")
+	require.NoError(t, err)
+
+	require.Equal(t, 1, len(*calls))
+	assert.Equal(t, []string{"storage", "cp", "-", "gs://ci-bucket/scripts/1.sh", "--project", "ci-project", "--format", "json"}, (*calls)[0].args)
+	assert.Equal(t, "echo hello", (*calls)[0].stdin)
+}
+
+func TestDescribeJob(t *testing.T) {
+	calls, done := mockGcloudCLI(`{"name": "projects/ci-project/locations/us-central1/jobs/runner-1", "uid": "runner-1-0123", "status": {"state": "RUNNING"}}`, nil)
+	defer done()
+
+	c := &batchClient{project: "ci-project", location: "us-central1"}
+	j, err := c.DescribeJob("runner-1")
+	require.NoError(t, err)
+	assert.Equal(t, "runner-1-0123", j.UID)
+	assert.Equal(t, "RUNNING", j.Status.State)
+	assert.Equal(t, []string{"batch", "jobs", "describe", "runner-1", "--location", "us-central1", "--project", "ci-project", "--format", "json"}, (*calls)[0].args)
+}
@@ -0,0 +1,220 @@
+package kubernetes
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+	"k8s.io/kubernetes/pkg/client/restclient"
+	client "k8s.io/kubernetes/pkg/client/unversioned"
+)
+
+// logStreamRetries is the number of times the log stream is reopened
+// without receiving any output before the command is considered as lost
+const logStreamRetries = 5
+
+// AttachOptions declare the arguments accepted by the Attach command
+type AttachOptions struct {
+	Namespace     string
+	PodName       string
+	ContainerName string
+
+	In io.Reader
+
+	Executor RemoteExecutor
+	Client   *client.Client
+	Config   *restclient.Config
+}
+
+// Run writes the input to the stdin of the main process of the container.
+// The container is created with StdinOnce disabled, so the process doesn't
+// receive EOF when the attach finishes.
+func (p *AttachOptions) Run() error {
+	req := p.Client.RESTClient.Post().
+		Resource("pods").
+		Name(p.PodName).
+		Namespace(p.Namespace).
+		SubResource("attach").
+		Param("container", p.ContainerName)
+	req.VersionedParams(&api.PodAttachOptions{
+		Container: p.ContainerName,
+		Stdin:     true,
+	}, api.ParameterCodec)
+
+	return p.Executor.Execute("POST", req.URL(), p.Config, p.In, nil, nil, false)
+}
+
+// scriptMarker delimits output of a single script in the container log
+type scriptMarker string
+
+func (m scriptMarker) start() string {
+	return string(m) + " start"
+}
+
+func (m scriptMarker) exit() string {
+	return string(m) + " exit "
+}
+
+// wrap runs the script in a subshell of the long-running container shell,
+// so the `exit` of the script doesn't terminate the container, and reports
+// its exit code
+func (m scriptMarker) wrap(script string) string {
+	if !strings.HasSuffix(script, "\n") {
+		script += "\n"
+	}
+	return fmt.Sprintf("echo '%s'\n(\n%s) </dev/null 2>&1\necho \"%s$?\"\n", m.start(), script, m.exit())
+}
+
+// logFollower reads the container log, remembering the last seen position,
+// so the stream can be reopened after a failure without duplicating output
+type logFollower struct {
+	kubeClient *client.Client
+	pod        *api.Pod
+	container  string
+
+	lastTimestamp time.Time
+	linesAtLast   int
+}
+
+func parseLogLine(line string) (time.Time, string) {
+	parts := strings.SplitN(line, " ", 2)
+	timestamp, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil || len(parts) < 2 {
+		return time.Time{}, line
+	}
+	return timestamp, parts[1]
+}
+
+func (f *logFollower) openStream() (io.ReadCloser, error) {
+	opts := &api.PodLogOptions{
+		Container:  f.container,
+		Follow:     true,
+		Timestamps: true,
+	}
+	if !f.lastTimestamp.IsZero() {
+		since := unversioned.NewTime(f.lastTimestamp)
+		opts.SinceTime = &since
+	}
+
+	return f.kubeClient.Pods(f.pod.Namespace).GetLogs(f.pod.Name, opts).Stream()
+}
+
+// isNew filters out lines already received from the previous stream. The
+// since time has a precision of seconds, so lines with the exact timestamp
+// of the last seen line are counted.
+func (f *logFollower) isNew(timestamp time.Time, skip *int) bool {
+	switch {
+	case timestamp.Before(f.lastTimestamp):
+		return false
+	case timestamp.Equal(f.lastTimestamp):
+		if *skip > 0 {
+			*skip--
+			return false
+		}
+		f.linesAtLast++
+	default:
+		f.lastTimestamp = timestamp
+		f.linesAtLast = 1
+	}
+	return true
+}
+
+// read copies output of the script to out. It returns when the exit marker
+// is found, or when the stream ends.
+func (f *logFollower) read(stream io.Reader, marker scriptMarker, started *bool, out io.Writer) (done bool, exitCode int, received bool, err error) {
+	skip := f.linesAtLast
+	reader := bufio.NewReader(stream)
+
+	for {
+		line, readErr := reader.ReadString('\n')
+		if line != "" {
+			timestamp, text := parseLogLine(line)
+			if f.isNew(timestamp, &skip) {
+				received = true
+
+				if !*started {
+					*started = strings.Contains(text, marker.start())
+				} else if i := strings.Index(text, marker.exit()); i >= 0 {
+					io.WriteString(out, text[:i])
+					exitCode, err = strconv.Atoi(strings.TrimSpace(text[i+len(marker.exit()):]))
+					return true, exitCode, received, err
+				} else {
+					io.WriteString(out, text)
+				}
+			}
+		}
+
+		if readErr != nil {
+			return false, 0, received, nil
+		}
+	}
+}
+
+func (f *logFollower) checkTerminated() error {
+	pod, err := f.kubeClient.Pods(f.pod.Namespace).Get(f.pod.Name)
+	if err != nil {
+		// the API may be unavailable for a moment, let the stream retry
+		return nil
+	}
+
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name == f.container && status.State.Terminated != nil {
+			return fmt.Errorf("container %s terminated with exit code %d before script finished",
+				f.container, status.State.Terminated.ExitCode)
+		}
+	}
+	return nil
+}
+
+// Follow streams output of the script identified by marker until it
+// finishes, reopening the log stream when the connection is lost
+func (f *logFollower) Follow(ctx context.Context, marker scriptMarker, out io.Writer, retryInterval time.Duration) (int, error) {
+	started := false
+
+	for retries := 0; retries <= logStreamRetries; retries++ {
+		stream, err := f.openStream()
+		if err == nil {
+			streamDone := make(chan struct{})
+			go func() {
+				select {
+				case <-ctx.Done():
+					stream.Close()
+				case <-streamDone:
+				}
+			}()
+
+			done, exitCode, received, readErr := f.read(stream, marker, &started, out)
+			close(streamDone)
+			stream.Close()
+
+			if done {
+				return exitCode, readErr
+			}
+			if received {
+				retries = 0
+			}
+		}
+
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+
+		if err := f.checkTerminated(); err != nil {
+			return 0, err
+		}
+
+		select {
+		case <-time.After(retryInterval):
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+
+	return 0, fmt.Errorf("lost output of container %s: log stream closed before script finished", f.container)
+}
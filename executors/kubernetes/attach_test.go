@@ -0,0 +1,68 @@
+package kubernetes
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScriptMarkerWrap(t *testing.T) {
+	marker := scriptMarker("marker")
+
+	assert.Equal(t, "echo 'marker start'\n(\necho test\n) </dev/null 2>&1\necho \"marker exit $?\"\n",
+		marker.wrap("echo test"))
+	assert.Equal(t, "echo 'marker start'\n(\necho test\n) </dev/null 2>&1\necho \"marker exit $?\"\n",
+		marker.wrap("echo test\n"))
+}
+
+func TestParseLogLine(t *testing.T) {
+	timestamp, text := parseLogLine("2017-03-01T10:00:00.123456789Z some output\n")
+	assert.Equal(t, time.Date(2017, 3, 1, 10, 0, 0, 123456789, time.UTC), timestamp.UTC())
+	assert.Equal(t, "some output\n", text)
+
+	timestamp, text = parseLogLine("no timestamp\n")
+	assert.True(t, timestamp.IsZero())
+	assert.Equal(t, "no timestamp\n", text)
+}
+
+func TestLogFollowerRead(t *testing.T) {
+	marker := scriptMarker("marker")
+	follower := &logFollower{}
+
+	first := strings.Join([]string{
+		"2017-03-01T10:00:00.1Z output of previous script",
+		"2017-03-01T10:00:01.1Z marker start",
+		"2017-03-01T10:00:01.2Z line 1",
+		"2017-03-01T10:00:01.2Z line 2",
+		"",
+	}, "\n")
+
+	out := new(bytes.Buffer)
+	started := false
+	done, _, received, err := follower.read(strings.NewReader(first), marker, &started, out)
+	require.NoError(t, err)
+	assert.False(t, done)
+	assert.True(t, received)
+	assert.True(t, started)
+	assert.Equal(t, "line 1\nline 2\n", out.String())
+
+	// reopened stream starts from the second of the last seen line
+	second := strings.Join([]string{
+		"2017-03-01T10:00:01.1Z marker start",
+		"2017-03-01T10:00:01.2Z line 1",
+		"2017-03-01T10:00:01.2Z line 2",
+		"2017-03-01T10:00:01.2Z line 3",
+		"2017-03-01T10:00:02Z no newline marker exit 1",
+		"",
+	}, "\n")
+
+	done, exitCode, _, err := follower.read(strings.NewReader(second), marker, &started, out)
+	require.NoError(t, err)
+	assert.True(t, done)
+	assert.Equal(t, 1, exitCode)
+	assert.Equal(t, "line 1\nline 2\nline 3\nno newline ", out.String())
+}
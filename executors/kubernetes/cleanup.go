@@ -0,0 +1,309 @@
+package kubernetes
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"k8s.io/kubernetes/pkg/api"
+	client "k8s.io/kubernetes/pkg/client/unversioned"
+	"k8s.io/kubernetes/pkg/labels"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+const runnerLabel = "gitlab-runner"
+const buildLabel = "gitlab-runner-build"
+const managerLabel = "gitlab-runner-manager"
+
+const defaultCleanupGracePeriod = common.DefaultTimeout
+
+// activeObjects tracks kubernetes objects owned by jobs handled by this
+// process; everything else labeled with the runner token is an orphan
+type activeObjects struct {
+	objects map[string]bool
+	lock    sync.Mutex
+}
+
+func (a *activeObjects) key(kind, namespace, name string) string {
+	return kind + "/" + namespace + "/" + name
+}
+
+func (a *activeObjects) Add(kind, namespace, name string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.objects == nil {
+		a.objects = make(map[string]bool)
+	}
+	a.objects[a.key(kind, namespace, name)] = true
+}
+
+func (a *activeObjects) Remove(kind, namespace, name string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	delete(a.objects, a.key(kind, namespace, name))
+}
+
+func (a *activeObjects) Contains(kind, namespace, name string) bool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	return a.objects[a.key(kind, namespace, name)]
+}
+
+var active activeObjects
+
+// orphanCollectorRun is a running collector, stopped when the runner didn't
+// use the namespace for longer than the grace period
+type orphanCollectorRun struct {
+	lastUsed time.Time
+}
+
+var collectors = make(map[string]*orphanCollectorRun)
+var collectorsLock sync.Mutex
+
+var invalidLabelChars = regexp.MustCompile("[^-A-Za-z0-9_.]+")
+
+// getManagerID returns the ID of the runner process in the labels of the
+// objects. It must stay the same when the process is restarted, so it's the
+// configured manager_id or the short runner token.
+func getManagerID(config *common.RunnerConfig) string {
+	id := config.ShortDescription()
+	if config.Kubernetes != nil && config.Kubernetes.ManagerID != "" {
+		id = config.Kubernetes.ManagerID
+	}
+
+	id = invalidLabelChars.ReplaceAllString(id, "-")
+	if len(id) > 63 {
+		id = id[:63]
+	}
+	return strings.Trim(id, "-_.")
+}
+
+func getObjectLabels(build *common.Build) map[string]string {
+	return map[string]string{
+		runnerLabel:  build.Runner.ShortDescription(),
+		buildLabel:   strconv.Itoa(build.ID),
+		managerLabel: getManagerID(build.Runner),
+	}
+}
+
+type orphanCollector struct {
+	kubeClient      *client.Client
+	namespace       string
+	namespacePerJob bool
+	runAsJob        bool
+	runner          string
+	gracePeriod     time.Duration
+	log             *logrus.Entry
+}
+
+func (c *orphanCollector) isOrphan(kind string, meta api.ObjectMeta, now time.Time) bool {
+	if active.Contains(kind, meta.Namespace, meta.Name) {
+		return false
+	}
+	return now.Sub(meta.CreationTimestamp.Time) > c.gracePeriod
+}
+
+func (c *orphanCollector) listOptions() api.ListOptions {
+	return api.ListOptions{
+		LabelSelector: labels.SelectorFromSet(labels.Set{runnerLabel: c.runner}),
+	}
+}
+
+func (c *orphanCollector) collectPods(now time.Time) error {
+	pods, err := c.kubeClient.Pods(c.namespace).List(c.listOptions())
+	if err != nil {
+		return err
+	}
+
+	for _, pod := range pods.Items {
+		if !c.isOrphan("pod", pod.ObjectMeta, now) {
+			continue
+		}
+
+		c.log.Infoln("Removing orphaned pod", pod.Name)
+		if err := c.kubeClient.Pods(c.namespace).Delete(pod.Name, nil); err != nil {
+			c.log.WithError(err).Warningln("Failed to remove orphaned pod", pod.Name)
+		}
+	}
+	return nil
+}
+
+func (c *orphanCollector) collectJobs(now time.Time) error {
+	jobs, err := c.kubeClient.Batch().Jobs(c.namespace).List(c.listOptions())
+	if err != nil {
+		return err
+	}
+
+	orphanDependents := false
+	for _, job := range jobs.Items {
+		if !c.isOrphan("job", job.ObjectMeta, now) {
+			continue
+		}
+
+		c.log.Infoln("Removing orphaned job", job.Name)
+		err := c.kubeClient.Batch().Jobs(c.namespace).Delete(job.Name, &api.DeleteOptions{OrphanDependents: &orphanDependents})
+		if err != nil {
+			c.log.WithError(err).Warningln("Failed to remove orphaned job", job.Name)
+		}
+	}
+	return nil
+}
+
+func (c *orphanCollector) collectSecrets(now time.Time) error {
+	secrets, err := c.kubeClient.Secrets(c.namespace).List(c.listOptions())
+	if err != nil {
+		return err
+	}
+
+	for _, secret := range secrets.Items {
+		if !c.isOrphan("secret", secret.ObjectMeta, now) {
+			continue
+		}
+
+		c.log.Infoln("Removing orphaned secret", secret.Name)
+		if err := c.kubeClient.Secrets(c.namespace).Delete(secret.Name); err != nil {
+			c.log.WithError(err).Warningln("Failed to remove orphaned secret", secret.Name)
+		}
+	}
+	return nil
+}
+
+func (c *orphanCollector) collectConfigMaps(now time.Time) error {
+	configMaps, err := c.kubeClient.ConfigMaps(c.namespace).List(c.listOptions())
+	if err != nil {
+		return err
+	}
+
+	for _, configMap := range configMaps.Items {
+		if !c.isOrphan("configmap", configMap.ObjectMeta, now) {
+			continue
+		}
+
+		c.log.Infoln("Removing orphaned config map", configMap.Name)
+		if err := c.kubeClient.ConfigMaps(c.namespace).Delete(configMap.Name); err != nil {
+			c.log.WithError(err).Warningln("Failed to remove orphaned config map", configMap.Name)
+		}
+	}
+	return nil
+}
+
+func (c *orphanCollector) collectNamespaces(now time.Time) error {
+	namespaces, err := c.kubeClient.Namespaces().List(c.listOptions())
+	if err != nil {
+		return err
+	}
+
+	for _, namespace := range namespaces.Items {
+		if namespace.Status.Phase == api.NamespaceTerminating || !c.isOrphan("namespace", namespace.ObjectMeta, now) {
+			continue
+		}
+
+		c.log.Infoln("Removing orphaned namespace", namespace.Name)
+		if err := c.kubeClient.Namespaces().Delete(namespace.Name); err != nil {
+			c.log.WithError(err).Warningln("Failed to remove orphaned namespace", namespace.Name)
+		}
+	}
+	return nil
+}
+
+// Collect removes all objects labeled with the runner token that are not used
+// by any of the jobs handled by this process and are older than the grace
+// period. The jobs of the other processes sharing the token are not known, so
+// the grace period must be longer than any of their jobs.
+func (c *orphanCollector) Collect(now time.Time) {
+	collectors := []func(time.Time) error{c.collectPods, c.collectSecrets, c.collectConfigMaps}
+	if c.runAsJob {
+		collectors = append(collectors, c.collectJobs)
+	}
+	if c.namespacePerJob {
+		collectors = append(collectors, c.collectNamespaces)
+	}
+
+	for _, collect := range collectors {
+		if err := collect(now); err != nil {
+			c.log.WithError(err).Warningln("Failed to list objects for orphans cleanup")
+		}
+	}
+}
+
+func runOrphanCollector(config *common.RunnerConfig, namespace, key string, run *orphanCollectorRun) {
+	interval := time.Duration(config.Kubernetes.CleanupInterval) * time.Second
+	gracePeriod := time.Duration(config.Kubernetes.CleanupGracePeriod) * time.Second
+	if gracePeriod <= 0 {
+		gracePeriod = defaultCleanupGracePeriod * time.Second
+	}
+
+	for {
+		kubeClient, err := getKubeClient(config.Kubernetes)
+		if err != nil {
+			config.Log().WithError(err).Warningln("Failed to connect to Kubernetes for orphans cleanup")
+		} else {
+			collector := &orphanCollector{
+				kubeClient:      kubeClient,
+				namespace:       namespace,
+				namespacePerJob: config.Kubernetes.NamespacePerJob,
+				runAsJob:        config.Kubernetes.RunAsJob,
+				runner:          config.ShortDescription(),
+				gracePeriod:     gracePeriod,
+				log:             config.Log().WithField("namespace", namespace),
+			}
+			collector.Collect(time.Now())
+			closeKubeClient(kubeClient)
+		}
+
+		// the objects of the last job were collected once they were older
+		// than the grace period, the next job starts a new collector
+		if stopIdleOrphanCollector(key, run, gracePeriod+interval) {
+			return
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+func stopIdleOrphanCollector(key string, run *orphanCollectorRun, idleTimeout time.Duration) bool {
+	collectorsLock.Lock()
+	defer collectorsLock.Unlock()
+
+	if time.Since(run.lastUsed) <= idleTimeout {
+		return false
+	}
+	if collectors[key] == run {
+		delete(collectors, key)
+	}
+	return true
+}
+
+// startOrphanCollector starts periodic removal of orphaned objects in the
+// namespace, once for every runner using that namespace
+func startOrphanCollector(config *common.RunnerConfig, namespace string) {
+	if config.Kubernetes.CleanupInterval <= 0 {
+		return
+	}
+
+	collectorsLock.Lock()
+	defer collectorsLock.Unlock()
+
+	key := config.UniqueID() + "/" + namespace
+	if run := collectors[key]; run != nil {
+		run.lastUsed = time.Now()
+		return
+	}
+
+	run := &orphanCollectorRun{lastUsed: time.Now()}
+	collectors[key] = run
+
+	// the collector outlives the job, so it needs its own copy of the config
+	runnerConfig := *config
+	kubernetesConfig := *config.Kubernetes
+	runnerConfig.Kubernetes = &kubernetesConfig
+
+	go runOrphanCollector(&runnerConfig, namespace, key, run)
+}
@@ -0,0 +1,152 @@
+package kubernetes
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/testapi"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+	"k8s.io/kubernetes/pkg/client/restclient"
+	client "k8s.io/kubernetes/pkg/client/unversioned"
+	"k8s.io/kubernetes/pkg/client/unversioned/fake"
+	"k8s.io/kubernetes/pkg/runtime"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+func TestGetObjectLabels(t *testing.T) {
+	build := &common.Build{
+		GetBuildResponse: common.GetBuildResponse{
+			ID: 1234,
+		},
+		Runner: &common.RunnerConfig{
+			RunnerCredentials: common.RunnerCredentials{
+				Token: "abcdef1234567890",
+			},
+		},
+	}
+
+	assert.Equal(t, map[string]string{
+		"gitlab-runner":         "abcdef12",
+		"gitlab-runner-build":   "1234",
+		"gitlab-runner-manager": "abcdef12",
+	}, getObjectLabels(build))
+}
+
+func TestOrphanCollector(t *testing.T) {
+	version := testapi.Default.GroupVersion().Version
+	codec := testapi.Default.Codec()
+	now := time.Now()
+
+	newPod := func(name string, age time.Duration) api.Pod {
+		return api.Pod{
+			ObjectMeta: api.ObjectMeta{
+				Name:              name,
+				Namespace:         "test-ns",
+				CreationTimestamp: unversioned.NewTime(now.Add(-age)),
+			},
+		}
+	}
+
+	pods := &api.PodList{
+		Items: []api.Pod{
+			newPod("orphaned", 2*time.Hour),
+			newPod("active", 2*time.Hour),
+			newPod("recent", time.Minute),
+		},
+	}
+
+	active.Add("pod", "test-ns", "active")
+	defer active.Remove("pod", "test-ns", "active")
+
+	var deleted []string
+	clientFunc := func(req *http.Request) (*http.Response, error) {
+		var body runtime.Object
+		switch p, m := req.URL.Path, req.Method; {
+		case m == "GET" && p == "/api/"+version+"/namespaces/test-ns/pods":
+			assert.Equal(t, "gitlab-runner=abcdef12", req.URL.Query().Get("labelSelector"))
+			body = pods
+		case m == "GET" && p == "/api/"+version+"/namespaces/test-ns/secrets":
+			body = &api.SecretList{}
+		case m == "GET" && p == "/api/"+version+"/namespaces/test-ns/configmaps":
+			body = &api.ConfigMapList{}
+		case m == "DELETE":
+			deleted = append(deleted, p)
+			body = &unversioned.Status{Status: unversioned.StatusSuccess}
+		default:
+			return nil, fmt.Errorf("unexpected request. method: %s, path: %s", m, p)
+		}
+
+		data, err := runtime.Encode(codec, body)
+		require.NoError(t, err)
+
+		resp := &http.Response{StatusCode: 200, Body: FakeReadCloser{
+			Reader: bytes.NewBuffer(data),
+		}}
+		resp.Header = make(http.Header)
+		resp.Header.Add("Content-Type", "application/json")
+		return resp, nil
+	}
+
+	c := client.NewOrDie(&restclient.Config{ContentConfig: restclient.ContentConfig{GroupVersion: &unversioned.GroupVersion{Version: version}}})
+	fakeClient := fake.RESTClient{
+		Codec:  codec,
+		Client: fake.CreateHTTPClient(clientFunc),
+	}
+	c.Client = fakeClient.Client
+
+	collector := &orphanCollector{
+		kubeClient:  c,
+		namespace:   "test-ns",
+		runner:      "abcdef12",
+		gracePeriod: time.Hour,
+		log:         logrus.WithFields(logrus.Fields{}),
+	}
+	collector.Collect(now)
+
+	assert.Equal(t, []string{"/api/" + version + "/namespaces/test-ns/pods/orphaned"}, deleted)
+}
+
+func TestStopIdleOrphanCollector(t *testing.T) {
+	run := &orphanCollectorRun{lastUsed: time.Now()}
+	collectorsLock.Lock()
+	collectors["test"] = run
+	collectorsLock.Unlock()
+
+	assert.False(t, stopIdleOrphanCollector("test", run, time.Hour))
+
+	run.lastUsed = time.Now().Add(-2 * time.Hour)
+	assert.True(t, stopIdleOrphanCollector("test", run, time.Hour))
+	collectorsLock.Lock()
+	_, ok := collectors["test"]
+	collectorsLock.Unlock()
+	assert.False(t, ok, "the next job starts a new collector")
+}
+
+func TestGetManagerID(t *testing.T) {
+	config := &common.RunnerConfig{
+		RunnerCredentials: common.RunnerCredentials{
+			Token: "abcdef1234567890",
+		},
+		RunnerSettings: common.RunnerSettings{
+			Kubernetes: &common.KubernetesConfig{},
+		},
+	}
+	assert.Equal(t, "abcdef12", getManagerID(config))
+
+	config.Kubernetes.ManagerID = "runner/manager 1"
+	assert.Equal(t, "runner-manager-1", getManagerID(config))
+
+	config.Kubernetes.ManagerID = "." + strings.Repeat("a", 70)
+	id := getManagerID(config)
+	assert.Equal(t, strings.Repeat("a", 62), id)
+}
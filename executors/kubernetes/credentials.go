@@ -0,0 +1,109 @@
+package kubernetes
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/fsouza/go-dockerclient"
+	"k8s.io/kubernetes/pkg/api"
+)
+
+type dockerConfigEntry struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Email    string `json:"email,omitempty"`
+	Auth     string `json:"auth"`
+}
+
+type dockerConfigJSON struct {
+	Auths map[string]dockerConfigEntry `json:"auths"`
+}
+
+// getDockerAuthConfigs returns registry credentials from DOCKER_AUTH_CONFIG,
+// which take precedence over the credentials sent with the job
+func (s *executor) getDockerAuthConfigs() map[string]dockerConfigEntry {
+	auths := make(map[string]dockerConfigEntry)
+
+	add := func(server string, config docker.AuthConfiguration) {
+		auths[server] = dockerConfigEntry{
+			Username: config.Username,
+			Password: config.Password,
+			Email:    config.Email,
+			Auth:     base64.StdEncoding.EncodeToString([]byte(config.Username + ":" + config.Password)),
+		}
+	}
+
+	for _, credentials := range s.Build.Credentials {
+		if credentials.Type != "registry" {
+			continue
+		}
+		add(credentials.URL, docker.AuthConfiguration{
+			Username: credentials.Username,
+			Password: credentials.Password,
+		})
+	}
+
+	if authConfig := s.Build.GetDockerAuthConfig(); authConfig != "" {
+		configs, err := docker.NewAuthConfigurations(bytes.NewBufferString(authConfig))
+		if err != nil {
+			s.Warningln("Failed to parse DOCKER_AUTH_CONFIG:", err)
+		} else {
+			for server, config := range configs.Configs {
+				add(server, config)
+			}
+		}
+	}
+
+	return auths
+}
+
+// setupCredentials creates a temporary secret holding the registry
+// credentials of the job, used by the build pod to pull images
+func (s *executor) setupCredentials() error {
+	if s.credentials != nil {
+		return nil
+	}
+
+	auths := s.getDockerAuthConfigs()
+	if len(auths) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(dockerConfigJSON{Auths: auths})
+	if err != nil {
+		return err
+	}
+
+	secret, err := s.kubeClient.Secrets(s.Config.Kubernetes.Namespace).Create(&api.Secret{
+		ObjectMeta: api.ObjectMeta{
+			GenerateName: s.Build.ProjectUniqueName() + "-",
+			Namespace:    s.Config.Kubernetes.Namespace,
+			Labels:       getObjectLabels(s.Build),
+		},
+		Type: api.SecretTypeDockerConfigJson,
+		Data: map[string][]byte{
+			api.DockerConfigJsonKey: data,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	s.credentials = secret
+	active.Add("secret", secret.Namespace, secret.Name)
+
+	return nil
+}
+
+func (s *executor) cleanupCredentials() {
+	if s.credentials == nil {
+		return
+	}
+
+	err := s.kubeClient.Secrets(s.credentials.Namespace).Delete(s.credentials.Name)
+	if err != nil {
+		s.Errorln("Error cleaning up secret:", err.Error())
+	}
+	active.Remove("secret", s.credentials.Namespace, s.credentials.Name)
+}
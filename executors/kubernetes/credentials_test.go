@@ -0,0 +1,114 @@
+package kubernetes
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/testapi"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+	"k8s.io/kubernetes/pkg/client/restclient"
+	client "k8s.io/kubernetes/pkg/client/unversioned"
+	"k8s.io/kubernetes/pkg/client/unversioned/fake"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors"
+)
+
+const testDockerAuthConfig = `{"auths":{"registry.local":{"auth":"dXNlcjpwYXNz"},"https://index.docker.io/v1/":{"auth":"aHViOnNlY3JldA=="}}}`
+
+func newCredentialsTestExecutor(variables ...common.BuildVariable) *executor {
+	return &executor{
+		AbstractExecutor: executors.AbstractExecutor{
+			Config: common.RunnerConfig{
+				RunnerSettings: common.RunnerSettings{
+					Kubernetes: &common.KubernetesConfig{
+						Namespace: "test-ns",
+					},
+				},
+			},
+			Build: &common.Build{
+				GetBuildResponse: common.GetBuildResponse{
+					Variables: variables,
+					Credentials: []common.BuildResponseCredentials{
+						{Type: "registry", URL: "registry.gitlab.com", Username: "gitlab-ci-token", Password: "job-token"},
+						{Type: "registry", URL: "registry.local", Username: "job", Password: "job-pass"},
+					},
+				},
+				Runner: &common.RunnerConfig{},
+			},
+		},
+	}
+}
+
+func TestGetDockerAuthConfigs(t *testing.T) {
+	s := newCredentialsTestExecutor(common.BuildVariable{Key: "DOCKER_AUTH_CONFIG", Value: testDockerAuthConfig})
+
+	auths := s.getDockerAuthConfigs()
+	assert.Equal(t, map[string]dockerConfigEntry{
+		"registry.gitlab.com":         {Username: "gitlab-ci-token", Password: "job-token", Auth: "Z2l0bGFiLWNpLXRva2VuOmpvYi10b2tlbg=="},
+		"registry.local":              {Username: "user", Password: "pass", Auth: "dXNlcjpwYXNz"},
+		"https://index.docker.io/v1/": {Username: "hub", Password: "secret", Auth: "aHViOnNlY3JldA=="},
+	}, auths)
+}
+
+func TestSetupCredentials(t *testing.T) {
+	version := testapi.Default.GroupVersion().Version
+	codec := testapi.Default.Codec()
+
+	var created *api.Secret
+	clientFunc := func(req *http.Request) (*http.Response, error) {
+		switch p, m := req.URL.Path, req.Method; {
+		case m == "POST" && p == "/api/"+version+"/namespaces/test-ns/secrets":
+			data, err := ioutil.ReadAll(req.Body)
+			require.NoError(t, err)
+
+			created = new(api.Secret)
+			require.NoError(t, json.Unmarshal(data, created))
+			created.Name = "created-secret"
+			data, err = json.Marshal(created)
+			require.NoError(t, err)
+
+			resp := &http.Response{StatusCode: 200, Body: FakeReadCloser{
+				Reader: bytes.NewBuffer(data),
+			}}
+			resp.Header = make(http.Header)
+			resp.Header.Add("Content-Type", "application/json")
+			return resp, nil
+		default:
+			return nil, fmt.Errorf("unexpected request. method: %s, path: %s", m, p)
+		}
+	}
+
+	c := client.NewOrDie(&restclient.Config{ContentConfig: restclient.ContentConfig{GroupVersion: &unversioned.GroupVersion{Version: version}}})
+	fakeClient := fake.RESTClient{
+		Codec:  codec,
+		Client: fake.CreateHTTPClient(clientFunc),
+	}
+	c.Client = fakeClient.Client
+
+	s := newCredentialsTestExecutor()
+	s.kubeClient = c
+
+	require.NoError(t, s.setupCredentials())
+	require.NotNil(t, created)
+	assert.Equal(t, api.SecretTypeDockerConfigJson, created.Type)
+	assert.Equal(t, getObjectLabels(s.Build), created.Labels)
+
+	var config dockerConfigJSON
+	require.NoError(t, json.Unmarshal(created.Data[api.DockerConfigJsonKey], &config))
+	_, ok := config.Auths["registry.gitlab.com"]
+	assert.True(t, ok)
+
+	require.NotNil(t, s.credentials)
+	assert.Equal(t, "created-secret", s.credentials.Name)
+	assert.True(t, active.Contains("secret", "test-ns", "created-secret"))
+	active.Remove("secret", "test-ns", "created-secret")
+}
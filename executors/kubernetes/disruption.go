@@ -0,0 +1,161 @@
+package kubernetes
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/net/context"
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/errors"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+// podDisruptionTarget is the condition set by newer clusters on pods that
+// are about to be removed because of preemption, eviction or node shutdown
+const podDisruptionTarget api.PodConditionType = "DisruptionTarget"
+
+// disruptionReasons are reasons of failed pods that were stopped by the
+// cluster, as opposed to a failure of the job
+var disruptionReasons = map[string]bool{
+	"Evicted":    true,
+	"Preempting": true,
+	"Shutdown":   true,
+	"Terminated": true,
+	"NodeLost":   true,
+}
+
+// podDisruptionError is returned when the build pod was stopped by the
+// cluster. It is not a BuildError, so it's reported as a system failure
+// and not as a failure of the script.
+type podDisruptionError struct {
+	Reason  string
+	Message string
+}
+
+func (e *podDisruptionError) Error() string {
+	return fmt.Sprintf("build pod was disrupted (%s): %s", e.Reason, e.Message)
+}
+
+func getPodDisruption(pod *api.Pod) *podDisruptionError {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == podDisruptionTarget && condition.Status == api.ConditionTrue {
+			return &podDisruptionError{Reason: condition.Reason, Message: condition.Message}
+		}
+	}
+
+	if pod.Status.Phase == api.PodFailed && disruptionReasons[pod.Status.Reason] {
+		return &podDisruptionError{Reason: pod.Status.Reason, Message: pod.Status.Message}
+	}
+
+	if pod.DeletionTimestamp != nil {
+		return &podDisruptionError{Reason: "Deleted", Message: "the pod is being deleted"}
+	}
+
+	for _, status := range pod.Status.ContainerStatuses {
+		terminated := status.State.Terminated
+		if terminated != nil && terminated.Reason == "OOMKilled" {
+			return &podDisruptionError{
+				Reason:  terminated.Reason,
+				Message: fmt.Sprintf("container %s was killed because it ran out of memory", status.Name),
+			}
+		}
+	}
+
+	return nil
+}
+
+// retryable returns true when the job may succeed on a new pod. Containers
+// killed because of too little memory would be killed again.
+func (e *podDisruptionError) retryable() bool {
+	return e.Reason != "OOMKilled"
+}
+
+// checkPodDisruption returns an error when the build pod was preempted,
+// evicted or removed while the job was running
+func (s *executor) checkPodDisruption() error {
+	if s.pod == nil {
+		return nil
+	}
+
+	pod, err := s.kubeClient.Pods(s.pod.Namespace).Get(s.pod.Name)
+	if errors.IsNotFound(err) {
+		return &podDisruptionError{Reason: "Deleted", Message: "the pod was deleted"}
+	} else if err != nil {
+		return nil
+	}
+
+	if disruption := getPodDisruption(pod); disruption != nil {
+		return disruption
+	}
+	return nil
+}
+
+// watchPod polls the build pod until the context is done, and reports
+// the first disruption of the pod
+func (s *executor) watchPod(ctx context.Context) <-chan error {
+	disruptions := make(chan error, 1)
+	go func() {
+		ticker := time.NewTicker(time.Duration(s.Config.Kubernetes.GetPollInterval()) * time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			if disruption := s.checkPodDisruption(); disruption != nil {
+				disruptions <- disruption
+				return
+			}
+		}
+	}()
+	return disruptions
+}
+
+// asSystemError returns the disruptions of the build pod which weren't
+// retried as system failures of the job
+func asSystemError(err error) error {
+	if disruption, ok := err.(*podDisruptionError); ok {
+		return &common.SystemError{Inner: disruption}
+	}
+	return err
+}
+
+// canRedispatch returns true when the stage failed because of a disruption
+// of the build pod and there are retries left
+func (s *executor) canRedispatch(err error) bool {
+	disruption, ok := err.(*podDisruptionError)
+	if !ok || !disruption.retryable() {
+		return false
+	}
+	return s.disruptionRetries < s.Config.Kubernetes.DisruptionRetries
+}
+
+// redispatch removes the disrupted pod and runs the already finished stages
+// of the job, followed by cmd, on a new pod
+func (s *executor) redispatch(cmd common.ExecutorCommand) error {
+	s.deleteJob()
+	if s.pod != nil {
+		err := s.kubeClient.Pods(s.pod.Namespace).Delete(s.pod.Name, nil)
+		if err != nil && !errors.IsNotFound(err) {
+			s.Warningln("Error removing the disrupted pod:", err.Error())
+		}
+		active.Remove("pod", s.pod.Namespace, s.pod.Name)
+	}
+
+	s.pod = nil
+	s.logFollowers = nil
+	s.servicesReady = false
+	s.podStarted = false
+
+	for _, previous := range s.history {
+		previous.Abort = cmd.Abort
+		if err := s.runCommand(previous); err != nil {
+			return err
+		}
+	}
+	return s.runCommand(cmd)
+}
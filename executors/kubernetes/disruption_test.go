@@ -0,0 +1,115 @@
+package kubernetes
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors"
+)
+
+func TestGetPodDisruption(t *testing.T) {
+	now := unversioned.Now()
+
+	tests := map[string]struct {
+		pod      api.Pod
+		expected *podDisruptionError
+	}{
+		"running": {
+			pod: api.Pod{Status: api.PodStatus{Phase: api.PodRunning}},
+		},
+		"failed": {
+			pod: api.Pod{Status: api.PodStatus{Phase: api.PodFailed, Reason: "Error"}},
+		},
+		"evicted": {
+			pod: api.Pod{Status: api.PodStatus{
+				Phase:   api.PodFailed,
+				Reason:  "Evicted",
+				Message: "The node was low on resource: memory.",
+			}},
+			expected: &podDisruptionError{Reason: "Evicted", Message: "The node was low on resource: memory."},
+		},
+		"preempted": {
+			pod: api.Pod{Status: api.PodStatus{
+				Phase: api.PodRunning,
+				Conditions: []api.PodCondition{
+					{Type: api.PodReady, Status: api.ConditionTrue},
+					{Type: podDisruptionTarget, Status: api.ConditionTrue, Reason: "PreemptionByScheduler", Message: "preempted by a higher priority pod"},
+				},
+			}},
+			expected: &podDisruptionError{Reason: "PreemptionByScheduler", Message: "preempted by a higher priority pod"},
+		},
+		"deleted": {
+			pod: api.Pod{
+				ObjectMeta: api.ObjectMeta{DeletionTimestamp: &now},
+				Status:     api.PodStatus{Phase: api.PodRunning},
+			},
+			expected: &podDisruptionError{Reason: "Deleted", Message: "the pod is being deleted"},
+		},
+		"oom killed": {
+			pod: api.Pod{Status: api.PodStatus{
+				Phase: api.PodRunning,
+				ContainerStatuses: []api.ContainerStatus{
+					{Name: "helper", State: api.ContainerState{Running: &api.ContainerStateRunning{}}},
+					{Name: "build", State: api.ContainerState{Terminated: &api.ContainerStateTerminated{Reason: "OOMKilled", ExitCode: 137}}},
+				},
+			}},
+			expected: &podDisruptionError{Reason: "OOMKilled", Message: "container build was killed because it ran out of memory"},
+		},
+	}
+
+	for name, test := range tests {
+		assert.Equal(t, test.expected, getPodDisruption(&test.pod), name)
+	}
+}
+
+func TestPodDisruptionError(t *testing.T) {
+	var err error = &podDisruptionError{Reason: "Evicted", Message: "out of disk"}
+	assert.EqualError(t, err, "build pod was disrupted (Evicted): out of disk")
+
+	err = asSystemError(err)
+	assert.IsType(t, &common.SystemError{}, err)
+	assert.Equal(t, common.RunnerSystemFailure, common.GetFailureReason(err))
+	assert.EqualError(t, err, "build pod was disrupted (Evicted): out of disk")
+
+	buildError := &common.BuildError{Inner: errors.New("exit code 1")}
+	assert.Equal(t, buildError, asSystemError(buildError))
+	assert.Equal(t, common.ScriptFailure, common.GetFailureReason(buildError))
+}
+
+func TestCanRedispatch(t *testing.T) {
+	tests := map[string]struct {
+		err      error
+		retries  int
+		attempts int
+		expected bool
+	}{
+		"no error":          {retries: 1},
+		"build error":       {err: &common.BuildError{}, retries: 1},
+		"retries disabled":  {err: &podDisruptionError{Reason: "Evicted"}},
+		"evicted":           {err: &podDisruptionError{Reason: "Evicted"}, retries: 1, expected: true},
+		"retries exhausted": {err: &podDisruptionError{Reason: "Evicted"}, retries: 2, attempts: 2},
+		"oom killed":        {err: &podDisruptionError{Reason: "OOMKilled"}, retries: 1},
+		"shutdown":          {err: &podDisruptionError{Reason: "Shutdown"}, retries: 3, attempts: 2, expected: true},
+	}
+
+	for name, test := range tests {
+		e := &executor{
+			AbstractExecutor: executors.AbstractExecutor{
+				Config: common.RunnerConfig{
+					RunnerSettings: common.RunnerSettings{
+						Kubernetes: &common.KubernetesConfig{
+							DisruptionRetries: test.retries,
+						},
+					},
+				},
+			},
+			disruptionRetries: test.attempts,
+		}
+		assert.Equal(t, test.expected, e.canRedispatch(test.err), name)
+	}
+}
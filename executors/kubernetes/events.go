@@ -0,0 +1,73 @@
+package kubernetes
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"k8s.io/kubernetes/pkg/api"
+	client "k8s.io/kubernetes/pkg/client/unversioned"
+)
+
+type eventsByTime []api.Event
+
+func (e eventsByTime) Len() int      { return len(e) }
+func (e eventsByTime) Swap(i, j int) { e[i], e[j] = e[j], e[i] }
+func (e eventsByTime) Less(i, j int) bool {
+	return e[i].LastTimestamp.Before(e[j].LastTimestamp)
+}
+
+// getPodEvents returns the events of the pod, oldest first
+func getPodEvents(c *client.Client, pod *api.Pod) ([]api.Event, error) {
+	kind := "Pod"
+	fieldSelector := c.Events(pod.Namespace).GetFieldSelector(&pod.Name, &pod.Namespace, &kind, nil)
+
+	list, err := c.Events(pod.Namespace).List(api.ListOptions{FieldSelector: fieldSelector})
+	if err != nil {
+		return nil, err
+	}
+
+	events := eventsByTime(list.Items)
+	sort.Sort(events)
+	return events, nil
+}
+
+// writePodEvents prints the events of the pod in the same form as
+// `kubectl describe pod`, so the reason why the pod doesn't start, like
+// a failed scheduling or image pull, can be found in the job trace
+func writePodEvents(out io.Writer, events []api.Event) {
+	if len(events) == 0 {
+		return
+	}
+
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "Type\tReason\tCount\tFrom\tMessage")
+	for _, event := range events {
+		count := event.Count
+		if count == 0 {
+			count = 1
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", event.Type, event.Reason, count, event.Source.Component, event.Message)
+	}
+	w.Flush()
+}
+
+// printPodEvents prints the events of the build pod in the job trace
+func (s *executor) printPodEvents() {
+	if s.pod == nil {
+		return
+	}
+
+	events, err := getPodEvents(s.kubeClient, s.pod)
+	if err != nil {
+		s.Warningln("Unable to get events of pod", s.pod.Name, ":", err.Error())
+		return
+	}
+	if len(events) == 0 {
+		return
+	}
+
+	s.Println("Events of pod", s.pod.Namespace+"/"+s.pod.Name, ":")
+	writePodEvents(s.BuildTrace, events)
+}
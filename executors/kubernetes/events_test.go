@@ -0,0 +1,45 @@
+package kubernetes
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+)
+
+func TestWritePodEvents(t *testing.T) {
+	now := time.Now()
+	events := eventsByTime{
+		{
+			Type:          api.EventTypeWarning,
+			Reason:        "FailedScheduling",
+			Message:       "0/3 nodes are available: 3 Insufficient cpu.",
+			Source:        api.EventSource{Component: "default-scheduler"},
+			Count:         4,
+			LastTimestamp: unversioned.NewTime(now),
+		},
+		{
+			Type:          api.EventTypeNormal,
+			Reason:        "Scheduled",
+			Message:       "Successfully assigned pod to node-1",
+			Source:        api.EventSource{Component: "default-scheduler"},
+			LastTimestamp: unversioned.NewTime(now.Add(-time.Minute)),
+		},
+	}
+
+	buf := new(bytes.Buffer)
+	writePodEvents(buf, events)
+	assert.Equal(t, "Type     Reason            Count  From               Message\n"+
+		"Warning  FailedScheduling  4      default-scheduler  0/3 nodes are available: 3 Insufficient cpu.\n"+
+		"Normal   Scheduled         1      default-scheduler  Successfully assigned pod to node-1\n", buf.String())
+
+	assert.True(t, events.Less(1, 0))
+	assert.False(t, events.Less(0, 1))
+
+	buf.Reset()
+	writePodEvents(buf, nil)
+	assert.Empty(t, buf.String())
+}
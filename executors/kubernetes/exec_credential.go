@@ -0,0 +1,120 @@
+package kubernetes
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/kubernetes/pkg/client/restclient"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+// execCredential is the output of a credential plugin, in the format used
+// by kubectl
+type execCredential struct {
+	Status *struct {
+		Token                 string     `json:"token"`
+		ClientCertificateData string     `json:"clientCertificateData"`
+		ClientKeyData         string     `json:"clientKeyData"`
+		ExpirationTimestamp   *time.Time `json:"expirationTimestamp"`
+	} `json:"status"`
+}
+
+func (c *execCredential) expired() bool {
+	if c.Status.ExpirationTimestamp == nil {
+		return false
+	}
+	// renew the credentials a bit earlier, so they don't expire during a request
+	return time.Now().Add(time.Minute).After(*c.Status.ExpirationTimestamp)
+}
+
+var execCredentials = struct {
+	sync.Mutex
+	cache map[string]*execCredential
+}{cache: make(map[string]*execCredential)}
+
+func runCredentialPlugin(config *common.KubernetesExecCredential) (*execCredential, error) {
+	cmd := exec.Command(config.Command, config.Args...)
+	cmd.Env = os.Environ()
+	for key, value := range config.Env {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
+
+	stderr := new(bytes.Buffer)
+	cmd.Stderr = stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("exec credential plugin %s failed: %v: %s", config.Command, err, strings.TrimSpace(stderr.String()))
+	}
+
+	credential := &execCredential{}
+	if err = json.Unmarshal(output, credential); err != nil {
+		return nil, fmt.Errorf("invalid output of exec credential plugin %s: %v", config.Command, err)
+	}
+	if credential.Status == nil {
+		return nil, fmt.Errorf("exec credential plugin %s didn't return status", config.Command)
+	}
+	return credential, nil
+}
+
+// getExecCredential returns the credentials returned by the plugin, which
+// are cached until they expire
+func getExecCredential(config *common.KubernetesExecCredential) (*execCredential, error) {
+	key := strings.Join(append([]string{config.Command}, config.Args...), " ")
+	var env []string
+	for name, value := range config.Env {
+		env = append(env, name+"="+value)
+	}
+	sort.Strings(env)
+	key += "\n" + strings.Join(env, "\n")
+
+	execCredentials.Lock()
+	defer execCredentials.Unlock()
+
+	credential := execCredentials.cache[key]
+	if credential != nil && !credential.expired() {
+		return credential, nil
+	}
+
+	credential, err := runCredentialPlugin(config)
+	if err != nil {
+		return nil, err
+	}
+
+	execCredentials.cache[key] = credential
+	return credential, nil
+}
+
+// setupAuth adds the bearer token or the credentials returned by the exec
+// credential plugin to the configuration of the client
+func setupAuth(restConfig *restclient.Config, config *common.KubernetesConfig) error {
+	if config.BearerToken != "" {
+		restConfig.BearerToken = config.BearerToken
+	}
+
+	if config.ExecCredential == nil {
+		return nil
+	}
+
+	credential, err := getExecCredential(config.ExecCredential)
+	if err != nil {
+		return err
+	}
+
+	if credential.Status.Token != "" {
+		restConfig.BearerToken = credential.Status.Token
+	}
+	if credential.Status.ClientCertificateData != "" {
+		restConfig.TLSClientConfig.CertData = []byte(credential.Status.ClientCertificateData)
+		restConfig.TLSClientConfig.KeyData = []byte(credential.Status.ClientKeyData)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/kubernetes/pkg/client/restclient"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+func TestSetupAuthBearerToken(t *testing.T) {
+	restConfig := &restclient.Config{Host: "host"}
+	err := setupAuth(restConfig, &common.KubernetesConfig{BearerToken: "token"})
+	require.NoError(t, err)
+	assert.Equal(t, "token", restConfig.BearerToken)
+}
+
+func TestSetupAuthExecCredential(t *testing.T) {
+	config := &common.KubernetesConfig{
+		BearerToken: "static-token",
+		ExecCredential: &common.KubernetesExecCredential{
+			Command: "sh",
+			Args:    []string{"-c", `echo "{\"kind\":\"ExecCredential\",\"status\":{\"token\":\"$TOKEN\"}}"`},
+			Env:     map[string]string{"TOKEN": "plugin-token"},
+		},
+	}
+
+	restConfig := &restclient.Config{Host: "host"}
+	require.NoError(t, setupAuth(restConfig, config))
+	assert.Equal(t, "plugin-token", restConfig.BearerToken)
+
+	config.ExecCredential.Env["TOKEN"] = "other-token"
+	require.NoError(t, setupAuth(restConfig, config))
+	assert.Equal(t, "other-token", restConfig.BearerToken)
+}
+
+func TestSetupAuthExecCredentialFailure(t *testing.T) {
+	config := &common.KubernetesConfig{
+		ExecCredential: &common.KubernetesExecCredential{
+			Command: "sh",
+			Args:    []string{"-c", "echo no credentials >&2; exit 1"},
+		},
+	}
+
+	err := setupAuth(&restclient.Config{}, config)
+	assert.EqualError(t, err, "exec credential plugin sh failed: exit status 1: no credentials")
+
+	config.ExecCredential.Args = []string{"-c", "echo '{}'"}
+	err = setupAuth(&restclient.Config{}, config)
+	assert.EqualError(t, err, "exec credential plugin sh didn't return status")
+}
+
+func TestExecCredentialExpired(t *testing.T) {
+	credential := &execCredential{}
+	require.NoError(t, json.Unmarshal([]byte(`{"status":{"token":"token"}}`), credential))
+	assert.False(t, credential.expired())
+
+	expiration := time.Now().Add(30 * time.Second)
+	credential.Status.ExpirationTimestamp = &expiration
+	assert.True(t, credential.expired())
+
+	expiration = time.Now().Add(time.Hour)
+	assert.False(t, credential.expired())
+}
@@ -2,11 +2,14 @@ package kubernetes
 
 import (
 	"fmt"
+	"path"
 	"regexp"
 	"strings"
+	"time"
 
 	"golang.org/x/net/context"
 	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/apis/batch"
 	client "k8s.io/kubernetes/pkg/client/unversioned"
 
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
@@ -17,9 +20,10 @@ var (
 	executorOptions = executors.ExecutorOptions{
 		SharedBuildsDir: false,
 		Shell: common.ShellScriptInfo{
-			Shell:         "bash",
-			Type:          common.NormalShell,
-			RunnerCommand: "/usr/bin/gitlab-runner-helper",
+			Shell:                        "bash",
+			Type:                         common.NormalShell,
+			RunnerCommand:                "/usr/bin/gitlab-runner-helper",
+			MaskedVariablesInEnvironment: true,
 		},
 		ShowHostname:     true,
 		SupportedOptions: []string{"image", "services", "artifacts", "cache"},
@@ -34,11 +38,20 @@ type kubernetesOptions struct {
 type executor struct {
 	executors.AbstractExecutor
 
-	kubeClient *client.Client
-	pod        *api.Pod
-	options    *kubernetesOptions
+	kubeClient  *client.Client
+	pod         *api.Pod
+	job         *batch.Job
+	credentials *api.Secret
+	variables   *api.Secret
+	namespace   *api.Namespace
+	options     *kubernetesOptions
 
-	namespaceOverwrite string
+	namespacePrefix string
+
+	namespaceOverwrite      string
+	serviceAccountOverwrite string
+	nodeSelectorOverwrite   map[string]string
+	tolerationsOverwrite    []api.Toleration
 
 	buildLimits     api.ResourceList
 	serviceLimits   api.ResourceList
@@ -47,6 +60,14 @@ type executor struct {
 	serviceRequests api.ResourceList
 	helperRequests  api.ResourceList
 	pullPolicy      common.KubernetesPullPolicy
+
+	logFollowers  map[string]*logFollower
+	scripts       int
+	servicesReady bool
+	podStarted    bool
+
+	history           []common.ExecutorCommand
+	disruptionRetries int
 }
 
 func (s *executor) setupResources() error {
@@ -95,6 +116,11 @@ func (s *executor) Prepare(globalConfig *common.Config, config *common.RunnerCon
 		return err
 	}
 
+	// the Kubernetes config is shared by all the jobs of the runner, it's
+	// copied before it's changed for the job, like its service account
+	kubernetesConfig := *s.Config.Kubernetes
+	s.Config.Kubernetes = &kubernetesConfig
+
 	if s.BuildShell.PassFile {
 		return fmt.Errorf("kubernetes doesn't support shells that require script file")
 	}
@@ -115,20 +141,63 @@ func (s *executor) Prepare(globalConfig *common.Config, config *common.RunnerCon
 		return err
 	}
 
+	if _, err = s.Config.Kubernetes.ExecutionStrategy.Get(); err != nil {
+		return err
+	}
+
+	if err = s.checkDNSConfig(); err != nil {
+		return err
+	}
+
 	if err = s.overwriteNamespace(build); err != nil {
 		return err
 	}
 
+	if err = s.mapServiceAccount(build); err != nil {
+		return err
+	}
+
+	if err = s.overwriteServiceAccount(build); err != nil {
+		return err
+	}
+
+	if err = s.overwriteScheduling(build); err != nil {
+		return err
+	}
+
+	// the per-job namespace is named after the namespace configured
+	// for the job, before it's defaulted to "default"
+	s.namespacePrefix = s.getNamespacePrefix()
+
 	if err = s.checkDefaults(); err != nil {
 		return err
 	}
 
+	// the namespace of the job is set up with the build pod, this is still
+	// the base namespace of the runner
+	startOrphanCollector(config, s.Config.Kubernetes.Namespace)
+
 	s.Println("Using Kubernetes executor with image", s.options.Image, "...")
 
 	return nil
 }
 
 func (s *executor) Run(cmd common.ExecutorCommand) error {
+	err := s.runCommand(cmd)
+	for s.canRedispatch(err) {
+		s.disruptionRetries++
+		s.Warningln(err.Error())
+		s.Warningln(fmt.Sprintf("Retrying the job on a new pod (%d of %d)...", s.disruptionRetries, s.Config.Kubernetes.DisruptionRetries))
+		err = s.redispatch(cmd)
+	}
+
+	if err == nil {
+		s.history = append(s.history, cmd)
+	}
+	return asSystemError(err)
+}
+
+func (s *executor) runCommand(cmd common.ExecutorCommand) error {
 	s.Debugln("Starting Kubernetes command...")
 
 	if s.pod == nil {
@@ -144,13 +213,40 @@ func (s *executor) Run(cmd common.ExecutorCommand) error {
 		containerName = "helper"
 	}
 
+	run := s.runInContainer
+	if strategy, _ := s.Config.Kubernetes.ExecutionStrategy.Get(); strategy == common.ExecutionStrategyAttach {
+		run = s.runInContainerWithAttach
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
+	disruptions := s.watchPod(ctx)
+	errc := make(chan error, 1)
+	go func() {
+		if !s.servicesReady {
+			if err := s.waitForServices(ctx); err != nil {
+				errc <- err
+				return
+			}
+			s.servicesReady = true
+		}
+		errc <- <-run(ctx, containerName, cmd.Script)
+	}()
+
 	select {
-	case err := <-s.runInContainer(ctx, containerName, cmd.Script):
+	case err := <-errc:
+		cancel()
+		if err != nil {
+			if disruption := s.checkPodDisruption(); disruption != nil {
+				return disruption
+			}
+		}
 		if err != nil && strings.Contains(err.Error(), "executing in Docker Container") {
 			return &common.BuildError{Inner: err}
 		}
 		return err
+	case disruption := <-disruptions:
+		cancel()
+		return disruption
 	case <-cmd.Abort:
 		cancel()
 		return fmt.Errorf("build aborted")
@@ -158,20 +254,26 @@ func (s *executor) Run(cmd common.ExecutorCommand) error {
 }
 
 func (s *executor) Cleanup() {
+	// the pod of the job is removed together with the job
+	podOfJob := s.job != nil
+	s.deleteJob()
 	if s.pod != nil {
-		err := s.kubeClient.Pods(s.pod.Namespace).Delete(s.pod.Name, nil)
-		if err != nil {
-			s.Errorln(fmt.Sprintf("Error cleaning up pod: %s", err.Error()))
+		if !podOfJob {
+			err := s.kubeClient.Pods(s.pod.Namespace).Delete(s.pod.Name, nil)
+			if err != nil {
+				s.Errorln(fmt.Sprintf("Error cleaning up pod: %s", err.Error()))
+			}
 		}
+		active.Remove("pod", s.pod.Namespace, s.pod.Name)
 	}
+	s.cleanupCredentials()
+	s.cleanupVariables()
+	s.cleanupNamespace()
 	closeKubeClient(s.kubeClient)
 	s.AbstractExecutor.Cleanup()
 }
 
 func (s *executor) buildContainer(name, image string, requests, limits api.ResourceList, command ...string) api.Container {
-	path := strings.Split(s.Build.BuildDir, "/")
-	path = path[:len(path)-1]
-
 	privileged := false
 	if s.Config.Kubernetes != nil {
 		privileged = s.Config.Kubernetes.Privileged
@@ -182,17 +284,12 @@ func (s *executor) buildContainer(name, image string, requests, limits api.Resou
 		Image:           image,
 		ImagePullPolicy: api.PullPolicy(s.pullPolicy),
 		Command:         command,
-		Env:             buildVariables(s.Build.GetAllVariables().PublicOrInternal()),
+		Env:             buildVariables(s.Build.GetAllVariables().PublicOrInternal().WithoutFiles()),
 		Resources: api.ResourceRequirements{
 			Limits:   limits,
 			Requests: requests,
 		},
-		VolumeMounts: []api.VolumeMount{
-			api.VolumeMount{
-				Name:      "repo",
-				MountPath: strings.Join(path, "/"),
-			},
-		},
+		VolumeMounts: s.getVolumeMounts(),
 		SecurityContext: &api.SecurityContext{
 			Privileged: &privileged,
 		},
@@ -200,11 +297,79 @@ func (s *executor) buildContainer(name, image string, requests, limits api.Resou
 	}
 }
 
+// buildHelperContainer returns the container used to clone the repository
+// and to handle artifacts and cache, using the helper image matching the
+// architecture of the node
+func (s *executor) buildHelperContainer() api.Container {
+	image := s.Config.Kubernetes.GetHelperImage(s.getNodeArchitecture())
+	container := s.buildContainer("helper", image, s.helperRequests, s.helperLimits, s.BuildShell.DockerCommand...)
+	if securityContext := s.Config.Kubernetes.HelperSecurityContext; securityContext != nil {
+		container.SecurityContext = buildSecurityContext(securityContext, container.SecurityContext)
+	}
+	return container
+}
+
+// buildSecurityContext overrides the defaults with the configured options
+func buildSecurityContext(config *common.KubernetesSecurityContext, defaults *api.SecurityContext) *api.SecurityContext {
+	securityContext := &api.SecurityContext{
+		Privileged:             config.Privileged,
+		RunAsUser:              config.RunAsUser,
+		RunAsNonRoot:           config.RunAsNonRoot,
+		ReadOnlyRootFilesystem: config.ReadOnlyRootFilesystem,
+	}
+	if securityContext.Privileged == nil && defaults != nil {
+		securityContext.Privileged = defaults.Privileged
+	}
+
+	if len(config.CapAdd) > 0 || len(config.CapDrop) > 0 {
+		securityContext.Capabilities = &api.Capabilities{}
+		for _, capability := range config.CapAdd {
+			securityContext.Capabilities.Add = append(securityContext.Capabilities.Add, api.Capability(capability))
+		}
+		for _, capability := range config.CapDrop {
+			securityContext.Capabilities.Drop = append(securityContext.Capabilities.Drop, api.Capability(capability))
+		}
+	}
+	return securityContext
+}
+
+// buildInitContainers returns containers started, one after another, before
+// the build and helper containers. Each of them has access to the repository
+// volume, as well as to the job variables.
+func (s *executor) buildInitContainers() []api.Container {
+	var containers []api.Container
+	for _, initContainer := range s.Config.Kubernetes.InitContainers {
+		image := s.Build.GetAllVariables().ExpandValue(initContainer.Image)
+		container := s.buildContainer(initContainer.Name, image, nil, nil, initContainer.Command...)
+		container.Args = initContainer.Args
+		container.Stdin = false
+
+		for _, mount := range initContainer.VolumeMounts {
+			container.VolumeMounts = append(container.VolumeMounts, api.VolumeMount{
+				Name:      mount.Name,
+				MountPath: mount.MountPath,
+				SubPath:   mount.SubPath,
+				ReadOnly:  mount.ReadOnly,
+			})
+		}
+		containers = append(containers, container)
+	}
+	return containers
+}
+
 func (s *executor) setupBuildPod() error {
+	namespace, err := s.setupNamespace()
+	if err != nil {
+		return err
+	}
+	s.Config.Kubernetes.Namespace = namespace
+
 	services := make([]api.Container, len(s.options.Services))
 	for i, image := range s.options.Services {
 		resolvedImage := s.Build.GetAllVariables().ExpandValue(image)
 		services[i] = s.buildContainer(fmt.Sprintf("svc-%d", i), resolvedImage, s.serviceRequests, s.serviceLimits)
+		services[i].ReadinessProbe = s.getServiceProbe(resolvedImage)
+		services[i].Lifecycle = s.getServiceLifecycle(resolvedImage)
 	}
 
 	var imagePullSecrets []api.LocalObjectReference
@@ -212,29 +377,50 @@ func (s *executor) setupBuildPod() error {
 		imagePullSecrets = append(imagePullSecrets, api.LocalObjectReference{Name: imagePullSecret})
 	}
 
+	if err := s.setupCredentials(); err != nil {
+		return err
+	}
+	if s.credentials != nil {
+		imagePullSecrets = append(imagePullSecrets, api.LocalObjectReference{Name: s.credentials.Name})
+	}
+
+	if err := s.setupVariables(); err != nil {
+		return err
+	}
+
 	buildImage := s.Build.GetAllVariables().ExpandValue(s.options.Image)
+	build := s.buildContainer("build", buildImage, s.buildRequests, s.buildLimits, s.BuildShell.DockerCommand...)
+	build.Lifecycle = buildLifecycle(s.Config.Kubernetes.BuildLifecycle)
+
+	// only the containers running the scripts get the masked variables
+	helper := s.buildHelperContainer()
+	masked := maskedVariables(s.variables, s.Build.GetAllVariables())
+	build.Env = append(build.Env, masked...)
+	helper.Env = append(helper.Env, masked...)
 
-	pod, err := s.kubeClient.Pods(s.Config.Kubernetes.Namespace).Create(&api.Pod{
+	annotations, err := s.getSchedulingAnnotations()
+	if err != nil {
+		return err
+	}
+
+	pod, err := s.createPod(&api.Pod{
 		ObjectMeta: api.ObjectMeta{
 			GenerateName: s.Build.ProjectUniqueName(),
 			Namespace:    s.Config.Kubernetes.Namespace,
+			Labels:       getObjectLabels(s.Build),
+			Annotations:  annotations,
 		},
 		Spec: api.PodSpec{
-			Volumes: []api.Volume{
-				api.Volume{
-					Name: "repo",
-					VolumeSource: api.VolumeSource{
-						EmptyDir: &api.EmptyDirVolumeSource{},
-					},
-				},
-			},
-			RestartPolicy: api.RestartPolicyNever,
-			NodeSelector:  s.Config.Kubernetes.NodeSelector,
+			Volumes:            s.getVolumes(),
+			InitContainers:     s.buildInitContainers(),
+			RestartPolicy:      api.RestartPolicyNever,
+			NodeSelector:       s.getNodeSelector(),
+			ServiceAccountName: s.Config.Kubernetes.ServiceAccount,
 			Containers: append([]api.Container{
-				s.buildContainer("build", buildImage, s.buildRequests, s.buildLimits, s.BuildShell.DockerCommand...),
-				s.buildContainer("helper", s.Config.Kubernetes.GetHelperImage(), s.helperRequests, s.helperLimits, s.BuildShell.DockerCommand...),
+				build,
+				helper,
 			}, services...),
-			TerminationGracePeriodSeconds: &s.Config.Kubernetes.TerminationGracePeriodSeconds,
+			TerminationGracePeriodSeconds: s.Config.Kubernetes.GetTerminationGracePeriod(),
 			ImagePullSecrets:              imagePullSecrets,
 		},
 	})
@@ -243,27 +429,40 @@ func (s *executor) setupBuildPod() error {
 	}
 
 	s.pod = pod
+	active.Add("pod", pod.Namespace, pod.Name)
 
 	return nil
 }
 
+// waitForPodRunning waits for the build pod to be running. When the pod
+// doesn't start, its events are printed to help finding the reason.
+func (s *executor) waitForPodRunning(ctx context.Context) error {
+	status, err := waitForPodRunning(ctx, s.kubeClient, s.pod, s.BuildTrace, s.Config.Kubernetes)
+	if err == nil && status != api.PodRunning {
+		err = fmt.Errorf("pod failed to enter running state: %s", status)
+	}
+
+	if err != nil && ctx.Err() == nil {
+		s.printPodEvents()
+	}
+
+	if err == nil && !s.podStarted {
+		s.podStarted = true
+		s.recordPodStartup()
+	}
+	return err
+}
+
 func (s *executor) runInContainer(ctx context.Context, name, command string) <-chan error {
 	errc := make(chan error, 1)
 	go func() {
 		defer close(errc)
 
-		status, err := waitForPodRunning(ctx, s.kubeClient, s.pod, s.BuildTrace, s.Config.Kubernetes)
-
-		if err != nil {
+		if err := s.waitForPodRunning(ctx); err != nil {
 			errc <- err
 			return
 		}
 
-		if status != api.PodRunning {
-			errc <- fmt.Errorf("pod failed to enter running state: %s", status)
-			return
-		}
-
 		config, err := getKubeClientConfig(s.Config.Kubernetes)
 
 		if err != nil {
@@ -271,21 +470,51 @@ func (s *executor) runInContainer(ctx context.Context, name, command string) <-c
 			return
 		}
 
+		s.scripts++
+		marker := scriptMarker(fmt.Sprintf("gitlab-runner-%d-%d", time.Now().UnixNano(), s.scripts))
+		output := &markedOutput{marker: marker, out: s.BuildTrace}
+
 		exec := ExecOptions{
 			PodName:       s.pod.Name,
 			Namespace:     s.pod.Namespace,
 			ContainerName: name,
 			Command:       s.BuildShell.DockerCommand,
-			In:            strings.NewReader(command),
-			Out:           s.BuildTrace,
-			Err:           s.BuildTrace,
+			In:            strings.NewReader(marker.wrapWithLog(command)),
+			Out:           output,
+			Err:           output,
 			Stdin:         true,
 			Config:        config,
 			Client:        s.kubeClient,
 			Executor:      &DefaultRemoteExecutor{},
 		}
 
-		errc <- exec.Run()
+		err = exec.Run()
+		exitCode := output.exitCode
+		if !output.done {
+			if ctx.Err() != nil {
+				errc <- ctx.Err()
+				return
+			}
+			if err == nil {
+				err = fmt.Errorf("exec stream closed before script finished")
+			}
+
+			// the script continues to run in the container, read
+			// the rest of its output from the container log
+			s.Warningln("Lost output of the script:", err.Error())
+			s.Warningln("Reading the rest of the output from the container log...")
+
+			retryInterval := time.Duration(s.Config.Kubernetes.GetPollInterval()) * time.Second
+			out := &skipWriter{skip: output.written, out: s.BuildTrace}
+			if exitCode, err = s.getLogFollower(name).Follow(ctx, marker, out, retryInterval); err != nil {
+				errc <- err
+				return
+			}
+		}
+
+		if exitCode != 0 {
+			errc <- &common.BuildError{Inner: fmt.Errorf("command terminated with exit code %d", exitCode)}
+		}
 	}()
 
 	return errc
@@ -311,6 +540,77 @@ func (s *executor) checkDefaults() error {
 	return nil
 }
 
+// runInContainerWithAttach feeds the script to the shell running in the
+// container and follows the output from the container log, which survives
+// interruptions of connection with the API server
+func (s *executor) runInContainerWithAttach(ctx context.Context, name, command string) <-chan error {
+	errc := make(chan error, 1)
+	go func() {
+		defer close(errc)
+
+		if err := s.waitForPodRunning(ctx); err != nil {
+			errc <- err
+			return
+		}
+
+		config, err := getKubeClientConfig(s.Config.Kubernetes)
+
+		if err != nil {
+			errc <- err
+			return
+		}
+
+		s.scripts++
+		marker := scriptMarker(fmt.Sprintf("gitlab-runner-%d-%d", time.Now().UnixNano(), s.scripts))
+
+		attach := AttachOptions{
+			PodName:       s.pod.Name,
+			Namespace:     s.pod.Namespace,
+			ContainerName: name,
+			In:            strings.NewReader(marker.wrap(command)),
+			Config:        config,
+			Client:        s.kubeClient,
+			Executor:      &DefaultRemoteExecutor{},
+		}
+
+		if err = attach.Run(); err != nil {
+			errc <- err
+			return
+		}
+
+		retryInterval := time.Duration(s.Config.Kubernetes.GetPollInterval()) * time.Second
+		exitCode, err := s.getLogFollower(name).Follow(ctx, marker, s.BuildTrace, retryInterval)
+		if err != nil {
+			errc <- err
+			return
+		}
+
+		if exitCode != 0 {
+			errc <- &common.BuildError{Inner: fmt.Errorf("command terminated with exit code %d", exitCode)}
+		}
+	}()
+
+	return errc
+}
+
+// getLogFollower returns the follower of the log of the container, which
+// remembers the position of the output already read
+func (s *executor) getLogFollower(name string) *logFollower {
+	if s.logFollowers == nil {
+		s.logFollowers = make(map[string]*logFollower)
+	}
+	follower := s.logFollowers[name]
+	if follower == nil {
+		follower = &logFollower{
+			kubeClient: s.kubeClient,
+			pod:        s.pod,
+			container:  name,
+		}
+		s.logFollowers[name] = follower
+	}
+	return follower
+}
+
 // overwriteNamespace checks for variable in order to overwrite the configured
 // namespace, as long as it complies to validation regular-expression, when
 // expression is empty the overwrite is disabled.
@@ -343,6 +643,76 @@ func (s *executor) overwriteNamespace(build *common.Build) error {
 	return nil
 }
 
+// matchProjectPath returns true when the path of the project matches the
+// pattern, where `group/**` matches all projects of the group and its subgroups
+func matchProjectPath(pattern, projectPath string) (bool, error) {
+	if strings.HasSuffix(pattern, "/**") {
+		return strings.HasPrefix(projectPath, strings.TrimSuffix(pattern, "**")), nil
+	}
+	return path.Match(pattern, projectPath)
+}
+
+// mapServiceAccount sets the service account mapped to the project of the
+// build, so only selected projects get the permissions of that account
+func (s *executor) mapServiceAccount(build *common.Build) error {
+	if len(s.Config.Kubernetes.ServiceAccountMapping) == 0 {
+		return nil
+	}
+
+	projectPath, err := build.ProjectSlug()
+	if err != nil {
+		return err
+	}
+	projectPath = strings.TrimPrefix(projectPath, "/")
+
+	for _, mapping := range s.Config.Kubernetes.ServiceAccountMapping {
+		matched, err := matchProjectPath(mapping.Project, projectPath)
+		if err != nil {
+			return fmt.Errorf("invalid project %q of service_account_mapping: %v", mapping.Project, err)
+		}
+		if !matched {
+			continue
+		}
+
+		s.Debugln("Using service account", mapping.ServiceAccount, "mapped to project", projectPath)
+		s.Config.Kubernetes.ServiceAccount = mapping.ServiceAccount
+		return nil
+	}
+	return nil
+}
+
+// overwriteServiceAccount checks for variable in order to overwrite the configured
+// service account, as long as it complies to validation regular-expression, when
+// expression is empty the overwrite is disabled.
+func (s *executor) overwriteServiceAccount(build *common.Build) error {
+	if s.Config.Kubernetes.ServiceAccountOverwriteAllowed == "" {
+		s.Debugln("Configuration entry 'service_account_overwrite_allowed' is empty, using configured service account.")
+		return nil
+	}
+
+	s.serviceAccountOverwrite = build.Variables.Expand().Get("KUBERNETES_SERVICE_ACCOUNT_OVERWRITE")
+	if s.serviceAccountOverwrite == "" {
+		return nil
+	}
+
+	r, err := regexp.Compile(s.Config.Kubernetes.ServiceAccountOverwriteAllowed)
+	if err != nil {
+		return err
+	}
+
+	if !r.MatchString(s.serviceAccountOverwrite) {
+		return fmt.Errorf("KUBERNETES_SERVICE_ACCOUNT_OVERWRITE='%s' does not match 'service_account_overwrite_allowed': '%s'",
+			s.serviceAccountOverwrite, s.Config.Kubernetes.ServiceAccountOverwriteAllowed)
+	}
+
+	// the config is the copy of the job, made in Prepare, so the overwrite
+	// isn't kept for the next jobs of the runner
+	s.Println("Overwritting configured service account, from", s.Config.Kubernetes.ServiceAccount, "to", s.serviceAccountOverwrite)
+	s.Config.Kubernetes.ServiceAccount = s.serviceAccountOverwrite
+
+	return nil
+}
+
 func createFn() common.Executor {
 	return &executor{
 		AbstractExecutor: executors.AbstractExecutor{
@@ -359,9 +729,19 @@ func featuresFn(features *common.FeaturesInfo) {
 	features.Cache = true
 }
 
+// executorProvider exposes the startup metrics of build pods
+type executorProvider struct {
+	executors.DefaultExecutorProvider
+	*podStartupMetrics
+}
+
 func init() {
-	common.RegisterExecutor("kubernetes", executors.DefaultExecutorProvider{
-		Creator:         createFn,
-		FeaturesUpdater: featuresFn,
+	common.RegisterExecutor("kubernetes", executorProvider{
+		DefaultExecutorProvider: executors.DefaultExecutorProvider{
+			Creator:         createFn,
+			FeaturesUpdater: featuresFn,
+			DefaultShell:    executorOptions.Shell.Shell,
+		},
+		podStartupMetrics: startupMetrics,
 	})
 }
@@ -21,6 +21,7 @@ import (
 	"k8s.io/kubernetes/pkg/api/resource"
 	"k8s.io/kubernetes/pkg/api/testapi"
 	"k8s.io/kubernetes/pkg/api/unversioned"
+	"k8s.io/kubernetes/pkg/apis/batch"
 	"k8s.io/kubernetes/pkg/client/restclient"
 	client "k8s.io/kubernetes/pkg/client/unversioned"
 	"k8s.io/kubernetes/pkg/client/unversioned/fake"
@@ -84,6 +85,7 @@ func TestCleanup(t *testing.T) {
 
 	tests := []struct {
 		Pod        *api.Pod
+		Job        *batch.Job
 		ClientFunc func(*http.Request) (*http.Response, error)
 		Error      bool
 	}{
@@ -99,7 +101,7 @@ func TestCleanup(t *testing.T) {
 				case m == "DELETE" && p == "/api/"+version+"/namespaces/test-ns/pods/test-pod":
 					return &http.Response{StatusCode: 200, Body: FakeReadCloser{
 						Reader: strings.NewReader(""),
-					}}, nil
+					}, Header: http.Header{"Content-Type": []string{"application/json"}}}, nil
 				default:
 					return nil, fmt.Errorf("unexpected request. method: %s, path: %s", m, p)
 				}
@@ -117,6 +119,30 @@ func TestCleanup(t *testing.T) {
 			},
 			Error: true,
 		},
+		{
+			Pod: &api.Pod{
+				ObjectMeta: api.ObjectMeta{
+					Name:      "test-job-pod",
+					Namespace: "test-ns",
+				},
+			},
+			Job: &batch.Job{
+				ObjectMeta: api.ObjectMeta{
+					Name:      "test-job",
+					Namespace: "test-ns",
+				},
+			},
+			ClientFunc: func(req *http.Request) (*http.Response, error) {
+				switch p, m := req.URL.Path, req.Method; {
+				case m == "DELETE" && p == "/apis/batch/v1/namespaces/test-ns/jobs/test-job":
+					return &http.Response{StatusCode: 200, Body: FakeReadCloser{
+						Reader: strings.NewReader(""),
+					}, Header: http.Header{"Content-Type": []string{"application/json"}}}, nil
+				default:
+					return nil, fmt.Errorf("unexpected request. method: %s, path: %s", m, p)
+				}
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -126,10 +152,13 @@ func TestCleanup(t *testing.T) {
 			Client: fake.CreateHTTPClient(test.ClientFunc),
 		}
 		c.Client = fakeClient.Client
+		c.BatchClient = client.NewBatchOrDie(&restclient.Config{})
+		c.BatchClient.Client = fakeClient.Client
 
 		ex := executor{
 			kubeClient: c,
 			pod:        test.Pod,
+			job:        test.Job,
 		}
 		errored := false
 		buildTrace := FakeBuildTrace{
@@ -141,6 +170,8 @@ func TestCleanup(t *testing.T) {
 						} else {
 							t.Errorf("expected failure. got: '%s'", string(b))
 						}
+					} else if !test.Error {
+						t.Errorf("unexpected output: '%s'", string(b))
 					}
 					return len(b), nil
 				},
@@ -198,6 +229,7 @@ func TestPrepare(t *testing.T) {
 					Image: "test-image",
 				},
 				namespaceOverwrite: "",
+				namespacePrefix:    "ci-job",
 				serviceLimits: api.ResourceList{
 					api.ResourceCPU:    resource.MustParse("100m"),
 					api.ResourceMemory: resource.MustParse("200Mi"),
@@ -257,6 +289,7 @@ func TestPrepare(t *testing.T) {
 					Image: "test-image",
 				},
 				namespaceOverwrite: "namespacee",
+				namespacePrefix:    "namespacee",
 				serviceLimits: api.ResourceList{
 					api.ResourceCPU:    resource.MustParse("100m"),
 					api.ResourceMemory: resource.MustParse("200Mi"),
@@ -319,6 +352,7 @@ func TestPrepare(t *testing.T) {
 					Image: "test-image",
 				},
 				namespaceOverwrite: "",
+				namespacePrefix:    "ci-job",
 				serviceLimits: api.ResourceList{
 					api.ResourceCPU:    resource.MustParse("100m"),
 					api.ResourceMemory: resource.MustParse("202Mi"),
@@ -363,6 +397,7 @@ func TestPrepare(t *testing.T) {
 					Image: "test-image",
 				},
 				namespaceOverwrite: "",
+				namespacePrefix:    "namespace",
 				serviceLimits:      api.ResourceList{},
 				buildLimits:        api.ResourceList{},
 				helperLimits:       api.ResourceList{},
@@ -371,6 +406,69 @@ func TestPrepare(t *testing.T) {
 				helperRequests:     api.ResourceList{},
 			},
 		},
+		{
+			GlobalConfig: &common.Config{},
+			RunnerConfig: &common.RunnerConfig{
+				RunnerSettings: common.RunnerSettings{
+					Kubernetes: &common.KubernetesConfig{
+						Namespace:                      "namespace",
+						Host:                           "test-server",
+						ServiceAccount:                 "default",
+						ServiceAccountOverwriteAllowed: "^project-.*$",
+					},
+				},
+			},
+			Build: &common.Build{
+				GetBuildResponse: common.GetBuildResponse{
+					Sha: "1234567890",
+					Options: common.BuildOptions{
+						"image": "test-image",
+					},
+					Variables: []common.BuildVariable{
+						common.BuildVariable{Key: "KUBERNETES_SERVICE_ACCOUNT_OVERWRITE", Value: "project-deployer"},
+					},
+				},
+				Runner: &common.RunnerConfig{},
+			},
+			Expected: &executor{
+				options: &kubernetesOptions{
+					Image: "test-image",
+				},
+				serviceAccountOverwrite: "project-deployer",
+				namespacePrefix:         "namespace",
+				serviceLimits:           api.ResourceList{},
+				buildLimits:             api.ResourceList{},
+				helperLimits:            api.ResourceList{},
+				serviceRequests:         api.ResourceList{},
+				buildRequests:           api.ResourceList{},
+				helperRequests:          api.ResourceList{},
+			},
+		},
+		{
+			GlobalConfig: &common.Config{},
+			RunnerConfig: &common.RunnerConfig{
+				RunnerSettings: common.RunnerSettings{
+					Kubernetes: &common.KubernetesConfig{
+						Namespace:                      "namespace",
+						Host:                           "test-server",
+						ServiceAccountOverwriteAllowed: "^project-.*$",
+					},
+				},
+			},
+			Build: &common.Build{
+				GetBuildResponse: common.GetBuildResponse{
+					Sha: "1234567890",
+					Options: common.BuildOptions{
+						"image": "test-image",
+					},
+					Variables: []common.BuildVariable{
+						common.BuildVariable{Key: "KUBERNETES_SERVICE_ACCOUNT_OVERWRITE", Value: "cluster-admin"},
+					},
+				},
+				Runner: &common.RunnerConfig{},
+			},
+			Error: true,
+		},
 	}
 
 	for index, test := range tests {
@@ -381,7 +479,9 @@ func TestPrepare(t *testing.T) {
 				},
 			}
 
+			runnerConfig := *test.RunnerConfig.Kubernetes
 			err := e.Prepare(test.GlobalConfig, test.RunnerConfig, test.Build)
+			assert.Equal(t, runnerConfig, *test.RunnerConfig.Kubernetes, "the config of the runner isn't changed by the job")
 
 			if err != nil {
 				if test.Error {
@@ -408,6 +508,39 @@ func TestPrepare(t *testing.T) {
 	}
 }
 
+func TestOverwriteServiceAccountOfOneJob(t *testing.T) {
+	runnerConfig := &common.RunnerConfig{
+		RunnerSettings: common.RunnerSettings{
+			Kubernetes: &common.KubernetesConfig{
+				Namespace:                      "namespace",
+				Host:                           "test-server",
+				ServiceAccount:                 "default",
+				ServiceAccountOverwriteAllowed: "^project-.*$",
+			},
+		},
+	}
+	newBuild := func(variables ...common.BuildVariable) *common.Build {
+		return &common.Build{
+			GetBuildResponse: common.GetBuildResponse{
+				Sha:       "1234567890",
+				Options:   common.BuildOptions{"image": "test-image"},
+				Variables: variables,
+			},
+			Runner: &common.RunnerConfig{},
+		}
+	}
+
+	e := &executor{AbstractExecutor: executors.AbstractExecutor{ExecutorOptions: executorOptions}}
+	err := e.Prepare(&common.Config{}, runnerConfig, newBuild(common.BuildVariable{Key: "KUBERNETES_SERVICE_ACCOUNT_OVERWRITE", Value: "project-deployer"}))
+	require.NoError(t, err)
+	assert.Equal(t, "project-deployer", e.Config.Kubernetes.ServiceAccount)
+
+	e = &executor{AbstractExecutor: executors.AbstractExecutor{ExecutorOptions: executorOptions}}
+	err = e.Prepare(&common.Config{}, runnerConfig, newBuild())
+	require.NoError(t, err)
+	assert.Equal(t, "default", e.Config.Kubernetes.ServiceAccount, "the overwrite of the previous job isn't kept")
+}
+
 func TestSetupBuildPod(t *testing.T) {
 	version := testapi.Default.GroupVersion().Version
 	codec := testapi.Default.Codec()
@@ -484,6 +617,118 @@ func TestSetupBuildPod(t *testing.T) {
 				}
 			},
 		},
+		{
+			RunnerConfig: common.RunnerConfig{
+				RunnerSettings: common.RunnerSettings{
+					Kubernetes: &common.KubernetesConfig{
+						Namespace:   "default",
+						HelperImage: "custom/helper-image",
+						HelperImages: map[string]string{
+							"arm64": "custom/helper-image:arm64",
+						},
+						NodeSelector: map[string]string{
+							"kubernetes.io/arch": "arm64",
+						},
+					},
+				},
+			},
+			VerifyFn: func(t *testing.T, test testDef, pod *api.Pod) {
+				for _, c := range pod.Spec.Containers {
+					if c.Name == "helper" {
+						assert.Equal(t, "custom/helper-image:arm64", c.Image)
+					}
+				}
+			},
+		},
+		{
+			RunnerConfig: common.RunnerConfig{
+				RunnerSettings: common.RunnerSettings{
+					Kubernetes: &common.KubernetesConfig{
+						Namespace:  "default",
+						Privileged: true,
+						HelperSecurityContext: &common.KubernetesSecurityContext{
+							RunAsUser: func(i int64) *int64 { return &i }(1000),
+							CapDrop:   []string{"ALL"},
+						},
+					},
+				},
+			},
+			VerifyFn: func(t *testing.T, test testDef, pod *api.Pod) {
+				for _, c := range pod.Spec.Containers {
+					require.NotNil(t, c.SecurityContext)
+					assert.True(t, *c.SecurityContext.Privileged, c.Name)
+
+					if c.Name == "helper" {
+						require.NotNil(t, c.SecurityContext.RunAsUser)
+						assert.Equal(t, int64(1000), *c.SecurityContext.RunAsUser)
+						require.NotNil(t, c.SecurityContext.Capabilities)
+						assert.Equal(t, []api.Capability{"ALL"}, c.SecurityContext.Capabilities.Drop)
+					} else {
+						assert.Nil(t, c.SecurityContext.RunAsUser, c.Name)
+					}
+				}
+			},
+		},
+		{
+			RunnerConfig: common.RunnerConfig{
+				RunnerSettings: common.RunnerSettings{
+					Kubernetes: &common.KubernetesConfig{
+						Namespace: "default",
+						PodSpec: []common.KubernetesPodSpec{
+							{
+								Name:      "hostname",
+								Patch:     "hostname: custom-hostname",
+								PatchType: "merge",
+							},
+							{
+								Name:      "helper-working-dir",
+								Patch:     `{"containers": [{"name": "helper", "workingDir": "/builds"}]}`,
+								PatchType: "strategic",
+							},
+						},
+					},
+				},
+			},
+			VerifyFn: func(t *testing.T, test testDef, pod *api.Pod) {
+				assert.Equal(t, "custom-hostname", pod.Spec.Hostname)
+				require.Equal(t, 2, len(pod.Spec.Containers))
+				assert.Equal(t, "build", pod.Spec.Containers[0].Name)
+				assert.Equal(t, "/builds", pod.Spec.Containers[1].WorkingDir)
+				assert.NotEmpty(t, pod.Spec.Containers[1].Image)
+			},
+		},
+		{
+			RunnerConfig: common.RunnerConfig{
+				RunnerSettings: common.RunnerSettings{
+					Kubernetes: &common.KubernetesConfig{
+						Namespace: "default",
+						InitContainers: []common.KubernetesInitContainer{
+							{
+								Name:    "fetch-certs",
+								Image:   "alpine:3.5",
+								Command: []string{"sh", "-c", "cp /secrets/* /certs"},
+								VolumeMounts: []common.KubernetesVolumeMount{
+									{Name: "certs", MountPath: "/certs"},
+								},
+							},
+						},
+					},
+				},
+			},
+			VerifyFn: func(t *testing.T, test testDef, pod *api.Pod) {
+				var initContainers []api.Container
+				err := json.Unmarshal([]byte(pod.Annotations["pod.alpha.kubernetes.io/init-containers"]), &initContainers)
+				require.NoError(t, err)
+				require.Equal(t, 1, len(initContainers))
+				assert.Equal(t, "fetch-certs", initContainers[0].Name)
+				assert.Equal(t, "alpine:3.5", initContainers[0].Image)
+				assert.Equal(t, []string{"sh", "-c", "cp /secrets/* /certs"}, initContainers[0].Command)
+				assert.False(t, initContainers[0].Stdin)
+				require.Equal(t, 2, len(initContainers[0].VolumeMounts))
+				assert.Equal(t, "repo", initContainers[0].VolumeMounts[0].Name)
+				assert.Equal(t, "/certs", initContainers[0].VolumeMounts[1].MountPath)
+			},
+		},
 	}
 
 	fakeClientRoundTripper := func(test testDef) func(req *http.Request) (*http.Response, error) {
@@ -760,6 +1005,62 @@ func TestOverwriteNamespaceNotMatch(t *testing.T) {
 	assert.Contains(t, err.Error(), "does not match")
 }
 
+func TestMatchProjectPath(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		path     string
+		expected bool
+	}{
+		{"group/project", "group/project", true},
+		{"group/project", "group/other", false},
+		{"group/deploy-*", "group/deploy-app", true},
+		{"group/*", "group/subgroup/project", false},
+		{"group/**", "group/subgroup/project", true},
+		{"group/**", "other-group/project", false},
+	}
+
+	for _, test := range tests {
+		matched, err := matchProjectPath(test.pattern, test.path)
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, matched, "%s %s", test.pattern, test.path)
+	}
+}
+
+func TestMapServiceAccount(t *testing.T) {
+	newExecutor := func() *executor {
+		return &executor{
+			AbstractExecutor: executors.AbstractExecutor{
+				Config: common.RunnerConfig{
+					RunnerSettings: common.RunnerSettings{
+						Kubernetes: &common.KubernetesConfig{
+							ServiceAccount: "default",
+							ServiceAccountMapping: []common.KubernetesServiceAccount{
+								{Project: "ops/deploy-*", ServiceAccount: "deployer"},
+								{Project: "ops/**", ServiceAccount: "ops"},
+							},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	tests := map[string]string{
+		"https://gitlab.example.com/ops/deploy-app.git":     "deployer",
+		"https://gitlab.example.com/ops/monitoring/app.git": "ops",
+		"https://gitlab.example.com/dev/app.git":            "default",
+	}
+
+	for repoURL, expected := range tests {
+		e := newExecutor()
+		err := e.mapServiceAccount(&common.Build{
+			GetBuildResponse: common.GetBuildResponse{RepoURL: repoURL},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, expected, e.Config.Kubernetes.ServiceAccount, repoURL)
+	}
+}
+
 type FakeReadCloser struct {
 	io.Reader
 }
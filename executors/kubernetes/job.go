@@ -0,0 +1,133 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/errors"
+	"k8s.io/kubernetes/pkg/apis/batch"
+	"k8s.io/kubernetes/pkg/labels"
+)
+
+// jobNameLabel is set by the job controller on pods created for a job
+const jobNameLabel = "job-name"
+
+// jobManifest is the Job object running the build pod. It's written by hand,
+// as backoffLimit and ttlSecondsAfterFinished aren't known to this version
+// of the kubernetes client.
+type jobManifest struct {
+	APIVersion string          `json:"apiVersion"`
+	Kind       string          `json:"kind"`
+	Metadata   api.ObjectMeta  `json:"metadata"`
+	Spec       jobManifestSpec `json:"spec"`
+}
+
+type jobManifestSpec struct {
+	BackoffLimit            int                 `json:"backoffLimit"`
+	TTLSecondsAfterFinished *int                `json:"ttlSecondsAfterFinished,omitempty"`
+	Template                jobManifestTemplate `json:"template"`
+}
+
+type jobManifestTemplate struct {
+	Metadata api.ObjectMeta  `json:"metadata"`
+	Spec     json.RawMessage `json:"spec"`
+}
+
+// buildJobManifest wraps the manifest of the pod in a Job, which doesn't
+// retry the failed pod, as the runner handles the retries of the job
+func buildJobManifest(pod *api.Pod, podManifest []byte, ttlSecondsAfterFinished int) ([]byte, error) {
+	var manifest map[string]json.RawMessage
+	if err := json.Unmarshal(podManifest, &manifest); err != nil {
+		return nil, err
+	}
+
+	job := jobManifest{
+		APIVersion: "batch/v1",
+		Kind:       "Job",
+		Metadata: api.ObjectMeta{
+			GenerateName: pod.GenerateName,
+			Namespace:    pod.Namespace,
+			Labels:       pod.Labels,
+		},
+		Spec: jobManifestSpec{
+			Template: jobManifestTemplate{
+				Metadata: api.ObjectMeta{
+					Labels:      pod.Labels,
+					Annotations: pod.Annotations,
+				},
+				Spec: manifest["spec"],
+			},
+		},
+	}
+	if ttlSecondsAfterFinished > 0 {
+		job.Spec.TTLSecondsAfterFinished = &ttlSecondsAfterFinished
+	}
+
+	return json.Marshal(job)
+}
+
+// createJob creates the Job running the build pod and returns the pod
+// created by the job controller
+func (s *executor) createJob(pod *api.Pod, podManifest []byte) (*api.Pod, error) {
+	data, err := buildJobManifest(pod, podManifest, s.Config.Kubernetes.JobTTLSecondsAfterFinished)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &batch.Job{}
+	err = s.kubeClient.BatchClient.Post().
+		Namespace(pod.Namespace).
+		Resource("jobs").
+		SetHeader("Content-Type", "application/json").
+		Body(data).
+		Do().
+		Into(job)
+	if err != nil {
+		return nil, err
+	}
+
+	s.job = job
+	active.Add("job", job.Namespace, job.Name)
+	s.Debugln("Created job", job.Namespace+"/"+job.Name)
+
+	return s.waitForJobPod(job)
+}
+
+// waitForJobPod waits for the job controller to create the pod of the job
+func (s *executor) waitForJobPod(job *batch.Job) (*api.Pod, error) {
+	options := api.ListOptions{
+		LabelSelector: labels.SelectorFromSet(labels.Set{jobNameLabel: job.Name}),
+	}
+
+	for i := 0; i <= s.Config.Kubernetes.GetPollAttempts(); i++ {
+		pods, err := s.kubeClient.Pods(job.Namespace).List(options)
+		if err != nil {
+			return nil, err
+		}
+		if len(pods.Items) > 0 {
+			return &pods.Items[0], nil
+		}
+
+		time.Sleep(time.Duration(s.Config.Kubernetes.GetPollInterval()) * time.Second)
+	}
+	return nil, fmt.Errorf("timedout waiting for job %s to create the pod", job.Name)
+}
+
+// deleteJob removes the job together with its pod
+func (s *executor) deleteJob() {
+	if s.job == nil {
+		return
+	}
+
+	orphanDependents := false
+	err := s.kubeClient.Batch().Jobs(s.job.Namespace).Delete(s.job.Name, &api.DeleteOptions{
+		OrphanDependents: &orphanDependents,
+	})
+	if err != nil && !errors.IsNotFound(err) {
+		s.Errorln(fmt.Sprintf("Error cleaning up job: %s", err.Error()))
+	}
+	active.Remove("job", s.job.Namespace, s.job.Name)
+	s.job = nil
+}
@@ -0,0 +1,65 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/kubernetes/pkg/api"
+)
+
+func TestBuildJobManifest(t *testing.T) {
+	pod := &api.Pod{
+		ObjectMeta: api.ObjectMeta{
+			GenerateName: "runner-abcdef12-project-1-concurrent-0",
+			Namespace:    "ci",
+			Labels:       map[string]string{runnerLabel: "abcdef12"},
+			Annotations:  map[string]string{"example.com/owner": "ci"},
+		},
+	}
+	podManifest := `{"kind":"Pod","apiVersion":"v1","metadata":{},"spec":{"restartPolicy":"Never"}}`
+
+	data, err := buildJobManifest(pod, []byte(podManifest), 0)
+	require.NoError(t, err)
+
+	var job struct {
+		APIVersion string `json:"apiVersion"`
+		Kind       string `json:"kind"`
+		Metadata   struct {
+			GenerateName string            `json:"generateName"`
+			Namespace    string            `json:"namespace"`
+			Labels       map[string]string `json:"labels"`
+		} `json:"metadata"`
+		Spec struct {
+			BackoffLimit            *int `json:"backoffLimit"`
+			TTLSecondsAfterFinished *int `json:"ttlSecondsAfterFinished"`
+			Template                struct {
+				Metadata struct {
+					Labels      map[string]string `json:"labels"`
+					Annotations map[string]string `json:"annotations"`
+				} `json:"metadata"`
+				Spec map[string]interface{} `json:"spec"`
+			} `json:"template"`
+		} `json:"spec"`
+	}
+	require.NoError(t, json.Unmarshal(data, &job))
+
+	assert.Equal(t, "batch/v1", job.APIVersion)
+	assert.Equal(t, "Job", job.Kind)
+	assert.Equal(t, pod.GenerateName, job.Metadata.GenerateName)
+	assert.Equal(t, "ci", job.Metadata.Namespace)
+	assert.Equal(t, pod.Labels, job.Metadata.Labels)
+	require.NotNil(t, job.Spec.BackoffLimit)
+	assert.Equal(t, 0, *job.Spec.BackoffLimit)
+	assert.Nil(t, job.Spec.TTLSecondsAfterFinished)
+	assert.Equal(t, pod.Labels, job.Spec.Template.Metadata.Labels)
+	assert.Equal(t, pod.Annotations, job.Spec.Template.Metadata.Annotations)
+	assert.Equal(t, map[string]interface{}{"restartPolicy": "Never"}, job.Spec.Template.Spec)
+
+	data, err = buildJobManifest(pod, []byte(podManifest), 600)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &job))
+	require.NotNil(t, job.Spec.TTLSecondsAfterFinished)
+	assert.Equal(t, 600, *job.Spec.TTLSecondsAfterFinished)
+}
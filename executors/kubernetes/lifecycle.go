@@ -0,0 +1,40 @@
+package kubernetes
+
+import (
+	"strings"
+
+	"k8s.io/kubernetes/pkg/api"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+// buildLifecycle returns the post start and pre stop hooks of a container,
+// or nil when none is configured
+func buildLifecycle(config *common.KubernetesLifecycle) *api.Lifecycle {
+	if config == nil || (len(config.PostStart) == 0 && len(config.PreStop) == 0) {
+		return nil
+	}
+
+	lifecycle := &api.Lifecycle{}
+	if len(config.PostStart) > 0 {
+		lifecycle.PostStart = &api.Handler{Exec: &api.ExecAction{Command: config.PostStart}}
+	}
+	if len(config.PreStop) > 0 {
+		lifecycle.PreStop = &api.Handler{Exec: &api.ExecAction{Command: config.PreStop}}
+	}
+	return lifecycle
+}
+
+// getServiceLifecycle returns the hooks configured for the service image,
+// matched the same way as the service probes
+func (s *executor) getServiceLifecycle(image string) *api.Lifecycle {
+	name := serviceImageName(image)
+
+	for i, lifecycle := range s.Config.Kubernetes.ServiceLifecycles {
+		if lifecycle.Service != name && !strings.HasSuffix(name, "/"+lifecycle.Service) {
+			continue
+		}
+		return buildLifecycle(&s.Config.Kubernetes.ServiceLifecycles[i])
+	}
+	return nil
+}
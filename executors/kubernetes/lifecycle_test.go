@@ -0,0 +1,58 @@
+package kubernetes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/kubernetes/pkg/api"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors"
+)
+
+func TestBuildLifecycle(t *testing.T) {
+	assert.Nil(t, buildLifecycle(nil))
+	assert.Nil(t, buildLifecycle(&common.KubernetesLifecycle{}))
+
+	lifecycle := buildLifecycle(&common.KubernetesLifecycle{
+		PreStop: []string{"sh", "-c", "license-checkin"},
+	})
+	assert.Equal(t, &api.Lifecycle{
+		PreStop: &api.Handler{Exec: &api.ExecAction{Command: []string{"sh", "-c", "license-checkin"}}},
+	}, lifecycle)
+
+	lifecycle = buildLifecycle(&common.KubernetesLifecycle{
+		PostStart: []string{"setup"},
+		PreStop:   []string{"teardown"},
+	})
+	assert.Equal(t, &api.Lifecycle{
+		PostStart: &api.Handler{Exec: &api.ExecAction{Command: []string{"setup"}}},
+		PreStop:   &api.Handler{Exec: &api.ExecAction{Command: []string{"teardown"}}},
+	}, lifecycle)
+}
+
+func TestGetServiceLifecycle(t *testing.T) {
+	s := &executor{
+		AbstractExecutor: executors.AbstractExecutor{
+			Config: common.RunnerConfig{
+				RunnerSettings: common.RunnerSettings{
+					Kubernetes: &common.KubernetesConfig{
+						ServiceLifecycles: []common.KubernetesLifecycle{
+							{Service: "postgres", PreStop: []string{"pg_ctl", "stop", "-m", "fast"}},
+							{Service: "redis"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	lifecycle := s.getServiceLifecycle("registry.local/postgres:9.6")
+	if assert.NotNil(t, lifecycle) {
+		assert.Equal(t, &api.ExecAction{Command: []string{"pg_ctl", "stop", "-m", "fast"}}, lifecycle.PreStop.Exec)
+		assert.Nil(t, lifecycle.PostStart)
+	}
+
+	assert.Nil(t, s.getServiceLifecycle("redis:3"))
+	assert.Nil(t, s.getServiceLifecycle("mysql"))
+}
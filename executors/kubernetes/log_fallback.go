@@ -0,0 +1,81 @@
+package kubernetes
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// containerLog is the standard output of the main process of the container,
+// which is written to the container log
+const containerLog = "/proc/1/fd/1"
+
+// wrapWithLog runs the script like wrap, and copies its output to the
+// container log, so the output can still be read from the log when the
+// exec stream breaks
+func (m scriptMarker) wrapWithLog(script string) string {
+	return fmt.Sprintf("{\n%s} 2>&1 | tee -a %s\n", m.wrap(script), containerLog)
+}
+
+// markedOutput copies output of a wrapped script from the exec stream to
+// out, and reads its exit code from the exit marker
+type markedOutput struct {
+	marker scriptMarker
+	out    io.Writer
+
+	buf      bytes.Buffer
+	started  bool
+	done     bool
+	exitCode int
+	written  int
+}
+
+func (o *markedOutput) Write(p []byte) (int, error) {
+	o.buf.Write(p)
+
+	for !o.done {
+		i := bytes.IndexByte(o.buf.Bytes(), '\n')
+		if i < 0 {
+			break
+		}
+		o.writeLine(string(o.buf.Next(i + 1)))
+	}
+	return len(p), nil
+}
+
+func (o *markedOutput) writeLine(line string) {
+	if !o.started {
+		o.started = strings.Contains(line, o.marker.start())
+		return
+	}
+
+	if i := strings.Index(line, o.marker.exit()); i >= 0 {
+		o.exitCode, _ = strconv.Atoi(strings.TrimSpace(line[i+len(o.marker.exit()):]))
+		o.done = true
+		line = line[:i]
+	}
+
+	n, _ := io.WriteString(o.out, line)
+	o.written += n
+}
+
+// skipWriter discards the given number of bytes before writing to out. It's
+// used to skip the output already received from the broken exec stream.
+type skipWriter struct {
+	skip int
+	out  io.Writer
+}
+
+func (w *skipWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	if w.skip >= n {
+		w.skip -= n
+		return n, nil
+	}
+
+	_, err := w.out.Write(p[w.skip:])
+	w.skip = 0
+	return n, err
+}
@@ -0,0 +1,44 @@
+package kubernetes
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScriptMarkerWrapWithLog(t *testing.T) {
+	marker := scriptMarker("marker")
+
+	assert.Equal(t, "{\necho 'marker start'\n(\necho test\n) </dev/null 2>&1\necho \"marker exit $?\"\n} 2>&1 | tee -a /proc/1/fd/1\n",
+		marker.wrapWithLog("echo test"))
+}
+
+func TestMarkedOutput(t *testing.T) {
+	out := new(bytes.Buffer)
+	output := &markedOutput{marker: scriptMarker("marker"), out: out}
+
+	io.WriteString(output, "marker start\nline 1\nli")
+	assert.False(t, output.done)
+	assert.Equal(t, "line 1\n", out.String())
+	assert.Equal(t, 7, output.written)
+
+	io.WriteString(output, "ne 2\nno newline marker exit 2\nafter exit\n")
+	assert.True(t, output.done)
+	assert.Equal(t, 2, output.exitCode)
+	assert.Equal(t, "line 1\nline 2\nno newline ", out.String())
+}
+
+func TestSkipWriter(t *testing.T) {
+	out := new(bytes.Buffer)
+	w := &skipWriter{skip: 10, out: out}
+
+	for _, line := range strings.SplitAfter("line 1\nline 2\nline 3\n", "\n") {
+		n, err := io.WriteString(w, line)
+		assert.NoError(t, err)
+		assert.Equal(t, len(line), n)
+	}
+	assert.Equal(t, "e 2\nline 3\n", out.String())
+}
@@ -0,0 +1,151 @@
+package kubernetes
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/kubernetes/pkg/api"
+)
+
+var startupBuckets = prometheus.ExponentialBuckets(1, 2, 10)
+
+// podStartupMetrics collects how long build pods take to start, so the size
+// of the node pool can be planned based on the time jobs wait for pods
+type podStartupMetrics struct {
+	scheduling *prometheus.HistogramVec
+	startup    *prometheus.HistogramVec
+	imagePull  *prometheus.HistogramVec
+}
+
+func newPodStartupMetrics() *podStartupMetrics {
+	return &podStartupMetrics{
+		scheduling: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "ci_kubernetes_pod_scheduling_seconds",
+			Help:    "Time from the creation of the build pod until it was assigned to a node.",
+			Buckets: startupBuckets,
+		}, []string{"runner"}),
+		startup: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "ci_kubernetes_pod_startup_seconds",
+			Help:    "Time from the creation of the build pod until it was running.",
+			Buckets: startupBuckets,
+		}, []string{"runner"}),
+		imagePull: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "ci_kubernetes_image_pull_seconds",
+			Help:    "Time spent pulling the images of the containers of the build pod.",
+			Buckets: startupBuckets,
+		}, []string{"runner", "container"}),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (m *podStartupMetrics) Describe(ch chan<- *prometheus.Desc) {
+	m.scheduling.Describe(ch)
+	m.startup.Describe(ch)
+	m.imagePull.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (m *podStartupMetrics) Collect(ch chan<- prometheus.Metric) {
+	m.scheduling.Collect(ch)
+	m.startup.Collect(ch)
+	m.imagePull.Collect(ch)
+}
+
+func (m *podStartupMetrics) Observe(runner string, times podStartupTimes) {
+	if times.Scheduling > 0 {
+		m.scheduling.WithLabelValues(runner).Observe(times.Scheduling.Seconds())
+	}
+	if times.Startup > 0 {
+		m.startup.WithLabelValues(runner).Observe(times.Startup.Seconds())
+	}
+	for container, duration := range times.ImagePulls {
+		m.imagePull.WithLabelValues(runner, container).Observe(duration.Seconds())
+	}
+}
+
+var startupMetrics = newPodStartupMetrics()
+
+type podStartupTimes struct {
+	Scheduling time.Duration
+	Startup    time.Duration
+	ImagePulls map[string]time.Duration
+}
+
+func (t podStartupTimes) String() string {
+	var pull time.Duration
+	for _, duration := range t.ImagePulls {
+		pull += duration
+	}
+	return fmt.Sprintf("started in %v (scheduling %v, pulling images %v)", t.Startup, t.Scheduling, pull)
+}
+
+// getContainerName returns the name of the container the event is about,
+// from a field path like spec.containers{build}
+func getContainerName(event api.Event) string {
+	fieldPath := event.InvolvedObject.FieldPath
+	start := strings.Index(fieldPath, "{")
+	if start < 0 || !strings.HasSuffix(fieldPath, "}") {
+		return ""
+	}
+	return fieldPath[start+1 : len(fieldPath)-1]
+}
+
+// getPodStartupTimes computes the startup times of a running pod from its
+// status and the Pulling and Pulled events of its containers
+func getPodStartupTimes(pod *api.Pod, events []api.Event) podStartupTimes {
+	created := pod.CreationTimestamp.Time
+	times := podStartupTimes{ImagePulls: make(map[string]time.Duration)}
+
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == api.PodScheduled && condition.Status == api.ConditionTrue {
+			times.Scheduling = condition.LastTransitionTime.Sub(created)
+		}
+	}
+
+	for _, status := range pod.Status.ContainerStatuses {
+		if running := status.State.Running; running != nil {
+			if startup := running.StartedAt.Sub(created); startup > times.Startup {
+				times.Startup = startup
+			}
+		}
+	}
+
+	pulling := make(map[string]time.Time)
+	for _, event := range events {
+		container := getContainerName(event)
+		if container == "" {
+			continue
+		}
+
+		switch event.Reason {
+		case "Pulling":
+			pulling[container] = event.FirstTimestamp.Time
+		case "Pulled":
+			if started, ok := pulling[container]; ok {
+				times.ImagePulls[container] = event.LastTimestamp.Sub(started)
+			}
+		}
+	}
+
+	return times
+}
+
+// recordPodStartup records the startup times of the running build pod
+func (s *executor) recordPodStartup() {
+	pod, err := s.kubeClient.Pods(s.pod.Namespace).Get(s.pod.Name)
+	if err != nil {
+		s.Debugln("Unable to get the build pod for startup metrics:", err.Error())
+		return
+	}
+
+	events, err := getPodEvents(s.kubeClient, pod)
+	if err != nil {
+		s.Debugln("Unable to get events of the build pod for startup metrics:", err.Error())
+	}
+
+	times := getPodStartupTimes(pod, events)
+	startupMetrics.Observe(s.Config.ShortDescription(), times)
+	s.Debugln("Pod", pod.Name, times.String())
+}
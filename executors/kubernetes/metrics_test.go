@@ -0,0 +1,75 @@
+package kubernetes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+)
+
+func TestGetPodStartupTimes(t *testing.T) {
+	created := time.Now().Truncate(time.Second)
+	at := func(seconds int) unversioned.Time {
+		return unversioned.NewTime(created.Add(time.Duration(seconds) * time.Second))
+	}
+
+	pod := &api.Pod{
+		ObjectMeta: api.ObjectMeta{CreationTimestamp: at(0)},
+		Status: api.PodStatus{
+			Conditions: []api.PodCondition{
+				{Type: api.PodScheduled, Status: api.ConditionTrue, LastTransitionTime: at(5)},
+			},
+			ContainerStatuses: []api.ContainerStatus{
+				{Name: "build", State: api.ContainerState{Running: &api.ContainerStateRunning{StartedAt: at(30)}}},
+				{Name: "helper", State: api.ContainerState{Running: &api.ContainerStateRunning{StartedAt: at(32)}}},
+			},
+		},
+	}
+
+	events := []api.Event{
+		{Reason: "Scheduled", LastTimestamp: at(5)},
+		{Reason: "Pulling", InvolvedObject: api.ObjectReference{FieldPath: "spec.containers{build}"}, FirstTimestamp: at(6)},
+		{Reason: "Pulled", InvolvedObject: api.ObjectReference{FieldPath: "spec.containers{build}"}, LastTimestamp: at(26)},
+		{Reason: "Pulled", InvolvedObject: api.ObjectReference{FieldPath: "spec.containers{helper}"}, LastTimestamp: at(27)},
+	}
+
+	times := getPodStartupTimes(pod, events)
+	assert.Equal(t, 5*time.Second, times.Scheduling)
+	assert.Equal(t, 32*time.Second, times.Startup)
+	assert.Equal(t, map[string]time.Duration{"build": 20 * time.Second}, times.ImagePulls)
+	assert.Equal(t, "started in 32s (scheduling 5s, pulling images 20s)", times.String())
+}
+
+func TestGetContainerName(t *testing.T) {
+	tests := map[string]string{
+		"spec.containers{build}":    "build",
+		"spec.initContainers{init}": "init",
+		"":                          "",
+		"spec.containers{truncated": "",
+	}
+
+	for fieldPath, expected := range tests {
+		event := api.Event{InvolvedObject: api.ObjectReference{FieldPath: fieldPath}}
+		assert.Equal(t, expected, getContainerName(event), fieldPath)
+	}
+}
+
+func TestPodStartupMetrics(t *testing.T) {
+	metrics := newPodStartupMetrics()
+	metrics.Observe("abcdef12", podStartupTimes{
+		Scheduling: 5 * time.Second,
+		Startup:    32 * time.Second,
+		ImagePulls: map[string]time.Duration{"build": 20 * time.Second},
+	})
+
+	ch := make(chan *prometheus.Desc, 10)
+	metrics.Describe(ch)
+	assert.Len(t, ch, 3)
+
+	metricsCh := make(chan prometheus.Metric, 10)
+	metrics.Collect(metricsCh)
+	assert.Len(t, metricsCh, 3)
+}
@@ -0,0 +1,141 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"k8s.io/kubernetes/pkg/api"
+)
+
+const defaultNamespacePrefix = "ci-job"
+
+type namespaceManifest struct {
+	resource   string
+	apiVersion string
+	path       string
+}
+
+func (s *executor) getNamespaceManifests() []namespaceManifest {
+	var manifests []namespaceManifest
+	if path := s.Config.Kubernetes.NamespaceResourceQuota; path != "" {
+		manifests = append(manifests, namespaceManifest{resource: "resourcequotas", apiVersion: "v1", path: path})
+	}
+	if path := s.Config.Kubernetes.NamespaceNetworkPolicy; path != "" {
+		manifests = append(manifests, namespaceManifest{resource: "networkpolicies", apiVersion: "networking.k8s.io/v1", path: path})
+	}
+	return manifests
+}
+
+// read returns the manifest, in JSON format, of the object to be
+// created in the namespace along with its API version
+func (m *namespaceManifest) read(namespace string) (data []byte, apiVersion string, err error) {
+	data, err = ioutil.ReadFile(m.path)
+	if err != nil {
+		return
+	}
+
+	if data, err = yaml.YAMLToJSON(data); err != nil {
+		return nil, "", fmt.Errorf("%s: %v", m.path, err)
+	}
+
+	var object map[string]interface{}
+	if err = json.Unmarshal(data, &object); err != nil {
+		return nil, "", fmt.Errorf("%s: %v", m.path, err)
+	}
+
+	apiVersion, _ = object["apiVersion"].(string)
+	if apiVersion == "" {
+		apiVersion = m.apiVersion
+	}
+
+	metadata, _ := object["metadata"].(map[string]interface{})
+	if metadata == nil {
+		metadata = make(map[string]interface{})
+	}
+	if metadata["name"] == nil {
+		metadata["name"] = namespace
+	}
+	metadata["namespace"] = namespace
+	object["metadata"] = metadata
+
+	data, err = json.Marshal(object)
+	return
+}
+
+func (m *namespaceManifest) absPath(apiVersion, namespace string) string {
+	prefix := "/apis"
+	if !strings.Contains(apiVersion, "/") {
+		prefix = "/api"
+	}
+	return strings.Join([]string{prefix, apiVersion, "namespaces", namespace, m.resource}, "/")
+}
+
+func (s *executor) getNamespacePrefix() string {
+	if s.Config.Kubernetes.Namespace == "" {
+		return defaultNamespacePrefix
+	}
+	return s.Config.Kubernetes.Namespace
+}
+
+// setupNamespace creates a namespace dedicated to the job, when
+// namespace_per_job is enabled, together with the configured resource quota
+// and network policy, and returns the namespace of the objects of the job.
+// All objects of the job are created in that namespace and are removed with
+// it during the cleanup.
+func (s *executor) setupNamespace() (string, error) {
+	if !s.Config.Kubernetes.NamespacePerJob {
+		return s.Config.Kubernetes.Namespace, nil
+	}
+	if s.namespace != nil {
+		return s.namespace.Name, nil
+	}
+
+	namespace, err := s.kubeClient.Namespaces().Create(&api.Namespace{
+		ObjectMeta: api.ObjectMeta{
+			Name:   fmt.Sprintf("%s-%d", s.namespacePrefix, s.Build.ID),
+			Labels: getObjectLabels(s.Build),
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	s.namespace = namespace
+	active.Add("namespace", "", namespace.Name)
+
+	s.Println("Created namespace", namespace.Name, "for the job")
+
+	for _, manifest := range s.getNamespaceManifests() {
+		data, apiVersion, err := manifest.read(namespace.Name)
+		if err != nil {
+			return "", err
+		}
+
+		err = s.kubeClient.RESTClient.Post().
+			AbsPath(manifest.absPath(apiVersion, namespace.Name)).
+			SetHeader("Content-Type", "application/json").
+			Body(data).
+			Do().
+			Error()
+		if err != nil {
+			return "", fmt.Errorf("error creating %s in namespace %s: %v", manifest.resource, namespace.Name, err)
+		}
+	}
+
+	return namespace.Name, nil
+}
+
+func (s *executor) cleanupNamespace() {
+	if s.namespace == nil {
+		return
+	}
+
+	err := s.kubeClient.Namespaces().Delete(s.namespace.Name)
+	if err != nil {
+		s.Errorln("Error cleaning up namespace:", err.Error())
+	}
+	active.Remove("namespace", "", s.namespace.Name)
+}
@@ -0,0 +1,169 @@
+package kubernetes
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/testapi"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+	"k8s.io/kubernetes/pkg/client/restclient"
+	client "k8s.io/kubernetes/pkg/client/unversioned"
+	"k8s.io/kubernetes/pkg/client/unversioned/fake"
+	"k8s.io/kubernetes/pkg/runtime"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors"
+)
+
+const testResourceQuota = `
+apiVersion: v1
+kind: ResourceQuota
+metadata:
+  name: job-quota
+spec:
+  hard:
+    pods: "4"
+`
+
+const testNetworkPolicy = `{"kind": "NetworkPolicy", "spec": {"podSelector": {}}}`
+
+func writeManifest(t *testing.T, content string) string {
+	file, err := ioutil.TempFile("", "manifest")
+	require.NoError(t, err)
+	defer file.Close()
+
+	_, err = file.WriteString(content)
+	require.NoError(t, err)
+	return file.Name()
+}
+
+func TestSetupNamespace(t *testing.T) {
+	version := testapi.Default.GroupVersion().Version
+	codec := testapi.Default.Codec()
+
+	resourceQuota := writeManifest(t, testResourceQuota)
+	defer os.Remove(resourceQuota)
+	networkPolicy := writeManifest(t, testNetworkPolicy)
+	defer os.Remove(networkPolicy)
+
+	created := make(map[string]map[string]interface{})
+	clientFunc := func(req *http.Request) (*http.Response, error) {
+		data, err := ioutil.ReadAll(req.Body)
+		require.NoError(t, err)
+
+		var body runtime.Object = &unversioned.Status{Status: unversioned.StatusSuccess}
+		switch p, m := req.URL.Path, req.Method; {
+		case m == "POST" && p == "/api/"+version+"/namespaces":
+			namespace := &api.Namespace{}
+			require.NoError(t, runtime.DecodeInto(codec, data, namespace))
+			body = namespace
+		case m == "POST":
+			object := make(map[string]interface{})
+			require.NoError(t, json.Unmarshal(data, &object))
+			created[p] = object
+		default:
+			return nil, fmt.Errorf("unexpected request. method: %s, path: %s", m, p)
+		}
+
+		data, err = runtime.Encode(codec, body)
+		require.NoError(t, err)
+
+		resp := &http.Response{StatusCode: 200, Body: FakeReadCloser{
+			Reader: bytes.NewBuffer(data),
+		}}
+		resp.Header = make(http.Header)
+		resp.Header.Add("Content-Type", "application/json")
+		return resp, nil
+	}
+
+	c := client.NewOrDie(&restclient.Config{ContentConfig: restclient.ContentConfig{GroupVersion: &unversioned.GroupVersion{Version: version}}})
+	fakeClient := fake.RESTClient{
+		Codec:  codec,
+		Client: fake.CreateHTTPClient(clientFunc),
+	}
+	c.Client = fakeClient.Client
+
+	kubernetesConfig := &common.KubernetesConfig{
+		Namespace:              "gitlab",
+		NamespacePerJob:        true,
+		NamespaceResourceQuota: resourceQuota,
+		NamespaceNetworkPolicy: networkPolicy,
+	}
+	s := &executor{
+		AbstractExecutor: executors.AbstractExecutor{
+			Config: common.RunnerConfig{
+				RunnerSettings: common.RunnerSettings{
+					Kubernetes: kubernetesConfig,
+				},
+			},
+			Build: &common.Build{
+				GetBuildResponse: common.GetBuildResponse{
+					ID: 1234,
+				},
+				Runner: &common.RunnerConfig{},
+			},
+		},
+		kubeClient:      c,
+		namespacePrefix: "gitlab",
+	}
+
+	namespace, err := s.setupNamespace()
+	require.NoError(t, err)
+	assert.Equal(t, "gitlab-1234", namespace)
+	require.NotNil(t, s.namespace)
+	assert.Equal(t, "gitlab-1234", s.namespace.Name)
+	assert.Equal(t, getObjectLabels(s.Build), s.namespace.Labels)
+	assert.Equal(t, "gitlab", kubernetesConfig.Namespace, "the configuration isn't modified")
+	assert.True(t, active.Contains("namespace", "", "gitlab-1234"))
+	active.Remove("namespace", "", "gitlab-1234")
+
+	quota := created["/api/v1/namespaces/gitlab-1234/resourcequotas"]
+	require.NotNil(t, quota)
+	assert.Equal(t, map[string]interface{}{"name": "job-quota", "namespace": "gitlab-1234"}, quota["metadata"])
+
+	policy := created["/apis/networking.k8s.io/v1/namespaces/gitlab-1234/networkpolicies"]
+	require.NotNil(t, policy)
+	assert.Equal(t, map[string]interface{}{"name": "gitlab-1234", "namespace": "gitlab-1234"}, policy["metadata"])
+}
+
+func TestGetNamespacePrefix(t *testing.T) {
+	s := &executor{
+		AbstractExecutor: executors.AbstractExecutor{
+			Config: common.RunnerConfig{
+				RunnerSettings: common.RunnerSettings{
+					Kubernetes: &common.KubernetesConfig{},
+				},
+			},
+		},
+	}
+	assert.Equal(t, "ci-job", s.getNamespacePrefix())
+
+	s.Config.Kubernetes.Namespace = "gitlab"
+	assert.Equal(t, "gitlab", s.getNamespacePrefix())
+}
+
+func TestSetupNamespaceDisabled(t *testing.T) {
+	s := &executor{
+		AbstractExecutor: executors.AbstractExecutor{
+			Config: common.RunnerConfig{
+				RunnerSettings: common.RunnerSettings{
+					Kubernetes: &common.KubernetesConfig{Namespace: "gitlab"},
+				},
+			},
+		},
+	}
+
+	namespace, err := s.setupNamespace()
+	assert.NoError(t, err)
+	assert.Equal(t, "gitlab", namespace)
+	assert.Nil(t, s.namespace)
+}
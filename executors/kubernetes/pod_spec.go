@@ -0,0 +1,174 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/runtime"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/patch"
+)
+
+// getGeneratedPatches returns strategic merge patches of the pod spec setting
+// the fields that aren't known to this version of the kubernetes client
+func (s *executor) getGeneratedPatches() (patches [][]byte, err error) {
+	volumesPatch, err := s.getVolumesPatch()
+	if err != nil {
+		return nil, err
+	}
+	if volumesPatch != nil {
+		patches = append(patches, volumesPatch)
+	}
+
+	fields := make(map[string]interface{})
+	if priorityClassName := s.Config.Kubernetes.PriorityClassName; priorityClassName != "" {
+		fields["priorityClassName"] = priorityClassName
+	}
+	if runtimeClassName := s.Config.Kubernetes.RuntimeClassName; runtimeClassName != "" {
+		fields["runtimeClassName"] = runtimeClassName
+	}
+
+	dnsPolicy, err := s.Config.Kubernetes.DNSPolicy.Get()
+	if err != nil {
+		return nil, err
+	}
+	if dnsPolicy != "" {
+		fields["dnsPolicy"] = dnsPolicy
+	}
+	if dnsConfig := s.Config.Kubernetes.DNSConfig; dnsConfig != nil {
+		fields["dnsConfig"] = buildDNSConfig(dnsConfig)
+	}
+
+	constraints, err := buildTopologySpreadConstraints(s.Config.Kubernetes.TopologySpreadConstraints, map[string]string{
+		runnerLabel: s.Build.Runner.ShortDescription(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(constraints) > 0 {
+		fields["topologySpreadConstraints"] = constraints
+	}
+
+	if len(fields) > 0 {
+		fieldsPatch, err := json.Marshal(fields)
+		if err != nil {
+			return nil, err
+		}
+		patches = append(patches, fieldsPatch)
+	}
+
+	return
+}
+
+// podDNSConfig is the dnsConfig of the pod spec, not known to this version
+// of the kubernetes client
+type podDNSConfig struct {
+	Nameservers []string             `json:"nameservers,omitempty"`
+	Searches    []string             `json:"searches,omitempty"`
+	Options     []podDNSConfigOption `json:"options,omitempty"`
+}
+
+type podDNSConfigOption struct {
+	Name  string  `json:"name"`
+	Value *string `json:"value,omitempty"`
+}
+
+func buildDNSConfig(config *common.KubernetesDNSConfig) podDNSConfig {
+	dnsConfig := podDNSConfig{
+		Nameservers: config.Nameservers,
+		Searches:    config.Searches,
+	}
+	for _, option := range config.Options {
+		dnsConfig.Options = append(dnsConfig.Options, podDNSConfigOption{
+			Name:  option.Name,
+			Value: option.Value,
+		})
+	}
+	return dnsConfig
+}
+
+// checkDNSConfig verifies the DNS settings of the build pod
+func (s *executor) checkDNSConfig() error {
+	dnsPolicy, err := s.Config.Kubernetes.DNSPolicy.Get()
+	if err != nil {
+		return err
+	}
+
+	dnsConfig := s.Config.Kubernetes.DNSConfig
+	if dnsPolicy == "None" && (dnsConfig == nil || len(dnsConfig.Nameservers) == 0) {
+		return fmt.Errorf("dns_policy %q requires nameservers to be set in dns_config", common.DNSPolicyNone)
+	}
+	return nil
+}
+
+// applyPodSpecPatches returns the manifest of the pod with the generated
+// patches and all pod_spec patches applied to its spec
+func (s *executor) applyPodSpecPatches(pod *api.Pod, generated [][]byte) ([]byte, error) {
+	data, err := runtime.Encode(s.kubeClient.RESTClient.Codec(), pod)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest map[string]json.RawMessage
+	if err = json.Unmarshal(data, &manifest); err != nil {
+		return nil, err
+	}
+
+	spec := []byte(manifest["spec"])
+	for _, generatedPatch := range generated {
+		if spec, err = patch.Apply(patch.Strategic, spec, generatedPatch); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, podSpec := range s.Config.Kubernetes.PodSpec {
+		patchData, err := podSpec.PodSpecPatch()
+		if err != nil {
+			return nil, err
+		}
+
+		s.Debugln("Applying pod_spec patch", podSpec.Name)
+		if spec, err = patch.Apply(podSpec.PatchType, spec, patchData); err != nil {
+			return nil, fmt.Errorf("pod_spec %q: %v", podSpec.Name, err)
+		}
+	}
+	manifest["spec"] = json.RawMessage(spec)
+
+	return json.Marshal(manifest)
+}
+
+// createPod creates the build pod. When pod_spec patches or settings not
+// known to this version of the kubernetes client are configured, the
+// patched manifest is sent as it is. With run_as_job the pod is created
+// by a Job.
+func (s *executor) createPod(pod *api.Pod) (*api.Pod, error) {
+	generated, err := s.getGeneratedPatches()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(s.Config.Kubernetes.PodSpec) == 0 && len(generated) == 0 && !s.Config.Kubernetes.RunAsJob {
+		return s.kubeClient.Pods(pod.Namespace).Create(pod)
+	}
+
+	data, err := s.applyPodSpecPatches(pod, generated)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.Config.Kubernetes.RunAsJob {
+		return s.createJob(pod, data)
+	}
+
+	result := &api.Pod{}
+	err = s.kubeClient.RESTClient.Post().
+		Namespace(pod.Namespace).
+		Resource("pods").
+		SetHeader("Content-Type", "application/json").
+		Body(data).
+		Do().
+		Into(result)
+	return result, err
+}
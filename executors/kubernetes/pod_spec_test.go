@@ -0,0 +1,86 @@
+package kubernetes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+func TestGetGeneratedPatches(t *testing.T) {
+	s := newVolumesTestExecutor(common.KubernetesVolumes{})
+	patches, err := s.getGeneratedPatches()
+	assert.NoError(t, err)
+	assert.Empty(t, patches)
+
+	s.Config.Kubernetes.PriorityClassName = "ci-low"
+	s.Config.Kubernetes.Volumes.CSIs = []common.KubernetesCSI{
+		{Name: "store", MountPath: "/store", Driver: "csi.example.com"},
+	}
+
+	patches, err = s.getGeneratedPatches()
+	require.NoError(t, err)
+	require.Equal(t, 2, len(patches))
+	assert.Equal(t, `{"volumes":[{"name":"store","csi":{"driver":"csi.example.com"}}]}`, string(patches[0]))
+	assert.Equal(t, `{"priorityClassName":"ci-low"}`, string(patches[1]))
+}
+
+func TestGetGeneratedPatchesRuntimeClass(t *testing.T) {
+	s := newVolumesTestExecutor(common.KubernetesVolumes{})
+	s.Config.Kubernetes.RuntimeClassName = "gvisor"
+
+	patches, err := s.getGeneratedPatches()
+	require.NoError(t, err)
+	require.Equal(t, 1, len(patches))
+	assert.Equal(t, `{"runtimeClassName":"gvisor"}`, string(patches[0]))
+
+	s.Config.Kubernetes.PriorityClassName = "ci-low"
+	patches, err = s.getGeneratedPatches()
+	require.NoError(t, err)
+	require.Equal(t, 1, len(patches))
+	assert.Equal(t, `{"priorityClassName":"ci-low","runtimeClassName":"gvisor"}`, string(patches[0]))
+}
+
+func TestGetGeneratedPatchesDNS(t *testing.T) {
+	ndots := "2"
+
+	s := newVolumesTestExecutor(common.KubernetesVolumes{})
+	s.Config.Kubernetes.DNSPolicy = common.DNSPolicyNone
+	s.Config.Kubernetes.DNSConfig = &common.KubernetesDNSConfig{
+		Nameservers: []string{"10.0.0.53"},
+		Searches:    []string{"ci.example.com"},
+		Options: []common.KubernetesDNSConfigOption{
+			{Name: "ndots", Value: &ndots},
+			{Name: "edns0"},
+		},
+	}
+
+	patches, err := s.getGeneratedPatches()
+	require.NoError(t, err)
+	require.Equal(t, 1, len(patches))
+	assert.Equal(t, `{"dnsConfig":{"nameservers":["10.0.0.53"],"searches":["ci.example.com"],`+
+		`"options":[{"name":"ndots","value":"2"},{"name":"edns0"}]},"dnsPolicy":"None"}`, string(patches[0]))
+
+	s.Config.Kubernetes.DNSPolicy = "unknown"
+	_, err = s.getGeneratedPatches()
+	assert.Error(t, err)
+}
+
+func TestCheckDNSConfig(t *testing.T) {
+	s := newVolumesTestExecutor(common.KubernetesVolumes{})
+	assert.NoError(t, s.checkDNSConfig())
+
+	s.Config.Kubernetes.DNSPolicy = common.DNSPolicyClusterFirst
+	assert.NoError(t, s.checkDNSConfig())
+
+	s.Config.Kubernetes.DNSPolicy = "unknown"
+	assert.EqualError(t, s.checkDNSConfig(), "unsupported kubernetes-dns-policy: unknown")
+
+	s.Config.Kubernetes.DNSPolicy = common.DNSPolicyNone
+	assert.EqualError(t, s.checkDNSConfig(), `dns_policy "none" requires nameservers to be set in dns_config`)
+
+	s.Config.Kubernetes.DNSConfig = &common.KubernetesDNSConfig{Nameservers: []string{"10.0.0.53"}}
+	assert.NoError(t, s.checkDNSConfig())
+}
@@ -0,0 +1,309 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+const nodeSelectorOverwriteVariablePrefix = "KUBERNETES_NODE_SELECTOR_"
+const nodeTolerationsOverwriteVariablePrefix = "KUBERNETES_NODE_TOLERATIONS_"
+
+// parseToleration converts a `key=value:effect` (or `key:effect`, `key=value`,
+// `key`) description into a kubernetes Toleration
+func parseToleration(description string) api.Toleration {
+	toleration := api.Toleration{
+		Operator: api.TolerationOpExists,
+	}
+
+	keyValue := description
+	if i := strings.LastIndex(description, ":"); i >= 0 {
+		keyValue = description[:i]
+		toleration.Effect = api.TaintEffect(description[i+1:])
+	}
+
+	parts := strings.SplitN(keyValue, "=", 2)
+	toleration.Key = parts[0]
+	if len(parts) == 2 {
+		toleration.Operator = api.TolerationOpEqual
+		toleration.Value = parts[1]
+	}
+
+	return toleration
+}
+
+// buildTolerations converts the node_tolerations table, where the key is
+// `key=value` and the value is a taint effect, into kubernetes Tolerations
+func buildTolerations(tolerations map[string]string) []api.Toleration {
+	var keys []string
+	for keyValue := range tolerations {
+		keys = append(keys, keyValue)
+	}
+	sort.Strings(keys)
+
+	var result []api.Toleration
+	for _, keyValue := range keys {
+		description := keyValue
+		if effect := tolerations[keyValue]; effect != "" {
+			description += ":" + effect
+		}
+		result = append(result, parseToleration(description))
+	}
+	return result
+}
+
+func buildNodeSelectorTerm(term common.KubernetesNodeSelectorTerm) api.NodeSelectorTerm {
+	result := api.NodeSelectorTerm{}
+	for _, expression := range term.MatchExpressions {
+		result.MatchExpressions = append(result.MatchExpressions, api.NodeSelectorRequirement{
+			Key:      expression.Key,
+			Operator: api.NodeSelectorOperator(expression.Operator),
+			Values:   expression.Values,
+		})
+	}
+	return result
+}
+
+func buildPodAffinityTerm(term common.KubernetesPodAffinityTerm) api.PodAffinityTerm {
+	result := api.PodAffinityTerm{
+		Namespaces:  term.Namespaces,
+		TopologyKey: term.TopologyKey,
+	}
+	if len(term.MatchLabels) > 0 {
+		result.LabelSelector = &unversioned.LabelSelector{
+			MatchLabels: term.MatchLabels,
+		}
+	}
+	return result
+}
+
+func buildPodAffinityTerms(affinity *common.KubernetesPodAffinity) (required []api.PodAffinityTerm, preferred []api.WeightedPodAffinityTerm) {
+	for _, term := range affinity.RequiredDuringSchedulingIgnoredDuringExecution {
+		required = append(required, buildPodAffinityTerm(term))
+	}
+	for _, term := range affinity.PreferredDuringSchedulingIgnoredDuringExecution {
+		preferred = append(preferred, api.WeightedPodAffinityTerm{
+			Weight:          term.Weight,
+			PodAffinityTerm: buildPodAffinityTerm(term.PodAffinityTerm),
+		})
+	}
+	return
+}
+
+// buildAffinity converts the affinity configuration into kubernetes Affinity
+func buildAffinity(affinity *common.KubernetesAffinity) *api.Affinity {
+	if affinity == nil {
+		return nil
+	}
+
+	result := &api.Affinity{}
+
+	if nodeAffinity := affinity.NodeAffinity; nodeAffinity != nil {
+		result.NodeAffinity = &api.NodeAffinity{}
+		if len(nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution) > 0 {
+			selector := &api.NodeSelector{}
+			for _, term := range nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution {
+				selector.NodeSelectorTerms = append(selector.NodeSelectorTerms, buildNodeSelectorTerm(term))
+			}
+			result.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = selector
+		}
+		for _, term := range nodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution {
+			result.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution = append(
+				result.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution,
+				api.PreferredSchedulingTerm{
+					Weight:     term.Weight,
+					Preference: buildNodeSelectorTerm(term.Preference),
+				})
+		}
+	}
+
+	if affinity.PodAffinity != nil {
+		required, preferred := buildPodAffinityTerms(affinity.PodAffinity)
+		result.PodAffinity = &api.PodAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution:  required,
+			PreferredDuringSchedulingIgnoredDuringExecution: preferred,
+		}
+	}
+
+	if affinity.PodAntiAffinity != nil {
+		required, preferred := buildPodAffinityTerms(affinity.PodAntiAffinity)
+		result.PodAntiAffinity = &api.PodAntiAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution:  required,
+			PreferredDuringSchedulingIgnoredDuringExecution: preferred,
+		}
+	}
+
+	return result
+}
+
+// getOverwriteValues returns values of all job variables starting with
+// prefix, validating each of them against the allowed regular expression.
+// When the expression is empty the overwrite is disabled.
+func getOverwriteValues(variables common.BuildVariables, prefix, allowed, configName string) ([]string, error) {
+	if allowed == "" {
+		return nil, nil
+	}
+
+	r, err := regexp.Compile(allowed)
+	if err != nil {
+		return nil, err
+	}
+
+	var values []string
+	for _, variable := range variables {
+		if !strings.HasPrefix(variable.Key, prefix) || variable.Value == "" {
+			continue
+		}
+
+		if !r.MatchString(variable.Value) {
+			return nil, fmt.Errorf("%s='%s' does not match '%s': '%s'",
+				variable.Key, variable.Value, configName, allowed)
+		}
+		values = append(values, variable.Value)
+	}
+	return values, nil
+}
+
+// overwriteScheduling validates the node selectors and tolerations requested
+// by the job, which are later merged with the configured ones
+func (s *executor) overwriteScheduling(build *common.Build) error {
+	variables := build.Variables.Expand()
+
+	selectors, err := getOverwriteValues(variables, nodeSelectorOverwriteVariablePrefix,
+		s.Config.Kubernetes.NodeSelectorOverwriteAllowed, "node_selector_overwrite_allowed")
+	if err != nil {
+		return err
+	}
+
+	for _, selector := range selectors {
+		keyValue := strings.SplitN(selector, "=", 2)
+		if len(keyValue) != 2 {
+			return fmt.Errorf("invalid node selector overwrite '%s': expected key=value", selector)
+		}
+
+		s.Println("Adding node selector", selector)
+		if s.nodeSelectorOverwrite == nil {
+			s.nodeSelectorOverwrite = make(map[string]string)
+		}
+		s.nodeSelectorOverwrite[keyValue[0]] = keyValue[1]
+	}
+
+	tolerations, err := getOverwriteValues(variables, nodeTolerationsOverwriteVariablePrefix,
+		s.Config.Kubernetes.NodeTolerationsOverwriteAllowed, "node_tolerations_overwrite_allowed")
+	if err != nil {
+		return err
+	}
+
+	for _, toleration := range tolerations {
+		s.Println("Adding node toleration", toleration)
+		s.tolerationsOverwrite = append(s.tolerationsOverwrite, parseToleration(toleration))
+	}
+
+	return nil
+}
+
+func (s *executor) getNodeSelector() map[string]string {
+	if len(s.nodeSelectorOverwrite) == 0 {
+		return s.Config.Kubernetes.NodeSelector
+	}
+
+	nodeSelector := make(map[string]string)
+	for key, value := range s.Config.Kubernetes.NodeSelector {
+		nodeSelector[key] = value
+	}
+	for key, value := range s.nodeSelectorOverwrite {
+		nodeSelector[key] = value
+	}
+	return nodeSelector
+}
+
+// topologySpreadConstraint is the topology spread constraint of the pod
+// spec, not known to this version of the kubernetes client
+type topologySpreadConstraint struct {
+	MaxSkew           int32                      `json:"maxSkew"`
+	TopologyKey       string                     `json:"topologyKey"`
+	WhenUnsatisfiable string                     `json:"whenUnsatisfiable"`
+	LabelSelector     *unversioned.LabelSelector `json:"labelSelector"`
+}
+
+// buildTopologySpreadConstraints converts the configured constraints. By
+// default they spread pods of all jobs of the runner.
+func buildTopologySpreadConstraints(constraints []common.KubernetesTopologySpread, labels map[string]string) ([]topologySpreadConstraint, error) {
+	var result []topologySpreadConstraint
+	for _, constraint := range constraints {
+		if constraint.TopologyKey == "" {
+			return nil, fmt.Errorf("topology_key of topology spread constraint is not set")
+		}
+
+		maxSkew := constraint.MaxSkew
+		if maxSkew <= 0 {
+			maxSkew = 1
+		}
+
+		whenUnsatisfiable := constraint.WhenUnsatisfiable
+		switch whenUnsatisfiable {
+		case "":
+			whenUnsatisfiable = "ScheduleAnyway"
+		case "ScheduleAnyway", "DoNotSchedule":
+		default:
+			return nil, fmt.Errorf("unsupported when_unsatisfiable of topology spread constraint: %v", whenUnsatisfiable)
+		}
+
+		matchLabels := constraint.MatchLabels
+		if len(matchLabels) == 0 {
+			matchLabels = labels
+		}
+
+		result = append(result, topologySpreadConstraint{
+			MaxSkew:           maxSkew,
+			TopologyKey:       constraint.TopologyKey,
+			WhenUnsatisfiable: whenUnsatisfiable,
+			LabelSelector:     &unversioned.LabelSelector{MatchLabels: matchLabels},
+		})
+	}
+	return result, nil
+}
+
+// getNodeArchitecture returns the architecture of nodes the build pod is
+// scheduled on, as required by the node selector. Defaults to amd64.
+func (s *executor) getNodeArchitecture() string {
+	nodeSelector := s.getNodeSelector()
+	for _, label := range []string{"kubernetes.io/arch", "beta.kubernetes.io/arch"} {
+		if arch := nodeSelector[label]; arch != "" {
+			return arch
+		}
+	}
+	return "amd64"
+}
+
+// getSchedulingAnnotations returns the annotations used by this version of
+// kubernetes to describe tolerations and affinity of the pod
+func (s *executor) getSchedulingAnnotations() (map[string]string, error) {
+	annotations := make(map[string]string)
+
+	tolerations := append(buildTolerations(s.Config.Kubernetes.NodeTolerations), s.tolerationsOverwrite...)
+	if len(tolerations) > 0 {
+		data, err := json.Marshal(tolerations)
+		if err != nil {
+			return nil, err
+		}
+		annotations[api.TolerationsAnnotationKey] = string(data)
+	}
+
+	if affinity := buildAffinity(s.Config.Kubernetes.Affinity); affinity != nil {
+		data, err := json.Marshal(affinity)
+		if err != nil {
+			return nil, err
+		}
+		annotations[api.AffinityAnnotationKey] = string(data)
+	}
+
+	return annotations, nil
+}
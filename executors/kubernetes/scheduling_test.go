@@ -0,0 +1,193 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors"
+)
+
+func TestParseToleration(t *testing.T) {
+	tests := map[string]api.Toleration{
+		"key":                  {Key: "key", Operator: api.TolerationOpExists},
+		"key:NoSchedule":       {Key: "key", Operator: api.TolerationOpExists, Effect: api.TaintEffectNoSchedule},
+		"key=value":            {Key: "key", Operator: api.TolerationOpEqual, Value: "value"},
+		"key=value:NoSchedule": {Key: "key", Operator: api.TolerationOpEqual, Value: "value", Effect: api.TaintEffectNoSchedule},
+	}
+
+	for description, expected := range tests {
+		assert.Equal(t, expected, parseToleration(description), description)
+	}
+}
+
+func TestBuildTolerations(t *testing.T) {
+	tolerations := buildTolerations(map[string]string{
+		"spot=true": "NoSchedule",
+		"gpu":       "",
+	})
+
+	assert.Equal(t, []api.Toleration{
+		{Key: "gpu", Operator: api.TolerationOpExists},
+		{Key: "spot", Operator: api.TolerationOpEqual, Value: "true", Effect: api.TaintEffectNoSchedule},
+	}, tolerations)
+}
+
+func TestBuildAffinity(t *testing.T) {
+	assert.Nil(t, buildAffinity(nil))
+
+	affinity := buildAffinity(&common.KubernetesAffinity{
+		NodeAffinity: &common.KubernetesNodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: []common.KubernetesNodeSelectorTerm{
+				{
+					MatchExpressions: []common.KubernetesNodeSelectorRequirement{
+						{Key: "pool", Operator: "In", Values: []string{"gpu"}},
+					},
+				},
+			},
+		},
+		PodAntiAffinity: &common.KubernetesPodAffinity{
+			PreferredDuringSchedulingIgnoredDuringExecution: []common.KubernetesWeightedPodAffinityTerm{
+				{
+					Weight: 100,
+					PodAffinityTerm: common.KubernetesPodAffinityTerm{
+						MatchLabels: map[string]string{"app": "gitlab-ci"},
+						TopologyKey: "kubernetes.io/hostname",
+					},
+				},
+			},
+		},
+	})
+
+	require.NotNil(t, affinity.NodeAffinity)
+	require.NotNil(t, affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution)
+	terms := affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	require.Equal(t, 1, len(terms))
+	assert.Equal(t, api.NodeSelectorOpIn, terms[0].MatchExpressions[0].Operator)
+	assert.Nil(t, affinity.PodAffinity)
+	require.NotNil(t, affinity.PodAntiAffinity)
+	require.Equal(t, 1, len(affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution))
+	term := affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution[0]
+	assert.Equal(t, 100, term.Weight)
+	assert.Equal(t, "kubernetes.io/hostname", term.PodAffinityTerm.TopologyKey)
+	assert.Equal(t, map[string]string{"app": "gitlab-ci"}, term.PodAffinityTerm.LabelSelector.MatchLabels)
+}
+
+func newSchedulingTestExecutor(config *common.KubernetesConfig) *executor {
+	return &executor{
+		AbstractExecutor: executors.AbstractExecutor{
+			Config: common.RunnerConfig{
+				RunnerSettings: common.RunnerSettings{
+					Kubernetes: config,
+				},
+			},
+		},
+	}
+}
+
+func newSchedulingTestBuild(variables ...common.BuildVariable) *common.Build {
+	return &common.Build{
+		GetBuildResponse: common.GetBuildResponse{
+			Variables: variables,
+		},
+		Runner: &common.RunnerConfig{},
+	}
+}
+
+func TestOverwriteScheduling(t *testing.T) {
+	s := newSchedulingTestExecutor(&common.KubernetesConfig{
+		NodeSelector:                    map[string]string{"arch": "amd64"},
+		NodeSelectorOverwriteAllowed:    "^pool=.*$",
+		NodeTolerations:                 map[string]string{"dedicated=ci": "NoSchedule"},
+		NodeTolerationsOverwriteAllowed: "^spot.*$",
+	})
+
+	build := newSchedulingTestBuild(
+		common.BuildVariable{Key: "KUBERNETES_NODE_SELECTOR_POOL", Value: "pool=gpu"},
+		common.BuildVariable{Key: "KUBERNETES_NODE_TOLERATIONS_SPOT", Value: "spot=true:NoSchedule"},
+	)
+
+	require.NoError(t, s.overwriteScheduling(build))
+	assert.Equal(t, map[string]string{"arch": "amd64", "pool": "gpu"}, s.getNodeSelector())
+
+	annotations, err := s.getSchedulingAnnotations()
+	require.NoError(t, err)
+	var tolerations []api.Toleration
+	require.NoError(t, json.Unmarshal([]byte(annotations[api.TolerationsAnnotationKey]), &tolerations))
+	assert.Equal(t, []api.Toleration{
+		{Key: "dedicated", Operator: api.TolerationOpEqual, Value: "ci", Effect: api.TaintEffectNoSchedule},
+		{Key: "spot", Operator: api.TolerationOpEqual, Value: "true", Effect: api.TaintEffectNoSchedule},
+	}, tolerations)
+	_, ok := annotations[api.AffinityAnnotationKey]
+	assert.False(t, ok)
+}
+
+func TestOverwriteSchedulingNotAllowed(t *testing.T) {
+	s := newSchedulingTestExecutor(&common.KubernetesConfig{
+		NodeSelectorOverwriteAllowed: "^pool=.*$",
+	})
+
+	build := newSchedulingTestBuild(
+		common.BuildVariable{Key: "KUBERNETES_NODE_SELECTOR_ARCH", Value: "arch=arm"},
+	)
+
+	err := s.overwriteScheduling(build)
+	assert.EqualError(t, err, "KUBERNETES_NODE_SELECTOR_ARCH='arch=arm' does not match 'node_selector_overwrite_allowed': '^pool=.*$'")
+}
+
+func TestOverwriteSchedulingDisabled(t *testing.T) {
+	s := newSchedulingTestExecutor(&common.KubernetesConfig{
+		NodeSelector: map[string]string{"arch": "amd64"},
+	})
+
+	build := newSchedulingTestBuild(
+		common.BuildVariable{Key: "KUBERNETES_NODE_SELECTOR_ARCH", Value: "arch=arm"},
+		common.BuildVariable{Key: "KUBERNETES_NODE_TOLERATIONS_SPOT", Value: "spot=true"},
+	)
+
+	require.NoError(t, s.overwriteScheduling(build))
+	assert.Equal(t, map[string]string{"arch": "amd64"}, s.getNodeSelector())
+	assert.Empty(t, s.tolerationsOverwrite)
+}
+
+func TestBuildTopologySpreadConstraints(t *testing.T) {
+	labels := map[string]string{"gitlab-runner": "abcdef12"}
+
+	constraints, err := buildTopologySpreadConstraints([]common.KubernetesTopologySpread{
+		{TopologyKey: "topology.kubernetes.io/zone"},
+		{
+			MaxSkew:           2,
+			TopologyKey:       "kubernetes.io/hostname",
+			WhenUnsatisfiable: "DoNotSchedule",
+			MatchLabels:       map[string]string{"team": "backend"},
+		},
+	}, labels)
+	require.NoError(t, err)
+
+	require.Equal(t, 2, len(constraints))
+	assert.Equal(t, topologySpreadConstraint{
+		MaxSkew:           1,
+		TopologyKey:       "topology.kubernetes.io/zone",
+		WhenUnsatisfiable: "ScheduleAnyway",
+		LabelSelector:     &unversioned.LabelSelector{MatchLabels: labels},
+	}, constraints[0])
+	assert.Equal(t, topologySpreadConstraint{
+		MaxSkew:           2,
+		TopologyKey:       "kubernetes.io/hostname",
+		WhenUnsatisfiable: "DoNotSchedule",
+		LabelSelector:     &unversioned.LabelSelector{MatchLabels: map[string]string{"team": "backend"}},
+	}, constraints[1])
+
+	_, err = buildTopologySpreadConstraints([]common.KubernetesTopologySpread{{}}, labels)
+	assert.EqualError(t, err, "topology_key of topology spread constraint is not set")
+
+	_, err = buildTopologySpreadConstraints([]common.KubernetesTopologySpread{
+		{TopologyKey: "kubernetes.io/hostname", WhenUnsatisfiable: "Never"},
+	}, labels)
+	assert.EqualError(t, err, "unsupported when_unsatisfiable of topology spread constraint: Never")
+}
@@ -0,0 +1,160 @@
+package kubernetes
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/util/intstr"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers"
+)
+
+// serviceImageName strips the tag from image, eg. registry.local:5000/postgres:9.6
+// becomes registry.local:5000/postgres
+func serviceImageName(image string) string {
+	name := image
+	if i := strings.LastIndex(name, "@"); i >= 0 {
+		name = name[:i]
+	}
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name = name[:i]
+	}
+	return name
+}
+
+// getServiceProbe returns readiness probe configured for the service image.
+// A probe configured for `postgres` matches `postgres:9.6` as well as
+// `library/postgres` and `registry.local/postgres`.
+func (s *executor) getServiceProbe(image string) *api.Probe {
+	name := serviceImageName(image)
+
+	for _, probe := range s.Config.Kubernetes.ServiceProbes {
+		if probe.Service != name && !strings.HasSuffix(name, "/"+probe.Service) {
+			continue
+		}
+
+		result := &api.Probe{
+			InitialDelaySeconds: probe.InitialDelaySeconds,
+			PeriodSeconds:       probe.PeriodSeconds,
+			TimeoutSeconds:      probe.TimeoutSeconds,
+			FailureThreshold:    probe.FailureThreshold,
+		}
+
+		switch {
+		case len(probe.Command) > 0:
+			result.Exec = &api.ExecAction{Command: probe.Command}
+		case probe.HTTPPath != "":
+			result.HTTPGet = &api.HTTPGetAction{Path: probe.HTTPPath, Port: intstr.FromInt(probe.Port)}
+		case probe.Port > 0:
+			result.TCPSocket = &api.TCPSocketAction{Port: intstr.FromInt(probe.Port)}
+		default:
+			continue
+		}
+		return result
+	}
+	return nil
+}
+
+func (s *executor) getServiceContainerStatuses(pod *api.Pod) (notReady []api.ContainerStatus, err error) {
+	for _, status := range pod.Status.ContainerStatuses {
+		if !strings.HasPrefix(status.Name, "svc-") || status.Ready {
+			continue
+		}
+
+		if status.State.Terminated != nil {
+			return []api.ContainerStatus{status}, fmt.Errorf("service container %s terminated with exit code %d",
+				status.Name, status.State.Terminated.ExitCode)
+		}
+		notReady = append(notReady, status)
+	}
+	return
+}
+
+func (s *executor) printServiceLogs(statuses []api.ContainerStatus, reason error) {
+	var buffer bytes.Buffer
+
+	for _, status := range statuses {
+		buffer.WriteString("\n")
+		buffer.WriteString(helpers.ANSI_YELLOW + "*** WARNING:" + helpers.ANSI_RESET + " Service " + status.Name + " (" + status.Image + ") is not ready.\n")
+		buffer.WriteString("\n")
+		buffer.WriteString(strings.TrimSpace(reason.Error()) + "\n")
+
+		logs, err := s.kubeClient.Pods(s.pod.Namespace).GetLogs(s.pod.Name, &api.PodLogOptions{
+			Container:  status.Name,
+			Timestamps: true,
+		}).Do().Raw()
+		if err == nil {
+			if containerLog := strings.TrimSpace(string(logs)); containerLog != "" {
+				buffer.WriteString("\n")
+				buffer.WriteString(containerLog)
+				buffer.WriteString("\n")
+			}
+		} else {
+			buffer.WriteString(strings.TrimSpace(err.Error()) + "\n")
+		}
+
+		buffer.WriteString("\n")
+		buffer.WriteString(helpers.ANSI_YELLOW + "*********" + helpers.ANSI_RESET + "\n")
+	}
+
+	s.Println(buffer.String())
+}
+
+// waitForServices delays execution of scripts until all service containers
+// of the pod are ready, which, for services with a readiness probe, means
+// that the probe succeeded
+func (s *executor) waitForServices(ctx context.Context) error {
+	if len(s.options.Services) == 0 {
+		return nil
+	}
+
+	timeout := s.Config.Kubernetes.WaitForServicesTimeout
+	if timeout == 0 {
+		timeout = common.DefaultWaitForServicesTimeout
+	}
+	if timeout < 0 {
+		return nil
+	}
+
+	status, err := waitForPodRunning(ctx, s.kubeClient, s.pod, s.BuildTrace, s.Config.Kubernetes)
+	if err != nil {
+		return err
+	}
+	if status != api.PodRunning {
+		return fmt.Errorf("pod failed to enter running state: %s", status)
+	}
+
+	s.Println("Waiting for services to be ready...")
+
+	deadline := time.Now().Add(time.Duration(timeout) * time.Second)
+	for {
+		pod, err := s.kubeClient.Pods(s.pod.Namespace).Get(s.pod.Name)
+		if err != nil {
+			return err
+		}
+
+		notReady, err := s.getServiceContainerStatuses(pod)
+		if err == nil && len(notReady) == 0 {
+			return nil
+		}
+
+		if err == nil && time.Now().After(deadline) {
+			err = fmt.Errorf("services weren't ready in %d seconds", timeout)
+		}
+		if err != nil {
+			s.printServiceLogs(notReady, err)
+			return &common.BuildError{Inner: err}
+		}
+
+		select {
+		case <-time.After(time.Second):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
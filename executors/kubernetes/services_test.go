@@ -0,0 +1,86 @@
+package kubernetes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/util/intstr"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors"
+)
+
+func TestServiceImageName(t *testing.T) {
+	tests := map[string]string{
+		"postgres":                             "postgres",
+		"postgres:9.6":                         "postgres",
+		"library/postgres:9.6":                 "library/postgres",
+		"registry.local:5000/postgres":         "registry.local:5000/postgres",
+		"registry.local:5000/postgres:9.6":     "registry.local:5000/postgres",
+		"postgres@sha256:0123456789abcdef0123": "postgres",
+	}
+
+	for image, expected := range tests {
+		assert.Equal(t, expected, serviceImageName(image), image)
+	}
+}
+
+func TestGetServiceProbe(t *testing.T) {
+	s := &executor{
+		AbstractExecutor: executors.AbstractExecutor{
+			Config: common.RunnerConfig{
+				RunnerSettings: common.RunnerSettings{
+					Kubernetes: &common.KubernetesConfig{
+						ServiceProbes: []common.KubernetesServiceProbe{
+							{Service: "postgres", Port: 5432, PeriodSeconds: 2},
+							{Service: "elasticsearch", Port: 9200, HTTPPath: "/_cluster/health"},
+							{Service: "redis", Command: []string{"redis-cli", "ping"}},
+							{Service: "mysql"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	probe := s.getServiceProbe("registry.local/postgres:9.6")
+	require.NotNil(t, probe)
+	assert.Equal(t, &api.TCPSocketAction{Port: intstr.FromInt(5432)}, probe.TCPSocket)
+	assert.Equal(t, int32(2), probe.PeriodSeconds)
+
+	probe = s.getServiceProbe("elasticsearch:5")
+	require.NotNil(t, probe)
+	assert.Equal(t, &api.HTTPGetAction{Path: "/_cluster/health", Port: intstr.FromInt(9200)}, probe.HTTPGet)
+
+	probe = s.getServiceProbe("redis")
+	require.NotNil(t, probe)
+	assert.Equal(t, &api.ExecAction{Command: []string{"redis-cli", "ping"}}, probe.Exec)
+
+	assert.Nil(t, s.getServiceProbe("mysql"))
+	assert.Nil(t, s.getServiceProbe("my-postgres"))
+}
+
+func TestGetServiceContainerStatuses(t *testing.T) {
+	s := &executor{}
+
+	pod := &api.Pod{
+		Status: api.PodStatus{
+			ContainerStatuses: []api.ContainerStatus{
+				{Name: "build", Ready: false},
+				{Name: "svc-0", Ready: true},
+				{Name: "svc-1", Ready: false},
+			},
+		},
+	}
+
+	notReady, err := s.getServiceContainerStatuses(pod)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(notReady))
+	assert.Equal(t, "svc-1", notReady[0].Name)
+
+	pod.Status.ContainerStatuses[2].State.Terminated = &api.ContainerStateTerminated{ExitCode: 1}
+	_, err = s.getServiceContainerStatuses(pod)
+	assert.EqualError(t, err, "service container svc-1 terminated with exit code 1")
+}
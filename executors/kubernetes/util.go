@@ -23,6 +23,18 @@ func init() {
 }
 
 func getKubeClientConfig(config *common.KubernetesConfig) (*restclient.Config, error) {
+	restConfig, err := getBaseKubeClientConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = setupAuth(restConfig, config); err != nil {
+		return nil, err
+	}
+	return restConfig, nil
+}
+
+func getBaseKubeClientConfig(config *common.KubernetesConfig) (*restclient.Config, error) {
 	switch {
 	case len(config.CertFile) > 0:
 		if len(config.KeyFile) == 0 || len(config.CAFile) == 0 {
@@ -40,21 +52,44 @@ func getKubeClientConfig(config *common.KubernetesConfig) (*restclient.Config, e
 	case len(config.Host) > 0:
 		return &restclient.Config{
 			Host: config.Host,
+			TLSClientConfig: restclient.TLSClientConfig{
+				CAFile: config.CAFile,
+			},
 		}, nil
 
+	case len(config.KubeConfig) > 0 || len(config.Context) > 0:
+		return loadKubeConfig(config)
+
 	default:
 		// Try in cluster config first
 		if inClusterCfg, err := restclient.InClusterConfig(); err == nil {
 			return inClusterCfg, nil
 		}
-		config, err := clientcmd.NewDefaultClientConfigLoadingRules().Load()
-		if err != nil {
-			return nil, err
-		}
+		return loadKubeConfig(config)
+	}
+}
+
+// loadKubeConfig returns the configuration of the selected context of the
+// kubeconfig file, or of its current context
+func loadKubeConfig(config *common.KubernetesConfig) (*restclient.Config, error) {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = config.KubeConfig
 
-		clientConfig := clientcmd.NewDefaultClientConfig(*config, &clientcmd.ConfigOverrides{})
-		return clientConfig.ClientConfig()
+	kubeConfig, err := loadingRules.Load()
+	if err != nil {
+		return nil, err
 	}
+
+	if len(config.Context) > 0 {
+		if _, ok := kubeConfig.Contexts[config.Context]; !ok {
+			return nil, fmt.Errorf("context %q not found in kubeconfig", config.Context)
+		}
+	}
+
+	clientConfig := clientcmd.NewDefaultClientConfig(*kubeConfig, &clientcmd.ConfigOverrides{
+		CurrentContext: config.Context,
+	})
+	return clientConfig.ClientConfig()
 }
 
 func getKubeClient(config *common.KubernetesConfig) (*client.Client, error) {
@@ -90,30 +125,46 @@ func isRunning(pod *api.Pod) (bool, error) {
 	}
 }
 
+// isScheduled returns true when the pod was assigned to a node
+func isScheduled(pod *api.Pod) bool {
+	if pod.Spec.NodeName != "" {
+		return true
+	}
+
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == api.PodScheduled {
+			return condition.Status == api.ConditionTrue
+		}
+	}
+	return false
+}
+
 type podPhaseResponse struct {
-	done  bool
-	phase api.PodPhase
-	err   error
+	done      bool
+	phase     api.PodPhase
+	err       error
+	scheduled bool
 }
 
 func getPodPhase(c *client.Client, pod *api.Pod, out io.Writer) podPhaseResponse {
 	pod, err := c.Pods(pod.Namespace).Get(pod.Name)
 	if err != nil {
-		return podPhaseResponse{true, api.PodUnknown, err}
+		return podPhaseResponse{true, api.PodUnknown, err, false}
 	}
 
 	ready, err := isRunning(pod)
 
 	if err != nil {
-		return podPhaseResponse{true, pod.Status.Phase, err}
+		return podPhaseResponse{true, pod.Status.Phase, err, true}
 	}
 
 	if ready {
-		return podPhaseResponse{true, pod.Status.Phase, nil}
+		return podPhaseResponse{true, pod.Status.Phase, nil, true}
 	}
 
 	// check status of containers
-	for _, container := range pod.Status.ContainerStatuses {
+	statuses := append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...)
+	for _, container := range statuses {
 		if container.Ready {
 			continue
 		}
@@ -125,12 +176,12 @@ func getPodPhase(c *client.Client, pod *api.Pod, out io.Writer) podPhaseResponse
 		case "ErrImagePull", "ImagePullBackOff":
 			err = fmt.Errorf("image pull failed: %s", container.State.Waiting.Message)
 			err = &common.BuildError{Inner: err}
-			return podPhaseResponse{true, api.PodUnknown, err}
+			return podPhaseResponse{true, api.PodUnknown, err, true}
 		}
 	}
 
 	fmt.Fprintf(out, "Waiting for pod %s/%s to be running, status is %s\n", pod.Namespace, pod.Name, pod.Status.Phase)
-	return podPhaseResponse{false, pod.Status.Phase, nil}
+	return podPhaseResponse{false, pod.Status.Phase, nil, isScheduled(pod)}
 
 }
 
@@ -150,14 +201,20 @@ func triggerPodPhaseCheck(c *client.Client, pod *api.Pod, out io.Writer) <-chan
 // It returns error if the call to retrieve pod details fails or the timeout is
 // reached.
 // The timeout and polling values are configurable through KubernetesConfig
-// parameters.
+// parameters. When the scheduling timeout is set, it returns error if the
+// pod isn't assigned to a node within that time.
 func waitForPodRunning(ctx context.Context, c *client.Client, pod *api.Pod, out io.Writer, config *common.KubernetesConfig) (api.PodPhase, error) {
 	pollInterval := config.GetPollInterval()
 	pollAttempts := config.GetPollAttempts()
+	schedulingTimeout := time.Duration(config.SchedulingTimeout) * time.Second
+	started := time.Now()
 	for i := 0; i <= pollAttempts; i++ {
 		select {
 		case r := <-triggerPodPhaseCheck(c, pod, out):
 			if !r.done {
+				if schedulingTimeout > 0 && !r.scheduled && time.Since(started) >= schedulingTimeout {
+					return r.phase, fmt.Errorf("pod could not be scheduled within %ds", config.SchedulingTimeout)
+				}
 				time.Sleep(time.Duration(pollInterval) * time.Second)
 				continue
 			}
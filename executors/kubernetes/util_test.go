@@ -2,11 +2,15 @@ package kubernetes
 
 import (
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"os"
 	"reflect"
 	"strings"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"golang.org/x/net/context"
 	"k8s.io/kubernetes/pkg/api"
 	"k8s.io/kubernetes/pkg/api/testapi"
@@ -69,6 +73,57 @@ func TestGetKubeClientConfig(t *testing.T) {
 	}
 }
 
+func TestGetKubeClientConfigContext(t *testing.T) {
+	kubeConfig, err := ioutil.TempFile("", "kubeconfig")
+	require.NoError(t, err)
+	defer os.Remove(kubeConfig.Name())
+
+	_, err = kubeConfig.WriteString(`
+apiVersion: v1
+kind: Config
+current-context: staging
+clusters:
+- name: staging
+  cluster:
+    server: https://staging.example.com
+- name: production
+  cluster:
+    server: https://production.example.com
+contexts:
+- name: staging
+  context:
+    cluster: staging
+    user: ci
+- name: production
+  context:
+    cluster: production
+    user: ci
+users:
+- name: ci
+  user:
+    token: kubeconfig-token
+`)
+	require.NoError(t, err)
+	kubeConfig.Close()
+
+	config := &common.KubernetesConfig{KubeConfig: kubeConfig.Name()}
+	restConfig, err := getKubeClientConfig(config)
+	require.NoError(t, err)
+	assert.Equal(t, "https://staging.example.com", restConfig.Host)
+	assert.Equal(t, "kubeconfig-token", restConfig.BearerToken)
+
+	config.Context = "production"
+	config.BearerToken = "runner-token"
+	restConfig, err = getKubeClientConfig(config)
+	require.NoError(t, err)
+	assert.Equal(t, "https://production.example.com", restConfig.Host)
+	assert.Equal(t, "runner-token", restConfig.BearerToken)
+
+	config.Context = "unknown"
+	_, err = getKubeClientConfig(config)
+	assert.EqualError(t, err, `context "unknown" not found in kubeconfig`)
+}
+
 func TestWaitForPodRunning(t *testing.T) {
 	version := testapi.Default.GroupVersion().Version
 	codec := testapi.Default.Codec()
@@ -224,6 +279,49 @@ func TestWaitForPodRunning(t *testing.T) {
 			Error:        true,
 			ExactRetries: true,
 		},
+		{
+			Name: "ensure function returns error if pod isn't scheduled in time",
+			Pod: &api.Pod{
+				ObjectMeta: api.ObjectMeta{
+					Name:      "test-pod",
+					Namespace: "test-ns",
+				},
+			},
+			Config: &common.KubernetesConfig{
+				PollInterval:      1,
+				PollTimeout:       10,
+				SchedulingTimeout: 1,
+			},
+			ClientFunc: func(req *http.Request) (*http.Response, error) {
+				switch p, m := req.URL.Path, req.Method; {
+				case p == "/api/"+version+"/namespaces/test-ns/pods/test-pod" && m == "GET":
+					pod := &api.Pod{
+						ObjectMeta: api.ObjectMeta{
+							Name:      "test-pod",
+							Namespace: "test-ns",
+						},
+						Status: api.PodStatus{
+							Phase: api.PodPending,
+							Conditions: []api.PodCondition{
+								{Type: api.PodScheduled, Status: api.ConditionFalse, Reason: "Unschedulable"},
+							},
+						},
+					}
+					if retries > 2 {
+						t.Errorf("Too many retries for the given scheduling timeout. (Expected 2)")
+					}
+					retries++
+					return &http.Response{StatusCode: 200, Body: objBody(codec, pod), Header: map[string][]string{
+						"Content-Type": []string{"application/json"},
+					}}, nil
+				default:
+					t.Errorf("unexpected request: %s %#v\n%#v", req.Method, req.URL, req)
+					return nil, fmt.Errorf("unexpected request")
+				}
+			},
+			PodEndPhase: api.PodPending,
+			Error:       true,
+		},
 	}
 
 	for _, test := range tests {
@@ -272,3 +370,14 @@ type testWriter struct {
 func (t testWriter) Write(b []byte) (int, error) {
 	return t.call(b)
 }
+
+func TestIsScheduled(t *testing.T) {
+	assert.False(t, isScheduled(&api.Pod{}))
+	assert.True(t, isScheduled(&api.Pod{Spec: api.PodSpec{NodeName: "node-1"}}))
+	assert.False(t, isScheduled(&api.Pod{Status: api.PodStatus{
+		Conditions: []api.PodCondition{{Type: api.PodScheduled, Status: api.ConditionFalse}},
+	}}))
+	assert.True(t, isScheduled(&api.Pod{Status: api.PodStatus{
+		Conditions: []api.PodCondition{{Type: api.PodScheduled, Status: api.ConditionTrue}},
+	}}))
+}
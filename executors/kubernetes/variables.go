@@ -0,0 +1,77 @@
+package kubernetes
+
+import (
+	"k8s.io/kubernetes/pkg/api"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+// setupVariables creates a temporary secret holding the masked variables of
+// the job, so they are neither in the scripts nor in the spec of the pod
+func (s *executor) setupVariables() error {
+	if s.variables != nil {
+		return nil
+	}
+
+	masked := s.Build.GetAllVariables().Masked()
+	if len(masked) == 0 {
+		return nil
+	}
+
+	data := make(map[string][]byte)
+	for _, variable := range masked {
+		data[variable.Key] = []byte(variable.Value)
+	}
+
+	secret, err := s.kubeClient.Secrets(s.Config.Kubernetes.Namespace).Create(&api.Secret{
+		ObjectMeta: api.ObjectMeta{
+			GenerateName: s.Build.ProjectUniqueName() + "-",
+			Namespace:    s.Config.Kubernetes.Namespace,
+			Labels:       getObjectLabels(s.Build),
+		},
+		Type: api.SecretTypeOpaque,
+		Data: data,
+	})
+	if err != nil {
+		return err
+	}
+
+	s.variables = secret
+	active.Add("secret", secret.Namespace, secret.Name)
+
+	return nil
+}
+
+// maskedVariables returns the environment variables of the containers
+// running the scripts, read from the secret of the masked variables
+func maskedVariables(secret *api.Secret, variables common.BuildVariables) []api.EnvVar {
+	if secret == nil {
+		return nil
+	}
+
+	var e []api.EnvVar
+	for _, variable := range variables.Masked() {
+		e = append(e, api.EnvVar{
+			Name: variable.Key,
+			ValueFrom: &api.EnvVarSource{
+				SecretKeyRef: &api.SecretKeySelector{
+					LocalObjectReference: api.LocalObjectReference{Name: secret.Name},
+					Key:                  variable.Key,
+				},
+			},
+		})
+	}
+	return e
+}
+
+func (s *executor) cleanupVariables() {
+	if s.variables == nil {
+		return
+	}
+
+	err := s.kubeClient.Secrets(s.variables.Namespace).Delete(s.variables.Name)
+	if err != nil {
+		s.Errorln("Error cleaning up secret:", err.Error())
+	}
+	active.Remove("secret", s.variables.Namespace, s.variables.Name)
+}
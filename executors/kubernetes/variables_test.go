@@ -0,0 +1,32 @@
+package kubernetes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/kubernetes/pkg/api"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+func TestMaskedVariables(t *testing.T) {
+	variables := common.BuildVariables{
+		{Key: "PUBLIC", Value: "value", Public: true},
+		{Key: "TOKEN", Value: "secret", Masked: true},
+	}
+
+	assert.Empty(t, maskedVariables(nil, variables))
+
+	secret := &api.Secret{ObjectMeta: api.ObjectMeta{Name: "variables"}}
+	assert.Equal(t, []api.EnvVar{
+		{
+			Name: "TOKEN",
+			ValueFrom: &api.EnvVarSource{
+				SecretKeyRef: &api.SecretKeySelector{
+					LocalObjectReference: api.LocalObjectReference{Name: "variables"},
+					Key:                  "TOKEN",
+				},
+			},
+		},
+	}, maskedVariables(secret, variables))
+}
@@ -0,0 +1,299 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/resource"
+)
+
+func (s *executor) getVolumeMounts() (mounts []api.VolumeMount) {
+	path := strings.Split(s.Build.BuildDir, "/")
+	path = path[:len(path)-1]
+
+	mounts = append(mounts, api.VolumeMount{
+		Name:      "repo",
+		MountPath: strings.Join(path, "/"),
+	})
+
+	if s.Config.Kubernetes == nil {
+		return
+	}
+
+	volumes := s.Config.Kubernetes.Volumes
+	for _, mount := range volumes.HostPaths {
+		mounts = append(mounts, api.VolumeMount{
+			Name:      mount.Name,
+			MountPath: mount.MountPath,
+			SubPath:   mount.SubPath,
+			ReadOnly:  mount.ReadOnly,
+		})
+	}
+
+	for _, mount := range volumes.PVCs {
+		mounts = append(mounts, api.VolumeMount{
+			Name:      mount.Name,
+			MountPath: mount.MountPath,
+			SubPath:   mount.SubPath,
+			ReadOnly:  mount.ReadOnly,
+		})
+	}
+
+	for _, mount := range volumes.ConfigMaps {
+		mounts = append(mounts, api.VolumeMount{
+			Name:      mount.Name,
+			MountPath: mount.MountPath,
+			SubPath:   mount.SubPath,
+			ReadOnly:  mount.ReadOnly,
+		})
+	}
+
+	for _, mount := range volumes.Secrets {
+		mounts = append(mounts, api.VolumeMount{
+			Name:      mount.Name,
+			MountPath: mount.MountPath,
+			SubPath:   mount.SubPath,
+			ReadOnly:  mount.ReadOnly,
+		})
+	}
+
+	for _, mount := range volumes.EmptyDirs {
+		mounts = append(mounts, api.VolumeMount{
+			Name:      mount.Name,
+			MountPath: mount.MountPath,
+			SubPath:   mount.SubPath,
+		})
+	}
+
+	for _, mount := range volumes.CSIs {
+		mounts = append(mounts, api.VolumeMount{
+			Name:      mount.Name,
+			MountPath: mount.MountPath,
+			SubPath:   mount.SubPath,
+			ReadOnly:  mount.ReadOnly,
+		})
+	}
+
+	return
+}
+
+func keyToPaths(items map[string]string) (paths []api.KeyToPath) {
+	for key, path := range items {
+		paths = append(paths, api.KeyToPath{Key: key, Path: path})
+	}
+	sort.Sort(keyToPathsByKey(paths))
+	return
+}
+
+type keyToPathsByKey []api.KeyToPath
+
+func (p keyToPathsByKey) Len() int           { return len(p) }
+func (p keyToPathsByKey) Less(i, j int) bool { return p[i].Key < p[j].Key }
+func (p keyToPathsByKey) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+// getVolumes returns volumes of the build pod. CSI volumes aren't known to
+// this version of the kubernetes client and are added by getVolumesPatch.
+func (s *executor) getVolumes() (volumes []api.Volume) {
+	volumes = append(volumes, api.Volume{
+		Name: "repo",
+		VolumeSource: api.VolumeSource{
+			EmptyDir: &api.EmptyDirVolumeSource{},
+		},
+	})
+
+	config := s.Config.Kubernetes.Volumes
+	for _, volume := range config.HostPaths {
+		path := volume.HostPath
+		if path == "" {
+			path = volume.MountPath
+		}
+
+		volumes = append(volumes, api.Volume{
+			Name: volume.Name,
+			VolumeSource: api.VolumeSource{
+				HostPath: &api.HostPathVolumeSource{
+					Path: path,
+				},
+			},
+		})
+	}
+
+	for _, volume := range config.PVCs {
+		volumes = append(volumes, api.Volume{
+			Name: volume.Name,
+			VolumeSource: api.VolumeSource{
+				PersistentVolumeClaim: &api.PersistentVolumeClaimVolumeSource{
+					ClaimName: volume.Name,
+					ReadOnly:  volume.ReadOnly,
+				},
+			},
+		})
+	}
+
+	for _, volume := range config.ConfigMaps {
+		volumes = append(volumes, api.Volume{
+			Name: volume.Name,
+			VolumeSource: api.VolumeSource{
+				ConfigMap: &api.ConfigMapVolumeSource{
+					LocalObjectReference: api.LocalObjectReference{
+						Name: volume.Name,
+					},
+					Items: keyToPaths(volume.Items),
+				},
+			},
+		})
+	}
+
+	for _, volume := range config.Secrets {
+		volumes = append(volumes, api.Volume{
+			Name: volume.Name,
+			VolumeSource: api.VolumeSource{
+				Secret: &api.SecretVolumeSource{
+					SecretName: volume.Name,
+					Items:      keyToPaths(volume.Items),
+				},
+			},
+		})
+	}
+
+	for _, volume := range config.EmptyDirs {
+		volumes = append(volumes, api.Volume{
+			Name: volume.Name,
+			VolumeSource: api.VolumeSource{
+				EmptyDir: &api.EmptyDirVolumeSource{
+					Medium: api.StorageMedium(volume.Medium),
+				},
+			},
+		})
+	}
+
+	return
+}
+
+type csiVolumeSource struct {
+	Driver           string            `json:"driver"`
+	FSType           string            `json:"fsType,omitempty"`
+	ReadOnly         bool              `json:"readOnly,omitempty"`
+	VolumeAttributes map[string]string `json:"volumeAttributes,omitempty"`
+}
+
+type emptyDirVolumeSource struct {
+	SizeLimit string `json:"sizeLimit"`
+}
+
+type volumeClaimSpec struct {
+	AccessModes      []string `json:"accessModes"`
+	StorageClassName string   `json:"storageClassName,omitempty"`
+	Resources        struct {
+		Requests map[string]string `json:"requests"`
+	} `json:"resources"`
+}
+
+type ephemeralVolumeSource struct {
+	VolumeClaimTemplate struct {
+		Metadata struct {
+			Labels map[string]string `json:"labels,omitempty"`
+		} `json:"metadata"`
+		Spec volumeClaimSpec `json:"spec"`
+	} `json:"volumeClaimTemplate"`
+}
+
+// buildsDirVolumePatch replaces the empty dir of the repo volume with
+// a generic ephemeral volume
+type buildsDirVolumePatch struct {
+	Name      string                 `json:"name"`
+	EmptyDir  *emptyDirVolumeSource  `json:"emptyDir"`
+	Ephemeral *ephemeralVolumeSource `json:"ephemeral"`
+}
+
+// getBuildsDirVolumePatch returns the patch of the volume holding the builds
+// directory, or nil when it's an empty dir on the node
+func (s *executor) getBuildsDirVolumePatch() (*buildsDirVolumePatch, error) {
+	config := s.Config.Kubernetes.BuildsDirVolume
+	if config == nil {
+		return nil, nil
+	}
+
+	if _, err := resource.ParseQuantity(config.Size); err != nil {
+		return nil, fmt.Errorf("invalid size of builds_dir_volume: %v", err)
+	}
+
+	accessMode := config.AccessMode
+	if accessMode == "" {
+		accessMode = string(api.ReadWriteOnce)
+	}
+
+	source := &ephemeralVolumeSource{}
+	source.VolumeClaimTemplate.Metadata.Labels = getObjectLabels(s.Build)
+	source.VolumeClaimTemplate.Spec.AccessModes = []string{accessMode}
+	source.VolumeClaimTemplate.Spec.StorageClassName = config.StorageClass
+	source.VolumeClaimTemplate.Spec.Resources.Requests = map[string]string{
+		string(api.ResourceStorage): config.Size,
+	}
+
+	return &buildsDirVolumePatch{Name: "repo", Ephemeral: source}, nil
+}
+
+type volumePatch struct {
+	Name     string                `json:"name"`
+	CSI      *csiVolumeSource      `json:"csi,omitempty"`
+	EmptyDir *emptyDirVolumeSource `json:"emptyDir,omitempty"`
+}
+
+// getVolumesPatch returns a strategic merge patch of the pod spec adding
+// the volume settings that can't be expressed with api.Volume, or nil
+// when there are none
+func (s *executor) getVolumesPatch() ([]byte, error) {
+	var volumes []interface{}
+
+	buildsDirVolume, err := s.getBuildsDirVolumePatch()
+	if err != nil {
+		return nil, err
+	}
+	if buildsDirVolume != nil {
+		volumes = append(volumes, buildsDirVolume)
+	}
+
+	config := s.Config.Kubernetes.Volumes
+	for _, volume := range config.EmptyDirs {
+		if volume.SizeLimit == "" {
+			continue
+		}
+
+		if _, err := resource.ParseQuantity(volume.SizeLimit); err != nil {
+			return nil, fmt.Errorf("invalid size_limit of empty_dir volume %q: %v", volume.Name, err)
+		}
+
+		volumes = append(volumes, volumePatch{
+			Name:     volume.Name,
+			EmptyDir: &emptyDirVolumeSource{SizeLimit: volume.SizeLimit},
+		})
+	}
+
+	for _, volume := range config.CSIs {
+		if volume.Driver == "" {
+			return nil, fmt.Errorf("driver of csi volume %q is not set", volume.Name)
+		}
+
+		volumes = append(volumes, volumePatch{
+			Name: volume.Name,
+			CSI: &csiVolumeSource{
+				Driver:           volume.Driver,
+				FSType:           volume.FSType,
+				ReadOnly:         volume.ReadOnly,
+				VolumeAttributes: volume.VolumeAttributes,
+			},
+		})
+	}
+
+	if len(volumes) == 0 {
+		return nil, nil
+	}
+
+	return json.Marshal(map[string][]interface{}{
+		"volumes": volumes,
+	})
+}
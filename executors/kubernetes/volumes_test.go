@@ -0,0 +1,179 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/kubernetes/pkg/api"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/patch"
+)
+
+func newVolumesTestExecutor(volumes common.KubernetesVolumes) *executor {
+	return &executor{
+		AbstractExecutor: executors.AbstractExecutor{
+			Config: common.RunnerConfig{
+				RunnerSettings: common.RunnerSettings{
+					Kubernetes: &common.KubernetesConfig{
+						Volumes: volumes,
+					},
+				},
+			},
+			Build: &common.Build{
+				BuildDir: "/builds/group/project",
+				Runner:   &common.RunnerConfig{},
+			},
+		},
+	}
+}
+
+var testVolumes = common.KubernetesVolumes{
+	HostPaths: []common.KubernetesHostPath{
+		{Name: "docker", MountPath: "/var/run/docker.sock", HostPath: "/var/run/docker.sock", ReadOnly: true},
+		{Name: "cache", MountPath: "/cache"},
+	},
+	PVCs: []common.KubernetesPVC{
+		{Name: "shared", MountPath: "/shared", SubPath: "jobs"},
+	},
+	ConfigMaps: []common.KubernetesConfigMap{
+		{Name: "settings", MountPath: "/etc/settings", Items: map[string]string{"b": "b.conf", "a": "a.conf"}},
+	},
+	Secrets: []common.KubernetesSecret{
+		{Name: "tls", MountPath: "/etc/tls", ReadOnly: true},
+	},
+	EmptyDirs: []common.KubernetesEmptyDir{
+		{Name: "scratch", MountPath: "/scratch", Medium: "Memory", SizeLimit: "1Gi"},
+	},
+	CSIs: []common.KubernetesCSI{
+		{Name: "store", MountPath: "/store", Driver: "csi.example.com", VolumeAttributes: map[string]string{"bucket": "ci"}},
+	},
+}
+
+func TestGetVolumeMounts(t *testing.T) {
+	s := newVolumesTestExecutor(testVolumes)
+
+	assert.Equal(t, []api.VolumeMount{
+		{Name: "repo", MountPath: "/builds/group"},
+		{Name: "docker", MountPath: "/var/run/docker.sock", ReadOnly: true},
+		{Name: "cache", MountPath: "/cache"},
+		{Name: "shared", MountPath: "/shared", SubPath: "jobs"},
+		{Name: "settings", MountPath: "/etc/settings"},
+		{Name: "tls", MountPath: "/etc/tls", ReadOnly: true},
+		{Name: "scratch", MountPath: "/scratch"},
+		{Name: "store", MountPath: "/store"},
+	}, s.getVolumeMounts())
+}
+
+func TestGetVolumes(t *testing.T) {
+	s := newVolumesTestExecutor(testVolumes)
+
+	volumes := s.getVolumes()
+	require.Equal(t, 7, len(volumes))
+
+	assert.Equal(t, "repo", volumes[0].Name)
+	assert.NotNil(t, volumes[0].EmptyDir)
+	assert.Equal(t, &api.HostPathVolumeSource{Path: "/var/run/docker.sock"}, volumes[1].HostPath)
+	assert.Equal(t, &api.HostPathVolumeSource{Path: "/cache"}, volumes[2].HostPath)
+	assert.Equal(t, &api.PersistentVolumeClaimVolumeSource{ClaimName: "shared"}, volumes[3].PersistentVolumeClaim)
+	assert.Equal(t, &api.ConfigMapVolumeSource{
+		LocalObjectReference: api.LocalObjectReference{Name: "settings"},
+		Items: []api.KeyToPath{
+			{Key: "a", Path: "a.conf"},
+			{Key: "b", Path: "b.conf"},
+		},
+	}, volumes[4].ConfigMap)
+	assert.Equal(t, &api.SecretVolumeSource{SecretName: "tls"}, volumes[5].Secret)
+	assert.Equal(t, &api.EmptyDirVolumeSource{Medium: api.StorageMediumMemory}, volumes[6].EmptyDir)
+}
+
+func TestGetVolumesPatch(t *testing.T) {
+	s := newVolumesTestExecutor(common.KubernetesVolumes{})
+	data, err := s.getVolumesPatch()
+	assert.NoError(t, err)
+	assert.Nil(t, data)
+
+	s = newVolumesTestExecutor(testVolumes)
+	data, err = s.getVolumesPatch()
+	require.NoError(t, err)
+
+	var result map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &result))
+	assert.Equal(t, map[string]interface{}{
+		"volumes": []interface{}{
+			map[string]interface{}{
+				"name":     "scratch",
+				"emptyDir": map[string]interface{}{"sizeLimit": "1Gi"},
+			},
+			map[string]interface{}{
+				"name": "store",
+				"csi": map[string]interface{}{
+					"driver":           "csi.example.com",
+					"volumeAttributes": map[string]interface{}{"bucket": "ci"},
+				},
+			},
+		},
+	}, result)
+
+	s = newVolumesTestExecutor(common.KubernetesVolumes{
+		EmptyDirs: []common.KubernetesEmptyDir{{Name: "scratch", SizeLimit: "a lot"}},
+	})
+	_, err = s.getVolumesPatch()
+	assert.Error(t, err)
+
+	s = newVolumesTestExecutor(common.KubernetesVolumes{
+		CSIs: []common.KubernetesCSI{{Name: "store"}},
+	})
+	_, err = s.getVolumesPatch()
+	assert.EqualError(t, err, `driver of csi volume "store" is not set`)
+}
+
+func TestGetVolumesPatchBuildsDirVolume(t *testing.T) {
+	s := newVolumesTestExecutor(common.KubernetesVolumes{})
+	s.Build.ID = 10
+	s.Config.Kubernetes.BuildsDirVolume = &common.KubernetesBuildsDirVolume{
+		StorageClass: "fast-ssd",
+		Size:         "50Gi",
+	}
+
+	data, err := s.getVolumesPatch()
+	require.NoError(t, err)
+
+	spec, err := patch.Apply(patch.Strategic, []byte(`{"volumes":[{"name":"repo","emptyDir":{}}]}`), data)
+	require.NoError(t, err)
+
+	var result map[string]interface{}
+	require.NoError(t, json.Unmarshal(spec, &result))
+	assert.Equal(t, map[string]interface{}{
+		"volumes": []interface{}{
+			map[string]interface{}{
+				"name": "repo",
+				"ephemeral": map[string]interface{}{
+					"volumeClaimTemplate": map[string]interface{}{
+						"metadata": map[string]interface{}{
+							"labels": map[string]interface{}{
+								"gitlab-runner":         "",
+								"gitlab-runner-build":   "10",
+								"gitlab-runner-manager": "",
+							},
+						},
+						"spec": map[string]interface{}{
+							"accessModes":      []interface{}{"ReadWriteOnce"},
+							"storageClassName": "fast-ssd",
+							"resources": map[string]interface{}{
+								"requests": map[string]interface{}{"storage": "50Gi"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}, result)
+
+	s.Config.Kubernetes.BuildsDirVolume.Size = ""
+	_, err = s.getVolumesPatch()
+	assert.Error(t, err)
+}
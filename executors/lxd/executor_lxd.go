@@ -0,0 +1,216 @@
+package lxd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"time"
+
+	"github.com/kardianos/osext"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/lxd"
+)
+
+const (
+	helperBinaryPath = "/usr/local/bin/gitlab-runner"
+	networkTimeout   = 60
+)
+
+type executor struct {
+	executors.AbstractExecutor
+	containerName string
+	launched      bool
+}
+
+func getContainerName(build *common.Build) string {
+	return fmt.Sprintf("runner-%s-project-%d-concurrent-%d",
+		build.Runner.ShortDescription(),
+		build.ProjectID,
+		build.RunnerID)
+}
+
+func (s *executor) getLaunchOptions() lxd.LaunchOptions {
+	options := lxd.LaunchOptions{
+		Image:     s.Config.LXD.Image,
+		Profiles:  s.Config.LXD.Profiles,
+		Config:    make(map[string]string),
+		Ephemeral: true,
+	}
+	if s.Config.LXD.CPULimit != "" {
+		options.Config["limits.cpu"] = s.Config.LXD.CPULimit
+	}
+	if s.Config.LXD.MemoryLimit != "" {
+		options.Config["limits.memory"] = s.Config.LXD.MemoryLimit
+	}
+	return options
+}
+
+func (s *executor) getHelperBinary() (string, error) {
+	if s.Config.LXD.HelperBinary != "" {
+		return s.Config.LXD.HelperBinary, nil
+	}
+	return osext.Executable()
+}
+
+func (s *executor) launchContainer() error {
+	if lxd.Exist(s.containerName) {
+		s.Debugln("Deleting old container...")
+		err := lxd.Delete(s.containerName)
+		if err != nil {
+			return err
+		}
+	}
+
+	s.Println("Launching container", s.containerName, "from image", s.Config.LXD.Image, "...")
+	err := lxd.Launch(s.containerName, s.getLaunchOptions())
+	if err != nil {
+		return err
+	}
+	s.launched = true
+
+	s.Debugln("Waiting for container network...")
+	err = lxd.WaitForNetwork(s.containerName, networkTimeout)
+	if err != nil {
+		return err
+	}
+
+	helperBinary, err := s.getHelperBinary()
+	if err != nil {
+		return err
+	}
+
+	s.Debugln("Pushing", helperBinary, "to container...")
+	return lxd.PushFile(s.containerName, helperBinary, helperBinaryPath, 0755)
+}
+
+func (s *executor) Prepare(globalConfig *common.Config, config *common.RunnerConfig, build *common.Build) error {
+	if config.LXD == nil {
+		return errors.New("Missing LXD configuration")
+	}
+
+	if config.LXD.Image == "" {
+		return errors.New("Missing Image setting from LXD configuration")
+	}
+
+	s.containerName = getContainerName(build)
+	build.Hostname = s.containerName
+
+	err := s.AbstractExecutor.Prepare(globalConfig, config, build)
+	if err != nil {
+		return err
+	}
+
+	if s.BuildShell.PassFile {
+		return errors.New("LXD doesn't support shells that require script file")
+	}
+
+	version, err := lxd.Version()
+	if err != nil {
+		return err
+	}
+
+	s.Println("Using LXD version", version, "executor...")
+
+	return s.launchContainer()
+}
+
+func (s *executor) killAndWait(cmd *exec.Cmd, waitCh chan error) error {
+	for {
+		s.Debugln("Aborting command...")
+		helpers.KillProcessGroup(cmd)
+		select {
+		case <-time.After(time.Second):
+		case err := <-waitCh:
+			return err
+		}
+	}
+}
+
+func (s *executor) Run(cmd common.ExecutorCommand) error {
+	c := lxd.Command(s.containerName, s.BuildShell.GetCommandWithArguments()...)
+
+	helpers.SetProcessGroup(c)
+	defer helpers.KillProcessGroup(c)
+
+	// the environment is exported by the script read from the standard input,
+	// as the arguments of the command are visible to all users of the host
+	var script bytes.Buffer
+	for _, keyValue := range s.BuildShell.Environment {
+		script.WriteString("export " + helpers.ShellEscape(keyValue) + "\n")
+	}
+	script.WriteString(cmd.Script)
+
+	c.Stdin = &script
+	c.Stdout = s.BuildTrace
+	c.Stderr = s.BuildTrace
+
+	err := c.Start()
+	if err != nil {
+		return fmt.Errorf("Failed to start process: %s", err)
+	}
+
+	waitCh := make(chan error)
+	go func() {
+		err := c.Wait()
+		if _, ok := err.(*exec.ExitError); ok {
+			err = &common.BuildError{Inner: err}
+		}
+		waitCh <- err
+	}()
+
+	select {
+	case err = <-waitCh:
+		return err
+
+	case <-cmd.Abort:
+		return s.killAndWait(c, waitCh)
+	}
+}
+
+func (s *executor) Cleanup() {
+	if s.launched {
+		err := lxd.Delete(s.containerName)
+		if err != nil {
+			s.Warningln("Failed to delete container", s.containerName+":", err)
+		}
+	}
+
+	s.AbstractExecutor.Cleanup()
+}
+
+func init() {
+	options := executors.ExecutorOptions{
+		DefaultBuildsDir: "/builds",
+		DefaultCacheDir:  "/cache",
+		SharedBuildsDir:  false,
+		Shell: common.ShellScriptInfo{
+			Shell:                        "bash",
+			Type:                         common.LoginShell,
+			RunnerCommand:                helperBinaryPath,
+			MaskedVariablesInEnvironment: true,
+		},
+		ShowHostname: true,
+	}
+
+	creator := func() common.Executor {
+		return &executor{
+			AbstractExecutor: executors.AbstractExecutor{
+				ExecutorOptions: options,
+			},
+		}
+	}
+
+	featuresUpdater := func(features *common.FeaturesInfo) {
+		features.Variables = true
+	}
+
+	common.RegisterExecutor("lxd", executors.DefaultExecutorProvider{
+		Creator:         creator,
+		FeaturesUpdater: featuresUpdater,
+		DefaultShell:    options.Shell.Shell,
+	})
+}
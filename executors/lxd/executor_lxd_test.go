@@ -0,0 +1,84 @@
+package lxd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/lxd"
+)
+
+func newTestExecutor(config *common.LXDConfig) *executor {
+	runner := &common.RunnerConfig{
+		RunnerCredentials: common.RunnerCredentials{Token: "abcdef1234567890"},
+		RunnerSettings:    common.RunnerSettings{LXD: config},
+	}
+	build := &common.Build{
+		GetBuildResponse: common.GetBuildResponse{ID: 10, ProjectID: 20},
+		Runner:           runner,
+		RunnerID:         3,
+	}
+
+	return &executor{
+		AbstractExecutor: executors.AbstractExecutor{
+			Config: *runner,
+			Build:  build,
+		},
+	}
+}
+
+func TestLXDExecutorRegistered(t *testing.T) {
+	executors := common.GetExecutors()
+	assert.Contains(t, executors, "lxd")
+}
+
+func TestGetContainerName(t *testing.T) {
+	e := newTestExecutor(&common.LXDConfig{})
+	assert.Equal(t, "runner-abcdef12-project-20-concurrent-3", getContainerName(e.Build))
+}
+
+func TestGetLaunchOptions(t *testing.T) {
+	e := newTestExecutor(&common.LXDConfig{
+		Image:       "ubuntu:16.04",
+		Profiles:    []string{"default", "ci"},
+		CPULimit:    "2",
+		MemoryLimit: "2GB",
+	})
+
+	assert.Equal(t, lxd.LaunchOptions{
+		Image:    "ubuntu:16.04",
+		Profiles: []string{"default", "ci"},
+		Config: map[string]string{
+			"limits.cpu":    "2",
+			"limits.memory": "2GB",
+		},
+		Ephemeral: true,
+	}, e.getLaunchOptions())
+
+	e = newTestExecutor(&common.LXDConfig{Image: "ubuntu:16.04"})
+	assert.Empty(t, e.getLaunchOptions().Config)
+}
+
+func TestGetHelperBinary(t *testing.T) {
+	e := newTestExecutor(&common.LXDConfig{HelperBinary: "/opt/gitlab-runner-linux-amd64"})
+	helperBinary, err := e.getHelperBinary()
+	assert.NoError(t, err)
+	assert.Equal(t, "/opt/gitlab-runner-linux-amd64", helperBinary)
+
+	e = newTestExecutor(&common.LXDConfig{})
+	helperBinary, err = e.getHelperBinary()
+	assert.NoError(t, err)
+	assert.NotEmpty(t, helperBinary)
+}
+
+func TestPrepareMissingConfiguration(t *testing.T) {
+	e := newTestExecutor(nil)
+	err := e.Prepare(nil, &e.Config, e.Build)
+	assert.EqualError(t, err, "Missing LXD configuration")
+
+	e = newTestExecutor(&common.LXDConfig{})
+	err = e.Prepare(nil, &e.Config, e.Build)
+	assert.EqualError(t, err, "Missing Image setting from LXD configuration")
+}
@@ -8,6 +8,7 @@ import (
 
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors/vmpool"
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/ssh"
 
 	prl "gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/parallels"
@@ -21,6 +22,8 @@ type executor struct {
 	provisioned     bool
 	ipAddress       string
 	machineVerified bool
+	pool            *vmpool.Pool
+	poolVM          *vmpool.VM
 }
 
 func (s *executor) waitForIPAddress(vmName string, seconds int) (string, error) {
@@ -99,13 +102,15 @@ func (s *executor) restoreFromSnapshot() error {
 	return nil
 }
 
-func (s *executor) createVM() error {
-	baseImage := s.Config.Parallels.BaseName
+// createFromTemplate creates the VM from the template of the base VM,
+// creating the template when it's missing
+func createFromTemplate(config *common.ParallelsConfig, vmName string) error {
+	baseImage := config.BaseName
 	if baseImage == "" {
 		return errors.New("Missing Image setting from Parallels config")
 	}
 
-	templateName := s.Config.Parallels.TemplateName
+	templateName := config.TemplateName
 	if templateName == "" {
 		templateName = baseImage + "-template"
 	}
@@ -117,15 +122,18 @@ func (s *executor) createVM() error {
 	}
 
 	if !prl.Exist(templateName) {
-		s.Debugln("Creating template from VM", baseImage, "...")
 		err := prl.CreateTemplate(baseImage, templateName)
 		if err != nil {
 			return err
 		}
 	}
 
+	return prl.CreateOsVM(vmName, templateName)
+}
+
+func (s *executor) createVM() error {
 	s.Debugln("Creating runner from VM template...")
-	err := prl.CreateOsVM(s.vmName, templateName)
+	err := createFromTemplate(s.Config.Parallels, s.vmName)
 	if err != nil {
 		return err
 	}
@@ -182,6 +190,62 @@ func (s *executor) Prepare(globalConfig *common.Config, config *common.RunnerCon
 
 	s.Println("Using Parallels", version, "executor...")
 
+	if vm, _ := build.ExecutorData.(*vmpool.VM); vm != nil {
+		err = s.usePoolVM(vm)
+	} else {
+		err = s.prepareVM()
+	}
+	if err != nil {
+		return err
+	}
+
+	// TODO: integration tests do fail on this due
+	// Unable to open new session in this virtual machine.
+	// Make sure the latest version of Parallels Tools is installed in this virtual machine and it has finished booting
+	s.Debugln("Updating VM date...")
+	err = prl.TryExec(s.vmName, 20, "sudo", "ntpdate", "-u", "time.apple.com")
+	if err != nil {
+		return err
+	}
+
+	ipAddr, err := s.waitForIPAddress(s.vmName, 60)
+	if err != nil {
+		return err
+	}
+
+	s.Debugln("Starting SSH command...")
+	s.sshCommand = ssh.Client{
+		Config: *s.Config.SSH,
+		Stdout: s.BuildTrace,
+		Stderr: s.BuildTrace,
+	}
+	s.sshCommand.Host = ipAddr
+
+	s.Debugln("Connecting to SSH server...")
+	err = s.sshCommand.Connect()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// usePoolVM uses the VM assigned to the build from the pool, which is
+// already booted
+func (s *executor) usePoolVM(vm *vmpool.VM) error {
+	s.poolVM = vm
+	s.vmName = vm.Name
+	s.pool.Use(vm)
+
+	s.Println("Using VM", vm.Name, "from the pool...")
+	err := s.verifyMachine(s.vmName)
+	if err != nil {
+		s.pool.MarkBroken(vm)
+		return err
+	}
+	return nil
+}
+
+func (s *executor) prepareVM() error {
 	// remove invalid VM (removed?)
 	vmStatus, _ := prl.Status(s.vmName)
 	if vmStatus == prl.Invalid {
@@ -260,34 +324,6 @@ func (s *executor) Prepare(globalConfig *common.Config, config *common.RunnerCon
 	}
 
 	s.provisioned = true
-
-	// TODO: integration tests do fail on this due
-	// Unable to open new session in this virtual machine.
-	// Make sure the latest version of Parallels Tools is installed in this virtual machine and it has finished booting
-	s.Debugln("Updating VM date...")
-	err = prl.TryExec(s.vmName, 20, "sudo", "ntpdate", "-u", "time.apple.com")
-	if err != nil {
-		return err
-	}
-
-	ipAddr, err := s.waitForIPAddress(s.vmName, 60)
-	if err != nil {
-		return err
-	}
-
-	s.Debugln("Starting SSH command...")
-	s.sshCommand = ssh.Client{
-		Config: *s.Config.SSH,
-		Stdout: s.BuildTrace,
-		Stderr: s.BuildTrace,
-	}
-	s.sshCommand.Host = ipAddr
-
-	s.Debugln("Connecting to SSH server...")
-	err = s.sshCommand.Connect()
-	if err != nil {
-		return err
-	}
 	return nil
 }
 
@@ -297,6 +333,7 @@ func (s *executor) Run(cmd common.ExecutorCommand) error {
 		Command:     s.BuildShell.GetCommandWithArguments(),
 		Stdin:       cmd.Script,
 		Abort:       cmd.Abort,
+		ScriptFile:  ssh.ScriptFile(s.Build.ID),
 	})
 	if _, ok := err.(*ssh.ExitError); ok {
 		err = &common.BuildError{Inner: err}
@@ -307,7 +344,8 @@ func (s *executor) Run(cmd common.ExecutorCommand) error {
 func (s *executor) Cleanup() {
 	s.sshCommand.Cleanup()
 
-	if s.vmName != "" {
+	// the VMs of the pool are recycled when they're released
+	if s.vmName != "" && s.poolVM == nil {
 		prl.Kill(s.vmName)
 
 		if s.Config.Parallels.DisableSnapshots || !s.provisioned {
@@ -323,18 +361,22 @@ func init() {
 		DefaultBuildsDir: "builds",
 		SharedBuildsDir:  false,
 		Shell: common.ShellScriptInfo{
-			Shell:         "bash",
-			Type:          common.LoginShell,
-			RunnerCommand: "gitlab-runner",
+			Shell:                        "bash",
+			Type:                         common.LoginShell,
+			RunnerCommand:                "gitlab-runner",
+			MaskedVariablesInEnvironment: true,
 		},
 		ShowHostname: true,
 	}
 
+	pool := vmpool.New("Parallels", prlController{})
+
 	creator := func() common.Executor {
 		return &executor{
 			AbstractExecutor: executors.AbstractExecutor{
 				ExecutorOptions: options,
 			},
+			pool: pool,
 		}
 	}
 
@@ -342,8 +384,12 @@ func init() {
 		features.Variables = true
 	}
 
-	common.RegisterExecutor("parallels", executors.DefaultExecutorProvider{
-		Creator:         creator,
-		FeaturesUpdater: featuresUpdater,
+	common.RegisterExecutor("parallels", &vmpool.Provider{
+		DefaultExecutorProvider: executors.DefaultExecutorProvider{
+			Creator:         creator,
+			FeaturesUpdater: featuresUpdater,
+			DefaultShell:    options.Shell.Shell,
+		},
+		Pool: pool,
 	})
 }
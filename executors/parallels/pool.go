@@ -0,0 +1,88 @@
+package parallels
+
+import (
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors/vmpool"
+
+	prl "gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/parallels"
+)
+
+// prlController manages the VMs of the pool with prlctl
+type prlController struct{}
+
+func (prlController) Options(config *common.RunnerConfig) vmpool.Options {
+	if config.Parallels == nil {
+		return vmpool.Options{}
+	}
+
+	return vmpool.Options{
+		Size:           config.Parallels.PoolSize,
+		MaxBuilds:      config.Parallels.PoolMaxBuilds,
+		TTL:            time.Duration(config.Parallels.PoolTTL) * time.Second,
+		DisableRecycle: config.Parallels.DisableSnapshots,
+		BaseName:       config.Parallels.BaseName,
+	}
+}
+
+func (prlController) Create(config *common.RunnerConfig, name string) error {
+	err := createFromTemplate(config.Parallels, name)
+	if err != nil {
+		return err
+	}
+
+	err = prl.Start(name)
+	if err != nil {
+		return err
+	}
+
+	err = prl.TryExec(name, 120, "exit", "0")
+	if err != nil {
+		return err
+	}
+
+	if config.Parallels.DisableSnapshots {
+		return nil
+	}
+	return prl.CreateSnapshot(name, "Started")
+}
+
+func (prlController) Recycle(config *common.RunnerConfig, name string) error {
+	snapshot, err := prl.GetDefaultSnapshot(name)
+	if err != nil {
+		return err
+	}
+
+	err = prl.RevertToSnapshot(name, snapshot)
+	if err != nil {
+		return err
+	}
+
+	return prl.WaitForStatus(name, prl.Running, 60)
+}
+
+// Provision runs the provisioning script in the VM, as root
+func (prlController) Provision(config *common.RunnerConfig, name string) error {
+	if config.Parallels.PoolProvisionScript == "" {
+		return nil
+	}
+
+	_, err := prl.Exec(name, "bash", "-c", config.Parallels.PoolProvisionScript)
+	return err
+}
+
+func (prlController) IsHealthy(name string) bool {
+	status, err := prl.Status(name)
+	return err == nil && status == prl.Running
+}
+
+func (prlController) Remove(name string) {
+	if !prl.Exist(name) {
+		return
+	}
+
+	prl.Kill(name)
+	prl.Delete(name)
+	prl.Unregister(name)
+}
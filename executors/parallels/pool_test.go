@@ -0,0 +1,36 @@
+package parallels
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors/vmpool"
+)
+
+func TestPoolOptions(t *testing.T) {
+	config := &common.RunnerConfig{
+		RunnerSettings: common.RunnerSettings{
+			Parallels: &common.ParallelsConfig{
+				BaseName:         "macos",
+				DisableSnapshots: true,
+				PoolSize:         2,
+				PoolMaxBuilds:    10,
+				PoolTTL:          3600,
+			},
+		},
+	}
+
+	options := prlController{}.Options(config)
+	assert.Equal(t, vmpool.Options{
+		Size:           2,
+		MaxBuilds:      10,
+		TTL:            time.Hour,
+		DisableRecycle: true,
+		BaseName:       "macos",
+	}, options)
+
+	assert.Equal(t, vmpool.Options{}, prlController{}.Options(&common.RunnerConfig{}))
+}
@@ -0,0 +1,59 @@
+package podman
+
+import (
+	"os"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+// CleanupCommand removes the pods left behind by the runners killed while
+// running jobs. It's run by a systemd unit started before the runner.
+type CleanupCommand struct {
+	Host string `long:"host" env:"PODMAN_HOST" description:"URL of the Podman API socket (defaults to the rootless socket of the user, or /run/podman/podman.sock for root)"`
+}
+
+// removeManagedPods removes the pods labeled by the runner and returns the
+// number of the removed ones
+func removeManagedPods(c *client) (int, error) {
+	pods, err := c.ListPods(labelPrefix + ".managed=true")
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, pod := range pods {
+		err = c.RemovePod(pod.Name)
+		if err != nil && !isNotFound(err) {
+			logrus.WithError(err).Warningln("Failed to remove pod", pod.Name)
+			continue
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+func (c *CleanupCommand) Execute(context *cli.Context) {
+	host := c.Host
+	if host == "" {
+		host = getDefaultHost(os.Getuid(), os.Getenv("XDG_RUNTIME_DIR"))
+	}
+
+	client, err := newClient(host)
+	if err != nil {
+		logrus.Fatalln(err)
+	}
+	defer client.Close()
+
+	removed, err := removeManagedPods(client)
+	if err != nil {
+		logrus.Fatalln("Failed to list the pods of", host+":", err)
+	}
+	logrus.Println("Removed", removed, "pods left behind by the runner")
+}
+
+func init() {
+	common.RegisterCommand2("podman-cleanup", "remove the Podman pods left behind by the runner", &CleanupCommand{})
+}
@@ -0,0 +1,372 @@
+package podman
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// apiVersion is the version of the libpod REST API used by the client
+const apiVersion = "v4.0.0"
+
+// getDefaultHost returns the socket of the Podman API service of the user
+// running the runner. Rootless Podman listens in the runtime directory of
+// the user.
+func getDefaultHost(uid int, runtimeDir string) string {
+	if uid == 0 {
+		return "unix:///run/podman/podman.sock"
+	}
+	if runtimeDir == "" {
+		runtimeDir = fmt.Sprintf("/run/user/%d", uid)
+	}
+	return "unix://" + runtimeDir + "/podman/podman.sock"
+}
+
+type apiError struct {
+	StatusCode int
+	Message    string `json:"message"`
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("podman API error (%d): %s", e.StatusCode, e.Message)
+}
+
+func isNotFound(err error) bool {
+	apiErr, ok := err.(*apiError)
+	return ok && apiErr.StatusCode == http.StatusNotFound
+}
+
+// client talks to the libpod REST API of the Podman service. The native API
+// is used, and not the Docker compatible one, to manage pods.
+type client struct {
+	baseURL string
+	dial    func() (net.Conn, error)
+	http    *http.Client
+}
+
+func newClient(host string) (*client, error) {
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid podman host %q: %v", host, err)
+	}
+
+	var dial func() (net.Conn, error)
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		dial = func() (net.Conn, error) {
+			return net.DialTimeout("unix", socket, 30*time.Second)
+		}
+	case "tcp", "http":
+		address := u.Host
+		dial = func() (net.Conn, error) {
+			return net.DialTimeout("tcp", address, 30*time.Second)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported scheme of podman host %q", host)
+	}
+
+	return &client{
+		// the host is ignored when connecting, as the connection is made by dial
+		baseURL: "http://d/" + apiVersion + "/libpod",
+		dial:    dial,
+		http: &http.Client{
+			Transport: &http.Transport{
+				Dial: func(network, addr string) (net.Conn, error) {
+					return dial()
+				},
+			},
+		},
+	}, nil
+}
+
+func (c *client) url(path string, query url.Values) string {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
+
+func (c *client) do(method, path string, query url.Values, body, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.url(path, query), reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err = checkResponse(resp); err != nil {
+		return err
+	}
+	if result == nil {
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode < 400 {
+		return nil
+	}
+
+	apiErr := &apiError{StatusCode: resp.StatusCode}
+	data, _ := ioutil.ReadAll(resp.Body)
+	if json.Unmarshal(data, apiErr) != nil || apiErr.Message == "" {
+		apiErr.Message = strings.TrimSpace(string(data))
+	}
+	return apiErr
+}
+
+func (c *client) Close() {
+	if transport, ok := c.http.Transport.(*http.Transport); ok {
+		transport.CloseIdleConnections()
+	}
+}
+
+type info struct {
+	Host struct {
+		Arch     string `json:"arch"`
+		Security struct {
+			Rootless bool `json:"rootless"`
+		} `json:"security"`
+	} `json:"host"`
+	Version struct {
+		Version string `json:"Version"`
+	} `json:"version"`
+}
+
+func (c *client) Info() (result *info, err error) {
+	result = &info{}
+	err = c.do("GET", "/info", nil, nil, result)
+	return
+}
+
+func (c *client) ImageExists(name string) (bool, error) {
+	err := c.do("GET", "/images/"+name+"/exists", nil, nil, nil)
+	if isNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// PullImage pulls the image; the progress of the pull is streamed as JSON
+// objects, of which the last one reports the error or the pulled image
+func (c *client) PullImage(name string) error {
+	query := url.Values{"reference": {name}, "quiet": {"true"}}
+	req, err := http.NewRequest("POST", c.url("/images/pull", query), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err = checkResponse(resp); err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var report struct {
+			Error string `json:"error"`
+		}
+		if err := decoder.Decode(&report); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if report.Error != "" {
+			return errors.New(report.Error)
+		}
+	}
+}
+
+type podSpec struct {
+	Name     string            `json:"name"`
+	Hostname string            `json:"hostname,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	HostAdd  []string          `json:"hostadd,omitempty"`
+}
+
+type createResponse struct {
+	ID string `json:"Id"`
+}
+
+func (c *client) CreatePod(spec podSpec) (string, error) {
+	result := &createResponse{}
+	err := c.do("POST", "/pods/create", nil, spec, result)
+	return result.ID, err
+}
+
+type podSummary struct {
+	Name string `json:"Name"`
+}
+
+// ListPods returns the pods with the label, given as key=value
+func (c *client) ListPods(label string) (pods []podSummary, err error) {
+	filters, err := json.Marshal(map[string][]string{"label": {label}})
+	if err != nil {
+		return nil, err
+	}
+	err = c.do("GET", "/pods/json", url.Values{"filters": {string(filters)}}, nil, &pods)
+	return
+}
+
+func (c *client) RemovePod(name string) error {
+	return c.do("DELETE", "/pods/"+name, url.Values{"force": {"true"}}, nil, nil)
+}
+
+type mount struct {
+	Destination string   `json:"destination"`
+	Type        string   `json:"type"`
+	Source      string   `json:"source"`
+	Options     []string `json:"options,omitempty"`
+}
+
+type namedVolume struct {
+	Name    string   `json:"Name"`
+	Dest    string   `json:"Dest"`
+	Options []string `json:"Options,omitempty"`
+}
+
+type containerSpec struct {
+	Name       string            `json:"name"`
+	Pod        string            `json:"pod,omitempty"`
+	Image      string            `json:"image"`
+	Command    []string          `json:"command,omitempty"`
+	Env        map[string]string `json:"env,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	Stdin      bool              `json:"stdin,omitempty"`
+	Privileged bool              `json:"privileged,omitempty"`
+	CapAdd     []string          `json:"cap_add,omitempty"`
+	CapDrop    []string          `json:"cap_drop,omitempty"`
+	Mounts     []mount           `json:"mounts,omitempty"`
+	Volumes    []namedVolume     `json:"volumes,omitempty"`
+}
+
+func (c *client) CreateContainer(spec containerSpec) (string, error) {
+	result := &createResponse{}
+	err := c.do("POST", "/containers/create", nil, spec, result)
+	return result.ID, err
+}
+
+func (c *client) StartContainer(name string) error {
+	return c.do("POST", "/containers/"+name+"/start", nil, nil, nil)
+}
+
+func (c *client) KillContainer(name string) error {
+	return c.do("POST", "/containers/"+name+"/kill", nil, nil, nil)
+}
+
+// WaitContainer waits for the container to exit and returns its exit code
+func (c *client) WaitContainer(name string) (exitCode int, err error) {
+	err = c.do("POST", "/containers/"+name+"/wait", url.Values{"condition": {"exited"}}, nil, &exitCode)
+	return
+}
+
+func (c *client) RemoveVolume(name string) error {
+	return c.do("DELETE", "/volumes/"+name, url.Values{"force": {"true"}}, nil, nil)
+}
+
+type closeWriter interface {
+	CloseWrite() error
+}
+
+// AttachContainer attaches to the standard streams of the container. The
+// input is written to the standard input of the container, which is closed
+// at the end of the input. The returned channel receives the result of
+// copying the output, once the container closes its output streams.
+func (c *client) AttachContainer(name string, input io.Reader, output io.Writer) (<-chan error, io.Closer, error) {
+	conn, err := c.dial()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	query := url.Values{"stream": {"true"}, "stdin": {"true"}, "stdout": {"true"}, "stderr": {"true"}}
+	req, err := http.NewRequest("POST", c.url("/containers/"+name+"/attach", query), nil)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "tcp")
+
+	if err = req.Write(conn); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	if err = checkResponse(resp); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	go func() {
+		io.Copy(conn, input)
+		if cw, ok := conn.(closeWriter); ok {
+			cw.CloseWrite()
+		}
+	}()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- demuxOutput(reader, output)
+	}()
+	return done, conn, nil
+}
+
+// demuxOutput copies the frames of the multiplexed stdout and stderr
+// streams to the output. Each frame starts with a header of the stream type
+// and the size of the frame.
+func demuxOutput(reader io.Reader, output io.Writer) error {
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(reader, header); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		size := int64(binary.BigEndian.Uint32(header[4:]))
+		if _, err := io.CopyN(output, reader, size); err != nil {
+			return err
+		}
+	}
+}
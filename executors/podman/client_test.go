@@ -0,0 +1,156 @@
+package podman
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) (*client, func()) {
+	server := httptest.NewServer(handler)
+	c, err := newClient("tcp://" + server.Listener.Addr().String())
+	require.NoError(t, err)
+
+	return c, func() {
+		c.Close()
+		server.Close()
+	}
+}
+
+func TestGetDefaultHost(t *testing.T) {
+	assert.Equal(t, "unix:///run/podman/podman.sock", getDefaultHost(0, "/run/user/0"))
+	assert.Equal(t, "unix:///run/user/1000/podman/podman.sock", getDefaultHost(1000, ""))
+	assert.Equal(t, "unix:///tmp/runtime/podman/podman.sock", getDefaultHost(1000, "/tmp/runtime"))
+}
+
+func TestNewClientInvalidHost(t *testing.T) {
+	_, err := newClient("ssh://podman.example.com")
+	assert.Error(t, err)
+}
+
+func TestCreateContainer(t *testing.T) {
+	var spec containerSpec
+	c, done := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, "/"+apiVersion+"/libpod/containers/create", r.URL.Path)
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&spec))
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"Id":"abcdef"}`))
+	})
+	defer done()
+
+	id, err := c.CreateContainer(containerSpec{Name: "build", Pod: "job", Image: "alpine", Stdin: true})
+	require.NoError(t, err)
+	assert.Equal(t, "abcdef", id)
+	assert.Equal(t, containerSpec{Name: "build", Pod: "job", Image: "alpine", Stdin: true}, spec)
+}
+
+func TestAPIError(t *testing.T) {
+	c, done := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"cause":"no such container","message":"no container with name or ID build found","response":404}`))
+	})
+	defer done()
+
+	err := c.StartContainer("build")
+	require.Error(t, err)
+	assert.True(t, isNotFound(err))
+	assert.Contains(t, err.Error(), "no container with name or ID build found")
+
+	exists, err := c.ImageExists("alpine")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestWaitContainer(t *testing.T) {
+	c, done := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/"+apiVersion+"/libpod/containers/build/wait", r.URL.Path)
+		assert.Equal(t, "exited", r.URL.Query().Get("condition"))
+		w.Write([]byte("2"))
+	})
+	defer done()
+
+	exitCode, err := c.WaitContainer("build")
+	require.NoError(t, err)
+	assert.Equal(t, 2, exitCode)
+}
+
+func TestPullImageError(t *testing.T) {
+	c, done := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "alpine:3.5", r.URL.Query().Get("reference"))
+		w.Write([]byte(`{"stream":"Trying to pull alpine:3.5..."}` + "\n" + `{"error":"manifest unknown"}`))
+	})
+	defer done()
+
+	err := c.PullImage("alpine:3.5")
+	require.Error(t, err)
+	assert.Equal(t, "manifest unknown", err.Error())
+}
+
+func writeFrame(buf *bytes.Buffer, stream byte, data string) {
+	header := make([]byte, 8)
+	header[0] = stream
+	binary.BigEndian.PutUint32(header[4:], uint32(len(data)))
+	buf.Write(header)
+	buf.WriteString(data)
+}
+
+func TestAttachContainer(t *testing.T) {
+	c, done := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/"+apiVersion+"/libpod/containers/build/attach", r.URL.Path)
+		assert.Equal(t, "tcp", r.Header.Get("Upgrade"))
+
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		require.NoError(t, err)
+		defer conn.Close()
+
+		rw.WriteString("HTTP/1.1 101 UPGRADED\r\nContent-Type: application/vnd.docker.raw-stream\r\nConnection: Upgrade\r\nUpgrade: tcp\r\n\r\n")
+		rw.Flush()
+
+		input, err := ioutil.ReadAll(rw)
+		require.NoError(t, err)
+
+		output := new(bytes.Buffer)
+		writeFrame(output, 1, "stdout: "+string(input))
+		writeFrame(output, 2, "stderr\n")
+		conn.Write(output.Bytes())
+	})
+	defer done()
+
+	output := new(bytes.Buffer)
+	attachCh, conn, err := c.AttachContainer("build", strings.NewReader("echo hello\n"), output)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	assert.NoError(t, <-attachCh)
+	assert.Equal(t, "stdout: echo hello\nstderr\n", output.String())
+}
+
+func TestRemoveManagedPods(t *testing.T) {
+	var removed []string
+	c, done := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			assert.Equal(t, "/"+apiVersion+"/libpod/pods/json", r.URL.Path)
+			assert.Equal(t, `{"label":["com.gitlab.gitlab-runner.managed=true"]}`, r.URL.Query().Get("filters"))
+			w.Write([]byte(`[{"Name":"runner-abcdef-project-1-concurrent-0"},{"Name":"runner-abcdef-project-2-concurrent-1"}]`))
+		case "DELETE":
+			removed = append(removed, strings.TrimPrefix(r.URL.Path, "/"+apiVersion+"/libpod/pods/"))
+			assert.Equal(t, "true", r.URL.Query().Get("force"))
+		}
+	})
+	defer done()
+
+	count, err := removeManagedPods(c)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	assert.Equal(t, []string{"runner-abcdef-project-1-concurrent-0", "runner-abcdef-project-2-concurrent-1"}, removed)
+}
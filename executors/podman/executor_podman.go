@@ -0,0 +1,537 @@
+package podman
+
+import (
+	"bytes"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors"
+)
+
+const labelPrefix = "com.gitlab.gitlab-runner"
+
+type podmanOptions struct {
+	Image    string   `json:"image"`
+	Services []string `json:"services"`
+}
+
+type executor struct {
+	executors.AbstractExecutor
+	client  *client
+	options podmanOptions
+
+	pod                 string
+	predefinedContainer string
+	buildContainer      string
+	mounts              []mount
+	volumes             []namedVolume
+	jobVolumes          []string
+	arch                string
+}
+
+func (s *executor) getLabels(containerType string) map[string]string {
+	return map[string]string{
+		labelPrefix + ".managed":         "true",
+		labelPrefix + ".build.id":        strconv.Itoa(s.Build.ID),
+		labelPrefix + ".build.sha":       s.Build.Sha,
+		labelPrefix + ".project.id":      strconv.Itoa(s.Build.ProjectID),
+		labelPrefix + ".runner.id":       s.Build.Runner.ShortDescription(),
+		labelPrefix + ".runner.local_id": strconv.Itoa(s.Build.RunnerID),
+		labelPrefix + ".type":            containerType,
+	}
+}
+
+func (s *executor) verifyAllowedImage(image, optionName string, allowedImages []string, internalImages []string) error {
+	if len(allowedImages) == 0 {
+		return nil
+	}
+
+	for _, allowedImage := range allowedImages {
+		if ok, _ := filepath.Match(allowedImage, image); ok {
+			return nil
+		}
+	}
+
+	for _, internalImage := range internalImages {
+		if internalImage == image {
+			return nil
+		}
+	}
+
+	s.Println()
+	s.Errorln("The", image, "is not present on list of allowed", optionName)
+	for _, allowedImage := range allowedImages {
+		s.Println("-", allowedImage)
+	}
+	s.Println()
+	return errors.New("invalid image")
+}
+
+func (s *executor) getImageName() (string, error) {
+	if s.options.Image != "" {
+		image := s.Build.GetAllVariables().ExpandValue(s.options.Image)
+		err := s.verifyAllowedImage(s.options.Image, "images", s.Config.Podman.AllowedImages, []string{s.Config.Podman.Image})
+		if err != nil {
+			return "", err
+		}
+		return image, nil
+	}
+
+	if s.Config.Podman.Image == "" {
+		return "", errors.New("No Podman image specified to run the build in")
+	}
+
+	return s.Config.Podman.Image, nil
+}
+
+func (s *executor) getServices() ([]string, error) {
+	services := s.Config.Podman.Services
+	for _, service := range s.options.Services {
+		service = s.Build.GetAllVariables().ExpandValue(service)
+		err := s.verifyAllowedImage(service, "services", s.Config.Podman.AllowedServices, s.Config.Podman.Services)
+		if err != nil {
+			return nil, err
+		}
+		services = append(services, service)
+	}
+	return services, nil
+}
+
+func (s *executor) pullImage(image string) error {
+	pullPolicy, err := s.Config.Podman.PullPolicy.Get()
+	if err != nil {
+		return err
+	}
+
+	if pullPolicy != common.PullPolicyAlways {
+		exists, err := s.client.ImageExists(image)
+		if err != nil {
+			return err
+		}
+		if exists {
+			s.Debugln("Using locally found image", image, "...")
+			return nil
+		}
+		if pullPolicy == common.PullPolicyNever {
+			return fmt.Errorf("image %s not found and the pull policy is never", image)
+		}
+	}
+
+	s.Println("Pulling image", image, "...")
+	if err := s.client.PullImage(image); err != nil {
+		return &common.BuildError{Inner: fmt.Errorf("failed to pull image %s: %v", image, err)}
+	}
+	return nil
+}
+
+func (s *executor) getAbsoluteContainerPath(dir string) string {
+	if path.IsAbs(dir) {
+		return dir
+	}
+	return path.Join(s.Build.FullProjectDir(), dir)
+}
+
+// addCacheVolume mounts a named volume of the project, which keeps its
+// content between jobs, like the cache containers of the docker executor
+func (s *executor) addCacheVolume(containerPath string) {
+	containerPath = s.getAbsoluteContainerPath(containerPath)
+
+	// disable cache for automatic volumes, but leave it for host volumes (they are shared on purpose)
+	if s.Config.Podman.DisableCache {
+		s.Debugln("Volume cache for", containerPath, "is disabled.")
+		return
+	}
+
+	name := fmt.Sprintf("%s-cache-%x", s.Build.ProjectUniqueName(), md5.Sum([]byte(containerPath)))
+	s.Debugln("Using volume", name, "as cache for", containerPath, "...")
+	s.volumes = append(s.volumes, namedVolume{Name: name, Dest: containerPath})
+}
+
+// addVolume adds a volume given as [source:]container[:mode]. The source is
+// either a host path or the name of a volume.
+func (s *executor) addVolume(volume string) error {
+	parts := strings.Split(volume, ":")
+	if len(parts) == 1 {
+		s.addCacheVolume(parts[0])
+		return nil
+	}
+	if len(parts) > 3 {
+		return fmt.Errorf("invalid volume %q", volume)
+	}
+
+	containerPath := s.getAbsoluteContainerPath(parts[1])
+	var options []string
+	if len(parts) == 3 {
+		options = strings.Split(parts[2], ",")
+	}
+
+	if !path.IsAbs(parts[0]) {
+		s.Debugln("Using volume", parts[0], "for", containerPath, "...")
+		s.volumes = append(s.volumes, namedVolume{Name: parts[0], Dest: containerPath, Options: options})
+		return nil
+	}
+
+	s.Debugln("Using host-based", parts[0], "for", containerPath, "...")
+	s.mounts = append(s.mounts, mount{
+		Destination: containerPath,
+		Type:        "bind",
+		Source:      parts[0],
+		Options:     append([]string{"rbind"}, options...),
+	})
+	return nil
+}
+
+func isHostMountedVolume(dir string, volumes ...string) bool {
+	isParentOf := func(parent string, dir string) bool {
+		for dir != "/" && dir != "." {
+			if dir == parent {
+				return true
+			}
+			dir = path.Dir(dir)
+		}
+		return false
+	}
+
+	for _, volume := range volumes {
+		hostVolume := strings.Split(volume, ":")
+		if len(hostVolume) < 2 {
+			continue
+		}
+
+		if isParentOf(path.Clean(hostVolume[1]), path.Clean(dir)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *executor) createBuildVolume() error {
+	// take path of the projects directory,
+	// because we use `rm -rf` which could remove the mounted volume
+	parentDir := path.Dir(s.Build.FullProjectDir())
+
+	if !path.IsAbs(parentDir) && parentDir != "/" {
+		return errors.New("build directory needs to be absolute and non-root path")
+	}
+
+	if isHostMountedVolume(s.Build.RootDir, s.Config.Podman.Volumes...) {
+		return nil
+	}
+
+	if s.Build.GetGitStrategy() == common.GitFetch && !s.Config.Podman.DisableCache {
+		// use persistent cache volume
+		s.addCacheVolume(parentDir)
+		return nil
+	}
+
+	// use temporary volume, removed when the job finishes
+	name := s.Build.ProjectUniqueName() + "-build-" + strconv.Itoa(s.Build.ID)
+	s.volumes = append(s.volumes, namedVolume{Name: name, Dest: parentDir})
+	s.jobVolumes = append(s.jobVolumes, name)
+	return nil
+}
+
+func (s *executor) createVolumes() error {
+	if err := s.createBuildVolume(); err != nil {
+		return err
+	}
+
+	for _, volume := range s.Config.Podman.Volumes {
+		if err := s.addVolume(volume); err != nil {
+			s.Errorln("Failed to create volume for", volume, err)
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *executor) createPod(services []string) error {
+	var hostAdd []string
+	for _, service := range services {
+		for _, alias := range common.GetServiceAliases(service) {
+			hostAdd = append(hostAdd, alias+":127.0.0.1")
+		}
+	}
+
+	name := s.Build.ProjectUniqueName()
+
+	// remove the pod left behind by a previous job, which could happen if
+	// the runner was killed
+	s.client.RemovePod(name)
+
+	s.Debugln("Creating pod", name, "...")
+	_, err := s.client.CreatePod(podSpec{
+		Name:     name,
+		Hostname: name,
+		Labels:   s.getLabels("pod"),
+		HostAdd:  hostAdd,
+	})
+	if err != nil {
+		return err
+	}
+	s.pod = name
+	return nil
+}
+
+func (s *executor) createContainer(containerType, image string, cmd []string) (string, error) {
+	env := make(map[string]string)
+	for _, variable := range append(s.Build.GetAllVariables().WithoutFiles().StringList(), s.BuildShell.Environment...) {
+		keyValue := strings.SplitN(variable, "=", 2)
+		if len(keyValue) == 2 {
+			env[keyValue[0]] = keyValue[1]
+		}
+	}
+
+	name := s.pod + "-" + containerType
+	s.Debugln("Creating container", name, "...")
+	_, err := s.client.CreateContainer(containerSpec{
+		Name:       name,
+		Pod:        s.pod,
+		Image:      image,
+		Command:    cmd,
+		Env:        env,
+		Labels:     s.getLabels(containerType),
+		Stdin:      true,
+		Privileged: s.Config.Podman.Privileged,
+		CapAdd:     s.Config.Podman.CapAdd,
+		CapDrop:    s.Config.Podman.CapDrop,
+		Mounts:     s.mounts,
+		Volumes:    s.volumes,
+	})
+	return name, err
+}
+
+func (s *executor) startServices(services []string) error {
+	for i, service := range services {
+		if err := s.pullImage(service); err != nil {
+			return err
+		}
+
+		s.Println("Starting service", service, "...")
+		name, err := s.createContainer(fmt.Sprintf("svc-%d", i), service, nil)
+		if err != nil {
+			return err
+		}
+		if err = s.client.StartContainer(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *executor) connect() error {
+	host := s.Config.Podman.Host
+	if host == "" {
+		host = getDefaultHost(os.Getuid(), os.Getenv("XDG_RUNTIME_DIR"))
+	}
+
+	client, err := newClient(host)
+	if err != nil {
+		return err
+	}
+	s.client = client
+
+	info, err := client.Info()
+	if err != nil {
+		return fmt.Errorf("failed to connect to podman at %s: %v", host, err)
+	}
+
+	mode := "rootful"
+	if info.Host.Security.Rootless {
+		mode = "rootless"
+	}
+	s.Debugln("Connected to", mode, "Podman", info.Version.Version, "on", info.Host.Arch)
+	s.arch = info.Host.Arch
+	return nil
+}
+
+func (s *executor) Prepare(globalConfig *common.Config, config *common.RunnerConfig, build *common.Build) error {
+	if config.Podman == nil {
+		return errors.New("Missing podman configuration")
+	}
+
+	rootDir := config.BuildsDir
+	if rootDir == "" {
+		rootDir = s.DefaultBuildsDir
+	}
+	if isHostMountedVolume(rootDir, config.Podman.Volumes...) {
+		s.SharedBuildsDir = true
+	}
+
+	err := s.AbstractExecutor.Prepare(globalConfig, config, build)
+	if err != nil {
+		return err
+	}
+
+	if s.BuildShell.PassFile {
+		return errors.New("Podman doesn't support shells that require script file")
+	}
+
+	if len(s.BuildShell.DockerCommand) == 0 {
+		return errors.New("Script is not compatible with Podman")
+	}
+
+	err = build.Options.Decode(&s.options)
+	if err != nil {
+		return err
+	}
+
+	imageName, err := s.getImageName()
+	if err != nil {
+		return err
+	}
+
+	services, err := s.getServices()
+	if err != nil {
+		return err
+	}
+
+	s.Println("Using Podman executor with image", imageName, "...")
+
+	if err = s.connect(); err != nil {
+		return err
+	}
+
+	helperImage := s.Config.Podman.GetHelperImage(s.arch)
+	if err = s.pullImage(helperImage); err != nil {
+		return err
+	}
+	if err = s.pullImage(imageName); err != nil {
+		return err
+	}
+
+	if err = s.createVolumes(); err != nil {
+		return err
+	}
+
+	if err = s.createPod(services); err != nil {
+		return err
+	}
+
+	if err = s.startServices(services); err != nil {
+		return err
+	}
+
+	// Start pre-build container which will git clone changes
+	s.predefinedContainer, err = s.createContainer("predefined", helperImage, []string{"gitlab-runner-build"})
+	if err != nil {
+		return err
+	}
+
+	// Start build container which will run actual build
+	s.buildContainer, err = s.createContainer("build", imageName, s.BuildShell.DockerCommand)
+	return err
+}
+
+func (s *executor) watchContainer(name, script string, abort chan interface{}) error {
+	s.Debugln("Attaching to container", name, "...")
+	attachCh, conn, err := s.client.AttachContainer(name, bytes.NewBufferString(script), s.BuildTrace)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	s.Debugln("Starting container", name, "...")
+	if err = s.client.StartContainer(name); err != nil {
+		return err
+	}
+
+	waitCh := make(chan error, 1)
+	go func() {
+		exitCode, err := s.client.WaitContainer(name)
+		if err == nil && exitCode != 0 {
+			err = &common.BuildError{Inner: fmt.Errorf("exit code %d", exitCode)}
+		}
+		waitCh <- err
+	}()
+
+	select {
+	case <-abort:
+		s.client.KillContainer(name)
+		return errors.New("Aborted")
+
+	case err = <-waitCh:
+		// wait for the remaining output of the container
+		<-attachCh
+		s.Debugln("Container", name, "finished with", err)
+		return err
+	}
+}
+
+func (s *executor) Run(cmd common.ExecutorCommand) error {
+	container := s.buildContainer
+	if cmd.Predefined {
+		container = s.predefinedContainer
+	}
+
+	s.Debugln("Executing on", container, "the", cmd.Script)
+	return s.watchContainer(container, cmd.Script, cmd.Abort)
+}
+
+func (s *executor) Cleanup() {
+	if s.client != nil {
+		if s.pod != "" {
+			err := s.client.RemovePod(s.pod)
+			s.Debugln("Removed pod", s.pod, "with", err)
+		}
+
+		var wg sync.WaitGroup
+		for _, volume := range s.jobVolumes {
+			wg.Add(1)
+			go func(volume string) {
+				err := s.client.RemoveVolume(volume)
+				s.Debugln("Removed volume", volume, "with", err)
+				wg.Done()
+			}(volume)
+		}
+		wg.Wait()
+
+		s.client.Close()
+	}
+
+	s.AbstractExecutor.Cleanup()
+}
+
+func init() {
+	options := executors.ExecutorOptions{
+		DefaultBuildsDir: "/builds",
+		DefaultCacheDir:  "/cache",
+		SharedBuildsDir:  false,
+		Shell: common.ShellScriptInfo{
+			Shell:                        "bash",
+			Type:                         common.NormalShell,
+			RunnerCommand:                "/usr/bin/gitlab-runner-helper",
+			MaskedVariablesInEnvironment: true,
+		},
+		ShowHostname:     true,
+		SupportedOptions: []string{"image", "services"},
+	}
+
+	creator := func() common.Executor {
+		return &executor{
+			AbstractExecutor: executors.AbstractExecutor{
+				ExecutorOptions: options,
+			},
+		}
+	}
+
+	featuresUpdater := func(features *common.FeaturesInfo) {
+		features.Variables = true
+		features.Image = true
+		features.Services = true
+	}
+
+	common.RegisterExecutor("podman", executors.DefaultExecutorProvider{
+		Creator:         creator,
+		FeaturesUpdater: featuresUpdater,
+		DefaultShell:    options.Shell.Shell,
+	})
+}
@@ -0,0 +1,74 @@
+package podman
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors"
+)
+
+func newTestExecutor(config *common.PodmanConfig) *executor {
+	runner := &common.RunnerConfig{
+		RunnerCredentials: common.RunnerCredentials{Token: "abcdef1234567890"},
+		RunnerSettings:    common.RunnerSettings{Podman: config},
+	}
+	build := &common.Build{
+		GetBuildResponse: common.GetBuildResponse{ID: 10, ProjectID: 20, RepoURL: "https://gitlab.example.com/group/project.git"},
+		Runner:           runner,
+	}
+	build.StartBuild("/builds", "/cache", false)
+
+	return &executor{
+		AbstractExecutor: executors.AbstractExecutor{
+			Config: *runner,
+			Build:  build,
+		},
+	}
+}
+
+func TestIsHostMountedVolume(t *testing.T) {
+	assert.True(t, isHostMountedVolume("/builds", "/srv/builds:/builds"))
+	assert.True(t, isHostMountedVolume("/builds/group", "/srv:/builds:ro"))
+	assert.False(t, isHostMountedVolume("/builds", "/builds"))
+	assert.False(t, isHostMountedVolume("/builds", "/srv/cache:/cache"))
+}
+
+func TestAddVolume(t *testing.T) {
+	e := newTestExecutor(&common.PodmanConfig{})
+
+	require.NoError(t, e.addVolume("/srv/data:/data:ro,z"))
+	require.NoError(t, e.addVolume("certs:/certs"))
+	require.NoError(t, e.addVolume("/cache"))
+	assert.Error(t, e.addVolume("/a:/b:ro:extra"))
+
+	assert.Equal(t, []mount{
+		{Destination: "/data", Type: "bind", Source: "/srv/data", Options: []string{"rbind", "ro", "z"}},
+	}, e.mounts)
+	require.Equal(t, 2, len(e.volumes))
+	assert.Equal(t, namedVolume{Name: "certs", Dest: "/certs"}, e.volumes[0])
+	assert.Equal(t, "/cache", e.volumes[1].Dest)
+	assert.Contains(t, e.volumes[1].Name, "runner-abcdef12-project-20-concurrent-0-cache-")
+}
+
+func TestAddVolumeDisableCache(t *testing.T) {
+	e := newTestExecutor(&common.PodmanConfig{DisableCache: true})
+
+	require.NoError(t, e.addVolume("/cache"))
+	assert.Empty(t, e.volumes)
+}
+
+func TestCreateBuildVolume(t *testing.T) {
+	e := newTestExecutor(&common.PodmanConfig{})
+	require.NoError(t, e.createBuildVolume())
+	assert.Equal(t, []namedVolume{
+		{Name: "runner-abcdef12-project-20-concurrent-0-build-10", Dest: "/builds/group"},
+	}, e.volumes)
+	assert.Equal(t, []string{"runner-abcdef12-project-20-concurrent-0-build-10"}, e.jobVolumes)
+
+	e = newTestExecutor(&common.PodmanConfig{Volumes: []string{"/srv/builds:/builds"}})
+	require.NoError(t, e.createBuildVolume())
+	assert.Empty(t, e.volumes)
+}
@@ -0,0 +1,66 @@
+package shell
+
+import (
+	"runtime"
+	"strings"
+)
+
+// systemEnvironment is always passed to the builds with clean_environment,
+// as the shells and most of the tools don't work without it
+var systemEnvironment = map[string][]string{
+	"windows": {
+		"ALLUSERSPROFILE", "APPDATA", "COMPUTERNAME", "ComSpec", "HOMEDRIVE", "HOMEPATH",
+		"LOCALAPPDATA", "NUMBER_OF_PROCESSORS", "OS", "PATH", "PATHEXT", "PROCESSOR_*",
+		"ProgramData", "ProgramFiles*", "PSModulePath", "PUBLIC", "SystemDrive", "SystemRoot",
+		"TEMP", "TMP", "USERDOMAIN", "USERNAME", "USERPROFILE", "windir",
+	},
+	"default": {
+		"HOME", "LANG", "LC_*", "LOGNAME", "PATH", "SHELL", "TMPDIR", "TZ", "USER",
+	},
+}
+
+func getSystemEnvironment(goos string) []string {
+	if environment, ok := systemEnvironment[goos]; ok {
+		return environment
+	}
+	return systemEnvironment["default"]
+}
+
+// matchVariableName matches the name to the pattern, which matches a prefix
+// when it ends with *; the names are case insensitive on Windows
+func matchVariableName(pattern, name string, goos string) bool {
+	if goos == "windows" {
+		pattern = strings.ToUpper(pattern)
+		name = strings.ToUpper(name)
+	}
+
+	if strings.HasSuffix(pattern, "*") {
+		return strings.HasPrefix(name, strings.TrimSuffix(pattern, "*"))
+	}
+	return pattern == name
+}
+
+// filterEnvironment returns the variables of the environment matching one
+// of the allowed names
+func filterEnvironment(environment []string, allowed []string, goos string) (filtered []string) {
+	for _, keyValue := range environment {
+		name := strings.SplitN(keyValue, "=", 2)[0]
+		for _, pattern := range allowed {
+			if matchVariableName(pattern, name, goos) {
+				filtered = append(filtered, keyValue)
+				break
+			}
+		}
+	}
+	return
+}
+
+func (s *executor) getEnvironment(environment []string) []string {
+	config := s.Config.ShellExecutor
+	if config == nil || !config.CleanEnvironment {
+		return append(environment, s.BuildShell.Environment...)
+	}
+
+	allowed := append(getSystemEnvironment(runtime.GOOS), config.AllowedEnvironment...)
+	return append(filterEnvironment(environment, allowed, runtime.GOOS), s.BuildShell.Environment...)
+}
@@ -0,0 +1,71 @@
+package shell
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors"
+)
+
+func TestMatchVariableName(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		name     string
+		goos     string
+		expected bool
+	}{
+		{"PATH", "PATH", "linux", true},
+		{"PATH", "PATHEXT", "linux", false},
+		{"LC_*", "LC_ALL", "linux", true},
+		{"LC_*", "LANG", "linux", false},
+		{"Path", "PATH", "linux", false},
+		{"Path", "PATH", "windows", true},
+		{"ProgramFiles*", "PROGRAMFILES(X86)", "windows", true},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, matchVariableName(test.pattern, test.name, test.goos),
+			"%s matching %s on %s", test.pattern, test.name, test.goos)
+	}
+}
+
+func TestFilterEnvironment(t *testing.T) {
+	environment := []string{"PATH=/usr/bin", "AWS_SECRET_ACCESS_KEY=secret", "LC_ALL=C", "GOPATH=/go"}
+
+	filtered := filterEnvironment(environment, []string{"PATH", "LC_*", "GO*"}, "linux")
+	assert.Equal(t, 3, len(filtered))
+	assert.Contains(t, filtered, "PATH=/usr/bin")
+	assert.Contains(t, filtered, "LC_ALL=C")
+	assert.Contains(t, filtered, "GOPATH=/go")
+	assert.NotContains(t, filtered, "AWS_SECRET_ACCESS_KEY=secret")
+}
+
+func newEnvironmentTestExecutor(config *common.ShellExecutorConfig) *executor {
+	e := &executor{
+		AbstractExecutor: executors.AbstractExecutor{
+			Config: common.RunnerConfig{
+				RunnerSettings: common.RunnerSettings{ShellExecutor: config},
+			},
+		},
+	}
+	e.BuildShell = &common.ShellConfiguration{Environment: []string{"CI=true"}}
+	return e
+}
+
+func TestGetEnvironment(t *testing.T) {
+	environment := []string{"HOME=/home/gitlab-runner", "VAULT_TOKEN=secret", "HTTP_PROXY=http://proxy"}
+
+	e := newEnvironmentTestExecutor(nil)
+	assert.Equal(t, 4, len(e.getEnvironment(environment)))
+
+	e = newEnvironmentTestExecutor(&common.ShellExecutorConfig{
+		CleanEnvironment:   true,
+		AllowedEnvironment: []string{"HTTP_PROXY"},
+	})
+	result := e.getEnvironment(environment)
+	assert.Contains(t, result, "HTTP_PROXY=http://proxy")
+	assert.Contains(t, result, "CI=true")
+	assert.NotContains(t, result, "VAULT_TOKEN=secret")
+}
@@ -77,7 +77,7 @@ func (s *executor) Run(cmd common.ExecutorCommand) error {
 	defer helpers.KillProcessGroup(c)
 
 	// Fill process environment variables
-	c.Env = append(os.Environ(), s.BuildShell.Environment...)
+	c.Env = s.getEnvironment(os.Environ())
 	c.Stdout = s.BuildTrace
 	c.Stderr = s.BuildTrace
 
@@ -137,9 +137,10 @@ func init() {
 		DefaultCacheDir:  "$PWD/cache",
 		SharedBuildsDir:  true,
 		Shell: common.ShellScriptInfo{
-			Shell:         common.GetDefaultShell(),
-			Type:          common.LoginShell,
-			RunnerCommand: runnerCommand,
+			Shell:                        common.GetDefaultShell(),
+			Type:                         common.LoginShell,
+			RunnerCommand:                runnerCommand,
+			MaskedVariablesInEnvironment: true,
 		},
 		ShowHostname: false,
 	}
@@ -159,5 +160,6 @@ func init() {
 	common.RegisterExecutor("shell", executors.DefaultExecutorProvider{
 		Creator:         creator,
 		FeaturesUpdater: featuresUpdater,
+		DefaultShell:    options.Shell.Shell,
 	})
 }
@@ -2,15 +2,92 @@ package ssh
 
 import (
 	"errors"
+	"fmt"
+	"path"
+	"strings"
 
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers"
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/ssh"
 )
 
+// runnerDir is where the scripts and the helper binary are uploaded to,
+// relative to the home directory of the user
+const runnerDir = ".gitlab-runner"
+
+// shellCandidates are tried in order, when the shell of the runner isn't
+// available on the host
+var shellCandidates = []string{"bash", "sh", "pwsh"}
+
 type executor struct {
 	executors.AbstractExecutor
 	sshCommand ssh.Client
+	runnerDir  string
+}
+
+func (s *executor) getScriptFile() string {
+	return path.Join(s.runnerDir, fmt.Sprintf("script-%s-%d", s.Build.Runner.ShortDescription(), s.Build.ID))
+}
+
+func (s *executor) createRunnerDir() error {
+	output, err := s.sshCommand.Output("mkdir -p " + runnerDir + " && cd " + runnerDir + " && pwd")
+	if err != nil {
+		return err
+	}
+	s.runnerDir = strings.TrimSpace(output)
+	return nil
+}
+
+func (s *executor) hasShell(shell string) bool {
+	_, err := s.sshCommand.Output(helpers.ShellEscape(shell) + " -c exit")
+	return err == nil
+}
+
+// detectShell checks that the shell of the runner is available on the host,
+// and otherwise switches to the first of the candidates which is
+func (s *executor) detectShell(hasShell func(shell string) bool) error {
+	shell := s.Shell().Shell
+	if hasShell(shell) {
+		return nil
+	}
+
+	for _, candidate := range shellCandidates {
+		if candidate == shell || common.GetShell(candidate) == nil || !hasShell(candidate) {
+			continue
+		}
+
+		info := *s.Shell()
+		info.Shell = candidate
+		shellConfiguration, err := common.GetShellConfiguration(info)
+		if err != nil {
+			return err
+		}
+		if shellConfiguration.PassFile {
+			continue
+		}
+
+		s.Warningln("The", shell, "shell is not available on the host, using", candidate, "instead")
+		s.Shell().Shell = candidate
+		shellConfiguration.Environment = s.BuildShell.Environment
+		s.BuildShell = shellConfiguration
+		return nil
+	}
+
+	return fmt.Errorf("The %s shell is not available on the host", shell)
+}
+
+func (s *executor) uploadHelperBinary() error {
+	helperBinary := path.Join(s.runnerDir, "gitlab-runner")
+
+	s.Debugln("Uploading", s.Config.SSH.HelperBinary, "to", helperBinary, "...")
+	err := s.sshCommand.UploadFile(s.Config.SSH.HelperBinary, helperBinary, 0755)
+	if err != nil {
+		return err
+	}
+
+	s.ExecutorOptions.Shell.RunnerCommand = helperBinary
+	return nil
 }
 
 func (s *executor) Prepare(globalConfig *common.Config, config *common.RunnerConfig, build *common.Build) error {
@@ -42,6 +119,21 @@ func (s *executor) Prepare(globalConfig *common.Config, config *common.RunnerCon
 	if err != nil {
 		return err
 	}
+
+	s.Debugln("Detecting the shell of the host...")
+	err = s.detectShell(s.hasShell)
+	if err != nil {
+		return err
+	}
+
+	err = s.createRunnerDir()
+	if err != nil {
+		return err
+	}
+
+	if s.Config.SSH.HelperBinary != "" {
+		return s.uploadHelperBinary()
+	}
 	return nil
 }
 
@@ -51,6 +143,7 @@ func (s *executor) Run(cmd common.ExecutorCommand) error {
 		Command:     s.BuildShell.GetCommandWithArguments(),
 		Stdin:       cmd.Script,
 		Abort:       cmd.Abort,
+		ScriptFile:  s.getScriptFile(),
 	})
 	if _, ok := err.(*ssh.ExitError); ok {
 		err = &common.BuildError{Inner: err}
@@ -68,9 +161,10 @@ func init() {
 		DefaultBuildsDir: "builds",
 		SharedBuildsDir:  true,
 		Shell: common.ShellScriptInfo{
-			Shell:         "bash",
-			Type:          common.LoginShell,
-			RunnerCommand: "gitlab-runner",
+			Shell:                        "bash",
+			Type:                         common.LoginShell,
+			RunnerCommand:                "gitlab-runner",
+			MaskedVariablesInEnvironment: true,
 		},
 		ShowHostname: true,
 	}
@@ -90,5 +184,6 @@ func init() {
 	common.RegisterExecutor("ssh", executors.DefaultExecutorProvider{
 		Creator:         creator,
 		FeaturesUpdater: featuresUpdater,
+		DefaultShell:    options.Shell.Shell,
 	})
 }
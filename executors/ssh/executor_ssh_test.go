@@ -1 +1,91 @@
-package ssh_test
+package ssh
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors"
+)
+
+func TestGetScriptFile(t *testing.T) {
+	runner := &common.RunnerConfig{
+		RunnerCredentials: common.RunnerCredentials{Token: "abcdef1234567890"},
+	}
+	e := &executor{
+		AbstractExecutor: executors.AbstractExecutor{
+			Build: &common.Build{
+				GetBuildResponse: common.GetBuildResponse{ID: 10},
+				Runner:           runner,
+			},
+		},
+		runnerDir: "/home/build/.gitlab-runner",
+	}
+
+	assert.Equal(t, "/home/build/.gitlab-runner/script-abcdef12-10", e.getScriptFile())
+}
+
+func newDetectShellExecutor(shell string) *executor {
+	build := &common.Build{
+		Runner: &common.RunnerConfig{},
+	}
+	build.Trace = &common.Trace{Writer: ioutil.Discard}
+
+	e := &executor{
+		AbstractExecutor: executors.AbstractExecutor{
+			ExecutorOptions: executors.ExecutorOptions{
+				Shell: common.ShellScriptInfo{
+					Shell: shell,
+					Type:  common.LoginShell,
+					Build: build,
+				},
+			},
+			Build:      build,
+			BuildShell: &common.ShellConfiguration{Environment: []string{"TOKEN=secret"}},
+		},
+	}
+	e.BuildLogger = common.NewBuildLogger(build.Trace, build.Log())
+	return e
+}
+
+func availableShells(shells ...string) func(string) bool {
+	return func(shell string) bool {
+		for _, available := range shells {
+			if available == shell {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func TestDetectShellConfiguredShellAvailable(t *testing.T) {
+	e := newDetectShellExecutor("bash")
+
+	err := e.detectShell(availableShells("bash", "sh"))
+	require.NoError(t, err)
+	assert.Equal(t, "bash", e.Shell().Shell)
+	assert.Empty(t, e.BuildShell.Command)
+}
+
+func TestDetectShellFallback(t *testing.T) {
+	e := newDetectShellExecutor("bash")
+
+	err := e.detectShell(availableShells("sh", "pwsh"))
+	require.NoError(t, err)
+	assert.Equal(t, "sh", e.Shell().Shell)
+	require.NotNil(t, e.BuildShell)
+	assert.Equal(t, "sh", e.BuildShell.Command)
+	assert.Equal(t, []string{"TOKEN=secret"}, e.BuildShell.Environment)
+}
+
+func TestDetectShellNoShellAvailable(t *testing.T) {
+	e := newDetectShellExecutor("zsh")
+
+	err := e.detectShell(availableShells())
+	assert.EqualError(t, err, "The zsh shell is not available on the host")
+	assert.Equal(t, "zsh", e.Shell().Shell)
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors/vmpool"
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/ssh"
 	vbox "gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/virtualbox"
 	"time"
@@ -17,6 +18,13 @@ type executor struct {
 	sshPort         string
 	provisioned     bool
 	machineVerified bool
+	pool            *vmpool.Pool
+	poolVM          *vmpool.VM
+}
+
+type logger interface {
+	Debugln(args ...interface{})
+	Warningln(args ...interface{})
 }
 
 func (s *executor) verifyMachine(vmName string, sshPort string) error {
@@ -58,14 +66,14 @@ func (s *executor) restoreFromSnapshot() error {
 	return nil
 }
 
-func (s *executor) determineBaseSnapshot(baseImage string) string {
+func determineBaseSnapshot(config *common.VirtualBoxConfig, baseImage string, log logger) string {
 	var err error
-	baseSnapshot := s.Config.VirtualBox.BaseSnapshot
+	baseSnapshot := config.BaseSnapshot
 	if baseSnapshot == "" {
 		baseSnapshot, err = vbox.GetCurrentSnapshot(baseImage)
 		if err != nil {
-			if s.Config.VirtualBox.DisableSnapshots {
-				s.Debugln("No snapshots found for base VM", baseImage)
+			if config.DisableSnapshots {
+				log.Debugln("No snapshots found for base VM", baseImage)
 				return ""
 			}
 
@@ -74,15 +82,15 @@ func (s *executor) determineBaseSnapshot(baseImage string) string {
 	}
 
 	if baseSnapshot != "" && !vbox.HasSnapshot(baseImage, baseSnapshot) {
-		if s.Config.VirtualBox.DisableSnapshots {
-			s.Warningln("Snapshot", baseSnapshot, "not found in base VM", baseImage)
+		if config.DisableSnapshots {
+			log.Warningln("Snapshot", baseSnapshot, "not found in base VM", baseImage)
 			return ""
 		}
 
-		s.Debugln("Creating snapshot", baseSnapshot, "from current base VM", baseImage, "state...")
+		log.Debugln("Creating snapshot", baseSnapshot, "from current base VM", baseImage, "state...")
 		err = vbox.CreateSnapshot(baseImage, baseSnapshot)
 		if err != nil {
-			s.Warningln("Failed to create snapshot", baseSnapshot, "from base VM", baseImage)
+			log.Warningln("Failed to create snapshot", baseSnapshot, "from base VM", baseImage)
 			return ""
 		}
 	}
@@ -103,7 +111,7 @@ func (s *executor) createVM(vmName string) (err error) {
 	}
 
 	if !vbox.Exist(vmName) {
-		baseSnapshot := s.determineBaseSnapshot(baseImage)
+		baseSnapshot := determineBaseSnapshot(s.Config.VirtualBox, baseImage, s)
 		if baseSnapshot == "" {
 			s.Debugln("Creating testing VM from VM", baseImage, "...")
 		} else {
@@ -176,6 +184,52 @@ func (s *executor) Prepare(globalConfig *common.Config, config *common.RunnerCon
 
 	s.Println("Using VirtualBox version", version, "executor...")
 
+	if vm, _ := build.ExecutorData.(*vmpool.VM); vm != nil {
+		err = s.usePoolVM(vm)
+	} else {
+		err = s.prepareVM()
+	}
+	if err != nil {
+		return err
+	}
+
+	s.Println("Starting SSH command...")
+	s.sshCommand = ssh.Client{
+		Config: *s.Config.SSH,
+		Stdout: s.BuildTrace,
+		Stderr: s.BuildTrace,
+	}
+	s.sshCommand.Port = s.sshPort
+	s.sshCommand.Host = "localhost"
+
+	s.Debugln("Connecting to SSH server...")
+	err = s.sshCommand.Connect()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// usePoolVM uses the VM assigned to the build from the pool, which is
+// already booted
+func (s *executor) usePoolVM(vm *vmpool.VM) (err error) {
+	s.poolVM = vm
+	s.vmName = vm.Name
+	s.pool.Use(vm)
+
+	s.Println("Using VM", vm.Name, "from the pool...")
+	s.sshPort, err = vbox.FindSSHPort(s.vmName)
+	if err == nil {
+		err = s.verifyMachine(s.vmName, s.sshPort)
+	}
+	if err != nil {
+		s.pool.MarkBroken(vm)
+		return err
+	}
+	return nil
+}
+
+func (s *executor) prepareVM() error {
 	if s.Config.VirtualBox.DisableSnapshots {
 		s.vmName = s.Config.VirtualBox.BaseName + "-" + s.Build.ProjectUniqueName()
 		if vbox.Exist(s.vmName) {
@@ -254,21 +308,6 @@ func (s *executor) Prepare(globalConfig *common.Config, config *common.RunnerCon
 	}
 
 	s.provisioned = true
-
-	s.Println("Starting SSH command...")
-	s.sshCommand = ssh.Client{
-		Config: *s.Config.SSH,
-		Stdout: s.BuildTrace,
-		Stderr: s.BuildTrace,
-	}
-	s.sshCommand.Port = s.sshPort
-	s.sshCommand.Host = "localhost"
-
-	s.Debugln("Connecting to SSH server...")
-	err = s.sshCommand.Connect()
-	if err != nil {
-		return err
-	}
 	return nil
 }
 
@@ -278,6 +317,7 @@ func (s *executor) Run(cmd common.ExecutorCommand) error {
 		Command:     s.BuildShell.GetCommandWithArguments(),
 		Stdin:       cmd.Script,
 		Abort:       cmd.Abort,
+		ScriptFile:  ssh.ScriptFile(s.Build.ID),
 	})
 	if _, ok := err.(*ssh.ExitError); ok {
 		err = &common.BuildError{Inner: err}
@@ -288,7 +328,8 @@ func (s *executor) Run(cmd common.ExecutorCommand) error {
 func (s *executor) Cleanup() {
 	s.sshCommand.Cleanup()
 
-	if s.vmName != "" {
+	// the VMs of the pool are recycled when they're released
+	if s.vmName != "" && s.poolVM == nil {
 		vbox.Kill(s.vmName)
 
 		if s.Config.VirtualBox.DisableSnapshots || !s.provisioned {
@@ -302,18 +343,22 @@ func init() {
 		DefaultBuildsDir: "builds",
 		SharedBuildsDir:  false,
 		Shell: common.ShellScriptInfo{
-			Shell:         "bash",
-			Type:          common.LoginShell,
-			RunnerCommand: "gitlab-runner",
+			Shell:                        "bash",
+			Type:                         common.LoginShell,
+			RunnerCommand:                "gitlab-runner",
+			MaskedVariablesInEnvironment: true,
 		},
 		ShowHostname: true,
 	}
 
+	pool := vmpool.New("VirtualBox", vboxController{})
+
 	creator := func() common.Executor {
 		return &executor{
 			AbstractExecutor: executors.AbstractExecutor{
 				ExecutorOptions: options,
 			},
+			pool: pool,
 		}
 	}
 
@@ -321,8 +366,12 @@ func init() {
 		features.Variables = true
 	}
 
-	common.RegisterExecutor("virtualbox", executors.DefaultExecutorProvider{
-		Creator:         creator,
-		FeaturesUpdater: featuresUpdater,
+	common.RegisterExecutor("virtualbox", &vmpool.Provider{
+		DefaultExecutorProvider: executors.DefaultExecutorProvider{
+			Creator:         creator,
+			FeaturesUpdater: featuresUpdater,
+			DefaultShell:    options.Shell.Shell,
+		},
+		Pool: pool,
 	})
 }
@@ -0,0 +1,141 @@
+package virtualbox
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors/vmpool"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/ssh"
+	vbox "gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/virtualbox"
+)
+
+// vboxController manages the VMs of the pool with VBoxManage
+type vboxController struct{}
+
+func (vboxController) Options(config *common.RunnerConfig) vmpool.Options {
+	if config.VirtualBox == nil {
+		return vmpool.Options{}
+	}
+
+	return vmpool.Options{
+		Size:           config.VirtualBox.PoolSize,
+		MaxBuilds:      config.VirtualBox.PoolMaxBuilds,
+		TTL:            time.Duration(config.VirtualBox.PoolTTL) * time.Second,
+		DisableRecycle: config.VirtualBox.DisableSnapshots,
+		BaseName:       config.VirtualBox.BaseName,
+	}
+}
+
+// runSSH runs the command in the VM, retrying the connection while the VM
+// is booting
+func runSSH(config *common.RunnerConfig, name string, command ssh.Command) error {
+	if config.SSH == nil {
+		return errors.New("Missing SSH config")
+	}
+
+	port, err := vbox.FindSSHPort(name)
+	if err != nil {
+		return err
+	}
+
+	sshCommand := ssh.Client{
+		Config:         *config.SSH,
+		ConnectRetries: 30,
+	}
+	sshCommand.Port = port
+	sshCommand.Host = "localhost"
+
+	err = sshCommand.Connect()
+	if err != nil {
+		return err
+	}
+	defer sshCommand.Cleanup()
+	return sshCommand.Run(command)
+}
+
+func (vboxController) Create(config *common.RunnerConfig, name string) error {
+	baseImage := config.VirtualBox.BaseName
+	baseSnapshot := determineBaseSnapshot(config.VirtualBox, baseImage, logrus.WithField("name", name))
+	err := vbox.CreateOsVM(baseImage, name, baseSnapshot)
+	if err != nil {
+		return err
+	}
+
+	vmSSHPort := "22"
+	if config.SSH != nil && config.SSH.Port != "" {
+		vmSSHPort = config.SSH.Port
+	}
+	_, err = vbox.ConfigureSSH(name, vmSSHPort)
+	if err != nil {
+		return err
+	}
+
+	err = vbox.Start(name)
+	if err != nil {
+		return err
+	}
+
+	err = vbox.WaitForStatus(name, vbox.Running, 60)
+	if err != nil {
+		return err
+	}
+
+	err = runSSH(config, name, ssh.Command{Command: []string{"exit"}})
+	if err != nil {
+		return err
+	}
+
+	if config.VirtualBox.DisableSnapshots {
+		return nil
+	}
+	return vbox.CreateSnapshot(name, "Started")
+}
+
+func (vboxController) Recycle(config *common.RunnerConfig, name string) error {
+	err := vbox.Kill(name)
+	if err != nil {
+		return err
+	}
+
+	err = vbox.RevertToSnapshot(name)
+	if err != nil {
+		return err
+	}
+
+	err = vbox.Start(name)
+	if err != nil {
+		return err
+	}
+
+	return vbox.WaitForStatus(name, vbox.Running, 60)
+}
+
+// Provision runs the provisioning script in the VM, with bash over SSH
+func (vboxController) Provision(config *common.RunnerConfig, name string) error {
+	if config.VirtualBox.PoolProvisionScript == "" {
+		return nil
+	}
+
+	return runSSH(config, name, ssh.Command{
+		Command: []string{"bash"},
+		Stdin:   config.VirtualBox.PoolProvisionScript,
+	})
+}
+
+func (vboxController) IsHealthy(name string) bool {
+	status, err := vbox.Status(name)
+	return err == nil && status == vbox.Running
+}
+
+func (vboxController) Remove(name string) {
+	if !vbox.Exist(name) {
+		return
+	}
+
+	vbox.Kill(name)
+	vbox.Delete(name)
+	vbox.Unregister(name)
+}
@@ -0,0 +1,44 @@
+package virtualbox
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors/vmpool"
+)
+
+func TestPoolOptions(t *testing.T) {
+	config := &common.RunnerConfig{
+		RunnerSettings: common.RunnerSettings{
+			VirtualBox: &common.VirtualBoxConfig{
+				BaseName:      "ubuntu",
+				PoolSize:      3,
+				PoolMaxBuilds: 5,
+				PoolTTL:       600,
+			},
+		},
+	}
+
+	options := vboxController{}.Options(config)
+	assert.Equal(t, vmpool.Options{
+		Size:      3,
+		MaxBuilds: 5,
+		TTL:       10 * time.Minute,
+		BaseName:  "ubuntu",
+	}, options)
+
+	assert.Equal(t, vmpool.Options{}, vboxController{}.Options(&common.RunnerConfig{}))
+}
+
+func TestPoolProvisionWithoutScript(t *testing.T) {
+	config := &common.RunnerConfig{
+		RunnerSettings: common.RunnerSettings{
+			VirtualBox: &common.VirtualBoxConfig{BaseName: "ubuntu"},
+		},
+	}
+
+	assert.NoError(t, vboxController{}.Provision(config, "ubuntu-runner-abcdef12-pool-0"))
+}
@@ -0,0 +1,322 @@
+package vmpool
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+type State int
+
+const (
+	StateCreating State = iota
+	StateIdle
+	StateAcquired
+	StateUsed
+	StateRecycling
+	StateRemoving
+)
+
+// VM is a VM of the pool, passed to the executor as the ExecutorData
+type VM struct {
+	Name      string
+	State     State
+	UsedCount int
+	Created   time.Time
+	broken    bool
+	// runner and index identify the place of the VM in the pool of the
+	// runner, to remove it when the pool gets smaller
+	runner string
+	index  int
+}
+
+// Options configure the pool of a runner
+type Options struct {
+	// Size is the number of VMs kept ready, 0 disables the pool
+	Size int
+	// MaxBuilds is the number of builds after which the VM is rebuilt, 0 to
+	// only recycle it
+	MaxBuilds int
+	// TTL is the time after which the VM is rebuilt, 0 to keep it
+	TTL time.Duration
+	// DisableRecycle rebuilds the VM after every build, for the VMs that
+	// can't be reverted to a snapshot
+	DisableRecycle bool
+	// BaseName is the prefix of the names of the VMs
+	BaseName string
+}
+
+// Controller manages the VMs of the pool
+type Controller interface {
+	// Options returns the options of the pool of the runner
+	Options(config *common.RunnerConfig) Options
+	// Create clones the VM, boots it and, unless recycling is disabled,
+	// takes the snapshot the VM is reverted to
+	Create(config *common.RunnerConfig, name string) error
+	// Recycle reverts the booted VM to the snapshot
+	Recycle(config *common.RunnerConfig, name string) error
+	IsHealthy(name string) bool
+	Remove(name string)
+}
+
+// Provisioner is implemented by the controllers running the provisioning
+// hooks, which prepare the VMs after they're created or recycled
+type Provisioner interface {
+	Provision(config *common.RunnerConfig, name string) error
+}
+
+// Pool keeps booted VMs ready for the builds, doing the heavy work of
+// creating and recycling them off the critical path of the builds
+type Pool struct {
+	name       string
+	controller Controller
+	vms        map[string]*VM
+	lock       sync.Mutex
+	// pending tracks the VMs being created and recycled
+	pending sync.WaitGroup
+}
+
+// New creates the pool, the name is used in the messages
+func New(name string, controller Controller) *Pool {
+	return &Pool{
+		name:       name,
+		controller: controller,
+		vms:        make(map[string]*VM),
+	}
+}
+
+func VMName(options Options, config *common.RunnerConfig, index int) string {
+	return fmt.Sprintf("%s-runner-%s-pool-%d", options.BaseName, config.ShortDescription(), index)
+}
+
+func (p *Pool) Enabled(config *common.RunnerConfig) bool {
+	return config != nil && p.controller.Options(config).Size > 0
+}
+
+func (p *Pool) provision(config *common.RunnerConfig, vm *VM) error {
+	provisioner, ok := p.controller.(Provisioner)
+	if !ok {
+		return nil
+	}
+	return provisioner.Provision(config, vm.Name)
+}
+
+func (p *Pool) isExpired(options Options, vm *VM) bool {
+	return options.TTL > 0 && time.Since(vm.Created) > options.TTL
+}
+
+// isOutOfPool checks if the VM is left out of the pool of the runner, after
+// its size was reduced
+func (p *Pool) isOutOfPool(options Options, config *common.RunnerConfig, vm *VM) bool {
+	return vm.runner == config.ShortDescription() && vm.index >= options.Size
+}
+
+// rebuild removes the VM, left behind, expired or broken, and creates it
+// in the background; it needs to be called with the lock held
+func (p *Pool) rebuild(config *common.RunnerConfig, vm *VM) {
+	vm.State = StateCreating
+	p.pending.Add(1)
+
+	go func() {
+		defer p.pending.Done()
+
+		started := time.Now()
+		p.controller.Remove(vm.Name)
+		err := p.controller.Create(config, vm.Name)
+		if err == nil {
+			err = p.provision(config, vm)
+		}
+
+		p.lock.Lock()
+		defer p.lock.Unlock()
+
+		if err != nil {
+			logrus.WithField("name", vm.Name).WithError(err).
+				Errorln(p.name, "VM creation failed")
+			// it's created again by the next acquire
+			delete(p.vms, vm.Name)
+			return
+		}
+
+		logrus.WithField("name", vm.Name).
+			WithField("time", time.Since(started)).
+			Infoln(p.name, "VM created")
+		vm.State = StateIdle
+		vm.UsedCount = 0
+		vm.Created = time.Now()
+		vm.broken = false
+	}()
+}
+
+// recycle reverts the VM to the snapshot in the background; it needs to be
+// called with the lock held
+func (p *Pool) recycle(config *common.RunnerConfig, vm *VM) {
+	vm.State = StateRecycling
+	p.pending.Add(1)
+
+	go func() {
+		defer p.pending.Done()
+
+		err := p.controller.Recycle(config, vm.Name)
+		if err == nil {
+			err = p.provision(config, vm)
+		}
+
+		p.lock.Lock()
+		defer p.lock.Unlock()
+
+		if err != nil {
+			logrus.WithField("name", vm.Name).WithError(err).
+				Warningln(p.name, "VM recycling failed, rebuilding it")
+			p.rebuild(config, vm)
+			return
+		}
+		vm.State = StateIdle
+	}()
+}
+
+// remove removes the VM left out of the pool in the background; it needs to
+// be called with the lock held
+func (p *Pool) remove(vm *VM) {
+	vm.State = StateRemoving
+	p.pending.Add(1)
+
+	go func() {
+		defer p.pending.Done()
+
+		p.controller.Remove(vm.Name)
+
+		p.lock.Lock()
+		defer p.lock.Unlock()
+
+		logrus.WithField("name", vm.Name).Infoln(p.name, "VM removed")
+		delete(p.vms, vm.Name)
+	}()
+}
+
+// Acquire creates the missing VMs of the pool, rebuilds the unhealthy and
+// the expired ones and returns an idle VM. The health of the VM is checked
+// without the lock, as it can take a while.
+func (p *Pool) Acquire(config *common.RunnerConfig) (*VM, error) {
+	for {
+		vm := p.reserve(config)
+		if vm == nil {
+			return nil, fmt.Errorf("No free VMs in the %s pool", p.name)
+		}
+
+		if p.controller.IsHealthy(vm.Name) {
+			return vm, nil
+		}
+
+		logrus.WithField("name", vm.Name).Warningln(p.name, "VM is unhealthy, rebuilding it")
+		p.lock.Lock()
+		p.rebuild(config, vm)
+		p.lock.Unlock()
+	}
+}
+
+// reserve creates the missing VMs of the pool, rebuilds the expired ones,
+// removes the idle ones left out of the pool and acquires an idle VM
+func (p *Pool) reserve(config *common.RunnerConfig) *VM {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	options := p.controller.Options(config)
+
+	for _, vm := range p.vms {
+		if vm.State == StateIdle && p.isOutOfPool(options, config, vm) {
+			logrus.WithField("name", vm.Name).Infoln(p.name, "VM is out of the pool, removing it")
+			p.remove(vm)
+		}
+	}
+
+	var free *VM
+	for i := 0; i < options.Size; i++ {
+		name := VMName(options, config, i)
+		vm := p.vms[name]
+		if vm == nil {
+			vm = &VM{Name: name, runner: config.ShortDescription(), index: i}
+			p.vms[name] = vm
+			p.rebuild(config, vm)
+			continue
+		}
+
+		if vm.State != StateIdle {
+			continue
+		}
+
+		if p.isExpired(options, vm) {
+			logrus.WithField("name", name).Infoln(p.name, "VM expired, rebuilding it")
+			p.rebuild(config, vm)
+			continue
+		}
+
+		if free == nil {
+			free = vm
+		}
+	}
+
+	if free != nil {
+		free.State = StateAcquired
+	}
+	return free
+}
+
+// Use marks the VM as used by the build
+func (p *Pool) Use(vm *VM) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	vm.State = StateUsed
+	vm.UsedCount++
+}
+
+// MarkBroken makes the VM to be rebuilt when it's released
+func (p *Pool) MarkBroken(vm *VM) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	vm.broken = true
+}
+
+// Release returns the VM to the pool, rebuilding it when it's broken,
+// expired or after the configured number of builds, and recycling it
+// otherwise. The VM left out of the pool is removed.
+func (p *Pool) Release(config *common.RunnerConfig, vm *VM) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	options := p.controller.Options(config)
+
+	if (vm.State == StateAcquired || vm.State == StateUsed) && p.isOutOfPool(options, config, vm) {
+		p.remove(vm)
+		return
+	}
+
+	switch vm.State {
+	case StateAcquired:
+		if vm.broken || p.isExpired(options, vm) {
+			p.rebuild(config, vm)
+		} else {
+			vm.State = StateIdle
+		}
+
+	case StateUsed:
+		maxBuilds := options.MaxBuilds
+		if vm.broken || options.DisableRecycle || p.isExpired(options, vm) ||
+			(maxBuilds > 0 && vm.UsedCount >= maxBuilds) {
+			p.rebuild(config, vm)
+		} else {
+			p.recycle(config, vm)
+		}
+	}
+}
+
+// Wait waits for the VMs being created and recycled
+func (p *Pool) Wait() {
+	p.pending.Wait()
+}
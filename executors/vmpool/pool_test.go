@@ -0,0 +1,350 @@
+package vmpool
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+type fakeController struct {
+	options      Options
+	lock         sync.Mutex
+	created      []string
+	recycled     []string
+	removed      []string
+	provisioned  []string
+	unhealthy    map[string]bool
+	createErr    error
+	provisionErr error
+}
+
+func (c *fakeController) Options(config *common.RunnerConfig) Options {
+	return c.options
+}
+
+func (c *fakeController) Create(config *common.RunnerConfig, name string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.created = append(c.created, name)
+	return c.createErr
+}
+
+func (c *fakeController) Recycle(config *common.RunnerConfig, name string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.recycled = append(c.recycled, name)
+	return nil
+}
+
+func (c *fakeController) IsHealthy(name string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return !c.unhealthy[name]
+}
+
+func (c *fakeController) Remove(name string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.removed = append(c.removed, name)
+}
+
+type fakeProvisioner struct {
+	*fakeController
+}
+
+func (c fakeProvisioner) Provision(config *common.RunnerConfig, name string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.provisioned = append(c.provisioned, name)
+	return c.provisionErr
+}
+
+var poolTestConfig = &common.RunnerConfig{
+	RunnerCredentials: common.RunnerCredentials{Token: "abcdef1234567890"},
+}
+
+func newFakeController(size, maxBuilds int) *fakeController {
+	return &fakeController{
+		options: Options{
+			Size:      size,
+			MaxBuilds: maxBuilds,
+			BaseName:  "macos",
+		},
+		unhealthy: make(map[string]bool),
+	}
+}
+
+func newFilledPool(t *testing.T, controller Controller, size int) *Pool {
+	pool := New("Test", controller)
+
+	_, err := pool.Acquire(poolTestConfig)
+	assert.EqualError(t, err, "No free VMs in the Test pool")
+	pool.Wait()
+	require.Equal(t, size, len(pool.vms))
+	return pool
+}
+
+func TestVMName(t *testing.T) {
+	options := Options{BaseName: "macos"}
+	assert.Equal(t, "macos-runner-abcdef12-pool-1", VMName(options, poolTestConfig, 1))
+}
+
+func TestPoolCreatesVMs(t *testing.T) {
+	controller := newFakeController(2, 0)
+	pool := newFilledPool(t, controller, 2)
+
+	assert.Contains(t, controller.removed, "macos-runner-abcdef12-pool-0")
+	assert.Contains(t, controller.removed, "macos-runner-abcdef12-pool-1")
+
+	first, err := pool.Acquire(poolTestConfig)
+	require.NoError(t, err)
+	second, err := pool.Acquire(poolTestConfig)
+	require.NoError(t, err)
+	assert.NotEqual(t, first.Name, second.Name)
+
+	_, err = pool.Acquire(poolTestConfig)
+	assert.EqualError(t, err, "No free VMs in the Test pool")
+}
+
+func TestPoolReleaseNotUsedVM(t *testing.T) {
+	controller := newFakeController(1, 0)
+	pool := newFilledPool(t, controller, 1)
+
+	vm, err := pool.Acquire(poolTestConfig)
+	require.NoError(t, err)
+	pool.Release(poolTestConfig, vm)
+	pool.Wait()
+
+	assert.Equal(t, StateIdle, vm.State)
+	assert.Empty(t, controller.recycled)
+}
+
+func TestPoolRecyclesUsedVM(t *testing.T) {
+	controller := newFakeController(1, 0)
+	pool := newFilledPool(t, controller, 1)
+
+	vm, err := pool.Acquire(poolTestConfig)
+	require.NoError(t, err)
+	pool.Use(vm)
+	pool.Release(poolTestConfig, vm)
+	pool.Wait()
+
+	assert.Equal(t, StateIdle, vm.State)
+	assert.Equal(t, 1, vm.UsedCount)
+	require.Equal(t, 1, len(controller.recycled))
+	assert.Equal(t, vm.Name, controller.recycled[0])
+	assert.Equal(t, 1, len(controller.created))
+}
+
+func TestPoolRebuildsVMWhenRecycleIsDisabled(t *testing.T) {
+	controller := newFakeController(1, 0)
+	controller.options.DisableRecycle = true
+	pool := newFilledPool(t, controller, 1)
+
+	vm, err := pool.Acquire(poolTestConfig)
+	require.NoError(t, err)
+	pool.Use(vm)
+	pool.Release(poolTestConfig, vm)
+	pool.Wait()
+
+	assert.Empty(t, controller.recycled)
+	assert.Equal(t, 2, len(controller.created))
+}
+
+func TestPoolRebuildsVMAfterMaxBuilds(t *testing.T) {
+	controller := newFakeController(1, 2)
+	pool := newFilledPool(t, controller, 1)
+
+	for i := 0; i < 2; i++ {
+		vm, err := pool.Acquire(poolTestConfig)
+		require.NoError(t, err)
+		pool.Use(vm)
+		pool.Release(poolTestConfig, vm)
+		pool.Wait()
+	}
+
+	assert.Equal(t, 1, len(controller.recycled))
+	assert.Equal(t, 2, len(controller.created))
+
+	vm, err := pool.Acquire(poolTestConfig)
+	require.NoError(t, err)
+	assert.Equal(t, 0, vm.UsedCount)
+}
+
+func TestPoolRebuildsExpiredVM(t *testing.T) {
+	controller := newFakeController(1, 0)
+	controller.options.TTL = time.Hour
+	pool := newFilledPool(t, controller, 1)
+
+	vm := pool.vms["macos-runner-abcdef12-pool-0"]
+	vm.Created = time.Now().Add(-2 * time.Hour)
+
+	_, err := pool.Acquire(poolTestConfig)
+	assert.EqualError(t, err, "No free VMs in the Test pool")
+	pool.Wait()
+	assert.Equal(t, 2, len(controller.created))
+
+	vm, err = pool.Acquire(poolTestConfig)
+	require.NoError(t, err)
+	pool.Use(vm)
+	vm.Created = time.Now().Add(-2 * time.Hour)
+	pool.Release(poolTestConfig, vm)
+	pool.Wait()
+
+	assert.Empty(t, controller.recycled, "the expired VM isn't recycled")
+	assert.Equal(t, 3, len(controller.created))
+}
+
+func TestPoolRebuildsBrokenVM(t *testing.T) {
+	controller := newFakeController(1, 0)
+	pool := newFilledPool(t, controller, 1)
+
+	vm, err := pool.Acquire(poolTestConfig)
+	require.NoError(t, err)
+	pool.Use(vm)
+	pool.MarkBroken(vm)
+	pool.Release(poolTestConfig, vm)
+	pool.Wait()
+
+	assert.Empty(t, controller.recycled)
+	assert.Equal(t, 2, len(controller.created))
+	assert.False(t, vm.broken)
+}
+
+func TestPoolRebuildsUnhealthyVM(t *testing.T) {
+	controller := newFakeController(1, 0)
+	pool := newFilledPool(t, controller, 1)
+
+	controller.unhealthy["macos-runner-abcdef12-pool-0"] = true
+	_, err := pool.Acquire(poolTestConfig)
+	assert.EqualError(t, err, "No free VMs in the Test pool")
+	pool.Wait()
+	assert.Equal(t, 2, len(controller.created))
+
+	controller.unhealthy["macos-runner-abcdef12-pool-0"] = false
+	_, err = pool.Acquire(poolTestConfig)
+	assert.NoError(t, err)
+}
+
+type lockingController struct {
+	*fakeController
+	pool *Pool
+}
+
+func (c *lockingController) IsHealthy(name string) bool {
+	// the pool must not be locked while the health is checked
+	c.pool.lock.Lock()
+	defer c.pool.lock.Unlock()
+	return c.fakeController.IsHealthy(name)
+}
+
+func TestPoolChecksHealthWithoutLock(t *testing.T) {
+	controller := &lockingController{fakeController: newFakeController(1, 0)}
+	pool := New("Test", controller)
+	controller.pool = pool
+
+	_, err := pool.Acquire(poolTestConfig)
+	assert.Error(t, err)
+	pool.Wait()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := pool.Acquire(poolTestConfig)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Acquire is blocked by the health check")
+	}
+}
+
+func TestPoolRemovesVMsWhenShrunk(t *testing.T) {
+	controller := newFakeController(3, 0)
+	pool := newFilledPool(t, controller, 3)
+
+	used, err := pool.Acquire(poolTestConfig)
+	require.NoError(t, err)
+	require.Equal(t, "macos-runner-abcdef12-pool-0", used.Name)
+	pool.Use(used)
+
+	controller.options.Size = 0
+	controller.removed = nil
+	pool.Release(poolTestConfig, used)
+	pool.Wait()
+	assert.Equal(t, []string{"macos-runner-abcdef12-pool-0"}, controller.removed, "the released VM is removed")
+
+	controller.options.Size = 1
+	controller.removed = nil
+	_, err = pool.Acquire(poolTestConfig)
+	assert.Error(t, err)
+	pool.Wait()
+
+	assert.Equal(t, 3, len(controller.removed), "the idle VMs are removed, and the missing one is created")
+	assert.Equal(t, 1, len(pool.vms))
+	_, ok := pool.vms["macos-runner-abcdef12-pool-0"]
+	assert.True(t, ok)
+}
+
+func TestPoolRetriesFailedCreation(t *testing.T) {
+	controller := newFakeController(1, 0)
+	controller.createErr = errors.New("failed")
+	pool := New("Test", controller)
+
+	_, err := pool.Acquire(poolTestConfig)
+	assert.Error(t, err)
+	pool.Wait()
+	assert.Empty(t, pool.vms)
+
+	controller.createErr = nil
+	_, err = pool.Acquire(poolTestConfig)
+	assert.Error(t, err)
+	pool.Wait()
+
+	_, err = pool.Acquire(poolTestConfig)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(controller.created))
+}
+
+func TestPoolProvisionsVMs(t *testing.T) {
+	controller := newFakeController(1, 0)
+	pool := newFilledPool(t, fakeProvisioner{controller}, 1)
+	require.Equal(t, 1, len(controller.provisioned), "it provisions the created VM")
+
+	vm, err := pool.Acquire(poolTestConfig)
+	require.NoError(t, err)
+	pool.Use(vm)
+	pool.Release(poolTestConfig, vm)
+	pool.Wait()
+
+	assert.Equal(t, 2, len(controller.provisioned), "it provisions the recycled VM")
+	assert.Equal(t, 1, len(controller.created))
+}
+
+func TestPoolRebuildsVMWhenProvisioningFails(t *testing.T) {
+	controller := newFakeController(1, 0)
+	controller.provisionErr = errors.New("failed")
+	pool := New("Test", fakeProvisioner{controller})
+
+	_, err := pool.Acquire(poolTestConfig)
+	assert.Error(t, err)
+	pool.Wait()
+	assert.Empty(t, pool.vms, "the VM is created again by the next acquire")
+}
+
+func TestProviderWithoutPool(t *testing.T) {
+	p := &Provider{Pool: New("Test", newFakeController(0, 0))}
+
+	data, err := p.Acquire(poolTestConfig)
+	assert.NoError(t, err)
+	assert.Nil(t, data)
+	assert.NoError(t, p.Release(poolTestConfig, data))
+}
@@ -0,0 +1,32 @@
+package vmpool
+
+import (
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors"
+)
+
+// Provider assigns the VMs of the pool to the builds, when it's enabled
+type Provider struct {
+	executors.DefaultExecutorProvider
+	Pool *Pool
+}
+
+func (p *Provider) Acquire(config *common.RunnerConfig) (common.ExecutorData, error) {
+	if !p.Pool.Enabled(config) {
+		return nil, nil
+	}
+
+	vm, err := p.Pool.Acquire(config)
+	if err != nil {
+		return nil, err
+	}
+	return vm, nil
+}
+
+func (p *Provider) Release(config *common.RunnerConfig, data common.ExecutorData) error {
+	vm, _ := data.(*VM)
+	if vm != nil && p.Pool.Enabled(config) {
+		p.Pool.Release(config, vm)
+	}
+	return nil
+}
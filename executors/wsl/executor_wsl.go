@@ -0,0 +1,204 @@
+package wsl
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/wsl"
+)
+
+type executor struct {
+	executors.AbstractExecutor
+	distribution string
+	installDir   string
+	imported     bool
+}
+
+func getDistributionName(build *common.Build) string {
+	return fmt.Sprintf("runner-%s-project-%d-concurrent-%d",
+		build.Runner.ShortDescription(),
+		build.ProjectID,
+		build.RunnerID)
+}
+
+func (s *executor) getInstallDir() string {
+	installDir := s.Config.WSL.InstallDir
+	if installDir == "" {
+		installDir = os.TempDir()
+	}
+	return filepath.Join(installDir, s.distribution)
+}
+
+func (s *executor) importDistribution() error {
+	// remove the distribution left behind by a killed runner
+	wsl.Unregister(s.distribution)
+
+	err := os.MkdirAll(s.installDir, 0700)
+	if err != nil {
+		return err
+	}
+
+	s.Println("Importing distribution", s.distribution, "from", s.Config.WSL.Image, "...")
+	err = wsl.Import(s.distribution, s.installDir, s.Config.WSL.Image)
+	if err != nil {
+		return err
+	}
+	s.imported = true
+	return nil
+}
+
+func (s *executor) Prepare(globalConfig *common.Config, config *common.RunnerConfig, build *common.Build) error {
+	if runtime.GOOS != "windows" {
+		return errors.New("WSL executor is supported only on Windows")
+	}
+
+	if config.WSL == nil {
+		return errors.New("Missing WSL configuration")
+	}
+
+	if config.WSL.Image == "" {
+		return errors.New("Missing Image setting from WSL configuration")
+	}
+
+	if config.WSL.HelperBinary != "" {
+		runnerCommand, err := wsl.ToLinuxPath(config.WSL.HelperBinary)
+		if err != nil {
+			return fmt.Errorf("invalid helper_binary: %v", err)
+		}
+		s.Shell().RunnerCommand = runnerCommand
+	}
+
+	s.distribution = getDistributionName(build)
+	build.Hostname = s.distribution
+
+	err := s.AbstractExecutor.Prepare(globalConfig, config, build)
+	if err != nil {
+		return err
+	}
+
+	if s.BuildShell.PassFile {
+		return errors.New("WSL doesn't support shells that require script file")
+	}
+
+	version, err := wsl.Version()
+	if err != nil {
+		return err
+	}
+
+	s.Println("Using WSL executor with", version, "...")
+
+	s.installDir = s.getInstallDir()
+	return s.importDistribution()
+}
+
+func (s *executor) killAndWait(cmd *exec.Cmd, waitCh chan error) error {
+	for {
+		s.Debugln("Aborting command...")
+		helpers.KillProcessGroup(cmd)
+		// killing wsl.exe doesn't stop the Linux processes
+		wsl.Terminate(s.distribution)
+		select {
+		case <-time.After(time.Second):
+		case err := <-waitCh:
+			return err
+		}
+	}
+}
+
+func (s *executor) Run(cmd common.ExecutorCommand) error {
+	c := wsl.Command(s.distribution, s.Config.WSL.User, s.BuildShell.GetCommandWithArguments()...)
+
+	helpers.SetProcessGroup(c)
+	defer helpers.KillProcessGroup(c)
+
+	// the environment is exported by the script read from the standard input,
+	// as the arguments of the command are visible to all users of the host
+	var script bytes.Buffer
+	for _, keyValue := range s.BuildShell.Environment {
+		script.WriteString("export " + helpers.ShellEscape(keyValue) + "\n")
+	}
+	script.WriteString(cmd.Script)
+
+	c.Stdin = &script
+	c.Stdout = s.BuildTrace
+	c.Stderr = s.BuildTrace
+
+	err := c.Start()
+	if err != nil {
+		return fmt.Errorf("Failed to start process: %s", err)
+	}
+
+	waitCh := make(chan error)
+	go func() {
+		err := c.Wait()
+		if _, ok := err.(*exec.ExitError); ok {
+			err = &common.BuildError{Inner: err}
+		}
+		waitCh <- err
+	}()
+
+	select {
+	case err = <-waitCh:
+		return err
+
+	case <-cmd.Abort:
+		return s.killAndWait(c, waitCh)
+	}
+}
+
+func (s *executor) Cleanup() {
+	if s.imported {
+		err := wsl.Unregister(s.distribution)
+		if err != nil {
+			s.Warningln("Failed to unregister distribution", s.distribution+":", err)
+		}
+	}
+
+	if s.installDir != "" {
+		os.RemoveAll(s.installDir)
+	}
+
+	s.AbstractExecutor.Cleanup()
+}
+
+func init() {
+	options := executors.ExecutorOptions{
+		DefaultBuildsDir: "/builds",
+		DefaultCacheDir:  "/cache",
+		SharedBuildsDir:  false,
+		Shell: common.ShellScriptInfo{
+			Shell:                        "bash",
+			Type:                         common.LoginShell,
+			RunnerCommand:                "gitlab-runner",
+			MaskedVariablesInEnvironment: true,
+		},
+		ShowHostname: true,
+	}
+
+	creator := func() common.Executor {
+		return &executor{
+			AbstractExecutor: executors.AbstractExecutor{
+				ExecutorOptions: options,
+			},
+		}
+	}
+
+	featuresUpdater := func(features *common.FeaturesInfo) {
+		features.Variables = true
+	}
+
+	common.RegisterExecutor("wsl", executors.DefaultExecutorProvider{
+		Creator:         creator,
+		FeaturesUpdater: featuresUpdater,
+		DefaultShell:    options.Shell.Shell,
+	})
+}
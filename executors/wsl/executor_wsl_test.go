@@ -0,0 +1,57 @@
+package wsl
+
+import (
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors"
+)
+
+func newTestExecutor(config *common.WSLConfig) *executor {
+	runner := &common.RunnerConfig{
+		RunnerCredentials: common.RunnerCredentials{Token: "abcdef1234567890"},
+		RunnerSettings:    common.RunnerSettings{WSL: config},
+	}
+	build := &common.Build{
+		GetBuildResponse: common.GetBuildResponse{ID: 10, ProjectID: 20},
+		Runner:           runner,
+		RunnerID:         3,
+	}
+
+	return &executor{
+		AbstractExecutor: executors.AbstractExecutor{
+			Config: *runner,
+			Build:  build,
+		},
+	}
+}
+
+func TestWSLExecutorRegistered(t *testing.T) {
+	executors := common.GetExecutors()
+	assert.Contains(t, executors, "wsl")
+}
+
+func TestGetDistributionName(t *testing.T) {
+	e := newTestExecutor(&common.WSLConfig{})
+	assert.Equal(t, "runner-abcdef12-project-20-concurrent-3", getDistributionName(e.Build))
+}
+
+func TestGetInstallDir(t *testing.T) {
+	e := newTestExecutor(&common.WSLConfig{InstallDir: filepath.Join("runner", "wsl")})
+	e.distribution = "runner-abcdef12-project-20-concurrent-3"
+	assert.Equal(t, filepath.Join("runner", "wsl", "runner-abcdef12-project-20-concurrent-3"), e.getInstallDir())
+}
+
+func TestPrepareOnlyOnWindows(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Test for non-Windows hosts")
+	}
+
+	e := newTestExecutor(&common.WSLConfig{Image: "ubuntu.tar.gz"})
+	err := e.Prepare(nil, &e.Config, e.Build)
+	assert.EqualError(t, err, "WSL executor is supported only on Windows")
+}
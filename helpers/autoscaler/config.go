@@ -0,0 +1,25 @@
+package autoscaler
+
+const defaultDockerPort = 2376
+
+type Config struct {
+	Provider          string   `toml:"provider" json:"provider" long:"provider" env:"AUTOSCALER_PROVIDER" description:"The driver creating the instances: aws-ec2, gcp or azure"`
+	Region            string   `toml:"region,omitempty" json:"region" long:"region" env:"AUTOSCALER_REGION" description:"Region (aws-ec2), zone (gcp) or location (azure) of the instances"`
+	Project           string   `toml:"project,omitempty" json:"project" long:"project" env:"AUTOSCALER_PROJECT" description:"Project (gcp) or resource group (azure) of the instances"`
+	InstanceType      string   `toml:"instance_type,omitempty" json:"instance_type" long:"instance-type" env:"AUTOSCALER_INSTANCE_TYPE" description:"Instance type (aws-ec2), machine type (gcp) or VM size (azure)"`
+	Image             string   `toml:"image" json:"image" long:"image" env:"AUTOSCALER_IMAGE" description:"Image of the instances, running Docker: AMI ID (aws-ec2), image (gcp) or image URN (azure)"`
+	Subnet            string   `toml:"subnet,omitempty" json:"subnet" long:"subnet" env:"AUTOSCALER_SUBNET" description:"Subnet of the instances"`
+	SecurityGroups    []string `toml:"security_groups,omitempty" json:"security_groups" long:"security-groups" env:"AUTOSCALER_SECURITY_GROUPS" description:"Security groups (aws-ec2) or network tags (gcp) of the instances"`
+	UserDataFile      string   `toml:"user_data_file,omitempty" json:"user_data_file" long:"user-data-file" env:"AUTOSCALER_USER_DATA_FILE" description:"File with the cloud-init user data of the instances"`
+	UsePrivateAddress bool     `toml:"use_private_address,omitzero" json:"use_private_address" long:"use-private-address" env:"AUTOSCALER_USE_PRIVATE_ADDRESS" description:"Connect to the private address of the instances"`
+	DockerPort        int      `toml:"docker_port,omitzero" json:"docker_port" long:"docker-port" env:"AUTOSCALER_DOCKER_PORT" description:"Port of the Docker daemon of the instances (default: 2376)"`
+	DockerCertPath    string   `toml:"docker_cert_path,omitempty" json:"docker_cert_path" long:"docker-cert-path" env:"AUTOSCALER_DOCKER_CERT_PATH" description:"Directory with the TLS client certificates of the Docker daemons, TLS isn't used when empty"`
+	CreateOptions     []string `toml:"create_options,omitempty" json:"create_options" long:"create-options" env:"AUTOSCALER_CREATE_OPTIONS" description:"Additional arguments of the command creating the instances"`
+}
+
+func (c *Config) GetDockerPort() int {
+	if c.DockerPort <= 0 {
+		return defaultDockerPort
+	}
+	return c.DockerPort
+}
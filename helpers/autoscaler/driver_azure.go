@@ -0,0 +1,88 @@
+package autoscaler
+
+import (
+	"errors"
+)
+
+// azureProvider creates the instances with the Azure CLI
+type azureProvider struct {
+	config *Config
+}
+
+func (p *azureProvider) run(args ...string) (string, error) {
+	if p.config.Project != "" {
+		args = append(args, "--resource-group", p.config.Project)
+	}
+	return runCLI("az", append([]string{"vm"}, args...)...)
+}
+
+func (p *azureProvider) Create(name string) error {
+	args := []string{
+		"create",
+		"--name", name,
+		"--image", p.config.Image,
+		"--tags", instanceLabel + "=true",
+		"--admin-username", "gitlab-runner",
+		"--generate-ssh-keys",
+		"--output", "none",
+	}
+	if p.config.Region != "" {
+		args = append(args, "--location", p.config.Region)
+	}
+	if p.config.InstanceType != "" {
+		args = append(args, "--size", p.config.InstanceType)
+	}
+	if p.config.Subnet != "" {
+		args = append(args, "--subnet", p.config.Subnet)
+	}
+	if p.config.UserDataFile != "" {
+		args = append(args, "--custom-data", p.config.UserDataFile)
+	}
+	if p.config.UsePrivateAddress {
+		args = append(args, "--public-ip-address", "")
+	}
+	args = append(args, p.config.CreateOptions...)
+
+	_, err := p.run(args...)
+	return err
+}
+
+func (p *azureProvider) Delete(name string) error {
+	_, err := p.run("delete", "--name", name, "--yes")
+	return err
+}
+
+func (p *azureProvider) List() ([]string, error) {
+	output, err := p.run("list",
+		"--query", "[?tags.\""+instanceLabel+"\"=='true'].name",
+		"--output", "tsv")
+	if err != nil {
+		return nil, err
+	}
+	return splitNames(output), nil
+}
+
+func (p *azureProvider) ConnectionInfo(name string) (info ConnectionInfo, err error) {
+	query := "[0].virtualMachine.network.publicIpAddresses[0].ipAddress"
+	if p.config.UsePrivateAddress {
+		query = "[0].virtualMachine.network.privateIpAddresses[0]"
+	}
+
+	output, err := p.run("list-ip-addresses", "--name", name, "--query", query, "--output", "tsv")
+	if err != nil {
+		return
+	}
+
+	if output == "" {
+		err = errors.New("Instance " + name + " has no IP address")
+		return
+	}
+	info.Address = output
+	return
+}
+
+func init() {
+	RegisterDriver("azure", func(config *Config) Provider {
+		return &azureProvider{config: config}
+	})
+}
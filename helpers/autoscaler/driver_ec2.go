@@ -0,0 +1,115 @@
+package autoscaler
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ec2Provider creates the instances with the AWS CLI
+type ec2Provider struct {
+	config *Config
+}
+
+func (p *ec2Provider) run(args ...string) (string, error) {
+	if p.config.Region != "" {
+		args = append(args, "--region", p.config.Region)
+	}
+	return runCLI("aws", append([]string{"ec2"}, args...)...)
+}
+
+func (p *ec2Provider) Create(name string) error {
+	args := []string{
+		"run-instances",
+		"--image-id", p.config.Image,
+		"--count", "1",
+		"--tag-specifications", fmt.Sprintf("ResourceType=instance,Tags=[{Key=Name,Value=%s},{Key=%s,Value=true}]", name, instanceLabel),
+		"--query", "Instances[0].InstanceId",
+		"--output", "text",
+	}
+	if p.config.InstanceType != "" {
+		args = append(args, "--instance-type", p.config.InstanceType)
+	}
+	if p.config.Subnet != "" {
+		args = append(args, "--subnet-id", p.config.Subnet)
+	}
+	if len(p.config.SecurityGroups) > 0 {
+		args = append(args, "--security-group-ids")
+		args = append(args, p.config.SecurityGroups...)
+	}
+	if p.config.UserDataFile != "" {
+		args = append(args, "--user-data", "file://"+p.config.UserDataFile)
+	}
+	args = append(args, p.config.CreateOptions...)
+
+	instanceID, err := p.run(args...)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.run("wait", "instance-running", "--instance-ids", instanceID)
+	return err
+}
+
+func (p *ec2Provider) describe(name string, query string) (string, error) {
+	return p.run("describe-instances",
+		"--filters",
+		"Name=tag:Name,Values="+name,
+		"Name=tag:"+instanceLabel+",Values=true",
+		"Name=instance-state-name,Values=pending,running,stopping,stopped",
+		"--query", query,
+		"--output", "text")
+}
+
+func (p *ec2Provider) Delete(name string) error {
+	output, err := p.describe(name, "Reservations[].Instances[].InstanceId")
+	if err != nil {
+		return err
+	}
+
+	instanceIDs := splitNames(output)
+	if len(instanceIDs) == 0 {
+		return nil
+	}
+
+	_, err = p.run(append([]string{"terminate-instances", "--instance-ids"}, instanceIDs...)...)
+	return err
+}
+
+func (p *ec2Provider) List() ([]string, error) {
+	output, err := p.run("describe-instances",
+		"--filters",
+		"Name=tag:"+instanceLabel+",Values=true",
+		"Name=instance-state-name,Values=pending,running,stopping,stopped",
+		"--query", "Reservations[].Instances[].Tags[?Key=='Name'].Value[]",
+		"--output", "text")
+	if err != nil {
+		return nil, err
+	}
+	return splitNames(output), nil
+}
+
+func (p *ec2Provider) ConnectionInfo(name string) (info ConnectionInfo, err error) {
+	query := "Reservations[0].Instances[0].PublicIpAddress"
+	if p.config.UsePrivateAddress {
+		query = "Reservations[0].Instances[0].PrivateIpAddress"
+	}
+
+	output, err := p.describe(name, query)
+	if err != nil {
+		return
+	}
+
+	if output == "" || strings.EqualFold(output, "none") {
+		err = errors.New("Instance " + name + " has no IP address")
+		return
+	}
+	info.Address = output
+	return
+}
+
+func init() {
+	RegisterDriver("aws-ec2", func(config *Config) Provider {
+		return &ec2Provider{config: config}
+	})
+}
@@ -0,0 +1,96 @@
+package autoscaler
+
+import (
+	"errors"
+	"strings"
+)
+
+// gcpProvider creates the instances with the Google Cloud SDK
+type gcpProvider struct {
+	config *Config
+}
+
+func (p *gcpProvider) run(args ...string) (string, error) {
+	if p.config.Project != "" {
+		args = append(args, "--project", p.config.Project)
+	}
+	return runCLI("gcloud", append([]string{"compute", "instances"}, args...)...)
+}
+
+func (p *gcpProvider) Create(name string) error {
+	args := []string{
+		"create", name,
+		"--image", p.config.Image,
+		"--labels", instanceLabel + "=true",
+		"--format", "value(name)",
+	}
+	if p.config.Region != "" {
+		args = append(args, "--zone", p.config.Region)
+	}
+	if p.config.InstanceType != "" {
+		args = append(args, "--machine-type", p.config.InstanceType)
+	}
+	if p.config.Subnet != "" {
+		args = append(args, "--subnet", p.config.Subnet)
+	}
+	if len(p.config.SecurityGroups) > 0 {
+		args = append(args, "--tags", strings.Join(p.config.SecurityGroups, ","))
+	}
+	if p.config.UserDataFile != "" {
+		args = append(args, "--metadata-from-file", "user-data="+p.config.UserDataFile)
+	}
+	if p.config.UsePrivateAddress {
+		args = append(args, "--no-address")
+	}
+	args = append(args, p.config.CreateOptions...)
+
+	_, err := p.run(args...)
+	return err
+}
+
+func (p *gcpProvider) zoneArgs(args ...string) []string {
+	if p.config.Region != "" {
+		args = append(args, "--zone", p.config.Region)
+	}
+	return args
+}
+
+func (p *gcpProvider) Delete(name string) error {
+	_, err := p.run(p.zoneArgs("delete", name, "--quiet")...)
+	return err
+}
+
+func (p *gcpProvider) List() ([]string, error) {
+	output, err := p.run("list",
+		"--filter", "labels."+instanceLabel+"=true",
+		"--format", "value(name)")
+	if err != nil {
+		return nil, err
+	}
+	return splitNames(output), nil
+}
+
+func (p *gcpProvider) ConnectionInfo(name string) (info ConnectionInfo, err error) {
+	format := "value(networkInterfaces[0].accessConfigs[0].natIP)"
+	if p.config.UsePrivateAddress {
+		format = "value(networkInterfaces[0].networkIP)"
+	}
+
+	output, err := p.run(p.zoneArgs("describe", name, "--format", format)...)
+	if err != nil {
+		return
+	}
+
+	if output == "" {
+		err = errors.New("Instance " + name + " has no IP address")
+		return
+	}
+	info.Address = output
+	return
+}
+
+func init() {
+	RegisterDriver("gcp", func(config *Config) Provider {
+		return &gcpProvider{config: config}
+	})
+}
@@ -0,0 +1,119 @@
+package autoscaler
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/docker"
+)
+
+const connectTimeout = 10 * time.Second
+
+// machine uses the provider in place of docker-machine, for the instances
+// already running Docker
+type machine struct {
+	config *Config
+}
+
+func (m *machine) provider() (Provider, error) {
+	return NewProvider(m.config)
+}
+
+// Create creates the instance; the driver and the options of docker-machine
+// are not used
+func (m *machine) Create(driver, name string, opts ...string) error {
+	provider, err := m.provider()
+	if err != nil {
+		return err
+	}
+	return provider.Create(name)
+}
+
+// Provision checks that the instance exists, as it's provisioned from its
+// image and user data
+func (m *machine) Provision(name string) error {
+	provider, err := m.provider()
+	if err != nil {
+		return err
+	}
+	_, err = provider.ConnectionInfo(name)
+	return err
+}
+
+func (m *machine) Remove(name string) error {
+	provider, err := m.provider()
+	if err != nil {
+		return err
+	}
+	return provider.Delete(name)
+}
+
+func (m *machine) List() ([]string, error) {
+	provider, err := m.provider()
+	if err != nil {
+		return nil, err
+	}
+	return provider.List()
+}
+
+func (m *machine) Exist(name string) bool {
+	machines, err := m.List()
+	if err != nil {
+		return false
+	}
+
+	for _, machine := range machines {
+		if machine == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *machine) address(name string) (string, error) {
+	provider, err := m.provider()
+	if err != nil {
+		return "", err
+	}
+
+	info, err := provider.ConnectionInfo(name)
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(info.Address, strconv.Itoa(m.config.GetDockerPort())), nil
+}
+
+// CanConnect checks that the Docker daemon of the instance accepts connections
+func (m *machine) CanConnect(name string) bool {
+	address, err := m.address(name)
+	if err != nil {
+		return false
+	}
+
+	conn, err := net.DialTimeout("tcp", address, connectTimeout)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+func (m *machine) Credentials(name string) (dc docker_helpers.DockerCredentials, err error) {
+	address, err := m.address(name)
+	if err != nil {
+		return
+	}
+
+	dc.Host = fmt.Sprintf("tcp://%s", address)
+	dc.CertPath = m.config.DockerCertPath
+	dc.TLSVerify = m.config.DockerCertPath != ""
+	return
+}
+
+// NewMachine returns the docker-machine replacement creating the instances
+// with the provider of the configuration
+func NewMachine(config *Config) docker_helpers.Machine {
+	return &machine{config: config}
+}
@@ -0,0 +1,92 @@
+package autoscaler
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// instanceLabel marks the instances created by the Runner, so only these
+// are listed and removed
+const instanceLabel = "gitlab-runner-autoscaler"
+
+// ConnectionInfo describes how to connect to an instance
+type ConnectionInfo struct {
+	Address string
+}
+
+// Provider creates the instances of the autoscaled fleet in a cloud
+type Provider interface {
+	// Create creates the instance and waits for it to be running
+	Create(name string) error
+	Delete(name string) error
+	// List returns the names of the instances created by the Runner
+	List() ([]string, error)
+	ConnectionInfo(name string) (ConnectionInfo, error)
+}
+
+// Factory creates the provider of a driver for the configuration
+type Factory func(config *Config) Provider
+
+var drivers = make(map[string]Factory)
+var driversLock sync.RWMutex
+
+func RegisterDriver(name string, factory Factory) {
+	driversLock.Lock()
+	defer driversLock.Unlock()
+
+	if drivers[name] != nil {
+		panic("Driver already exist: " + name)
+	}
+	drivers[name] = factory
+}
+
+func GetDrivers() (names []string) {
+	driversLock.RLock()
+	defer driversLock.RUnlock()
+
+	for name := range drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+func NewProvider(config *Config) (Provider, error) {
+	driversLock.RLock()
+	factory := drivers[config.Provider]
+	driversLock.RUnlock()
+
+	if factory == nil {
+		return nil, fmt.Errorf("Unknown autoscaler provider %q, use one of: %s",
+			config.Provider, strings.Join(GetDrivers(), ", "))
+	}
+	return factory(config), nil
+}
+
+// runCLI runs the command line tool of the cloud and returns its output.
+// It's a variable, so tests can replace it.
+var runCLI = func(name string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	logrus.Debugf("Executing %s: %#v", name, args)
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+
+	if _, ok := err.(*exec.ExitError); ok {
+		err = fmt.Errorf("%s error: %s", name, strings.TrimSpace(stderr.String()))
+	}
+
+	return strings.TrimSpace(stdout.String()), err
+}
+
+// splitNames splits the names printed one per line, or separated by spaces
+func splitNames(output string) []string {
+	return strings.Fields(output)
+}
@@ -0,0 +1,189 @@
+package autoscaler
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type cliCall struct {
+	name string
+	args string
+}
+
+// mockCLI replaces the command line tools, answering the commands starting
+// with the keys of the outputs
+func mockCLI(outputs map[string]string) (calls *[]cliCall, restore func()) {
+	calls = &[]cliCall{}
+	original := runCLI
+	runCLI = func(name string, args ...string) (string, error) {
+		call := cliCall{name: name, args: strings.Join(args, " ")}
+		*calls = append(*calls, call)
+
+		for prefix, output := range outputs {
+			if strings.HasPrefix(call.args, prefix) {
+				return output, nil
+			}
+		}
+		return "", errors.New("unexpected command")
+	}
+	return calls, func() { runCLI = original }
+}
+
+func TestNewProvider(t *testing.T) {
+	assert.Equal(t, []string{"aws-ec2", "azure", "gcp"}, GetDrivers())
+
+	provider, err := NewProvider(&Config{Provider: "gcp"})
+	require.NoError(t, err)
+	assert.IsType(t, &gcpProvider{}, provider)
+
+	_, err = NewProvider(&Config{Provider: "docker-machine"})
+	assert.EqualError(t, err, `Unknown autoscaler provider "docker-machine", use one of: aws-ec2, azure, gcp`)
+}
+
+func TestEC2Provider(t *testing.T) {
+	calls, restore := mockCLI(map[string]string{
+		"ec2 run-instances": "i-0123456789",
+		"ec2 wait":          "",
+		"ec2 describe-instances --filters Name=tag:Name":                     "10.0.0.5",
+		"ec2 describe-instances --filters Name=tag:gitlab-runner-autoscaler": "runner-1\trunner-2",
+	})
+	defer restore()
+
+	provider := &ec2Provider{config: &Config{
+		Provider:       "aws-ec2",
+		Region:         "eu-west-1",
+		Image:          "ami-123",
+		InstanceType:   "m4.large",
+		SecurityGroups: []string{"sg-1", "sg-2"},
+	}}
+
+	require.NoError(t, provider.Create("runner-1"))
+	require.Equal(t, 2, len(*calls))
+	assert.Contains(t, (*calls)[0].args, "--image-id ami-123")
+	assert.Contains(t, (*calls)[0].args, "--instance-type m4.large")
+	assert.Contains(t, (*calls)[0].args, "--security-group-ids sg-1 sg-2")
+	assert.Contains(t, (*calls)[0].args, "{Key=Name,Value=runner-1}")
+	assert.Contains(t, (*calls)[0].args, "--region eu-west-1")
+	assert.Equal(t, "ec2 wait instance-running --instance-ids i-0123456789 --region eu-west-1", (*calls)[1].args)
+
+	names, err := provider.List()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"runner-1", "runner-2"}, names)
+
+	info, err := provider.ConnectionInfo("runner-1")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.5", info.Address)
+	assert.Contains(t, (*calls)[len(*calls)-1].args, "PublicIpAddress")
+}
+
+func TestGCPProvider(t *testing.T) {
+	calls, restore := mockCLI(map[string]string{
+		"compute instances create":   "runner-1",
+		"compute instances delete":   "",
+		"compute instances describe": "",
+	})
+	defer restore()
+
+	provider := &gcpProvider{config: &Config{
+		Provider:          "gcp",
+		Project:           "ci",
+		Region:            "europe-west1-b",
+		Image:             "projects/ci/global/images/docker",
+		UsePrivateAddress: true,
+	}}
+
+	require.NoError(t, provider.Create("runner-1"))
+	assert.Contains(t, (*calls)[0].args, "create runner-1 --image projects/ci/global/images/docker")
+	assert.Contains(t, (*calls)[0].args, "--labels gitlab-runner-autoscaler=true")
+	assert.Contains(t, (*calls)[0].args, "--zone europe-west1-b")
+	assert.Contains(t, (*calls)[0].args, "--no-address")
+	assert.Contains(t, (*calls)[0].args, "--project ci")
+
+	require.NoError(t, provider.Delete("runner-1"))
+	assert.Equal(t, "compute instances delete runner-1 --quiet --zone europe-west1-b --project ci", (*calls)[1].args)
+
+	_, err := provider.ConnectionInfo("runner-1")
+	assert.EqualError(t, err, "Instance runner-1 has no IP address")
+	assert.Contains(t, (*calls)[2].args, "networkIP")
+}
+
+func TestAzureProvider(t *testing.T) {
+	calls, restore := mockCLI(map[string]string{
+		"vm create":            "",
+		"vm list ":             "runner-1\nrunner-2",
+		"vm list-ip-addresses": "52.0.0.5",
+	})
+	defer restore()
+
+	provider := &azureProvider{config: &Config{
+		Provider:     "azure",
+		Project:      "ci",
+		Region:       "westeurope",
+		Image:        "Canonical:UbuntuServer:16.04-LTS:latest",
+		InstanceType: "Standard_D2_v2",
+		UserDataFile: "/etc/gitlab-runner/cloud-init.yml",
+	}}
+
+	require.NoError(t, provider.Create("runner-1"))
+	assert.Contains(t, (*calls)[0].args, "--size Standard_D2_v2")
+	assert.Contains(t, (*calls)[0].args, "--custom-data /etc/gitlab-runner/cloud-init.yml")
+	assert.Contains(t, (*calls)[0].args, "--resource-group ci")
+
+	names, err := provider.List()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"runner-1", "runner-2"}, names)
+
+	info, err := provider.ConnectionInfo("runner-1")
+	require.NoError(t, err)
+	assert.Equal(t, "52.0.0.5", info.Address)
+}
+
+type testProvider struct {
+	address string
+}
+
+func (p *testProvider) Create(name string) error { return nil }
+func (p *testProvider) Delete(name string) error { return nil }
+func (p *testProvider) List() ([]string, error)  { return []string{"runner-1"}, nil }
+func (p *testProvider) ConnectionInfo(name string) (ConnectionInfo, error) {
+	return ConnectionInfo{Address: p.address}, nil
+}
+
+func TestMachine(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	RegisterDriver("test", func(config *Config) Provider {
+		return &testProvider{address: "127.0.0.1"}
+	})
+	defer func() {
+		driversLock.Lock()
+		delete(drivers, "test")
+		driversLock.Unlock()
+	}()
+
+	m := NewMachine(&Config{Provider: "test", DockerPort: port, DockerCertPath: "/etc/gitlab-runner/certs"})
+	assert.True(t, m.Exist("runner-1"))
+	assert.False(t, m.Exist("runner-2"))
+	assert.True(t, m.CanConnect("runner-1"))
+
+	dc, err := m.Credentials("runner-1")
+	require.NoError(t, err)
+	assert.Equal(t, "tcp://127.0.0.1:"+strconv.Itoa(port), dc.Host)
+	assert.Equal(t, "/etc/gitlab-runner/certs", dc.CertPath)
+	assert.True(t, dc.TLSVerify)
+}
+
+func TestMachineUnknownProvider(t *testing.T) {
+	m := NewMachine(&Config{Provider: "unknown"})
+	assert.Error(t, m.Create("", "runner-1"))
+	assert.False(t, m.CanConnect("runner-1"))
+}
@@ -0,0 +1,74 @@
+package cli_helpers
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/rotatelog"
+)
+
+func SetupLogFormatOptions(app *cli.App) {
+	newFlags := []cli.Flag{
+		cli.StringFlag{
+			Name:   "log-format",
+			Value:  "text",
+			Usage:  "Log format (options: text, json)",
+			EnvVar: "LOG_FORMAT",
+		},
+		cli.StringFlag{
+			Name:   "log-file",
+			Usage:  "Write the logs to the file, rotated, instead of stderr",
+			EnvVar: "LOG_FILE",
+		},
+		cli.IntFlag{
+			Name:   "log-max-size",
+			Value:  100,
+			Usage:  "Rotate the log file when it reaches the size in megabytes, 0 to disable",
+			EnvVar: "LOG_MAX_SIZE",
+		},
+		cli.DurationFlag{
+			Name:   "log-rotate-interval",
+			Usage:  "Rotate the log file at this interval, like 24h, 0 to disable",
+			EnvVar: "LOG_ROTATE_INTERVAL",
+		},
+		cli.IntFlag{
+			Name:   "log-max-backups",
+			Value:  5,
+			Usage:  "Number of the rotated log files kept, 0 to keep all of them",
+			EnvVar: "LOG_MAX_BACKUPS",
+		},
+	}
+	app.Flags = append(app.Flags, newFlags...)
+
+	appBefore := app.Before
+	app.Before = func(c *cli.Context) error {
+		// the log level options set the output to stderr first
+		if appBefore != nil {
+			err := appBefore(c)
+			if err != nil {
+				return err
+			}
+		}
+
+		switch format := c.String("log-format"); format {
+		case "text":
+		case "json":
+			log.SetFormatter(&log.JSONFormatter{TimestampFormat: time.RFC3339Nano})
+		default:
+			return fmt.Errorf("unknown log format: %s", format)
+		}
+
+		if path := c.String("log-file"); path != "" {
+			log.SetOutput(&rotatelog.File{
+				Path:       path,
+				MaxSize:    int64(c.Int("log-max-size")) * 1024 * 1024,
+				Interval:   c.Duration("log-rotate-interval"),
+				MaxBackups: c.Int("log-max-backups"),
+			})
+		}
+		return nil
+	}
+}
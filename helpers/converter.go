@@ -3,10 +3,13 @@ package helpers
 import (
 	"bufio"
 	"bytes"
+	"encoding/base64"
 	"github.com/BurntSushi/toml"
 	"gopkg.in/yaml.v2"
 )
 
+const base64LineLength = 76
+
 func ToYAML(src interface{}) string {
 	data, err := yaml.Marshal(src)
 	if err == nil {
@@ -15,6 +18,21 @@ func ToYAML(src interface{}) string {
 	return ""
 }
 
+// ToBase64Lines encodes the data with base64, in lines of 76 characters like
+// the base64 tool, so the scripts with CRLF, unicode or backticks survive the
+// shells and tools transferring them
+func ToBase64Lines(data []byte) []byte {
+	encoded := base64.StdEncoding.EncodeToString(data)
+
+	var buf bytes.Buffer
+	for len(encoded) > base64LineLength {
+		buf.WriteString(encoded[:base64LineLength] + "\n")
+		encoded = encoded[base64LineLength:]
+	}
+	buf.WriteString(encoded + "\n")
+	return buf.Bytes()
+}
+
 func ToTOML(src interface{}) string {
 	var data bytes.Buffer
 	buffer := bufio.NewWriter(&data)
@@ -1,10 +1,12 @@
 package helpers
 
 import (
+	"encoding/base64"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"gopkg.in/yaml.v2"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -100,3 +102,16 @@ test:
 	_, ok = GetMapKey(config1, "test", "undefined", "untracked")
 	assert.False(t, ok)
 }
+
+func TestToBase64Lines(t *testing.T) {
+	script := "echo `date`\r\necho héllo " + strings.Repeat("x", 100) + "\n"
+
+	encoded := ToBase64Lines([]byte(script))
+	lines := strings.Split(strings.TrimSuffix(string(encoded), "\n"), "\n")
+	assert.Len(t, lines, 3)
+	assert.Len(t, lines[0], base64LineLength)
+
+	decoded, err := base64.StdEncoding.DecodeString(strings.Join(lines, ""))
+	assert.NoError(t, err)
+	assert.Equal(t, script, string(decoded))
+}
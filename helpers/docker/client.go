@@ -13,6 +13,7 @@ type Client interface {
 	InspectContainer(id string) (*docker.Container, error)
 	AttachToContainerNonBlocking(opts docker.AttachToContainerOptions) (docker.CloseWaiter, error)
 	RemoveContainer(opts docker.RemoveContainerOptions) error
+	ConnectNetwork(id string, opts docker.NetworkConnectionOptions) error
 	DisconnectNetwork(id string, opts docker.NetworkConnectionOptions) error
 	ListNetworks() ([]docker.Network, error)
 	Logs(opts docker.LogsOptions) error
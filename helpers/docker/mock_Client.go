@@ -84,6 +84,13 @@ func (m *MockClient) RemoveContainer(opts docker.RemoveContainerOptions) error {
 
 	return r0
 }
+func (m *MockClient) ConnectNetwork(id string, opts docker.NetworkConnectionOptions) error {
+	ret := m.Called(id, opts)
+
+	r0 := ret.Error(0)
+
+	return r0
+}
 func (m *MockClient) DisconnectNetwork(id string, opts docker.NetworkConnectionOptions) error {
 	ret := m.Called(id, opts)
 
@@ -0,0 +1,132 @@
+package lxd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+type LaunchOptions struct {
+	Image     string
+	Profiles  []string
+	Config    map[string]string
+	Ephemeral bool
+}
+
+func LXCOutput(exe string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	log.Debugf("Executing LXCOutput: %#v", args)
+	cmd := exec.Command(exe, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+
+	stderrString := strings.TrimSpace(stderr.String())
+
+	if _, ok := err.(*exec.ExitError); ok {
+		err = fmt.Errorf("LXCOutput error: %s", stderrString)
+	}
+
+	return stdout.String(), err
+}
+
+func LXC(args ...string) (string, error) {
+	return LXCOutput("lxc", args...)
+}
+
+func Version() (string, error) {
+	version, err := LXC("--version")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(version), nil
+}
+
+func launchArgs(name string, options LaunchOptions) []string {
+	args := []string{"launch", options.Image, name}
+	if options.Ephemeral {
+		args = append(args, "--ephemeral")
+	}
+	for _, profile := range options.Profiles {
+		args = append(args, "--profile", profile)
+	}
+
+	// sort the keys to have the same command for the same options
+	keys := make([]string, 0, len(options.Config))
+	for key := range options.Config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		args = append(args, "--config", key+"="+options.Config[key])
+	}
+	return args
+}
+
+func Launch(name string, options LaunchOptions) error {
+	_, err := LXC(launchArgs(name, options)...)
+	return err
+}
+
+func Exist(name string) bool {
+	_, err := LXC("info", name)
+	if err != nil {
+		return false
+	}
+	return true
+}
+
+func Delete(name string) error {
+	_, err := LXC("delete", "--force", name)
+	return err
+}
+
+func PushFile(name string, source string, dest string, mode os.FileMode) error {
+	_, err := LXC("file", "push", "--create-dirs", fmt.Sprintf("--mode=%04o", mode), source, name+dest)
+	return err
+}
+
+// IPv4Address returns the first IPv4 address of the container, or an empty
+// string when the network of the container is not up yet
+func IPv4Address(name string) (string, error) {
+	output, err := LXC("list", "^"+name+"$", "--format=csv", "--columns=4")
+	if err != nil {
+		return "", err
+	}
+
+	// the output looks like `10.0.3.15 (eth0)`, quoted when the container
+	// has more addresses
+	fields := strings.Fields(strings.Trim(strings.TrimSpace(output), `"`))
+	if len(fields) == 0 {
+		return "", nil
+	}
+	return fields[0], nil
+}
+
+func WaitForNetwork(name string, seconds int) error {
+	for i := 0; i < seconds; i++ {
+		address, err := IPv4Address(name)
+		if err != nil {
+			return err
+		}
+		if address != "" {
+			return nil
+		}
+		time.Sleep(time.Second)
+	}
+	return errors.New("Container network didn't start in time")
+}
+
+// Command returns the command executing the given command in the container
+func Command(name string, command ...string) *exec.Cmd {
+	args := []string{"exec", name, "--"}
+	args = append(args, command...)
+	return exec.Command("lxc", args...)
+}
@@ -0,0 +1,30 @@
+package lxd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLaunchArgs(t *testing.T) {
+	args := launchArgs("runner-abcdef12", LaunchOptions{
+		Image:    "ubuntu:16.04",
+		Profiles: []string{"default", "ci"},
+		Config: map[string]string{
+			"limits.memory": "2GB",
+			"limits.cpu":    "2",
+		},
+		Ephemeral: true,
+	})
+
+	assert.Equal(t, []string{
+		"launch", "ubuntu:16.04", "runner-abcdef12", "--ephemeral",
+		"--profile", "default", "--profile", "ci",
+		"--config", "limits.cpu=2", "--config", "limits.memory=2GB",
+	}, args)
+}
+
+func TestCommand(t *testing.T) {
+	cmd := Command("runner-abcdef12", "bash", "--login")
+	assert.Equal(t, []string{"lxc", "exec", "runner-abcdef12", "--", "bash", "--login"}, cmd.Args)
+}
@@ -0,0 +1,81 @@
+package helpers
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"strings"
+)
+
+// MinMaskedLength is the length of the shortest secrets masked by the
+// MaskWriter, as the shorter ones would mask common words
+const MinMaskedLength = 8
+
+const maskedText = "[MASKED]"
+
+// MaskWriter replaces the secrets with [MASKED] in the output written to the
+// writer. The output is buffered by lines, so the secrets split between two
+// writes are masked too, and Close writes the last line.
+type MaskWriter struct {
+	writer  io.Writer
+	secrets [][]byte
+	buffer  []byte
+}
+
+func NewMaskWriter(writer io.Writer, secrets []string) *MaskWriter {
+	w := &MaskWriter{writer: writer}
+
+	// the lines of the multi-line secrets are masked one by one
+	var lines []string
+	for _, secret := range secrets {
+		for _, line := range strings.Split(secret, "\n") {
+			line = strings.TrimSuffix(line, "\r")
+			if len(line) >= MinMaskedLength {
+				lines = append(lines, line)
+			}
+		}
+	}
+
+	// the longest secrets first, in case a secret contains another one
+	sort.Sort(secretsByLength(lines))
+	for _, line := range lines {
+		w.secrets = append(w.secrets, []byte(line))
+	}
+	return w
+}
+
+type secretsByLength []string
+
+func (s secretsByLength) Len() int           { return len(s) }
+func (s secretsByLength) Less(i, j int) bool { return len(s[i]) > len(s[j]) }
+func (s secretsByLength) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+func (w *MaskWriter) Write(p []byte) (int, error) {
+	w.buffer = append(w.buffer, p...)
+
+	if end := bytes.LastIndexAny(w.buffer, "\r\n"); end >= 0 {
+		if err := w.flush(end + 1); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (w *MaskWriter) flush(length int) error {
+	data := w.buffer[:length]
+	for _, secret := range w.secrets {
+		data = bytes.Replace(data, secret, []byte(maskedText), -1)
+	}
+
+	w.buffer = append([]byte{}, w.buffer[length:]...)
+	_, err := w.writer.Write(data)
+	return err
+}
+
+// Close writes the output left in the buffer
+func (w *MaskWriter) Close() error {
+	if len(w.buffer) == 0 {
+		return nil
+	}
+	return w.flush(len(w.buffer))
+}
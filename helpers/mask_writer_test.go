@@ -0,0 +1,31 @@
+package helpers
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaskWriter(t *testing.T) {
+	output := new(bytes.Buffer)
+	w := NewMaskWriter(output, []string{"password123", "short", "line-one-secret\nline-two-secret"})
+
+	for _, data := range []string{"login with pass", "word123\n", "short\r\n", "line-one-secret and line-two-secret\n", "last password123"} {
+		_, err := w.Write([]byte(data))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, "login with [MASKED]\nshort\r\n[MASKED] and [MASKED]\n", output.String())
+
+	require.NoError(t, w.Close())
+	assert.Equal(t, "login with [MASKED]\nshort\r\n[MASKED] and [MASKED]\nlast [MASKED]", output.String())
+}
+
+func TestMaskWriterLongestSecretFirst(t *testing.T) {
+	output := new(bytes.Buffer)
+	w := NewMaskWriter(output, []string{"secret12", "secret1234"})
+
+	w.Write([]byte("secret1234\n"))
+	assert.Equal(t, "[MASKED]\n", output.String())
+}
@@ -0,0 +1,385 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+type Type string
+
+const (
+	// Strategic merges objects like the merge patch, but merges lists of
+	// objects identified by their merge key instead of replacing them
+	Strategic Type = "strategic"
+	// Merge is the JSON Merge Patch described by RFC 7386
+	Merge Type = "merge"
+	// JSON is the JSON Patch described by RFC 6902
+	JSON Type = "json"
+)
+
+const defaultMergeKey = "name"
+const patchDirective = "$patch"
+
+// mergeKeys are the keys identifying the items of the lists of the pod spec
+// which aren't identified by their name, like in the Kubernetes API
+var mergeKeys = map[string]string{
+	"volumeMounts":  "mountPath",
+	"volumeDevices": "devicePath",
+	"ports":         "containerPort",
+	"hostAliases":   "ip",
+}
+
+func mergeKeyOf(field string) string {
+	if key, ok := mergeKeys[field]; ok {
+		return key
+	}
+	return defaultMergeKey
+}
+
+// Apply applies the patch of given type to the JSON document
+func Apply(patchType Type, document, patch []byte) ([]byte, error) {
+	var doc interface{}
+	if err := json.Unmarshal(document, &doc); err != nil {
+		return nil, fmt.Errorf("invalid document: %v", err)
+	}
+
+	var err error
+	switch patchType {
+	case "", Strategic, Merge:
+		var p interface{}
+		if err = json.Unmarshal(patch, &p); err != nil {
+			return nil, fmt.Errorf("invalid patch: %v", err)
+		}
+		doc = mergePatch(doc, p, patchType != Merge, defaultMergeKey)
+
+	case JSON:
+		var operations []operation
+		if err = json.Unmarshal(patch, &operations); err != nil {
+			return nil, fmt.Errorf("invalid patch: %v", err)
+		}
+		for _, op := range operations {
+			if doc, err = op.apply(doc); err != nil {
+				return nil, err
+			}
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported patch type: %v", patchType)
+	}
+
+	return json.Marshal(doc)
+}
+
+func mergePatch(target, patch interface{}, strategic bool, mergeKey string) interface{} {
+	if strategic {
+		targetList, targetIsList := target.([]interface{})
+		patchList, patchIsList := patch.([]interface{})
+		if targetIsList && patchIsList && isMergeableList(targetList, mergeKey) && isMergeableList(patchList, mergeKey) {
+			return mergeLists(targetList, patchList, mergeKey)
+		}
+	}
+
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = make(map[string]interface{})
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = mergePatch(targetObject[key], value, strategic, mergeKeyOf(key))
+	}
+	return targetObject
+}
+
+func isMergeableList(list []interface{}, mergeKey string) bool {
+	for _, item := range list {
+		object, ok := item.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		switch object[mergeKey].(type) {
+		case string, float64:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func mergeLists(target, patch []interface{}, mergeKey string) []interface{} {
+	result := append([]interface{}{}, target...)
+
+	for _, item := range patch {
+		patchItem := item.(map[string]interface{})
+		name := patchItem[mergeKey]
+		remove := patchItem[patchDirective] == "delete"
+		delete(patchItem, patchDirective)
+
+		found := false
+		for i, current := range result {
+			if current.(map[string]interface{})[mergeKey] != name {
+				continue
+			}
+
+			found = true
+			if remove {
+				result = append(result[:i], result[i+1:]...)
+			} else {
+				result[i] = mergePatch(current, patchItem, true, mergeKey)
+			}
+			break
+		}
+
+		if !found && !remove {
+			result = append(result, patchItem)
+		}
+	}
+	return result
+}
+
+type operation struct {
+	Op    string           `json:"op"`
+	Path  string           `json:"path"`
+	From  string           `json:"from"`
+	Value *json.RawMessage `json:"value"`
+}
+
+func (o *operation) value() (value interface{}, err error) {
+	if o.Value == nil {
+		return nil, fmt.Errorf("%s operation on %q is missing value", o.Op, o.Path)
+	}
+	err = json.Unmarshal(*o.Value, &value)
+	return
+}
+
+func (o *operation) apply(doc interface{}) (interface{}, error) {
+	switch o.Op {
+	case "add":
+		value, err := o.value()
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, o.Path, value)
+
+	case "remove":
+		_, doc, err := remove(doc, o.Path)
+		return doc, err
+
+	case "replace":
+		value, err := o.value()
+		if err != nil {
+			return nil, err
+		}
+		if _, doc, err = remove(doc, o.Path); err != nil {
+			return nil, err
+		}
+		return add(doc, o.Path, value)
+
+	case "move":
+		value, doc, err := remove(doc, o.From)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, o.Path, value)
+
+	case "copy":
+		value, err := get(doc, o.From)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, o.Path, deepCopy(value))
+
+	case "test":
+		expected, err := o.value()
+		if err != nil {
+			return nil, err
+		}
+		value, err := get(doc, o.Path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(expected, value) {
+			return nil, fmt.Errorf("test operation on %q failed", o.Path)
+		}
+		return doc, nil
+	}
+
+	return nil, fmt.Errorf("unsupported operation: %q", o.Op)
+}
+
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid path: %q", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens, nil
+}
+
+func arrayIndex(token string, length int, appending bool) (int, error) {
+	if appending && token == "-" {
+		return length, nil
+	}
+
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || index > length || (!appending && index == length) {
+		return 0, fmt.Errorf("invalid array index: %q", token)
+	}
+	return index, nil
+}
+
+func child(doc interface{}, token string) (interface{}, error) {
+	switch container := doc.(type) {
+	case map[string]interface{}:
+		value, ok := container[token]
+		if !ok {
+			return nil, fmt.Errorf("missing key: %q", token)
+		}
+		return value, nil
+
+	case []interface{}:
+		index, err := arrayIndex(token, len(container), false)
+		if err != nil {
+			return nil, err
+		}
+		return container[index], nil
+	}
+
+	return nil, fmt.Errorf("can't get %q from scalar value", token)
+}
+
+func get(doc interface{}, pointer string) (interface{}, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, token := range tokens {
+		if doc, err = child(doc, token); err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+// update replaces the container holding the last token of the path with
+// the result of fn, rebuilding all the parents on the way
+func update(doc interface{}, tokens []string, fn func(container interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(tokens) == 1 {
+		return fn(doc, tokens[0])
+	}
+
+	value, err := child(doc, tokens[0])
+	if err != nil {
+		return nil, err
+	}
+
+	value, err = update(value, tokens[1:], fn)
+	if err != nil {
+		return nil, err
+	}
+
+	switch container := doc.(type) {
+	case map[string]interface{}:
+		container[tokens[0]] = value
+	case []interface{}:
+		index, _ := arrayIndex(tokens[0], len(container), false)
+		container[index] = value
+	}
+	return doc, nil
+}
+
+func add(doc interface{}, pointer string, value interface{}) (interface{}, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return value, nil
+	}
+
+	return update(doc, tokens, func(container interface{}, token string) (interface{}, error) {
+		switch container := container.(type) {
+		case map[string]interface{}:
+			container[token] = value
+			return container, nil
+
+		case []interface{}:
+			index, err := arrayIndex(token, len(container), true)
+			if err != nil {
+				return nil, err
+			}
+			container = append(container, nil)
+			copy(container[index+1:], container[index:])
+			container[index] = value
+			return container, nil
+		}
+
+		return nil, fmt.Errorf("can't add %q to scalar value", token)
+	})
+}
+
+func remove(doc interface{}, pointer string) (removed interface{}, result interface{}, err error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, nil, errors.New("can't remove the whole document")
+	}
+
+	result, err = update(doc, tokens, func(container interface{}, token string) (interface{}, error) {
+		if removed, err = child(container, token); err != nil {
+			return nil, err
+		}
+
+		switch container := container.(type) {
+		case map[string]interface{}:
+			delete(container, token)
+			return container, nil
+
+		case []interface{}:
+			index, _ := arrayIndex(token, len(container), false)
+			return append(container[:index], container[index+1:]...), nil
+		}
+		return container, nil
+	})
+	return
+}
+
+func deepCopy(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			result[key] = deepCopy(item)
+		}
+		return result
+
+	case []interface{}:
+		result := make([]interface{}, len(value))
+		for i, item := range value {
+			result[i] = deepCopy(item)
+		}
+		return result
+	}
+	return value
+}
@@ -0,0 +1,133 @@
+package patch
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const document = `{
+	"hostname": "build",
+	"containers": [
+		{"name": "build", "image": "ruby:2.3"},
+		{"name": "helper", "image": "helper:latest"}
+	],
+	"args": ["a", "b"]
+}`
+
+func assertJSON(t *testing.T, expected, actual string) {
+	var expectedValue, actualValue interface{}
+	require.NoError(t, json.Unmarshal([]byte(expected), &expectedValue))
+	require.NoError(t, json.Unmarshal([]byte(actual), &actualValue))
+	assert.Equal(t, expectedValue, actualValue)
+}
+
+func TestMergePatch(t *testing.T) {
+	result, err := Apply(Merge, []byte(document), []byte(`{
+		"hostname": null,
+		"schedulerName": "custom",
+		"containers": [{"name": "build", "image": "ruby:2.4"}]
+	}`))
+	require.NoError(t, err)
+	assertJSON(t, `{
+		"schedulerName": "custom",
+		"containers": [{"name": "build", "image": "ruby:2.4"}],
+		"args": ["a", "b"]
+	}`, string(result))
+}
+
+func TestStrategicMergePatch(t *testing.T) {
+	result, err := Apply(Strategic, []byte(document), []byte(`{
+		"containers": [
+			{"name": "build", "workingDir": "/builds"},
+			{"name": "helper", "$patch": "delete"},
+			{"name": "sidecar", "image": "alpine"}
+		],
+		"args": ["c"]
+	}`))
+	require.NoError(t, err)
+	assertJSON(t, `{
+		"hostname": "build",
+		"containers": [
+			{"name": "build", "image": "ruby:2.3", "workingDir": "/builds"},
+			{"name": "sidecar", "image": "alpine"}
+		],
+		"args": ["c"]
+	}`, string(result))
+}
+
+func TestStrategicMergePatchMergeKeys(t *testing.T) {
+	result, err := Apply(Strategic, []byte(`{
+		"containers": [{
+			"name": "build",
+			"volumeMounts": [{"name": "cache", "mountPath": "/cache"}],
+			"ports": [{"containerPort": 8080, "protocol": "TCP"}]
+		}],
+		"hostAliases": [{"ip": "10.0.0.1", "hostnames": ["gitlab"]}]
+	}`), []byte(`{
+		"containers": [{
+			"name": "build",
+			"volumeMounts": [{"name": "cache", "mountPath": "/cache2"}],
+			"ports": [{"containerPort": 8080, "name": "http"}]
+		}],
+		"hostAliases": [{"ip": "10.0.0.2", "hostnames": ["registry"]}]
+	}`))
+	require.NoError(t, err)
+	assertJSON(t, `{
+		"containers": [{
+			"name": "build",
+			"volumeMounts": [
+				{"name": "cache", "mountPath": "/cache"},
+				{"name": "cache", "mountPath": "/cache2"}
+			],
+			"ports": [{"containerPort": 8080, "protocol": "TCP", "name": "http"}]
+		}],
+		"hostAliases": [
+			{"ip": "10.0.0.1", "hostnames": ["gitlab"]},
+			{"ip": "10.0.0.2", "hostnames": ["registry"]}
+		]
+	}`, string(result))
+}
+
+func TestJSONPatch(t *testing.T) {
+	result, err := Apply(JSON, []byte(document), []byte(`[
+		{"op": "test", "path": "/containers/0/name", "value": "build"},
+		{"op": "replace", "path": "/containers/0/image", "value": "ruby:2.4"},
+		{"op": "add", "path": "/args/-", "value": "c"},
+		{"op": "add", "path": "/args/0", "value": "first"},
+		{"op": "remove", "path": "/containers/1"},
+		{"op": "copy", "from": "/hostname", "path": "/subdomain"},
+		{"op": "move", "from": "/hostname", "path": "/host~1name"}
+	]`))
+	require.NoError(t, err)
+	assertJSON(t, `{
+		"host/name": "build",
+		"subdomain": "build",
+		"containers": [{"name": "build", "image": "ruby:2.4"}],
+		"args": ["first", "a", "b", "c"]
+	}`, string(result))
+}
+
+func TestJSONPatchErrors(t *testing.T) {
+	tests := map[string]string{
+		"failed test":     `[{"op": "test", "path": "/hostname", "value": "other"}]`,
+		"missing key":     `[{"op": "remove", "path": "/missing"}]`,
+		"invalid index":   `[{"op": "replace", "path": "/args/5", "value": "c"}]`,
+		"invalid path":    `[{"op": "add", "path": "hostname", "value": "c"}]`,
+		"missing value":   `[{"op": "add", "path": "/hostname"}]`,
+		"invalid op":      `[{"op": "merge", "path": "/hostname"}]`,
+		"remove document": `[{"op": "remove", "path": ""}]`,
+	}
+
+	for name, patch := range tests {
+		_, err := Apply(JSON, []byte(document), []byte(patch))
+		assert.Error(t, err, name)
+	}
+}
+
+func TestUnsupportedPatchType(t *testing.T) {
+	_, err := Apply("unknown", []byte(document), []byte(`{}`))
+	assert.EqualError(t, err, "unsupported patch type: unknown")
+}
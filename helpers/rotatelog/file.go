@@ -0,0 +1,119 @@
+package rotatelog
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const backupTimeFormat = "20060102T150405.000"
+
+// File is a log file rotated when it reaches MaxSize bytes or when it's
+// older than Interval. The rotated files are renamed with the time of the
+// rotation, like runner.log.20170102T150405.000, and only the MaxBackups
+// newest of them are kept.
+type File struct {
+	Path       string
+	MaxSize    int64
+	Interval   time.Duration
+	MaxBackups int
+
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	lock     sync.Mutex
+}
+
+func (f *File) open() error {
+	file, err := os.OpenFile(f.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	f.file = file
+	f.size = stat.Size()
+	f.openedAt = time.Now()
+	return nil
+}
+
+func (f *File) needsRotation(size int) bool {
+	if f.MaxSize > 0 && f.size > 0 && f.size+int64(size) > f.MaxSize {
+		return true
+	}
+	return f.Interval > 0 && time.Since(f.openedAt) >= f.Interval
+}
+
+func (f *File) rotate() error {
+	f.file.Close()
+	f.file = nil
+
+	err := os.Rename(f.Path, f.Path+"."+time.Now().Format(backupTimeFormat))
+	if err != nil {
+		return err
+	}
+
+	f.removeOldBackups()
+	return f.open()
+}
+
+func (f *File) removeOldBackups() {
+	if f.MaxBackups <= 0 {
+		return
+	}
+
+	backups, err := filepath.Glob(f.Path + ".*")
+	if err != nil || len(backups) <= f.MaxBackups {
+		return
+	}
+
+	// the time of the rotation sorts the backups from the oldest
+	sort.Strings(backups)
+	for _, backup := range backups[:len(backups)-f.MaxBackups] {
+		os.Remove(backup)
+	}
+}
+
+// Write writes the entry to the file, rotated before when it's needed
+func (f *File) Write(p []byte) (int, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.file == nil {
+		err := f.open()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if f.needsRotation(len(p)) {
+		err := f.rotate()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *File) Close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
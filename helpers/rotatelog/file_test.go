@@ -0,0 +1,68 @@
+package rotatelog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotateOnSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotatelog")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "runner.log")
+	file := &File{Path: path, MaxSize: 10, MaxBackups: 2}
+	defer file.Close()
+
+	for _, entry := range []string{"entry 1\n", "entry 2\n", "entry 3\n", "entry 4\n"} {
+		_, err = file.Write([]byte(entry))
+		require.NoError(t, err)
+		// the backups are named after the time of the rotation
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "entry 4\n", string(data))
+
+	backups, err := filepath.Glob(path + ".*")
+	require.NoError(t, err)
+	require.Equal(t, 2, len(backups), "only the newest backups are kept")
+
+	data, err = ioutil.ReadFile(backups[1])
+	require.NoError(t, err)
+	assert.Equal(t, "entry 3\n", string(data))
+}
+
+func TestRotateOnInterval(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotatelog")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "runner.log")
+	file := &File{Path: path, Interval: time.Hour}
+	defer file.Close()
+
+	_, err = file.Write([]byte("entry 1\n"))
+	require.NoError(t, err)
+	_, err = file.Write([]byte("entry 2\n"))
+	require.NoError(t, err)
+
+	file.openedAt = time.Now().Add(-time.Hour)
+	_, err = file.Write([]byte("entry 3\n"))
+	require.NoError(t, err)
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "entry 3\n", string(data))
+
+	backups, err := filepath.Glob(path + ".*")
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(backups))
+}
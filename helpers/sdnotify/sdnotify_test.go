@@ -0,0 +1,80 @@
+package sdnotify
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func withEnv(variables map[string]string, f func()) {
+	saved := map[string]string{}
+	for key, value := range variables {
+		saved[key] = os.Getenv(key)
+		os.Setenv(key, value)
+	}
+	defer func() {
+		for key, value := range saved {
+			os.Setenv(key, value)
+		}
+	}()
+	f()
+}
+
+func TestNotify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sdnotify")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	withEnv(map[string]string{"NOTIFY_SOCKET": socket}, func() {
+		sent, err := Notify("READY=1\nSTATUS=Running")
+		require.NoError(t, err)
+		assert.True(t, sent)
+	})
+
+	buffer := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buffer)
+	require.NoError(t, err)
+	assert.Equal(t, "READY=1\nSTATUS=Running", string(buffer[:n]))
+}
+
+func TestNotifyWithoutSocket(t *testing.T) {
+	withEnv(map[string]string{"NOTIFY_SOCKET": ""}, func() {
+		sent, err := Notify("READY=1")
+		assert.NoError(t, err)
+		assert.False(t, sent)
+	})
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	pid := strconv.Itoa(os.Getpid())
+
+	examples := []struct {
+		usec, pid string
+		interval  time.Duration
+	}{
+		{"", "", 0},
+		{"invalid", "", 0},
+		{"20000000", "", 10 * time.Second},
+		{"20000000", pid, 10 * time.Second},
+		{"20000000", "1", 0},
+	}
+
+	for _, example := range examples {
+		withEnv(map[string]string{"WATCHDOG_USEC": example.usec, "WATCHDOG_PID": example.pid}, func() {
+			assert.Equal(t, example.interval, WatchdogInterval(), example)
+		})
+	}
+}
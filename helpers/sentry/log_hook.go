@@ -14,6 +14,9 @@ import (
 
 type LogHook struct {
 	client *raven.Client
+	// runners are the clients of the runners with their own DSN, by the
+	// short token of the runner
+	runners map[string]*raven.Client
 }
 
 func (s *LogHook) Levels() []logrus.Level {
@@ -24,8 +27,18 @@ func (s *LogHook) Levels() []logrus.Level {
 	}
 }
 
+// clientFor returns the client of the runner of the entry, or the client of
+// the hook when the runner doesn't have its own DSN
+func (s *LogHook) clientFor(entry *logrus.Entry) *raven.Client {
+	if runner, ok := entry.Data["runner"].(string); ok && s.runners[runner] != nil {
+		return s.runners[runner]
+	}
+	return s.client
+}
+
 func (s *LogHook) Fire(entry *logrus.Entry) error {
-	if s.client == nil {
+	client := s.clientFor(entry)
+	if client == nil {
 		return nil
 	}
 
@@ -36,18 +49,38 @@ func (s *LogHook) Fire(entry *logrus.Entry) error {
 
 	switch entry.Level {
 	case logrus.PanicLevel:
-		s.client.CaptureErrorAndWait(errors.New(entry.Message), tags)
+		client.CaptureErrorAndWait(errors.New(entry.Message), tags)
 
 	case logrus.FatalLevel:
-		s.client.CaptureErrorAndWait(errors.New(entry.Message), tags)
+		client.CaptureErrorAndWait(errors.New(entry.Message), tags)
 
 	case logrus.ErrorLevel:
-		s.client.CaptureError(errors.New(entry.Message), tags)
+		client.CaptureError(errors.New(entry.Message), tags)
+	}
+	return nil
+}
+
+// AddRunner reports the errors of the runner, like the failures of its jobs
+// and of its requests to GitLab, to its own DSN
+func (s *LogHook) AddRunner(runner, dsn string) error {
+	client, err := newClient(dsn)
+	if err != nil {
+		return err
 	}
+
+	if s.runners == nil {
+		s.runners = make(map[string]*raven.Client)
+	}
+	s.runners[runner] = client
 	return nil
 }
 
 func NewLogHook(dsn string) (lh LogHook, err error) {
+	lh.client, err = newClient(dsn)
+	return
+}
+
+func newClient(dsn string) (*raven.Client, error) {
 	tags := make(map[string]string)
 	tags["built"] = common.BUILT
 	tags["version"] = common.VERSION
@@ -57,10 +90,5 @@ func NewLogHook(dsn string) (lh LogHook, err error) {
 	tags["go-os"] = runtime.GOOS
 	tags["go-arch"] = runtime.GOARCH
 	tags["hostname"], _ = os.Hostname()
-	client, err := raven.NewWithTags(dsn, tags)
-	if err != nil {
-		return
-	}
-	lh.client = client
-	return
+	return raven.NewWithTags(dsn, tags)
 }
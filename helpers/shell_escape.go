@@ -140,3 +140,27 @@ func ToBackslash(path string) string {
 func ToSlash(path string) string {
 	return strings.Replace(path, "\\", "/", -1)
 }
+
+// IsUNCPath checks if the path is a UNC one, like \\server\share\builds or
+// //server/share/builds
+func IsUNCPath(path string) bool {
+	path = ToBackslash(path)
+	return strings.HasPrefix(path, `\\`) && !strings.HasPrefix(path, `\\?\`)
+}
+
+// ToExtendedLengthPath returns the extended-length form of the absolute
+// Windows path, which is not limited to 260 characters, like \\?\C:\builds
+// or \\?\UNC\server\share\builds. The other paths are returned with
+// backslashes.
+func ToExtendedLengthPath(path string) string {
+	path = ToBackslash(path)
+	switch {
+	case strings.HasPrefix(path, `\\?\`):
+		return path
+	case IsUNCPath(path):
+		return `\\?\UNC\` + path[2:]
+	case len(path) >= 3 && path[1] == ':' && path[2] == '\\':
+		return `\\?\` + path
+	}
+	return path
+}
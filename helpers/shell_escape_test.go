@@ -54,3 +54,28 @@ func TestToSlash(t *testing.T) {
 		t.Error("Expected", expected, ", got ", result)
 	}
 }
+
+func TestIsUNCPath(t *testing.T) {
+	assert.True(t, IsUNCPath(`\\server\share\builds`))
+	assert.True(t, IsUNCPath("//server/share/builds"))
+	assert.False(t, IsUNCPath(`\\?\C:\builds`))
+	assert.False(t, IsUNCPath(`C:\builds`))
+	assert.False(t, IsUNCPath("/builds"))
+}
+
+func TestToExtendedLengthPath(t *testing.T) {
+	tests := map[string]string{
+		`C:\builds\project`:     `\\?\C:\builds\project`,
+		"C:/builds/project":     `\\?\C:\builds\project`,
+		`\\server\share\builds`: `\\?\UNC\server\share\builds`,
+		"//server/share/builds": `\\?\UNC\server\share\builds`,
+		`\\?\C:\builds`:         `\\?\C:\builds`,
+		`\\?\UNC\server\share`:  `\\?\UNC\server\share`,
+		"builds/project":        `builds\project`,
+		`%CD%\builds`:           `%CD%\builds`,
+	}
+
+	for path, expected := range tests {
+		assert.Equal(t, expected, ToExtendedLengthPath(path), path)
+	}
+}
@@ -0,0 +1,164 @@
+package ssh
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// messages of the ssh-agent protocol, as described in
+// https://tools.ietf.org/html/draft-miller-ssh-agent
+const (
+	agentFailure            = 5
+	agentRequestIdentities  = 11
+	agentIdentitiesAnswer   = 12
+	agentSignRequest        = 13
+	agentSignResponse       = 14
+	agentMaxMessageLength   = 256 * 1024
+	agentSocketEnvVariable  = "SSH_AUTH_SOCK"
+	agentErrorMessagePrefix = "ssh-agent"
+)
+
+// agentClient talks to the ssh-agent, which keeps the keys, including the
+// hardware-backed ones, so the runner never reads them
+type agentClient struct {
+	conn io.ReadWriter
+	lock sync.Mutex
+}
+
+func dialAgent() (*agentClient, net.Conn, error) {
+	socket := os.Getenv(agentSocketEnvVariable)
+	if socket == "" {
+		return nil, nil, fmt.Errorf("%s: %s is not set", agentErrorMessagePrefix, agentSocketEnvVariable)
+	}
+
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", agentErrorMessagePrefix, err)
+	}
+	return &agentClient{conn: conn}, conn, nil
+}
+
+func (c *agentClient) call(request []byte) ([]byte, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	message := make([]byte, 4+len(request))
+	binary.BigEndian.PutUint32(message, uint32(len(request)))
+	copy(message[4:], request)
+	if _, err := c.conn.Write(message); err != nil {
+		return nil, err
+	}
+
+	var length [4]byte
+	if _, err := io.ReadFull(c.conn, length[:]); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(length[:])
+	if size == 0 || size > agentMaxMessageLength {
+		return nil, fmt.Errorf("%s: invalid response length %d", agentErrorMessagePrefix, size)
+	}
+
+	response := make([]byte, size)
+	if _, err := io.ReadFull(c.conn, response); err != nil {
+		return nil, err
+	}
+	if response[0] == agentFailure {
+		return nil, fmt.Errorf("%s: request failed", agentErrorMessagePrefix)
+	}
+	return response, nil
+}
+
+func appendString(buf []byte, s []byte) []byte {
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(s)))
+	return append(append(buf, length[:]...), s...)
+}
+
+func readString(buf []byte) ([]byte, []byte, error) {
+	if len(buf) < 4 {
+		return nil, nil, errors.New("short read")
+	}
+	length := binary.BigEndian.Uint32(buf)
+	if uint32(len(buf)-4) < length {
+		return nil, nil, errors.New("short read")
+	}
+	return buf[4 : 4+length], buf[4+length:], nil
+}
+
+// Signers returns a signer for every key of the agent
+func (c *agentClient) Signers() ([]ssh.Signer, error) {
+	response, err := c.call([]byte{agentRequestIdentities})
+	if err != nil {
+		return nil, err
+	}
+	if response[0] != agentIdentitiesAnswer || len(response) < 5 {
+		return nil, fmt.Errorf("%s: unexpected response %d", agentErrorMessagePrefix, response[0])
+	}
+
+	count := binary.BigEndian.Uint32(response[1:])
+	rest := response[5:]
+
+	var signers []ssh.Signer
+	for i := uint32(0); i < count; i++ {
+		var blob []byte
+		blob, rest, err = readString(rest)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", agentErrorMessagePrefix, err)
+		}
+		// the comment of the key
+		_, rest, err = readString(rest)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", agentErrorMessagePrefix, err)
+		}
+
+		key, err := ssh.ParsePublicKey(blob)
+		if err != nil {
+			// skip the keys of types unknown to the SSH client
+			continue
+		}
+		signers = append(signers, &agentSigner{agent: c, key: key})
+	}
+	return signers, nil
+}
+
+type agentSigner struct {
+	agent *agentClient
+	key   ssh.PublicKey
+}
+
+func (s *agentSigner) PublicKey() ssh.PublicKey {
+	return s.key
+}
+
+func (s *agentSigner) Sign(rand io.Reader, data []byte) (*ssh.Signature, error) {
+	request := []byte{agentSignRequest}
+	request = appendString(request, s.key.Marshal())
+	request = appendString(request, data)
+	request = append(request, 0, 0, 0, 0)
+
+	response, err := s.agent.call(request)
+	if err != nil {
+		return nil, err
+	}
+	if response[0] != agentSignResponse {
+		return nil, fmt.Errorf("%s: unexpected response %d", agentErrorMessagePrefix, response[0])
+	}
+
+	blob, _, err := readString(response[1:])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", agentErrorMessagePrefix, err)
+	}
+
+	var signature ssh.Signature
+	if err = ssh.Unmarshal(blob, &signature); err != nil {
+		return nil, fmt.Errorf("%s: %v", agentErrorMessagePrefix, err)
+	}
+	return &signature, nil
+}
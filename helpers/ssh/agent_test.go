@@ -0,0 +1,95 @@
+package ssh
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// serveTestAgent answers the requests of the agent client with the signer
+func serveTestAgent(conn net.Conn, signer ssh.Signer) {
+	defer conn.Close()
+
+	for {
+		var length [4]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return
+		}
+		request := make([]byte, binary.BigEndian.Uint32(length[:]))
+		if _, err := io.ReadFull(conn, request); err != nil {
+			return
+		}
+
+		var response []byte
+		switch request[0] {
+		case agentRequestIdentities:
+			response = []byte{agentIdentitiesAnswer, 0, 0, 0, 1}
+			response = appendString(response, signer.PublicKey().Marshal())
+			response = appendString(response, []byte("test key"))
+		case agentSignRequest:
+			_, rest, _ := readString(request[1:])
+			data, _, _ := readString(rest)
+			signature, err := signer.Sign(rand.Reader, data)
+			if err != nil {
+				response = []byte{agentFailure}
+				break
+			}
+			response = appendString([]byte{agentSignResponse}, ssh.Marshal(signature))
+		default:
+			response = []byte{agentFailure}
+		}
+
+		binary.BigEndian.PutUint32(length[:], uint32(len(response)))
+		conn.Write(append(length[:], response...))
+	}
+}
+
+func TestAgentSigners(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+
+	client, server := net.Pipe()
+	defer client.Close()
+	go serveTestAgent(server, signer)
+
+	agent := &agentClient{conn: client}
+	signers, err := agent.Signers()
+	require.NoError(t, err)
+	require.Equal(t, 1, len(signers))
+	assert.Equal(t, signer.PublicKey().Marshal(), signers[0].PublicKey().Marshal())
+
+	data := []byte("session data")
+	signature, err := signers[0].Sign(rand.Reader, data)
+	require.NoError(t, err)
+	assert.NoError(t, signer.PublicKey().Verify(data, signature))
+}
+
+func TestAgentFailure(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	go serveTestAgent(server, nil)
+
+	agent := &agentClient{conn: client}
+	_, err := agent.call([]byte{agentFailure})
+	assert.EqualError(t, err, "ssh-agent: request failed")
+}
+
+func TestDialAgentWithoutSocket(t *testing.T) {
+	socket := os.Getenv(agentSocketEnvVariable)
+	os.Unsetenv(agentSocketEnvVariable)
+	defer os.Setenv(agentSocketEnvVariable, socket)
+
+	_, _, err := dialAgent()
+	assert.EqualError(t, err, "ssh-agent: SSH_AUTH_SOCK is not set")
+}
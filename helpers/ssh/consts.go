@@ -1,3 +1,5 @@
 package ssh
 
 const sshRetryInterval = 3
+
+const base64DecodeCommand = "base64 -d"
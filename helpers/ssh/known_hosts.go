@@ -0,0 +1,178 @@
+package ssh
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+type knownHost struct {
+	marker   string
+	patterns []string
+	key      ssh.PublicKey
+}
+
+type knownHosts []knownHost
+
+func loadKnownHosts(file string) (knownHosts, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var hosts knownHosts
+	for len(data) > 0 {
+		marker, patterns, key, _, rest, err := ssh.ParseKnownHosts(data)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		hosts = append(hosts, knownHost{marker: marker, patterns: patterns, key: key})
+		data = rest
+	}
+	return hosts, nil
+}
+
+// knownHostsAddress returns the address as written in known_hosts files,
+// where the port is given only when it's not the default one
+func knownHostsAddress(address string) string {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return address
+	}
+	if port == "22" {
+		return host
+	}
+	return "[" + host + "]:" + port
+}
+
+// matchHashedHost matches the address to a hashed entry, like
+// |1|base64(salt)|base64(hmac-sha1(salt, address))
+func matchHashedHost(pattern string, address string) bool {
+	parts := strings.Split(pattern, "|")
+	if len(parts) != 4 || parts[1] != "1" {
+		return false
+	}
+
+	salt, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	hash, err := base64.StdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte(address))
+	return hmac.Equal(mac.Sum(nil), hash)
+}
+
+// matchPattern matches the address to the pattern with the * and ?
+// wildcards. path.Match can't be used, as the brackets of the addresses
+// with ports are not character classes.
+func matchPattern(pattern string, address string) bool {
+	if pattern == "" {
+		return address == ""
+	}
+
+	switch pattern[0] {
+	case '*':
+		for i := 0; i <= len(address); i++ {
+			if matchPattern(pattern[1:], address[i:]) {
+				return true
+			}
+		}
+		return false
+	case '?':
+		return address != "" && matchPattern(pattern[1:], address[1:])
+	default:
+		return address != "" && pattern[0] == address[0] && matchPattern(pattern[1:], address[1:])
+	}
+}
+
+// matchHost matches the address to the patterns of an entry, which can use
+// the * and ? wildcards and be negated with !
+func (h *knownHost) matchHost(address string) bool {
+	matched := false
+	for _, pattern := range h.patterns {
+		if strings.HasPrefix(pattern, "|") {
+			if matchHashedHost(pattern, address) {
+				matched = true
+			}
+			continue
+		}
+
+		negated := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(pattern, "!")
+
+		if !matchPattern(pattern, address) {
+			continue
+		}
+		if negated {
+			return false
+		}
+		matched = true
+	}
+	return matched
+}
+
+// hostKeyAlgorithms returns the types of the keys known for the address, so
+// the server offers one of them, or nil when no key is known
+func (k knownHosts) hostKeyAlgorithms(hostname string) (algorithms []string) {
+	address := knownHostsAddress(hostname)
+	known := make(map[string]bool)
+	for _, host := range k {
+		if host.marker != "" || !host.matchHost(address) || known[host.key.Type()] {
+			continue
+		}
+		known[host.key.Type()] = true
+		algorithms = append(algorithms, host.key.Type())
+	}
+	return
+}
+
+// HostKeyCallback verifies the host key of the address against the
+// entries, failing for unknown hosts too
+func (k knownHosts) HostKeyCallback(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	address := knownHostsAddress(hostname)
+	marshaledKey := key.Marshal()
+
+	trusted, found := false, false
+	for _, host := range k {
+		if !host.matchHost(address) {
+			continue
+		}
+
+		sameKey := bytes.Equal(host.key.Marshal(), marshaledKey)
+		switch host.marker {
+		case "revoked":
+			if sameKey {
+				return fmt.Errorf("host key of %s is revoked", address)
+			}
+		case "":
+			if sameKey {
+				trusted = true
+			} else if host.key.Type() == key.Type() {
+				found = true
+			}
+		}
+	}
+
+	if trusted {
+		return nil
+	}
+	if found {
+		return fmt.Errorf("host key mismatch for %s, it may be a man-in-the-middle attack", address)
+	}
+	return fmt.Errorf("no %s host key for %s in known hosts", key.Type(), address)
+}
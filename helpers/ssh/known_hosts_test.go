@@ -0,0 +1,131 @@
+package ssh
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func newTestPublicKey(t *testing.T) ssh.PublicKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	publicKey, err := ssh.NewPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	return publicKey
+}
+
+func hashHost(address string) string {
+	salt := []byte("0123456789abcdefghij")
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte(address))
+	return "|1|" + base64.StdEncoding.EncodeToString(salt) + "|" + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func writeKnownHosts(t *testing.T, lines ...string) knownHosts {
+	file, err := ioutil.TempFile("", "known_hosts")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+
+	for _, line := range lines {
+		file.WriteString(line + "\n")
+	}
+	file.Close()
+
+	hosts, err := loadKnownHosts(file.Name())
+	require.NoError(t, err)
+	return hosts
+}
+
+func knownHostsLine(patterns string, key ssh.PublicKey) string {
+	return patterns + " " + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+}
+
+func TestKnownHostsAddress(t *testing.T) {
+	assert.Equal(t, "example.com", knownHostsAddress("example.com:22"))
+	assert.Equal(t, "[example.com]:2222", knownHostsAddress("example.com:2222"))
+	assert.Equal(t, "[fe80::1]:2222", knownHostsAddress("[fe80::1]:2222"))
+}
+
+func TestKnownHostsHostKeyCallback(t *testing.T) {
+	key := newTestPublicKey(t)
+	otherKey := newTestPublicKey(t)
+	revokedKey := newTestPublicKey(t)
+
+	hosts := writeKnownHosts(t,
+		"# comment",
+		knownHostsLine("example.com,10.0.0.5", key),
+		knownHostsLine("[example.com]:2222", key),
+		knownHostsLine(hashHost("hashed.example.com"), key),
+		knownHostsLine("*.example.org,!bad.example.org", key),
+		knownHostsLine("@revoked *", revokedKey),
+	)
+
+	tests := map[string]struct {
+		address string
+		key     ssh.PublicKey
+		err     string
+	}{
+		"plain host":       {address: "example.com:22", key: key},
+		"address":          {address: "10.0.0.5:22", key: key},
+		"host with port":   {address: "example.com:2222", key: key},
+		"hashed host":      {address: "hashed.example.com:22", key: key},
+		"wildcard":         {address: "ci.example.org:22", key: key},
+		"negated wildcard": {address: "bad.example.org:22", key: key, err: "no ecdsa-sha2-nistp256 host key for bad.example.org in known hosts"},
+		"unknown port":     {address: "example.com:2200", key: key, err: "no ecdsa-sha2-nistp256 host key for [example.com]:2200 in known hosts"},
+		"unknown host":     {address: "unknown.example.com:22", key: key, err: "no ecdsa-sha2-nistp256 host key for unknown.example.com in known hosts"},
+		"key mismatch":     {address: "example.com:22", key: otherKey, err: "host key mismatch for example.com, it may be a man-in-the-middle attack"},
+		"revoked key":      {address: "example.com:22", key: revokedKey, err: "host key of example.com is revoked"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := hosts.HostKeyCallback(test.address, nil, test.key)
+			if test.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, test.err)
+			}
+		})
+	}
+}
+
+func TestKnownHostsHostKeyAlgorithms(t *testing.T) {
+	key := newTestPublicKey(t)
+
+	hosts := writeKnownHosts(t,
+		knownHostsLine("example.com", key),
+		knownHostsLine("*.com", key),
+		knownHostsLine("@revoked *", newTestPublicKey(t)),
+	)
+	assert.Equal(t, []string{"ecdsa-sha2-nistp256"}, hosts.hostKeyAlgorithms("example.com:22"))
+	assert.Nil(t, hosts.hostKeyAlgorithms("example.org:22"))
+}
+
+func TestEmptyKnownHostsRejectHosts(t *testing.T) {
+	c := &Client{
+		Config:     Config{KnownHosts: "/etc/gitlab-runner/known_hosts"},
+		knownHosts: writeKnownHosts(t, "# no hosts yet"),
+	}
+
+	hop, err := c.newHop("root", "password", "example.com", "22", "")
+	require.NoError(t, err)
+	require.NotNil(t, hop.config.HostKeyCallback, "the unknown hosts are rejected")
+	err = hop.config.HostKeyCallback("example.com:22", nil, newTestPublicKey(t))
+	assert.EqualError(t, err, "no ecdsa-sha2-nistp256 host key for example.com in known hosts")
+}
+
+func TestLoadKnownHostsMissingFile(t *testing.T) {
+	_, err := loadKnownHosts("/nonexistent/known_hosts")
+	assert.Error(t, err)
+}
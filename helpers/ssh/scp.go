@@ -0,0 +1,109 @@
+package ssh
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers"
+)
+
+// The files are transferred with the SCP protocol, which sends them as is,
+// so binaries and large archives don't go through the remote shell
+
+func readSCPAck(r *bufio.Reader) error {
+	code, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	if code == 0 {
+		return nil
+	}
+
+	// the remote scp prefixes its messages with "scp:"
+	message, _ := r.ReadString('\n')
+	return errors.New(strings.TrimSpace(message))
+}
+
+// scpSend sends the file to the remote scp running in sink mode (scp -t)
+func scpSend(w io.Writer, r *bufio.Reader, content io.Reader, size int64, mode os.FileMode, name string) error {
+	if err := readSCPAck(r); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(w, "C%04o %d %s\n", mode.Perm(), size, name)
+	if err != nil {
+		return err
+	}
+	if err = readSCPAck(r); err != nil {
+		return err
+	}
+
+	n, err := io.CopyN(w, content, size)
+	if err != nil {
+		return fmt.Errorf("scp: sent %d of %d bytes: %v", n, size, err)
+	}
+	if _, err = w.Write([]byte{0}); err != nil {
+		return err
+	}
+	return readSCPAck(r)
+}
+
+func (s *Client) scp(command string, transfer func(w io.Writer, r *bufio.Reader) error) error {
+	if s.client == nil {
+		return errors.New("Not connected")
+	}
+
+	session, err := s.client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	err = session.Start(command)
+	if err != nil {
+		return err
+	}
+
+	err = transfer(stdin, bufio.NewReader(stdout))
+	stdin.Close()
+	if err != nil {
+		return err
+	}
+	return session.Wait()
+}
+
+// Upload writes the content to the remote path
+func (s *Client) Upload(content io.Reader, size int64, mode os.FileMode, remotePath string) error {
+	return s.scp("scp -qt "+helpers.ShellEscape(remotePath), func(w io.Writer, r *bufio.Reader) error {
+		return scpSend(w, r, content, size, mode, path.Base(remotePath))
+	})
+}
+
+// UploadFile copies the local file to the remote path
+func (s *Client) UploadFile(localPath string, remotePath string, mode os.FileMode) error {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	return s.Upload(file, info.Size(), mode, remotePath)
+}
@@ -0,0 +1,41 @@
+package ssh
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSCPSend(t *testing.T) {
+	var sent bytes.Buffer
+	acks := bufio.NewReader(strings.NewReader("\x00\x00\x00"))
+
+	err := scpSend(&sent, acks, strings.NewReader("binary\x00data"), 11, 0755, "gitlab-runner")
+	require.NoError(t, err)
+	assert.Equal(t, "C0755 11 gitlab-runner\nbinary\x00data\x00", sent.String())
+}
+
+func TestSCPSendError(t *testing.T) {
+	var sent bytes.Buffer
+	acks := bufio.NewReader(strings.NewReader("\x00\x01scp: /root/.gitlab-runner/script: Permission denied\n"))
+
+	err := scpSend(&sent, acks, strings.NewReader("script"), 6, 0600, "script")
+	assert.EqualError(t, err, "scp: /root/.gitlab-runner/script: Permission denied")
+}
+
+func TestSCPSendShortContent(t *testing.T) {
+	var sent bytes.Buffer
+	acks := bufio.NewReader(strings.NewReader("\x00\x00"))
+
+	err := scpSend(&sent, acks, strings.NewReader("short"), 10, 0600, "script")
+	assert.Error(t, err)
+}
+
+func TestSCPNotConnected(t *testing.T) {
+	s := &Client{}
+	assert.EqualError(t, s.Upload(strings.NewReader(""), 0, 0600, "file"), "Not connected")
+}
@@ -3,8 +3,10 @@ package ssh
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"strings"
 	"time"
 
@@ -20,7 +22,15 @@ type Client struct {
 	Stderr         io.Writer
 	ConnectRetries int
 
-	client *ssh.Client
+	client      *ssh.Client
+	jumpClients []*ssh.Client
+	agent       *agentClient
+	agentConn   net.Conn
+	knownHosts  knownHosts
+
+	// stdinScripts is set when a script couldn't be uploaded, the next ones
+	// are written to the stdin of the commands
+	stdinScripts bool
 }
 
 type Command struct {
@@ -28,6 +38,19 @@ type Command struct {
 	Command     []string
 	Stdin       string
 	Abort       chan interface{}
+
+	// ScriptFile is the remote path the environment and the stdin are
+	// uploaded to, instead of being written to the stdin of the command.
+	// The file is removed when the command finishes. The script is written
+	// to the stdin when it can't be uploaded, like on the hosts without scp.
+	ScriptFile string
+}
+
+// ScriptFile returns the path of the script file of the build, relative to
+// the home directory of the user, used by the executors which don't manage
+// a directory for the scripts on the host
+func ScriptFile(buildID int) string {
+	return fmt.Sprintf(".gitlab-runner-script-%d", buildID)
 }
 
 type ExitError struct {
@@ -50,21 +73,124 @@ func (s *Client) getSSHKey(identityFile string) (key ssh.Signer, err error) {
 	return key, err
 }
 
-func (s *Client) getSSHAuthMethods() ([]ssh.AuthMethod, error) {
+func (s *Client) getSSHAuthMethods(password string, identityFile string) ([]ssh.AuthMethod, error) {
 	var methods []ssh.AuthMethod
-	methods = append(methods, ssh.Password(s.Password))
+	methods = append(methods, ssh.Password(password))
 
-	if s.IdentityFile != "" {
-		key, err := s.getSSHKey(s.IdentityFile)
+	if identityFile != "" {
+		key, err := s.getSSHKey(identityFile)
 		if err != nil {
 			return nil, err
 		}
 		methods = append(methods, ssh.PublicKeys(key))
 	}
 
+	if s.agent != nil {
+		methods = append(methods, ssh.PublicKeysCallback(s.agent.Signers))
+	}
+
 	return methods, nil
 }
 
+// hop is one of the hosts the connection goes through
+type hop struct {
+	address string
+	config  *ssh.ClientConfig
+}
+
+func (s *Client) newHop(user, password, host, port, identityFile string) (hop, error) {
+	if user == "" {
+		user = "root"
+	}
+	if port == "" {
+		port = "22"
+	}
+
+	methods, err := s.getSSHAuthMethods(password, identityFile)
+	if err != nil {
+		return hop{}, err
+	}
+
+	address := net.JoinHostPort(host, port)
+	config := &ssh.ClientConfig{
+		User: user,
+		Auth: methods,
+	}
+	// without the callback any host key is accepted, so it's set also when
+	// the file has no entries, to reject the unknown hosts
+	if s.KnownHosts != "" {
+		config.HostKeyCallback = s.knownHosts.HostKeyCallback
+		config.HostKeyAlgorithms = s.knownHosts.hostKeyAlgorithms(address)
+	}
+
+	return hop{
+		address: address,
+		config:  config,
+	}, nil
+}
+
+// getHops returns the jump hosts, in order, followed by the remote host
+func (s *Client) getHops() ([]hop, error) {
+	var hops []hop
+	for _, jumpHost := range s.JumpHosts {
+		if jumpHost.Host == "" {
+			return nil, errors.New("Missing host of jump host")
+		}
+
+		h, err := s.newHop(jumpHost.User, jumpHost.Password, jumpHost.Host, jumpHost.Port, jumpHost.IdentityFile)
+		if err != nil {
+			return nil, err
+		}
+		hops = append(hops, h)
+	}
+
+	h, err := s.newHop(s.User, s.Password, s.Host, s.Port, s.IdentityFile)
+	if err != nil {
+		return nil, err
+	}
+	return append(hops, h), nil
+}
+
+// dial connects to the first hop, and through every hop to the next one.
+// It returns the client of the last hop, and the clients of the jump hosts.
+func dial(hops []hop) (*ssh.Client, []*ssh.Client, error) {
+	var clients []*ssh.Client
+	closeClients := func() {
+		for i := len(clients) - 1; i >= 0; i-- {
+			clients[i].Close()
+		}
+	}
+
+	for _, h := range hops {
+		var client *ssh.Client
+		if len(clients) == 0 {
+			var err error
+			client, err = ssh.Dial("tcp", h.address, h.config)
+			if err != nil {
+				return nil, nil, err
+			}
+		} else {
+			conn, err := clients[len(clients)-1].Dial("tcp", h.address)
+			if err != nil {
+				closeClients()
+				return nil, nil, fmt.Errorf("failed to connect to %s through jump host: %v", h.address, err)
+			}
+
+			c, chans, reqs, err := ssh.NewClientConn(conn, h.address, h.config)
+			if err != nil {
+				conn.Close()
+				closeClients()
+				return nil, nil, fmt.Errorf("failed to connect to %s through jump host: %v", h.address, err)
+			}
+			client = ssh.NewClient(c, chans, reqs)
+		}
+		clients = append(clients, client)
+	}
+
+	last := len(clients) - 1
+	return clients[last], clients[:last], nil
+}
+
 func (s *Client) Connect() error {
 	if s.Host == "" {
 		s.Host = "localhost"
@@ -76,14 +202,25 @@ func (s *Client) Connect() error {
 		s.Port = "22"
 	}
 
-	methods, err := s.getSSHAuthMethods()
-	if err != nil {
-		return err
+	if s.KnownHosts != "" {
+		knownHosts, err := loadKnownHosts(s.KnownHosts)
+		if err != nil {
+			return err
+		}
+		s.knownHosts = knownHosts
 	}
 
-	config := &ssh.ClientConfig{
-		User: s.User,
-		Auth: methods,
+	if s.UseAgent && s.agent == nil {
+		agent, conn, err := dialAgent()
+		if err != nil {
+			return err
+		}
+		s.agent, s.agentConn = agent, conn
+	}
+
+	hops, err := s.getHops()
+	if err != nil {
+		return err
 	}
 
 	connectRetries := s.ConnectRetries
@@ -94,9 +231,10 @@ func (s *Client) Connect() error {
 	var finalError error
 
 	for i := 0; i < connectRetries; i++ {
-		client, err := ssh.Dial("tcp", s.Host+":"+s.Port, config)
+		client, jumpClients, err := dial(hops)
 		if err == nil {
 			s.client = client
+			s.jumpClients = jumpClients
 			return nil
 		}
 		time.Sleep(sshRetryInterval * time.Second)
@@ -122,6 +260,39 @@ func (s *Client) Exec(cmd string) error {
 	return err
 }
 
+// Output runs the command and returns its standard output
+func (s *Client) Output(cmd string) (string, error) {
+	if s.client == nil {
+		return "", errors.New("Not connected")
+	}
+
+	session, err := s.client.NewSession()
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+
+	session.Stderr = s.Stderr
+	output, err := session.Output(cmd)
+	return string(output), err
+}
+
+// scriptCommand returns the command run on the host, reading the script
+// from the stdin or from the script file, and decoding it when it's sent
+// encoded with base64
+func scriptCommand(command string, scriptFile string, encoded bool) string {
+	switch {
+	case scriptFile != "" && encoded:
+		return base64DecodeCommand + " < " + helpers.ShellEscape(scriptFile) + " | " + command
+	case scriptFile != "":
+		return command + " < " + helpers.ShellEscape(scriptFile)
+	case encoded:
+		return base64DecodeCommand + " | " + command
+	default:
+		return command
+	}
+}
+
 func (s *Command) fullCommand() string {
 	var arguments []string
 	// TODO: This method is compatible only with Bjourne compatible shells
@@ -136,24 +307,43 @@ func (s *Client) Run(cmd Command) error {
 		return errors.New("Not connected")
 	}
 
+	var script bytes.Buffer
+	for _, keyValue := range cmd.Environment {
+		script.WriteString("export " + helpers.ShellEscape(keyValue) + "\n")
+	}
+	script.WriteString(cmd.Stdin)
+
+	if s.Base64Scripts {
+		encoded := helpers.ToBase64Lines(script.Bytes())
+		script.Reset()
+		script.Write(encoded)
+	}
+
+	command := scriptCommand(cmd.fullCommand(), "", s.Base64Scripts)
+	if cmd.ScriptFile != "" && !s.stdinScripts {
+		err := s.Upload(bytes.NewReader(script.Bytes()), int64(script.Len()), 0600, cmd.ScriptFile)
+		if err == nil {
+			command = scriptCommand(cmd.fullCommand(), cmd.ScriptFile, s.Base64Scripts)
+			script.Reset()
+			defer s.Exec("rm -f " + helpers.ShellEscape(cmd.ScriptFile))
+		} else {
+			s.stdinScripts = true
+			if s.Stderr != nil {
+				fmt.Fprintln(s.Stderr, "WARNING: Failed to upload the script, the scripts are written to the standard input:", err)
+			}
+		}
+	}
+
 	session, err := s.client.NewSession()
 	if err != nil {
 		return err
 	}
 	defer session.Close()
 
-	var envVariables bytes.Buffer
-	for _, keyValue := range cmd.Environment {
-		envVariables.WriteString("export " + helpers.ShellEscape(keyValue) + "\n")
-	}
-
-	session.Stdin = io.MultiReader(
-		&envVariables,
-		bytes.NewBufferString(cmd.Stdin),
-	)
+	session.Stdin = &script
 	session.Stdout = s.Stdout
 	session.Stderr = s.Stderr
-	err = session.Start(cmd.fullCommand())
+	err = session.Start(command)
 	if err != nil {
 		return err
 	}
@@ -182,4 +372,14 @@ func (s *Client) Cleanup() {
 	if s.client != nil {
 		s.client.Close()
 	}
+
+	for i := len(s.jumpClients) - 1; i >= 0; i-- {
+		s.jumpClients[i].Close()
+	}
+	s.jumpClients = nil
+
+	if s.agentConn != nil {
+		s.agentConn.Close()
+		s.agent, s.agentConn = nil, nil
+	}
 }
@@ -0,0 +1,78 @@
+package ssh
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetHops(t *testing.T) {
+	s := &Client{
+		Config: Config{
+			User: "build",
+			Host: "10.0.0.5",
+			Port: "2222",
+			JumpHosts: []JumpHost{
+				{Host: "bastion.example.com", User: "jump", Password: "secret"},
+				{Host: "fe80::1", Port: "2200"},
+			},
+		},
+	}
+
+	hops, err := s.getHops()
+	require.NoError(t, err)
+	require.Equal(t, 3, len(hops))
+
+	assert.Equal(t, "bastion.example.com:22", hops[0].address)
+	assert.Equal(t, "jump", hops[0].config.User)
+	assert.Equal(t, "[fe80::1]:2200", hops[1].address)
+	assert.Equal(t, "root", hops[1].config.User)
+	assert.Equal(t, "10.0.0.5:2222", hops[2].address)
+	assert.Equal(t, "build", hops[2].config.User)
+}
+
+func TestGetHopsMissingJumpHost(t *testing.T) {
+	s := &Client{
+		Config: Config{
+			Host:      "10.0.0.5",
+			JumpHosts: []JumpHost{{User: "jump"}},
+		},
+	}
+
+	_, err := s.getHops()
+	assert.EqualError(t, err, "Missing host of jump host")
+}
+
+func TestGetHopsInvalidIdentityFile(t *testing.T) {
+	s := &Client{
+		Config: Config{
+			Host:      "10.0.0.5",
+			JumpHosts: []JumpHost{{Host: "bastion.example.com", IdentityFile: "/nonexistent/id_rsa"}},
+		},
+	}
+
+	_, err := s.getHops()
+	assert.Error(t, err)
+}
+
+func TestScriptFile(t *testing.T) {
+	assert.Equal(t, ".gitlab-runner-script-15", ScriptFile(15))
+}
+
+func TestScriptCommand(t *testing.T) {
+	tests := []struct {
+		scriptFile string
+		encoded    bool
+		expected   string
+	}{
+		{"", false, "bash --login"},
+		{"", true, "base64 -d | bash --login"},
+		{".script", false, "bash --login < $'.script'"},
+		{".script", true, "base64 -d < $'.script' | bash --login"},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, scriptCommand("bash --login", test.scriptFile, test.encoded))
+	}
+}
@@ -1,9 +1,24 @@
 package ssh
 
 type Config struct {
-	User         string `toml:"user,omitempty" json:"user" long:"user" env:"SSH_USER" description:"User name"`
-	Password     string `toml:"password,omitempty" json:"password" long:"password" env:"SSH_PASSWORD" description:"User password"`
-	Host         string `toml:"host,omitempty" json:"host" long:"host" env:"SSH_HOST" description:"Remote host"`
-	Port         string `toml:"port,omitempty" json:"port" long:"port" env:"SSH_PORT" description:"Remote host port"`
-	IdentityFile string `toml:"identity_file,omitempty" json:"identity_file" long:"identity-file" env:"SSH_IDENTITY_FILE" description:"Identity file to be used"`
+	User          string     `toml:"user,omitempty" json:"user" long:"user" env:"SSH_USER" description:"User name"`
+	Password      string     `toml:"password,omitempty" json:"password" long:"password" env:"SSH_PASSWORD" description:"User password"`
+	Host          string     `toml:"host,omitempty" json:"host" long:"host" env:"SSH_HOST" description:"Remote host"`
+	Port          string     `toml:"port,omitempty" json:"port" long:"port" env:"SSH_PORT" description:"Remote host port"`
+	IdentityFile  string     `toml:"identity_file,omitempty" json:"identity_file" long:"identity-file" env:"SSH_IDENTITY_FILE" description:"Identity file to be used"`
+	UseAgent      bool       `toml:"use_agent,omitzero" json:"use_agent" long:"use-agent" env:"SSH_USE_AGENT" description:"Authenticate with the keys of the ssh-agent listening on SSH_AUTH_SOCK"`
+	KnownHosts    string     `toml:"known_hosts_file,omitempty" json:"known_hosts_file" long:"known-hosts-file" env:"SSH_KNOWN_HOSTS_FILE" description:"Verify the host keys against this known_hosts file"`
+	HelperBinary  string     `toml:"helper_binary,omitempty" json:"helper_binary" long:"helper-binary" env:"SSH_HELPER_BINARY" description:"The gitlab-runner binary uploaded to the host by the SSH executor, to handle artifacts and caching"`
+	Base64Scripts bool       `toml:"base64_scripts,omitzero" json:"base64_scripts" long:"base64-scripts" env:"SSH_BASE64_SCRIPTS" description:"Send the scripts encoded with base64, decoded on the host with base64 -d"`
+	JumpHosts     []JumpHost `toml:"jump_hosts,omitempty" json:"jump_hosts"`
+}
+
+// JumpHost is a host the connection to the remote host goes through, like
+// the ProxyJump option of OpenSSH
+type JumpHost struct {
+	User         string `toml:"user,omitempty" json:"user"`
+	Password     string `toml:"password,omitempty" json:"password"`
+	Host         string `toml:"host" json:"host"`
+	Port         string `toml:"port,omitempty" json:"port"`
+	IdentityFile string `toml:"identity_file,omitempty" json:"identity_file"`
 }
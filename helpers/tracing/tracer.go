@@ -0,0 +1,246 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+const (
+	defaultServiceName = "gitlab-runner"
+	exportInterval     = 5 * time.Second
+	maxBatchSize       = 512
+	maxQueueSize       = 4096
+)
+
+type finishedSpan struct {
+	traceID    []byte
+	spanID     []byte
+	parentID   []byte
+	name       string
+	start      time.Time
+	end        time.Time
+	attributes map[string]string
+	err        error
+}
+
+// Tracer exports the finished spans in batches to the OTLP/HTTP endpoint,
+// encoded in JSON
+type Tracer struct {
+	config Config
+	client http.Client
+
+	spans     []*finishedSpan
+	spansLock sync.Mutex
+
+	stop    chan bool
+	stopped chan bool
+}
+
+func NewTracer(config Config) *Tracer {
+	if config.ServiceName == "" {
+		config.ServiceName = defaultServiceName
+	}
+
+	return &Tracer{
+		config: config,
+		client: http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (t *Tracer) sample() bool {
+	if t.config.SampleRatio <= 0 || t.config.SampleRatio >= 1 {
+		return true
+	}
+	return randomRatio() < t.config.SampleRatio
+}
+
+// record queues the span for the next export, the spans are dropped when the
+// endpoint can't keep up
+func (t *Tracer) record(span *finishedSpan) {
+	t.spansLock.Lock()
+	defer t.spansLock.Unlock()
+
+	if len(t.spans) < maxQueueSize {
+		t.spans = append(t.spans, span)
+	}
+}
+
+func (t *Tracer) takeSpans() []*finishedSpan {
+	t.spansLock.Lock()
+	defer t.spansLock.Unlock()
+
+	spans := t.spans
+	if len(spans) > maxBatchSize {
+		spans = spans[:maxBatchSize]
+	}
+	t.spans = t.spans[len(spans):]
+	return spans
+}
+
+// Flush exports the queued spans
+func (t *Tracer) Flush() {
+	for {
+		spans := t.takeSpans()
+		if len(spans) == 0 {
+			return
+		}
+
+		err := t.export(spans)
+		if err != nil {
+			logrus.Warningln("Failed to export the traces:", err)
+			return
+		}
+	}
+}
+
+// Start exports the spans periodically, until Stop
+func (t *Tracer) Start() {
+	t.stop = make(chan bool)
+	t.stopped = make(chan bool)
+
+	go func() {
+		defer close(t.stopped)
+
+		for {
+			select {
+			case <-time.After(exportInterval):
+				t.Flush()
+			case <-t.stop:
+				t.Flush()
+				return
+			}
+		}
+	}()
+}
+
+func (t *Tracer) Stop() {
+	if t.stop == nil {
+		return
+	}
+
+	close(t.stop)
+	<-t.stopped
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+const (
+	otlpSpanKindInternal = 1
+	otlpStatusOk         = 1
+	otlpStatusError      = 2
+)
+
+func newOTLPAttributes(attributes map[string]string) (result []otlpAttribute) {
+	for key, value := range attributes {
+		result = append(result, otlpAttribute{Key: key, Value: otlpValue{StringValue: value}})
+	}
+	return
+}
+
+func newOTLPSpan(span *finishedSpan) otlpSpan {
+	result := otlpSpan{
+		TraceID:           hex.EncodeToString(span.traceID),
+		SpanID:            hex.EncodeToString(span.spanID),
+		Name:              span.name,
+		Kind:              otlpSpanKindInternal,
+		StartTimeUnixNano: strconv.FormatInt(span.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(span.end.UnixNano(), 10),
+		Attributes:        newOTLPAttributes(span.attributes),
+		Status:            otlpStatus{Code: otlpStatusOk},
+	}
+	if span.parentID != nil {
+		result.ParentSpanID = hex.EncodeToString(span.parentID)
+	}
+	if span.err != nil {
+		result.Status = otlpStatus{Code: otlpStatusError, Message: span.err.Error()}
+	}
+	return result
+}
+
+func (t *Tracer) export(spans []*finishedSpan) error {
+	scopeSpans := otlpScopeSpans{}
+	scopeSpans.Scope.Name = defaultServiceName
+	for _, span := range spans {
+		scopeSpans.Spans = append(scopeSpans.Spans, newOTLPSpan(span))
+	}
+
+	resourceSpans := otlpResourceSpans{ScopeSpans: []otlpScopeSpans{scopeSpans}}
+	resourceSpans.Resource.Attributes = newOTLPAttributes(map[string]string{
+		"service.name": t.config.ServiceName,
+	})
+
+	body, err := json.Marshal(otlpRequest{ResourceSpans: []otlpResourceSpans{resourceSpans}})
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest("POST", t.config.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for key, value := range t.config.Headers {
+		request.Header.Set(key, value)
+	}
+
+	response, err := t.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode/100 != 2 {
+		return fmt.Errorf("%s returned %s", t.config.Endpoint, response.Status)
+	}
+	return nil
+}
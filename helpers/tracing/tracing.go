@@ -0,0 +1,178 @@
+package tracing
+
+import (
+	"crypto/rand"
+	"math/big"
+	"sync"
+	"time"
+)
+
+// Config is the export of the traces of the jobs to an OpenTelemetry
+// collector, with the OTLP/HTTP protocol
+type Config struct {
+	Endpoint    string            `toml:"endpoint" json:"endpoint" description:"URL of the OTLP/HTTP traces endpoint, like http://localhost:4318/v1/traces"`
+	SampleRatio float64           `toml:"sample_ratio,omitzero" json:"sample_ratio" description:"Ratio of the traced jobs, from 0 to 1, all the jobs are traced when it's not set"`
+	ServiceName string            `toml:"service_name,omitempty" json:"service_name" description:"Name of the service of the traces, gitlab-runner by default"`
+	Headers     map[string]string `toml:"headers,omitempty" json:"headers" description:"Headers of the requests to the endpoint, like the authentication"`
+}
+
+// Span is an operation of a traced job. The methods of a nil span do
+// nothing, it's the span of a job which isn't traced.
+type Span struct {
+	tracer   *Tracer
+	traceID  []byte
+	spanID   []byte
+	parentID []byte
+
+	name       string
+	start      time.Time
+	attributes map[string]string
+	lock       sync.Mutex
+}
+
+var (
+	defaultTracer *Tracer
+	jobSpans      = make(map[int]*Span)
+	lock          sync.RWMutex
+)
+
+// Configure starts the export of the traces to the endpoint of the config,
+// or stops it when there's no endpoint. The spans of the previous
+// configuration are exported before.
+func Configure(config *Config) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	if defaultTracer != nil {
+		defaultTracer.Stop()
+		defaultTracer = nil
+	}
+
+	if config != nil && config.Endpoint != "" {
+		defaultTracer = NewTracer(*config)
+		defaultTracer.Start()
+	}
+}
+
+// StartTrace starts the trace of a job, at the given time. It returns nil
+// when the tracing isn't configured or the job isn't sampled.
+func StartTrace(name string, start time.Time) *Span {
+	lock.RLock()
+	tracer := defaultTracer
+	lock.RUnlock()
+
+	if tracer == nil || !tracer.sample() {
+		return nil
+	}
+
+	return &Span{
+		tracer:  tracer,
+		traceID: randomID(16),
+		spanID:  randomID(8),
+		name:    name,
+		start:   start,
+	}
+}
+
+// RegisterJob makes the span the parent of the spans of the requests of the
+// job to GitLab, like the updates of its trace
+func RegisterJob(id int, span *Span) {
+	if span == nil {
+		return
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	jobSpans[id] = span
+}
+
+func UnregisterJob(id int) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	delete(jobSpans, id)
+}
+
+// JobSpan returns the span registered for the job, or nil
+func JobSpan(id int) *Span {
+	lock.RLock()
+	defer lock.RUnlock()
+
+	return jobSpans[id]
+}
+
+// StartChild starts the span of an operation of the span
+func (s *Span) StartChild(name string) *Span {
+	return s.StartChildAt(name, time.Now())
+}
+
+// StartChildAt starts the span of an operation of the span, at the given
+// time
+func (s *Span) StartChildAt(name string, start time.Time) *Span {
+	if s == nil {
+		return nil
+	}
+
+	return &Span{
+		tracer:   s.tracer,
+		traceID:  s.traceID,
+		spanID:   randomID(8),
+		parentID: s.spanID,
+		name:     name,
+		start:    start,
+	}
+}
+
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.attributes == nil {
+		s.attributes = make(map[string]string)
+	}
+	s.attributes[key] = value
+}
+
+// End ends the span, it failed when err is set
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+
+	s.lock.Lock()
+	attributes := make(map[string]string, len(s.attributes))
+	for key, value := range s.attributes {
+		attributes[key] = value
+	}
+	s.lock.Unlock()
+
+	s.tracer.record(&finishedSpan{
+		traceID:    s.traceID,
+		spanID:     s.spanID,
+		parentID:   s.parentID,
+		name:       s.name,
+		start:      s.start,
+		end:        time.Now(),
+		attributes: attributes,
+		err:        err,
+	})
+}
+
+func randomID(size int) []byte {
+	id := make([]byte, size)
+	rand.Read(id)
+	return id
+}
+
+func randomRatio() float64 {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return 0
+	}
+	return float64(n.Int64()) / 1000000
+}
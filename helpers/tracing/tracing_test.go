@@ -0,0 +1,74 @@
+package tracing
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNilSpanIsNotTraced(t *testing.T) {
+	Configure(nil)
+
+	span := StartTrace("job", time.Now())
+	assert.Nil(t, span)
+
+	child := span.StartChild("prepare")
+	child.SetAttribute("key", "value")
+	child.End(nil)
+	assert.Nil(t, child)
+}
+
+func TestExportSpans(t *testing.T) {
+	requests := make(chan otlpRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "secret", r.Header.Get("Authorization"))
+
+		var request otlpRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		requests <- request
+	}))
+	defer server.Close()
+
+	Configure(&Config{Endpoint: server.URL, Headers: map[string]string{"Authorization": "secret"}})
+
+	job := StartTrace("job", time.Now())
+	require.NotNil(t, job)
+	RegisterJob(10, job)
+	assert.Equal(t, job, JobSpan(10))
+
+	JobSpan(10).StartChild("get_sources").End(errors.New("clone failed"))
+	UnregisterJob(10)
+	assert.Nil(t, JobSpan(10))
+	job.End(nil)
+
+	Configure(nil)
+
+	request := <-requests
+	require.Equal(t, 1, len(request.ResourceSpans))
+	resourceSpans := request.ResourceSpans[0]
+	assert.Equal(t, "service.name", resourceSpans.Resource.Attributes[0].Key)
+	assert.Equal(t, "gitlab-runner", resourceSpans.Resource.Attributes[0].Value.StringValue)
+
+	spans := resourceSpans.ScopeSpans[0].Spans
+	require.Equal(t, 2, len(spans))
+	assert.Equal(t, "get_sources", spans[0].Name)
+	assert.Equal(t, otlpStatusError, spans[0].Status.Code)
+	assert.Equal(t, "clone failed", spans[0].Status.Message)
+	assert.Equal(t, spans[1].SpanID, spans[0].ParentSpanID)
+	assert.Equal(t, spans[1].TraceID, spans[0].TraceID)
+	assert.Len(t, spans[1].TraceID, 32)
+	assert.Equal(t, "job", spans[1].Name)
+	assert.Empty(t, spans[1].ParentSpanID)
+}
+
+func TestSampleRatio(t *testing.T) {
+	assert.True(t, NewTracer(Config{}).sample())
+	assert.False(t, NewTracer(Config{SampleRatio: 0.000001}).sample())
+}
@@ -0,0 +1,104 @@
+package wsl
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"unicode/utf16"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// decodeOutput decodes the output of wsl.exe, which is UTF-16LE for its own
+// messages and UTF-8 for the output of the Linux commands
+func decodeOutput(output []byte) string {
+	if len(output) < 2 || len(output)%2 != 0 || output[1] != 0 {
+		return string(output)
+	}
+
+	chars := make([]uint16, len(output)/2)
+	for i := range chars {
+		chars[i] = uint16(output[2*i]) | uint16(output[2*i+1])<<8
+	}
+	return string(utf16.Decode(chars))
+}
+
+func WSLOutput(exe string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	log.Debugf("Executing WSLOutput: %#v", args)
+	cmd := exec.Command(exe, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+
+	if _, ok := err.(*exec.ExitError); ok {
+		// wsl.exe writes its errors to the standard output
+		message := strings.TrimSpace(decodeOutput(stderr.Bytes()) + decodeOutput(stdout.Bytes()))
+		err = fmt.Errorf("WSLOutput error: %s", message)
+	}
+
+	return decodeOutput(stdout.Bytes()), err
+}
+
+func WSL(args ...string) (string, error) {
+	return WSLOutput("wsl.exe", args...)
+}
+
+func Version() (string, error) {
+	version, err := WSL("--version")
+	if err != nil {
+		return "", err
+	}
+
+	// the first line looks like `WSL version: 2.0.9.0`
+	lines := strings.Split(strings.TrimSpace(version), "\n")
+	return strings.TrimSpace(lines[0]), nil
+}
+
+// Import imports the root filesystem tarball as a WSL2 distribution, storing
+// its disk in the install directory
+func Import(name string, installDir string, tarball string) error {
+	_, err := WSL("--import", name, installDir, tarball, "--version", "2")
+	return err
+}
+
+func Terminate(name string) error {
+	_, err := WSL("--terminate", name)
+	return err
+}
+
+// Unregister removes the distribution with its disk
+func Unregister(name string) error {
+	_, err := WSL("--unregister", name)
+	return err
+}
+
+// Command returns the command executing the given command in the
+// distribution, as the given user
+func Command(name string, user string, command ...string) *exec.Cmd {
+	args := []string{"--distribution", name}
+	if user != "" {
+		args = append(args, "--user", user)
+	}
+	args = append(args, "--exec")
+	args = append(args, command...)
+	return exec.Command("wsl.exe", args...)
+}
+
+// ToLinuxPath translates the absolute Windows path to the path where it's
+// mounted in the distributions, like C:\Runner\bin to /mnt/c/Runner/bin
+func ToLinuxPath(path string) (string, error) {
+	if len(path) < 3 || path[1] != ':' || (path[2] != '\\' && path[2] != '/') {
+		return "", errors.New("not an absolute Windows path with a drive letter: " + path)
+	}
+
+	drive := strings.ToLower(path[:1])
+	if drive < "a" || drive > "z" {
+		return "", errors.New("invalid drive letter: " + path)
+	}
+
+	rest := strings.Replace(path[3:], "\\", "/", -1)
+	return strings.TrimSuffix("/mnt/"+drive+"/"+rest, "/"), nil
+}
@@ -0,0 +1,40 @@
+package wsl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToLinuxPath(t *testing.T) {
+	tests := map[string]string{
+		`C:\Runner\gitlab-runner-linux-amd64`: "/mnt/c/Runner/gitlab-runner-linux-amd64",
+		`d:/Program Files/Runner/`:            "/mnt/d/Program Files/Runner",
+		`E:\`:                                 "/mnt/e",
+	}
+
+	for path, expected := range tests {
+		linuxPath, err := ToLinuxPath(path)
+		assert.NoError(t, err, path)
+		assert.Equal(t, expected, linuxPath, path)
+	}
+
+	for _, path := range []string{`Runner\bin`, `\\server\share\bin`, `1:\bin`, ""} {
+		_, err := ToLinuxPath(path)
+		assert.Error(t, err, path)
+	}
+}
+
+func TestDecodeOutput(t *testing.T) {
+	utf16 := []byte{'W', 0, 'S', 0, 'L', 0, '\r', 0, '\n', 0}
+	assert.Equal(t, "WSL\r\n", decodeOutput(utf16))
+	assert.Equal(t, "bash output\n", decodeOutput([]byte("bash output\n")))
+}
+
+func TestCommand(t *testing.T) {
+	cmd := Command("runner-abcdef12", "build", "bash", "--login")
+	assert.Equal(t, []string{
+		"wsl.exe", "--distribution", "runner-abcdef12", "--user", "build",
+		"--exec", "bash", "--login",
+	}, cmd.Args)
+}
@@ -12,14 +12,21 @@ import (
 
 	_ "gitlab.com/gitlab-org/gitlab-ci-multi-runner/commands"
 	_ "gitlab.com/gitlab-org/gitlab-ci-multi-runner/commands/helpers"
+	_ "gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors/custom"
 	_ "gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors/docker"
 	_ "gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors/docker/machine"
+	_ "gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors/fargate"
+	_ "gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors/gcpbatch"
 	_ "gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors/kubernetes"
+	_ "gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors/lxd"
 	_ "gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors/parallels"
+	_ "gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors/podman"
 	_ "gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors/shell"
 	_ "gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors/ssh"
 	_ "gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors/virtualbox"
+	_ "gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors/wsl"
 	_ "gitlab.com/gitlab-org/gitlab-ci-multi-runner/shells"
+	_ "gitlab.com/gitlab-org/gitlab-ci-multi-runner/tokenstores"
 )
 
 func main() {
@@ -48,6 +55,7 @@ func main() {
 	}
 	cli_helpers.LogRuntimePlatform(app)
 	cli_helpers.SetupLogLevelOptions(app)
+	cli_helpers.SetupLogFormatOptions(app)
 	cli_helpers.SetupCPUProfile(app)
 	cli_helpers.FixHOME(app)
 	app.Commands = common.GetCommands()
@@ -15,6 +15,10 @@ import (
 var traceUpdateInterval = common.UpdateInterval
 var traceForceSendInterval = common.ForceTraceSentInterval
 var traceFinishRetryInterval = common.UpdateRetryInterval
+var tracePatchLimit = common.TracePatchLimit
+var traceKeepaliveInterval = common.KeepaliveInterval
+var traceOrphanedTimeout = common.OrphanedJobTimeout
+var traceFinalUpdateRetries = common.FinalUpdateRetries
 
 type tracePatch struct {
 	trace  bytes.Buffer
@@ -46,12 +50,17 @@ func (tp *tracePatch) ValidateRange() bool {
 	return false
 }
 
+// newTracePatch returns the patch of the trace from the offset, of
+// tracePatchLimit bytes at most
 func newTracePatch(trace bytes.Buffer, offset int) (*tracePatch, error) {
 	patch := &tracePatch{
 		trace:  trace,
 		offset: offset,
 		limit:  trace.Len(),
 	}
+	if patch.limit-offset > tracePatchLimit {
+		patch.limit = offset + tracePatchLimit
+	}
 
 	if !patch.ValidateRange() {
 		return nil, errors.New("Range is invalid, limit can't be less than offset")
@@ -72,14 +81,22 @@ type clientBuildTrace struct {
 
 	incrementalAvailable bool
 
-	log      bytes.Buffer
-	lock     sync.RWMutex
-	state    common.BuildState
-	finished chan bool
+	log       bytes.Buffer
+	lock      sync.RWMutex
+	state     common.BuildState
+	processed chan bool
+	finished  chan bool
 
+	// sentTrace is the length of the trace confirmed by GitLab, the next
+	// patches are sent from it
 	sentTrace int
 	sentTime  time.Time
 	sentState common.BuildState
+
+	// keepaliveTime is the time of the last update of the state of the
+	// build, aliveTime of the last update accepted by GitLab
+	keepaliveTime time.Time
+	aliveTime     time.Time
 }
 
 func (c *clientBuildTrace) Success() {
@@ -113,26 +130,94 @@ func (c *clientBuildTrace) IsStdout() bool {
 func (c *clientBuildTrace) start() {
 	reader, writer := io.Pipe()
 	c.PipeWriter = writer
+	c.processed = make(chan bool)
 	c.finished = make(chan bool)
 	c.state = common.Running
 	c.incrementalAvailable = true
+	c.aliveTime = time.Now()
 	go c.process(reader)
 	go c.watch()
 }
 
 func (c *clientBuildTrace) finish() {
 	c.Close()
+	// the final upload has the whole output of the build
+	<-c.processed
 	c.finished <- true
 
 	// Do final upload of build trace
-	for {
-		if c.staleUpdate() != common.UpdateFailed {
+	for attempt := 1; ; attempt++ {
+		if c.finalUpdate() != common.UpdateFailed {
+			return
+		}
+		if attempt >= traceFinalUpdateRetries && c.spool() {
+			return
+		}
+		if c.isOrphaned() {
+			c.config.Log().WithField("build", c.id).Errorln("Submitting build to coordinator...", "orphaned, giving up")
 			return
 		}
 		time.Sleep(traceFinishRetryInterval)
 	}
 }
 
+// spool keeps the final update of the trace on the disk, sent later by the
+// spooler, so the worker isn't held while GitLab is unreachable. It's false
+// when the spooling isn't configured or fails.
+func (c *clientBuildTrace) spool() bool {
+	spooler := getSpooler()
+	if spooler == nil {
+		return false
+	}
+
+	c.lock.RLock()
+	state := c.state
+	trace := c.log.String()
+	c.lock.RUnlock()
+
+	log := c.config.Log().WithField("build", c.id)
+	err := spooler.spoolTrace(c.config.RunnerCredentials, c.id, state, trace)
+	if err != nil {
+		log.WithError(err).Errorln("Failed to spool the trace")
+		return false
+	}
+
+	log.Warningln("Submitting build to coordinator...", "spooled, will be retried in the background")
+	return true
+}
+
+// isOrphaned is true when GitLab didn't accept any update for longer than it
+// waits before it drops the running jobs as stuck, so the job is already
+// failed there
+func (c *clientBuildTrace) isOrphaned() bool {
+	return time.Since(c.aliveTime) > traceOrphanedTimeout
+}
+
+// finalUpdate sends the rest of the trace, incrementally when GitLab
+// supports it, and then the final state of the build
+func (c *clientBuildTrace) finalUpdate() common.UpdateState {
+	if c.incrementalAvailable {
+		update := c.patchTrace()
+		if update == common.UpdateNotFound {
+			c.incrementalAvailable = false
+		} else if update != common.UpdateSucceeded {
+			return update
+		} else {
+			c.lock.RLock()
+			state := c.state
+			c.lock.RUnlock()
+
+			update = c.client.UpdateBuild(c.config, c.id, state, nil)
+			if update == common.UpdateSucceeded {
+				c.sentState = state
+			}
+			return update
+		}
+	}
+
+	return c.staleUpdate()
+}
+
 func (c *clientBuildTrace) writeRune(r rune, limit int) (n int, err error) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
@@ -153,6 +238,7 @@ func (c *clientBuildTrace) writeRune(r rune, limit int) (n int, err error) {
 }
 
 func (c *clientBuildTrace) process(pipe *io.PipeReader) {
+	defer close(c.processed)
 	defer pipe.Close()
 
 	stopped := false
@@ -204,40 +290,68 @@ func (c *clientBuildTrace) update() common.UpdateState {
 func (c *clientBuildTrace) incrementalUpdate() common.UpdateState {
 	c.lock.RLock()
 	state := c.state
-	trace := c.log
+	traceLength := c.log.Len()
 	c.lock.RUnlock()
 
+	keepalive := time.Since(c.keepaliveTime) >= traceKeepaliveInterval
 	if c.sentState == state &&
-		c.sentTrace == trace.Len() &&
-		time.Since(c.sentTime) < traceForceSendInterval {
+		c.sentTrace == traceLength &&
+		time.Since(c.sentTime) < traceForceSendInterval &&
+		!keepalive {
 		return common.UpdateSucceeded
 	}
 
-	if c.sentState != state {
-		c.client.UpdateBuild(c.config, c.id, state, nil)
-		c.sentState = state
+	if c.sentState != state || keepalive {
+		if c.keepalive(state) == common.UpdateAbort {
+			return common.UpdateAbort
+		}
 	}
 
-	tracePatch, err := newTracePatch(trace, c.sentTrace)
-	if err != nil {
-		c.config.Log().Errorln("Error while creating a tracePatch", err.Error())
-	}
+	return c.patchTrace()
+}
 
-	update := c.client.PatchTrace(c.config, c.buildCredentials, tracePatch)
-	if update == common.UpdateNotFound {
-		return update
+// keepalive sends the state of the build, at least every
+// traceKeepaliveInterval while it runs, so GitLab doesn't consider the job
+// stuck and tells when the job was canceled or failed meanwhile
+func (c *clientBuildTrace) keepalive(state common.BuildState) common.UpdateState {
+	update := c.client.UpdateBuild(c.config, c.id, state, nil)
+	if update == common.UpdateSucceeded {
+		c.sentState = state
+		c.keepaliveTime = time.Now()
 	}
+	return update
+}
 
-	if update == common.UpdateRangeMismatch {
-		update = c.resendPatch(c.buildCredentials.ID, c.config, c.buildCredentials, tracePatch)
-	}
+// patchTrace sends the output written since the last update, coalesced in
+// patches of tracePatchLimit bytes at most, until all of it is sent or a
+// patch fails. A failed patch is sent again on the next update, from the
+// offset confirmed by GitLab.
+func (c *clientBuildTrace) patchTrace() common.UpdateState {
+	for {
+		c.lock.RLock()
+		trace := c.log
+		c.lock.RUnlock()
+
+		tracePatch, err := newTracePatch(trace, c.sentTrace)
+		if err != nil {
+			c.config.Log().Errorln("Error while creating a tracePatch", err.Error())
+			return c.staleUpdate()
+		}
+
+		update := c.client.PatchTrace(c.config, c.buildCredentials, tracePatch)
+		if update == common.UpdateRangeMismatch {
+			update = c.resendPatch(c.buildCredentials.ID, c.config, c.buildCredentials, tracePatch)
+		}
+		if update != common.UpdateSucceeded {
+			return update
+		}
 
-	if update == common.UpdateSucceeded {
 		c.sentTrace = tracePatch.Limit()
 		c.sentTime = time.Now()
+		if c.sentTrace >= trace.Len() {
+			return update
+		}
 	}
-
-	return update
 }
 
 func (c *clientBuildTrace) resendPatch(id int, config common.RunnerConfig, buildCredentials *common.BuildCredentials, tracePatch common.BuildTracePatch) (update common.UpdateState) {
@@ -292,16 +406,38 @@ func (c *clientBuildTrace) abort() bool {
 	}
 }
 
+// nextUpdateInterval backs off the updates while they fail, like when
+// GitLab is slow to accept the trace, up to the forced update interval
+func nextUpdateInterval(interval time.Duration, state common.UpdateState) time.Duration {
+	if state != common.UpdateFailed {
+		return traceUpdateInterval
+	}
+
+	interval *= 2
+	if interval > traceForceSendInterval {
+		return traceForceSendInterval
+	}
+	return interval
+}
+
 func (c *clientBuildTrace) watch() {
+	interval := traceUpdateInterval
 	for {
 		select {
-		case <-time.After(traceUpdateInterval):
+		case <-time.After(interval):
 			state := c.update()
+			if state == common.UpdateSucceeded {
+				c.aliveTime = time.Now()
+			} else if state == common.UpdateFailed && c.isOrphaned() {
+				c.config.Log().WithField("build", c.id).Errorln("Job orphaned, no update accepted by GitLab for", traceOrphanedTimeout)
+				state = common.UpdateAbort
+			}
+
 			if state == common.UpdateAbort && c.abort() {
 				<-c.finished
 				return
 			}
-			break
+			interval = nextUpdateInterval(interval, state)
 
 		case <-c.finished:
 			return
@@ -315,6 +451,8 @@ func newBuildTrace(client common.Network, config common.RunnerConfig, buildCrede
 		config:           config,
 		buildCredentials: buildCredentials,
 		id:               buildCredentials.ID,
-		abortCh:          make(chan interface{}),
+		// the abort is kept until the build waits for it, like when
+		// GitLab cancels the job while the executor is prepared
+		abortCh: make(chan interface{}, 1),
 	}
 }
@@ -3,6 +3,9 @@ package network
 import (
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -176,3 +179,173 @@ func TestBuildForceSend(t *testing.T) {
 	assert.Equal(t, "test", *u.trace)
 	assert.Equal(t, common.Running, u.state)
 }
+
+type patchTraceNetwork struct {
+	common.MockNetwork
+	remote   string
+	failures int
+	patches  int
+	state    common.BuildState
+	trace    *string
+}
+
+func (m *patchTraceNetwork) UpdateBuild(config common.RunnerConfig, id int, state common.BuildState, trace *string) common.UpdateState {
+	m.state = state
+	m.trace = trace
+	return common.UpdateSucceeded
+}
+
+func (m *patchTraceNetwork) PatchTrace(config common.RunnerConfig, buildCredentials *common.BuildCredentials, tracePatch common.BuildTracePatch) common.UpdateState {
+	m.patches++
+	if m.failures > 0 {
+		m.failures--
+		return common.UpdateFailed
+	}
+	if tracePatch.Offset() != len(m.remote) {
+		tracePatch.SetNewOffset(len(m.remote))
+		return common.UpdateRangeMismatch
+	}
+
+	m.remote += string(tracePatch.Patch())
+	return common.UpdateSucceeded
+}
+
+func TestBuildTracePatchesAreResumed(t *testing.T) {
+	tracePatchLimit = 4
+	defer func() { tracePatchLimit = common.TracePatchLimit }()
+
+	u := &patchTraceNetwork{failures: 1}
+	b := newBuildTrace(u, buildConfig, &common.BuildCredentials{ID: successID})
+	b.log.WriteString("0123456789")
+	b.state = common.Running
+	b.incrementalAvailable = true
+
+	assert.Equal(t, common.UpdateFailed, b.update())
+	assert.Equal(t, 0, b.sentTrace)
+
+	assert.Equal(t, common.UpdateSucceeded, b.update())
+	assert.Equal(t, "0123456789", u.remote)
+	assert.Equal(t, 10, b.sentTrace)
+	assert.Equal(t, 4, u.patches, "the trace is sent in patches of 4 bytes, after the failed one")
+
+	b.log.WriteString("abc")
+	b.state = common.Success
+	assert.Equal(t, common.UpdateSucceeded, b.finalUpdate())
+	assert.Equal(t, "0123456789abc", u.remote)
+	assert.Equal(t, common.Success, u.state)
+	assert.Nil(t, u.trace, "the whole trace isn't sent again")
+}
+
+func TestNextUpdateInterval(t *testing.T) {
+	traceUpdateInterval = time.Second
+	traceForceSendInterval = 5 * time.Second
+	defer func() {
+		traceUpdateInterval = common.UpdateInterval
+		traceForceSendInterval = common.ForceTraceSentInterval
+	}()
+
+	assert.Equal(t, 2*time.Second, nextUpdateInterval(time.Second, common.UpdateFailed))
+	assert.Equal(t, 4*time.Second, nextUpdateInterval(2*time.Second, common.UpdateFailed))
+	assert.Equal(t, 5*time.Second, nextUpdateInterval(4*time.Second, common.UpdateFailed))
+	assert.Equal(t, time.Second, nextUpdateInterval(4*time.Second, common.UpdateSucceeded))
+}
+
+type keepaliveNetwork struct {
+	common.MockNetwork
+	updates int
+	patches int
+	abort   bool
+}
+
+func (m *keepaliveNetwork) UpdateBuild(config common.RunnerConfig, id int, state common.BuildState, trace *string) common.UpdateState {
+	m.updates++
+	if m.abort {
+		return common.UpdateAbort
+	}
+	return common.UpdateSucceeded
+}
+
+func (m *keepaliveNetwork) PatchTrace(config common.RunnerConfig, buildCredentials *common.BuildCredentials, tracePatch common.BuildTracePatch) common.UpdateState {
+	m.patches++
+	return common.UpdateSucceeded
+}
+
+func TestBuildTraceKeepalive(t *testing.T) {
+	u := &keepaliveNetwork{}
+	b := newBuildTrace(u, buildConfig, &common.BuildCredentials{ID: successID})
+	b.state = common.Running
+	b.incrementalAvailable = true
+
+	assert.Equal(t, common.UpdateSucceeded, b.update())
+	assert.Equal(t, 1, u.updates, "the state is sent with the first update")
+
+	assert.Equal(t, common.UpdateSucceeded, b.update())
+	assert.Equal(t, 1, u.updates, "the state isn't sent again before the keepalive")
+
+	b.keepaliveTime = time.Now().Add(-traceKeepaliveInterval)
+	assert.Equal(t, common.UpdateSucceeded, b.update())
+	assert.Equal(t, 2, u.updates, "the state is sent again as a keepalive")
+
+	u.abort = true
+	b.keepaliveTime = time.Now().Add(-traceKeepaliveInterval)
+	assert.Equal(t, common.UpdateAbort, b.update(), "the keepalive aborts the canceled build")
+}
+
+func TestBuildAbortBeforeWaiting(t *testing.T) {
+	traceUpdateInterval = 0
+	defer func() { traceUpdateInterval = common.UpdateInterval }()
+
+	u := &keepaliveNetwork{abort: true}
+	b := newBuildTrace(u, buildConfig, &common.BuildCredentials{ID: successID})
+	b.start()
+
+	for started := time.Now(); time.Since(started) < time.Second && len(b.Aborted()) == 0; {
+		time.Sleep(time.Millisecond)
+	}
+	assert.NotNil(t, <-b.Aborted(), "the abort is kept until the build waits for it")
+	b.Success()
+}
+
+func TestBuildOrphaned(t *testing.T) {
+	traceUpdateInterval = 0
+	traceOrphanedTimeout = 0
+	defer func() {
+		traceUpdateInterval = common.UpdateInterval
+		traceOrphanedTimeout = common.OrphanedJobTimeout
+	}()
+
+	u := &updateTraceNetwork{}
+	b := newBuildTrace(u, buildConfig, &common.BuildCredentials{ID: retryID})
+	b.start()
+	assert.NotNil(t, <-b.Aborted(), "should abort the orphaned build")
+	b.Success()
+	assert.Equal(t, 1, u.count, "the final update isn't retried for the orphaned build")
+}
+
+func TestBuildTraceSpooled(t *testing.T) {
+	traceFinishRetryInterval = time.Microsecond
+	traceFinalUpdateRetries = 2
+	defer func() { traceFinalUpdateRetries = common.FinalUpdateRetries }()
+
+	dir, err := ioutil.TempDir("", "spool")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	u := &updateTraceNetwork{}
+	ConfigureSpool(dir, u, nil)
+	defer ConfigureSpool("", nil, nil)
+
+	b := newBuildTrace(u, buildConfig, &common.BuildCredentials{ID: retryID})
+	b.start()
+	fmt.Fprint(b, "test content")
+	b.Success()
+	assert.Equal(t, 2, u.count, "the final update is spooled after the retries")
+
+	entry, err := readSpoolEntry(filepath.Join(dir, "trace-6.json"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, common.Success, entry.State)
+		if assert.NotNil(t, entry.Trace) {
+			assert.Equal(t, "test content", *entry.Trace)
+		}
+	}
+}
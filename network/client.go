@@ -12,48 +12,81 @@ import (
 	"io"
 	"io/ioutil"
 	"mime"
-	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Sirupsen/logrus"
 
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/tracing"
 )
 
-var dialer = net.Dialer{
-	Timeout:   30 * time.Second,
-	KeepAlive: 30 * time.Second,
-}
-
 type client struct {
 	http.Client
 	url        *url.URL
 	caFile     string
 	caData     []byte
+	certFile   string
+	keyFile    string
+	certData   []byte
+	keyData    []byte
+	proxy      common.RunnerCredentials
 	skipVerify bool
 	updateTime time.Time
+	// lastUpdate and longPolling are set by the concurrent requests of the
+	// runner, they are guarded by headersLock
 	lastUpdate string
+	// longPolling is set when GitLab held the last request until a job was
+	// available, as reported by the Gitlab-Ci-Builds-Polling header
+	longPolling bool
+	headersLock sync.RWMutex
+	// instance is the URL of GitLab of the runner, its requests are paused
+	// when GitLab rate limits them
+	instance string
 }
 
 func (n *client) getLastUpdate() string {
+	n.headersLock.RLock()
+	defer n.headersLock.RUnlock()
+
 	return n.lastUpdate
 }
 
 func (n *client) setLastUpdate(headers http.Header) {
+	n.headersLock.Lock()
+	defer n.headersLock.Unlock()
+
 	if lu := headers.Get("X-GitLab-Last-Update"); len(lu) > 0 {
 		n.lastUpdate = lu
 	}
 }
 
+func (n *client) isLongPolling() bool {
+	n.headersLock.RLock()
+	defer n.headersLock.RUnlock()
+
+	return n.longPolling
+}
+
+func (n *client) setLongPolling(headers http.Header) {
+	n.headersLock.Lock()
+	defer n.headersLock.Unlock()
+
+	n.longPolling = headers.Get("Gitlab-Ci-Builds-Polling") == "yes"
+}
+
 func (n *client) ensureTLSConfig() {
 	// certificate got modified
-	if stat, err := os.Stat(n.caFile); err == nil && n.updateTime.Before(stat.ModTime()) {
-		n.Transport = nil
+	for _, file := range []string{n.caFile, n.certFile, n.keyFile} {
+		if stat, err := os.Stat(file); err == nil && n.updateTime.Before(stat.ModTime()) {
+			n.Transport = nil
+		}
 	}
 
 	// create or update transport
@@ -71,6 +104,7 @@ func (n *client) createTransport() {
 	}
 
 	// load TLS certificate
+	var caData []byte
 	if file := n.caFile; file != "" && !n.skipVerify {
 		logrus.Debugln("Trying to load", file, "...")
 
@@ -80,6 +114,7 @@ func (n *client) createTransport() {
 			if pool.AppendCertsFromPEM(data) {
 				tlsConfig.RootCAs = pool
 				n.caData = data
+				caData = data
 			} else {
 				logrus.Errorln("Failed to parse PEM in", n.caFile)
 			}
@@ -90,16 +125,40 @@ func (n *client) createTransport() {
 		}
 	}
 
-	// create transport
-	n.Transport = &http.Transport{
-		Proxy: http.ProxyFromEnvironment,
-		Dial: func(network, addr string) (net.Conn, error) {
-			logrus.Debugln("Dialing:", network, addr, "...")
-			return dialer.Dial(network, addr)
-		},
-		TLSHandshakeTimeout: 10 * time.Second,
-		TLSClientConfig:     &tlsConfig,
+	// load TLS client certificate
+	var certData []byte
+	if n.certFile != "" && n.keyFile != "" {
+		certificate, err := n.loadCertificate()
+		if err == nil {
+			tlsConfig.Certificates = []tls.Certificate{certificate}
+			certData = n.certData
+		} else {
+			logrus.Errorln("Failed to load the client certificate", n.certFile, err)
+		}
 	}
+
+	// use the transport shared with the other clients with the same TLS config
+	n.Transport = getTransport(&tlsConfig, caData, certData, n.proxy)
+}
+
+func (n *client) loadCertificate() (certificate tls.Certificate, err error) {
+	certData, err := ioutil.ReadFile(n.certFile)
+	if err != nil {
+		return
+	}
+	keyData, err := ioutil.ReadFile(n.keyFile)
+	if err != nil {
+		return
+	}
+
+	certificate, err = tls.X509KeyPair(certData, keyData)
+	if err != nil {
+		return
+	}
+
+	n.certData = certData
+	n.keyData = keyData
+	return
 }
 
 func (n *client) getCAChain(tls *tls.ConnectionState) string {
@@ -143,6 +202,11 @@ func (n *client) do(uri, method string, request io.Reader, requestType string, h
 		return
 	}
 
+	body, rewindable := bufferBody(request)
+	if rewindable && request != nil {
+		request = bytes.NewReader(body)
+	}
+
 	req, err := http.NewRequest(method, url.String(), request)
 	if err != nil {
 		err = fmt.Errorf("failed to create NewRequest: %v", err)
@@ -160,11 +224,41 @@ func (n *client) do(uri, method string, request io.Reader, requestType string, h
 
 	n.ensureTLSConfig()
 
-	res, err = n.Do(req)
-	if err != nil {
-		err = fmt.Errorf("couldn't execute %v against %s: %v", req.Method, req.URL, err)
-		return
+	span := tracing.JobSpan(apiJobID(uri)).StartChild("api " + method + " " + apiEndpoint(uri))
+	for attempt := 1; ; attempt++ {
+		waitRateLimit(n.instance)
+
+		started := time.Now()
+		res, err = n.Do(req)
+		if err != nil {
+			APIMetrics.observeRequest(uri, method, 0, time.Since(started))
+			err = fmt.Errorf("couldn't execute %v against %s: %v", req.Method, req.URL, err)
+			span.End(err)
+			return
+		}
+		APIMetrics.observeRequest(uri, method, res.StatusCode, time.Since(started))
+
+		if res.StatusCode != http.StatusTooManyRequests {
+			break
+		}
+
+		// pause all the requests to GitLab, and send the request again
+		// when it can be
+		delay := retryAfter(res.Header)
+		common.SetRateLimited(n.instance, time.Now().Add(delay))
+		APIMetrics.observeRateLimit(uri, method)
+		logrus.WithField("endpoint", apiEndpoint(uri)).
+			Warningln("Rate limited by GitLab, the requests are paused for", delay)
+
+		if attempt > common.RateLimitRetries || !rewindable {
+			break
+		}
+		io.Copy(ioutil.Discard, res.Body)
+		res.Body.Close()
+		rewindBody(req, body)
 	}
+	span.SetAttribute("http.status_code", strconv.Itoa(res.StatusCode))
+	span.End(nil)
 	return
 }
 
@@ -207,6 +301,7 @@ func (n *client) doJSON(uri, method string, statusCode int, request interface{},
 	}
 
 	n.setLastUpdate(res.Header)
+	n.setLongPolling(res.Header)
 
 	return res.StatusCode, res.Status, n.getCAChain(res.TLS)
 }
@@ -246,8 +341,12 @@ func newClient(config common.RunnerCredentials) (c *client, err error) {
 	}
 
 	c = &client{
-		url:    url,
-		caFile: config.TLSCAFile,
+		url:      url,
+		instance: config.URL,
+		caFile:   config.TLSCAFile,
+		certFile: config.TLSCertFile,
+		keyFile:  config.TLSKeyFile,
+		proxy:    common.RunnerCredentials{HTTPProxy: config.HTTPProxy, HTTPSProxy: config.HTTPSProxy, NoProxy: config.NoProxy},
 	}
 
 	if CertificateDirectory != "" && c.caFile == "" {
@@ -1,6 +1,8 @@
 package network
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/pem"
 	"errors"
 	"fmt"
@@ -13,6 +15,7 @@ import (
 
 	"github.com/Sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	. "gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
 )
@@ -142,6 +145,54 @@ func TestClientTLSCAFile(t *testing.T) {
 	assert.NotEmpty(t, certificates)
 }
 
+func writeTLSKey(s *httptest.Server, file string) error {
+	data, err := x509.MarshalPKCS8PrivateKey(s.TLS.Certificates[0].PrivateKey)
+	if err != nil {
+		return err
+	}
+
+	encoded := pem.EncodeToMemory(&pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: data,
+	})
+
+	return ioutil.WriteFile(file, encoded, 0600)
+}
+
+func TestClientTLSCertFile(t *testing.T) {
+	s := httptest.NewUnstartedServer(http.HandlerFunc(clientHandler))
+	s.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	s.StartTLS()
+	defer s.Close()
+
+	tempDir, err := ioutil.TempDir("", "cert_")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	caFile := filepath.Join(tempDir, "ca.crt")
+	certFile := filepath.Join(tempDir, "client.crt")
+	keyFile := filepath.Join(tempDir, "client.key")
+	require.NoError(t, writeTLSCertificate(s, caFile))
+	require.NoError(t, writeTLSCertificate(s, certFile))
+	require.NoError(t, writeTLSKey(s, keyFile))
+
+	c, _ := newClient(RunnerCredentials{
+		URL:       s.URL,
+		TLSCAFile: caFile,
+	})
+	statusCode, _, _ := c.doJSON("test/ok", "GET", 200, nil, nil)
+	assert.Equal(t, -1, statusCode, "the server requires the client certificate")
+
+	c, _ = newClient(RunnerCredentials{
+		URL:         s.URL,
+		TLSCAFile:   caFile,
+		TLSCertFile: certFile,
+		TLSKeyFile:  keyFile,
+	})
+	statusCode, statusText, _ := c.doJSON("test/ok", "GET", 200, nil, nil)
+	assert.Equal(t, 200, statusCode, statusText)
+}
+
 func TestClientCertificateInPredefinedDirectory(t *testing.T) {
 	s := httptest.NewTLSServer(http.HandlerFunc(clientHandler))
 	defer s.Close()
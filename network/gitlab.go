@@ -2,6 +2,7 @@ package network
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -33,7 +34,8 @@ func (n *GitLabClient) getClient(runner common.RunnerCredentials) (c *client, er
 	if n.clients == nil {
 		n.clients = make(map[string]*client)
 	}
-	key := fmt.Sprintf("%s_%s_%s", runner.URL, runner.Token, runner.TLSCAFile)
+	key := fmt.Sprintf("%s_%s_%s_%s_%s_%s_%s_%s", runner.URL, runner.Token, runner.TLSCAFile,
+		runner.TLSCertFile, runner.TLSKeyFile, runner.HTTPProxy, runner.HTTPSProxy, runner.NoProxy)
 	c = n.clients[key]
 	if c == nil {
 		c, err = newClient(runner)
@@ -45,6 +47,16 @@ func (n *GitLabClient) getClient(runner common.RunnerCredentials) (c *client, er
 	return
 }
 
+// ResetClients drops the clients of the runners, so they are created again
+// with the reloaded TLS certificates. The builds running create the clients
+// they need with their own credentials.
+func (n *GitLabClient) ResetClients() {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	n.clients = nil
+}
+
 func (n *GitLabClient) getLastUpdate(runner common.RunnerCredentials) (lu string) {
 	cli, err := n.getClient(runner)
 	if err != nil {
@@ -53,6 +65,14 @@ func (n *GitLabClient) getLastUpdate(runner common.RunnerCredentials) (lu string
 	return cli.getLastUpdate()
 }
 
+func (n *GitLabClient) isLongPolling(runner common.RunnerCredentials) bool {
+	cli, err := n.getClient(runner)
+	if err != nil {
+		return false
+	}
+	return cli.isLongPolling()
+}
+
 func (n *GitLabClient) getRunnerVersion(config common.RunnerConfig) common.VersionInfo {
 	info := common.VersionInfo{
 		Name:         common.NAME,
@@ -61,16 +81,8 @@ func (n *GitLabClient) getRunnerVersion(config common.RunnerConfig) common.Versi
 		Platform:     runtime.GOOS,
 		Architecture: runtime.GOARCH,
 		Executor:     config.Executor,
+		Features:     common.GetFeatures(config),
 	}
-
-	if executor := common.GetExecutor(config.Executor); executor != nil {
-		executor.GetFeatures(&info.Features)
-	}
-
-	if shell := common.GetShell(config.Shell); shell != nil {
-		shell.GetFeatures(&info.Features)
-	}
-
 	return info
 }
 
@@ -101,6 +113,8 @@ func (n *GitLabClient) GetBuild(config common.RunnerConfig) (*common.GetBuildRes
 
 	var response common.GetBuildResponse
 	result, statusText, certificates := n.doJSON(config.RunnerCredentials, "POST", "builds/register.json", 201, &request, &response)
+	common.SetLongPolling(config.RunnerCredentials, n.isLongPolling(config.RunnerCredentials))
+	common.SetInstanceReachable(config.URL, result != -1 && result < 500)
 
 	switch result {
 	case 201:
@@ -177,7 +191,7 @@ func (n *GitLabClient) DeleteRunner(runner common.RunnerCredentials) bool {
 	}
 }
 
-func (n *GitLabClient) VerifyRunner(runner common.RunnerCredentials) bool {
+func (n *GitLabClient) VerifyRunner(runner common.RunnerCredentials) common.VerifyState {
 	request := common.VerifyRunnerRequest{
 		Token: runner.Token,
 	}
@@ -189,16 +203,43 @@ func (n *GitLabClient) VerifyRunner(runner common.RunnerCredentials) bool {
 	case 404:
 		// this is expected due to fact that we ask for non-existing job
 		runner.Log().Println("Verifying runner...", "is alive")
-		return true
+		return common.VerifySucceeded
 	case 403:
 		runner.Log().Errorln("Verifying runner...", "is removed")
-		return false
+		return common.VerifyForbidden
 	case clientError:
 		runner.Log().WithField("status", statusText).Errorln("Verifying runner...", "error")
-		return false
+		return common.VerifyFailed
 	default:
+		// we can't explicitly say that the runner is not valid
 		runner.Log().WithField("status", statusText).Errorln("Verifying runner...", "failed")
-		return true
+		return common.VerifySucceeded
+	}
+}
+
+// VerifyRunnerToken verifies the authentication token of a runner created in
+// GitLab and returns its details. It uses the API v4, next to the CI API.
+func (n *GitLabClient) VerifyRunnerToken(runner common.RunnerCredentials) (*common.VerifyRunnerTokenResponse, common.VerifyState) {
+	request := common.VerifyRunnerRequest{
+		Token: runner.Token,
+	}
+
+	var response common.VerifyRunnerTokenResponse
+	result, statusText, _ := n.doJSON(runner, "POST", "../../../api/v4/runners/verify", 200, &request, &response)
+
+	switch result {
+	case 200:
+		runner.Log().Println("Verifying runner...", "is valid")
+		return &response, common.VerifySucceeded
+	case 403:
+		runner.Log().Errorln("Verifying runner...", "forbidden (check the runner authentication token)")
+		return nil, common.VerifyForbidden
+	case clientError:
+		runner.Log().WithField("status", statusText).Errorln("Verifying runner...", "error")
+		return nil, common.VerifyFailed
+	default:
+		runner.Log().WithField("status", statusText).Errorln("Verifying runner...", "failed")
+		return nil, common.VerifyFailed
 	}
 }
 
@@ -212,22 +253,49 @@ func (n *GitLabClient) UpdateBuild(config common.RunnerConfig, id int, state com
 
 	log := config.Log().WithField("build", id)
 
-	result, statusText, _ := n.doJSON(config.RunnerCredentials, "PUT", fmt.Sprintf("builds/%d.json", id), 200, &request, nil)
-	switch result {
-	case 200:
+	c, err := n.getClient(config.RunnerCredentials)
+	if err != nil {
+		log.WithField("status", err.Error()).Errorln("Submitting build to coordinator...", "error")
+		return common.UpdateAbort
+	}
+
+	body, err := json.Marshal(&request)
+	if err != nil {
+		log.WithError(err).Errorln("Submitting build to coordinator...", "error")
+		return common.UpdateFailed
+	}
+
+	response, err := c.do(fmt.Sprintf("builds/%d.json", id), "PUT", bytes.NewReader(body), "application/json", make(http.Header))
+	if err != nil {
+		log.WithField("status", err.Error()).Warningln("Submitting build to coordinator...", "failed")
+		return common.UpdateFailed
+	}
+	defer response.Body.Close()
+	defer io.Copy(ioutil.Discard, response.Body)
+
+	// the job canceled or failed in GitLab, like when it was dropped as
+	// stuck, is aborted
+	remoteState := response.Header.Get("Build-Status")
+	log = log.WithFields(logrus.Fields{
+		"build-status": remoteState,
+		"status":       response.Status,
+	})
+
+	switch {
+	case isBuildAborted(remoteState):
+		log.Warningln("Submitting build to coordinator...", "aborted")
+		return common.UpdateAbort
+	case response.StatusCode == 200:
 		log.Debugln("Submitting build to coordinator...", "ok")
 		return common.UpdateSucceeded
-	case 404:
+	case response.StatusCode == 404:
 		log.Warningln("Submitting build to coordinator...", "aborted")
 		return common.UpdateAbort
-	case 403:
-		log.WithField("status", statusText).Errorln("Submitting build to coordinator...", "forbidden")
-		return common.UpdateAbort
-	case clientError:
-		log.WithField("status", statusText).Errorln("Submitting build to coordinator...", "error")
+	case response.StatusCode == 403:
+		log.Errorln("Submitting build to coordinator...", "forbidden")
 		return common.UpdateAbort
 	default:
-		log.WithField("status", statusText).Warningln("Submitting build to coordinator...", "failed")
+		log.Warningln("Submitting build to coordinator...", "failed")
 		return common.UpdateFailed
 	}
 }
@@ -314,9 +382,11 @@ func (n *GitLabClient) UploadRawArtifacts(config common.BuildCredentials, reader
 
 	// TODO: Create proper interface for `doRaw` that can use other types than RunnerCredentials
 	mappedConfig := common.RunnerCredentials{
-		URL:       config.URL,
-		Token:     config.Token,
-		TLSCAFile: config.TLSCAFile,
+		URL:         config.URL,
+		Token:       config.Token,
+		TLSCAFile:   config.TLSCAFile,
+		TLSCertFile: config.TLSCertFile,
+		TLSKeyFile:  config.TLSKeyFile,
 	}
 
 	query := url.Values{}
@@ -390,9 +460,11 @@ func (n *GitLabClient) UploadArtifacts(config common.BuildCredentials, artifacts
 func (n *GitLabClient) DownloadArtifacts(config common.BuildCredentials, artifactsFile string) common.DownloadState {
 	// TODO: Create proper interface for `doRaw` that can use other types than RunnerCredentials
 	mappedConfig := common.RunnerCredentials{
-		URL:       config.URL,
-		Token:     config.Token,
-		TLSCAFile: config.TLSCAFile,
+		URL:         config.URL,
+		Token:       config.Token,
+		TLSCAFile:   config.TLSCAFile,
+		TLSCertFile: config.TLSCertFile,
+		TLSKeyFile:  config.TLSKeyFile,
 	}
 
 	headers := make(http.Header)
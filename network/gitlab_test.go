@@ -13,6 +13,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	. "gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
 )
 
@@ -73,6 +74,7 @@ func testGetBuildHandler(w http.ResponseWriter, r *http.Request, t *testing.T) {
 		res["id"] = 10
 	case "no-builds":
 		w.Header().Add("X-GitLab-Last-Update", "a nice timestamp")
+		w.Header().Add("Gitlab-Ci-Builds-Polling", "yes")
 		w.WriteHeader(404)
 		return
 	case "invalid":
@@ -139,6 +141,8 @@ func TestGetBuild(t *testing.T) {
 	assert.Nil(t, res)
 	assert.True(t, ok, "If no builds, runner is healthy")
 	assert.Equal(t, c.getLastUpdate(noBuildsToken.RunnerCredentials), "a nice timestamp", "Last-Update should be set")
+	assert.True(t, IsLongPolling(noBuildsToken.RunnerCredentials), "Long polling should be set")
+	assert.False(t, IsLongPolling(validToken.RunnerCredentials), "Long polling should not be set")
 
 	res, ok = c.GetBuild(invalidToken)
 	assert.Nil(t, res)
@@ -354,16 +358,75 @@ func TestVerifyRunner(t *testing.T) {
 	c := GitLabClient{}
 
 	state := c.VerifyRunner(validToken)
-	assert.True(t, state)
+	assert.Equal(t, VerifySucceeded, state)
 
 	state = c.VerifyRunner(invalidToken)
-	assert.False(t, state)
+	assert.Equal(t, VerifyForbidden, state)
 
 	state = c.VerifyRunner(otherToken)
-	assert.True(t, state, "in other cases where we can't explicitly say that runner is valid we say that it's")
+	assert.Equal(t, VerifySucceeded, state, "in other cases where we can't explicitly say that runner is valid we say that it's")
 
 	state = c.VerifyRunner(brokenCredentials)
-	assert.False(t, state)
+	assert.Equal(t, VerifyFailed, state)
+}
+
+func TestVerifyRunnerToken(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/gitlab/api/v4/runners/verify" {
+			w.WriteHeader(404)
+			return
+		}
+
+		if r.Method != "POST" {
+			w.WriteHeader(406)
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		assert.NoError(t, err)
+
+		var req map[string]interface{}
+		err = json.Unmarshal(body, &req)
+		assert.NoError(t, err)
+
+		switch req["token"].(string) {
+		case "glrt-valid":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(200)
+			fmt.Fprint(w, `{"id":12,"token":"glrt-valid","token_expires_at":"2030-01-02T03:04:05Z"}`)
+		case "glrt-invalid":
+			w.WriteHeader(403)
+		default:
+			w.WriteHeader(400)
+		}
+	}
+
+	s := httptest.NewServer(http.HandlerFunc(handler))
+	defer s.Close()
+
+	c := GitLabClient{}
+
+	result, state := c.VerifyRunnerToken(RunnerCredentials{URL: s.URL + "/gitlab/", Token: "glrt-valid"})
+	assert.Equal(t, VerifySucceeded, state)
+	if assert.NotNil(t, result) {
+		assert.Equal(t, 12, result.ID)
+		assert.Equal(t, "glrt-valid", result.Token)
+		if assert.NotNil(t, result.TokenExpiresAt) {
+			assert.Equal(t, 2030, result.TokenExpiresAt.Year())
+		}
+	}
+
+	result, state = c.VerifyRunnerToken(RunnerCredentials{URL: s.URL + "/gitlab/", Token: "glrt-invalid"})
+	assert.Nil(t, result)
+	assert.Equal(t, VerifyForbidden, state)
+
+	result, state = c.VerifyRunnerToken(RunnerCredentials{URL: s.URL + "/gitlab/", Token: "glrt-other"})
+	assert.Nil(t, result)
+	assert.Equal(t, VerifyFailed, state)
+
+	result, state = c.VerifyRunnerToken(brokenCredentials)
+	assert.Nil(t, result)
+	assert.Equal(t, VerifyFailed, state)
 }
 
 func TestUpdateBuild(t *testing.T) {
@@ -393,6 +456,9 @@ func TestUpdateBuild(t *testing.T) {
 			w.WriteHeader(200)
 		case "forbidden":
 			w.WriteHeader(403)
+		case "stuck":
+			w.Header().Set("Build-Status", "failed")
+			w.WriteHeader(200)
 		default:
 			w.WriteHeader(400)
 		}
@@ -417,6 +483,9 @@ func TestUpdateBuild(t *testing.T) {
 	state = c.UpdateBuild(config, 10, "forbidden", &trace)
 	assert.Equal(t, UpdateAbort, state, "Update should if the state is forbidden")
 
+	state = c.UpdateBuild(config, 10, "stuck", &trace)
+	assert.Equal(t, UpdateAbort, state, "Update should abort if the build failed in GitLab")
+
 	state = c.UpdateBuild(config, 10, "other", &trace)
 	assert.Equal(t, UpdateFailed, state, "Update should fail for badly formatted request")
 
@@ -675,3 +744,55 @@ func TestBuildFailedStatePatchTrace(t *testing.T) {
 	state := client.PatchTrace(config, &BuildCredentials{ID: 1, Token: patchToken}, tracePatch)
 	assert.Equal(t, UpdateAbort, state)
 }
+
+type featuresTestShell struct {
+	MockShell
+}
+
+func (s *featuresTestShell) GetName() string {
+	return "features-test-shell"
+}
+
+func (s *featuresTestShell) GetFeatures(features *FeaturesInfo) {
+	features.Artifacts = true
+	features.Cache = true
+}
+
+type featuresTestProvider struct {
+	MockExecutorProvider
+}
+
+func (p *featuresTestProvider) GetFeatures(features *FeaturesInfo) {
+	features.Variables = true
+}
+
+func (p *featuresTestProvider) GetDefaultShell() string {
+	return "features-test-shell"
+}
+
+func TestGetRunnerVersionFeatures(t *testing.T) {
+	RegisterShell(&featuresTestShell{})
+	RegisterExecutor("features-test", &featuresTestProvider{})
+
+	c := GitLabClient{}
+	info := c.getRunnerVersion(RunnerConfig{
+		RunnerSettings: RunnerSettings{Executor: "features-test"},
+	})
+
+	assert.Equal(t, FeaturesInfo{
+		Variables: true,
+		Artifacts: true,
+		Cache:     true,
+	}, info.Features, "it uses the default shell of the executor")
+
+	enabled := info.Features.Enabled()
+	require.Equal(t, 3, len(enabled))
+	assert.Equal(t, "variables", enabled[0])
+	assert.Equal(t, "artifacts", enabled[1])
+	assert.Equal(t, "cache", enabled[2])
+
+	data, err := json.Marshal(info.Features)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"artifacts":true`)
+	assert.Contains(t, string(data), `"services":false`)
+}
@@ -0,0 +1,93 @@
+package network
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var endpointIDRegexp = regexp.MustCompile(`(^|/)\d+(/|\.|$)`)
+var jobURIRegexp = regexp.MustCompile(`^builds/(\d+)(/|\.|$)`)
+
+type apiMetrics struct {
+	requestDuration *prometheus.HistogramVec
+	requestErrors   *prometheus.CounterVec
+	rateLimits      *prometheus.CounterVec
+}
+
+// APIMetrics are the durations and the errors of the requests to the GitLab
+// API, registered by the metrics server
+var APIMetrics = &apiMetrics{
+	requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "ci_runner_api_request_duration_seconds",
+		Help: "The duration of the requests to the GitLab API.",
+	}, []string{"endpoint", "method", "status"}),
+	requestErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ci_runner_api_request_errors_total",
+		Help: "The number of the requests to the GitLab API which failed without response or with a server error.",
+	}, []string{"endpoint", "method"}),
+	rateLimits: prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ci_runner_api_rate_limited_total",
+		Help: "The number of the requests to the GitLab API rate limited with 429 Too Many Requests.",
+	}, []string{"endpoint", "method"}),
+}
+
+// Describe implements prometheus.Collector.
+func (m *apiMetrics) Describe(ch chan<- *prometheus.Desc) {
+	m.requestDuration.Describe(ch)
+	m.requestErrors.Describe(ch)
+	m.rateLimits.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (m *apiMetrics) Collect(ch chan<- prometheus.Metric) {
+	m.requestDuration.Collect(ch)
+	m.requestErrors.Collect(ch)
+	m.rateLimits.Collect(ch)
+}
+
+// apiEndpoint returns the endpoint of the request, without the IDs of the
+// builds and the query: builds/123/trace.txt is builds/:id/trace.txt
+func apiEndpoint(uri string) string {
+	uri = strings.SplitN(uri, "?", 2)[0]
+	uri = strings.TrimLeft(uri, "./")
+	for endpointIDRegexp.MatchString(uri) {
+		uri = endpointIDRegexp.ReplaceAllString(uri, "$1:id$2")
+	}
+	return uri
+}
+
+// apiJobID returns the ID of the job of the request, or 0 when the request
+// isn't about a job
+func apiJobID(uri string) int {
+	match := jobURIRegexp.FindStringSubmatch(uri)
+	if match == nil {
+		return 0
+	}
+
+	id, _ := strconv.Atoi(match[1])
+	return id
+}
+
+// observeRequest records the request, the status is 0 when it got no
+// response
+func (m *apiMetrics) observeRequest(uri, method string, status int, duration time.Duration) {
+	endpoint := apiEndpoint(uri)
+
+	label := "error"
+	if status > 0 {
+		label = strconv.Itoa(status)
+	}
+	m.requestDuration.WithLabelValues(endpoint, method, label).Observe(duration.Seconds())
+
+	if status == 0 || status >= 500 {
+		m.requestErrors.WithLabelValues(endpoint, method).Inc()
+	}
+}
+
+func (m *apiMetrics) observeRateLimit(uri, method string) {
+	m.rateLimits.WithLabelValues(apiEndpoint(uri), method).Inc()
+}
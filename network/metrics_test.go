@@ -0,0 +1,22 @@
+package network
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIEndpoint(t *testing.T) {
+	assert.Equal(t, "builds/register.json", apiEndpoint("builds/register.json"))
+	assert.Equal(t, "builds/:id.json", apiEndpoint("builds/123.json"))
+	assert.Equal(t, "builds/:id/trace.txt", apiEndpoint("builds/123/trace.txt"))
+	assert.Equal(t, "builds/:id/artifacts", apiEndpoint("builds/123/artifacts?expire_in=1d"))
+	assert.Equal(t, "api/v4/runners/verify", apiEndpoint("../../../api/v4/runners/verify"))
+}
+
+func TestAPIJobID(t *testing.T) {
+	assert.Equal(t, 123, apiJobID("builds/123.json"))
+	assert.Equal(t, 123, apiJobID("builds/123/trace.txt"))
+	assert.Equal(t, 0, apiJobID("builds/register.json"))
+	assert.Equal(t, 0, apiJobID("runners/verify"))
+}
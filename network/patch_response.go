@@ -13,8 +13,14 @@ type TracePatchResponse struct {
 	RemoteRange string
 }
 
+// isBuildAborted is true when the Build-Status of the response tells that the
+// job is over in GitLab
+func isBuildAborted(remoteState string) bool {
+	return remoteState == "canceled" || remoteState == "failed"
+}
+
 func (p *TracePatchResponse) IsAborted() bool {
-	if p.RemoteState == "canceled" || p.RemoteState == "failed" {
+	if isBuildAborted(p.RemoteState) {
 		return true
 	}
 
@@ -0,0 +1,64 @@
+package network
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+// retryAfter returns the delay of the Retry-After header of the 429
+// response, in seconds or as a date, capped to MaxRetryAfter
+func retryAfter(headers http.Header) time.Duration {
+	delay := common.DefaultRetryAfter
+
+	value := headers.Get("Retry-After")
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		delay = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(value); err == nil {
+		delay = date.Sub(time.Now())
+	}
+
+	if delay < 0 {
+		return 0
+	}
+	if delay > common.MaxRetryAfter {
+		return common.MaxRetryAfter
+	}
+	return delay
+}
+
+// waitRateLimit waits until the requests to the GitLab instance aren't
+// rate limited anymore
+func waitRateLimit(instance string) {
+	if delay := common.RateLimitedUntil(instance).Sub(time.Now()); delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+// bufferBody reads the bodies kept in memory, so they can be sent again when
+// the request is rate limited. It returns false for the streamed bodies, like
+// the artifacts, which can't be read again.
+func bufferBody(request io.Reader) ([]byte, bool) {
+	switch request.(type) {
+	case nil:
+		return nil, true
+	case *bytes.Reader, *bytes.Buffer, *strings.Reader:
+		body, err := ioutil.ReadAll(request)
+		return body, err == nil
+	default:
+		return nil, false
+	}
+}
+
+// rewindBody resets the body of the request to send it again
+func rewindBody(req *http.Request, body []byte) {
+	if req.Body != nil {
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+}
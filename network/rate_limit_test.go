@@ -0,0 +1,63 @@
+package network
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+func TestRetryAfter(t *testing.T) {
+	headers := make(http.Header)
+	assert.Equal(t, common.DefaultRetryAfter, retryAfter(headers))
+
+	headers.Set("Retry-After", "10")
+	assert.Equal(t, 10*time.Second, retryAfter(headers))
+
+	headers.Set("Retry-After", "3600")
+	assert.Equal(t, common.MaxRetryAfter, retryAfter(headers))
+
+	headers.Set("Retry-After", time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat))
+	assert.Equal(t, time.Duration(0), retryAfter(headers))
+}
+
+func TestClientRetriesRateLimitedRequests(t *testing.T) {
+	requests := 0
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.Equal(t, `{"token":"token"}`, string(body))
+		if requests == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer s.Close()
+
+	c, _ := newClient(common.RunnerCredentials{URL: s.URL})
+	statusCode, statusText, _ := c.doJSON("builds/register.json", "POST", 201, map[string]string{"token": "token"}, nil)
+	assert.Equal(t, 201, statusCode, statusText)
+	assert.Equal(t, 2, requests)
+}
+
+func TestClientGivesUpRateLimitedRequests(t *testing.T) {
+	requests := 0
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer s.Close()
+
+	c, _ := newClient(common.RunnerCredentials{URL: s.URL})
+	statusCode, _, _ := c.doJSON("builds/register.json", "POST", 201, nil, nil)
+	assert.Equal(t, http.StatusTooManyRequests, statusCode)
+	assert.Equal(t, common.RateLimitRetries+1, requests)
+}
@@ -0,0 +1,242 @@
+package network
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+var spoolCheckInterval = common.SpoolCheckInterval
+
+// spoolEntry is the final update of the trace of a job kept on the disk
+// while GitLab is unreachable. It has a reference to the runner of the job
+// instead of its token, looked up in the config when the update is sent.
+type spoolEntry struct {
+	ID      int               `json:"id"`
+	Runner  string            `json:"runner"`
+	State   common.BuildState `json:"state,omitempty"`
+	Trace   *string           `json:"trace,omitempty"`
+	Created time.Time         `json:"created"`
+
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"next_attempt"`
+}
+
+// runnerReference identifies the runner in the spooled entries, without
+// revealing its token
+func runnerReference(credentials common.RunnerCredentials) string {
+	digest := sha256.Sum256([]byte(credentials.UniqueID()))
+	return hex.EncodeToString(digest[:])
+}
+
+// retryInterval backs off the retries of the entry exponentially, up to
+// MaxSpoolRetryInterval
+func (e *spoolEntry) retryInterval() time.Duration {
+	interval := common.SpoolRetryInterval
+	for i := 1; i < e.Attempts && interval < common.MaxSpoolRetryInterval; i++ {
+		interval *= 2
+	}
+	if interval > common.MaxSpoolRetryInterval {
+		return common.MaxSpoolRetryInterval
+	}
+	return interval
+}
+
+// writeSpoolEntry writes the entry readable only by the runner, renamed at
+// the end so the spooler never reads a partial entry
+func writeSpoolEntry(file string, entry *spoolEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(file+".tmp", data, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(file+".tmp", file)
+}
+
+func readSpoolEntry(file string) (*spoolEntry, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &spoolEntry{}
+	err = json.Unmarshal(data, entry)
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// Spooler sends the final updates of the traces kept in its directory,
+// retried with an exponential backoff until GitLab accepts them
+type Spooler struct {
+	dir     string
+	network common.Network
+	config  *common.Config
+
+	stop    chan bool
+	stopped chan bool
+}
+
+func newSpooler(dir string, network common.Network, config *common.Config) *Spooler {
+	return &Spooler{
+		dir:     dir,
+		network: network,
+		config:  config,
+	}
+}
+
+// spoolTrace keeps the final update of the trace of the job
+func (s *Spooler) spoolTrace(runner common.RunnerCredentials, id int, state common.BuildState, trace string) error {
+	err := os.MkdirAll(s.dir, 0700)
+	if err != nil {
+		return err
+	}
+
+	return writeSpoolEntry(filepath.Join(s.dir, fmt.Sprintf("trace-%d.json", id)), &spoolEntry{
+		ID:      id,
+		Runner:  runnerReference(runner),
+		State:   state,
+		Trace:   &trace,
+		Created: time.Now(),
+	})
+}
+
+// findRunner returns the runner of the reference from the config, nil when
+// it was removed from it
+func (s *Spooler) findRunner(reference string) *common.RunnerConfig {
+	if s.config == nil {
+		return nil
+	}
+
+	for _, runner := range s.config.Runners {
+		if runnerReference(runner.RunnerCredentials) == reference {
+			return runner
+		}
+	}
+	return nil
+}
+
+// send returns true when the entry is done with, sent or rejected by GitLab
+func (s *Spooler) send(entry *spoolEntry) bool {
+	runner := s.findRunner(entry.Runner)
+	if runner == nil {
+		logrus.WithField("build", entry.ID).Errorln("The runner of the spooled trace isn't in the config")
+		return true
+	}
+
+	return s.network.UpdateBuild(*runner, entry.ID, entry.State, entry.Trace) != common.UpdateFailed
+}
+
+// Flush sends the entries due to be retried
+func (s *Spooler) Flush() {
+	files, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return
+	}
+
+	for _, file := range files {
+		entry, err := readSpoolEntry(file)
+		if err != nil {
+			logrus.WithError(err).Warningln("Failed to read the spooled", file)
+			os.Remove(file)
+			continue
+		}
+
+		if time.Since(entry.Created) > common.SpoolExpiry {
+			logrus.WithField("build", entry.ID).Errorln("Dropping the spooled trace after", common.SpoolExpiry)
+			os.Remove(file)
+			continue
+		}
+
+		if time.Now().Before(entry.NextAttempt) {
+			continue
+		}
+
+		if s.send(entry) {
+			logrus.WithField("build", entry.ID).Infoln("Sent the spooled trace")
+			os.Remove(file)
+			continue
+		}
+
+		entry.Attempts++
+		entry.NextAttempt = time.Now().Add(entry.retryInterval())
+		err = writeSpoolEntry(file, entry)
+		if err != nil {
+			logrus.WithError(err).Warningln("Failed to update the spooled", file)
+		}
+	}
+}
+
+// Start sends the entries periodically, until Stop
+func (s *Spooler) Start() {
+	s.stop = make(chan bool)
+	s.stopped = make(chan bool)
+
+	go func() {
+		defer close(s.stopped)
+
+		for {
+			select {
+			case <-time.After(spoolCheckInterval):
+				s.Flush()
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (s *Spooler) Stop() {
+	if s.stop == nil {
+		return
+	}
+
+	close(s.stop)
+	<-s.stopped
+}
+
+var (
+	defaultSpooler *Spooler
+	spoolerLock    sync.RWMutex
+)
+
+// ConfigureSpool keeps the final updates of the traces which can't be sent to
+// GitLab in the directory, sent later by the network with the runners of the
+// config, or stops the spooling when the directory is empty. The entries are
+// kept on the disk when it's stopped.
+func ConfigureSpool(dir string, network common.Network, config *common.Config) {
+	spoolerLock.Lock()
+	defer spoolerLock.Unlock()
+
+	if defaultSpooler != nil {
+		defaultSpooler.Stop()
+		defaultSpooler = nil
+	}
+
+	if dir != "" {
+		defaultSpooler = newSpooler(dir, network, config)
+		defaultSpooler.Start()
+	}
+}
+
+func getSpooler() *Spooler {
+	spoolerLock.RLock()
+	defer spoolerLock.RUnlock()
+
+	return defaultSpooler
+}
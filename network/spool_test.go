@@ -0,0 +1,120 @@
+package network
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+type spoolNetwork struct {
+	common.MockNetwork
+	updateState common.UpdateState
+	updates     int
+	token       string
+	state       common.BuildState
+	trace       *string
+}
+
+func (m *spoolNetwork) UpdateBuild(config common.RunnerConfig, id int, state common.BuildState, trace *string) common.UpdateState {
+	m.updates++
+	m.token = config.Token
+	m.state = state
+	m.trace = trace
+	return m.updateState
+}
+
+func spooledFiles(t *testing.T, dir string) []string {
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	require.NoError(t, err)
+	return files
+}
+
+func TestSpoolerSendsTheTrace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spool")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	runner := &common.RunnerConfig{RunnerCredentials: common.RunnerCredentials{URL: "http://gitlab/", Token: "runner-token"}}
+	u := &spoolNetwork{updateState: common.UpdateFailed}
+	s := newSpooler(dir, u, &common.Config{Runners: []*common.RunnerConfig{runner}})
+
+	require.NoError(t, s.spoolTrace(runner.RunnerCredentials, 10, common.Success, "trace"))
+	files := spooledFiles(t, dir)
+	require.Equal(t, 1, len(files))
+	data, err := ioutil.ReadFile(files[0])
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "runner-token", "the token isn't written to the disk")
+
+	s.Flush()
+	assert.Equal(t, 1, u.updates)
+	assert.Equal(t, "runner-token", u.token)
+
+	s.Flush()
+	assert.Equal(t, 1, u.updates, "the trace is retried after a backoff")
+
+	entry, err := readSpoolEntry(files[0])
+	require.NoError(t, err)
+	assert.Equal(t, 1, entry.Attempts)
+	entry.NextAttempt = time.Now()
+	require.NoError(t, writeSpoolEntry(files[0], entry))
+
+	u.updateState = common.UpdateSucceeded
+	s.Flush()
+	assert.Equal(t, 2, u.updates)
+	assert.Equal(t, common.Success, u.state)
+	if assert.NotNil(t, u.trace) {
+		assert.Equal(t, "trace", *u.trace)
+	}
+	assert.Empty(t, spooledFiles(t, dir), "the sent entries are removed")
+}
+
+func TestSpoolerDropsTheTracesOfRemovedRunners(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spool")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	u := &spoolNetwork{updateState: common.UpdateSucceeded}
+	s := newSpooler(dir, u, &common.Config{})
+
+	credentials := common.RunnerCredentials{URL: "http://gitlab/", Token: "runner-token"}
+	require.NoError(t, s.spoolTrace(credentials, 10, common.Success, "trace"))
+
+	s.Flush()
+	assert.Equal(t, 0, u.updates)
+	assert.Empty(t, spooledFiles(t, dir))
+}
+
+func TestSpoolerDropsTheExpiredEntries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spool")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	u := &spoolNetwork{updateState: common.UpdateFailed}
+	s := newSpooler(dir, u, nil)
+
+	trace := "trace"
+	err = writeSpoolEntry(filepath.Join(dir, "trace-10.json"), &spoolEntry{
+		ID:      10,
+		State:   common.Failed,
+		Trace:   &trace,
+		Created: time.Now().Add(-common.SpoolExpiry - time.Minute),
+	})
+	require.NoError(t, err)
+
+	s.Flush()
+	assert.Equal(t, 0, u.updates)
+	assert.Empty(t, spooledFiles(t, dir))
+}
+
+func TestSpoolEntryRetryInterval(t *testing.T) {
+	assert.Equal(t, common.SpoolRetryInterval, (&spoolEntry{Attempts: 1}).retryInterval())
+	assert.Equal(t, 4*common.SpoolRetryInterval, (&spoolEntry{Attempts: 3}).retryInterval())
+	assert.Equal(t, common.MaxSpoolRetryInterval, (&spoolEntry{Attempts: 20}).retryInterval())
+}
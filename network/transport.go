@@ -0,0 +1,114 @@
+package network
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"golang.org/x/net/http2"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+// The transports are shared by the clients with the same TLS config, so the
+// requests of all the jobs, like the updates of their traces, reuse the
+// connections to GitLab instead of dialing new ones
+var (
+	transportConfig *common.HTTPClientConfig
+	transports      = make(map[string]*http.Transport)
+	transportsLock  sync.Mutex
+)
+
+// ConfigureTransport sets the settings of the connections to GitLab. The
+// idle connections of the previous settings are closed.
+func ConfigureTransport(config *common.HTTPClientConfig) {
+	transportsLock.Lock()
+	defer transportsLock.Unlock()
+
+	for _, transport := range transports {
+		transport.CloseIdleConnections()
+	}
+	transports = make(map[string]*http.Transport)
+	transportConfig = config
+}
+
+func transportKey(skipVerify bool, caData, certData []byte, proxy common.RunnerCredentials) string {
+	caSum := sha256.Sum256(caData)
+	certSum := sha256.Sum256(certData)
+	return strings.Join([]string{
+		strconv.FormatBool(skipVerify),
+		hex.EncodeToString(caSum[:]),
+		hex.EncodeToString(certSum[:]),
+		proxy.HTTPProxy,
+		proxy.HTTPSProxy,
+		proxy.NoProxy,
+	}, "_")
+}
+
+// newProxy returns the proxies of the runner, or the ones of the environment
+// of the process when the runner doesn't have proxies
+func newProxy(proxy common.RunnerCredentials) func(*http.Request) (*url.URL, error) {
+	if !proxy.HasProxy() {
+		return http.ProxyFromEnvironment
+	}
+
+	return func(request *http.Request) (*url.URL, error) {
+		proxyURL := proxy.GetProxy(request.URL.Scheme, request.URL.Host)
+		if proxyURL == "" {
+			return nil, nil
+		}
+		return url.Parse(proxyURL)
+	}
+}
+
+func newTransport(tlsConfig *tls.Config, proxy common.RunnerCredentials) *http.Transport {
+	dialer := net.Dialer{
+		Timeout:   transportConfig.GetDialTimeout(),
+		KeepAlive: 30 * time.Second,
+	}
+
+	transport := &http.Transport{
+		Proxy: newProxy(proxy),
+		Dial: func(network, addr string) (net.Conn, error) {
+			logrus.Debugln("Dialing:", network, addr, "...")
+			return dialer.Dial(network, addr)
+		},
+		TLSHandshakeTimeout: transportConfig.GetTLSHandshakeTimeout(),
+		TLSClientConfig:     tlsConfig,
+		MaxIdleConns:        transportConfig.GetMaxIdleConns(),
+		MaxIdleConnsPerHost: transportConfig.GetMaxIdleConnsPerHost(),
+		IdleConnTimeout:     transportConfig.GetIdleConnTimeout(),
+	}
+
+	if transportConfig.IsHTTP2Enabled() {
+		err := http2.ConfigureTransport(transport)
+		if err != nil {
+			logrus.Warningln("Failed to enable HTTP/2:", err)
+		}
+	}
+	return transport
+}
+
+// getTransport returns the transport of the TLS config, the one of the
+// certificates loaded from caData and of the client certificate loaded from
+// certData, and of the proxies
+func getTransport(tlsConfig *tls.Config, caData, certData []byte, proxy common.RunnerCredentials) *http.Transport {
+	transportsLock.Lock()
+	defer transportsLock.Unlock()
+
+	key := transportKey(tlsConfig.InsecureSkipVerify, caData, certData, proxy)
+	transport := transports[key]
+	if transport == nil {
+		transport = newTransport(tlsConfig, proxy)
+		transports[key] = transport
+	}
+	return transport
+}
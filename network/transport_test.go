@@ -0,0 +1,77 @@
+package network
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+func TestClientsShareTransport(t *testing.T) {
+	ConfigureTransport(nil)
+
+	c1, err := newClient(common.RunnerCredentials{URL: "http://gitlab.example.com/", Token: "job-token-1"})
+	require.NoError(t, err)
+	c2, err := newClient(common.RunnerCredentials{URL: "http://gitlab.example.com/", Token: "job-token-2"})
+	require.NoError(t, err)
+
+	c1.ensureTLSConfig()
+	c2.ensureTLSConfig()
+	assert.True(t, c1.Transport == c2.Transport)
+
+	transport := c1.Transport.(*http.Transport)
+	assert.Equal(t, common.DefaultMaxIdleConnsPerHost, transport.MaxIdleConnsPerHost)
+	assert.Equal(t, common.DefaultIdleConnTimeout*time.Second, transport.IdleConnTimeout)
+	assert.Nil(t, transport.TLSNextProto["h2"])
+}
+
+func TestConfigureTransport(t *testing.T) {
+	ConfigureTransport(&common.HTTPClientConfig{
+		MaxIdleConns:        20,
+		MaxIdleConnsPerHost: 5,
+		IdleConnTimeout:     30,
+		TLSHandshakeTimeout: 3,
+		EnableHTTP2:         true,
+	})
+	defer ConfigureTransport(nil)
+
+	c, err := newClient(common.RunnerCredentials{URL: "https://gitlab.example.com/", Token: "token"})
+	require.NoError(t, err)
+	c.ensureTLSConfig()
+
+	transport := c.Transport.(*http.Transport)
+	assert.Equal(t, 20, transport.MaxIdleConns)
+	assert.Equal(t, 5, transport.MaxIdleConnsPerHost)
+	assert.Equal(t, 30*time.Second, transport.IdleConnTimeout)
+	assert.Equal(t, 3*time.Second, transport.TLSHandshakeTimeout)
+	assert.NotNil(t, transport.TLSNextProto["h2"])
+}
+
+func TestClientProxy(t *testing.T) {
+	c, err := newClient(common.RunnerCredentials{
+		URL:       "https://gitlab.example.com/",
+		Token:     "token",
+		HTTPProxy: "http://proxy.example.com:3128",
+		NoProxy:   "internal.example.com",
+	})
+	require.NoError(t, err)
+	c.ensureTLSConfig()
+
+	transport := c.Transport.(*http.Transport)
+	request, err := http.NewRequest("GET", "https://gitlab.example.com/ci/api/v1/builds/register.json", nil)
+	require.NoError(t, err)
+	proxy, err := transport.Proxy(request)
+	require.NoError(t, err)
+	require.NotNil(t, proxy)
+	assert.Equal(t, "proxy.example.com:3128", proxy.Host)
+
+	request, err = http.NewRequest("GET", "https://internal.example.com/ci/api/v1/builds/register.json", nil)
+	require.NoError(t, err)
+	proxy, err = transport.Proxy(request)
+	require.NoError(t, err)
+	assert.Nil(t, proxy)
+}
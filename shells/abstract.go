@@ -1,6 +1,7 @@
 package shells
 
 import (
+	"net/url"
 	"path"
 	"path/filepath"
 	"strconv"
@@ -8,6 +9,7 @@ import (
 
 	"errors"
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers"
 )
 
 type AbstractShell struct {
@@ -16,6 +18,7 @@ type AbstractShell struct {
 func (b *AbstractShell) GetFeatures(features *common.FeaturesInfo) {
 	features.Artifacts = true
 	features.Cache = true
+	features.Steps = true
 }
 
 func (b *AbstractShell) GetSupportedOptions() []string {
@@ -26,9 +29,37 @@ func (b *AbstractShell) writeCdBuildDir(w ShellWriter, info common.ShellScriptIn
 	w.Cd(info.Build.FullProjectDir())
 }
 
+// writeCdWorkingDir changes to the working directory of the stage, or to the
+// project directory when it has none
+func (b *AbstractShell) writeCdWorkingDir(w ShellWriter, info common.ShellScriptInfo, buildStage common.BuildStage) error {
+	dir, err := info.Build.GetWorkingDirectory(buildStage)
+	if err != nil {
+		return err
+	}
+
+	if dir == "" {
+		b.writeCdBuildDir(w, info)
+	} else {
+		w.Cd(path.Join(info.Build.FullProjectDir(), dir))
+	}
+	return nil
+}
+
+// writeVariable exports the variable. The masked variables given by the
+// executor in the environment of the shell are not, so they are never
+// printed, but the files of the file ones are written from the environment.
+func (b *AbstractShell) writeVariable(w ShellWriter, info common.ShellScriptInfo, variable common.BuildVariable) {
+	if !info.MaskedVariablesInEnvironment {
+		variable.Masked = false
+	} else if variable.Masked && !variable.File {
+		return
+	}
+	w.Variable(variable)
+}
+
 func (b *AbstractShell) writeExports(w ShellWriter, info common.ShellScriptInfo) {
 	for _, variable := range info.Build.GetAllVariables() {
-		w.Variable(variable)
+		b.writeVariable(w, info, variable)
 	}
 }
 
@@ -44,6 +75,31 @@ func (b *AbstractShell) writeTLSCAInfo(w ShellWriter, build *common.Build, key s
 	}
 }
 
+// writeServerTLSInfo passes the CA chain of GitLab to the scripts of the
+// build, in CI_SERVER_TLS_CA_FILE. The git commands trust it for the
+// requests to GitLab only, with the git config of the environment, unless
+// the build sets its own.
+func (b *AbstractShell) writeServerTLSInfo(w ShellWriter, build *common.Build) {
+	if build.TLSCAChain == "" {
+		return
+	}
+
+	b.writeTLSCAInfo(w, build, "CI_SERVER_TLS_CA_FILE")
+
+	serverURL, err := url.Parse(build.Runner.URL)
+	if err != nil || serverURL.Host == "" {
+		return
+	}
+	if build.GetAllVariables().Get("GIT_CONFIG_COUNT") != "" {
+		return
+	}
+
+	serverURL = &url.URL{Scheme: serverURL.Scheme, Host: serverURL.Host, Path: "/"}
+	w.Variable(common.BuildVariable{Key: "GIT_CONFIG_COUNT", Value: "1"})
+	w.Variable(common.BuildVariable{Key: "GIT_CONFIG_KEY_0", Value: "http." + serverURL.String() + ".sslCAInfo"})
+	b.writeTLSCAInfo(w, build, "GIT_CONFIG_VALUE_0")
+}
+
 func (b *AbstractShell) writeCloneCmd(w ShellWriter, build *common.Build, projectDir string) {
 	templateDir := w.MkTmpDir("git-template")
 	args := []string{"clone", "--no-checkout", build.GetRemoteURL(), projectDir, "--template", templateDir}
@@ -51,6 +107,14 @@ func (b *AbstractShell) writeCloneCmd(w ShellWriter, build *common.Build, projec
 	w.RmDir(projectDir)
 	w.Command("git", "config", "-f", path.Join(templateDir, "config"), "fetch.recurseSubmodules", "false")
 
+	// the objects found in the reference repository are not downloaded, but
+	// copied from it, so the clone doesn't depend on it; the clone is done as
+	// usual when it doesn't exist
+	if reference := build.GetGitReference(); reference != "" {
+		w.Notice("Using the reference repository %s...", reference)
+		args = append(args, "--reference-if-able", reference, "--dissociate")
+	}
+
 	if depth := build.GetGitDepth(); depth != "" {
 		w.Notice("Cloning repository for %s with git depth set to %s...", build.RefName, depth)
 		args = append(args, "--depth", depth, "--branch", build.RefName)
@@ -79,6 +143,13 @@ func (b *AbstractShell) writeFetchCmd(w ShellWriter, build *common.Build, projec
 	w.RmFile(".git/index.lock")
 	w.RmFile(".git/shallow.lock")
 
+	// the repositories cloned from a reference without --dissociate read its
+	// objects; copy them, as the fetch doesn't keep the reference up to date
+	w.IfFile(".git/objects/info/alternates")
+	w.Command("git", "repack", "-a", "-d", "-q")
+	w.RmFile(".git/objects/info/alternates")
+	w.EndIf()
+
 	w.Command("git", "clean", "-ffdx")
 	w.Command("git", "reset", "--hard")
 	w.Command("git", "remote", "set-url", "origin", build.GetRemoteURL())
@@ -125,7 +196,14 @@ func (b *AbstractShell) writeSubmoduleUpdateCmd(w ShellWriter, build *common.Bui
 	w.Command("git", args...)
 }
 
-func (b *AbstractShell) cacheFile(build *common.Build, userKey string) (key, file string) {
+// isPosixShell checks if the shell is one of the POSIX shells, which need
+// the slashes in the paths, like the Linux shells of WSL on Windows hosts
+func isPosixShell(shell string) bool {
+	_, ok := common.GetShell(shell).(*BashShell)
+	return ok
+}
+
+func (b *AbstractShell) cacheFile(build *common.Build, userKey string, posix bool) (key, file string) {
 	if build.CacheDir == "" {
 		return
 	}
@@ -146,6 +224,12 @@ func (b *AbstractShell) cacheFile(build *common.Build, userKey string) (key, fil
 	if err != nil {
 		return "", ""
 	}
+
+	// the path is used by the shell of the build, which can be a Linux
+	// shell on Windows hosts
+	if posix {
+		file = helpers.ToSlash(file)
+	}
 	return
 }
 
@@ -184,7 +268,7 @@ func (b *AbstractShell) cacheExtractor(w ShellWriter, options *archivingOptions,
 	}
 
 	// Skip archiving if no cache is defined
-	cacheKey, cacheFile := b.cacheFile(info.Build, options.Key)
+	cacheKey, cacheFile := b.cacheFile(info.Build, options.Key, isPosixShell(info.Shell))
 	if cacheKey == "" {
 		return
 	}
@@ -210,7 +294,33 @@ func (b *AbstractShell) cacheExtractor(w ShellWriter, options *archivingOptions,
 	})
 }
 
+// localArtifactsFile returns the path of the artifacts of the job kept in
+// the cache directory, relative to the build directory
+func (b *AbstractShell) localArtifactsFile(build *common.Build, name string) string {
+	if build.CacheDir == "" {
+		return ""
+	}
+
+	file, err := filepath.Rel(build.BuildDir, common.LocalArtifactsFile(build.CacheDir, name))
+	if err != nil {
+		return ""
+	}
+	return helpers.ToSlash(file)
+}
+
 func (b *AbstractShell) downloadArtifacts(w ShellWriter, build *common.BuildInfo, info common.ShellScriptInfo) {
+	// the builds run without GitLab extract the artifacts kept locally
+	if info.Build.Runner.URL == "" {
+		file := b.localArtifactsFile(info.Build, build.Name)
+		if file == "" {
+			return
+		}
+
+		w.Notice("Extracting local artifacts of %s...", build.Name)
+		w.Command(info.RunnerCommand, "cache-extractor", "--file", file)
+		return
+	}
+
 	args := []string{
 		"artifacts-downloader",
 		"--url",
@@ -356,21 +466,33 @@ func (b *AbstractShell) writeDownloadArtifactsScript(w ShellWriter, info common.
 // Write the given string of commands using the provided ShellWriter object.
 func (b *AbstractShell) writeCommands(w ShellWriter, commands string) {
 	commands = strings.TrimSpace(commands)
-	for _, command := range strings.Split(commands, "\n") {
+	b.writeCommandLines(w, strings.Split(commands, "\n"))
+}
+
+func (b *AbstractShell) writeCommandLines(w ShellWriter, commands []string) {
+	for _, command := range commands {
 		command = strings.TrimSpace(command)
 		if command != "" {
+			w.StartCommand()
 			w.Notice("$ %s", command)
 		} else {
 			w.EmptyLine()
 		}
 		w.Line(command)
 		w.CheckForErrors()
+		if command != "" {
+			w.EndCommand()
+		}
 	}
 }
 
 func (b *AbstractShell) writeUserScript(w ShellWriter, info common.ShellScriptInfo) (err error) {
 	b.writeExports(w, info)
-	b.writeCdBuildDir(w, info)
+	b.writeServerTLSInfo(w, info.Build)
+	err = b.writeCdWorkingDir(w, info, common.BuildStageUserScript)
+	if err != nil {
+		return err
+	}
 
 	if info.PreBuildScript != "" {
 		b.writeCommands(w, info.PreBuildScript)
@@ -386,13 +508,42 @@ func (b *AbstractShell) writeUserScript(w ShellWriter, info common.ShellScriptIn
 	return nil
 }
 
+func (b *AbstractShell) writeStepScript(w ShellWriter, info common.ShellScriptInfo, step *common.Step) error {
+	buildVariables := info.Build.GetAllVariables()
+	variables := append(buildVariables, step.Variables...)
+	for i, variable := range variables.Expand() {
+		if i >= len(buildVariables) {
+			// the variables of the step are not in the environment
+			variable.Masked = false
+		}
+		b.writeVariable(w, info, variable)
+	}
+	b.writeServerTLSInfo(w, info.Build)
+	err := b.writeCdWorkingDir(w, info, common.StepStage(step.Name))
+	if err != nil {
+		return err
+	}
+
+	if info.PreBuildScript != "" {
+		b.writeCommands(w, info.PreBuildScript)
+	}
+
+	b.writeCommandLines(w, step.Script)
+
+	if info.PostBuildScript != "" {
+		b.writeCommands(w, info.PostBuildScript)
+	}
+
+	return nil
+}
+
 func (b *AbstractShell) cacheArchiver(w ShellWriter, options *archivingOptions, info common.ShellScriptInfo) {
 	if options == nil {
 		return
 	}
 
 	// Skip archiving if no cache is defined
-	cacheKey, cacheFile := b.cacheFile(info.Build, options.Key)
+	cacheKey, cacheFile := b.cacheFile(info.Build, options.Key, isPosixShell(info.Shell))
 	if cacheKey == "" {
 		return
 	}
@@ -431,6 +582,7 @@ func (b *AbstractShell) uploadArtifacts(w ShellWriter, options *archivingOptions
 		return
 	}
 	if info.Build.Runner.URL == "" {
+		b.saveLocalArtifacts(w, options, info)
 		return
 	}
 
@@ -468,6 +620,25 @@ func (b *AbstractShell) uploadArtifacts(w ShellWriter, options *archivingOptions
 	})
 }
 
+// saveLocalArtifacts archives the artifacts of the builds run without
+// GitLab to the cache directory, for the next jobs
+func (b *AbstractShell) saveLocalArtifacts(w ShellWriter, options *archivingOptions, info common.ShellScriptInfo) {
+	file := b.localArtifactsFile(info.Build, info.Build.Name)
+	if file == "" {
+		return
+	}
+
+	archiverArgs := options.CommandArguments()
+	if len(archiverArgs) == 0 {
+		return
+	}
+
+	b.guardRunnerCommand(w, info.RunnerCommand, "Saving artifacts", func() {
+		w.Notice("Saving artifacts locally...")
+		w.Command(info.RunnerCommand, append([]string{"cache-archiver", "--file", file}, archiverArgs...)...)
+	})
+}
+
 func (b *AbstractShell) writeAfterScript(w ShellWriter, info common.ShellScriptInfo) error {
 	shellOptions := struct {
 		AfterScript []string `json:"after_script"`
@@ -482,21 +653,14 @@ func (b *AbstractShell) writeAfterScript(w ShellWriter, info common.ShellScriptI
 	}
 
 	b.writeExports(w, info)
-	b.writeCdBuildDir(w, info)
-
-	w.Notice("Running after script...")
-
-	for _, command := range shellOptions.AfterScript {
-		command = strings.TrimSpace(command)
-		if command != "" {
-			w.Notice("$ %s", command)
-		} else {
-			w.EmptyLine()
-		}
-		w.Line(command)
-		w.CheckForErrors()
+	b.writeServerTLSInfo(w, info.Build)
+	err = b.writeCdWorkingDir(w, info, common.BuildStageAfterScript)
+	if err != nil {
+		return err
 	}
 
+	w.Notice("Running after script...")
+	b.writeCommandLines(w, shellOptions.AfterScript)
 	return nil
 }
 
@@ -535,6 +699,10 @@ func (b *AbstractShell) writeUploadArtifactsScript(w ShellWriter, info common.Sh
 }
 
 func (b *AbstractShell) writeScript(w ShellWriter, buildStage common.BuildStage, info common.ShellScriptInfo) error {
+	return transformScriptWriter(b.writeStageScript)(w, buildStage, info)
+}
+
+func (b *AbstractShell) writeStageScript(w ShellWriter, buildStage common.BuildStage, info common.ShellScriptInfo) error {
 	methods := map[common.BuildStage]func(ShellWriter, common.ShellScriptInfo) error{
 		common.BuildStagePrepare:           b.writePrepareScript,
 		common.BuildStageGetSources:        b.writeGetSourcesScript,
@@ -546,6 +714,10 @@ func (b *AbstractShell) writeScript(w ShellWriter, buildStage common.BuildStage,
 		common.BuildStageUploadArtifacts:   b.writeUploadArtifactsScript,
 	}
 
+	if step := info.Build.GetStep(buildStage); step != nil {
+		return b.writeStepScript(w, info, step)
+	}
+
 	fn := methods[buildStage]
 	if fn == nil {
 		return errors.New("Not supported script type: " + string(buildStage))
@@ -32,6 +32,19 @@ fi
 
 `
 
+const zshDetectShell = `if [ -x /usr/local/bin/zsh ]; then
+	exec /usr/local/bin/zsh $@
+elif [ -x /usr/bin/zsh ]; then
+	exec /usr/bin/zsh $@
+elif [ -x /bin/zsh ]; then
+	exec /bin/zsh $@
+else
+	echo shell not found
+	exit 1
+fi
+
+`
+
 type BashShell struct {
 	AbstractShell
 	Shell string
@@ -40,7 +53,53 @@ type BashShell struct {
 type BashWriter struct {
 	bytes.Buffer
 	TemporaryPath string
+	Shell         string
+	Options       []BashOption
 	indent        int
+	commands      int
+}
+
+// BashOption is an option of set -o, turned on or off for the script
+type BashOption struct {
+	Name    string
+	Enabled bool
+}
+
+// bashOptions are the options of set -o which can be set by the builds.
+// errexit can't be turned off, as the scripts rely on it.
+var bashOptions = []string{"allexport", "errtrace", "functrace", "noclobber", "noglob", "nounset", "pipefail", "verbose", "xtrace"}
+
+// bashTraceOptions print the commands with the values of the variables, so
+// they're allowed only with the debug trace, which masks the secrets
+var bashTraceOptions = map[string]bool{"verbose": true, "xtrace": true}
+
+func isBashOption(name string) bool {
+	for _, option := range bashOptions {
+		if option == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseBashOptions parses the options separated with spaces or commas, like
+// "xtrace +pipefail", where the options starting with + are turned off
+func parseBashOptions(value string, debugTrace bool) (options []BashOption, err error) {
+	for _, field := range strings.Fields(strings.Replace(value, ",", " ", -1)) {
+		name := strings.TrimPrefix(field, "+")
+		enabled := !strings.HasPrefix(field, "+")
+
+		if !isBashOption(name) {
+			return nil, fmt.Errorf("invalid option %q of %s, the supported options are: %s",
+				field, common.ShellOptionsVariable, strings.Join(bashOptions, ", "))
+		}
+		if enabled && bashTraceOptions[name] && !debugTrace {
+			return nil, fmt.Errorf("the %s option of %s prints the secret variables, it requires %s, which masks them",
+				name, common.ShellOptionsVariable, "CI_DEBUG_TRACE")
+		}
+		options = append(options, BashOption{Name: name, Enabled: enabled})
+	}
+	return
 }
 
 func (b *BashWriter) GetTemporaryPath() string {
@@ -51,9 +110,33 @@ func (b *BashWriter) Line(text string) {
 	b.WriteString(strings.Repeat("  ", b.indent) + text + "\n")
 }
 
+// echo returns the command printing its arguments as they are. The echo
+// builtin of zsh interprets the escape sequences, unless -E is given.
+func (b *BashWriter) echo() string {
+	if b.Shell == "zsh" {
+		return "echo -E"
+	}
+	return "echo"
+}
+
 func (b *BashWriter) CheckForErrors() {
 }
 
+// StartCommand writes the section marker of the command, hidden by the
+// erase line sequence, and keeps its index for the EXIT trap
+func (b *BashWriter) StartCommand() {
+	b.commands++
+	b.Line(fmt.Sprintf("ci_command=%d", b.commands))
+	b.Line(fmt.Sprintf(`printf 'section_start:%%s:command_%d\r\033[0K' "$(date +%%s)"`, b.commands))
+}
+
+// EndCommand closes the section of the command which succeeded, the one of
+// the failing command is closed by the EXIT trap
+func (b *BashWriter) EndCommand() {
+	b.Line(fmt.Sprintf(`printf 'section_end:%%s:command_%d\r\033[0K' "$(date +%%s)"`, b.commands))
+	b.Line("unset ci_command")
+}
+
 func (b *BashWriter) Indent() {
 	b.indent++
 }
@@ -82,7 +165,13 @@ func (b *BashWriter) Variable(variable common.BuildVariable) {
 	if variable.File {
 		variableFile := b.Absolute(path.Join(b.TemporaryPath, variable.Key))
 		b.Line(fmt.Sprintf("mkdir -p %q", helpers.ToSlash(b.TemporaryPath)))
-		b.Line(fmt.Sprintf("echo -n %s > %q", helpers.ShellEscape(variable.Value), variableFile))
+		// the file is readable only by the user, as it often holds credentials
+		value := helpers.ShellEscape(variable.Value)
+		if variable.Masked {
+			// the value is in the environment, to not print it
+			value = fmt.Sprintf("\"$%s\"", variable.Key)
+		}
+		b.Line(fmt.Sprintf("(umask 077 && printf '%%s' %s > %q)", value, variableFile))
 		b.Line(fmt.Sprintf("export %s=%q", helpers.ShellEscape(variable.Key), variableFile))
 	} else {
 		b.Line(fmt.Sprintf("export %s=%s", helpers.ShellEscape(variable.Key), helpers.ShellEscape(variable.Value)))
@@ -148,22 +237,22 @@ func (b *BashWriter) Absolute(dir string) string {
 
 func (b *BashWriter) Print(format string, arguments ...interface{}) {
 	coloredText := helpers.ANSI_RESET + fmt.Sprintf(format, arguments...)
-	b.Line("echo " + helpers.ShellEscape(coloredText))
+	b.Line(b.echo() + " " + helpers.ShellEscape(coloredText))
 }
 
 func (b *BashWriter) Notice(format string, arguments ...interface{}) {
 	coloredText := helpers.ANSI_BOLD_GREEN + fmt.Sprintf(format, arguments...) + helpers.ANSI_RESET
-	b.Line("echo " + helpers.ShellEscape(coloredText))
+	b.Line(b.echo() + " " + helpers.ShellEscape(coloredText))
 }
 
 func (b *BashWriter) Warning(format string, arguments ...interface{}) {
 	coloredText := helpers.ANSI_YELLOW + fmt.Sprintf(format, arguments...) + helpers.ANSI_RESET
-	b.Line("echo " + helpers.ShellEscape(coloredText))
+	b.Line(b.echo() + " " + helpers.ShellEscape(coloredText))
 }
 
 func (b *BashWriter) Error(format string, arguments ...interface{}) {
 	coloredText := helpers.ANSI_BOLD_RED + fmt.Sprintf(format, arguments...) + helpers.ANSI_RESET
-	b.Line("echo " + helpers.ShellEscape(coloredText))
+	b.Line(b.echo() + " " + helpers.ShellEscape(coloredText))
 }
 
 func (b *BashWriter) EmptyLine() {
@@ -178,9 +267,42 @@ func (b *BashWriter) Finish(trace bool) string {
 		io.WriteString(w, "set -o xtrace\n")
 	}
 
-	io.WriteString(w, "set -eo pipefail\n")
+	pipefail := true
+	for _, option := range b.Options {
+		if option.Name == "pipefail" {
+			pipefail = option.Enabled
+		}
+	}
+
+	if pipefail {
+		io.WriteString(w, "set -eo pipefail\n")
+	} else {
+		io.WriteString(w, "set -e\n")
+	}
 	io.WriteString(w, "set +o noclobber\n")
-	io.WriteString(w, ": | eval "+helpers.ShellEscape(b.String())+"\n")
+
+	for _, option := range b.Options {
+		if option.Name == "pipefail" {
+			continue
+		}
+		if option.Enabled {
+			io.WriteString(w, "set -o "+option.Name+"\n")
+		} else {
+			io.WriteString(w, "set +o "+option.Name+"\n")
+		}
+	}
+
+	script := b.String()
+	if b.commands > 0 {
+		// the commands exit the script on errors, so the failing one is
+		// reported when the subshell running the eval exits
+		report := `ci_exit_code=$?; if [ $ci_exit_code -ne 0 ] && [ -n "${ci_command:-}" ]; then ` +
+			`printf 'section_end:%s:command_%s\r\033[0K' "$(date +%s)" "$ci_command"; ` +
+			`printf '\033[31;1mCommand %s failed with exit code %s\033[0;m\n' "$ci_command" "$ci_exit_code"; fi`
+		script = "trap " + helpers.ShellEscape(report) + " EXIT\n" + script
+	}
+
+	io.WriteString(w, ": | eval "+helpers.ShellEscape(script)+"\n")
 	io.WriteString(w, "exit 0\n")
 	w.Flush()
 	return buffer.String()
@@ -191,13 +313,18 @@ func (b *BashShell) GetName() string {
 }
 
 func (b *BashShell) GetConfiguration(info common.ShellScriptInfo) (script *common.ShellConfiguration, err error) {
+	detectShell := bashDetectShell
+	if b.Shell == "zsh" {
+		detectShell = zshDetectShell
+	}
+
 	var detectScript string
 	var shellCommand string
 	if info.Type == common.LoginShell {
-		detectScript = strings.Replace(bashDetectShell, "$@", "--login", -1)
+		detectScript = strings.Replace(detectShell, "$@", "--login", -1)
 		shellCommand = b.Shell + " --login"
 	} else {
-		detectScript = strings.Replace(bashDetectShell, "$@", "", -1)
+		detectScript = strings.Replace(detectShell, "$@", "", -1)
 		shellCommand = b.Shell
 	}
 
@@ -219,12 +346,18 @@ func (b *BashShell) GetConfiguration(info common.ShellScriptInfo) (script *commo
 		}
 	}
 
-	return
+	return prefixShell(script, info), nil
 }
 
 func (b *BashShell) GenerateScript(buildStage common.BuildStage, info common.ShellScriptInfo) (script string, err error) {
 	w := &BashWriter{
 		TemporaryPath: info.Build.FullProjectDir() + ".tmp",
+		Shell:         b.Shell,
+	}
+
+	w.Options, err = parseBashOptions(info.Build.GetAllVariables().Get(common.ShellOptionsVariable), info.Build.IsDebugTraceEnabled())
+	if err != nil {
+		return "", err
 	}
 
 	if buildStage == common.BuildStagePrepare {
@@ -247,4 +380,5 @@ func (b *BashShell) IsDefault() bool {
 func init() {
 	common.RegisterShell(&BashShell{Shell: "sh"})
 	common.RegisterShell(&BashShell{Shell: "bash"})
+	common.RegisterShell(&BashShell{Shell: "zsh"})
 }
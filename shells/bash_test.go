@@ -4,6 +4,9 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
 )
 
 func TestBash_CommandShellEscapes(t *testing.T) {
@@ -19,3 +22,289 @@ func TestBash_IfCmdShellEscapes(t *testing.T) {
 
 	assert.Equal(t, `if $'foo' "x&(y)" >/dev/null 2>/dev/null; then`+"\n", writer.String())
 }
+
+func TestZsh_PrintDoesntInterpretEscapes(t *testing.T) {
+	writer := &BashWriter{Shell: "zsh"}
+	writer.Print(`C:\temp`)
+
+	assert.Equal(t, `echo -E $'\x1b[0;mC:\\temp'`+"\n", writer.String())
+}
+
+func TestZsh_GetConfiguration(t *testing.T) {
+	shell := &BashShell{Shell: "zsh"}
+
+	config, err := shell.GetConfiguration(common.ShellScriptInfo{Type: common.LoginShell})
+	require.NoError(t, err)
+	assert.Equal(t, "zsh", config.Command)
+	assert.Equal(t, []string{"--login"}, config.Arguments)
+	require.Equal(t, 3, len(config.DockerCommand))
+	assert.Contains(t, config.DockerCommand[2], "exec /bin/zsh --login")
+	assert.NotContains(t, config.DockerCommand[2], "bash")
+}
+
+func TestBash_ParseOptions(t *testing.T) {
+	options, err := parseBashOptions("xtrace, +pipefail nounset", true)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(options))
+	assert.Equal(t, BashOption{Name: "xtrace", Enabled: true}, options[0])
+	assert.Equal(t, BashOption{Name: "pipefail", Enabled: false}, options[1])
+	assert.Equal(t, BashOption{Name: "nounset", Enabled: true}, options[2])
+
+	for _, value := range []string{"+errexit", "$(rm)", "+", "pipefial"} {
+		_, err = parseBashOptions(value, true)
+		assert.Error(t, err, value)
+	}
+	_, err = parseBashOptions("pipefial", true)
+	assert.EqualError(t, err, `invalid option "pipefial" of CI_SHELL_OPTIONS, the supported options are: allexport, errtrace, functrace, noclobber, noglob, nounset, pipefail, verbose, xtrace`)
+}
+
+func TestBash_ParseTraceOptionsWithoutDebugTrace(t *testing.T) {
+	for _, value := range []string{"xtrace", "verbose"} {
+		_, err := parseBashOptions(value, false)
+		assert.Error(t, err, value)
+	}
+
+	options, err := parseBashOptions("+xtrace", false)
+	require.NoError(t, err)
+	assert.Equal(t, []BashOption{{Name: "xtrace", Enabled: false}}, options)
+}
+
+func TestBash_FinishWithOptions(t *testing.T) {
+	writer := &BashWriter{}
+	assert.Equal(t, "set -eo pipefail\nset +o noclobber\n: | eval ''\nexit 0\n", writer.Finish(false))
+
+	writer.Options = []BashOption{{Name: "pipefail"}, {Name: "noclobber", Enabled: true}, {Name: "xtrace", Enabled: true}}
+	assert.Equal(t, "set -e\nset +o noclobber\nset -o noclobber\nset -o xtrace\n: | eval ''\nexit 0\n", writer.Finish(false))
+}
+
+func TestBash_ColorVariables(t *testing.T) {
+	shell := &AbstractShell{}
+	info := common.ShellScriptInfo{
+		Build: &common.Build{
+			Runner: &common.RunnerConfig{
+				RunnerSettings: common.RunnerSettings{
+					Color:       common.ColorNever,
+					Environment: []string{"TERM=vt100"},
+				},
+			},
+		},
+	}
+
+	writer := &BashWriter{}
+	shell.writeExports(writer, info)
+	assert.Contains(t, writer.String(), "export NO_COLOR=1\n")
+	assert.Contains(t, writer.String(), "export TERM=$'dumb'\nexport TERM=$'vt100'\n")
+
+	info.Build.Runner.Color = common.ColorAlways
+	writer = &BashWriter{}
+	shell.writeExports(writer, info)
+	assert.Contains(t, writer.String(), "export FORCE_COLOR=1\n")
+	assert.NotContains(t, writer.String(), "NO_COLOR")
+}
+
+func TestBash_StartCommand(t *testing.T) {
+	writer := &BashWriter{}
+	writer.StartCommand()
+	writer.EndCommand()
+	writer.StartCommand()
+
+	assert.Equal(t, "ci_command=1\nprintf 'section_start:%s:command_1\\r\\033[0K' \"$(date +%s)\"\n"+
+		"printf 'section_end:%s:command_1\\r\\033[0K' \"$(date +%s)\"\nunset ci_command\n"+
+		"ci_command=2\nprintf 'section_start:%s:command_2\\r\\033[0K' \"$(date +%s)\"\n", writer.String())
+
+	script := writer.Finish(false)
+	assert.Contains(t, script, ": | eval $'trap ")
+	assert.Contains(t, script, "section_end:%s:command_%s")
+}
+
+func TestBash_StepScript(t *testing.T) {
+	shell := &AbstractShell{}
+	info := common.ShellScriptInfo{
+		Build: &common.Build{
+			GetBuildResponse: common.GetBuildResponse{
+				Steps: []common.Step{
+					{Name: "build", Script: []string{"make"}},
+					{
+						Name:      "test",
+						Script:    []string{"make test"},
+						Variables: common.BuildVariables{{Key: "SUITE", Value: "unit-$CI"}},
+					},
+				},
+			},
+			Runner: &common.RunnerConfig{},
+		},
+	}
+
+	writer := &BashWriter{}
+	err := shell.writeScript(writer, common.StepStage("test"), info)
+	require.NoError(t, err)
+	assert.Contains(t, writer.String(), "export SUITE=$'unit-true'\n")
+	assert.Contains(t, writer.String(), "\nmake test\n")
+	assert.NotContains(t, writer.String(), "\nmake\n")
+}
+
+func TestBash_FileVariable(t *testing.T) {
+	writer := &BashWriter{TemporaryPath: "/builds/project.tmp"}
+	writer.Variable(common.BuildVariable{Key: "KUBECONFIG", Value: "apiVersion: v1\n", File: true})
+
+	assert.Equal(t, "mkdir -p \"/builds/project.tmp\"\n"+
+		"(umask 077 && printf '%s' $'apiVersion: v1\\n' > \"/builds/project.tmp/KUBECONFIG\")\n"+
+		"export KUBECONFIG=\"/builds/project.tmp/KUBECONFIG\"\n", writer.String())
+}
+
+func TestBash_MaskedVariables(t *testing.T) {
+	shell := &AbstractShell{}
+	info := common.ShellScriptInfo{
+		Build: &common.Build{
+			GetBuildResponse: common.GetBuildResponse{
+				Variables: common.BuildVariables{
+					{Key: "TOKEN", Value: "secret", Masked: true},
+					{Key: "KEY_FILE", Value: "secret-key", Masked: true, File: true},
+				},
+			},
+			Runner: &common.RunnerConfig{},
+		},
+	}
+
+	writer := &BashWriter{TemporaryPath: "/builds/project.tmp"}
+	shell.writeExports(writer, info)
+	assert.Contains(t, writer.String(), "export TOKEN=$'secret'\n")
+	assert.Contains(t, writer.String(), "printf '%s' $'secret-key' >")
+
+	info.MaskedVariablesInEnvironment = true
+	writer = &BashWriter{TemporaryPath: "/builds/project.tmp"}
+	shell.writeExports(writer, info)
+	assert.NotContains(t, writer.String(), "secret")
+	assert.Contains(t, writer.String(), "(umask 077 && printf '%s' \"$KEY_FILE\" > \"/builds/project.tmp/KEY_FILE\")\n")
+	assert.Contains(t, writer.String(), "export KEY_FILE=\"/builds/project.tmp/KEY_FILE\"\n")
+}
+
+func TestBash_LocalArtifacts(t *testing.T) {
+	shell := &AbstractShell{}
+	info := common.ShellScriptInfo{
+		RunnerCommand: "gitlab-runner",
+		Build: &common.Build{
+			GetBuildResponse: common.GetBuildResponse{
+				Name:            "test",
+				Options:         common.BuildOptions{"artifacts": map[string]interface{}{"paths": []interface{}{"out/"}}},
+				DependsOnBuilds: []common.BuildInfo{{Name: "build", Artifacts: &common.BuildArtifacts{Filename: "artifacts.zip"}}},
+			},
+			Runner: &common.RunnerConfig{},
+		},
+	}
+	info.Build.BuildDir = "/builds/project-1"
+	info.Build.CacheDir = "/cache/project-1"
+
+	writer := &BashWriter{}
+	err := shell.writeScript(writer, common.BuildStageUploadArtifacts, info)
+	require.NoError(t, err)
+	assert.Contains(t, writer.String(), "\"cache-archiver\" \"--file\" \"../../cache/project-1/artifacts/test/artifacts.zip\" \"--path\" \"out/\"\n")
+
+	writer = &BashWriter{}
+	err = shell.writeScript(writer, common.BuildStageDownloadArtifacts, info)
+	require.NoError(t, err)
+	assert.Contains(t, writer.String(), "\"cache-extractor\" \"--file\" \"../../cache/project-1/artifacts/build/artifacts.zip\"\n")
+	assert.NotContains(t, writer.String(), "artifacts-downloader")
+}
+
+func TestBash_WorkingDirectories(t *testing.T) {
+	shell := &AbstractShell{}
+	info := common.ShellScriptInfo{
+		Build: &common.Build{
+			GetBuildResponse: common.GetBuildResponse{
+				Commands: "make",
+				Options:  common.BuildOptions{"working_directories": map[string]interface{}{"build_script": "services/api"}},
+				Steps:    []common.Step{{Name: "lint", Script: []string{"make lint"}, WorkingDirectory: "web"}},
+			},
+			Runner: &common.RunnerConfig{},
+		},
+	}
+	info.Build.BuildDir = "/builds/project"
+
+	writer := &BashWriter{}
+	err := shell.writeScript(writer, common.BuildStageUserScript, info)
+	require.NoError(t, err)
+	assert.Contains(t, writer.String(), "$'cd' \"/builds/project/services/api\"\n")
+
+	writer = &BashWriter{}
+	err = shell.writeScript(writer, common.StepStage("lint"), info)
+	require.NoError(t, err)
+	assert.Contains(t, writer.String(), "$'cd' \"/builds/project/web\"\n")
+
+	info.Build.Options["working_directories"] = map[string]interface{}{"build_script": "../other"}
+	err = shell.writeScript(&BashWriter{}, common.BuildStageUserScript, info)
+	assert.EqualError(t, err, "Working directory of build_script must be inside the project directory: ../other")
+}
+
+func TestBash_CloneWithGitReference(t *testing.T) {
+	shell := &AbstractShell{}
+	build := &common.Build{
+		GetBuildResponse: common.GetBuildResponse{
+			RepoURL: "https://gitlab.example.com/group/monorepo.git",
+		},
+		Runner: &common.RunnerConfig{
+			RunnerSettings: common.RunnerSettings{
+				GitReference:  "/mirrors/default.git",
+				GitReferences: map[string]string{"group/monorepo": "/mirrors/monorepo.git"},
+			},
+		},
+	}
+
+	writer := &BashWriter{}
+	shell.writeCloneCmd(writer, build, "/builds/group/monorepo")
+	assert.Contains(t, writer.String(), `"--reference-if-able" "/mirrors/monorepo.git" "--dissociate"`)
+
+	build.RepoURL = "https://gitlab.example.com/group/other.git"
+	writer = &BashWriter{}
+	shell.writeCloneCmd(writer, build, "/builds/group/other")
+	assert.Contains(t, writer.String(), `"--reference-if-able" "/mirrors/default.git" "--dissociate"`)
+
+	build.Runner.GitReference = ""
+	writer = &BashWriter{}
+	shell.writeCloneCmd(writer, build, "/builds/group/other")
+	assert.NotContains(t, writer.String(), "--reference-if-able")
+}
+
+func TestBash_FetchDissociatesReference(t *testing.T) {
+	shell := &AbstractShell{}
+	build := &common.Build{
+		GetBuildResponse: common.GetBuildResponse{
+			RepoURL: "https://gitlab.example.com/group/monorepo.git",
+		},
+		Runner: &common.RunnerConfig{},
+	}
+
+	writer := &BashWriter{}
+	shell.writeFetchCmd(writer, build, "/builds/group/monorepo", "/builds/group/monorepo/.git")
+	assert.Contains(t, writer.String(), `if [[ -e ".git/objects/info/alternates" ]]; then`)
+	assert.Contains(t, writer.String(), `$'git' "repack" "-a" "-d" "-q"`)
+}
+
+func TestBash_ServerTLSInfo(t *testing.T) {
+	shell := &AbstractShell{}
+	info := common.ShellScriptInfo{
+		Build: &common.Build{
+			GetBuildResponse: common.GetBuildResponse{
+				Commands:   "git ls-remote https://gitlab.example.com/group/project.git",
+				TLSCAChain: "-----BEGIN CERTIFICATE-----",
+			},
+			Runner: &common.RunnerConfig{
+				RunnerCredentials: common.RunnerCredentials{URL: "https://gitlab.example.com/ci"},
+			},
+		},
+	}
+
+	writer := &BashWriter{TemporaryPath: "/builds/project.tmp"}
+	err := shell.writeScript(writer, common.BuildStageUserScript, info)
+	require.NoError(t, err)
+	assert.Contains(t, writer.String(), "export CI_SERVER_TLS_CA_FILE=\"/builds/project.tmp/CI_SERVER_TLS_CA_FILE\"\n")
+	assert.Contains(t, writer.String(), "export GIT_CONFIG_KEY_0=$'http.https://gitlab.example.com/.sslCAInfo'\n")
+	assert.Contains(t, writer.String(), "export GIT_CONFIG_VALUE_0=\"/builds/project.tmp/GIT_CONFIG_VALUE_0\"\n")
+
+	info.Build.Variables = common.BuildVariables{{Key: "GIT_CONFIG_COUNT", Value: "2"}}
+	writer = &BashWriter{TemporaryPath: "/builds/project.tmp"}
+	err = shell.writeScript(writer, common.BuildStageUserScript, info)
+	require.NoError(t, err)
+	assert.Contains(t, writer.String(), "export CI_SERVER_TLS_CA_FILE=")
+	assert.NotContains(t, writer.String(), "GIT_CONFIG_KEY_0")
+}
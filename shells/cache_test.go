@@ -95,3 +95,21 @@ func TestGetCacheObjectNameWhenSharedFlagIsFalseThenRunnerSegmentShouldNotBePres
 	url := getCacheObjectName(s3CacheBuild, s3Cache, "key")
 	require.Equal(t, "project/10/key", url)
 }
+
+func TestCacheFile(t *testing.T) {
+	build := &common.Build{
+		BuildDir: "/builds/project",
+		CacheDir: "/cache",
+	}
+	shell := &AbstractShell{}
+
+	key, file := shell.cacheFile(build, `release\v1`, true)
+	assert.Equal(t, `release\v1`, key)
+	assert.Equal(t, "../../cache/release/v1/cache.zip", file)
+
+	_, file = shell.cacheFile(build, `release\v1`, false)
+	assert.Equal(t, `../../cache/release\v1/cache.zip`, file)
+
+	assert.True(t, isPosixShell("sh"))
+	assert.False(t, isPosixShell("pwsh"))
+}
@@ -22,6 +22,8 @@ type CmdWriter struct {
 	bytes.Buffer
 	TemporaryPath string
 	indent        int
+	commands      int
+	command       int
 }
 
 func batchQuote(text string) string {
@@ -68,7 +70,30 @@ func (b *CmdWriter) Line(text string) {
 }
 
 func (b *CmdWriter) CheckForErrors() {
-	b.checkErrorLevel()
+	if b.command == 0 {
+		b.checkErrorLevel()
+		return
+	}
+
+	b.Line("IF !errorlevel! NEQ 0 (")
+	b.Indent()
+	failed := batchEscapeVariable(fmt.Sprintf("%sCommand %d failed with exit code ", helpers.ANSI_BOLD_RED, b.command))
+	b.Line("echo " + failed + "!errorlevel!" + batchEscapeVariable(helpers.ANSI_RESET))
+	b.Line("exit /b !errorlevel!")
+	b.Unindent()
+	b.Line(")")
+	b.Line("")
+}
+
+// StartCommand keeps the index of the command, to report it when it fails.
+// The section marker isn't written, as Batch can't get the Unix time.
+func (b *CmdWriter) StartCommand() {
+	b.commands++
+	b.command = b.commands
+}
+
+func (b *CmdWriter) EndCommand() {
+	b.command = 0
 }
 
 func (b *CmdWriter) Indent() {
@@ -79,8 +104,12 @@ func (b *CmdWriter) Unindent() {
 	b.indent--
 }
 
+// checkErrorLevel exits the script with the exit code of the last command,
+// when it failed. The delayed expansion of !errorlevel! is needed to read the
+// exit code inside of the parentheses, where %errorlevel% is expanded once,
+// before any of the commands of the block is run.
 func (b *CmdWriter) checkErrorLevel() {
-	b.Line("IF %errorlevel% NEQ 0 exit /b %errorlevel%")
+	b.Line("IF !errorlevel! NEQ 0 exit /b !errorlevel!")
 	b.Line("")
 }
 
@@ -106,7 +135,11 @@ func (b *CmdWriter) Variable(variable common.BuildVariable) {
 		variableFile := b.Absolute(path.Join(b.TemporaryPath, variable.Key))
 		variableFile = helpers.ToBackslash(variableFile)
 		b.Line(fmt.Sprintf("md %q 2>NUL 1>NUL", batchEscape(helpers.ToBackslash(b.TemporaryPath))))
-		b.Line(fmt.Sprintf("echo %s > %s", batchEscapeVariable(variable.Value), batchEscape(variableFile)))
+		value := batchEscapeVariable(variable.Value)
+		if variable.Masked {
+			value = "!" + variable.Key + "!"
+		}
+		b.Line(fmt.Sprintf("echo %s > %s", value, batchEscape(variableFile)))
 		b.Line("SET " + batchEscapeVariable(variable.Key) + "=" + batchEscape(variableFile))
 	} else {
 		b.Line("SET " + batchEscapeVariable(variable.Key) + "=" + batchEscapeVariable(variable.Value))
@@ -126,7 +159,7 @@ func (b *CmdWriter) IfFile(path string) {
 func (b *CmdWriter) IfCmd(cmd string, arguments ...string) {
 	cmdline := b.buildCommand(cmd, arguments...)
 	b.Line(fmt.Sprintf("%s 2>NUL 1>NUL", cmdline))
-	b.Line("IF %errorlevel% EQU 0 (")
+	b.Line("IF !errorlevel! EQU 0 (")
 	b.Indent()
 }
 
@@ -142,13 +175,18 @@ func (b *CmdWriter) EndIf() {
 }
 
 func (b *CmdWriter) Cd(path string) {
-	b.Line("cd /D " + batchQuote(helpers.ToBackslash(path)))
+	if helpers.IsUNCPath(path) {
+		// cd can't change to the UNC paths, pushd maps them to a drive first
+		b.Line("pushd " + batchQuote(helpers.ToBackslash(path)))
+	} else {
+		b.Line("cd /D " + batchQuote(helpers.ToBackslash(path)))
+	}
 	b.checkErrorLevel()
 }
 
 func (b *CmdWriter) MkDir(path string) {
-	args := batchQuote(helpers.ToBackslash(path)) + " 2>NUL 1>NUL"
-	b.Line("dir " + args + " || md " + args)
+	b.Line("dir " + batchQuote(helpers.ToBackslash(path)) + " 2>NUL 1>NUL || " +
+		"md " + batchQuote(helpers.ToExtendedLengthPath(path)) + " 2>NUL 1>NUL")
 }
 
 func (b *CmdWriter) MkTmpDir(name string) string {
@@ -158,12 +196,14 @@ func (b *CmdWriter) MkTmpDir(name string) string {
 	return path
 }
 
+// RmDir removes the directory with its extended-length path, so the files
+// nested deeper than 260 characters, like in node_modules, are removed too
 func (b *CmdWriter) RmDir(path string) {
-	b.Line("rd /s /q " + batchQuote(helpers.ToBackslash(path)) + " 2>NUL 1>NUL")
+	b.Line("rd /s /q " + batchQuote(helpers.ToExtendedLengthPath(path)) + " 2>NUL 1>NUL")
 }
 
 func (b *CmdWriter) RmFile(path string) {
-	b.Line("rd /s /q " + batchQuote(helpers.ToBackslash(path)) + " 2>NUL 1>NUL")
+	b.Line("rd /s /q " + batchQuote(helpers.ToExtendedLengthPath(path)) + " 2>NUL 1>NUL")
 }
 
 func (b *CmdWriter) Print(format string, arguments ...interface{}) {
@@ -191,7 +231,7 @@ func (b *CmdWriter) EmptyLine() {
 }
 
 func (b *CmdWriter) Absolute(dir string) string {
-	if filepath.IsAbs(dir) {
+	if filepath.IsAbs(dir) || helpers.IsUNCPath(dir) {
 		return dir
 	}
 	return filepath.Join("%CD%", dir)
@@ -223,7 +263,7 @@ func (b *CmdShell) GetConfiguration(info common.ShellScriptInfo) (script *common
 		PassFile:  true,
 		Extension: "cmd",
 	}
-	return
+	return prefixShell(script, info), nil
 }
 
 func (b *CmdShell) GenerateScript(buildStage common.BuildStage, info common.ShellScriptInfo) (script string, err error) {
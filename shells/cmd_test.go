@@ -50,21 +50,72 @@ func TestCMD_CDShellEscapes(t *testing.T) {
 	} {
 		writer := &CmdWriter{}
 		writer.Cd(tc.in)
-		expected := fmt.Sprintf("cd /D \"%s\"\r\nIF %%errorlevel%% NEQ 0 exit /b %%errorlevel%%\r\n\r\n", tc.out)
+		expected := fmt.Sprintf("cd /D \"%s\"\r\nIF !errorlevel! NEQ 0 exit /b !errorlevel!\r\n\r\n", tc.out)
 		assert.Equal(t, expected, writer.String(), "case %d", i)
 	}
 }
 
+func TestCMD_CDToUNCPath(t *testing.T) {
+	writer := &CmdWriter{}
+	writer.Cd("//server/share/builds")
+
+	assert.Equal(t, "pushd \"\\\\server\\share\\builds\"\r\nIF !errorlevel! NEQ 0 exit /b !errorlevel!\r\n\r\n", writer.String())
+}
+
+func TestCMD_DirectoriesUseExtendedLengthPaths(t *testing.T) {
+	writer := &CmdWriter{}
+	writer.MkDir(`C:\builds\project`)
+	writer.RmDir(`\\server\share\builds\project`)
+
+	assert.Equal(t, "dir \"C:\\builds\\project\" 2>NUL 1>NUL || md \"\\\\?\\C:\\builds\\project\" 2>NUL 1>NUL\r\n"+
+		"rd /s /q \"\\\\?\\UNC\\server\\share\\builds\\project\" 2>NUL 1>NUL\r\n", writer.String())
+}
+
 func TestCMD_CommandShellEscapes(t *testing.T) {
 	writer := &CmdWriter{}
 	writer.Command("foo", "x&(y)")
 
-	assert.Equal(t, "\"foo\" \"x^&(y)\"\r\nIF %errorlevel% NEQ 0 exit /b %errorlevel%\r\n\r\n", writer.String())
+	assert.Equal(t, "\"foo\" \"x^&(y)\"\r\nIF !errorlevel! NEQ 0 exit /b !errorlevel!\r\n\r\n", writer.String())
 }
 
 func TestCMD_IfCmdShellEscapes(t *testing.T) {
 	writer := &CmdWriter{}
 	writer.IfCmd("foo", "x&(y)")
 
-	assert.Equal(t, "\"foo\" \"x^&(y)\" 2>NUL 1>NUL\r\nIF %errorlevel% EQU 0 (\r\n", writer.String())
+	assert.Equal(t, "\"foo\" \"x^&(y)\" 2>NUL 1>NUL\r\nIF !errorlevel! EQU 0 (\r\n", writer.String())
+}
+
+func TestCMD_CheckForErrorsInsideOfBlocks(t *testing.T) {
+	writer := &CmdWriter{}
+	writer.IfDirectory("vendor")
+	writer.Command("foo")
+	writer.Line("call build.cmd")
+	writer.CheckForErrors()
+	writer.EndIf()
+
+	expected := "IF EXIST \"vendor\" (\r\n" +
+		"  \"foo\"\r\n" +
+		"  IF !errorlevel! NEQ 0 exit /b !errorlevel!\r\n" +
+		"  \r\n" +
+		"  call build.cmd\r\n" +
+		"  IF !errorlevel! NEQ 0 exit /b !errorlevel!\r\n" +
+		"  \r\n" +
+		")\r\n"
+	assert.Equal(t, expected, writer.String())
+	assert.NotContains(t, writer.String(), "%errorlevel%")
+}
+
+func TestCMD_ReportsFailedCommand(t *testing.T) {
+	writer := &CmdWriter{}
+	writer.StartCommand()
+	writer.EndCommand()
+	writer.StartCommand()
+	writer.CheckForErrors()
+
+	expected := "IF !errorlevel! NEQ 0 (\r\n" +
+		"  echo \x1b[31;1mCommand 2 failed with exit code !errorlevel!\x1b[0;m\r\n" +
+		"  exit /b !errorlevel!\r\n" +
+		")\r\n" +
+		"\r\n"
+	assert.Equal(t, expected, writer.String())
 }
@@ -0,0 +1,32 @@
+package shells
+
+import (
+	"strings"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+// prefixShell runs the shell of the scripts with the command prefix of the
+// runner, like nice -n10, so it applies once to all the commands of the
+// scripts: the ones of the runner, like git, and the ones of the user
+func prefixShell(script *common.ShellConfiguration, info common.ShellScriptInfo) *common.ShellConfiguration {
+	if info.Build == nil || info.Build.Runner == nil {
+		return script
+	}
+
+	prefix := strings.Fields(info.Build.Runner.CommandPrefix)
+	if len(prefix) == 0 {
+		return script
+	}
+
+	if script.Command != "" {
+		arguments := append([]string{}, prefix[1:]...)
+		arguments = append(arguments, script.Command)
+		script.Arguments = append(arguments, script.Arguments...)
+		script.Command = prefix[0]
+	}
+	if len(script.DockerCommand) > 0 {
+		script.DockerCommand = append(append([]string{}, prefix...), script.DockerCommand...)
+	}
+	return script
+}
@@ -0,0 +1,67 @@
+package shells
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+func newCommandPrefixInfo(prefix string) common.ShellScriptInfo {
+	return common.ShellScriptInfo{
+		RunnerCommand: "gitlab-runner",
+		Build: &common.Build{
+			GetBuildResponse: common.GetBuildResponse{
+				Commands: "cd dir\nexport X=1\nmake",
+				Sha:      "1234567890abcdef",
+			},
+			Runner: &common.RunnerConfig{
+				RunnerSettings: common.RunnerSettings{CommandPrefix: prefix},
+			},
+		},
+	}
+}
+
+func TestCommandPrefix(t *testing.T) {
+	shell := &BashShell{Shell: "bash"}
+	info := newCommandPrefixInfo("nice -n10")
+
+	script, err := shell.GetConfiguration(info)
+	require.NoError(t, err)
+	assert.Equal(t, "nice", script.Command)
+	assert.Equal(t, []string{"-n10", "bash"}, script.Arguments)
+	assert.Equal(t, []string{"nice", "-n10", "sh", "-c"}, script.DockerCommand[:4])
+
+	info.Type = common.LoginShell
+	info.User = "user"
+	script, err = shell.GetConfiguration(info)
+	require.NoError(t, err)
+	assert.Equal(t, "nice", script.Command)
+	assert.Equal(t, []string{"-n10", "su"}, script.Arguments[:2])
+
+	writer := &BashWriter{}
+	err = shell.writeScript(writer, common.BuildStageUserScript, info)
+	require.NoError(t, err)
+	assert.Contains(t, writer.String(), "\ncd dir\n", "the lines of the scripts aren't prefixed")
+	assert.NotContains(t, writer.String(), "nice")
+}
+
+func TestCommandPrefixNotSet(t *testing.T) {
+	shell := &BashShell{Shell: "bash"}
+
+	script, err := shell.GetConfiguration(newCommandPrefixInfo(""))
+	require.NoError(t, err)
+	assert.Equal(t, "bash", script.Command)
+	assert.Empty(t, script.Arguments)
+}
+
+func TestCommandPrefixOfPowerShell(t *testing.T) {
+	shell := &PowerShell{Shell: "powershell"}
+
+	script, err := shell.GetConfiguration(newCommandPrefixInfo("start /low"))
+	require.NoError(t, err)
+	assert.Equal(t, "start", script.Command)
+	assert.Equal(t, []string{"/low", "powershell", "-noprofile"}, script.Arguments[:3])
+}
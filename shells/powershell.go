@@ -15,12 +15,40 @@ import (
 
 type PowerShell struct {
 	AbstractShell
+	// Shell is powershell, for Windows PowerShell, or pwsh, for PowerShell
+	// Core running on Linux and macOS too
+	Shell string
 }
 
 type PsWriter struct {
 	bytes.Buffer
 	TemporaryPath string
-	indent        int
+	// Shell is pwsh for the PowerShell Core scripts, which use slashes in
+	// the paths and LF line endings, to run on all the platforms
+	Shell string
+	// ErrorActionPreference is set at the start of the script, Stop when
+	// it's empty
+	ErrorActionPreference string
+	indent                int
+	commands              int
+	command               int
+}
+
+const psDefaultErrorActionPreference = "Stop"
+
+// psErrorActionPreferences are the values of $ErrorActionPreference usable
+// in the non-interactive scripts
+var psErrorActionPreferences = []string{"Stop", "Continue", "SilentlyContinue", "Ignore"}
+
+// parseErrorActionPreference returns the preference with the case used by
+// PowerShell, and false when it's not a valid one
+func parseErrorActionPreference(value string) (string, bool) {
+	for _, preference := range psErrorActionPreferences {
+		if strings.EqualFold(preference, value) {
+			return preference, true
+		}
+	}
+	return "", false
 }
 
 func psQuote(text string) string {
@@ -46,16 +74,72 @@ func psQuoteVariable(text string) string {
 	return text
 }
 
+func (b *PsWriter) isPwsh() bool {
+	return b.Shell == "pwsh"
+}
+
+func (b *PsWriter) resolvePath(path string) string {
+	if b.isPwsh() {
+		return helpers.ToSlash(path)
+	}
+	return helpers.ToBackslash(path)
+}
+
+// resolveLongPath returns the path for the cmdlets removing the files. Windows
+// PowerShell needs the extended-length paths for the ones longer than 260
+// characters, while pwsh supports them natively.
+func (b *PsWriter) resolveLongPath(path string) string {
+	if b.isPwsh() {
+		return helpers.ToSlash(path)
+	}
+	return helpers.ToExtendedLengthPath(path)
+}
+
 func (b *PsWriter) GetTemporaryPath() string {
 	return b.TemporaryPath
 }
 
+func (b *PsWriter) eol() string {
+	if b.isPwsh() {
+		return "\n"
+	}
+	return "\r\n"
+}
+
 func (b *PsWriter) Line(text string) {
-	b.WriteString(strings.Repeat("  ", b.indent) + text + "\r\n")
+	b.WriteString(strings.Repeat("  ", b.indent) + text + b.eol())
 }
 
 func (b *PsWriter) CheckForErrors() {
-	b.checkErrorLevel()
+	if b.command == 0 {
+		b.checkErrorLevel()
+		return
+	}
+
+	failed := psQuoteVariable(fmt.Sprintf("%sCommand %d failed with exit code ", helpers.ANSI_BOLD_RED, b.command))
+	b.Line(fmt.Sprintf("if(!$?) { $ci_exit_code = %s; %s; Write-Host (%s + $ci_exit_code + %s); Exit $ci_exit_code }",
+		b.exitCode(), b.commandSection("section_end"), failed, psQuoteVariable(helpers.ANSI_RESET)))
+	b.Line("")
+}
+
+func (b *PsWriter) commandSection(marker string) string {
+	return fmt.Sprintf(`Write-Host -NoNewline ("%s:" + [int](Get-Date -UFormat %%s) + %s)`,
+		marker, psQuoteVariable(fmt.Sprintf(":command_%d\r\033[0K", b.command)))
+}
+
+// StartCommand writes the section marker of the command, hidden by the
+// erase line sequence
+func (b *PsWriter) StartCommand() {
+	b.commands++
+	b.command = b.commands
+	b.Line(b.commandSection("section_start"))
+}
+
+// EndCommand closes the section of the command which succeeded, the one of
+// the failing command is closed before exiting
+func (b *PsWriter) EndCommand() {
+	b.Line(b.commandSection("section_end"))
+	b.command = 0
 }
 
 func (b *PsWriter) Indent() {
@@ -66,8 +150,14 @@ func (b *PsWriter) Unindent() {
 	b.indent--
 }
 
+func (b *PsWriter) exitCode() string {
+	// $LASTEXITCODE is not set when a cmdlet fails, and Exit $null exits
+	// with 0
+	return "&{if($LASTEXITCODE) {$LASTEXITCODE} else {1}}"
+}
+
 func (b *PsWriter) checkErrorLevel() {
-	b.Line("if(!$?) { Exit $LASTEXITCODE }")
+	b.Line("if(!$?) { Exit " + b.exitCode() + " }")
 	b.Line("")
 }
 
@@ -91,9 +181,13 @@ func (b *PsWriter) buildCommand(command string, arguments ...string) string {
 func (b *PsWriter) Variable(variable common.BuildVariable) {
 	if variable.File {
 		variableFile := b.Absolute(path.Join(b.TemporaryPath, variable.Key))
-		variableFile = helpers.ToBackslash(variableFile)
-		b.Line(fmt.Sprintf("md %s -Force | out-null", psQuote(helpers.ToBackslash(b.TemporaryPath))))
-		b.Line(fmt.Sprintf("Set-Content %s -Value %s -Encoding UTF8 -Force", psQuote(variableFile), psQuoteVariable(variable.Value)))
+		variableFile = b.resolvePath(variableFile)
+		b.MkDir(b.TemporaryPath)
+		value := psQuoteVariable(variable.Value)
+		if variable.Masked {
+			value = "$env:" + variable.Key
+		}
+		b.Line(fmt.Sprintf("Set-Content %s -Value %s -Encoding UTF8 -Force", psQuote(variableFile), value))
 		b.Line("$" + variable.Key + "=" + psQuote(variableFile))
 	} else {
 		b.Line("$" + variable.Key + "=" + psQuoteVariable(variable.Value))
@@ -103,12 +197,12 @@ func (b *PsWriter) Variable(variable common.BuildVariable) {
 }
 
 func (b *PsWriter) IfDirectory(path string) {
-	b.Line("if(Test-Path " + psQuote(helpers.ToBackslash(path)) + " -PathType Container) {")
+	b.Line("if(Test-Path -LiteralPath " + psQuote(b.resolvePath(path)) + " -PathType Container) {")
 	b.Indent()
 }
 
 func (b *PsWriter) IfFile(path string) {
-	b.Line("if(Test-Path " + psQuote(helpers.ToBackslash(path)) + " -PathType Leaf) {")
+	b.Line("if(Test-Path -LiteralPath " + psQuote(b.resolvePath(path)) + " -PathType Leaf) {")
 	b.Indent()
 }
 
@@ -130,44 +224,52 @@ func (b *PsWriter) EndIf() {
 }
 
 func (b *PsWriter) Cd(path string) {
-	b.Line("cd " + psQuote(helpers.ToBackslash(path)))
+	// -LiteralPath doesn't expand the wildcards, like [ and ], of the path
+	b.Line("Set-Location -LiteralPath " + psQuote(b.resolvePath(path)))
 	b.checkErrorLevel()
 }
 
 func (b *PsWriter) MkDir(path string) {
-	b.Line(fmt.Sprintf("md %s -Force | out-null", psQuote(helpers.ToBackslash(path))))
+	if b.isPwsh() {
+		// md is not an alias on all the platforms
+		b.Line(fmt.Sprintf("New-Item -ItemType Directory -Force -Path %s | out-null", psQuote(b.resolvePath(path))))
+		return
+	}
+	b.Line(fmt.Sprintf("md %s -Force | out-null", psQuote(b.resolvePath(path))))
 }
 
 func (b *PsWriter) MkTmpDir(name string) string {
-	path := helpers.ToBackslash(path.Join(b.TemporaryPath, name))
+	path := b.resolvePath(path.Join(b.TemporaryPath, name))
 	b.MkDir(path)
 
 	return path
 }
 
 func (b *PsWriter) RmDir(path string) {
-	path = psQuote(helpers.ToBackslash(path))
-	b.Line("if( (Get-Command -Name Remove-Item2 -Module NTFSSecurity -ErrorAction SilentlyContinue) -and (Test-Path " + path + " -PathType Container) ) {")
+	longPath := psQuote(b.resolveLongPath(path))
+	path = psQuote(b.resolvePath(path))
+	b.Line("if( (Get-Command -Name Remove-Item2 -Module NTFSSecurity -ErrorAction SilentlyContinue) -and (Test-Path -LiteralPath " + path + " -PathType Container) ) {")
 	b.Indent()
 	b.Line("Remove-Item2 -Force -Recurse " + path)
 	b.Unindent()
-	b.Line("} elseif(Test-Path " + path + ") {")
+	b.Line("} elseif(Test-Path -LiteralPath " + longPath + ") {")
 	b.Indent()
-	b.Line("Remove-Item -Force -Recurse " + path)
+	b.Line("Remove-Item -Force -Recurse -LiteralPath " + longPath)
 	b.Unindent()
 	b.Line("}")
 	b.Line("")
 }
 
 func (b *PsWriter) RmFile(path string) {
-	path = psQuote(helpers.ToBackslash(path))
-	b.Line("if( (Get-Command -Name Remove-Item2 -Module NTFSSecurity -ErrorAction SilentlyContinue) -and (Test-Path " + path + " -PathType Leaf) ) {")
+	longPath := psQuote(b.resolveLongPath(path))
+	path = psQuote(b.resolvePath(path))
+	b.Line("if( (Get-Command -Name Remove-Item2 -Module NTFSSecurity -ErrorAction SilentlyContinue) -and (Test-Path -LiteralPath " + path + " -PathType Leaf) ) {")
 	b.Indent()
 	b.Line("Remove-Item2 -Force " + path)
 	b.Unindent()
-	b.Line("} elseif(Test-Path " + path + ") {")
+	b.Line("} elseif(Test-Path -LiteralPath " + longPath + ") {")
 	b.Indent()
-	b.Line("Remove-Item -Force " + path)
+	b.Line("Remove-Item -Force -LiteralPath " + longPath)
 	b.Unindent()
 	b.Line("}")
 	b.Line("")
@@ -202,6 +304,11 @@ func (b *PsWriter) Absolute(dir string) string {
 		return dir
 	}
 
+	if b.isPwsh() {
+		b.Line("$CurrentDirectory = (Resolve-Path ./).Path")
+		return path.Join("$CurrentDirectory", dir)
+	}
+
 	b.Line("$CurrentDirectory = (Resolve-Path .\\).Path")
 	return filepath.Join("$CurrentDirectory", dir)
 }
@@ -210,39 +317,95 @@ func (b *PsWriter) Finish(trace bool) string {
 	var buffer bytes.Buffer
 	w := bufio.NewWriter(&buffer)
 
+	preference := b.ErrorActionPreference
+	if preference == "" {
+		preference = psDefaultErrorActionPreference
+	}
+
+	if b.isPwsh() {
+		// the script is passed on the stdin, where it's run line by line,
+		// so it's wrapped in a single script block
+		io.WriteString(w, "& {"+b.eol())
+	}
+	io.WriteString(w, "$ErrorActionPreference = "+psQuote(preference)+b.eol())
+	// the output of the native commands is decoded with the code page of
+	// the console otherwise, which mangles it on Windows
+	io.WriteString(w, "[Console]::OutputEncoding = [System.Text.Encoding]::UTF8"+b.eol())
+	io.WriteString(w, "$OutputEncoding = [System.Text.Encoding]::UTF8"+b.eol())
 	if trace {
-		io.WriteString(w, "Set-PSDebug -Trace 2\r\n")
+		io.WriteString(w, "Set-PSDebug -Trace 2"+b.eol())
 	}
 
 	io.WriteString(w, b.String())
+	if b.isPwsh() {
+		io.WriteString(w, "}\n\n")
+	}
 	w.Flush()
 	return buffer.String()
 }
 
 func (b *PowerShell) GetName() string {
-	return "powershell"
+	return b.Shell
 }
 
 func (b *PowerShell) GetConfiguration(info common.ShellScriptInfo) (script *common.ShellConfiguration, err error) {
+	if b.Shell == "pwsh" {
+		return prefixShell(b.getPwshConfiguration(info), info), nil
+	}
+
 	script = &common.ShellConfiguration{
 		Command:   "powershell",
 		Arguments: []string{"-noprofile", "-noninteractive", "-executionpolicy", "Bypass", "-command"},
 		PassFile:  true,
 		Extension: "ps1",
 	}
-	return
+	return prefixShell(script, info), nil
+}
+
+// getPwshConfiguration runs pwsh with the script on the stdin, so it can be
+// used by the executors not supporting the script files, like Docker
+func (b *PowerShell) getPwshConfiguration(info common.ShellScriptInfo) *common.ShellConfiguration {
+	arguments := []string{"-NoProfile", "-NoLogo", "-NonInteractive", "-ExecutionPolicy", "Bypass", "-Command", "-"}
+
+	script := &common.ShellConfiguration{
+		DockerCommand: append([]string{"pwsh"}, arguments...),
+		Extension:     "ps1",
+	}
+
+	if info.User != "" {
+		script.Command = "su"
+		script.Arguments = []string{info.User, "-c", "pwsh " + strings.Join(arguments, " ")}
+	} else {
+		script.Command = "pwsh"
+		script.Arguments = arguments
+	}
+	return script
 }
 
 func (b *PowerShell) GenerateScript(buildStage common.BuildStage, info common.ShellScriptInfo) (script string, err error) {
 	w := &PsWriter{
 		TemporaryPath: info.Build.FullProjectDir() + ".tmp",
+		Shell:         b.Shell,
+	}
+
+	if value := info.Build.GetAllVariables().Get(common.ErrorActionPreferenceVariable); value != "" {
+		preference, valid := parseErrorActionPreference(value)
+		if !valid {
+			w.Warning("Ignoring the invalid value %q of %s", value, common.ErrorActionPreferenceVariable)
+		}
+		w.ErrorActionPreference = preference
+	}
+
+	hostname := "$env:computername"
+	if w.isPwsh() {
+		hostname = "$([Environment]::MachineName)"
 	}
 
 	if buildStage == common.BuildStagePrepare {
 		if len(info.Build.Hostname) != 0 {
-			w.Line("echo \"Running on $env:computername via " + psQuoteVariable(info.Build.Hostname) + "...\"")
+			w.Line("echo \"Running on " + hostname + " via " + psQuoteVariable(info.Build.Hostname) + "...\"")
 		} else {
-			w.Line("echo \"Running on $env:computername...\"")
+			w.Line("echo \"Running on " + hostname + "...\"")
 		}
 	}
 
@@ -256,5 +419,6 @@ func (b *PowerShell) IsDefault() bool {
 }
 
 func init() {
-	common.RegisterShell(&PowerShell{})
+	common.RegisterShell(&PowerShell{Shell: "powershell"})
+	common.RegisterShell(&PowerShell{Shell: "pwsh"})
 }
@@ -1,16 +1,20 @@
 package shells
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
 )
 
 func TestPowershell_CommandShellEscapes(t *testing.T) {
 	writer := &PsWriter{}
 	writer.Command("foo", "x&(y)")
 
-	assert.Equal(t, "& \"foo\" \"x&(y)\"\r\nif(!$?) { Exit $LASTEXITCODE }\r\n\r\n", writer.String())
+	assert.Equal(t, "& \"foo\" \"x&(y)\"\r\nif(!$?) { Exit &{if($LASTEXITCODE) {$LASTEXITCODE} else {1}} }\r\n\r\n", writer.String())
 }
 
 func TestPowershell_IfCmdShellEscapes(t *testing.T) {
@@ -19,3 +23,125 @@ func TestPowershell_IfCmdShellEscapes(t *testing.T) {
 
 	assert.Equal(t, "& \"foo\" \"x&(y)\" 2>$null\r\nif($?) {\r\n", writer.String())
 }
+
+func TestPwsh_CommandChecksExitCode(t *testing.T) {
+	writer := &PsWriter{Shell: "pwsh"}
+	writer.Command("foo", "x&(y)")
+
+	assert.Equal(t, "& \"foo\" \"x&(y)\"\nif(!$?) { Exit &{if($LASTEXITCODE) {$LASTEXITCODE} else {1}} }\n\n", writer.String())
+}
+
+func TestPwsh_UsesSlashes(t *testing.T) {
+	writer := &PsWriter{Shell: "pwsh"}
+	writer.Cd("C:\\builds\\project")
+	writer.MkDir("/builds/project.tmp")
+
+	assert.Equal(t, "Set-Location -LiteralPath \"C:/builds/project\"\n"+
+		"if(!$?) { Exit &{if($LASTEXITCODE) {$LASTEXITCODE} else {1}} }\n\n"+
+		"New-Item -ItemType Directory -Force -Path \"/builds/project.tmp\" | out-null\n", writer.String())
+}
+
+func TestPwsh_Finish(t *testing.T) {
+	writer := &PsWriter{Shell: "pwsh"}
+	writer.EmptyLine()
+
+	assert.Equal(t, "& {\n"+
+		"$ErrorActionPreference = \"Stop\"\n"+
+		"[Console]::OutputEncoding = [System.Text.Encoding]::UTF8\n"+
+		"$OutputEncoding = [System.Text.Encoding]::UTF8\n"+
+		"echo \"\"\n"+
+		"}\n\n", writer.Finish(false))
+}
+
+func TestPowershell_Finish(t *testing.T) {
+	writer := &PsWriter{ErrorActionPreference: "Continue"}
+	writer.EmptyLine()
+
+	assert.Equal(t, "$ErrorActionPreference = \"Continue\"\r\n"+
+		"[Console]::OutputEncoding = [System.Text.Encoding]::UTF8\r\n"+
+		"$OutputEncoding = [System.Text.Encoding]::UTF8\r\n"+
+		"echo \"\"\r\n", writer.Finish(false))
+}
+
+func TestPowershell_ErrorActionPreference(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string
+		warning  bool
+	}{
+		{"", "$ErrorActionPreference = \"Stop\"", false},
+		{"continue", "$ErrorActionPreference = \"Continue\"", false},
+		{"SilentlyContinue", "$ErrorActionPreference = \"SilentlyContinue\"", false},
+		{"Inquire", "$ErrorActionPreference = \"Stop\"", true},
+	}
+
+	for _, test := range tests {
+		shell := &PowerShell{Shell: "powershell"}
+		info := common.ShellScriptInfo{
+			Build: &common.Build{
+				GetBuildResponse: common.GetBuildResponse{
+					Variables: common.BuildVariables{{Key: common.ErrorActionPreferenceVariable, Value: test.value}},
+				},
+				Runner: &common.RunnerConfig{},
+			},
+		}
+
+		script, err := shell.GenerateScript(common.BuildStageAfterScript, info)
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(script, test.expected+"\r\n"), test.value)
+		if test.warning {
+			assert.Contains(t, script, "Ignoring the invalid value", test.value)
+		} else {
+			assert.NotContains(t, script, "Ignoring the invalid value", test.value)
+		}
+	}
+}
+
+func TestPwsh_GetConfiguration(t *testing.T) {
+	shell := &PowerShell{Shell: "pwsh"}
+	assert.Equal(t, "pwsh", shell.GetName())
+
+	config, err := shell.GetConfiguration(common.ShellScriptInfo{})
+	require.NoError(t, err)
+	assert.Equal(t, "pwsh", config.Command)
+	assert.False(t, config.PassFile, "the script is passed on the stdin")
+	assert.Equal(t, "pwsh", config.DockerCommand[0])
+	assert.Equal(t, "-", config.Arguments[len(config.Arguments)-1])
+
+	config, err = shell.GetConfiguration(common.ShellScriptInfo{User: "build"})
+	require.NoError(t, err)
+	assert.Equal(t, "su", config.Command)
+	assert.Equal(t, "build", config.Arguments[0])
+}
+
+func TestPowershell_ReportsFailedCommand(t *testing.T) {
+	writer := &PsWriter{}
+	writer.StartCommand()
+	writer.CheckForErrors()
+
+	assert.Equal(t, "Write-Host -NoNewline (\"section_start:\" + [int](Get-Date -UFormat %s) + \":command_1`r\x1b[0K\")\r\n"+
+		"if(!$?) { $ci_exit_code = &{if($LASTEXITCODE) {$LASTEXITCODE} else {1}}; "+
+		"Write-Host -NoNewline (\"section_end:\" + [int](Get-Date -UFormat %s) + \":command_1`r\x1b[0K\"); Write-Host (\"\x1b[31;1mCommand 1 failed with exit code \" + $ci_exit_code + \"\x1b[0;m\"); Exit $ci_exit_code }\r\n\r\n",
+		writer.String())
+
+	writer.Reset()
+	writer.EndCommand()
+	writer.CheckForErrors()
+	assert.Equal(t, "Write-Host -NoNewline (\"section_end:\" + [int](Get-Date -UFormat %s) + \":command_1`r\x1b[0K\")\r\n"+
+		"if(!$?) { Exit &{if($LASTEXITCODE) {$LASTEXITCODE} else {1}} }\r\n\r\n", writer.String())
+}
+
+func TestPowershell_RmDirUsesExtendedLengthPaths(t *testing.T) {
+	writer := &PsWriter{}
+	writer.RmDir(`\\server\share\builds\project`)
+
+	assert.Contains(t, writer.String(), "Remove-Item2 -Force -Recurse \"\\\\server\\share\\builds\\project\"\r\n")
+	assert.Contains(t, writer.String(), "Remove-Item -Force -Recurse -LiteralPath \"\\\\?\\UNC\\server\\share\\builds\\project\"\r\n")
+}
+
+func TestPwsh_RmFileUsesSlashes(t *testing.T) {
+	writer := &PsWriter{Shell: "pwsh"}
+	writer.RmFile(`C:\builds\project\file`)
+
+	assert.Contains(t, writer.String(), "Remove-Item -Force -LiteralPath \"C:/builds/project/file\"\n")
+}
@@ -0,0 +1,28 @@
+package shells
+
+import "gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+
+// ScriptWriterFunc writes the script of the build stage with the writer
+type ScriptWriterFunc func(w ShellWriter, buildStage common.BuildStage, info common.ShellScriptInfo) error
+
+// ScriptTransformer wraps the writing of the scripts of the shells. It can
+// write to the script before and after calling next, or call next with a
+// writer wrapping the given one, e.g. to change the commands of the user
+// given to Line. The name of the shell is in info.Shell.
+type ScriptTransformer func(next ScriptWriterFunc) ScriptWriterFunc
+
+var scriptTransformers []ScriptTransformer
+
+// RegisterScriptTransformer registers the transformer for the scripts of
+// all the shells. It should be called in init, the transformers registered
+// later wrap the ones registered before.
+func RegisterScriptTransformer(transformer ScriptTransformer) {
+	scriptTransformers = append(scriptTransformers, transformer)
+}
+
+func transformScriptWriter(writer ScriptWriterFunc) ScriptWriterFunc {
+	for _, transformer := range scriptTransformers {
+		writer = transformer(writer)
+	}
+	return writer
+}
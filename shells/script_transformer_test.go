@@ -0,0 +1,86 @@
+package shells
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+type srunWriter struct {
+	ShellWriter
+}
+
+func (w srunWriter) Line(text string) {
+	w.ShellWriter.Line("srun " + text)
+}
+
+func withScriptTransformers(transformers []ScriptTransformer, f func()) {
+	saved := scriptTransformers
+	defer func() {
+		scriptTransformers = saved
+	}()
+
+	scriptTransformers = nil
+	for _, transformer := range transformers {
+		RegisterScriptTransformer(transformer)
+	}
+	f()
+}
+
+func TestScriptTransformers(t *testing.T) {
+	sccache := func(next ScriptWriterFunc) ScriptWriterFunc {
+		return func(w ShellWriter, buildStage common.BuildStage, info common.ShellScriptInfo) error {
+			if buildStage == common.BuildStageUserScript {
+				w.Variable(common.BuildVariable{Key: "RUSTC_WRAPPER", Value: "sccache"})
+			}
+			err := next(w, buildStage, info)
+			w.Line("# " + info.Shell)
+			return err
+		}
+	}
+	srun := func(next ScriptWriterFunc) ScriptWriterFunc {
+		return func(w ShellWriter, buildStage common.BuildStage, info common.ShellScriptInfo) error {
+			return next(srunWriter{w}, buildStage, info)
+		}
+	}
+
+	shell := &AbstractShell{}
+	writer := &BashWriter{}
+	info := common.ShellScriptInfo{
+		Shell: "bash",
+		Build: &common.Build{
+			GetBuildResponse: common.GetBuildResponse{
+				Commands: "make",
+			},
+			Runner: &common.RunnerConfig{},
+		},
+	}
+
+	withScriptTransformers([]ScriptTransformer{srun, sccache}, func() {
+		err := shell.writeScript(writer, common.BuildStageUserScript, info)
+		require.NoError(t, err)
+	})
+
+	script := writer.String()
+	assert.Contains(t, script, "export RUSTC_WRAPPER=$'sccache'\n")
+	assert.Contains(t, script, "srun make\n")
+	assert.NotContains(t, script, "srun # bash")
+	assert.Contains(t, script, "# bash\n")
+}
+
+func TestScriptTransformerErrors(t *testing.T) {
+	shell := &AbstractShell{}
+	info := common.ShellScriptInfo{Build: &common.Build{Runner: &common.RunnerConfig{}}}
+
+	noop := func(next ScriptWriterFunc) ScriptWriterFunc {
+		return next
+	}
+
+	withScriptTransformers([]ScriptTransformer{noop}, func() {
+		err := shell.writeScript(&BashWriter{}, common.BuildStage("unknown"), info)
+		assert.EqualError(t, err, "Not supported script type: unknown")
+	})
+}
@@ -8,6 +8,12 @@ type ShellWriter interface {
 	Line(text string)
 	CheckForErrors()
 
+	// StartCommand marks the start of the next command of the user, with
+	// its index and start time, so the command is reported when it fails
+	StartCommand()
+	// EndCommand marks the end of the command which succeeded
+	EndCommand()
+
 	IfDirectory(path string)
 	IfFile(file string)
 	IfCmd(cmd string, arguments ...string)
@@ -56,6 +56,8 @@ func TestMkDir(t *testing.T) {
 	require.NoError(t, err)
 
 	onShell(t, "bash", "bash", "sh", []string{}, &BashWriter{TemporaryPath: tmpDir})
+	onShell(t, "zsh", "zsh", "sh", []string{}, &BashWriter{TemporaryPath: tmpDir, Shell: "zsh"})
 	onShell(t, "cmd", "cmd.exe", "cmd", []string{"/Q", "/C"}, &CmdWriter{TemporaryPath: tmpDir})
 	onShell(t, "powershell", "powershell.exe", "ps1", []string{"-noprofile", "-noninteractive", "-executionpolicy", "Bypass", "-command"}, &PsWriter{TemporaryPath: tmpDir})
+	onShell(t, "pwsh", "pwsh", "ps1", []string{"-NoProfile", "-NonInteractive", "-File"}, &PsWriter{TemporaryPath: tmpDir, Shell: "pwsh"})
 }
@@ -0,0 +1,28 @@
+package tokenstores
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// runCommand runs the command with the input on its standard input, so the
+// tokens are not visible in the list of processes, and returns its output
+func runCommand(input string, name string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = strings.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return "", fmt.Errorf("%s: %v: %s", name, err, message)
+		}
+		return "", fmt.Errorf("%s: %v", name, err)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
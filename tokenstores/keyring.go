@@ -0,0 +1,63 @@
+package tokenstores
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"runtime"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers"
+)
+
+const keyringService = "gitlab-runner"
+
+// keyringStore saves the tokens in the keyring of the system: the keychain
+// on macOS and the secret service (libsecret) on Linux. The reference is the
+// short token followed by a hash of the token, used as the account of the
+// secret.
+type keyringStore struct {
+	goos string
+}
+
+// keyringReference returns the account of the token. The short token alone
+// isn't unique, as all the authentication tokens start with glrt-.
+func keyringReference(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return helpers.ShortenToken(token) + "-" + hex.EncodeToString(hash[:8])
+}
+
+func (s *keyringStore) Load(config *common.Config, reference string) (string, error) {
+	switch s.goos {
+	case "darwin":
+		return runCommand("", "security", "find-generic-password", "-s", keyringService, "-a", reference, "-w")
+	case "linux":
+		return runCommand("", "secret-tool", "lookup", "service", keyringService, "account", reference)
+	default:
+		return "", errors.New("the keyring is not supported on " + s.goos)
+	}
+}
+
+func (s *keyringStore) Store(config *common.Config, token string) (string, error) {
+	reference := keyringReference(token)
+
+	var err error
+	switch s.goos {
+	case "darwin":
+		// -w without a value, as the last option, prompts for the password
+		// and its confirmation, read from the standard input
+		_, err = runCommand(token+"\n"+token+"\n", "security", "add-generic-password", "-U", "-s", keyringService, "-a", reference, "-w")
+	case "linux":
+		_, err = runCommand(token, "secret-tool", "store", "--label", "GitLab Runner "+reference, "service", keyringService, "account", reference)
+	default:
+		err = errors.New("the keyring is not supported on " + s.goos)
+	}
+	if err != nil {
+		return "", err
+	}
+	return reference, nil
+}
+
+func init() {
+	common.RegisterTokenStore("keyring", &keyringStore{goos: runtime.GOOS})
+}
@@ -0,0 +1,99 @@
+package tokenstores
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const fakeSecretTool = `#!/bin/sh
+dir=$(dirname "$0")
+case "$1" in
+store) echo "$@" > "$dir/args"; cat > "$dir/secret-$7" ;;
+lookup) echo "$@" > "$dir/args"; cat "$dir/secret-$5" ;;
+esac
+`
+
+func TestKeyringStore(t *testing.T) {
+	withFakeCommand(t, "secret-tool", fakeSecretTool, func(dir string) {
+		path := os.Getenv("PATH")
+		defer os.Setenv("PATH", path)
+		os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+
+		store := &keyringStore{goos: "linux"}
+
+		reference, err := store.Store(nil, "abcdef123456")
+		require.NoError(t, err)
+		assert.Equal(t, "abcdef12-da4ec3358a10c9b0", reference)
+
+		token, err := store.Load(nil, reference)
+		require.NoError(t, err)
+		assert.Equal(t, "abcdef123456", token)
+	})
+}
+
+func TestKeyringStoreAuthenticationTokens(t *testing.T) {
+	withFakeCommand(t, "secret-tool", fakeSecretTool, func(dir string) {
+		path := os.Getenv("PATH")
+		defer os.Setenv("PATH", path)
+		os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+
+		store := &keyringStore{goos: "linux"}
+
+		tokens := []string{"glrt-first-runner-token", "glrt-second-runner-token"}
+		var references []string
+		for _, token := range tokens {
+			reference, err := store.Store(nil, token)
+			require.NoError(t, err)
+			references = append(references, reference)
+		}
+		assert.NotEqual(t, references[0], references[1], "the tokens sharing the prefix have their own entries")
+
+		for i, reference := range references {
+			token, err := store.Load(nil, reference)
+			require.NoError(t, err)
+			assert.Equal(t, tokens[i], token)
+		}
+	})
+}
+
+func TestKeyringStoreNotSupported(t *testing.T) {
+	store := &keyringStore{goos: "windows"}
+
+	_, err := store.Store(nil, "abcdef123456")
+	assert.EqualError(t, err, "the keyring is not supported on windows")
+}
+
+const fakeSecurity = `#!/bin/sh
+dir=$(dirname "$0")
+case "$1" in
+add-generic-password) echo "$@" > "$dir/args"; head -n 1 > "$dir/secret-$6" ;;
+find-generic-password) echo "$@" > "$dir/args"; cat "$dir/secret-$5" ;;
+esac
+`
+
+func TestKeyringStoreDarwin(t *testing.T) {
+	withFakeCommand(t, "security", fakeSecurity, func(dir string) {
+		path := os.Getenv("PATH")
+		defer os.Setenv("PATH", path)
+		os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+
+		store := &keyringStore{goos: "darwin"}
+
+		reference, err := store.Store(nil, "abcdef123456")
+		require.NoError(t, err)
+		assert.Equal(t, keyringReference("abcdef123456"), reference)
+
+		args, err := ioutil.ReadFile(filepath.Join(dir, "args"))
+		require.NoError(t, err)
+		assert.NotContains(t, string(args), "abcdef123456", "the token isn't in the arguments")
+
+		token, err := store.Load(nil, reference)
+		require.NoError(t, err)
+		assert.Equal(t, "abcdef123456", token)
+	})
+}
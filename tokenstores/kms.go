@@ -0,0 +1,36 @@
+package tokenstores
+
+import (
+	"errors"
+	"strings"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+// kmsStore encrypts the tokens with an external command, set by the
+// token_kms_command of the config, e.g. a wrapper of the CLI of a key
+// management service. The command is called with the encrypt or decrypt
+// argument, it reads the token or the ciphertext from the standard input and
+// writes the result to the standard output. The reference is the ciphertext.
+type kmsStore struct{}
+
+func (s *kmsStore) run(config *common.Config, action, input string) (string, error) {
+	command := strings.Fields(config.TokenKMSCommand)
+	if len(command) == 0 {
+		return "", errors.New("the token_kms_command is not set")
+	}
+
+	return runCommand(input, command[0], append(command[1:], action)...)
+}
+
+func (s *kmsStore) Load(config *common.Config, reference string) (string, error) {
+	return s.run(config, "decrypt", reference)
+}
+
+func (s *kmsStore) Store(config *common.Config, token string) (string, error) {
+	return s.run(config, "encrypt", token)
+}
+
+func init() {
+	common.RegisterTokenStore("kms", &kmsStore{})
+}
@@ -0,0 +1,94 @@
+package tokenstores
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+const fakeKMS = `#!/bin/sh
+case "$2" in
+encrypt) echo "$1:$(base64)" ;;
+decrypt) sed "s/^$1://" | base64 -d ;;
+*) echo "unknown action: $2" >&2; exit 1 ;;
+esac
+`
+
+func withFakeCommand(t *testing.T, name, script string, f func(dir string)) {
+	dir, err := ioutil.TempDir("", "tokenstores")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = ioutil.WriteFile(filepath.Join(dir, name), []byte(script), 0700)
+	require.NoError(t, err)
+	f(dir)
+}
+
+func TestKMSStore(t *testing.T) {
+	withFakeCommand(t, "kms", fakeKMS, func(dir string) {
+		config := &common.Config{TokenKMSCommand: filepath.Join(dir, "kms") + " key-1"}
+		store := &kmsStore{}
+
+		reference, err := store.Store(config, "the-token")
+		require.NoError(t, err)
+		assert.Equal(t, "key-1:dGhlLXRva2Vu", reference)
+
+		token, err := store.Load(config, reference)
+		require.NoError(t, err)
+		assert.Equal(t, "the-token", token)
+	})
+}
+
+func TestKMSStoreErrors(t *testing.T) {
+	store := &kmsStore{}
+
+	_, err := store.Load(&common.Config{}, "reference")
+	assert.EqualError(t, err, "the token_kms_command is not set")
+
+	withFakeCommand(t, "kms", "#!/bin/sh\necho 'access denied' >&2\nexit 1\n", func(dir string) {
+		command := filepath.Join(dir, "kms")
+		_, err := store.Load(&common.Config{TokenKMSCommand: command}, "reference")
+		assert.EqualError(t, err, command+": exit status 1: access denied")
+	})
+}
+
+func TestTokenStoreConfig(t *testing.T) {
+	withFakeCommand(t, "kms", fakeKMS, func(dir string) {
+		configFile := filepath.Join(dir, "config.toml")
+		config := common.NewConfig()
+		config.TokenKMSCommand = filepath.Join(dir, "kms") + " key-1"
+		config.Runners = []*common.RunnerConfig{
+			{RunnerCredentials: common.RunnerCredentials{URL: "https://gitlab.example.com/", Token: "the-token"}},
+			{RunnerCredentials: common.RunnerCredentials{URL: "https://gitlab.example.com/", Token: "plain-token"}},
+		}
+
+		require.NoError(t, config.StoreToken(config.Runners[0], "kms"))
+		require.NoError(t, config.SaveConfig(configFile))
+		assert.Equal(t, "the-token", config.Runners[0].Token, "the token is kept in memory")
+
+		data, err := ioutil.ReadFile(configFile)
+		require.NoError(t, err)
+		assert.NotContains(t, string(data), "the-token")
+		assert.Contains(t, string(data), `token = "kms:key-1:dGhlLXRva2Vu"`)
+		assert.Contains(t, string(data), `token = "plain-token"`)
+
+		loaded := common.NewConfig()
+		require.NoError(t, loaded.LoadConfig(configFile))
+		assert.Equal(t, "the-token", loaded.Runners[0].Token)
+		assert.Equal(t, "kms:key-1:dGhlLXRva2Vu", loaded.Runners[0].TokenReference())
+		assert.Equal(t, "plain-token", loaded.Runners[1].Token)
+		assert.Empty(t, loaded.Runners[1].TokenReference())
+	})
+}
+
+func TestStoreTokenUnknownStore(t *testing.T) {
+	config := common.NewConfig()
+	err := config.StoreToken(&common.RunnerConfig{}, "vault")
+	assert.EqualError(t, err, "Unknown token store: vault, supported: keyring, kms")
+}